@@ -1,9 +1,18 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"golang.org/x/text/encoding/htmlindex"
 	"gopkg.in/yaml.v3"
 )
 
@@ -14,6 +23,15 @@ type DatabaseConfig struct {
 	PostgreSQL     PostgresConfig `yaml:"postgres"`
 	SQLite         SQLiteConfig   `yaml:"sqlite"`
 	ConnectionPool PoolConfig     `yaml:"connection_pool"`
+
+	// TablePrefix and TableSuffix are added to every table name
+	TablePrefix string `yaml:"table_prefix"`
+	TableSuffix string `yaml:"table_suffix"`
+
+	// IDStrategy keys sensor_data rows: auto_increment, snowflake or composite.
+	// SnowflakeNode distinguishes concurrent importers generating snowflake IDs.
+	IDStrategy    string `yaml:"id_strategy"`
+	SnowflakeNode int64  `yaml:"snowflake_node"`
 }
 
 // MySQLConfig holds MySQL specific configuration
@@ -37,11 +55,48 @@ type PostgresConfig struct {
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
 	TimeZone string `yaml:"timezone"`
+	Schema   string `yaml:"schema"` // search_path for all tables; defaults to the server setting
 }
 
 // SQLiteConfig holds SQLite specific configuration
 type SQLiteConfig struct {
+	// Path is the database file, or ":memory:" for a database that lives
+	// only as long as the process
 	Path string `yaml:"path"`
+
+	// BulkMode trades durability for import speed: WAL journaling,
+	// synchronous=OFF, a larger page cache and one transaction per file
+	BulkMode bool `yaml:"bulk_mode"`
+	// CacheSizeMB is the page cache of each connection in bulk mode (default 256)
+	CacheSizeMB int `yaml:"cache_size_mb"`
+}
+
+// DefaultSQLiteCacheSizeMB is the page cache of a connection in bulk mode
+const DefaultSQLiteCacheSizeMB = 256
+
+// BulkCacheSizeMB returns the page cache of a connection in bulk mode
+func (s SQLiteConfig) BulkCacheSizeMB() int {
+	if s.CacheSizeMB == 0 {
+		return DefaultSQLiteCacheSizeMB
+	}
+	return s.CacheSizeMB
+}
+
+// bulkParams returns the connection parameters of bulk mode. Transactions
+// take the write lock when they begin, and wait for another worker's file
+// for up to ten minutes, so a file transaction never fails for lack of it.
+func (s SQLiteConfig) bulkParams() string {
+	// A negative cache size is in KiB rather than pages
+	return fmt.Sprintf("_journal_mode=WAL&_synchronous=OFF&_cache_size=-%d&_busy_timeout=600000&_txlock=immediate",
+		s.BulkCacheSizeMB()*1024)
+}
+
+// SQLiteMemory is the sqlite path of an in-memory database
+const SQLiteMemory = ":memory:"
+
+// InMemory reports whether the database is kept in memory
+func (s SQLiteConfig) InMemory() bool {
+	return s.Path == SQLiteMemory
 }
 
 // PoolConfig holds connection pool configuration
@@ -49,6 +104,38 @@ type PoolConfig struct {
 	MaxIdleConns    int `yaml:"max_idle_conns"`
 	MaxOpenConns    int `yaml:"max_open_conns"`
 	ConnMaxLifetime int `yaml:"conn_max_lifetime"`
+
+	// MonitorInterval is how often pool utilization is checked during imports,
+	// in seconds; a negative value disables the monitor
+	MonitorInterval int `yaml:"monitor_interval"`
+}
+
+// Connection pool defaults, used when a setting is missing or zero
+const (
+	DefaultMaxOpenConns    = 25
+	DefaultMaxIdleConns    = 10
+	DefaultConnMaxLifetime = 3600 // seconds
+)
+
+// WithDefaults returns the pool settings with the defaults in place of
+// missing or zero values, and the names of the settings it defaulted. An
+// idle limit above the open limit is lowered to it.
+func (p PoolConfig) WithDefaults() (PoolConfig, []string) {
+	var defaulted []string
+	if p.MaxOpenConns == 0 {
+		p.MaxOpenConns = DefaultMaxOpenConns
+		defaulted = append(defaulted, fmt.Sprintf("max_open_conns=%d", p.MaxOpenConns))
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = min(DefaultMaxIdleConns, p.MaxOpenConns)
+		defaulted = append(defaulted, fmt.Sprintf("max_idle_conns=%d", p.MaxIdleConns))
+	}
+	if p.ConnMaxLifetime == 0 {
+		p.ConnMaxLifetime = DefaultConnMaxLifetime
+		defaulted = append(defaulted, fmt.Sprintf("conn_max_lifetime=%d", p.ConnMaxLifetime))
+	}
+	p.MaxIdleConns = min(p.MaxIdleConns, p.MaxOpenConns)
+	return p, defaulted
 }
 
 // MigrationConfig holds migration specific configuration
@@ -57,6 +144,128 @@ type MigrationConfig struct {
 	MigrationTable string `yaml:"migration_table"`
 }
 
+// ServerConfig holds the settings of the HTTP API started by the serve command
+type ServerConfig struct {
+	// Listen is the address to serve on; addresses other hosts can reach
+	// require APIToken
+	Listen string `yaml:"listen"`
+	// APIToken, when set, must be sent as "Authorization: Bearer <token>"
+	APIToken string `yaml:"api_token"`
+	// MaxStreams limits the concurrent gRPC streams per client connection;
+	// 0 keeps the HTTP/2 default of 100
+	MaxStreams int `yaml:"max_streams"`
+	// ExportWorkers is how many time chunks of an export are read at once;
+	// 0 or 1 reads the whole range with one query
+	ExportWorkers int `yaml:"export_workers"`
+	// ExportChunk is the time range of each chunk read by the export
+	// workers (default 24h)
+	ExportChunk string `yaml:"export_chunk"`
+	// RateLimit caps the readings pushed over HTTP and gRPC per second,
+	// across all clients; 0 for no limit
+	RateLimit float64 `yaml:"rate_limit"`
+	// AdminToken enables the admin API under /api/v1/admin, which changes
+	// the log level, export workers and rate limit at runtime; it must be
+	// sent as "Authorization: Bearer <token>"
+	AdminToken string `yaml:"admin_token"`
+}
+
+// DefaultExportChunk is the time range of each chunk read by export workers
+const DefaultExportChunk = 24 * time.Hour
+
+// ExportChunkDuration returns the time range of each chunk read by the
+// export workers
+func (s ServerConfig) ExportChunkDuration() time.Duration {
+	chunk, err := time.ParseDuration(s.ExportChunk)
+	if err != nil || chunk <= 0 {
+		return DefaultExportChunk
+	}
+	return chunk
+}
+
+// DisplayConfig holds how timestamps and numbers are shown in summaries and
+// reports. Stored data and machine-readable output are not affected.
+type DisplayConfig struct {
+	// Timezone is the IANA timezone of displayed timestamps (e.g.
+	// Asia/Tokyo); empty keeps each timestamp's own zone
+	Timezone string `yaml:"timezone"`
+	// Locale selects the digit grouping and decimal separators (e.g. ja-JP,
+	// de-DE); empty shows plain numbers
+	Locale string `yaml:"locale"`
+}
+
+// ControlConfig holds the local control socket of watch and serve, which
+// the status command queries
+type ControlConfig struct {
+	// Socket is the Unix domain socket, or named pipe on Windows, to listen
+	// on; default sensor_data_import.sock in the working directory, or
+	// \\.\pipe\sensor_data_import on Windows
+	Socket string `yaml:"socket"`
+	// Disabled turns the control socket off
+	Disabled bool `yaml:"disabled"`
+}
+
+// IngestConfig holds the settings of the ingest commands, which read
+// readings from message brokers instead of files
+type IngestConfig struct {
+	// FlushInterval is the longest time received readings wait before they
+	// are inserted, e.g. "5s" (default); a full batch is inserted right away
+	FlushInterval string `yaml:"flush_interval"`
+	// QueueFile is a local SQLite database that holds received readings
+	// until they are inserted. Messages are acknowledged once queued, so an
+	// outage of the database or a crash loses none; empty keeps the readings
+	// in memory, unacknowledged.
+	QueueFile string `yaml:"queue_file"`
+	// QueueSize is how many readings are held while inserts fail, default
+	// 100 batches. A full queue file stops taking messages until the
+	// database catches up; a full in-memory queue ends the ingest.
+	QueueSize int         `yaml:"queue_size"`
+	MQTT      MQTTConfig  `yaml:"mqtt"`
+	Kafka     KafkaConfig `yaml:"kafka"`
+}
+
+// MQTTConfig connects ingest:mqtt to a broker
+type MQTTConfig struct {
+	Broker   string   `yaml:"broker"`    // tcp://host:1883, or ssl://host:8883 for TLS
+	ClientID string   `yaml:"client_id"` // Default sensor_data_import-<hostname>
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	Topics   []string `yaml:"topics"` // Topic filters, wildcards + and # allowed
+	// QoS is the subscription quality of service: 0 (at most once) or 1 (at
+	// least once, acknowledged after the readings are committed; default)
+	QoS *int `yaml:"qos"`
+	// CleanSession discards the subscription and undelivered messages when
+	// the importer disconnects
+	CleanSession bool   `yaml:"clean_session"`
+	KeepAlive    string `yaml:"keep_alive"` // e.g. "60s" (default)
+	// PayloadFormat is json (an object or array of objects with the
+	// scanner json_fields), csv (timestamp,sensor_name,value lines) or auto
+	PayloadFormat string `yaml:"payload_format"`
+}
+
+// KafkaConfig connects ingest:kafka to a Kafka cluster
+type KafkaConfig struct {
+	Brokers  []string        `yaml:"brokers"` // Bootstrap brokers, e.g. kafka-1:9092
+	Topics   []string        `yaml:"topics"`
+	GroupID  string          `yaml:"group_id"`  // Consumer group whose committed offsets are resumed (default sensor_data_import)
+	ClientID string          `yaml:"client_id"` // Default sensor_data_import
+	TLS      bool            `yaml:"tls"`
+	SASL     KafkaSASLConfig `yaml:"sasl"`
+	// AutoOffsetReset is where a partition without a committed offset is
+	// read from: earliest (default) or latest
+	AutoOffsetReset string `yaml:"auto_offset_reset"`
+	SessionTimeout  string `yaml:"session_timeout"` // e.g. "30s" (default)
+	// PayloadFormat is json, csv or auto, as for MQTT
+	PayloadFormat string `yaml:"payload_format"`
+}
+
+// KafkaSASLConfig authenticates the Kafka consumer
+type KafkaSASLConfig struct {
+	// Mechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512; empty disables SASL
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"` // ${VAR} is read from the environment
+}
+
 // LoggingConfig holds logging specific configuration
 type LoggingConfig struct {
 	LogFile      string `yaml:"log_file"`
@@ -64,11 +273,340 @@ type LoggingConfig struct {
 	LogLevel     string `yaml:"log_level"`
 }
 
+// ScannerConfig holds CSV scanner specific configuration
+type ScannerConfig struct {
+	FilenamePattern string `yaml:"filename_pattern"`
+	FilenamePolicy  string `yaml:"filename_policy"`
+	AcceptFrom      string `yaml:"accept_from"`
+	AcceptTo        string `yaml:"accept_to"`
+	IngestMode      string `yaml:"ingest_mode"`
+	Recursive       bool   `yaml:"recursive"`
+
+	// FilenameRegex is a regular expression whose named groups, such as
+	// (?P<site>...) and (?P<sensor_name>...), supply the sensor of rows
+	// without one; FilenameSensorName builds it from them (default
+	// "{sensor_name}")
+	FilenameRegex      string `yaml:"filename_regex"`
+	FilenameSensorName string `yaml:"filename_sensor_name"`
+
+	// BatchSize is the number of readings per insert statement (default 1000),
+	// WorkerCount the number of files imported in parallel (default: CPU cores,
+	// at most 8) and MaxRowsInMemory the number of CSV rows a worker reads
+	// before inserting them (default 0: whole files)
+	BatchSize       int `yaml:"batch_size"`
+	WorkerCount     int `yaml:"worker_count"`
+	MaxRowsInMemory int `yaml:"max_rows_in_memory"`
+
+	// InsertWorkers is the number of workers inserting the batches of each
+	// file while it is parsed (default 1)
+	InsertWorkers int `yaml:"insert_workers"`
+
+	// LoadMethod is how batches are written: insert (default), copy, which
+	// streams them with COPY FROM STDIN on PostgreSQL, or staging, which loads
+	// them into an unindexed temporary table and merges it with one statement
+	LoadMethod string `yaml:"load_method"`
+
+	// WatchRampUp is how long watch mode waits before starting each additional
+	// worker on a burst of files, e.g. "2s" (default); "0" starts them all at once
+	WatchRampUp string `yaml:"watch_ramp_up"`
+
+	// WatchRetryAttempts is how often watch mode tries to import a file that
+	// keeps failing before giving up (default 5; 1 disables retries), and
+	// WatchRetryDelay the wait before the first retry, doubled for each
+	// further one, e.g. "30s" (default)
+	WatchRetryAttempts int    `yaml:"watch_retry_attempts"`
+	WatchRetryDelay    string `yaml:"watch_retry_delay"`
+
+	// IncludeSensors and ExcludeSensors select the sensors imported, by exact
+	// name or glob pattern
+	IncludeSensors []string `yaml:"include_sensors"`
+	ExcludeSensors []string `yaml:"exclude_sensors"`
+
+	// FilePatterns and ExcludeFiles select the files of a directory that are
+	// imported, by glob pattern on the file name, or on the relative path
+	// when the pattern has a slash
+	FilePatterns []string `yaml:"file_patterns"`
+	ExcludeFiles []string `yaml:"exclude_files"`
+
+	// ValueTransforms rewrite the values of matching sensors while parsing,
+	// before they are checked and validated
+	ValueTransforms []ValueTransformConfig `yaml:"value_transforms"`
+
+	// Aggregations store the readings of matching sensors as per-interval
+	// min/max/avg/count aggregates instead of individual rows
+	Aggregations []AggregationConfig `yaml:"aggregations"`
+
+	MaxAbsValue        float64  `yaml:"max_abs_value"`
+	MagnitudeWhitelist []string `yaml:"magnitude_whitelist"`
+
+	// MaxErrors fails a file once it has more parsing errors than this: a
+	// count such as 1000 or a share of its rows such as 5% (default: no limit)
+	MaxErrors string `yaml:"max_errors"`
+
+	// InsertPolicy handles rows that already exist: error, skip or update
+	InsertPolicy string `yaml:"insert_policy"`
+	// UpsertWindow, e.g. "24h", overwrites existing readings newer than this
+	// and skips older duplicates, replacing InsertPolicy for sources that
+	// resend a rolling window
+	UpsertWindow string `yaml:"upsert_window"`
+
+	DuplicatePrecedence   string   `yaml:"duplicate_precedence"`
+	PrecedenceDirectories []string `yaml:"precedence_directories"`
+
+	JSONFields JSONFieldsConfig `yaml:"json_fields"`
+
+	// Layout is long (timestamp,sensor_name,value) or wide (one column per sensor)
+	Layout          string `yaml:"layout"`
+	WideMappingFile string `yaml:"wide_mapping_file"`
+
+	// SensorAliasFile maps former sensor names to canonical ones; UnknownSensors
+	// is keep (default) or reject for names it does not list
+	SensorAliasFile string `yaml:"sensor_alias_file"`
+	UnknownSensors  string `yaml:"unknown_sensors"`
+
+	// SkipLines and HeaderMarker skip metadata preamble lines before the header row
+	SkipLines    int    `yaml:"skip_lines"`
+	HeaderMarker string `yaml:"header_marker"`
+
+	// TimestampFormats are Go time layouts tried in order when parsing timestamps
+	TimestampFormats []string `yaml:"timestamp_formats"`
+
+	// SourceTimezone is the IANA zone of timestamps without an offset (default UTC);
+	// TimezoneOverrides set a different zone for files matching a pattern
+	SourceTimezone    string                   `yaml:"source_timezone"`
+	TimezoneOverrides []TimezoneOverrideConfig `yaml:"timezone_overrides"`
+
+	// Encoding is the character encoding of source files, such as shift_jis,
+	// utf-16le or windows-1252; auto (default) detects a byte order mark,
+	// UTF-16 and Shift-JIS. EncodingOverrides set it for files matching a pattern.
+	Encoding          string                   `yaml:"encoding"`
+	EncodingOverrides []EncodingOverrideConfig `yaml:"encoding_overrides"`
+
+	// NumberFormat is how values are written in CSV files: standard (default,
+	// 1234.5), decimal_point (1,234.5) or decimal_comma (1.234,5).
+	// NumberFormatOverrides set it for files matching a pattern.
+	NumberFormat          string                       `yaml:"number_format"`
+	NumberFormatOverrides []NumberFormatOverrideConfig `yaml:"number_format_overrides"`
+
+	// FooterPatterns are regular expressions matching summary rows to skip,
+	// applied to each row's cells joined by commas
+	FooterPatterns []string `yaml:"footer_patterns"`
+
+	// ColumnMappings locate columns explicitly for files matching a pattern
+	ColumnMappings []ColumnMappingConfig `yaml:"column_mappings"`
+
+	// ColumnSynonyms adds header names recognized for timestamp, sensor_name and value
+	ColumnSynonyms map[string][]string `yaml:"column_synonyms"`
+
+	// RejectDir receives the <file>.rejects.csv files of rejected rows
+	// (default: next to each source file)
+	RejectDir string `yaml:"reject_dir"`
+
+	// ChangelogFile receives insert/update change events as JSON Lines
+	ChangelogFile string `yaml:"changelog_file"`
+
+	// JournalFile receives a checksummed JSON Lines record of every file
+	// imported, failed or reverted on this host
+	JournalFile string `yaml:"journal_file"`
+
+	// SpoolFile is a local SQLite database that keeps parsed readings while
+	// the database is unreachable; they are inserted once it is back
+	SpoolFile string `yaml:"spool_file"`
+
+	AfterImport AfterImportConfig `yaml:"after_import"`
+
+	Validation ValidationConfig `yaml:"validation"`
+
+	// HTTP controls downloads when scanning http:// or https:// URLs
+	HTTP HTTPSourceConfig `yaml:"http"`
+
+	// S3 holds the credentials and region used when scanning s3:// URLs
+	S3 S3SourceConfig `yaml:"s3"`
+
+	// SFTP holds the credentials used when scanning sftp:// URLs
+	SFTP SFTPSourceConfig `yaml:"sftp"`
+}
+
+// ColumnMappingConfig locates the reading columns for files matching a glob
+// pattern. Each column is a header name, a zero-based column index or an
+// expression over the row's cells.
+type ColumnMappingConfig struct {
+	Files      string `yaml:"files"`
+	Timestamp  string `yaml:"timestamp"`
+	SensorName string `yaml:"sensor_name"`
+	Value      string `yaml:"value"`
+}
+
+// TimezoneOverrideConfig sets the source timezone for files matching a glob pattern
+type TimezoneOverrideConfig struct {
+	Files    string `yaml:"files"`
+	Timezone string `yaml:"timezone"`
+}
+
+// EncodingOverrideConfig sets the character encoding for files matching a glob pattern
+type EncodingOverrideConfig struct {
+	Files    string `yaml:"files"`
+	Encoding string `yaml:"encoding"`
+}
+
+// NumberFormatOverrideConfig sets the number format for files matching a glob pattern
+type NumberFormatOverrideConfig struct {
+	Files  string `yaml:"files"`
+	Format string `yaml:"format"`
+}
+
+// ValueTransformConfig converts the values of sensors matching a glob pattern
+// with an arithmetic expression over value, such as "value * 0.1 + 2.5";
+// the first matching transform applies
+type ValueTransformConfig struct {
+	Sensors    string `yaml:"sensors"`
+	Expression string `yaml:"expression"`
+}
+
+// AggregationConfig stores the readings of sensors matching a glob pattern as
+// aggregates over an interval such as 1m; the first matching aggregation applies
+type AggregationConfig struct {
+	Sensors  string `yaml:"sensors"`
+	Interval string `yaml:"interval"`
+}
+
+// AfterImportConfig is applied to each source file once it was imported
+type AfterImportConfig struct {
+	// Action is none, archive (move to ArchiveDir), rename (append Suffix) or delete
+	Action string `yaml:"action"`
+	// ArchiveDir is relative to the scanned directory unless absolute
+	ArchiveDir string `yaml:"archive_dir"`
+	Suffix     string `yaml:"suffix"`
+}
+
+// HTTPSourceConfig controls how remote files are downloaded
+type HTTPSourceConfig struct {
+	// Timeout bounds each download attempt, e.g. "60s" (default)
+	Timeout string `yaml:"timeout"`
+	// Attempts is how often a download is tried before giving up (default 3)
+	Attempts int `yaml:"attempts"`
+	// RetryDelay is the wait before the first retry, doubled for each further one (default "2s")
+	RetryDelay string `yaml:"retry_delay"`
+	// Headers are sent with every request, e.g. Authorization; ${VAR} in a
+	// value is replaced by the environment variable
+	Headers map[string]string `yaml:"headers"`
+}
+
+// S3SourceConfig locates and authenticates the S3 buckets scanned through
+// s3://bucket/prefix URLs. Empty settings fall back to the standard AWS_*
+// environment variables; without credentials requests are sent unsigned,
+// which works for public buckets. ${VAR} in a value is replaced by the
+// environment variable.
+type S3SourceConfig struct {
+	Region          string `yaml:"region"`   // e.g. eu-central-1 (default: AWS_REGION, then us-east-1)
+	Endpoint        string `yaml:"endpoint"` // S3-compatible service such as MinIO, e.g. http://minio:9000
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"` // Temporary credentials only
+	// PathStyle addresses buckets as endpoint/bucket instead of bucket.endpoint,
+	// as most S3-compatible services require
+	PathStyle bool `yaml:"path_style"`
+}
+
+// SFTPSourceConfig authenticates the servers scanned through
+// sftp://user@host/path URLs. ${VAR} in a value is replaced by the
+// environment variable.
+type SFTPSourceConfig struct {
+	KeyFile       string `yaml:"key_file"`       // Private key, e.g. ~/.ssh/id_ed25519
+	KeyPassphrase string `yaml:"key_passphrase"` // For an encrypted private key
+	Password      string `yaml:"password"`       // Password authentication, tried after the key
+	// KnownHosts verifies the server's host key (default ~/.ssh/known_hosts)
+	KnownHosts string `yaml:"known_hosts"`
+	// InsecureIgnoreHostKey accepts any host key; only for testing
+	InsecureIgnoreHostKey bool `yaml:"insecure_ignore_host_key"`
+	// Timeout bounds connecting and authenticating, e.g. "30s" (default)
+	Timeout string `yaml:"timeout"`
+	// DeleteAfterImport removes each file from the server once it was imported successfully
+	DeleteAfterImport bool `yaml:"delete_after_import"`
+}
+
+// ValidationConfig declares which readings are plausible. Readings breaking a
+// rule are rejected and counted as violations instead of parsing errors.
+type ValidationConfig struct {
+	// SensorNamePattern is a regular expression every sensor name must match
+	SensorNamePattern string                 `yaml:"sensor_name_pattern"`
+	Rules             []ValidationRuleConfig `yaml:"rules"`
+	// Calendar is the planned downtime left out of interval gaps
+	Calendar CalendarConfig `yaml:"calendar"`
+}
+
+// CalendarConfig describes when sensors are not expected to report, so
+// planned downtime is not reported as gaps
+type CalendarConfig struct {
+	// Timezone is the IANA zone of the weekdays, dates and times below (default UTC)
+	Timezone       string           `yaml:"timezone"`
+	ClosedWeekdays []string         `yaml:"closed_weekdays"` // e.g. [saturday, sunday]
+	Holidays       []string         `yaml:"holidays"`        // Dates such as 2025-12-25
+	Shutdowns      []ShutdownConfig `yaml:"shutdowns"`
+}
+
+// ShutdownConfig is a planned shutdown from a date or time to another,
+// inclusive; a date as To includes the whole day
+type ShutdownConfig struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// CalendarTimeLayouts are the layouts accepted for shutdown bounds
+var CalendarTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// ValidationRuleConfig constrains the readings of sensors matching a glob
+// pattern; the first matching rule applies
+type ValidationRuleConfig struct {
+	Sensors      string    `yaml:"sensors"`
+	Min          *float64  `yaml:"min"`
+	Max          *float64  `yaml:"max"`
+	RejectValues []float64 `yaml:"reject_values"` // Sentinels such as -999
+	// Interval is the expected reporting interval (e.g. 5m). Readings closer
+	// together or further apart than Interval ± IntervalTolerance (a fraction,
+	// default 0.5) are reported but still imported.
+	Interval          string  `yaml:"interval"`
+	IntervalTolerance float64 `yaml:"interval_tolerance"`
+}
+
+// JSONFieldsConfig names the JSON Lines properties holding each reading field
+type JSONFieldsConfig struct {
+	Timestamp  string `yaml:"timestamp"`
+	SensorName string `yaml:"sensor_name"`
+	Value      string `yaml:"value"`
+}
+
+// identifierPattern matches table name affixes and schema names that are safe to use unquoted
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
+
+// DefaultTimestampFormats are the layouts tried when timestamp_formats is not set
+var DefaultTimestampFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// DefaultFooterPatterns match common total/summary rows written by spreadsheet exports
+var DefaultFooterPatterns = []string{
+	`(?i)^\s*(grand\s+total|sub-?total|total|sum|summary|average|avg|count)\b`,
+}
+
 // Config holds the complete application configuration
 type Config struct {
+	// Dataset selects a logical dataset with its own set of tables
+	Dataset string `yaml:"dataset"`
+
 	Database  DatabaseConfig  `yaml:"database"`
 	Migration MigrationConfig `yaml:"migration"`
 	Logging   LoggingConfig   `yaml:"logging"`
+	Scanner   ScannerConfig   `yaml:"scanner"`
+	Server    ServerConfig    `yaml:"server"`
+	Control   ControlConfig   `yaml:"control"`
+	Ingest    IngestConfig    `yaml:"ingest"`
+	Display   DisplayConfig   `yaml:"display"`
+
+	// ScanProfiles holds named scanner option sets layered over Scanner
+	ScanProfiles map[string]yaml.Node `yaml:"scan_profiles"`
 }
 
 // Load loads configuration from the specified YAML file
@@ -84,11 +622,24 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	// Parse the YAML
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	// Parse the YAML, then check it against the schema so typos and values
+	// of the wrong type are reported instead of leaving settings at zero
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	var config Config
+	decodeErr := root.Decode(&config)
+	var typeErr *yaml.TypeError
+	if decodeErr != nil && !errors.As(decodeErr, &typeErr) {
+		return nil, fmt.Errorf("failed to parse config file: %w", decodeErr)
+	}
+	if err := checkSchema(&root, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", configPath, err)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", decodeErr)
+	}
 
 	// Set default values for logging if not specified
 	if config.Logging.LogFile == "" {
@@ -98,6 +649,85 @@ func Load(configPath string) (*Config, error) {
 		config.Logging.LogLevel = "info"
 	}
 
+	if config.Database.IDStrategy == "" {
+		config.Database.IDStrategy = "auto_increment"
+	}
+
+	// Set default values for scanner if not specified
+	if config.Scanner.FilenamePolicy == "" {
+		config.Scanner.FilenamePolicy = "warn"
+	}
+	if config.Scanner.IngestMode == "" {
+		config.Scanner.IngestMode = "direct"
+	}
+	if config.Scanner.JSONFields.Timestamp == "" {
+		config.Scanner.JSONFields.Timestamp = "timestamp"
+	}
+	if config.Scanner.JSONFields.SensorName == "" {
+		config.Scanner.JSONFields.SensorName = "sensor_name"
+	}
+	if config.Scanner.JSONFields.Value == "" {
+		config.Scanner.JSONFields.Value = "value"
+	}
+
+	if len(config.Scanner.TimestampFormats) == 0 {
+		config.Scanner.TimestampFormats = DefaultTimestampFormats
+	}
+
+	if config.Scanner.InsertPolicy == "" {
+		config.Scanner.InsertPolicy = "error"
+	}
+
+	if config.Scanner.FooterPatterns == nil {
+		config.Scanner.FooterPatterns = DefaultFooterPatterns
+	}
+
+	if config.Scanner.AfterImport.Action == "" {
+		config.Scanner.AfterImport.Action = "none"
+	}
+	if config.Scanner.AfterImport.ArchiveDir == "" {
+		config.Scanner.AfterImport.ArchiveDir = "archive"
+	}
+	if config.Scanner.AfterImport.Suffix == "" {
+		config.Scanner.AfterImport.Suffix = ".imported"
+	}
+
+	if config.Scanner.HTTP.Timeout == "" {
+		config.Scanner.HTTP.Timeout = "60s"
+	}
+	if config.Scanner.HTTP.Attempts == 0 {
+		config.Scanner.HTTP.Attempts = 3
+	}
+	if config.Scanner.HTTP.RetryDelay == "" {
+		config.Scanner.HTTP.RetryDelay = "2s"
+	}
+
+	if config.Server.Listen == "" {
+		config.Server.Listen = "127.0.0.1:8080"
+	}
+
+	if config.Ingest.FlushInterval == "" {
+		config.Ingest.FlushInterval = "5s"
+	}
+	if config.Ingest.MQTT.KeepAlive == "" {
+		config.Ingest.MQTT.KeepAlive = "60s"
+	}
+	if config.Ingest.MQTT.PayloadFormat == "" {
+		config.Ingest.MQTT.PayloadFormat = "auto"
+	}
+	if config.Ingest.Kafka.GroupID == "" {
+		config.Ingest.Kafka.GroupID = "sensor_data_import"
+	}
+	if config.Ingest.Kafka.AutoOffsetReset == "" {
+		config.Ingest.Kafka.AutoOffsetReset = "earliest"
+	}
+	if config.Ingest.Kafka.SessionTimeout == "" {
+		config.Ingest.Kafka.SessionTimeout = "30s"
+	}
+	if config.Ingest.Kafka.PayloadFormat == "" {
+		config.Ingest.Kafka.PayloadFormat = "auto"
+	}
+
 	// Validate the configuration
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -129,18 +759,541 @@ func (c *Config) Validate() error {
 		if c.Database.PostgreSQL.DBName == "" {
 			return fmt.Errorf("postgres database name is required")
 		}
+		if !identifierPattern.MatchString(c.Database.PostgreSQL.Schema) {
+			return fmt.Errorf("invalid postgres schema: %q", c.Database.PostgreSQL.Schema)
+		}
 	case "sqlite":
 		if c.Database.SQLite.Path == "" {
 			return fmt.Errorf("sqlite path is required")
 		}
+		if c.Database.SQLite.CacheSizeMB < 0 {
+			return fmt.Errorf("sqlite cache_size_mb must not be negative")
+		}
 	default:
 		return fmt.Errorf("unsupported database driver: %s", c.Database.Driver)
 	}
 
+	if !identifierPattern.MatchString(c.Dataset) {
+		return fmt.Errorf("dataset name may only contain letters, digits and underscores: %q", c.Dataset)
+	}
+	if !identifierPattern.MatchString(c.Database.TablePrefix) || !identifierPattern.MatchString(c.Database.TableSuffix) {
+		return fmt.Errorf("table_prefix and table_suffix may only contain letters, digits and underscores")
+	}
+
+	pool := c.Database.ConnectionPool
+	if pool.MaxOpenConns < 0 || pool.MaxIdleConns < 0 || pool.ConnMaxLifetime < 0 {
+		return fmt.Errorf("connection_pool max_open_conns, max_idle_conns and conn_max_lifetime must not be negative")
+	}
+
+	switch c.Database.IDStrategy {
+	case "", "auto_increment", "composite":
+	case "snowflake":
+		if c.Database.SnowflakeNode < 0 || c.Database.SnowflakeNode > 1023 {
+			return fmt.Errorf("snowflake_node must be between 0 and 1023")
+		}
+	default:
+		return fmt.Errorf("unsupported id_strategy: %s (expected auto_increment, snowflake or composite)", c.Database.IDStrategy)
+	}
+
+	if err := c.Scanner.Validate(); err != nil {
+		return err
+	}
+	if err := c.Ingest.Validate(); err != nil {
+		return err
+	}
+	if c.Ingest.QueueFile != "" && c.Ingest.QueueFile == c.Scanner.SpoolFile {
+		return fmt.Errorf("ingest queue_file and scanner spool_file must be different files")
+	}
+	if c.Server.ExportWorkers < 0 {
+		return fmt.Errorf("invalid server export_workers: %d (expected 0 or more)", c.Server.ExportWorkers)
+	}
+	if c.Server.RateLimit < 0 {
+		return fmt.Errorf("invalid server rate_limit: %v (expected 0 or more readings per second)", c.Server.RateLimit)
+	}
+	if c.Server.ExportChunk != "" {
+		if chunk, err := time.ParseDuration(c.Server.ExportChunk); err != nil || chunk < time.Second || chunk%time.Second != 0 {
+			return fmt.Errorf("invalid server export_chunk: %q (expected whole seconds such as 24h)", c.Server.ExportChunk)
+		}
+	}
+
+	for name := range c.ScanProfiles {
+		if _, err := c.ScannerProfile(name); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Validate validates the scanner configuration
+func (s *ScannerConfig) Validate() error {
+	switch s.FilenamePolicy {
+	case "", "warn", "reject":
+	default:
+		return fmt.Errorf("unsupported scanner filename policy: %s (expected warn or reject)", s.FilenamePolicy)
+	}
+
+	if s.FilenameRegex != "" {
+		if _, err := regexp.Compile(s.FilenameRegex); err != nil {
+			return fmt.Errorf("invalid scanner filename_regex: %w", err)
+		}
+	} else if s.FilenameSensorName != "" {
+		return fmt.Errorf("scanner filename_sensor_name requires a filename_regex")
+	}
+
+	switch s.IngestMode {
+	case "", "direct", "raw":
+	default:
+		return fmt.Errorf("unsupported scanner ingest mode: %s (expected direct or raw)", s.IngestMode)
+	}
+
+	switch s.UnknownSensors {
+	case "", "keep":
+	case "reject":
+		if s.SensorAliasFile == "" {
+			return fmt.Errorf("scanner unknown_sensors: reject requires a sensor_alias_file")
+		}
+	default:
+		return fmt.Errorf("unsupported scanner unknown_sensors: %s (expected keep or reject)", s.UnknownSensors)
+	}
+
+	switch s.Layout {
+	case "", "long", "wide":
+	default:
+		return fmt.Errorf("unsupported scanner layout: %s (expected long or wide)", s.Layout)
+	}
+
+	if s.SkipLines < 0 {
+		return fmt.Errorf("scanner skip_lines must not be negative")
+	}
+	if s.BatchSize < 0 {
+		return fmt.Errorf("scanner batch_size must not be negative")
+	}
+	if s.WorkerCount < 0 {
+		return fmt.Errorf("scanner worker_count must not be negative")
+	}
+	if s.MaxRowsInMemory < 0 {
+		return fmt.Errorf("scanner max_rows_in_memory must not be negative")
+	}
+	if s.InsertWorkers < 0 {
+		return fmt.Errorf("scanner insert_workers must not be negative")
+	}
+	switch s.LoadMethod {
+	case "", "insert", "copy", "staging":
+	default:
+		return fmt.Errorf("unsupported scanner load method: %s (expected insert, copy or staging)", s.LoadMethod)
+	}
+	if s.WatchRampUp != "" {
+		if rampUp, err := time.ParseDuration(s.WatchRampUp); err != nil || rampUp < 0 {
+			return fmt.Errorf("invalid scanner watch_ramp_up: %q (expected a duration like 2s)", s.WatchRampUp)
+		}
+	}
+	if s.WatchRetryAttempts < 0 {
+		return fmt.Errorf("scanner watch_retry_attempts must not be negative")
+	}
+	if s.WatchRetryDelay != "" {
+		if delay, err := time.ParseDuration(s.WatchRetryDelay); err != nil || delay <= 0 {
+			return fmt.Errorf("invalid scanner watch_retry_delay: %q (expected a duration like 30s)", s.WatchRetryDelay)
+		}
+	}
+	if s.HeaderMarker != "" {
+		if _, err := regexp.Compile(s.HeaderMarker); err != nil {
+			return fmt.Errorf("invalid scanner header_marker: %w", err)
+		}
+	}
+
+	for _, layout := range s.TimestampFormats {
+		if strings.TrimSpace(layout) == "" {
+			return fmt.Errorf("scanner timestamp_formats must not contain empty layouts")
+		}
+	}
+
+	if s.SourceTimezone != "" {
+		if _, err := time.LoadLocation(s.SourceTimezone); err != nil {
+			return fmt.Errorf("invalid scanner source_timezone: %w", err)
+		}
+	}
+	for i, override := range s.TimezoneOverrides {
+		if _, err := path.Match(override.Files, ""); err != nil || override.Files == "" {
+			return fmt.Errorf("scanner timezone_overrides[%d]: invalid files pattern %q", i, override.Files)
+		}
+		if _, err := time.LoadLocation(override.Timezone); err != nil || override.Timezone == "" {
+			return fmt.Errorf("scanner timezone_overrides[%d]: invalid timezone %q", i, override.Timezone)
+		}
+	}
+
+	if !validEncoding(s.Encoding) {
+		return fmt.Errorf("unsupported scanner encoding: %s (expected auto or a name such as utf-8, shift_jis or utf-16le)", s.Encoding)
+	}
+	for i, override := range s.EncodingOverrides {
+		if _, err := path.Match(override.Files, ""); err != nil || override.Files == "" {
+			return fmt.Errorf("scanner encoding_overrides[%d]: invalid files pattern %q", i, override.Files)
+		}
+		if override.Encoding == "" || !validEncoding(override.Encoding) {
+			return fmt.Errorf("scanner encoding_overrides[%d]: unsupported encoding %q", i, override.Encoding)
+		}
+	}
+
+	if !validNumberFormat(s.NumberFormat) {
+		return fmt.Errorf("unsupported scanner number_format: %s (expected standard, decimal_point or decimal_comma)", s.NumberFormat)
+	}
+	for i, override := range s.NumberFormatOverrides {
+		if _, err := path.Match(override.Files, ""); err != nil || override.Files == "" {
+			return fmt.Errorf("scanner number_format_overrides[%d]: invalid files pattern %q", i, override.Files)
+		}
+		if override.Format == "" || !validNumberFormat(override.Format) {
+			return fmt.Errorf("scanner number_format_overrides[%d]: unsupported format %q (expected standard, decimal_point or decimal_comma)", i, override.Format)
+		}
+	}
+
+	for i, transform := range s.ValueTransforms {
+		if _, err := path.Match(transform.Sensors, ""); err != nil || transform.Sensors == "" {
+			return fmt.Errorf("scanner value_transforms[%d]: invalid sensors pattern %q", i, transform.Sensors)
+		}
+		if strings.TrimSpace(transform.Expression) == "" {
+			return fmt.Errorf("scanner value_transforms[%d]: expression is required", i)
+		}
+	}
+
+	for i, aggregation := range s.Aggregations {
+		if _, err := path.Match(aggregation.Sensors, ""); err != nil || aggregation.Sensors == "" {
+			return fmt.Errorf("scanner aggregations[%d]: invalid sensors pattern %q", i, aggregation.Sensors)
+		}
+		interval, err := time.ParseDuration(aggregation.Interval)
+		if err != nil || interval < time.Second || interval%time.Second != 0 {
+			return fmt.Errorf("scanner aggregations[%d]: invalid interval %q (expected whole seconds such as 1m)", i, aggregation.Interval)
+		}
+	}
+
+	for i, mapping := range s.ColumnMappings {
+		if mapping.Files == "" {
+			return fmt.Errorf("scanner column_mappings[%d]: files pattern is required", i)
+		}
+		if _, err := path.Match(mapping.Files, ""); err != nil {
+			return fmt.Errorf("scanner column_mappings[%d]: invalid files pattern %q: %w", i, mapping.Files, err)
+		}
+		if mapping.Timestamp == "" || mapping.SensorName == "" || mapping.Value == "" {
+			return fmt.Errorf("scanner column_mappings[%d]: timestamp, sensor_name and value are required", i)
+		}
+	}
+
+	for _, pattern := range s.FooterPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid scanner footer pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, s.IncludeSensors...), s.ExcludeSensors...) {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("invalid scanner sensor filter pattern %q", pattern)
+		}
+	}
+	for _, pattern := range append(append([]string{}, s.FilePatterns...), s.ExcludeFiles...) {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("invalid scanner file filter pattern %q", pattern)
+		}
+	}
+
+	if _, _, err := ParseMaxErrors(s.MaxErrors); err != nil {
+		return err
+	}
+
+	if s.MaxAbsValue < 0 {
+		return fmt.Errorf("scanner max_abs_value must not be negative")
+	}
+	for _, pattern := range s.MagnitudeWhitelist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid scanner magnitude_whitelist pattern %q: %w", pattern, err)
+		}
+	}
+
+	if err := s.Validation.Validate(); err != nil {
+		return err
+	}
+
+	switch s.InsertPolicy {
+	case "", "error", "skip", "update":
+	default:
+		return fmt.Errorf("unsupported scanner insert policy: %s (expected error, skip or update)", s.InsertPolicy)
+	}
+	if s.UpsertWindow != "" {
+		if window, err := time.ParseDuration(s.UpsertWindow); err != nil || window < 0 {
+			return fmt.Errorf("invalid scanner upsert_window: %q (expected a duration like 24h)", s.UpsertWindow)
+		}
+	}
+
+	switch s.AfterImport.Action {
+	case "", "none", "archive", "rename", "delete":
+	default:
+		return fmt.Errorf("unsupported scanner after_import action: %s (expected none, archive, rename or delete)", s.AfterImport.Action)
+	}
+
+	if s.HTTP.Attempts < 0 {
+		return fmt.Errorf("scanner http attempts must not be negative")
+	}
+	for name, value := range map[string]string{"timeout": s.HTTP.Timeout, "retry_delay": s.HTTP.RetryDelay} {
+		if value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(value); err != nil || duration < 0 {
+			return fmt.Errorf("invalid scanner http %s: %q (expected a duration like 30s)", name, value)
+		}
+	}
+
+	if endpoint := s.S3.Endpoint; endpoint != "" {
+		if parsed, err := url.Parse(os.ExpandEnv(endpoint)); err != nil || parsed.Host == "" ||
+			(parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid scanner s3 endpoint: %q (expected a URL like https://minio.example:9000)", endpoint)
+		}
+	}
+	if (s.S3.AccessKeyID == "") != (s.S3.SecretAccessKey == "") {
+		return fmt.Errorf("scanner s3 access_key_id and secret_access_key must be set together")
+	}
+	if s.SFTP.Timeout != "" {
+		if timeout, err := time.ParseDuration(s.SFTP.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid scanner sftp timeout: %q (expected a duration like 30s)", s.SFTP.Timeout)
+		}
+	}
+
+	switch s.DuplicatePrecedence {
+	case "", "first", "latest_delivery":
+	case "directory":
+		if len(s.PrecedenceDirectories) == 0 {
+			return fmt.Errorf("scanner precedence_directories is required for directory precedence")
+		}
+	default:
+		return fmt.Errorf("unsupported scanner duplicate precedence: %s (expected first, latest_delivery or directory)", s.DuplicatePrecedence)
+	}
+
+	return nil
+}
+
+// Validate validates the ingest settings. The broker and topics are checked
+// when an ingest command starts, so they may be left out.
+func (i *IngestConfig) Validate() error {
+	if i.FlushInterval != "" {
+		if interval, err := time.ParseDuration(i.FlushInterval); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid ingest flush_interval: %q (expected a duration like 5s)", i.FlushInterval)
+		}
+	}
+	if i.QueueSize < 0 {
+		return fmt.Errorf("invalid ingest queue_size: %d (expected 0 or more readings)", i.QueueSize)
+	}
+
+	mqtt := i.MQTT
+	if mqtt.Broker != "" {
+		parsed, err := url.Parse(os.ExpandEnv(mqtt.Broker))
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("invalid ingest mqtt broker: %q (expected a URL like tcp://broker:1883)", mqtt.Broker)
+		}
+		switch parsed.Scheme {
+		case "tcp", "mqtt", "ssl", "tls", "mqtts":
+		default:
+			return fmt.Errorf("unsupported ingest mqtt broker scheme: %s (expected tcp or ssl)", parsed.Scheme)
+		}
+	}
+	if mqtt.QoS != nil && (*mqtt.QoS < 0 || *mqtt.QoS > 1) {
+		return fmt.Errorf("unsupported ingest mqtt qos: %d (expected 0 or 1)", *mqtt.QoS)
+	}
+	if mqtt.KeepAlive != "" {
+		if keepAlive, err := time.ParseDuration(mqtt.KeepAlive); err != nil || keepAlive < time.Second || keepAlive > 65535*time.Second {
+			return fmt.Errorf("invalid ingest mqtt keep_alive: %q (expected a duration like 60s)", mqtt.KeepAlive)
+		}
+	}
+	switch mqtt.PayloadFormat {
+	case "", "auto", "json", "csv":
+	default:
+		return fmt.Errorf("unsupported ingest mqtt payload_format: %s (expected auto, json or csv)", mqtt.PayloadFormat)
+	}
+
+	kafka := i.Kafka
+	for _, broker := range kafka.Brokers {
+		if _, _, err := net.SplitHostPort(os.ExpandEnv(broker)); err != nil {
+			return fmt.Errorf("invalid ingest kafka broker: %q (expected host:port)", broker)
+		}
+	}
+	switch kafka.AutoOffsetReset {
+	case "", "earliest", "latest":
+	default:
+		return fmt.Errorf("unsupported ingest kafka auto_offset_reset: %s (expected earliest or latest)", kafka.AutoOffsetReset)
+	}
+	if kafka.SessionTimeout != "" {
+		if timeout, err := time.ParseDuration(kafka.SessionTimeout); err != nil || timeout < 6*time.Second {
+			return fmt.Errorf("invalid ingest kafka session_timeout: %q (expected a duration of at least 6s)", kafka.SessionTimeout)
+		}
+	}
+	switch kafka.PayloadFormat {
+	case "", "auto", "json", "csv":
+	default:
+		return fmt.Errorf("unsupported ingest kafka payload_format: %s (expected auto, json or csv)", kafka.PayloadFormat)
+	}
+	return nil
+}
+
+// Validate validates the validation rules
+func (v *ValidationConfig) Validate() error {
+	if v.SensorNamePattern != "" {
+		if _, err := regexp.Compile(v.SensorNamePattern); err != nil {
+			return fmt.Errorf("invalid scanner validation sensor_name_pattern: %w", err)
+		}
+	}
+
+	for i, rule := range v.Rules {
+		if rule.Sensors == "" {
+			return fmt.Errorf("scanner validation rules[%d]: sensors pattern is required", i)
+		}
+		if _, err := path.Match(rule.Sensors, ""); err != nil {
+			return fmt.Errorf("scanner validation rules[%d]: invalid sensors pattern %q: %w", i, rule.Sensors, err)
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return fmt.Errorf("scanner validation rules[%d]: min %g is greater than max %g", i, *rule.Min, *rule.Max)
+		}
+		if rule.Interval != "" {
+			interval, err := time.ParseDuration(rule.Interval)
+			if err != nil || interval <= 0 {
+				return fmt.Errorf("scanner validation rules[%d]: invalid interval %q", i, rule.Interval)
+			}
+		}
+		if rule.IntervalTolerance < 0 || rule.IntervalTolerance >= 1 {
+			return fmt.Errorf("scanner validation rules[%d]: interval_tolerance must be at least 0 and below 1", i)
+		}
+	}
+	return v.Calendar.Validate()
+}
+
+// Validate validates the operating calendar
+func (c *CalendarConfig) Validate() error {
+	location := time.UTC
+	if c.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid scanner validation calendar timezone: %w", err)
+		}
+	}
+	for _, day := range c.ClosedWeekdays {
+		if _, ok := ParseWeekday(day); !ok {
+			return fmt.Errorf("scanner validation calendar: unknown weekday %q", day)
+		}
+	}
+	for _, day := range c.Holidays {
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return fmt.Errorf("scanner validation calendar: invalid holiday %q (expected YYYY-MM-DD)", day)
+		}
+	}
+	for i, shutdown := range c.Shutdowns {
+		from, fromErr := ParseCalendarTime(shutdown.From, location, false)
+		to, toErr := ParseCalendarTime(shutdown.To, location, true)
+		if fromErr != nil || toErr != nil {
+			return fmt.Errorf("scanner validation calendar shutdowns[%d]: expected from and to as YYYY-MM-DD or YYYY-MM-DD HH:MM", i)
+		}
+		if to.Before(from) {
+			return fmt.Errorf("scanner validation calendar shutdowns[%d]: ends before it starts", i)
+		}
+	}
+	return nil
+}
+
+// ParseWeekday parses an English weekday name such as saturday or Sat
+func ParseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// ParseCalendarTime parses a shutdown bound in a location. A date as the end
+// of a shutdown means the end of that day.
+func ParseCalendarTime(value string, location *time.Location, end bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range CalendarTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, location)
+		if err != nil {
+			continue
+		}
+		if end && layout == "2006-01-02" {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid calendar time %q", value)
+}
+
+// validEncoding reports whether an encoding setting is auto or a known encoding name
+func validEncoding(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "auto") {
+		return true
+	}
+	_, err := htmlindex.Get(name)
+	return err == nil
+}
+
+// validNumberFormat reports whether a number format setting is known
+func validNumberFormat(format string) bool {
+	switch format {
+	case "", "standard", "decimal_point", "decimal_comma":
+		return true
+	}
+	return false
+}
+
+// ParseMaxErrors parses a max_errors setting into an error count or a
+// percentage of rows, either of which is 0 when not set
+func ParseMaxErrors(value string) (int, float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, 0, nil
+	}
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			return 0, 0, fmt.Errorf("invalid scanner max_errors: %q (expected a percentage between 0 and 100, e.g. 5%%)", value)
+		}
+		return 0, percent, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		return 0, 0, fmt.Errorf("invalid scanner max_errors: %q (expected an error count like 1000 or a percentage like 5%%)", value)
+	}
+	return count, 0, nil
+}
+
+// ScannerProfile returns the scanner configuration for a named scan profile.
+// Settings omitted from the profile are inherited from the scanner section.
+func (c *Config) ScannerProfile(name string) (ScannerConfig, error) {
+	profile := c.Scanner
+
+	node, ok := c.ScanProfiles[name]
+	if !ok {
+		return profile, fmt.Errorf("unknown scan profile: %s", name)
+	}
+
+	if err := node.Decode(&profile); err != nil {
+		return profile, fmt.Errorf("invalid scan profile %s: %w", name, err)
+	}
+	if err := profile.Validate(); err != nil {
+		return profile, fmt.Errorf("invalid scan profile %s: %w", name, err)
+	}
+
+	return profile, nil
+}
+
 // GetDSN returns the database connection string based on the configured driver
+// TablePrefix returns the prefix of every table name: the configured
+// table_prefix followed by the dataset name, if one is selected
+func (c *Config) TablePrefix() string {
+	if c.Dataset == "" {
+		return c.Database.TablePrefix
+	}
+	return c.Database.TablePrefix + c.Dataset + "_"
+}
+
 func (c *Config) GetDSN() string {
 	switch c.Database.Driver {
 	case "mysql":
@@ -153,8 +1306,23 @@ func (c *Config) GetDSN() string {
 		pg := c.Database.PostgreSQL
 		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s TimeZone=%s",
 			pg.Host, pg.Port, pg.User, pg.Password, pg.DBName, pg.SSLMode, pg.TimeZone)
+		if pg.Schema != "" {
+			dsn += " search_path=" + pg.Schema
+		}
 		return dsn
 	case "sqlite":
+		if c.Database.SQLite.InMemory() {
+			// A plain :memory: database is private to one connection; the memdb
+			// VFS shares it between pooled connections with normal file locking
+			return "file:/sensor_data_import?vfs=memdb&_busy_timeout=5000"
+		}
+		if c.Database.SQLite.BulkMode {
+			separator := "?"
+			if strings.Contains(c.Database.SQLite.Path, "?") {
+				separator = "&"
+			}
+			return c.Database.SQLite.Path + separator + c.Database.SQLite.bulkParams()
+		}
 		return c.Database.SQLite.Path
 	default:
 		return ""
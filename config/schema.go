@@ -0,0 +1,345 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaProblem is a setting that does not fit the configuration schema
+type schemaProblem struct {
+	line    int
+	message string
+}
+
+// SchemaError lists every problem found in a configuration file, each with
+// the line it is on
+type SchemaError struct {
+	problems []schemaProblem
+}
+
+// Error lists the problems in the order they appear in the file
+func (e *SchemaError) Error() string {
+	if len(e.problems) == 1 {
+		return fmt.Sprintf("line %d: %s", e.problems[0].line, e.problems[0].message)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems", len(e.problems))
+	for _, problem := range e.problems {
+		fmt.Fprintf(&b, "\n  line %d: %s", problem.line, problem.message)
+	}
+	return b.String()
+}
+
+// exclusiveOption is a pair of settings that contradict each other when
+// both are set
+type exclusiveOption struct {
+	first, second []string // Key paths from the top of the file
+	conflict      func(c *Config) bool
+	reason        string
+}
+
+// exclusiveOptions are the settings that cannot be combined
+var exclusiveOptions = []exclusiveOption{
+	{
+		first:  []string{"scanner", "upsert_window"},
+		second: []string{"scanner", "insert_policy"},
+		conflict: func(c *Config) bool {
+			return c.Scanner.UpsertWindow != "" && c.Scanner.InsertPolicy != "" && c.Scanner.InsertPolicy != "error"
+		},
+		reason: "upsert_window replaces insert_policy; set one of them",
+	},
+	{
+		first:  []string{"scanner", "ingest_mode"},
+		second: []string{"scanner", "duplicate_precedence"},
+		conflict: func(c *Config) bool {
+			return c.Scanner.IngestMode == "raw" && c.Scanner.DuplicatePrecedence != "" && c.Scanner.DuplicatePrecedence != "first"
+		},
+		reason: "duplicate precedence is not applied in raw ingest mode",
+	},
+	{
+		first:    []string{"scanner", "wide_mapping_file"},
+		second:   []string{"scanner", "layout"},
+		conflict: func(c *Config) bool { return c.Scanner.WideMappingFile != "" && c.Scanner.Layout == "long" },
+		reason:   "a wide_mapping_file implies layout: wide",
+	},
+}
+
+// checkSchema checks a parsed configuration file against the Config struct:
+// unknown keys, values of the wrong type and contradicting settings. config
+// is the file decoded without defaults.
+func checkSchema(root *yaml.Node, config *Config) error {
+	var problems []schemaProblem
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		checkNode(root.Content[0], reflect.TypeOf(Config{}), "", &problems)
+	}
+
+	for _, option := range exclusiveOptions {
+		if !option.conflict(config) {
+			continue
+		}
+		first, second := findNode(root, option.first), findNode(root, option.second)
+		if first == nil || second == nil {
+			continue
+		}
+		problems = append(problems, schemaProblem{
+			line: second.Line,
+			message: fmt.Sprintf("%s conflicts with %s on line %d: %s",
+				strings.Join(option.second, "."), strings.Join(option.first, "."), first.Line, option.reason),
+		})
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].line < problems[j].line })
+	return &SchemaError{problems: problems}
+}
+
+// scannerConfigType is checked against each scan profile
+var scannerConfigType = reflect.TypeOf(ScannerConfig{})
+
+// checkNode checks a node against the type it is decoded into. path is the
+// dotted key path of the node, for messages.
+func checkNode(node *yaml.Node, t reflect.Type, path string, problems *[]schemaProblem) {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// Scan profiles are held undecoded until one is selected
+	if path == "scan_profiles" && t.Kind() == reflect.Map {
+		t = reflect.MapOf(t.Key(), scannerConfigType)
+	}
+	if t == reflect.TypeOf(yaml.Node{}) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			addTypeProblem(node, path, "a mapping", problems)
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				checkMerge(value, t, path, problems)
+				continue
+			}
+			field, ok := fields[key.Value]
+			if !ok {
+				*problems = append(*problems, schemaProblem{line: key.Line, message: unknownKeyMessage(key.Value, path, fields)})
+				continue
+			}
+			checkNode(value, field.Type, joinPath(path, key.Value), problems)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			addTypeProblem(node, path, "a mapping", problems)
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkNode(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value), problems)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			addTypeProblem(node, path, "a list", problems)
+			return
+		}
+		for i, item := range node.Content {
+			checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			addTypeProblem(node, path, expectedKind(t), problems)
+			return
+		}
+		// yaml.v3 truncates fractions decoded into whole numbers
+		fraction := node.ShortTag() == "!!float" && expectedKind(t) == "a whole number"
+		if err := node.Decode(reflect.New(t).Interface()); err != nil || fraction {
+			addTypeProblem(node, path, expectedKind(t), problems)
+		}
+	}
+}
+
+// checkMerge checks the mappings merged into a struct with "<<"
+func checkMerge(node *yaml.Node, t reflect.Type, path string, problems *[]schemaProblem) {
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			checkNode(item, t, path, problems)
+		}
+		return
+	}
+	checkNode(node, t, path, problems)
+}
+
+// yamlFields maps the yaml keys of a struct to its fields
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// unknownKeyMessage reports an unknown key, suggesting the closest known key
+// of the same mapping or a setting of the same name one level down
+func unknownKeyMessage(key, path string, fields map[string]reflect.StructField) string {
+	message := fmt.Sprintf("unknown key %s", joinPath(path, key))
+	if suggestion := closestKey(key, fields); suggestion != "" {
+		return message + fmt.Sprintf(" (did you mean %s?)", suggestion)
+	}
+	var nested []string
+	for name, field := range fields {
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct {
+			continue
+		}
+		if _, ok := yamlFields(fieldType)[key]; ok {
+			nested = append(nested, joinPath(path, name+"."+key))
+		}
+	}
+	if len(nested) > 0 {
+		sort.Strings(nested)
+		return message + fmt.Sprintf(" (did you mean %s?)", strings.Join(nested, " or "))
+	}
+	return message
+}
+
+// closestKey returns the known key nearest to a misspelt one, or "" if none
+// is close enough to be a likely typo
+func closestKey(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", max(2, len(key)/3)+1
+	for name := range fields {
+		distance := editDistance(strings.ToLower(key), name)
+		if distance < bestDistance || (distance == bestDistance && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of
+// adjacent letters turning one string into the other
+func editDistance(a, b string) int {
+	distance := make([][]int, len(a)+1)
+	for i := range distance {
+		distance[i] = make([]int, len(b)+1)
+		distance[i][0] = i
+	}
+	for j := range distance[0] {
+		distance[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			distance[i][j] = min(distance[i-1][j]+1, distance[i][j-1]+1, distance[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				distance[i][j] = min(distance[i][j], distance[i-2][j-2]+1)
+			}
+		}
+	}
+	return distance[len(a)][len(b)]
+}
+
+// addTypeProblem reports a value of the wrong type
+func addTypeProblem(node *yaml.Node, path, expected string, problems *[]schemaProblem) {
+	got := "a " + nodeKindName(node)
+	if node.Kind == yaml.ScalarNode {
+		got = fmt.Sprintf("%q", node.Value)
+	}
+	*problems = append(*problems, schemaProblem{
+		line:    node.Line,
+		message: fmt.Sprintf("%s must be %s, got %s", path, expected, got),
+	})
+}
+
+// expectedKind describes the values a scalar type accepts
+func expectedKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	default:
+		return "a single value"
+	}
+}
+
+// nodeKindName names the kind of a node for messages
+func nodeKindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "list"
+	default:
+		return "value"
+	}
+}
+
+// findNode returns the value of a key path in a parsed file, or nil if it is
+// not set
+func findNode(root *yaml.Node, keys []string) *yaml.Node {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, key := range keys {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// joinPath appends a key to a dotted key path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
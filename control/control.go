@@ -0,0 +1,167 @@
+// Package control lets operators talk to a running watch or serve process
+// over a local socket: a Unix domain socket, or a named pipe on Windows. Each
+// connection carries one command as a JSON line and is answered with one.
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+)
+
+// ErrUnknownCommand is returned by a Handler for a command it does not know
+var ErrUnknownCommand = errors.New("unknown command")
+
+// requestTimeout bounds how long a client waits for an answer, and how long
+// the server waits for a client to send its command
+const requestTimeout = 10 * time.Second
+
+// maxRequestSize is the longest command line the server reads
+const maxRequestSize = 64 * 1024
+
+// Handler answers a command with a value sent back as JSON
+type Handler func(command string) (interface{}, error)
+
+// request is the line a client sends
+type request struct {
+	Command string `json:"command"`
+}
+
+// response is the line the server answers with
+type response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// DefaultAddress returns the socket used when none is configured: a file in
+// the working directory on Unix, like the log file, or a named pipe on Windows
+func DefaultAddress() string {
+	return defaultAddress
+}
+
+// listener accepts the connections of a control socket
+type listener interface {
+	Accept() (io.ReadWriteCloser, error)
+	Close() error
+}
+
+// Server answers commands on a control socket until closed
+type Server struct {
+	address  string
+	listener listener
+	handler  Handler
+	done     sync.WaitGroup
+}
+
+// Listen opens the control socket at address and answers its commands with
+// handler in the background. It fails when another process listens on the
+// address.
+func Listen(address string, handler Handler) (*Server, error) {
+	l, err := listen(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control socket %s: %w", address, err)
+	}
+	s := &Server{address: address, listener: l, handler: handler}
+	s.done.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Address returns where the server listens
+func (s *Server) Address() string {
+	return s.address
+}
+
+// Close stops answering commands and removes the socket, waiting for the
+// commands being answered
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.done.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.done.Done()
+
+	var connections sync.WaitGroup
+	defer connections.Wait()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, errListenerClosed) {
+				logger.Warnf("Control socket stopped: %v\n", err)
+			}
+			return
+		}
+		connections.Add(1)
+		go func() {
+			defer connections.Done()
+			s.answer(conn)
+		}()
+	}
+}
+
+// answer reads one command from a connection and writes its response
+func (s *Server) answer(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	stop := closeAfter(conn, requestTimeout)
+	defer stop()
+
+	var req request
+	line, err := bufio.NewReader(io.LimitReader(conn, maxRequestSize)).ReadBytes('\n')
+	if err == nil || errors.Is(err, io.EOF) {
+		err = json.Unmarshal(line, &req)
+	}
+	var resp response
+	if err != nil {
+		resp.Error = fmt.Sprintf("invalid request: %v", err)
+	} else if result, err := s.handler(req.Command); err != nil {
+		resp.Error = err.Error()
+	} else if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = fmt.Sprintf("failed to encode the result: %v", err)
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		logger.Debugf("Failed to answer control command %q: %v\n", req.Command, err)
+	}
+}
+
+// Send sends a command to the process listening at address and decodes its
+// result into result
+func Send(address, command string, result interface{}) error {
+	conn, err := dial(address)
+	if err != nil {
+		return fmt.Errorf("no process is listening on %s (is watch or serve running?): %w", address, err)
+	}
+	defer conn.Close()
+	stop := closeAfter(conn, requestTimeout)
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(request{Command: command}); err != nil {
+		return fmt.Errorf("failed to send %s: %w", command, err)
+	}
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read the answer to %s: %w", command, err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// closeAfter closes conn once timeout passes, unblocking its reads and
+// writes, unless the returned function is called first. Named pipes do not
+// support deadlines.
+func closeAfter(conn io.Closer, timeout time.Duration) func() {
+	timer := time.AfterFunc(timeout, func() { conn.Close() })
+	return func() { timer.Stop() }
+}
@@ -0,0 +1,101 @@
+//go:build !windows
+
+package control
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// socketPath returns a socket path short enough for the limit of sun_path
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "test.sock")
+}
+
+type progress struct {
+	Files []string `json:"files"`
+	Queue int      `json:"queue"`
+}
+
+func listenTest(t *testing.T, address string) *Server {
+	t.Helper()
+	srv, err := Listen(address, func(command string) (interface{}, error) {
+		if command == "status" {
+			return progress{Files: []string{"a.csv"}, Queue: 3}, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommand, command)
+	})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func TestSendAnswersCommands(t *testing.T) {
+	address := socketPath(t)
+	listenTest(t, address)
+
+	var status progress
+	if err := Send(address, "status", &status); err != nil {
+		t.Fatalf("Send status: %v", err)
+	}
+	if len(status.Files) != 1 || status.Files[0] != "a.csv" || status.Queue != 3 {
+		t.Errorf("status = %+v, want a.csv with 3 queued", status)
+	}
+
+	err := Send(address, "reboot", nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown command: reboot") {
+		t.Errorf("Send reboot: %v, want unknown command", err)
+	}
+}
+
+func TestListenRefusesASocketInUse(t *testing.T) {
+	address := socketPath(t)
+	listenTest(t, address)
+
+	if _, err := Listen(address, nil); err == nil || !strings.Contains(err.Error(), "another process") {
+		t.Errorf("second Listen: %v, want the socket reported in use", err)
+	}
+}
+
+func TestListenReplacesAStaleSocket(t *testing.T) {
+	address := socketPath(t)
+	// A process that exited without removing its socket leaves the file
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: address, Net: "unix"})
+	if err != nil {
+		t.Fatalf("ListenUnix: %v", err)
+	}
+	l.SetUnlinkOnClose(false)
+	l.Close()
+
+	listenTest(t, address)
+	if err := Send(address, "status", nil); err != nil {
+		t.Errorf("Send after replacing the stale socket: %v", err)
+	}
+}
+
+func TestCloseRemovesTheSocket(t *testing.T) {
+	address := socketPath(t)
+	srv := listenTest(t, address)
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(address); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket still exists after Close: %v", err)
+	}
+	if err := Send(address, "status", nil); err == nil {
+		t.Error("Send to a closed socket succeeded")
+	}
+}
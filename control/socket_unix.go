@@ -0,0 +1,61 @@
+//go:build !windows
+
+package control
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// defaultAddress is relative, so each working directory gets its own socket
+const defaultAddress = "sensor_data_import.sock"
+
+// dialTimeout bounds connecting to a socket
+const dialTimeout = 2 * time.Second
+
+// errListenerClosed is returned by Accept once the listener is closed
+var errListenerClosed = net.ErrClosed
+
+// unixListener accepts connections on a Unix domain socket
+type unixListener struct {
+	*net.UnixListener
+}
+
+func (l unixListener) Accept() (io.ReadWriteCloser, error) {
+	return l.UnixListener.Accept()
+}
+
+// listen listens on a Unix domain socket only the current user may connect
+// to. A socket file left behind by a process that exited without removing
+// it is replaced.
+func listen(address string) (listener, error) {
+	addr := &net.UnixAddr{Name: address, Net: "unix"}
+	l, err := net.ListenUnix("unix", addr)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		if conn, dialErr := net.DialTimeout("unix", address, dialTimeout); dialErr == nil {
+			conn.Close()
+			return nil, errors.New("another process is listening on it")
+		}
+		if err := os.Remove(address); err != nil {
+			return nil, err
+		}
+		l, err = net.ListenUnix("unix", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return unixListener{l}, nil
+}
+
+// dial connects to a Unix domain socket
+func dial(address string) (io.ReadWriteCloser, error) {
+	return net.DialTimeout("unix", address, dialTimeout)
+}
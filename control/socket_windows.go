@@ -0,0 +1,165 @@
+//go:build windows
+
+package control
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// defaultAddress is the named pipe used when none is configured
+const defaultAddress = `\\.\pipe\sensor_data_import`
+
+// pipeBufferSize is the input and output buffer of each pipe instance
+const pipeBufferSize = 4096
+
+// dialAttempts and dialRetryDelay cover the moment between one client
+// connecting and the next pipe instance being created
+const (
+	dialAttempts   = 20
+	dialRetryDelay = 100 * time.Millisecond
+)
+
+// errListenerClosed is returned by Accept once the listener is closed
+var errListenerClosed = errors.New("control pipe closed")
+
+// pipeListener accepts connections on a named pipe. Each connection takes an
+// instance of the pipe, and the next one is created as it connects.
+type pipeListener struct {
+	address string
+	name    *uint16
+
+	mu      sync.Mutex
+	next    windows.Handle // Instance waiting for the next client
+	waiting bool           // Accept is blocked waiting for a client
+	closed  bool
+}
+
+// listen creates the first instance of a named pipe that clients on other
+// hosts may not connect to. The default security of a pipe only lets its
+// owner and administrators write, and so send commands.
+func listen(address string) (listener, error) {
+	name, err := windows.UTF16PtrFromString(address)
+	if err != nil {
+		return nil, err
+	}
+	// The first instance fails if another process owns the pipe
+	handle, err := createPipe(name, windows.FILE_FLAG_FIRST_PIPE_INSTANCE)
+	if err != nil {
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+			return nil, errors.New("another process is listening on it")
+		}
+		return nil, err
+	}
+	return &pipeListener{address: address, name: name, next: handle}, nil
+}
+
+func createPipe(name *uint16, flags uint32) (windows.Handle, error) {
+	return windows.CreateNamedPipe(name,
+		windows.PIPE_ACCESS_DUPLEX|flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, nil)
+}
+
+func (l *pipeListener) Accept() (io.ReadWriteCloser, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, errListenerClosed
+	}
+	handle := l.next
+	l.waiting = true
+	l.mu.Unlock()
+
+	err := windows.ConnectNamedPipe(handle, nil)
+	if errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+		err = nil // The client connected before ConnectNamedPipe was called
+	}
+
+	// Create the next instance right away, so clients find one
+	next, nextErr := createPipe(l.name, 0)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiting = false
+	if l.closed || err != nil || nextErr != nil {
+		windows.CloseHandle(handle)
+		if nextErr == nil {
+			windows.CloseHandle(next)
+		}
+		l.next = windows.InvalidHandle
+		switch {
+		case l.closed:
+			return nil, errListenerClosed
+		case err != nil:
+			return nil, err
+		}
+		return nil, nextErr
+	}
+	l.next = next
+	return &pipeConn{File: os.NewFile(uintptr(handle), l.address), handle: handle}, nil
+}
+
+// Close closes the pipe. A blocked Accept is woken up by connecting to it.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	waiting := l.waiting
+	if !waiting && l.next != windows.InvalidHandle {
+		windows.CloseHandle(l.next)
+		l.next = windows.InvalidHandle
+	}
+	l.mu.Unlock()
+
+	if waiting {
+		if conn, err := os.OpenFile(l.address, os.O_RDWR, 0); err == nil {
+			conn.Close()
+		}
+	}
+	return nil
+}
+
+// pipeConn is the server end of a connected pipe instance
+type pipeConn struct {
+	*os.File
+	handle windows.Handle
+	once   sync.Once
+}
+
+// Close lets the client read the answer before the instance is released.
+// It may be called again by a timeout, which must not touch the handle.
+func (c *pipeConn) Close() error {
+	err := os.ErrClosed
+	c.once.Do(func() {
+		windows.FlushFileBuffers(c.handle)
+		windows.DisconnectNamedPipe(c.handle)
+		err = c.File.Close()
+	})
+	return err
+}
+
+// dial connects to a named pipe, waiting briefly while every instance is busy
+func dial(address string) (io.ReadWriteCloser, error) {
+	var err error
+	for attempt := 0; attempt < dialAttempts; attempt++ {
+		var conn *os.File
+		conn, err = os.OpenFile(address, os.O_RDWR, 0)
+		if err == nil {
+			return conn, nil
+		}
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) && !errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			break
+		}
+		time.Sleep(dialRetryDelay)
+	}
+	return nil, err
+}
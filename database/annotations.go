@@ -0,0 +1,117 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+// ErrAnnotationNotFound is returned when deleting an annotation that does not exist
+var ErrAnnotationNotFound = errors.New("annotation not found")
+
+// AnnotationFilter selects the annotations returned by ListAnnotations
+type AnnotationFilter struct {
+	From    time.Time // Annotations ending at or after it; zero for no lower bound
+	To      time.Time // Annotations starting before it; zero for no upper bound
+	Sensors []string  // Sensor names; annotations whose pattern matches one of them, empty for all
+}
+
+// NewAnnotation checks an annotation before it is stored: the time range must
+// not be reversed and the sensor pattern must be a valid glob
+func NewAnnotation(startsAt, endsAt time.Time, sensorPattern, text, author string) (*models.Annotation, error) {
+	if endsAt.IsZero() {
+		endsAt = startsAt
+	}
+	if startsAt.IsZero() {
+		return nil, fmt.Errorf("annotation start time is required")
+	}
+	if endsAt.Before(startsAt) {
+		return nil, fmt.Errorf("annotation ends before it starts")
+	}
+	if sensorPattern = strings.TrimSpace(sensorPattern); sensorPattern == "" {
+		sensorPattern = "*"
+	}
+	if _, err := path.Match(sensorPattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid sensor pattern %q: %w", sensorPattern, err)
+	}
+	if text = strings.TrimSpace(text); text == "" {
+		return nil, fmt.Errorf("annotation text is required")
+	}
+	if len(text) > 1024 || len(sensorPattern) > 255 || len(author) > 255 {
+		return nil, fmt.Errorf("annotation text, sensor pattern or author is too long")
+	}
+
+	return &models.Annotation{
+		StartsAt:      startsAt.UTC(),
+		EndsAt:        endsAt.UTC(),
+		SensorPattern: sensorPattern,
+		Text:          text,
+		Author:        strings.TrimSpace(author),
+	}, nil
+}
+
+// CreateAnnotation stores an annotation built by NewAnnotation
+func CreateAnnotation(annotation *models.Annotation) error {
+	if DB == nil {
+		return fmt.Errorf("database is not connected")
+	}
+	if err := quietSession().Create(annotation).Error; err != nil {
+		return fmt.Errorf("failed to store annotation: %w", err)
+	}
+	return nil
+}
+
+// ListAnnotations returns the annotations overlapping the filter's time range
+// for its sensors, ordered by start time
+func ListAnnotations(filter AnnotationFilter) ([]models.Annotation, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	query := quietSession().Order("starts_at, id")
+	if !filter.From.IsZero() {
+		query = query.Where("ends_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("starts_at < ?", filter.To)
+	}
+
+	var annotations []models.Annotation
+	if err := query.Find(&annotations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %w", err)
+	}
+	if len(filter.Sensors) == 0 {
+		return annotations, nil
+	}
+
+	// Patterns are matched here, as SQL has no portable glob match
+	matching := annotations[:0]
+	for _, annotation := range annotations {
+		for _, sensor := range filter.Sensors {
+			if matched, _ := path.Match(annotation.SensorPattern, sensor); matched {
+				matching = append(matching, annotation)
+				break
+			}
+		}
+	}
+	return matching, nil
+}
+
+// DeleteAnnotation removes an annotation
+func DeleteAnnotation(id uint) error {
+	if DB == nil {
+		return fmt.Errorf("database is not connected")
+	}
+	result := quietSession().Delete(&models.Annotation{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete annotation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrAnnotationNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+	"sensor_data_import/rollup"
+
+	"gorm.io/gorm"
+)
+
+// rollupBatchSize is the number of aggregates merged again per statement
+// after aggregate parts were deleted
+const rollupBatchSize = 500
+
+// BatchInfo describes an import batch and the readings it still has stored
+type BatchInfo struct {
+	Batch      models.ImportFile `json:"batch"`
+	Rows       int64             `json:"rows"`       // Readings in sensor_data
+	RawRows    int64             `json:"raw_rows"`   // Readings in the raw ingest table not compacted yet
+	Aggregates int64             `json:"aggregates"` // Intervals of aggregated sensors the batch contributed to
+}
+
+// RevertResult describes the readings of an import batch that a revert removes
+type RevertResult struct {
+	BatchInfo
+	Reverted bool // False for a dry run
+}
+
+// ListBatches returns the import batches started at or after since (all
+// batches for a zero time), most recent first
+func ListBatches(since time.Time) ([]models.ImportFile, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	query := quietSession().Order("imported_at DESC, id DESC")
+	if !since.IsZero() {
+		query = query.Where("imported_at >= ?", since)
+	}
+
+	var batches []models.ImportFile
+	if err := query.Find(&batches).Error; err != nil {
+		return nil, fmt.Errorf("failed to list import batches: %w", err)
+	}
+	return batches, nil
+}
+
+// GetBatch returns an import batch with the number of readings it still has stored
+func GetBatch(batchID uint) (*BatchInfo, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	db := quietSession()
+	info := &BatchInfo{}
+	if err := db.Where("id = ?", batchID).Limit(1).Find(&info.Batch).Error; err != nil {
+		return nil, fmt.Errorf("failed to load import batch: %w", err)
+	}
+	if info.Batch.ID == 0 {
+		return nil, fmt.Errorf("import batch %d not found", batchID)
+	}
+
+	if err := db.Model(&models.SensorData{}).Where("import_file_id = ?", batchID).Count(&info.Rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count readings: %w", err)
+	}
+	rawTable := models.SensorDataRaw{}.TableName()
+	if db.Migrator().HasTable(rawTable) {
+		if err := db.Table(rawTable).Where("import_file_id = ?", batchID).Count(&info.RawRows).Error; err != nil {
+			return nil, fmt.Errorf("failed to count raw readings: %w", err)
+		}
+	}
+	if db.Migrator().HasTable(&models.SensorAggregatePart{}) {
+		if err := db.Model(&models.SensorAggregatePart{}).Where("import_file_id = ?", batchID).Count(&info.Aggregates).Error; err != nil {
+			return nil, fmt.Errorf("failed to count aggregates: %w", err)
+		}
+	}
+	return info, nil
+}
+
+// RevertBatch removes every reading written by an import batch, together with
+// its manifest entry and checkpoint so a later scan can import the file again.
+// Readings the batch overwrote are removed, not restored. With dryRun only the
+// counts are returned.
+func RevertBatch(batchID uint, dryRun bool) (*RevertResult, error) {
+	info, err := GetBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	result := &RevertResult{BatchInfo: *info}
+
+	if dryRun {
+		return result, nil
+	}
+
+	var intervals []rollup.Key
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var sensorNames []string
+		sensorNames, intervals, err = deleteBatch(tx, info)
+		if err != nil {
+			return err
+		}
+		return refreshLastValues(tx, sensorNames)
+	})
+	if err != nil {
+		return nil, err
+	}
+	recomputeAggregates(intervals)
+
+	result.Reverted = true
+	return result, nil
+}
+
+// deleteBatch deletes the readings, manifest entry and checkpoint of a batch
+// and returns the sensors whose readings were deleted and the aggregated
+// intervals it flagged dirty
+func deleteBatch(tx *gorm.DB, info *BatchInfo) ([]string, []rollup.Key, error) {
+	batchID := info.Batch.ID
+	var sensorNames []string
+	if err := tx.Model(&models.SensorData{}).Where("import_file_id = ?", batchID).
+		Distinct().Pluck("sensor_name", &sensorNames).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to list sensors: %w", err)
+	}
+
+	if err := tx.Where("import_file_id = ?", batchID).Delete(&models.SensorData{}).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to delete readings: %w", err)
+	}
+	if info.RawRows > 0 {
+		rawTable := models.SensorDataRaw{}.TableName()
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE import_file_id = ?", rawTable), batchID).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to delete raw readings: %w", err)
+		}
+	}
+	var intervals []rollup.Key
+	if info.Aggregates > 0 {
+		var err error
+		if intervals, err = deleteAggregateParts(tx, "import_file_id = ?", batchID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := forgetBatch(tx, info.Batch); err != nil {
+		return nil, nil, err
+	}
+	return sensorNames, intervals, nil
+}
+
+// deleteAggregateParts deletes the aggregate parts matching the condition
+// and flags the intervals they covered dirty, to be merged again from the
+// parts other batches stored so their readings stay counted. It returns the
+// intervals.
+func deleteAggregateParts(tx *gorm.DB, query string, args ...interface{}) ([]rollup.Key, error) {
+	var parts []models.SensorAggregatePart
+	if err := tx.Select("bucket_start", "sensor_name", "interval_seconds").Where(query, args...).
+		Find(&parts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list aggregates: %w", err)
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	keys := make([]rollup.Key, 0, len(parts))
+	seen := make(map[rollup.Key]bool, len(parts))
+	for _, part := range parts {
+		if key := rollup.KeyOf(part); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if err := rollup.MarkDirty(tx, keys, rollupBatchSize); err != nil {
+		return nil, err
+	}
+	if err := tx.Where(query, args...).Delete(&models.SensorAggregatePart{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete aggregates: %w", err)
+	}
+	return keys, nil
+}
+
+// recomputeAggregates merges the intervals flagged dirty by a committed
+// change. Intervals it fails to merge stay dirty for the next rollup run.
+func recomputeAggregates(intervals []rollup.Key) {
+	if len(intervals) == 0 {
+		return
+	}
+	if err := rollup.Recompute(DB, intervals, rollupBatchSize); err != nil {
+		logger.Warnf("Aggregates left dirty, run aggregates:rollup to merge them: %v\n", err)
+	}
+}
+
+// RollupAggregates merges the aggregated intervals left dirty, such as by an
+// interrupted import, and returns how many it merged
+func RollupAggregates() (int, error) {
+	if DB == nil {
+		return 0, fmt.Errorf("database is not connected")
+	}
+	if !DB.Migrator().HasTable(&models.SensorAggregatePart{}) {
+		return 0, fmt.Errorf("aggregate parts table not found; run migrate first")
+	}
+	return rollup.RecomputeDirty(DB, rollupBatchSize)
+}
+
+// forgetBatch deletes the manifest entry and checkpoint of a batch, so
+// scanning its file again imports it again
+func forgetBatch(tx *gorm.DB, batch models.ImportFile) error {
+	if tx.Migrator().HasTable(&models.ImportCheckpoint{}) {
+		if err := tx.Where("sha256 = ?", batch.SHA256).Delete(&models.ImportCheckpoint{}).Error; err != nil {
+			return fmt.Errorf("failed to delete checkpoint: %w", err)
+		}
+	}
+	if err := tx.Delete(&models.ImportFile{}, batch.ID).Error; err != nil {
+		return fmt.Errorf("failed to delete import batch: %w", err)
+	}
+	return nil
+}
+
+// refreshLastValues recomputes the cached latest reading of the given
+// sensors from sensor_data after readings were removed
+func refreshLastValues(tx *gorm.DB, sensorNames []string) error {
+	if len(sensorNames) == 0 || !tx.Migrator().HasTable(&models.SensorLastValue{}) {
+		return nil
+	}
+
+	if err := tx.Where("sensor_name IN ?", sensorNames).Delete(&models.SensorLastValue{}).Error; err != nil {
+		return fmt.Errorf("failed to clear last values: %w", err)
+	}
+
+	dataTable := models.SensorData{}.TableName()
+	insertSQL := fmt.Sprintf(`INSERT INTO %[1]s (sensor_name, timestamp, value, updated_at)
+SELECT d.sensor_name, d.timestamp, MAX(d.value), ?
+FROM %[2]s d
+JOIN (SELECT sensor_name, MAX(timestamp) AS timestamp FROM %[2]s WHERE sensor_name IN ? GROUP BY sensor_name) latest
+  ON d.sensor_name = latest.sensor_name AND d.timestamp = latest.timestamp
+GROUP BY d.sensor_name, d.timestamp`, models.SensorLastValue{}.TableName(), dataTable)
+
+	if err := tx.Exec(insertSQL, time.Now().UTC(), sensorNames).Error; err != nil {
+		return fmt.Errorf("failed to refresh last values: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+func TestRevertBatch(t *testing.T) {
+	openTestDB(t)
+	reverted := importBatch(t, "/data/2025-09-01.csv", "aaaa")
+	kept := importBatch(t, "/data/2025-08-31.csv", "bbbb")
+	insertReadings(t,
+		fromBatch(reading("temp_01", 0, 1), kept.ID),
+		fromBatch(reading("temp_01", 5, 2), reverted.ID),
+		fromBatch(reading("temp_02", 5, 3), reverted.ID),
+	)
+	// Both batches contributed to an interval of an aggregated sensor
+	hour := reading("humidity_01", 0, 0).Timestamp
+	parts := []models.SensorAggregatePart{
+		{BucketStart: hour, SensorName: "humidity_01", IntervalSeconds: 3600, ImportFileID: reverted.ID, ReadingCount: 2, MinValue: 50, MaxValue: 60, AvgValue: 55},
+		{BucketStart: hour, SensorName: "humidity_01", IntervalSeconds: 3600, ImportFileID: kept.ID, ReadingCount: 1, MinValue: 40, MaxValue: 40, AvgValue: 40},
+	}
+	aggregate := models.SensorAggregate{
+		BucketStart: hour, SensorName: "humidity_01", IntervalSeconds: 3600, ReadingCount: 3, MinValue: 40, MaxValue: 60, AvgValue: 50,
+	}
+	checkpoint := models.ImportCheckpoint{FilePath: reverted.FilePath, SHA256: reverted.SHA256, CommittedRows: 2, UpdatedAt: time.Now()}
+	lastValues := []models.SensorLastValue{
+		{SensorName: "temp_01", Timestamp: reading("temp_01", 5, 0).Timestamp, Value: 2, UpdatedAt: time.Now()},
+		{SensorName: "temp_02", Timestamp: reading("temp_02", 5, 0).Timestamp, Value: 3, UpdatedAt: time.Now()},
+	}
+	insertRows(t, DB, parts...)
+	insertRows(t, DB, aggregate)
+	insertRows(t, DB, checkpoint)
+	insertRows(t, DB, lastValues...)
+
+	result, err := RevertBatch(reverted.ID, true)
+	if err != nil {
+		t.Fatalf("RevertBatch dry run: %v", err)
+	}
+	if result.Reverted || result.Rows != 2 || result.Aggregates != 1 {
+		t.Errorf("dry run = %+v, want 2 rows and 1 aggregate, not reverted", *result)
+	}
+	if rows := countRows(t, &models.SensorData{}); rows != 3 {
+		t.Fatalf("dry run left %d readings, want 3", rows)
+	}
+
+	result, err = RevertBatch(reverted.ID, false)
+	if err != nil {
+		t.Fatalf("RevertBatch: %v", err)
+	}
+	if !result.Reverted || result.Rows != 2 {
+		t.Errorf("result = %+v, want 2 rows reverted", *result)
+	}
+	values := storedValues(t)
+	if len(values) != 1 || values["temp_01@00:00"] != 1 {
+		t.Errorf("sensor_data = %v, want only the reading of the other batch", values)
+	}
+	// The interval keeps the readings of the other batch
+	var aggregates []models.SensorAggregate
+	if err := DB.Find(&aggregates).Error; err != nil {
+		t.Fatalf("read aggregates: %v", err)
+	}
+	if len(aggregates) != 1 || aggregates[0].ReadingCount != 1 || aggregates[0].MinValue != 40 || aggregates[0].AvgValue != 40 || aggregates[0].Dirty {
+		t.Errorf("aggregates = %+v, want the interval of the other batch", aggregates)
+	}
+	if checkpoints := countRows(t, &models.ImportCheckpoint{}); checkpoints != 0 {
+		t.Errorf("%d checkpoints left, want 0", checkpoints)
+	}
+	if batches, err := ListBatches(time.Time{}); err != nil || len(batches) != 1 || batches[0].ID != kept.ID {
+		t.Errorf("batches = %+v, %v; want only the other batch", batches, err)
+	}
+
+	// The last value falls back to the older reading, and a sensor left
+	// without readings loses its last value
+	if value, ok := lastValue(t, "temp_01"); !ok || value != 1 {
+		t.Errorf("last value of temp_01 = %v, %v; want 1", value, ok)
+	}
+	if _, ok := lastValue(t, "temp_02"); ok {
+		t.Error("temp_02 kept a last value without readings")
+	}
+
+	if _, err := RevertBatch(reverted.ID, false); err == nil {
+		t.Error("reverting the batch again succeeded, want not found")
+	}
+}
+
+// Intervals left dirty, here by an import interrupted before merging them,
+// are merged by the next rollup run
+func TestRollupAggregates(t *testing.T) {
+	openTestDB(t)
+	hour := reading("vib_01", 0, 0).Timestamp
+	parts := []models.SensorAggregatePart{
+		{BucketStart: hour, SensorName: "vib_01", IntervalSeconds: 3600, ImportFileID: 1, ReadingCount: 3, MinValue: 1, MaxValue: 3, AvgValue: 2},
+		{BucketStart: hour, SensorName: "vib_01", IntervalSeconds: 3600, ImportFileID: 2, ReadingCount: 1, MinValue: 6, MaxValue: 6, AvgValue: 6},
+	}
+	aggregates := []models.SensorAggregate{
+		{BucketStart: hour, SensorName: "vib_01", IntervalSeconds: 3600, ReadingCount: 3, MinValue: 1, MaxValue: 3, AvgValue: 2, Dirty: true},
+		{BucketStart: hour.Add(time.Hour), SensorName: "vib_01", IntervalSeconds: 3600, ReadingCount: 5, MinValue: 1, MaxValue: 1, AvgValue: 1, Dirty: true},
+	}
+	insertRows(t, DB, parts...)
+	insertRows(t, DB, aggregates...)
+
+	merged, err := RollupAggregates()
+	if err != nil {
+		t.Fatalf("RollupAggregates: %v", err)
+	}
+	if merged != 2 {
+		t.Errorf("merged %d intervals, want 2", merged)
+	}
+	// The second interval has no parts left and is deleted
+	aggregates = nil
+	if err := DB.Find(&aggregates).Error; err != nil {
+		t.Fatalf("read aggregates: %v", err)
+	}
+	if len(aggregates) != 1 || aggregates[0].ReadingCount != 4 || aggregates[0].MaxValue != 6 || aggregates[0].AvgValue != 3 || aggregates[0].Dirty {
+		t.Errorf("aggregates = %+v, want the first interval merged from both parts", aggregates)
+	}
+
+	if merged, err = RollupAggregates(); err != nil || merged != 0 {
+		t.Errorf("second run merged %d intervals, %v; want none", merged, err)
+	}
+}
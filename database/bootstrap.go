@@ -0,0 +1,130 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// baselineModels are the tables the importer needs before its first import
+var baselineModels = []interface{}{
+	&models.SensorData{},
+	&models.SensorDataRaw{},
+	&models.SensorDataConflict{},
+	&models.ImportFile{},
+	&models.ImportCheckpoint{},
+	&models.SensorLastValue{},
+	&models.SensorDataReject{},
+	&models.Annotation{},
+	&models.ReadingExclusion{},
+	&models.ImportRun{},
+	&models.SensorAggregate{},
+	&models.SensorAggregatePart{},
+	&models.TailOffset{},
+	&models.ExportState{},
+}
+
+// BaselineTables returns the configured names of the baseline tables
+func BaselineTables() []string {
+	return []string{
+		models.TableName("sensor_data"),
+		models.TableName("sensor_data_raw"),
+		models.TableName("sensor_data_conflicts"),
+		models.TableName("import_files"),
+		models.TableName("import_checkpoints"),
+		models.TableName("sensor_last_values"),
+		models.TableName("sensor_data_rejects"),
+		models.TableName("annotations"),
+		models.TableName("reading_exclusions"),
+		models.TableName("import_runs"),
+		models.TableName("sensor_data_aggregates"),
+		models.TableName("sensor_data_aggregate_parts"),
+		models.TableName("tail_offsets"),
+		models.TableName("export_states"),
+	}
+}
+
+// Bootstrap creates the baseline schema on a fresh database in one step and
+// brings an existing one up to date. MySQL runs the pending migrations. The
+// bundled migrations are written in MySQL syntax, so on PostgreSQL and SQLite
+// a fresh database gets its tables from the models instead and the migration
+// files present are recorded as applied; later migrations run as usual. So
+// does a fresh MySQL dataset sharing the database with unprefixed tables.
+// It returns the number of migrations applied or recorded.
+func (mr *MigrationRunner) Bootstrap(driver string) (int, error) {
+	if err := mr.InitializeMigrationTable(); err != nil {
+		return 0, fmt.Errorf("failed to create migration table: %w", err)
+	}
+
+	applied, err := mr.GetAppliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	pending, err := mr.GetPendingMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	if len(applied) == 0 {
+		for _, table := range BaselineTables() {
+			if mr.db.Migrator().HasTable(table) {
+				return 0, fmt.Errorf("table %s already exists but no migrations are recorded in %s: "+
+					"the schema was created outside the migration workflow, so it cannot be bootstrapped", table, mr.migrationTable)
+			}
+		}
+		// The baseline migration creates sensor_data unprefixed before renaming
+		// it, which fails while another dataset uses that name
+		if driver != "mysql" || mr.unprefixedSensorDataTaken() {
+			return len(pending), mr.createBaseline(pending)
+		}
+	}
+
+	if err := mr.RunMigrations(); err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+// unprefixedSensorDataTaken reports whether sensor_data is configured with a
+// prefix or suffix while an unprefixed sensor_data table exists
+func (mr *MigrationRunner) unprefixedSensorDataTaken() bool {
+	return models.TableName("sensor_data") != "sensor_data" && mr.db.Migrator().HasTable("sensor_data")
+}
+
+// createBaseline creates the baseline tables from the models and records the
+// given migrations as applied
+func (mr *MigrationRunner) createBaseline(migrations []MigrationFile) error {
+	if models.IDStrategy() == "composite" {
+		return fmt.Errorf("id_strategy composite is only created by the MySQL migrations: " +
+			"create sensor_data manually (see the README) or use auto_increment or snowflake")
+	}
+
+	logger.Printf("Creating baseline schema: %d table(s)\n", len(baselineModels))
+	return mr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(baselineModels...); err != nil {
+			return fmt.Errorf("failed to create baseline tables: %w", err)
+		}
+
+		now := time.Now()
+		for _, migrationFile := range migrations {
+			migration := Migration{
+				Version:     migrationFile.Version,
+				Name:        migrationFile.Name,
+				Applied:     true,
+				AppliedAt:   &now,
+				Description: migrationFile.Description,
+			}
+			if err := tx.Create(&migration).Error; err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", migrationFile.Version, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sensor_data_import/config"
+)
+
+// Capabilities describes what the connected database server supports
+type Capabilities struct {
+	Driver           string
+	Version          string   // Server version as reported by the server
+	Upsert           bool     // INSERT ... ON CONFLICT / ON DUPLICATE KEY UPDATE
+	Returning        bool     // INSERT ... RETURNING
+	GeneratedColumns bool     // Columns computed from other columns
+	Partitioning     bool     // Native table partitioning
+	MaxVariables     int      // Bind variables allowed in one statement
+	Extensions       []string // Installed PostgreSQL extensions
+	CompileOptions   []string // SQLite compile-time options
+	MissingSchema    string   // Configured PostgreSQL schema that does not exist
+}
+
+// columnsPerReading is the most columns one sensor_data row binds in a batch insert
+const columnsPerReading = 8
+
+// versionNumbers matches the leading dotted version numbers of a version string
+var versionNumbers = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// parseVersion returns the major, minor and patch numbers of a version string
+// such as "8.0.35", "10.6.12-MariaDB" or "16.2 (Debian 16.2-1)"
+func parseVersion(version string) [3]int {
+	var numbers [3]int
+	match := versionNumbers.FindStringSubmatch(strings.TrimSpace(version))
+	for i := 1; i < len(match); i++ {
+		numbers[i-1], _ = strconv.Atoi(match[i])
+	}
+	return numbers
+}
+
+// atLeast reports whether a version is at least major.minor.patch
+func atLeast(version [3]int, major, minor, patch int) bool {
+	want := [3]int{major, minor, patch}
+	for i := range version {
+		if version[i] != want[i] {
+			return version[i] > want[i]
+		}
+	}
+	return true
+}
+
+// DetectCapabilities queries the server version and features of the connected database
+func DetectCapabilities(cfg *config.Config) (Capabilities, error) {
+	caps := Capabilities{Driver: cfg.Database.Driver}
+	if DB == nil {
+		return caps, fmt.Errorf("database is not connected")
+	}
+	db := quietSession()
+
+	switch cfg.Database.Driver {
+	case "mysql":
+		if err := db.Raw("SELECT VERSION()").Scan(&caps.Version).Error; err != nil {
+			return caps, fmt.Errorf("failed to read server version: %w", err)
+		}
+		version := parseVersion(caps.Version)
+		caps.Upsert = true
+		caps.MaxVariables = 65535
+		if strings.Contains(strings.ToLower(caps.Version), "mariadb") {
+			caps.Returning = atLeast(version, 10, 5, 0)
+			caps.GeneratedColumns = atLeast(version, 5, 2, 0)
+			caps.Partitioning = true
+		} else {
+			caps.GeneratedColumns = atLeast(version, 5, 7, 6)
+			caps.Partitioning = atLeast(version, 5, 1, 0)
+		}
+
+	case "postgres":
+		if err := db.Raw("SHOW server_version").Scan(&caps.Version).Error; err != nil {
+			return caps, fmt.Errorf("failed to read server version: %w", err)
+		}
+		version := parseVersion(caps.Version)
+		caps.Upsert = atLeast(version, 9, 5, 0)
+		caps.Returning = true
+		caps.MaxVariables = 65535
+		caps.GeneratedColumns = atLeast(version, 12, 0, 0)
+		caps.Partitioning = atLeast(version, 10, 0, 0)
+		if err := db.Raw("SELECT extname FROM pg_extension ORDER BY extname").Scan(&caps.Extensions).Error; err != nil {
+			return caps, fmt.Errorf("failed to list extensions: %w", err)
+		}
+		if schema := cfg.Database.PostgreSQL.Schema; schema != "" {
+			var count int64
+			if err := db.Raw("SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = ?", schema).Scan(&count).Error; err != nil {
+				return caps, fmt.Errorf("failed to look up schema: %w", err)
+			}
+			if count == 0 {
+				caps.MissingSchema = schema
+			}
+		}
+
+	case "sqlite":
+		if err := db.Raw("SELECT sqlite_version()").Scan(&caps.Version).Error; err != nil {
+			return caps, fmt.Errorf("failed to read SQLite version: %w", err)
+		}
+		version := parseVersion(caps.Version)
+		caps.Upsert = atLeast(version, 3, 24, 0)
+		caps.Returning = atLeast(version, 3, 35, 0)
+		caps.GeneratedColumns = atLeast(version, 3, 31, 0)
+		if err := db.Raw("PRAGMA compile_options").Scan(&caps.CompileOptions).Error; err != nil {
+			return caps, fmt.Errorf("failed to read compile options: %w", err)
+		}
+		// The default limit was raised from 999 in SQLite 3.32
+		caps.MaxVariables = 999
+		if atLeast(version, 3, 32, 0) {
+			caps.MaxVariables = 32766
+		}
+		for _, option := range caps.CompileOptions {
+			if value, ok := strings.CutPrefix(option, "MAX_VARIABLE_NUMBER="); ok {
+				caps.MaxVariables, _ = strconv.Atoi(value)
+			}
+		}
+	}
+
+	return caps, nil
+}
+
+// HasExtension reports whether a PostgreSQL extension is installed
+func (c Capabilities) HasExtension(name string) bool {
+	for _, extension := range c.Extensions {
+		if extension == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings lists configured features the server cannot support, so they are
+// reported at connect time instead of failing later with an SQL error
+func (c Capabilities) Warnings(cfg *config.Config) []string {
+	var warnings []string
+	server := c.Driver + " " + c.Version
+
+	if !c.Upsert {
+		warnings = append(warnings, fmt.Sprintf(
+			"%s does not support INSERT ... ON CONFLICT (needs SQLite 3.24+ or PostgreSQL 9.5+): "+
+				"import checkpoints, sensor_last_values, compact and duplicate handling will fail", server))
+		if policy := cfg.Scanner.InsertPolicy; policy == "skip" || policy == "update" {
+			warnings = append(warnings, fmt.Sprintf("scanner insert_policy %s cannot be applied on %s", policy, server))
+		}
+		if cfg.Scanner.UpsertWindow != "" {
+			warnings = append(warnings, fmt.Sprintf("scanner upsert_window cannot be applied on %s", server))
+		}
+	}
+	if cfg.Database.IDStrategy == "composite" && c.Driver == "sqlite" && !c.Returning {
+		warnings = append(warnings, fmt.Sprintf(
+			"id_strategy composite needs INSERT ... RETURNING, which %s does not support (needs SQLite 3.35+)", server))
+	}
+	if batchSize := cfg.Scanner.BatchSize; c.MaxVariables > 0 && batchSize*columnsPerReading > c.MaxVariables {
+		warnings = append(warnings, fmt.Sprintf(
+			"scanner batch_size %d binds up to %d variables per insert, more than the %d %s allows: use at most %d",
+			batchSize, batchSize*columnsPerReading, c.MaxVariables, server, c.MaxVariables/columnsPerReading))
+	}
+	if c.MissingSchema != "" {
+		warnings = append(warnings, fmt.Sprintf(
+			"postgres schema %q does not exist: create it before running migrate", c.MissingSchema))
+	}
+	return warnings
+}
+
+// Summary describes the detected features on one line
+func (c Capabilities) Summary() string {
+	features := []string{fmt.Sprintf("%s %s", c.Driver, c.Version)}
+	for _, feature := range []struct {
+		name      string
+		supported bool
+	}{
+		{"upsert", c.Upsert},
+		{"returning", c.Returning},
+		{"generated columns", c.GeneratedColumns},
+		{"partitioning", c.Partitioning},
+	} {
+		if feature.supported {
+			features = append(features, feature.name)
+		} else {
+			features = append(features, "no "+feature.name)
+		}
+	}
+	if c.HasExtension("timescaledb") {
+		features = append(features, "TimescaleDB")
+	}
+	return strings.Join(features, ", ")
+}
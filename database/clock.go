@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	applog "sensor_data_import/logger"
+
+	"gorm.io/gorm"
+)
+
+// exportSettleMargin is how long before the oldest open transaction an
+// incremental export's watermark lies. It covers the time between a writer
+// stamping created_at and its statement reaching the database, and the
+// error of the measured clock offset.
+const exportSettleMargin = 5 * time.Second
+
+// sqliteBusyTimeout is how long a SQLite writer waits for the write lock by
+// default, after stamping created_at, unless it took the lock when its
+// transaction began
+const sqliteBusyTimeout = 5 * time.Second
+
+// dbClock follows the clock of the database server, so the created_at
+// stamps of every host writing to it and the export watermarks read from it
+// agree even when the hosts' clocks do not
+type dbClock struct {
+	offset atomic.Int64 // Nanoseconds the database clock is ahead of the local one
+}
+
+// now returns the current time of the database server, in the local zone
+// like GORM's default
+func (c *dbClock) now() time.Time {
+	return time.Now().Add(time.Duration(c.offset.Load()))
+}
+
+// sync measures the offset of the database clock, halfway through the query
+// reading it. SQLite runs in this process, so it shares the local clock.
+func (c *dbClock) sync(db *gorm.DB) error {
+	var query string
+	switch db.Dialector.Name() {
+	case "mysql":
+		query = "SELECT UNIX_TIMESTAMP(NOW(6))"
+	case "postgres":
+		query = "SELECT EXTRACT(EPOCH FROM clock_timestamp())"
+	default:
+		return nil
+	}
+	var epoch float64
+	sent := time.Now()
+	if err := db.Raw(query).Scan(&epoch).Error; err != nil {
+		return fmt.Errorf("failed to read the database clock: %w", err)
+	}
+	received := time.Now()
+	local := sent.Add(received.Sub(sent) / 2)
+	dbTime := time.Unix(0, int64(epoch*float64(time.Second)))
+	c.offset.Store(int64(dbTime.Sub(local)))
+	if offset := dbTime.Sub(local).Round(time.Millisecond); offset.Abs() > time.Second {
+		applog.Warnf("The database clock is %v ahead of this host; created_at and export watermarks follow the database\n", offset)
+	}
+	return nil
+}
+
+// ExportWatermark returns the database time up to which every reading is
+// committed: readings with a later created_at may still be written, but none
+// with an earlier one. It lies before the oldest transaction still open, so
+// a long import is exported once it commits, which on PostgreSQL needs the
+// pg_read_all_stats role to see other users' transactions and on MySQL the
+// PROCESS privilege. On SQLite it takes the write lock to wait for the
+// writer holding it.
+func ExportWatermark(ctx context.Context) (time.Time, error) {
+	if DB == nil {
+		return time.Time{}, fmt.Errorf("database is not connected")
+	}
+	db := quietSession().WithContext(ctx)
+
+	var watermark time.Time
+	switch db.Dialector.Name() {
+	case "mysql", "postgres":
+		query := `SELECT EXTRACT(EPOCH FROM clock_timestamp()) AS now, EXTRACT(EPOCH FROM MIN(xact_start)) AS oldest
+FROM pg_stat_activity WHERE datname = current_database() AND pid <> pg_backend_pid()`
+		if db.Dialector.Name() == "mysql" {
+			query = "SELECT UNIX_TIMESTAMP(NOW(6)) AS now, UNIX_TIMESTAMP(MIN(trx_started)) AS oldest FROM information_schema.INNODB_TRX"
+		}
+		var clock struct {
+			Now    float64
+			Oldest *float64
+		}
+		if err := db.Raw(query).Scan(&clock).Error; err != nil {
+			return time.Time{}, fmt.Errorf("failed to read the oldest open transaction: %w", err)
+		}
+		epoch := clock.Now
+		if clock.Oldest != nil {
+			epoch = min(epoch, *clock.Oldest)
+		}
+		watermark = time.Unix(0, int64(epoch*float64(time.Second))).Local().Add(-exportSettleMargin)
+	case "sqlite":
+		// Holding the write lock, no writer is between stamping and commit,
+		// except one still waiting for the lock
+		err := db.Connection(func(conn *gorm.DB) error {
+			if err := conn.Exec("BEGIN IMMEDIATE").Error; err != nil {
+				return fmt.Errorf("failed to take the write lock: %w", err)
+			}
+			watermark = conn.NowFunc().Add(-exportSettleMargin - sqliteBusyTimeout)
+			return conn.Exec("ROLLBACK").Error
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+	default:
+		return time.Time{}, fmt.Errorf("unsupported database driver: %s", db.Dialector.Name())
+	}
+	// created_at is kept in whole seconds on MySQL
+	return watermark.Truncate(time.Second), nil
+}
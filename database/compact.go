@@ -0,0 +1,162 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// CompactResult contains the outcome of a raw table compaction
+type CompactResult struct {
+	RawRows    int64 // Rows read from the raw table
+	Inserted   int64 // Rows added to sensor_data
+	Replaced   int64 // Rows of sensor_data overwritten, with the update insert policy
+	Duplicates int64 // Rows discarded as duplicates
+}
+
+// CompactRawData moves rows from the append-only raw table into sensor_data.
+//
+// Rows are deduplicated on (timestamp, sensor_name), keeping the most recently
+// ingested value. Rows that already exist in sensor_data are replaced with the
+// update insert policy and skipped otherwise, and the last values of the
+// compacted sensors are brought up to date.
+// The IDs of the rows present when the compaction starts are copied into a
+// temporary table, and only those rows are moved and deleted. Imports may keep
+// writing to the raw table while it runs: their rows are left for the next
+// run, whatever IDs they carry.
+func CompactRawData(cfg *config.Config) (*CompactResult, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	rawTable := models.SensorDataRaw{}.TableName()
+	targetTable := models.SensorData{}.TableName()
+	idsTable := models.TableName("sensor_data_compact_ids")
+	result := &CompactResult{}
+
+	var createIDs, dropIDs string
+	switch cfg.Database.Driver {
+	case "mysql":
+		createIDs = fmt.Sprintf("CREATE TEMPORARY TABLE %s (PRIMARY KEY (id)) AS SELECT id FROM %s", idsTable, rawTable)
+		// DROP TEMPORARY TABLE does not commit the transaction implicitly
+		dropIDs = "DROP TEMPORARY TABLE IF EXISTS " + idsTable
+	case "postgres":
+		createIDs = fmt.Sprintf("CREATE TEMPORARY TABLE %s ON COMMIT DROP AS SELECT id FROM %s", idsTable, rawTable)
+	case "sqlite":
+		createIDs = fmt.Sprintf("CREATE TEMPORARY TABLE %s AS SELECT id FROM %s", idsTable, rawTable)
+		dropIDs = "DROP TABLE IF EXISTS temp." + idsTable
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Database.Driver)
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// A failed run may have left the table on this pooled connection
+		if dropIDs != "" {
+			if err := tx.Exec(dropIDs).Error; err != nil {
+				return fmt.Errorf("failed to drop compaction ID table: %w", err)
+			}
+		}
+		if err := tx.Exec(createIDs).Error; err != nil {
+			return fmt.Errorf("failed to select raw rows: %w", err)
+		}
+
+		if err := tx.Table(idsTable).Count(&result.RawRows).Error; err != nil {
+			return fmt.Errorf("failed to count raw rows: %w", err)
+		}
+
+		if result.RawRows > 0 {
+			// Keep the latest ingested row for each (timestamp, sensor_name)
+			columns := "timestamp, sensor_name, value, source_file, source_modified_at, import_file_id, source_run_id, created_at"
+			if models.IDStrategy() == models.IDSnowflake {
+				// Raw rows already carry snowflake IDs, which stay unique in sensor_data
+				columns = "id, " + columns
+			}
+			// created_at is the time of the compaction, when the readings reach
+			// sensor_data, so incremental exports after it pick them up
+			stamp := "?"
+			if cfg.Database.Driver == "postgres" {
+				stamp = "CAST(? AS TIMESTAMPTZ)"
+			}
+			selected := strings.Replace("r."+strings.ReplaceAll(columns, ", ", ", r."), "r.created_at", stamp, 1)
+			selectLatest := fmt.Sprintf(`SELECT %[3]s
+FROM %[1]s r
+JOIN (SELECT MAX(raw.id) AS id FROM %[1]s raw JOIN %[2]s ids ON raw.id = ids.id GROUP BY raw.timestamp, raw.sensor_name) latest ON r.id = latest.id`,
+				rawTable, idsTable, selected)
+
+			replace := cfg.Scanner.InsertPolicy == "update"
+			updates := []string{"value", "source_file", "source_modified_at", "import_file_id", "source_run_id"}
+			var insertSQL string
+			switch {
+			case cfg.Database.Driver == "mysql" && replace:
+				for i, column := range updates {
+					updates[i] = fmt.Sprintf("%[1]s.%[2]s = VALUES(%[2]s)", targetTable, column)
+				}
+				insertSQL = fmt.Sprintf("INSERT INTO %s (%s) %s ON DUPLICATE KEY UPDATE %s", targetTable, columns, selectLatest, strings.Join(updates, ", "))
+			case cfg.Database.Driver == "mysql":
+				insertSQL = fmt.Sprintf("INSERT IGNORE INTO %s (%s) %s", targetTable, columns, selectLatest)
+			default:
+				// The WHERE clause resolves SQLite's parsing ambiguity between a join constraint and ON CONFLICT
+				onConflict := "DO NOTHING"
+				if replace {
+					for i, column := range updates {
+						updates[i] = fmt.Sprintf("%[1]s = excluded.%[1]s", column)
+					}
+					onConflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+				}
+				insertSQL = fmt.Sprintf("INSERT INTO %s (%s) %s WHERE true ON CONFLICT (timestamp, sensor_name) %s",
+					targetTable, columns, selectLatest, onConflict)
+			}
+
+			// MySQL counts a replaced row twice, or not at all when its value
+			// is unchanged, so replaced rows are counted before
+			if replace {
+				counts := struct{ Compacted, Existing int64 }{}
+				if err := tx.Raw(fmt.Sprintf(`SELECT COUNT(*) AS compacted, COUNT(d.sensor_name) AS existing
+FROM (SELECT raw.timestamp, raw.sensor_name FROM %[1]s raw JOIN %[2]s ids ON raw.id = ids.id GROUP BY raw.timestamp, raw.sensor_name) k
+LEFT JOIN %[3]s d ON d.timestamp = k.timestamp AND d.sensor_name = k.sensor_name`,
+					rawTable, idsTable, targetTable)).Scan(&counts).Error; err != nil {
+					return fmt.Errorf("failed to count the readings to replace: %w", err)
+				}
+				result.Replaced = counts.Existing
+				result.Inserted = counts.Compacted - counts.Existing
+			}
+			insert := tx.Exec(insertSQL, tx.NowFunc())
+			if insert.Error != nil {
+				return fmt.Errorf("failed to copy raw rows into %s: %w", targetTable, insert.Error)
+			}
+			if !replace {
+				result.Inserted = insert.RowsAffected
+			}
+
+			var sensorNames []string
+			if err := tx.Raw(fmt.Sprintf("SELECT DISTINCT raw.sensor_name FROM %s raw JOIN %s ids ON raw.id = ids.id", rawTable, idsTable)).
+				Scan(&sensorNames).Error; err != nil {
+				return fmt.Errorf("failed to list compacted sensors: %w", err)
+			}
+			if err := refreshLastValues(tx, sensorNames); err != nil {
+				return err
+			}
+
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s)", rawTable, idsTable)).Error; err != nil {
+				return fmt.Errorf("failed to clear compacted raw rows: %w", err)
+			}
+		}
+
+		if dropIDs != "" {
+			if err := tx.Exec(dropIDs).Error; err != nil {
+				return fmt.Errorf("failed to drop compaction ID table: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Duplicates = result.RawRows - result.Inserted - result.Replaced
+	return result, nil
+}
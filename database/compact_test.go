@@ -0,0 +1,122 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+func TestCompactRawDataDeduplicates(t *testing.T) {
+	cfg := openTestDB(t)
+	insertReadings(t, reading("temp_01", 1, 9))
+	insertRows(t, DB,
+		rawReading(10, "temp_01", 0, 1),
+		rawReading(11, "temp_01", 0, 2), // Ingested later, so it wins
+		rawReading(12, "temp_01", 1, 3), // Already in sensor_data
+	)
+
+	result, err := CompactRawData(cfg)
+	if err != nil {
+		t.Fatalf("CompactRawData: %v", err)
+	}
+	if result.RawRows != 3 || result.Inserted != 1 || result.Duplicates != 2 {
+		t.Errorf("result = %+v, want 3 raw rows, 1 inserted, 2 duplicates", *result)
+	}
+
+	values := storedValues(t)
+	if len(values) != 2 || values["temp_01@00:00"] != 2 || values["temp_01@00:01"] != 9 {
+		t.Errorf("sensor_data = %v, want temp_01@00:00=2 and the existing temp_01@00:01=9", values)
+	}
+	if value, ok := lastValue(t, "temp_01"); !ok || value != 9 {
+		t.Errorf("last value of temp_01 = %v, %v; want the kept 9", value, ok)
+	}
+	if raw := countRows(t, &models.SensorDataRaw{}); raw != 0 {
+		t.Errorf("%d raw rows left, want 0", raw)
+	}
+}
+
+func TestCompactRawDataReplaces(t *testing.T) {
+	cfg := openTestDB(t)
+	cfg.Scanner.InsertPolicy = "update"
+	insertReadings(t, reading("temp_01", 1, 9), reading("temp_02", 0, 5))
+	insertRows(t, DB,
+		rawReading(10, "temp_01", 0, 1),
+		rawReading(11, "temp_01", 1, 3), // Replaces the stored 9
+		rawReading(12, "temp_01", 1, 4), // Ingested later, so it wins
+	)
+
+	result, err := CompactRawData(cfg)
+	if err != nil {
+		t.Fatalf("CompactRawData: %v", err)
+	}
+	if result.RawRows != 3 || result.Inserted != 1 || result.Replaced != 1 || result.Duplicates != 1 {
+		t.Errorf("result = %+v, want 3 raw rows, 1 inserted, 1 replaced, 1 duplicate", *result)
+	}
+
+	values := storedValues(t)
+	if len(values) != 3 || values["temp_01@00:00"] != 1 || values["temp_01@00:01"] != 4 {
+		t.Errorf("sensor_data = %v, want temp_01@00:00=1 and temp_01@00:01 replaced by 4", values)
+	}
+	if value, ok := lastValue(t, "temp_01"); !ok || value != 4 {
+		t.Errorf("last value of temp_01 = %v, %v; want the compacted 4", value, ok)
+	}
+	if _, ok := lastValue(t, "temp_02"); ok {
+		t.Error("temp_02 was not compacted but got a last value")
+	}
+}
+
+func TestCompactRawDataEmpty(t *testing.T) {
+	cfg := openTestDB(t)
+
+	result, err := CompactRawData(cfg)
+	if err != nil {
+		t.Fatalf("CompactRawData: %v", err)
+	}
+	if result.RawRows != 0 || result.Inserted != 0 {
+		t.Errorf("result = %+v, want nothing compacted", *result)
+	}
+}
+
+// A row committed by a concurrent import after the compaction selected its
+// rows must survive, even with a lower ID than the compacted ones, as
+// snowflake IDs from another node can have
+func TestCompactRawDataKeepsRowsWrittenMeanwhile(t *testing.T) {
+	cfg := openTestDB(t)
+	insertRows(t, DB, rawReading(10, "temp_01", 0, 1), rawReading(11, "temp_02", 0, 2))
+
+	const callback = "test:concurrent_import"
+	written := false
+	err := DB.Callback().Raw().After("gorm:raw").Register(callback, func(db *gorm.DB) {
+		if written || !strings.HasPrefix(db.Statement.SQL.String(), "INSERT INTO "+models.SensorData{}.TableName()) {
+			return
+		}
+		written = true
+		insertRows(t, db.Session(&gorm.Session{NewDB: true}), rawReading(5, "temp_03", 0, 3))
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	t.Cleanup(func() { DB.Callback().Raw().Remove(callback) })
+
+	result, err := CompactRawData(cfg)
+	if err != nil {
+		t.Fatalf("CompactRawData: %v", err)
+	}
+	if !written {
+		t.Fatal("the concurrent row was never written")
+	}
+	if result.RawRows != 2 || result.Inserted != 2 {
+		t.Errorf("result = %+v, want the 2 rows present at the start", *result)
+	}
+
+	var left []models.SensorDataRaw
+	if err := DB.Find(&left).Error; err != nil {
+		t.Fatalf("read raw rows: %v", err)
+	}
+	if len(left) != 1 || left[0].ID != 5 {
+		t.Errorf("raw rows left = %+v, want only the row written during the compaction", left)
+	}
+}
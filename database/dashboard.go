@@ -0,0 +1,115 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+// Dashboard is what the web dashboard of serve shows
+type Dashboard struct {
+	Since       time.Time           `json:"since"`
+	Runs        []models.ImportRun  `json:"runs"`         // Most recent first
+	Files       []models.ImportFile `json:"files"`        // Most recent first
+	Sensors     []SensorFreshness   `json:"sensors"`      // Stalest first
+	SensorCount int64               `json:"sensor_count"` // Sensors with a last value, including those not listed
+	Trend       []DayTrend          `json:"trend"`        // One entry per UTC day since Since, oldest first
+	// Missing lists the tables not created yet (run migrate); their sections are empty
+	Missing []string `json:"missing_tables,omitempty"`
+}
+
+// SensorFreshness is the most recent reading of a sensor
+type SensorFreshness struct {
+	SensorName string    `json:"sensor_name"`
+	Timestamp  time.Time `json:"timestamp"`
+	Value      float64   `json:"value"`
+	AgeSeconds int64     `json:"age_seconds"`
+}
+
+// DayTrend sums the import runs started on a day
+type DayTrend struct {
+	Day         string `json:"day"` // 2006-01-02 in UTC
+	Runs        int    `json:"runs"`
+	Files       int    `json:"files"`
+	FailedFiles int    `json:"failed_files"`
+	Records     int    `json:"records"`
+	Errors      int    `json:"errors"` // Parsing errors and validation violations
+}
+
+// LoadDashboard returns the import runs and the daily trend since since, the
+// rows most recent import runs and files, and the rows stalest sensors
+func LoadDashboard(since time.Time, rows int) (*Dashboard, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+	db := quietSession()
+	dashboard := &Dashboard{Since: since, Runs: []models.ImportRun{}, Files: []models.ImportFile{}, Sensors: []SensorFreshness{}}
+
+	var runs []models.ImportRun
+	if db.Migrator().HasTable(&models.ImportRun{}) {
+		var err error
+		if runs, err = ListRuns(since); err != nil {
+			return nil, err
+		}
+		dashboard.Runs = runs[:min(len(runs), rows)]
+	} else {
+		dashboard.Missing = append(dashboard.Missing, models.ImportRun{}.TableName())
+	}
+	dashboard.Trend = dailyTrend(since, time.Now(), runs)
+
+	if db.Migrator().HasTable(&models.ImportFile{}) {
+		if err := db.Order("imported_at DESC, id DESC").Limit(rows).Find(&dashboard.Files).Error; err != nil {
+			return nil, fmt.Errorf("failed to list import files: %w", err)
+		}
+	} else {
+		dashboard.Missing = append(dashboard.Missing, models.ImportFile{}.TableName())
+	}
+
+	if db.Migrator().HasTable(&models.SensorLastValue{}) {
+		var lastValues []models.SensorLastValue
+		if err := db.Model(&models.SensorLastValue{}).Count(&dashboard.SensorCount).Error; err != nil {
+			return nil, fmt.Errorf("failed to count sensors: %w", err)
+		}
+		if err := db.Order("timestamp, sensor_name").Limit(rows).Find(&lastValues).Error; err != nil {
+			return nil, fmt.Errorf("failed to list sensor last values: %w", err)
+		}
+		now := time.Now()
+		for _, last := range lastValues {
+			dashboard.Sensors = append(dashboard.Sensors, SensorFreshness{
+				SensorName: last.SensorName,
+				Timestamp:  last.Timestamp,
+				Value:      last.Value,
+				AgeSeconds: int64(now.Sub(last.Timestamp) / time.Second),
+			})
+		}
+	} else {
+		dashboard.Missing = append(dashboard.Missing, models.SensorLastValue{}.TableName())
+	}
+	return dashboard, nil
+}
+
+// dailyTrend sums runs by the UTC day they started, with an entry for every
+// day from since to now
+func dailyTrend(since, now time.Time, runs []models.ImportRun) []DayTrend {
+	start := since.UTC().Truncate(24 * time.Hour)
+	var trend []DayTrend
+	index := make(map[string]int)
+	for day := start; !day.After(now.UTC()); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		index[key] = len(trend)
+		trend = append(trend, DayTrend{Day: key})
+	}
+	for _, run := range runs {
+		i, ok := index[run.StartedAt.UTC().Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		trend[i].Runs++
+		trend[i].Files += run.FileCount
+		trend[i].FailedFiles += run.FailedCount
+		trend[i].Records += run.RecordCount
+		trend[i].Errors += run.ErrorCount
+	}
+	return trend
+}
@@ -2,15 +2,21 @@ package database
 
 import (
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"sensor_data_import/config"
+	applog "sensor_data_import/logger"
+	"sensor_data_import/models"
+	"sensor_data_import/sensorquery"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
 )
 
 // DB is the global database instance
@@ -35,9 +41,23 @@ func Connect(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Database.Driver)
 	}
 
-	// Configure GORM with logger
+	// Apply the configured table prefix and suffix to every model
+	models.SetTableNaming(cfg.TablePrefix(), cfg.Database.TableSuffix)
+	models.SetIDStrategy(cfg.Database.IDStrategy, cfg.Database.SnowflakeNode)
+
+	// Configure GORM with logger, printing SQL above the scan progress line
+	sqlLogger := logger.New(log.New(applog.Console(), "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold: 200 * time.Millisecond,
+		LogLevel:      logger.Info,
+		Colorful:      true,
+	})
+	// Stamp created_at with the database clock, which the export watermark
+	// is read from
+	clock := &dbClock{}
 	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger:         sqlLogger,
+		NamingStrategy: tableNaming{NamingStrategy: schema.NamingStrategy{TablePrefix: cfg.TablePrefix()}, suffix: cfg.Database.TableSuffix},
+		NowFunc:        clock.now,
 	}
 
 	// Connect to database
@@ -52,15 +72,35 @@ func Connect(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
 	}
 
-	pool := cfg.Database.ConnectionPool
+	// Zero would leave the pool without idle connections or limits, so
+	// missing settings get defaults, which db:info and the monitor then show
+	pool, defaulted := cfg.Database.ConnectionPool.WithDefaults()
+	if len(defaulted) > 0 {
+		applog.Warnf("Connection pool settings missing or zero, using %s\n", strings.Join(defaulted, ", "))
+	}
+	cfg.Database.ConnectionPool = pool
 	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
 	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Duration(pool.ConnMaxLifetime) * time.Second)
+	if cfg.Database.Driver == "sqlite" && cfg.Database.SQLite.InMemory() {
+		// The in-memory database is dropped with its last connection, so
+		// keep one open for the life of the process
+		sqlDB.SetMaxIdleConns(max(pool.MaxIdleConns, 1))
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
 
 	// Test the connection
 	if err := sqlDB.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
+	if err := clock.sync(db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})); err != nil {
+		return nil, err
+	}
+	if cfg.Database.Driver == "sqlite" && cfg.Database.SQLite.BulkMode && !cfg.Database.SQLite.InMemory() {
+		applog.Printf("SQLite bulk mode: WAL journal, synchronous=OFF, %d MB page cache per connection\n",
+			cfg.Database.SQLite.BulkCacheSizeMB())
+	}
 
 	// Set global DB instance
 	DB = db
@@ -68,6 +108,18 @@ func Connect(cfg *config.Config) (*gorm.DB, error) {
 	return db, nil
 }
 
+// tableNaming adds the table suffix to GORM's default naming, for models
+// without an explicit TableName such as the migration table
+type tableNaming struct {
+	schema.NamingStrategy
+	suffix string
+}
+
+// TableName returns the prefixed and suffixed table name of a model
+func (tn tableNaming) TableName(str string) string {
+	return tn.NamingStrategy.TableName(str) + tn.suffix
+}
+
 // Close closes the database connection
 func Close() error {
 	if DB != nil {
@@ -103,6 +155,60 @@ func IsConnected() bool {
 	return true
 }
 
+// DataStats summarizes the readings in sensor_data
+type DataStats struct {
+	Records          int64
+	Sensors          int64
+	Earliest, Latest time.Time // Zero without readings
+	Excluded         int64     // Readings left out by active exclusions
+}
+
+// GetDataStats counts the readings in sensor_data and their sensors and
+// finds their time range. Readings covered by an active exclusion are left
+// out, like queries and exports leave them out, unless includeExcluded is
+// set; they are counted in Excluded either way.
+func GetDataStats(includeExcluded bool) (*DataStats, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	db := quietSession()
+	notExcluded := sensorquery.NotExcluded(db, models.SensorData{}.TableName())
+	readings := func() *gorm.DB {
+		query := db.Model(&models.SensorData{})
+		if !includeExcluded && notExcluded != "" {
+			query = query.Where(notExcluded)
+		}
+		return query
+	}
+
+	stats := &DataStats{}
+	if err := readings().Count(&stats.Records).Error; err != nil {
+		return nil, fmt.Errorf("failed to count readings: %w", err)
+	}
+	if err := readings().Distinct("sensor_name").Count(&stats.Sensors).Error; err != nil {
+		return nil, fmt.Errorf("failed to count sensors: %w", err)
+	}
+	if stats.Records > 0 {
+		var earliest, latest []time.Time
+		if err := readings().Order("timestamp").Limit(1).Pluck("timestamp", &earliest).Error; err != nil {
+			return nil, fmt.Errorf("failed to find the earliest reading: %w", err)
+		}
+		if err := readings().Order("timestamp DESC").Limit(1).Pluck("timestamp", &latest).Error; err != nil {
+			return nil, fmt.Errorf("failed to find the latest reading: %w", err)
+		}
+		if len(earliest) > 0 && len(latest) > 0 {
+			stats.Earliest, stats.Latest = earliest[0], latest[0]
+		}
+	}
+	if notExcluded != "" {
+		if err := db.Model(&models.SensorData{}).Where("NOT " + notExcluded).Count(&stats.Excluded).Error; err != nil {
+			return nil, fmt.Errorf("failed to count excluded readings: %w", err)
+		}
+	}
+	return stats, nil
+}
+
 // GetDatabaseInfo returns information about the connected database
 func GetDatabaseInfo(cfg *config.Config) map[string]interface{} {
 	info := make(map[string]interface{})
@@ -117,6 +223,8 @@ func GetDatabaseInfo(cfg *config.Config) map[string]interface{} {
 			info["open_connections"] = stats.OpenConnections
 			info["in_use"] = stats.InUse
 			info["idle"] = stats.Idle
+			info["wait_count"] = stats.WaitCount
+			info["wait_duration"] = stats.WaitDuration.String()
 		}
 	}
 
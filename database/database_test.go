@@ -0,0 +1,138 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB connects the package to a new SQLite database with the baseline
+// tables, closed when the test ends
+func openTestDB(t *testing.T) *config.Config {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.IDStrategy = models.IDAutoIncrement
+	cfg.Database.SQLite.Path = filepath.Join(t.TempDir(), "sensor.db")
+	db, err := Connect(cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	DB = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	if err := DB.AutoMigrate(baselineModels...); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		DB = nil
+	})
+	return cfg
+}
+
+// insertRows stores rows through db
+func insertRows[T any](t *testing.T, db *gorm.DB, rows ...T) []T {
+	t.Helper()
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatalf("insert %T: %v", rows, err)
+	}
+	return rows
+}
+
+// insertReadings stores readings in sensor_data
+func insertReadings(t *testing.T, readings ...models.SensorData) {
+	t.Helper()
+	insertRows(t, DB, readings...)
+}
+
+// countRows returns the number of rows of a model's table
+func countRows(t *testing.T, model interface{}) int64 {
+	t.Helper()
+	var count int64
+	if err := DB.Model(model).Count(&count).Error; err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	return count
+}
+
+// reading builds a reading of sensor at minute past midnight of 2025-09-01 UTC
+func reading(sensor string, minute int, value float64) models.SensorData {
+	return models.SensorData{
+		Timestamp:  time.Date(2025, 9, 1, 0, minute, 0, 0, time.UTC),
+		SensorName: sensor,
+		Value:      value,
+	}
+}
+
+// rawReading builds a row of the raw ingest table like reading
+func rawReading(id uint, sensor string, minute int, value float64) models.SensorDataRaw {
+	r := reading(sensor, minute, value)
+	return models.SensorDataRaw{ID: id, Timestamp: r.Timestamp, SensorName: r.SensorName, Value: r.Value}
+}
+
+// importBatch records an import batch of the file at path
+func importBatch(t *testing.T, path, sha256 string) models.ImportFile {
+	t.Helper()
+	return insertRows(t, DB, models.ImportFile{
+		FilePath:   path,
+		SHA256:     sha256,
+		ModifiedAt: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		ImportedAt: time.Now().UTC(),
+		Completed:  true,
+	})[0]
+}
+
+// importRun records an import run
+func importRun(t *testing.T) models.ImportRun {
+	t.Helper()
+	return insertRows(t, DB, models.ImportRun{Command: "scan", StartedAt: time.Now().UTC()})[0]
+}
+
+// fromBatch marks a reading as written by an import batch
+func fromBatch(r models.SensorData, batchID uint) models.SensorData {
+	r.ImportFileID = &batchID
+	return r
+}
+
+// fromRun marks a reading as written by an import run
+func fromRun(r models.SensorData, runID uint) models.SensorData {
+	r.SourceRunID = &runID
+	return r
+}
+
+// storedValues returns the value of every reading in sensor_data by sensor
+// name and minute
+func storedValues(t *testing.T) map[string]float64 {
+	t.Helper()
+	var readings []models.SensorData
+	if err := DB.Order("timestamp, sensor_name").Find(&readings).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	values := make(map[string]float64)
+	for _, r := range readings {
+		values[r.SensorName+"@"+r.Timestamp.UTC().Format("15:04")] = r.Value
+	}
+	return values
+}
+
+// lastValue returns the cached latest value of a sensor
+func lastValue(t *testing.T, sensor string) (float64, bool) {
+	t.Helper()
+	var last []models.SensorLastValue
+	if err := DB.Where("sensor_name = ?", sensor).Find(&last).Error; err != nil {
+		t.Fatalf("read last value: %v", err)
+	}
+	if len(last) == 0 {
+		return 0, false
+	}
+	return last[0].Value, true
+}
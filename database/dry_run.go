@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// dryRunCallback names the callbacks recording the statements of a dry run
+const dryRunCallback = "dry_run:record"
+
+// DryRunStatement is a statement a dry run executed and the rows it affected
+type DryRunStatement struct {
+	SQL  string
+	Rows int64
+}
+
+// recording collects the statements of the dry run in progress
+var recording struct {
+	sync.Mutex
+	statements *[]DryRunStatement // nil outside a dry run
+}
+
+// DryRun runs fn in a transaction that is rolled back afterwards, so a
+// destructive command can show what it would change without changing it.
+// While fn runs, the package functions use the transaction. It returns the
+// statements that modified data, with the rows each affected. Schema changes
+// cannot be rehearsed this way, since MySQL commits them implicitly.
+func DryRun(fn func() error) ([]DryRunStatement, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+	if err := registerDryRunCallbacks(DB); err != nil {
+		return nil, fmt.Errorf("failed to record statements: %w", err)
+	}
+
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	var statements []DryRunStatement
+	recording.Lock()
+	recording.statements = &statements
+	recording.Unlock()
+
+	connected := DB
+	DB = tx
+	defer func() {
+		DB = connected
+		recording.Lock()
+		recording.statements = nil
+		recording.Unlock()
+		tx.Rollback()
+	}()
+
+	err := fn()
+	return statements, err
+}
+
+// registerDryRunCallbacks adds the callbacks recording statements that modify
+// data, once per connection
+func registerDryRunCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if callbacks.Raw().Get(dryRunCallback) != nil {
+		return nil
+	}
+	return errors.Join(
+		callbacks.Create().After("gorm:create").Register(dryRunCallback, recordStatement),
+		callbacks.Update().After("gorm:update").Register(dryRunCallback, recordStatement),
+		callbacks.Delete().After("gorm:delete").Register(dryRunCallback, recordStatement),
+		callbacks.Raw().After("gorm:raw").Register(dryRunCallback, recordStatement),
+	)
+}
+
+// recordStatement records a statement executed during a dry run, leaving out
+// the savepoints of nested transactions
+func recordStatement(db *gorm.DB) {
+	recording.Lock()
+	defer recording.Unlock()
+	if recording.statements == nil || db.Error != nil {
+		return
+	}
+
+	sql := db.Statement.SQL.String()
+	keyword := strings.ToUpper(strings.TrimSpace(sql))
+	for _, prefix := range []string{"SAVEPOINT", "RELEASE", "ROLLBACK"} {
+		if strings.HasPrefix(keyword, prefix) {
+			return
+		}
+	}
+	*recording.statements = append(*recording.statements, DryRunStatement{
+		SQL:  db.Dialector.Explain(sql, db.Statement.Vars...),
+		Rows: db.RowsAffected,
+	})
+}
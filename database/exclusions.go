@@ -0,0 +1,170 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"sensor_data_import/models"
+	"sensor_data_import/rollup"
+	"sensor_data_import/sensorquery"
+
+	"gorm.io/gorm"
+)
+
+// ErrExclusionNotFound is returned when revoking an exclusion that does not
+// exist or was already revoked
+var ErrExclusionNotFound = errors.New("active exclusion not found")
+
+// NewExclusion checks an exclusion before it is stored: the time range must
+// not be reversed and the sensor pattern must be a valid glob. A zero endsAt
+// excludes the readings at startsAt only.
+func NewExclusion(startsAt, endsAt time.Time, sensorPattern, reason, author string) (*models.ReadingExclusion, error) {
+	if endsAt.IsZero() {
+		endsAt = startsAt
+	}
+	if startsAt.IsZero() {
+		return nil, fmt.Errorf("exclusion start time is required")
+	}
+	if endsAt.Before(startsAt) {
+		return nil, fmt.Errorf("exclusion ends before it starts")
+	}
+	if sensorPattern = strings.TrimSpace(sensorPattern); sensorPattern == "" {
+		return nil, fmt.Errorf("exclusion sensor pattern is required (* for every sensor)")
+	}
+	if _, err := path.Match(sensorPattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid sensor pattern %q: %w", sensorPattern, err)
+	}
+	if reason = strings.TrimSpace(reason); reason == "" {
+		return nil, fmt.Errorf("exclusion reason is required")
+	}
+	if len(reason) > 1024 || len(sensorPattern) > 255 || len(author) > 255 {
+		return nil, fmt.Errorf("exclusion reason, sensor pattern or author is too long")
+	}
+
+	return &models.ReadingExclusion{
+		StartsAt:      startsAt.UTC(),
+		EndsAt:        endsAt.UTC(),
+		SensorPattern: sensorPattern,
+		SensorLike:    sensorquery.GlobToLike(sensorPattern),
+		Reason:        reason,
+		Author:        strings.TrimSpace(author),
+	}, nil
+}
+
+// CreateExclusion stores an exclusion built by NewExclusion and returns the
+// number of readings it covers. The aggregated intervals it covers are
+// merged again without their readings.
+func CreateExclusion(exclusion *models.ReadingExclusion) (int64, error) {
+	if DB == nil {
+		return 0, fmt.Errorf("database is not connected")
+	}
+
+	var readings int64
+	var intervals []rollup.Key
+	err := quietSession().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(exclusion).Error; err != nil {
+			return fmt.Errorf("failed to store exclusion: %w", err)
+		}
+		var err error
+		if intervals, err = markExcludedAggregates(tx, exclusion); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SensorData{}).
+			Where("timestamp BETWEEN ? AND ?", exclusion.StartsAt, exclusion.EndsAt).
+			Where("sensor_name LIKE ? ESCAPE '!'", exclusion.SensorLike).
+			Count(&readings).Error; err != nil {
+			return fmt.Errorf("failed to count excluded readings: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	recomputeAggregates(intervals)
+	return readings, nil
+}
+
+// ListExclusions returns the exclusions, oldest first; revoked ones only
+// with includeRevoked
+func ListExclusions(includeRevoked bool) ([]models.ReadingExclusion, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	query := quietSession().Order("id")
+	if !includeRevoked {
+		query = query.Where("revoked_at IS NULL")
+	}
+	var exclusions []models.ReadingExclusion
+	if err := query.Find(&exclusions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list exclusions: %w", err)
+	}
+	return exclusions, nil
+}
+
+// RevokeExclusion makes the readings of an exclusion count again, in the
+// aggregates too. The exclusion is kept, with who revoked it and when, for
+// audit.
+func RevokeExclusion(id uint, revokedBy string) error {
+	if DB == nil {
+		return fmt.Errorf("database is not connected")
+	}
+
+	var intervals []rollup.Key
+	err := quietSession().Transaction(func(tx *gorm.DB) error {
+		var exclusion models.ReadingExclusion
+		if err := tx.Where("id = ? AND revoked_at IS NULL", id).Limit(1).Find(&exclusion).Error; err != nil {
+			return fmt.Errorf("failed to load exclusion: %w", err)
+		}
+		if exclusion.ID == 0 {
+			return fmt.Errorf("%w: %d", ErrExclusionNotFound, id)
+		}
+
+		result := tx.Model(&models.ReadingExclusion{}).
+			Where("id = ? AND revoked_at IS NULL", id).
+			Updates(map[string]interface{}{"revoked_at": time.Now().UTC(), "revoked_by": strings.TrimSpace(revokedBy)})
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke exclusion: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: %d", ErrExclusionNotFound, id)
+		}
+		var err error
+		intervals, err = markExcludedAggregates(tx, &exclusion)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	recomputeAggregates(intervals)
+	return nil
+}
+
+// markExcludedAggregates flags the aggregated intervals of the exclusion's
+// sensors that start within its time range dirty, so they are merged again
+// with the exclusion applied, and returns them. Only intervals the exclusion
+// covers entirely leave the aggregates; readings of aggregated sensors
+// imported while it is active are stored individually instead.
+func markExcludedAggregates(tx *gorm.DB, exclusion *models.ReadingExclusion) ([]rollup.Key, error) {
+	if !tx.Migrator().HasTable(&models.SensorAggregatePart{}) {
+		return nil, nil
+	}
+	var parts []models.SensorAggregatePart
+	if err := tx.Model(&models.SensorAggregatePart{}).Distinct("bucket_start", "sensor_name", "interval_seconds").
+		Where("bucket_start BETWEEN ? AND ?", exclusion.StartsAt, exclusion.EndsAt).
+		Where("sensor_name LIKE ? ESCAPE '!'", exclusion.SensorLike).
+		Find(&parts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list excluded aggregates: %w", err)
+	}
+	keys := make([]rollup.Key, len(parts))
+	for i, part := range parts {
+		keys[i] = rollup.KeyOf(part)
+	}
+	if err := rollup.MarkDirty(tx, keys, rollupBatchSize); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+	"sensor_data_import/sensorquery"
+)
+
+func TestNewExclusion(t *testing.T) {
+	at := reading("temp_01", 0, 0).Timestamp
+	tests := []struct {
+		name             string
+		startsAt, endsAt time.Time
+		pattern, reason  string
+	}{
+		{"no start", time.Time{}, at, "*", "spike"},
+		{"reversed", at, at.Add(-time.Minute), "*", "spike"},
+		{"no pattern", at, at, " ", "spike"},
+		{"invalid pattern", at, at, "temp_[", "spike"},
+		{"no reason", at, at, "*", " "},
+	}
+	for _, tt := range tests {
+		if _, err := NewExclusion(tt.startsAt, tt.endsAt, tt.pattern, tt.reason, "test"); err == nil {
+			t.Errorf("%s: NewExclusion succeeded, want an error", tt.name)
+		}
+	}
+
+	exclusion, err := NewExclusion(at, time.Time{}, " temp_* ", "spike", "test")
+	if err != nil {
+		t.Fatalf("NewExclusion: %v", err)
+	}
+	if !exclusion.EndsAt.Equal(at) || exclusion.SensorPattern != "temp_*" {
+		t.Errorf("exclusion = %+v, want temp_* at %s only", *exclusion, at)
+	}
+}
+
+// Readings under an exclusion are left out of queries until it is revoked
+func TestRevokeExclusion(t *testing.T) {
+	openTestDB(t)
+	insertReadings(t,
+		reading("temp_01", 0, 1),
+		reading("temp_01", 1, 100),
+		reading("temp_02", 1, 2),
+		reading("humidity_01", 1, 50),
+	)
+
+	exclusion, err := NewExclusion(reading("", 1, 0).Timestamp, time.Time{}, "temp_*", "spike", "alice")
+	if err != nil {
+		t.Fatalf("NewExclusion: %v", err)
+	}
+	covered, err := CreateExclusion(exclusion)
+	if err != nil {
+		t.Fatalf("CreateExclusion: %v", err)
+	}
+	if covered != 2 {
+		t.Errorf("exclusion covers %d readings, want 2", covered)
+	}
+	if rows, err := sensorquery.Readings().Find(ReadingSource()); err != nil || len(rows) != 2 {
+		t.Errorf("with the exclusion: %d readings, %v; want 2", len(rows), err)
+	}
+	if stats, err := GetDataStats(false); err != nil || stats.Records != 2 || stats.Sensors != 2 || stats.Excluded != 2 {
+		t.Errorf("stats = %+v, %v; want 2 readings of 2 sensors and 2 excluded", stats, err)
+	}
+	if stats, err := GetDataStats(true); err != nil || stats.Records != 4 || stats.Sensors != 3 {
+		t.Errorf("stats including excluded readings = %+v, %v; want 4 readings of 3 sensors", stats, err)
+	}
+
+	if err := RevokeExclusion(exclusion.ID, " bob "); err != nil {
+		t.Fatalf("RevokeExclusion: %v", err)
+	}
+	if rows, err := sensorquery.Readings().Find(ReadingSource()); err != nil || len(rows) != 4 {
+		t.Errorf("after revoking: %d readings, %v; want 4", len(rows), err)
+	}
+	if err := RevokeExclusion(exclusion.ID, "bob"); !errors.Is(err, ErrExclusionNotFound) {
+		t.Errorf("revoking again: %v, want ErrExclusionNotFound", err)
+	}
+
+	// The revoked exclusion stays listed for audit
+	if active, err := ListExclusions(false); err != nil || len(active) != 0 {
+		t.Errorf("active exclusions = %+v, %v; want none", active, err)
+	}
+	all, err := ListExclusions(true)
+	if err != nil || len(all) != 1 {
+		t.Fatalf("all exclusions = %+v, %v; want the revoked one", all, err)
+	}
+	if all[0].RevokedAt == nil || all[0].RevokedBy != "bob" {
+		t.Errorf("revoked exclusion = %+v, want revoked by bob", all[0])
+	}
+}
+
+// An exclusion covering an aggregated interval entirely leaves it out of the
+// aggregates until it is revoked
+func TestExclusionMergesAggregates(t *testing.T) {
+	openTestDB(t)
+	hour := reading("vib_01", 0, 0).Timestamp
+	for _, start := range []time.Time{hour, hour.Add(time.Hour)} {
+		part := models.SensorAggregatePart{BucketStart: start, SensorName: "vib_01", IntervalSeconds: 3600, ImportFileID: 1,
+			ReadingCount: 2, MinValue: 1, MaxValue: 3, AvgValue: 2}
+		aggregate := models.SensorAggregate{BucketStart: start, SensorName: "vib_01", IntervalSeconds: 3600,
+			ReadingCount: 2, MinValue: 1, MaxValue: 3, AvgValue: 2}
+		insertRows(t, DB, part)
+		insertRows(t, DB, aggregate)
+	}
+	intervals := func() []time.Time {
+		t.Helper()
+		var starts []time.Time
+		if err := DB.Model(&models.SensorAggregate{}).Where("dirty = ?", false).Order("bucket_start").
+			Pluck("bucket_start", &starts).Error; err != nil {
+			t.Fatalf("read aggregates: %v", err)
+		}
+		return starts
+	}
+
+	// The second interval is only partly excluded and stays
+	exclusion, err := NewExclusion(hour, hour.Add(90*time.Minute), "vib_*", "sensor fault", "alice")
+	if err != nil {
+		t.Fatalf("NewExclusion: %v", err)
+	}
+	if _, err := CreateExclusion(exclusion); err != nil {
+		t.Fatalf("CreateExclusion: %v", err)
+	}
+	if starts := intervals(); len(starts) != 1 || !starts[0].Equal(hour.Add(time.Hour)) {
+		t.Errorf("intervals with the exclusion = %v, want only the second", starts)
+	}
+
+	if err := RevokeExclusion(exclusion.ID, "bob"); err != nil {
+		t.Fatalf("RevokeExclusion: %v", err)
+	}
+	if starts := intervals(); len(starts) != 2 {
+		t.Errorf("intervals after revoking = %v, want both", starts)
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrExportStateNotFound is returned when an incremental export has no state
+var ErrExportStateNotFound = errors.New("export state not found")
+
+// LoadExportState returns the watermark of a named incremental export; zero
+// before its first export
+func LoadExportState(name string) (time.Time, error) {
+	if DB == nil {
+		return time.Time{}, fmt.Errorf("database is not connected")
+	}
+	var state models.ExportState
+	err := quietSession().Where("name = ?", name).Take(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read export state %s: %w", name, err)
+	}
+	// Compared with created_at, which is stamped in the local zone
+	return state.Watermark.Local(), nil
+}
+
+// SaveExportState records that a named incremental export returned every
+// reading stored up to watermark
+func SaveExportState(name string, watermark time.Time) error {
+	if DB == nil {
+		return fmt.Errorf("database is not connected")
+	}
+	state := models.ExportState{Name: name, Watermark: watermark, UpdatedAt: time.Now().UTC()}
+	onConflict := clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoUpdates: clause.AssignmentColumns([]string{"watermark", "updated_at"})}
+	if err := quietSession().Clauses(onConflict).Create(&state).Error; err != nil {
+		return fmt.Errorf("failed to save export state %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListExportStates returns the states of the incremental exports by name
+func ListExportStates() ([]models.ExportState, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+	var states []models.ExportState
+	if err := quietSession().Order("name").Find(&states).Error; err != nil {
+		return nil, fmt.Errorf("failed to list export states: %w", err)
+	}
+	return states, nil
+}
+
+// DeleteExportState removes the state of a named incremental export, whose
+// next export starts again with the first reading
+func DeleteExportState(name string) error {
+	if DB == nil {
+		return fmt.Errorf("database is not connected")
+	}
+	result := quietSession().Where("name = ?", name).Delete(&models.ExportState{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete export state: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrExportStateNotFound, name)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// TableIDStrategy returns how the existing sensor_data table is keyed, or an
+// empty string when it does not exist. SQLite assigns a missing integer
+// primary key itself, so an id column there reads as auto_increment.
+func TableIDStrategy(db *gorm.DB) (string, error) {
+	table := models.SensorData{}.TableName()
+	migrator := db.Migrator()
+	if !migrator.HasTable(table) {
+		return "", nil
+	}
+	if !migrator.HasColumn(table, "id") {
+		return models.IDComposite, nil
+	}
+
+	var generated bool
+	switch db.Dialector.Name() {
+	case "mysql":
+		var extra string
+		err := db.Raw("SELECT EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'id'", table).
+			Scan(&extra).Error
+		if err != nil {
+			return "", fmt.Errorf("failed to read the id column of %s: %w", table, err)
+		}
+		generated = strings.Contains(strings.ToLower(extra), "auto_increment")
+	case "postgres":
+		var column struct {
+			ColumnDefault *string
+			IsIdentity    string
+		}
+		err := db.Raw("SELECT column_default, is_identity FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = 'id'", table).
+			Scan(&column).Error
+		if err != nil {
+			return "", fmt.Errorf("failed to read the id column of %s: %w", table, err)
+		}
+		generated = column.IsIdentity == "YES" ||
+			(column.ColumnDefault != nil && strings.HasPrefix(*column.ColumnDefault, "nextval("))
+	default:
+		generated = true
+	}
+
+	if generated {
+		return models.IDAutoIncrement, nil
+	}
+	return models.IDSnowflake, nil
+}
+
+// CheckIDStrategy returns an error when sensor_data exists but is keyed
+// differently from the configured database.id_strategy, since changing the
+// setting does not change an existing table
+func CheckIDStrategy() error {
+	if DB == nil {
+		return fmt.Errorf("database is not connected")
+	}
+	return checkIDStrategy(quietSession(), false)
+}
+
+// checkIDStrategy compares the key of sensor_data with the configured ID
+// strategy. With allowEmpty an empty table may still be converted.
+func checkIDStrategy(db *gorm.DB, allowEmpty bool) error {
+	actual, err := TableIDStrategy(db)
+	if err != nil || actual == "" {
+		return err
+	}
+	configured := models.IDStrategy()
+	// Explicit IDs fit the self-assigning SQLite key as well
+	if actual == configured || (db.Dialector.Name() == "sqlite" && actual == models.IDAutoIncrement && configured == models.IDSnowflake) {
+		return nil
+	}
+
+	table := models.SensorData{}.TableName()
+	var count int64
+	if err := db.Table(table).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count the rows of %s: %w", table, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%s is keyed by %s but database.id_strategy is %s: refusing to change the ID strategy of a table holding %d readings, set id_strategy back to %s",
+			table, actual, configured, count, actual)
+	}
+	if allowEmpty {
+		return nil
+	}
+	return fmt.Errorf("%s is keyed by %s but database.id_strategy is %s: the strategy is applied when the migrations create the table, so convert the empty table by hand (see the README) or set id_strategy back to %s",
+		table, actual, configured, actual)
+}
@@ -7,10 +7,12 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/template"
 	"time"
 
 	"sensor_data_import/config"
 	"sensor_data_import/logger"
+	"sensor_data_import/models"
 
 	"gorm.io/gorm"
 )
@@ -34,6 +36,9 @@ type MigrationFile struct {
 	Applied     bool
 }
 
+// baselineVersion is the migration creating sensor_data
+const baselineVersion = "20250905_050500"
+
 // MigrationRunner handles database migrations
 type MigrationRunner struct {
 	db             *gorm.DB
@@ -168,6 +173,28 @@ func (mr *MigrationRunner) RunMigrations() error {
 		return nil
 	}
 
+	for _, migration := range pendingMigrations {
+		if migration.Version == baselineVersion && mr.unprefixedSensorDataTaken() {
+			return fmt.Errorf("migration %s creates sensor_data before renaming it to %s, but another dataset already uses sensor_data: "+
+				"run init instead, which creates the tables from the models", baselineVersion, models.TableName("sensor_data"))
+		}
+	}
+
+	// A migration keying sensor_data by the ID strategy must not rewrite a
+	// populated table keyed differently
+	for _, migration := range pendingMigrations {
+		uses, err := usesIDStrategy(migration)
+		if err != nil {
+			return err
+		}
+		if uses {
+			if err := checkIDStrategy(mr.db, true); err != nil {
+				return fmt.Errorf("cannot run migration %s: %w", migration.Version, err)
+			}
+			break
+		}
+	}
+
 	logger.Printf("Running %d pending migration(s)...\n", len(pendingMigrations))
 
 	for _, migration := range pendingMigrations {
@@ -184,17 +211,34 @@ func (mr *MigrationRunner) RunMigrations() error {
 func (mr *MigrationRunner) runSingleMigration(migrationFile MigrationFile) error {
 	logger.Printf("Running migration: %s - %s\n", migrationFile.Version, migrationFile.Name)
 
-	// Read migration file content
-	content, err := os.ReadFile(migrationFile.FilePath)
+	sql, err := mr.MigrationSQL(migrationFile)
 	if err != nil {
-		return fmt.Errorf("failed to read migration file: %w", err)
+		return err
+	}
+
+	// A sensor_data table already keyed as configured needs no conversion
+	uses, err := usesIDStrategy(migrationFile)
+	if err != nil {
+		return err
+	}
+	if uses {
+		actual, err := TableIDStrategy(mr.db)
+		if err != nil {
+			return err
+		}
+		if actual == models.IDStrategy() {
+			sql = ""
+		}
 	}
 
 	// Execute migration in a transaction
 	return mr.db.Transaction(func(tx *gorm.DB) error {
-		// Execute the SQL
-		if err := tx.Exec(string(content)).Error; err != nil {
-			return fmt.Errorf("failed to execute migration SQL: %w", err)
+		// Execute the SQL one statement at a time, as MySQL connections do not
+		// accept several in one query
+		for _, statement := range migrationStatements(sql) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to execute migration SQL: %w", err)
+			}
 		}
 
 		// Record migration as applied
@@ -215,6 +259,96 @@ func (mr *MigrationRunner) runSingleMigration(migrationFile MigrationFile) error
 	})
 }
 
+// MigrationSQL returns the SQL of a migration file with the configured table
+// names applied
+func (mr *MigrationRunner) MigrationSQL(migrationFile MigrationFile) (string, error) {
+	content, err := os.ReadFile(migrationFile.FilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read migration file: %w", err)
+	}
+
+	// Apply the configured table prefix and suffix
+	sql, err := renderMigration(string(content), mr.db.Dialector.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to render migration %s: %w", migrationFile.Version, err)
+	}
+	return sql, nil
+}
+
+// renderMigration expands {{table "name"}} references in migration SQL to
+// the configured table names; {{idStrategy}} returns the sensor_data ID
+// strategy and {{driver}} the database driver
+func renderMigration(content, driver string) (string, error) {
+	tmpl, err := template.New("migration").
+		Funcs(template.FuncMap{
+			"table":      models.TableName,
+			"idStrategy": models.IDStrategy,
+			"driver":     func() string { return driver },
+		}).
+		Parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	var sql strings.Builder
+	if err := tmpl.Execute(&sql, nil); err != nil {
+		return "", err
+	}
+	return sql.String(), nil
+}
+
+// migrationStatements splits migration SQL into its statements, leaving out
+// comment lines and statements a template rendered empty. Statements end with
+// a semicolon at the end of a line.
+func migrationStatements(sql string) []string {
+	var statements []string
+	var statement strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(statement.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// usesIDStrategy reports whether a migration file depends on the configured
+// ID strategy
+func usesIDStrategy(migrationFile MigrationFile) (bool, error) {
+	content, err := os.ReadFile(migrationFile.FilePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read migration file: %w", err)
+	}
+	return strings.Contains(string(content), "idStrategy"), nil
+}
+
+// PendingMigrations returns the versions of the migration files not yet
+// applied to the connected database, without logging its queries, for
+// commands that check the schema while they run
+func PendingMigrations(cfg *config.Config) ([]string, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+	pending, err := NewMigrationRunner(quietSession(), cfg).GetPendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, len(pending))
+	for i, migration := range pending {
+		versions[i] = migration.Version
+	}
+	return versions, nil
+}
+
 // GetMigrationStatus returns the status of all migrations
 func (mr *MigrationRunner) GetMigrationStatus() ([]MigrationFile, error) {
 	// Get all migration files
@@ -265,8 +399,9 @@ func (mr *MigrationRunner) CreateMigration(name string) (string, error) {
 -- Description: %s
 
 -- Add your migration SQL here
+-- Refer to tables as {{table "name"}} so the configured table_prefix/table_suffix apply
 -- Example:
--- CREATE TABLE example (
+-- CREATE TABLE {{table "example"}} (
 --     id INT AUTO_INCREMENT PRIMARY KEY,
 --     name VARCHAR(255) NOT NULL,
 --     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
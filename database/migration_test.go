@@ -0,0 +1,120 @@
+package database
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sensor_data_import/models"
+)
+
+func TestMigrationStatements(t *testing.T) {
+	sql := `-- Migration: Example
+-- Description: two statements
+
+ALTER TABLE sensor_data
+    ADD COLUMN source_file VARCHAR(768) NULL;
+
+CREATE INDEX idx_source_file ON sensor_data (source_file);
+`
+	want := []string{
+		"ALTER TABLE sensor_data\n    ADD COLUMN source_file VARCHAR(768) NULL;",
+		"CREATE INDEX idx_source_file ON sensor_data (source_file);",
+	}
+	if got := migrationStatements(sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("migrationStatements = %q, want %q", got, want)
+	}
+	if got := migrationStatements("-- Only comments\n\n"); len(got) != 0 {
+		t.Errorf("migrationStatements of comments = %q, want none", got)
+	}
+}
+
+func TestRenderIDStrategyMigration(t *testing.T) {
+	content, err := os.ReadFile("../migrations/20250905_050600_apply_sensor_data_id_strategy.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	defer models.SetIDStrategy(models.IDAutoIncrement, 0)
+
+	tests := []struct {
+		strategy, driver string
+		want             string // Expected statement; empty for none
+	}{
+		{models.IDAutoIncrement, "mysql", ""},
+		{models.IDSnowflake, "mysql", "MODIFY id BIGINT NOT NULL"},
+		{models.IDComposite, "mysql", "ADD PRIMARY KEY (timestamp, sensor_name)"},
+		{models.IDSnowflake, "postgres", "ALTER COLUMN id DROP DEFAULT"},
+		{models.IDSnowflake, "sqlite", ""},
+	}
+	for _, tt := range tests {
+		models.SetIDStrategy(tt.strategy, 0)
+		sql, err := renderMigration(string(content), tt.driver)
+		if err != nil {
+			t.Fatalf("render %s on %s: %v", tt.strategy, tt.driver, err)
+		}
+		statements := migrationStatements(sql)
+		switch {
+		case tt.want == "" && len(statements) != 0:
+			t.Errorf("%s on %s renders %q, want nothing", tt.strategy, tt.driver, statements)
+		case tt.want != "" && (len(statements) != 1 || !strings.Contains(statements[0], tt.want)):
+			t.Errorf("%s on %s renders %q, want one statement with %q", tt.strategy, tt.driver, statements, tt.want)
+		}
+	}
+}
+
+func TestCheckIDStrategy(t *testing.T) {
+	openTestDB(t)
+	defer models.SetIDStrategy(models.IDAutoIncrement, 0)
+
+	if actual, err := TableIDStrategy(DB); err != nil || actual != models.IDAutoIncrement {
+		t.Fatalf("TableIDStrategy = %q, %v, want auto_increment", actual, err)
+	}
+
+	// SQLite assigns missing IDs itself, so snowflake IDs fit the same table
+	models.SetIDStrategy(models.IDSnowflake, 0)
+	if err := CheckIDStrategy(); err != nil {
+		t.Errorf("snowflake on an auto-increment SQLite table: %v", err)
+	}
+
+	models.SetIDStrategy(models.IDComposite, 0)
+	if err := checkIDStrategy(DB, true); err != nil {
+		t.Errorf("composite on an empty table before its migration: %v", err)
+	}
+	if err := CheckIDStrategy(); err == nil {
+		t.Error("composite on an empty auto-increment table was accepted")
+	}
+
+	models.SetIDStrategy(models.IDAutoIncrement, 0)
+	insertReadings(t, reading("temp_01", 0, 1))
+	models.SetIDStrategy(models.IDComposite, 0)
+	if err := checkIDStrategy(DB, true); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("composite on a populated auto-increment table: %v, want a refusal", err)
+	}
+}
+
+func TestRenderRenameMigration(t *testing.T) {
+	content, err := os.ReadFile("../migrations/20250905_050550_rename_sensor_data_table.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	defer models.SetTableNaming("", "")
+
+	sql, err := renderMigration(string(content), "mysql")
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if statements := migrationStatements(sql); len(statements) != 0 {
+		t.Errorf("unprefixed tables render %q, want nothing", statements)
+	}
+
+	models.SetTableNaming("trial_", "")
+	sql, err = renderMigration(string(content), "mysql")
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := []string{"ALTER TABLE sensor_data RENAME TO trial_sensor_data;"}
+	if statements := migrationStatements(sql); !reflect.DeepEqual(statements, want) {
+		t.Errorf("prefixed tables render %q, want %q", statements, want)
+	}
+}
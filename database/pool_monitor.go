@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+)
+
+// PoolMonitor periodically logs connection pool utilization and warns when
+// callers have to wait for a connection
+type PoolMonitor struct {
+	sqlDB    *sql.DB
+	interval time.Duration
+	workers  int
+
+	start    sql.DBStats
+	last     sql.DBStats
+	peakUsed int
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// StartPoolMonitor starts logging pool statistics every interval. Workers is
+// the number of concurrent importers, used to suggest pool settings.
+func StartPoolMonitor(interval time.Duration, workers int) (*PoolMonitor, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	stats := sqlDB.Stats()
+	pm := &PoolMonitor{
+		sqlDB:    sqlDB,
+		interval: interval,
+		workers:  workers,
+		start:    stats,
+		last:     stats,
+		stop:     make(chan struct{}),
+	}
+
+	pm.done.Add(1)
+	go pm.run()
+	return pm, nil
+}
+
+func (pm *PoolMonitor) run() {
+	defer pm.done.Done()
+
+	ticker := time.NewTicker(pm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			pm.sample()
+		case <-pm.stop:
+			return
+		}
+	}
+}
+
+// sample logs the current utilization and warns about new waits
+func (pm *PoolMonitor) sample() {
+	stats := pm.sqlDB.Stats()
+	pm.peakUsed = max(pm.peakUsed, stats.InUse)
+
+	limit := "unlimited"
+	if stats.MaxOpenConnections > 0 {
+		limit = fmt.Sprintf("%d", stats.MaxOpenConnections)
+	}
+	logger.Debugf("Connection pool: %d in use, %d idle, %d open (max %s), %d waits\n",
+		stats.InUse, stats.Idle, stats.OpenConnections, limit, stats.WaitCount)
+
+	waits := stats.WaitCount - pm.last.WaitCount
+	if waits > 0 {
+		waited := stats.WaitDuration - pm.last.WaitDuration
+		logger.Warnf("Connection pool exhausted: %d request(s) waited %v for a connection in the last %v; %s\n",
+			waits, waited.Round(time.Millisecond), pm.interval, pm.suggestion(stats))
+	}
+
+	if closed := stats.MaxIdleClosed - pm.last.MaxIdleClosed; closed > int64(pm.workers) {
+		logger.Warnf("Connection pool closed %d idle connection(s) over the max_idle_conns limit; "+
+			"consider raising database.connection_pool.max_idle_conns to at least %d\n", closed, pm.workers)
+	}
+
+	pm.last = stats
+}
+
+// suggestion proposes a config change for pool waits
+func (pm *PoolMonitor) suggestion(stats sql.DBStats) string {
+	if stats.MaxOpenConnections > 0 && stats.MaxOpenConnections < pm.workers {
+		return fmt.Sprintf("max_open_conns (%d) is below the worker count (%d); raise database.connection_pool.max_open_conns or reduce the workers",
+			stats.MaxOpenConnections, pm.workers)
+	}
+	return "consider raising database.connection_pool.max_open_conns or reducing the workers"
+}
+
+// Stop stops the monitor and logs totals for the monitored period
+func (pm *PoolMonitor) Stop() {
+	close(pm.stop)
+	pm.done.Wait()
+	pm.sample()
+
+	stats := pm.last
+	waits := stats.WaitCount - pm.start.WaitCount
+	logger.Printf("Connection pool: peak %d in use, %d wait(s) totalling %v\n",
+		pm.peakUsed, waits, (stats.WaitDuration - pm.start.WaitDuration).Round(time.Millisecond))
+}
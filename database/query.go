@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// readOnlyStatement matches statements that only read data
+var readOnlyStatement = regexp.MustCompile(`(?i)^(select|with|show|explain|describe|desc)\b`)
+
+// leadingComments matches SQL comments and whitespace before the statement
+var leadingComments = regexp.MustCompile(`^(\s+|--[^\n]*\n?|/\*.*?\*/)+`)
+
+// IsReadOnlyQuery reports whether sql is a single statement that only reads data
+func IsReadOnlyQuery(sql string) bool {
+	statement := strings.TrimSpace(leadingComments.ReplaceAllString(sql, ""))
+	statement = strings.TrimSuffix(statement, ";")
+	if strings.Contains(statement, ";") {
+		return false
+	}
+	return readOnlyStatement.MatchString(statement)
+}
+
+// QueryResult holds the columns and rows returned by a query
+type QueryResult struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// RunReadOnlyQuery runs a query in a read-only transaction that is always
+// rolled back, so even statements that slip past IsReadOnlyQuery cannot write
+func RunReadOnlyQuery(driver, query string) (*QueryResult, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	tx := quietSession().Begin(&sql.TxOptions{ReadOnly: true})
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	// SQLite ignores the read-only transaction option
+	if driver == "sqlite" {
+		if err := tx.Exec("PRAGMA query_only = ON").Error; err != nil {
+			return nil, fmt.Errorf("failed to make transaction read-only: %w", err)
+		}
+		defer tx.Exec("PRAGMA query_only = OFF")
+	}
+
+	return runQuery(tx, query)
+}
+
+// ExecStatement runs a statement that may modify data and returns the number of affected rows
+func ExecStatement(statement string) (int64, error) {
+	if DB == nil {
+		return 0, fmt.Errorf("database is not connected")
+	}
+
+	exec := quietSession().Exec(statement)
+	if exec.Error != nil {
+		return 0, exec.Error
+	}
+	return exec.RowsAffected, nil
+}
+
+// quietSession returns a session that does not log SQL, keeping query output clean
+func quietSession() *gorm.DB {
+	return DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+}
+
+func runQuery(db *gorm.DB, sql string) (*QueryResult, error) {
+	rows, err := db.Raw(sql).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{Columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			// Drivers return text columns as bytes
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+
+	return result, rows.Err()
+}
+
+// formatValue renders a value for table and CSV output
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteTable writes the result as an aligned text table
+func (qr *QueryResult) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(qr.Columns, "\t"))
+
+	separators := make([]string, len(qr.Columns))
+	for i, column := range qr.Columns {
+		separators[i] = strings.Repeat("-", len(column))
+	}
+	fmt.Fprintln(tw, strings.Join(separators, "\t"))
+
+	for _, row := range qr.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = formatValue(value)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes the result as CSV with a header row
+func (qr *QueryResult) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(qr.Columns); err != nil {
+		return err
+	}
+	for _, row := range qr.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			if value != nil {
+				cells[i] = formatValue(value)
+			}
+		}
+		if err := writer.Write(cells); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes the result as a JSON array of objects keyed by column
+func (qr *QueryResult) WriteJSON(w io.Writer) error {
+	objects := make([]map[string]interface{}, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		object := make(map[string]interface{}, len(row))
+		for i, value := range row {
+			object[qr.Columns[i]] = value
+		}
+		objects = append(objects, object)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(objects)
+}
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"sensor_data_import/sensorquery"
+)
+
+// ReadingSource returns the connected database as a source of reading
+// queries, or nil when no database is connected. The source looks up the
+// exclusions table once, so callers keep it for the queries that follow.
+func ReadingSource() *sensorquery.Source {
+	if DB == nil {
+		return nil
+	}
+	return sensorquery.NewSource(quietSession())
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+// ListRuns returns the import runs started at or after since (all runs for a
+// zero time), most recent first
+func ListRuns(since time.Time) ([]models.ImportRun, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	query := quietSession().Order("started_at DESC, id DESC")
+	if !since.IsZero() {
+		query = query.Where("started_at >= ?", since)
+	}
+
+	var runs []models.ImportRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list import runs: %w", err)
+	}
+	return runs, nil
+}
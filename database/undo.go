@@ -0,0 +1,212 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"sensor_data_import/models"
+	"sensor_data_import/rollup"
+
+	"gorm.io/gorm"
+)
+
+// UndoResult describes the readings an undo of a run or file removes
+type UndoResult struct {
+	Run        *models.ImportRun `json:"run,omitempty"` // The run undone, nil when undoing a file
+	Rows       int64             `json:"rows"`          // Readings in sensor_data
+	RawRows    int64             `json:"raw_rows"`      // Readings in the raw ingest table not compacted yet
+	Aggregates int64             `json:"aggregates"`    // Intervals of aggregated sensors the readings contributed to
+	Batches    []BatchInfo       `json:"batches"`       // Batches left without readings, whose files a later scan imports again
+	Undone     bool              `json:"undone"`        // False for a dry run
+}
+
+// readingTable is a table holding imported readings and the counter of an
+// UndoResult its readings add to
+type readingTable struct {
+	name       string
+	count      *int64
+	aggregates bool // Aggregate parts, whose intervals are merged again after deleting them
+}
+
+// readingTables returns the tables holding imported readings that exist
+func readingTables(db *gorm.DB, result *UndoResult) []readingTable {
+	tables := []readingTable{{name: models.SensorData{}.TableName(), count: &result.Rows}}
+	if rawTable := (models.SensorDataRaw{}).TableName(); db.Migrator().HasTable(rawTable) {
+		tables = append(tables, readingTable{name: rawTable, count: &result.RawRows})
+	}
+	if partTable := (models.SensorAggregatePart{}).TableName(); db.Migrator().HasTable(partTable) {
+		tables = append(tables, readingTable{name: partTable, count: &result.Aggregates, aggregates: true})
+	}
+	return tables
+}
+
+// UndoFile removes every reading imported from a file, in all of its import
+// batches, like RevertBatch does for one batch. name matches the stored path
+// of the file, or its trailing path elements such as the base name. With
+// dryRun only the counts are returned.
+func UndoFile(name string, dryRun bool) (*UndoResult, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	// LIKE narrows the candidates; the path is compared exactly below
+	var candidates []models.ImportFile
+	if err := quietSession().Where("file_path LIKE ?", "%"+name).Order("id").Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("failed to find import batches: %w", err)
+	}
+
+	result := &UndoResult{}
+	for _, batch := range candidates {
+		if batch.FilePath != name && !strings.HasSuffix(batch.FilePath, "/"+name) {
+			continue
+		}
+		info, err := GetBatch(batch.ID)
+		if err != nil {
+			return nil, err
+		}
+		result.Rows += info.Rows
+		result.RawRows += info.RawRows
+		result.Aggregates += info.Aggregates
+		result.Batches = append(result.Batches, *info)
+	}
+	if len(result.Batches) == 0 {
+		return nil, fmt.Errorf("no import batches found for %s", name)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	var intervals []rollup.Key
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var sensorNames []string
+		for i := range result.Batches {
+			names, keys, err := deleteBatch(tx, &result.Batches[i])
+			if err != nil {
+				return err
+			}
+			sensorNames = append(sensorNames, names...)
+			intervals = append(intervals, keys...)
+		}
+		return refreshLastValues(tx, sensorNames)
+	})
+	if err != nil {
+		return nil, err
+	}
+	recomputeAggregates(intervals)
+
+	result.Undone = true
+	return result, nil
+}
+
+// UndoRun removes every reading written by an import run. Batches whose
+// readings all came from the run lose their manifest entry and checkpoint
+// too, so a later scan imports their files again. The run itself stays
+// listed. With dryRun only the counts are returned.
+func UndoRun(runID uint, dryRun bool) (*UndoResult, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database is not connected")
+	}
+
+	db := quietSession()
+	if !db.Migrator().HasTable(&models.ImportRun{}) {
+		return nil, fmt.Errorf("import runs table not found; run migrate first")
+	}
+	var run models.ImportRun
+	if err := db.Where("id = ?", runID).Limit(1).Find(&run).Error; err != nil {
+		return nil, fmt.Errorf("failed to load import run: %w", err)
+	}
+	if run.ID == 0 {
+		return nil, fmt.Errorf("import run %d not found", runID)
+	}
+
+	result := &UndoResult{Run: &run}
+	tables := readingTables(db, result)
+	var batchIDs []uint
+	for _, table := range tables {
+		if err := db.Table(table.name).Where("source_run_id = ?", runID).Count(table.count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count readings in %s: %w", table.name, err)
+		}
+		var ids []uint
+		if err := db.Table(table.name).Where("source_run_id = ? AND import_file_id IS NOT NULL", runID).
+			Distinct().Pluck("import_file_id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to list import batches in %s: %w", table.name, err)
+		}
+		batchIDs = append(batchIDs, ids...)
+	}
+
+	var batches []models.ImportFile
+	if len(batchIDs) > 0 {
+		if err := db.Where("id IN ?", batchIDs).Order("id").Find(&batches).Error; err != nil {
+			return nil, fmt.Errorf("failed to load import batches: %w", err)
+		}
+	}
+	for _, batch := range batches {
+		emptied, err := onlyFromRun(db, tables, batch.ID, runID)
+		if err != nil {
+			return nil, err
+		}
+		if emptied {
+			info, err := GetBatch(batch.ID)
+			if err != nil {
+				return nil, err
+			}
+			result.Batches = append(result.Batches, *info)
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	var intervals []rollup.Key
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var sensorNames []string
+		if err := tx.Model(&models.SensorData{}).Where("source_run_id = ?", runID).
+			Distinct().Pluck("sensor_name", &sensorNames).Error; err != nil {
+			return fmt.Errorf("failed to list sensors: %w", err)
+		}
+
+		for _, table := range tables {
+			if table.aggregates {
+				var err error
+				if intervals, err = deleteAggregateParts(tx, "source_run_id = ?", runID); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE source_run_id = ?", table.name), runID).Error; err != nil {
+				return fmt.Errorf("failed to delete readings from %s: %w", table.name, err)
+			}
+		}
+		for _, info := range result.Batches {
+			if err := forgetBatch(tx, info.Batch); err != nil {
+				return err
+			}
+		}
+
+		return refreshLastValues(tx, sensorNames)
+	})
+	if err != nil {
+		return nil, err
+	}
+	recomputeAggregates(intervals)
+
+	result.Undone = true
+	return result, nil
+}
+
+// onlyFromRun reports whether every reading of a batch was written by the run
+func onlyFromRun(db *gorm.DB, tables []readingTable, batchID, runID uint) (bool, error) {
+	for _, table := range tables {
+		var others int64
+		if err := db.Table(table.name).Where("import_file_id = ? AND (source_run_id IS NULL OR source_run_id <> ?)", batchID, runID).
+			Count(&others).Error; err != nil {
+			return false, fmt.Errorf("failed to count readings in %s: %w", table.name, err)
+		}
+		if others > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
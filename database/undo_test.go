@@ -0,0 +1,96 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+// The file is matched by its path or its base name, in every batch
+func TestUndoFile(t *testing.T) {
+	openTestDB(t)
+	first := importBatch(t, "/data/site_a/readings.csv", "aaaa")
+	second := importBatch(t, "/data/site_a/readings.csv", "bbbb")
+	other := importBatch(t, "/data/site_b/old_readings.csv", "cccc")
+	insertReadings(t,
+		fromBatch(reading("temp_01", 0, 1), first.ID),
+		fromBatch(reading("temp_01", 1, 2), second.ID),
+		fromBatch(reading("temp_01", 2, 3), other.ID),
+	)
+
+	if _, err := UndoFile("eadings.csv", true); err == nil {
+		t.Error("a partial base name matched, want no batches found")
+	}
+
+	result, err := UndoFile("readings.csv", true)
+	if err != nil {
+		t.Fatalf("UndoFile dry run: %v", err)
+	}
+	if result.Undone || result.Rows != 2 || len(result.Batches) != 2 {
+		t.Errorf("dry run = %+v, want 2 rows in 2 batches, not undone", *result)
+	}
+	if rows := countRows(t, &models.SensorData{}); rows != 3 {
+		t.Fatalf("dry run left %d readings, want 3", rows)
+	}
+
+	if result, err = UndoFile("site_a/readings.csv", false); err != nil {
+		t.Fatalf("UndoFile: %v", err)
+	}
+	if !result.Undone || result.Rows != 2 {
+		t.Errorf("result = %+v, want 2 rows undone", *result)
+	}
+	values := storedValues(t)
+	if len(values) != 1 || values["temp_01@00:02"] != 3 {
+		t.Errorf("sensor_data = %v, want only the reading of the other file", values)
+	}
+	if batches, err := ListBatches(time.Time{}); err != nil || len(batches) != 1 || batches[0].ID != other.ID {
+		t.Errorf("batches = %+v, %v; want only the other file", batches, err)
+	}
+}
+
+// A batch written partly by another run keeps its manifest entry
+func TestUndoRun(t *testing.T) {
+	openTestDB(t)
+	run := importRun(t)
+	later := importRun(t)
+	whole := importBatch(t, "/data/whole.csv", "aaaa")
+	shared := importBatch(t, "/data/shared.csv", "bbbb")
+	insertReadings(t,
+		fromRun(fromBatch(reading("temp_01", 0, 1), whole.ID), run.ID),
+		fromRun(fromBatch(reading("temp_01", 1, 2), shared.ID), run.ID),
+		fromRun(fromBatch(reading("temp_01", 2, 3), shared.ID), later.ID),
+	)
+
+	result, err := UndoRun(run.ID, true)
+	if err != nil {
+		t.Fatalf("UndoRun dry run: %v", err)
+	}
+	if result.Undone || result.Rows != 2 || len(result.Batches) != 1 || result.Batches[0].Batch.ID != whole.ID {
+		t.Errorf("dry run = %+v, want 2 rows emptying only %s, not undone", *result, whole.FilePath)
+	}
+	if rows := countRows(t, &models.SensorData{}); rows != 3 {
+		t.Fatalf("dry run left %d readings, want 3", rows)
+	}
+
+	if result, err = UndoRun(run.ID, false); err != nil {
+		t.Fatalf("UndoRun: %v", err)
+	}
+	if !result.Undone || result.Rows != 2 {
+		t.Errorf("result = %+v, want 2 rows undone", *result)
+	}
+	values := storedValues(t)
+	if len(values) != 1 || values["temp_01@00:02"] != 3 {
+		t.Errorf("sensor_data = %v, want only the reading of the later run", values)
+	}
+	if batches, err := ListBatches(time.Time{}); err != nil || len(batches) != 1 || batches[0].ID != shared.ID {
+		t.Errorf("batches = %+v, %v; want only %s", batches, err, shared.FilePath)
+	}
+	if runs := countRows(t, &models.ImportRun{}); runs != 2 {
+		t.Errorf("%d runs left, want the undone run still listed", runs)
+	}
+
+	if _, err := UndoRun(later.ID+1, false); err == nil {
+		t.Error("undoing an unknown run succeeded, want not found")
+	}
+}
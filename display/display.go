@@ -0,0 +1,116 @@
+// Package display formats timestamps and numbers in human-facing output,
+// such as summaries and reports, for the operator's timezone and locale.
+// Machine-readable output (JSON, CSV exports, reject files) is not affected.
+package display
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sensor_data_import/config"
+)
+
+var (
+	// location converts timestamps before formatting; nil keeps their zone
+	location *time.Location
+	// Separators of the configured locale; no grouping without a locale
+	groupSeparator   string
+	decimalSeparator = "."
+)
+
+// separators holds the digit group and decimal separators by language
+var separators = map[string][2]string{
+	"en": {",", "."}, "ja": {",", "."}, "zh": {",", "."}, "ko": {",", "."}, "th": {",", "."}, "hi": {",", "."},
+	"de": {".", ","}, "nl": {".", ","}, "it": {".", ","}, "es": {".", ","}, "pt": {".", ","},
+	"id": {".", ","}, "da": {".", ","}, "tr": {".", ","}, "el": {".", ","},
+	"fr": {" ", ","}, "ru": {" ", ","}, "pl": {" ", ","}, "cs": {" ", ","},
+	"sv": {" ", ","}, "fi": {" ", ","}, "nb": {" ", ","}, "uk": {" ", ","},
+	"de-ch": {"'", "."},
+}
+
+// Init applies the display settings from config.yaml
+func Init(cfg config.DisplayConfig) error {
+	location = nil
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid display timezone %q: %w", cfg.Timezone, err)
+		}
+		location = loc
+	}
+
+	groupSeparator, decimalSeparator = "", "."
+	if cfg.Locale != "" {
+		tag := strings.ToLower(strings.ReplaceAll(cfg.Locale, "_", "-"))
+		tag, _, _ = strings.Cut(tag, ".") // ja_JP.UTF-8
+		seps, ok := separators[tag]
+		if !ok {
+			language, _, _ := strings.Cut(tag, "-")
+			if seps, ok = separators[language]; !ok {
+				return fmt.Errorf("unsupported display locale %q", cfg.Locale)
+			}
+		}
+		groupSeparator, decimalSeparator = seps[0], seps[1]
+	}
+	return nil
+}
+
+// Time formats a timestamp in the display timezone. A layout without a zone
+// gets the zone abbreviation appended once a display timezone is set, so the
+// time cannot be mistaken for UTC or local time.
+func Time(t time.Time, layout string) string {
+	if location == nil {
+		return t.Format(layout)
+	}
+	t = t.In(location)
+	if !strings.Contains(layout, "MST") && !strings.Contains(layout, "Z07") && !strings.Contains(layout, "-07") {
+		layout += " MST"
+	}
+	return t.Format(layout)
+}
+
+// Number formats an integer with the digit grouping of the display locale
+func Number(n int) string {
+	return group(strconv.Itoa(n))
+}
+
+// Float formats a number with a fixed number of decimals, using the
+// separators of the display locale
+func Float(value float64, decimals int) string {
+	formatted := strconv.FormatFloat(value, 'f', decimals, 64)
+	whole, fraction, hasFraction := strings.Cut(formatted, ".")
+	whole = group(whole)
+	if !hasFraction {
+		return whole
+	}
+	return whole + decimalSeparator + fraction
+}
+
+// group inserts the group separator every three digits
+func group(digits string) string {
+	if groupSeparator == "" {
+		return digits
+	}
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if len(digits) <= 3 {
+		return sign + digits
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if i > 0 {
+			b.WriteString(groupSeparator)
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
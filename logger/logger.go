@@ -6,9 +6,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"sensor_data_import/config"
+	"sensor_data_import/display"
 )
 
 var (
@@ -18,8 +22,13 @@ var (
 	DebugLogger  *log.Logger
 	WarnLogger   *log.Logger
 	logFile      *os.File
-	logLevel     string
+	logFileMu    sync.Mutex   // Guards logFile against a Close while Sync runs
+	logLevel     atomic.Value // string; changed at runtime by the admin API of serve
 	logToConsole bool
+
+	// Status line redrawn below the console output of an interactive terminal
+	statusMu   sync.Mutex
+	statusLine string
 )
 
 // LogLevel constants
@@ -40,7 +49,7 @@ func Init(cfg *config.Config) error {
 
 	// Set global variables from config
 	logToConsole = cfg.Logging.LogToConsole
-	logLevel = cfg.Logging.LogLevel
+	logLevel.Store(cfg.Logging.LogLevel)
 
 	// Create log file path
 	logPath := filepath.Join(cwd, cfg.Logging.LogFile)
@@ -56,10 +65,10 @@ func Init(cfg *config.Config) error {
 
 	if logToConsole {
 		// Write to both console and file
-		infoWriter = io.MultiWriter(os.Stdout, logFile)
-		errorWriter = io.MultiWriter(os.Stderr, logFile)
-		debugWriter = io.MultiWriter(os.Stdout, logFile)
-		warnWriter = io.MultiWriter(os.Stdout, logFile)
+		infoWriter = io.MultiWriter(consoleWriter{os.Stdout}, logFile)
+		errorWriter = io.MultiWriter(consoleWriter{os.Stderr}, logFile)
+		debugWriter = io.MultiWriter(consoleWriter{os.Stdout}, logFile)
+		warnWriter = io.MultiWriter(consoleWriter{os.Stdout}, logFile)
 	} else {
 		// Write only to file
 		infoWriter = logFile
@@ -75,25 +84,113 @@ func Init(cfg *config.Config) error {
 	WarnLogger = log.New(warnWriter, "", 0)
 
 	// Log session start
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	timestamp := display.Time(time.Now(), "2006-01-02 15:04:05")
 	InfoLogger.Printf("=== Session started at %s ===\n", timestamp)
 	InfoLogger.Printf("Log file: %s\n", logPath)
-	InfoLogger.Printf("Log level: %s\n", logLevel)
+	InfoLogger.Printf("Log level: %s\n", Level())
 	InfoLogger.Printf("Log to console: %t\n", logToConsole)
 	LogDivider()
 
 	return nil
 }
 
-// Close closes the log file
+// consoleWriter writes log output to the console, keeping the status line
+// below it
+type consoleWriter struct {
+	out io.Writer
+}
+
+func (w consoleWriter) Write(p []byte) (int, error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if statusLine == "" {
+		return w.out.Write(p)
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K")
+	n, err := w.out.Write(p)
+	fmt.Fprint(os.Stderr, statusLine)
+	return n, err
+}
+
+// Console returns a writer to standard output that keeps the status line below
+// what it writes, for output that does not go through this package
+func Console() io.Writer {
+	return consoleWriter{os.Stdout}
+}
+
+// IsTerminal reports whether the console is an interactive terminal that can
+// show a status line
+func IsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetStatus shows a line below the console log output, replacing the previous
+// one; an empty line removes it. The status line is never written to the log file.
+func SetStatus(line string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if line == "" && statusLine == "" {
+		return
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K"+line)
+	statusLine = line
+}
+
+// Close closes the log file, flushing it to disk. Closing it again does
+// nothing, so exit paths can close it without knowing whether it is open.
 func Close() error {
-	if logFile != nil {
+	SetStatus("")
+	logFileMu.Lock()
+	file := logFile
+	logFile = nil
+	logFileMu.Unlock()
+	if file != nil {
 		// Log session end
-		timestamp := time.Now().Format("2006-01-02 15:04:05")
+		timestamp := display.Time(time.Now(), "2006-01-02 15:04:05")
 		LogDivider()
 		InfoLogger.Printf("=== Session ended at %s ===\n\n", timestamp)
-		return logFile.Close()
+		file.Sync()
+		return file.Close()
+	}
+	return nil
+}
+
+// CapturePanic logs a panic of the calling goroutine with its stack trace
+// and closes the log before the process exits. Defer it directly:
+//
+//	defer logger.CapturePanic()
+func CapturePanic() {
+	if r := recover(); r != nil {
+		Errorf("Panic: %v\n%s", r, debug.Stack())
+		Close()
+		os.Exit(2)
+	}
+}
+
+// Level returns the current log level
+func Level() string {
+	level, _ := logLevel.Load().(string)
+	return level
+}
+
+// CheckLevel returns an error unless level is a log level
+func CheckLevel(level string) error {
+	switch level {
+	case DEBUG, INFO, WARN, ERROR:
+		return nil
+	}
+	return fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", level)
+}
+
+// SetLevel changes the log level of the running process
+func SetLevel(level string) error {
+	if err := CheckLevel(level); err != nil {
+		return err
 	}
+	logLevel.Store(level)
 	return nil
 }
 
@@ -106,7 +203,7 @@ func shouldLog(messageLevel string) bool {
 		ERROR: 3,
 	}
 
-	currentLevel, exists := levels[logLevel]
+	currentLevel, exists := levels[Level()]
 	if !exists {
 		currentLevel = levels[INFO] // Default to INFO if invalid level
 	}
@@ -1,18 +1,34 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"sensor_data_import/config"
+	"sensor_data_import/control"
 	"sensor_data_import/database"
+	"sensor_data_import/display"
 	"sensor_data_import/logger"
 	"sensor_data_import/models"
 	"sensor_data_import/scanner"
+	"sensor_data_import/sensorquery"
+	"sensor_data_import/server"
 )
 
 func main() {
@@ -21,6 +37,18 @@ func main() {
 		return
 	}
 
+	// Global options may appear anywhere on the command line
+	args, err := extractGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(args) == 0 {
+		showHelp()
+		return
+	}
+	os.Args = append(os.Args[:1], args...)
+
 	command := os.Args[1]
 
 	// Initialize logging only for commands that need it
@@ -37,12 +65,16 @@ func main() {
 		}()
 		logger.LogCommand(os.Args[0], os.Args)
 	}
+	// Log a panic with its stack trace and close the log before exiting
+	defer logger.CapturePanic()
 
 	switch command {
 	case "connect":
 		connectCommand()
+	case "init":
+		initCommand()
 	case "migrate":
-		migrateCommand()
+		migrateCommand(os.Args[2:])
 	case "migrate:create":
 		if len(os.Args) < 3 {
 			fmt.Println("Error: migration name required")
@@ -53,14 +85,61 @@ func main() {
 	case "migrate:status":
 		migrationStatusCommand()
 	case "db:info":
-		dbInfoCommand()
+		dbInfoCommand(os.Args[2:])
+	case "db:query":
+		dbQueryCommand(os.Args[2:])
 	case "scan":
-		if len(os.Args) < 3 {
-			fmt.Println("Error: directory path required")
-			fmt.Println("Usage: go run main.go scan <directory_path>")
-			return
-		}
-		scanCommand(os.Args[2])
+		scanCommand(os.Args[2:])
+	case "watch":
+		watchCommand(os.Args[2:])
+	case "import":
+		importCommand(os.Args[2:])
+	case "tail":
+		tailCommand(os.Args[2:])
+	case "import:undo":
+		importUndoCommand(os.Args[2:])
+	case "runs:list":
+		runsListCommand(os.Args[2:])
+	case "batches:list":
+		batchesListCommand(os.Args[2:])
+	case "batches:show":
+		batchesShowCommand(os.Args[2:])
+	case "batches:revert":
+		batchesRevertCommand(os.Args[2:])
+	case "annotations:add":
+		annotationsAddCommand(os.Args[2:])
+	case "annotations:list":
+		annotationsListCommand(os.Args[2:])
+	case "annotations:delete":
+		annotationsDeleteCommand(os.Args[2:])
+	case "readings:exclude":
+		readingsExcludeCommand(os.Args[2:])
+	case "readings:exclusions":
+		readingsExclusionsCommand(os.Args[2:])
+	case "readings:restore":
+		readingsRestoreCommand(os.Args[2:])
+	case "compact":
+		compactCommand(os.Args[2:])
+	case "aggregates:rollup":
+		aggregatesRollupCommand(os.Args[2:])
+	case "rejects:retry":
+		rejectsRetryCommand(os.Args[2:])
+	case "journal:verify":
+		journalVerifyCommand(os.Args[2:])
+	case "serve":
+		serveCommand(os.Args[2:])
+	case "status":
+		statusCommand(os.Args[2:])
+	case "control":
+		controlCommand(os.Args[2:])
+	case "benchmark:live":
+		benchmarkLiveCommand(os.Args[2:])
+	case "ingest:mqtt":
+		ingestMQTTCommand(os.Args[2:])
+	case "ingest:kafka":
+		ingestKafkaCommand(os.Args[2:])
+	case "demo":
+		demoCommand(os.Args[2:])
 	case "test:insert":
 		testInsertCommand()
 	case "help":
@@ -74,12 +153,31 @@ func main() {
 // needsLogging determines which commands need logging
 func needsLogging(command string) bool {
 	loggingCommands := map[string]bool{
-		"migrate":        true,
-		"migrate:create": true,
-		"migrate:status": true,
-		"scan":           true,
-		"connect":        true,
-		"test:insert":    true,
+		"init":               true,
+		"migrate":            true,
+		"migrate:create":     true,
+		"migrate:status":     true,
+		"scan":               true,
+		"watch":              true,
+		"import":             true,
+		"tail":               true,
+		"compact":            true,
+		"aggregates:rollup":  true,
+		"serve":              true,
+		"benchmark:live":     true,
+		"ingest:mqtt":        true,
+		"ingest:kafka":       true,
+		"batches:revert":     true,
+		"import:undo":        true,
+		"annotations:add":    true,
+		"annotations:delete": true,
+		"readings:exclude":   true,
+		"readings:restore":   true,
+		"rejects:retry":      true,
+		"journal:verify":     true,
+		"connect":            true,
+		"demo":               true,
+		"test:insert":        true,
 	}
 	return loggingCommands[command]
 }
@@ -91,14 +189,133 @@ func showHelp() {
 	fmt.Println("")
 	fmt.Println("Commands:")
 	fmt.Println("  connect              Test database connection")
-	fmt.Println("  migrate              Run pending migrations")
+	fmt.Println("  init                 Create the schema on a fresh database, or apply pending migrations")
+	fmt.Println("  migrate [--dry-run]  Run pending migrations (--dry-run prints their SQL instead)")
 	fmt.Println("  migrate:create <name> Create a new migration file")
 	fmt.Println("  migrate:status       Show migration status")
-	fmt.Println("  db:info              Show database information")
-	fmt.Println("  scan <directory>     Scan directory for CSV files and import sensor data (non-recursive)")
+	fmt.Println("  db:info [--include-excluded]")
+	fmt.Println("                       Show database information (excluded readings are not counted unless included)")
+	fmt.Println("  db:query [options] \"<sql>\"")
+	fmt.Println("                       Run a read-only query and print the results")
+	fmt.Println("                       --format <fmt>        Output format: table, csv or json")
+	fmt.Println("                       --unsafe              Allow statements that modify data")
+	fmt.Println("                       --dry-run             With --unsafe, show the rows affected and roll back")
+	fmt.Println("  scan [options] <directory>")
+	fmt.Println("                       Scan directory for CSV files and import sensor data")
+	fmt.Println("  scan [options] <url>... | --url-list <file>")
+	fmt.Println("                       Download http(s) files and import them (retries and headers in scanner.http)")
+	fmt.Println("  scan [options] s3://<bucket>/<prefix>...")
+	fmt.Println("                       Import the data files under an S3 key prefix (credentials in scanner.s3)")
+	fmt.Println("  scan [options] sftp://<user>@<host>/<path>...")
+	fmt.Println("                       Import a file or directory from an SFTP server (credentials in scanner.sftp)")
+	fmt.Println("                       --profile <name>      Use a scan profile from config.yaml")
+	fmt.Println("                       --recursive           Also scan nested subdirectories")
+	fmt.Println("                       --wide                Parse wide-format files (one column per sensor)")
+	fmt.Println("                       --accept-from <time>  Drop rows before this time (alias --from)")
+	fmt.Println("                       --accept-to <time>    Drop rows at or after this time (alias --to)")
+	fmt.Println("                       --raw                 Write to the append-only raw ingest table")
+	fmt.Println("                       --force               Re-import files already in the import manifest")
+	fmt.Println("                       --include <patterns>  Only import these sensors (comma-separated globs)")
+	fmt.Println("                       --exclude <patterns>  Do not import these sensors")
+	fmt.Println("                       --pattern <globs>     Only import files matching these globs (e.g. temp_*.csv)")
+	fmt.Println("                       --exclude-files <globs>  Do not import files matching these globs")
+	fmt.Println("                       --workers <n>         Files imported in parallel")
+	fmt.Println("                       --batch-size <n>      Readings per insert statement")
+	fmt.Println("                       --max-rows-in-memory <n>  Read and insert large CSV files in chunks of n rows")
+	fmt.Println("                       --insert-workers <n>  Workers inserting the batches of each file")
+	fmt.Println("                       --load-method <m>     How batches are written: insert, copy (PostgreSQL) or staging")
+	fmt.Println("                       --max-open-conns <n>  Database connections open at once for this run")
+	fmt.Println("                       --max-idle-conns <n>  Idle database connections kept for this run")
+	fmt.Println("  watch [options] <directory>")
+	fmt.Println("                       Import new or modified files as they appear (accepts the scan options)")
+	fmt.Println("                       --debounce <duration> Wait until a file is unchanged this long (default 2s)")
+	fmt.Println("                       --ramp-up <duration>  Delay before starting each additional worker (default 2s)")
+	fmt.Println("                       --retry-attempts <n>  Tries to import a failing file before giving up (default 5)")
+	fmt.Println("                       --control-socket <path>  Answer status on this socket (overrides control.socket)")
+	fmt.Println("  import [options] <file>")
+	fmt.Println("                       Import one file, or standard input with \"-\" (accepts the scan options)")
+	fmt.Println("                       --name <name>         File name for standard input, e.g. data.jsonl (default stdin.csv)")
+	fmt.Println("  tail [options] <file|directory>")
+	fmt.Println("                       Import lines as they are appended to growing files (accepts the scan options)")
+	fmt.Println("                       --interval <duration> How often to check for appended lines (default 1s)")
+	fmt.Println("  import:undo [options] <run_id|file>")
+	fmt.Println("                       Remove all readings written by one import run, or imported from one file")
+	fmt.Println("                       --dry-run             Only show how many readings would be removed")
+	fmt.Println("                       --yes                 Skip the confirmation prompt")
+	fmt.Println("  runs:list [options]")
+	fmt.Println("                       List import runs (scan, import, watch, ...), most recent first")
+	fmt.Println("                       --since <time>        Only runs started at or after this time")
+	fmt.Println("                       --format <fmt>        Output format: table or json")
+	fmt.Println("  batches:list [options]")
+	fmt.Println("                       List import batches, most recent first")
+	fmt.Println("                       --since <time>        Only batches imported at or after this time")
+	fmt.Println("                       --format <fmt>        Output format: table or json")
+	fmt.Println("  batches:show [options] <batch_id>")
+	fmt.Println("                       Show the details of one import batch (--format table or json)")
+	fmt.Println("  batches:revert [options] <batch_id>")
+	fmt.Println("                       Remove all readings written by one import batch")
+	fmt.Println("                       --dry-run             Only show how many readings would be removed")
+	fmt.Println("                       --yes                 Skip the confirmation prompt")
+	fmt.Println("  annotations:add [options] <text>")
+	fmt.Println("                       Record an event, such as maintenance, alongside the readings")
+	fmt.Println("                       --from <time>         Start of the event (required)")
+	fmt.Println("                       --to <time>           End of the event (default: a point in time)")
+	fmt.Println("                       --sensors <glob>      Sensors the event concerns (default: all)")
+	fmt.Println("                       --author <name>       Author (default: the current user)")
+	fmt.Println("  annotations:list [options]")
+	fmt.Println("                       List annotations (--from, --to, --sensors, --format table or json)")
+	fmt.Println("  annotations:delete [--dry-run] <annotation_id>")
+	fmt.Println("                       Remove an annotation")
+	fmt.Println("  readings:exclude [options] <reason>")
+	fmt.Println("                       Mark readings as bad data without deleting them; exports skip them")
+	fmt.Println("                       --from <time>         Start of the range, or the timestamp of one reading (required)")
+	fmt.Println("                       --to <time>           End of the range, inclusive")
+	fmt.Println("                       --sensors <glob>      Sensors whose readings are excluded, * for all (required)")
+	fmt.Println("  readings:exclusions [--all] [--format <fmt>]")
+	fmt.Println("                       List active exclusions, and revoked ones with --all")
+	fmt.Println("  readings:restore [--dry-run] <exclusion_id>")
+	fmt.Println("                       Revoke an exclusion; it is kept for audit")
+	fmt.Println("  compact [--dry-run]  Deduplicate the raw ingest table into sensor_data")
+	fmt.Println("  aggregates:rollup    Merge the aggregated intervals left dirty by interrupted imports or reverts")
+	fmt.Println("  rejects:retry [options]")
+	fmt.Println("                       Replay readings kept in sensor_data_rejects after failing to insert")
+	fmt.Println("                       --source <glob>       Only readings from matching source files")
+	fmt.Println("                       --dry-run             Only count the readings that would be retried")
+	fmt.Println("  journal:verify [options]")
+	fmt.Println("                       Check the import journal's checksums and compare it with the database")
+	fmt.Println("                       --journal <file>      Journal to check (default: scanner.journal_file)")
+	fmt.Println("                       --offline             Only check the checksums, without the database")
+	fmt.Println("                       --replay              Re-import journaled files missing from the database")
+	fmt.Println("  serve [options]      Serve the HTTP and gRPC API for pushing and exporting readings")
+	fmt.Println("                       --listen <addr>       Address to listen on (overrides server.listen)")
+	fmt.Println("  status [options]     Show the progress of a running watch or serve: files, rows/sec and queue depth")
+	fmt.Println("                       --control-socket <path>  Socket of the process (overrides control.socket)")
+	fmt.Println("                       --format <fmt>        Output format: table or json")
+	fmt.Println("  control [options] pause|resume")
+	fmt.Println("                       Pause a running watch or serve: files in progress finish, new files and pushes wait")
+	fmt.Println("                       --control-socket <path>  Socket of the process (overrides control.socket)")
+	fmt.Println("  benchmark:live --dir <sample> [options]")
+	fmt.Println("                       Import sample files and report end-to-end throughput")
+	fmt.Println("                       --dry-run-db          Roll back all database changes afterwards")
+	fmt.Println("  ingest:mqtt [options]")
+	fmt.Println("                       Subscribe to MQTT topics and insert the readings of the messages")
+	fmt.Println("                       --broker <url>        Broker URL (overrides ingest.mqtt.broker)")
+	fmt.Println("                       --topics <filters>    Comma-separated topic filters (overrides ingest.mqtt.topics)")
+	fmt.Println("  ingest:kafka [options]")
+	fmt.Println("                       Consume Kafka topics in a consumer group and insert the readings")
+	fmt.Println("                       --brokers <list>      Bootstrap brokers host:port (overrides ingest.kafka.brokers)")
+	fmt.Println("                       --topics <list>       Comma-separated topics (overrides ingest.kafka.topics)")
+	fmt.Println("                       --group <id>          Consumer group (overrides ingest.kafka.group_id)")
+	fmt.Println("  demo [--days <n>]    Import generated sample data into a throwaway in-memory database")
 	fmt.Println("  test:insert          Insert sample sensor data")
 	fmt.Println("  help                 Show this help message")
 	fmt.Println("")
+	fmt.Println("Global options:")
+	fmt.Println("  --dataset <name>     Use the tables of a logical dataset (overrides dataset in config.yaml)")
+	fmt.Println("  --display-timezone <tz>")
+	fmt.Println("                       Show summary and report timestamps in this IANA timezone (overrides display.timezone)")
+	fmt.Println("  --locale <locale>    Group digits in summaries and reports for this locale, e.g. ja-JP (overrides display.locale)")
+	fmt.Println("")
 	fmt.Println("Configuration:")
 	fmt.Println("  Edit config.yaml to configure database settings")
 	fmt.Println("")
@@ -107,25 +324,187 @@ func showHelp() {
 	fmt.Println("  Timestamp format: ISO8601 (e.g., 2025-09-05T12:30:45Z)")
 }
 
+// parseFlags parses command flags, allowing them before or after positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// hiddenFlags are accepted on the command line but left out of usage output
+var hiddenFlags = map[string]bool{
+	"fault-injection": true,
+}
+
+// printFlagDefaults prints flag usage, skipping hidden flags
+func printFlagDefaults(flags *flag.FlagSet) {
+	visible := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+	visible.SetOutput(flags.Output())
+	flags.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// datasetOverride is the dataset selected with --dataset, if any
+var datasetOverride string
+
+// displayOverride holds the display settings selected with
+// --display-timezone and --locale
+var displayOverride config.DisplayConfig
+
+// poolOverride holds the connection pool limits selected with
+// --max-open-conns and --max-idle-conns of the import commands
+var poolOverride config.PoolConfig
+
+// extractGlobalFlags removes options shared by all commands from the arguments
+func extractGlobalFlags(args []string) ([]string, error) {
+	var remaining []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--dataset" || arg == "-dataset":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--dataset requires a name")
+			}
+			datasetOverride = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--dataset=") || strings.HasPrefix(arg, "-dataset="):
+			datasetOverride = arg[strings.Index(arg, "=")+1:]
+		case arg == "--display-timezone" || arg == "-display-timezone" || arg == "--locale" || arg == "-locale":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s requires a value", arg)
+			}
+			setDisplayOverride(arg, args[i+1])
+			i++
+		case strings.HasPrefix(arg, "--display-timezone=") || strings.HasPrefix(arg, "-display-timezone=") ||
+			strings.HasPrefix(arg, "--locale=") || strings.HasPrefix(arg, "-locale="):
+			name, value, _ := strings.Cut(arg, "=")
+			setDisplayOverride(name, value)
+		default:
+			remaining = append(remaining, arg)
+		}
+	}
+	return remaining, nil
+}
+
+// setDisplayOverride records a --display-timezone or --locale option
+func setDisplayOverride(name, value string) {
+	if strings.TrimLeft(name, "-") == "locale" {
+		displayOverride.Locale = value
+	} else {
+		displayOverride.Timezone = value
+	}
+}
+
 func loadConfig() *config.Config {
 	cfg, err := config.Load("")
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if datasetOverride != "" {
+		cfg.Dataset = datasetOverride
+		if err := cfg.Validate(); err != nil {
+			log.Fatalf("Invalid --dataset: %v", err)
+		}
+	}
+	if displayOverride.Timezone != "" {
+		cfg.Display.Timezone = displayOverride.Timezone
+	}
+	if displayOverride.Locale != "" {
+		cfg.Display.Locale = displayOverride.Locale
+	}
+	if err := display.Init(cfg.Display); err != nil {
+		log.Fatalf("Invalid display settings: %v", err)
+	}
 	return cfg
 }
 
 func connectDatabase() (*config.Config, error) {
 	cfg := loadConfig()
+	if poolOverride.MaxOpenConns > 0 {
+		cfg.Database.ConnectionPool.MaxOpenConns = poolOverride.MaxOpenConns
+	}
+	if poolOverride.MaxIdleConns > 0 {
+		cfg.Database.ConnectionPool.MaxIdleConns = poolOverride.MaxIdleConns
+	}
 
 	_, err := database.Connect(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	if cfg.Dataset != "" {
+		logger.Printf("Using dataset: %s (tables prefixed %s)\n", cfg.Dataset, cfg.TablePrefix())
+	}
+
+	// Output commands skip the check so their results stay machine-readable
+	if needsLogging(os.Args[1]) {
+		checkCapabilities(cfg)
+	}
+
+	if cfg.Migration.AutoMigrate && writesData(os.Args[1]) {
+		if err := bootstrapSchema(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if writesData(os.Args[1]) {
+		if err := database.CheckIDStrategy(); err != nil {
+			return nil, err
+		}
+	}
 
 	return cfg, nil
 }
 
+// writesData reports whether a command reads or writes the importer's tables,
+// so migration.auto_migrate creates or updates the schema before it runs
+func writesData(command string) bool {
+	switch command {
+	case "scan", "watch", "import", "tail", "compact", "aggregates:rollup", "rejects:retry", "journal:verify", "annotations:add", "readings:exclude", "serve", "benchmark:live", "ingest:mqtt", "ingest:kafka", "test:insert":
+		return true
+	}
+	return false
+}
+
+// bootstrapSchema creates the baseline schema on a fresh database and applies
+// pending migrations to an existing one
+func bootstrapSchema(cfg *config.Config) error {
+	runner := database.NewMigrationRunner(database.GetDB(), cfg)
+	count, err := runner.Bootstrap(cfg.Database.Driver)
+	if err != nil {
+		return fmt.Errorf("schema bootstrap failed: %w", err)
+	}
+	if count > 0 {
+		logger.Printf("✓ Schema ready: %d migration(s) applied\n", count)
+	}
+	return nil
+}
+
+// checkCapabilities warns about configured features the database server does
+// not support, before they fail with an SQL error mid-import or mid-migration
+func checkCapabilities(cfg *config.Config) {
+	caps, err := database.DetectCapabilities(cfg)
+	if err != nil {
+		logger.Warnf("Could not detect database capabilities: %v\n", err)
+		return
+	}
+	logger.Debugf("Database server: %s\n", caps.Summary())
+	for _, warning := range caps.Warnings(cfg) {
+		logger.Warnf("%s\n", warning)
+	}
+}
+
 func connectCommand() {
 	logger.Println("Testing database connection...")
 
@@ -135,6 +514,9 @@ func connectCommand() {
 	}
 
 	logger.Printf("✓ Successfully connected to %s database\n", cfg.Database.Driver)
+	if caps, err := database.DetectCapabilities(cfg); err == nil {
+		logger.Printf("Server: %s\n", caps.Summary())
+	}
 
 	// Show connection info
 	info := database.GetDatabaseInfo(cfg)
@@ -142,7 +524,34 @@ func connectCommand() {
 	logger.Printf("Connection info: %s\n", infoJSON)
 }
 
-func migrateCommand() {
+func initCommand() {
+	logger.Println("Initializing database schema...")
+
+	cfg, err := connectDatabase()
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	if err := bootstrapSchema(cfg); err != nil {
+		logger.Fatalf("Initialization failed: %v", err)
+	}
+	if err := database.CheckIDStrategy(); err != nil {
+		logger.Fatalf("Initialization failed: %v", err)
+	}
+
+	logger.Printf("✓ Database ready, tables: %s\n", strings.Join(database.BaselineTables(), ", "))
+}
+
+func migrateCommand(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only print the SQL of the pending migrations")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go migrate [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
 	logger.Println("Running database migrations...")
 
 	cfg, err := connectDatabase()
@@ -152,9 +561,29 @@ func migrateCommand() {
 
 	runner := database.NewMigrationRunner(database.GetDB(), cfg)
 
+	// Schema changes cannot be rolled back on every driver, so show the SQL
+	if *dryRun {
+		pending, err := runner.GetPendingMigrations()
+		if err != nil {
+			logger.Fatalf("Failed to get pending migrations: %v", err)
+		}
+		for _, migration := range pending {
+			sql, err := runner.MigrationSQL(migration)
+			if err != nil {
+				logger.Fatalf("Migration failed: %v", err)
+			}
+			logger.Printf("-- %s - %s\n%s\n", migration.Version, migration.Name, strings.TrimSpace(sql))
+		}
+		logger.Printf("Dry run, %d pending migration(s) not applied\n", len(pending))
+		return
+	}
+
 	if err := runner.RunMigrations(); err != nil {
 		logger.Fatalf("Migration failed: %v", err)
 	}
+	if err := database.CheckIDStrategy(); err != nil {
+		logger.Fatalf("Migration failed: %v", err)
+	}
 }
 
 func createMigrationCommand(name string) {
@@ -203,7 +632,17 @@ func migrationStatusCommand() {
 	}
 }
 
-func dbInfoCommand() {
+func dbInfoCommand(args []string) {
+	flags := flag.NewFlagSet("db:info", flag.ContinueOnError)
+	includeExcluded := flags.Bool("include-excluded", false, "Count readings covered by an active exclusion")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go db:info [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
 	fmt.Println("Database Information:")
 	fmt.Println(strings.Repeat("=", 50))
 
@@ -234,32 +673,53 @@ func dbInfoCommand() {
 
 	// Display connection pool information if available
 	if info["connected"] == true {
+		if caps, err := database.DetectCapabilities(cfg); err == nil {
+			fmt.Println("\nServer:")
+			fmt.Printf("  Version:         %s\n", caps.Version)
+			fmt.Printf("  Upsert:          %s\n", supportedText(caps.Upsert))
+			fmt.Printf("  RETURNING:       %s\n", supportedText(caps.Returning))
+			fmt.Printf("  Generated Cols:  %s\n", supportedText(caps.GeneratedColumns))
+			fmt.Printf("  Partitioning:    %s\n", supportedText(caps.Partitioning))
+			fmt.Printf("  Max Bind Vars:   %d\n", caps.MaxVariables)
+			if len(caps.Extensions) > 0 {
+				fmt.Printf("  Extensions:      %s\n", strings.Join(caps.Extensions, ", "))
+			}
+			if len(caps.CompileOptions) > 0 {
+				fmt.Printf("  Compile Options: %d (PRAGMA compile_options lists them)\n", len(caps.CompileOptions))
+			}
+			for _, warning := range caps.Warnings(cfg) {
+				fmt.Printf("  Warning:         %s\n", warning)
+			}
+		}
+
 		fmt.Println("\nConnection Pool:")
 		fmt.Printf("  Max Connections: %v\n", info["max_open_connections"])
 		fmt.Printf("  Open Connections:%v\n", info["open_connections"])
 		fmt.Printf("  In Use:          %v\n", info["in_use"])
 		fmt.Printf("  Idle:            %v\n", info["idle"])
+		fmt.Printf("  Waits:           %v (%v)\n", info["wait_count"], info["wait_duration"])
 
 		// Get table information
-		db := database.GetDB()
-		var count int64
-		db.Model(&models.SensorData{}).Count(&count)
+		stats, err := database.GetDataStats(*includeExcluded)
+		if err != nil {
+			log.Fatalf("Failed to read data information: %v", err)
+		}
 		fmt.Println("\nData Information:")
-		fmt.Printf("  Total Records:   %d\n", count)
-
-		// Get sensor count
-		var sensorCount int64
-		db.Model(&models.SensorData{}).Distinct("sensor_name").Count(&sensorCount)
-		fmt.Printf("  Unique Sensors:  %d\n", sensorCount)
+		fmt.Printf("  Total Records:   %s\n", display.Number(int(stats.Records)))
+		fmt.Printf("  Unique Sensors:  %s\n", display.Number(int(stats.Sensors)))
 
 		// Get date range if data exists
-		if count > 0 {
-			var earliest, latest time.Time
-			db.Model(&models.SensorData{}).Select("MIN(timestamp)").Scan(&earliest)
-			db.Model(&models.SensorData{}).Select("MAX(timestamp)").Scan(&latest)
+		if !stats.Earliest.IsZero() {
 			fmt.Printf("  Date Range:      %s to %s\n",
-				earliest.Format("2006-01-02 15:04:05"),
-				latest.Format("2006-01-02 15:04:05"))
+				display.Time(stats.Earliest, "2006-01-02 15:04:05"),
+				display.Time(stats.Latest, "2006-01-02 15:04:05"))
+		}
+		if stats.Excluded > 0 {
+			if *includeExcluded {
+				fmt.Printf("  Excluded:        %s (included above)\n", display.Number(int(stats.Excluded)))
+			} else {
+				fmt.Printf("  Excluded:        %s (left out above, --include-excluded counts them)\n", display.Number(int(stats.Excluded)))
+			}
 		}
 	} else {
 		fmt.Println("\nConnection failed - unable to retrieve detailed information")
@@ -275,24 +735,1777 @@ func getConnectionStatusText(connected interface{}) string {
 	return "✗ Disconnected"
 }
 
-func scanCommand(directoryPath string) {
-	logger.Printf("Scanning directory: %s\n", directoryPath)
+func supportedText(supported bool) string {
+	if supported {
+		return "✓ Supported"
+	}
+	return "✗ Not supported"
+}
+
+func dbQueryCommand(args []string) {
+	flags := flag.NewFlagSet("db:query", flag.ContinueOnError)
+	format := flags.String("format", "table", "Output format: table, csv or json")
+	unsafe := flags.Bool("unsafe", false, "Allow statements that modify data")
+	dryRun := flags.Bool("dry-run", false, "Run a modifying statement in a transaction that is rolled back")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go db:query [options] \"<sql>\"")
+		printFlagDefaults(flags)
+	}
 
-	_, err := connectDatabase()
+	positional, err := parseFlags(flags, args)
 	if err != nil {
-		logger.Fatalf("Failed to connect to database: %v", err)
+		return
+	}
+	if len(positional) != 1 {
+		fmt.Println("Error: exactly one SQL statement required (quote it)")
+		flags.Usage()
+		return
 	}
+	query := positional[0]
 
-	db := database.GetDB()
-	csvScanner := scanner.NewCSVScanner(db)
+	if *format != "table" && *format != "csv" && *format != "json" {
+		fmt.Printf("Error: unsupported format %q (expected table, csv or json)\n", *format)
+		return
+	}
+
+	readOnly := database.IsReadOnlyQuery(query)
+	if !readOnly && !*unsafe {
+		fmt.Println("Error: only single SELECT, WITH, SHOW, EXPLAIN or DESCRIBE statements are allowed; pass --unsafe to run other statements")
+		os.Exit(1)
+	}
+
+	cfg, err := connectDatabase()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if !readOnly && *dryRun {
+		rehearse(func() error {
+			_, err := database.ExecStatement(query)
+			return err
+		})
+		return
+	}
+	if !readOnly {
+		affected, err := database.ExecStatement(query)
+		if err != nil {
+			log.Fatalf("Statement failed: %v", err)
+		}
+		fmt.Printf("%d row(s) affected\n", affected)
+		return
+	}
 
-	if err := csvScanner.ScanDirectory(directoryPath); err != nil {
+	result, err := database.RunReadOnlyQuery(cfg.Database.Driver, query)
+	if err != nil {
+		log.Fatalf("Query failed: %v", err)
+	}
+
+	switch *format {
+	case "csv":
+		err = result.WriteCSV(os.Stdout)
+	case "json":
+		err = result.WriteJSON(os.Stdout)
+	default:
+		err = result.WriteTable(os.Stdout)
+		fmt.Printf("(%d row(s))\n", len(result.Rows))
+	}
+	if err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+}
+
+func scanCommand(args []string) {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	urlList := flags.String("url-list", "", "File listing http(s), s3:// or sftp:// URLs to download and import, one per line")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go scan [options] <directory_path>")
+		fmt.Println("       go run main.go scan [options] <url>... | s3://<bucket>/<prefix>... | sftp://<user>@<host>/<path>... | --url-list <file>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+
+	// Remote sources are given as URLs or in a URL list file
+	var urls []string
+	if *urlList != "" {
+		if urls, err = scanner.ReadURLList(*urlList); err != nil {
+			fmt.Printf("Error: failed to read URL list: %v\n", err)
+			return
+		}
+	}
+	var directories []string
+	for _, source := range positional {
+		if scanner.IsRemote(source) {
+			urls = append(urls, source)
+		} else {
+			directories = append(directories, source)
+		}
+	}
+	if len(urls) > 0 && len(directories) > 0 {
+		fmt.Println("Error: scan either a directory or URLs, not both")
+		return
+	}
+	if len(directories) == 0 && len(urls) == 0 {
+		fmt.Println("Error: directory path or URL required")
+		flags.Usage()
+		return
+	}
+
+	cfg, csvScanner := options.newScanner()
+	defer startPoolMonitor(cfg, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if len(urls) > 0 {
+		err = csvScanner.ScanURLs(ctx, urls)
+	} else {
+		logger.Printf("Scanning directory: %s\n", directories[0])
+		err = csvScanner.ScanDirectory(ctx, directories[0])
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			logger.Warnf("Scan interrupted; run it again to import the remaining files\n")
+			return
+		}
 		logger.Fatalf("Scan failed: %v", err)
 	}
 
+	if len(urls) > 0 {
+		logger.Println("✓ Remote scan completed successfully")
+		return
+	}
 	logger.Println("✓ Directory scan completed successfully")
 }
 
+func watchCommand(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	debounce := flags.Duration("debounce", scanner.DefaultWatchDebounce, "Wait until a file has not changed for this long before importing it")
+	rampUp := flags.String("ramp-up", "", "Wait this long before starting each additional worker on a burst of files, 0 for all at once (overrides scanner.watch_ramp_up)")
+	retryAttempts := flags.Int("retry-attempts", 0, "Tries to import a failing file before giving up, 1 for no retries (overrides scanner.watch_retry_attempts)")
+	controlSocket := flags.String("control-socket", "", "Answer status commands on this socket (overrides control.socket)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go watch [options] <directory_path>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) < 1 {
+		fmt.Println("Error: directory path required")
+		flags.Usage()
+		return
+	}
+	directoryPath := positional[0]
+
+	cfg, csvScanner := options.newScanner()
+	if *rampUp != "" {
+		interval, err := time.ParseDuration(*rampUp)
+		if err != nil || interval < 0 {
+			logger.Fatalf("Invalid --ramp-up %q: expected a duration like 2s", *rampUp)
+		}
+		csvScanner.SetWatchRampUp(interval)
+	}
+	if *retryAttempts < 0 {
+		logger.Fatalf("Invalid --retry-attempts %d: must not be negative", *retryAttempts)
+	}
+	csvScanner.SetWatchRetryAttempts(*retryAttempts)
+	defer startPoolMonitor(cfg, csvScanner)()
+	defer startControl(cfg, *controlSocket, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := csvScanner.Watch(ctx, directoryPath, *debounce); err != nil {
+		logger.Fatalf("Watch failed: %v", err)
+	}
+}
+
+func tailCommand(args []string) {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	interval := flags.Duration("interval", scanner.DefaultTailInterval, "How often to check the files for appended lines")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go tail [options] <file_or_directory>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) < 1 {
+		fmt.Println("Error: file or directory path required")
+		flags.Usage()
+		return
+	}
+	target := positional[0]
+
+	cfg, csvScanner := options.newScanner()
+	defer startPoolMonitor(cfg, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := csvScanner.Tail(ctx, target, *interval); err != nil {
+		logger.Fatalf("Tail failed: %v", err)
+	}
+}
+
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	name := flags.String("name", scanner.DefaultStdinName, "File name for standard input; its extension selects the parser")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go import [options] <file_path>")
+		fmt.Println("       go run main.go import [options] - < data.csv")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) < 1 {
+		fmt.Println("Error: file path required (use - for standard input)")
+		flags.Usage()
+		return
+	}
+	filePath := positional[0]
+
+	cfg, csvScanner := options.newScanner()
+	defer startPoolMonitor(cfg, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if filePath == "-" {
+		logger.Printf("Importing standard input as %s\n", *name)
+		err = csvScanner.ImportReader(ctx, os.Stdin, *name)
+	} else {
+		logger.Printf("Importing file: %s\n", filePath)
+		err = csvScanner.ImportFile(ctx, filePath)
+	}
+	if err != nil {
+		logger.Fatalf("Import failed: %v", err)
+	}
+
+	logger.Println("✓ Import completed successfully")
+}
+
+func benchmarkLiveCommand(args []string) {
+	flags := flag.NewFlagSet("benchmark:live", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	dir := flags.String("dir", "", "Directory of representative sample files to import")
+	dryRun := flags.Bool("dry-run-db", false, "Import in one transaction that is rolled back, leaving the database unchanged")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go benchmark:live --dir <sample_directory> [--dry-run-db] [options]")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if *dir == "" && len(positional) > 0 {
+		*dir = positional[0]
+	}
+	if *dir == "" {
+		fmt.Println("Error: sample directory required (--dir)")
+		flags.Usage()
+		return
+	}
+
+	cfg, csvScanner := options.newScanner()
+	defer startPoolMonitor(cfg, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	result, err := csvScanner.Benchmark(ctx, *dir, *dryRun)
+	if err != nil {
+		logger.Fatalf("Benchmark failed: %v", err)
+	}
+
+	logger.Println("Benchmark results:")
+	logger.Printf("  Target:      %s\n", cfg.Database.Driver)
+	logger.Printf("  Files:       %d (%d failed)\n", result.Files, result.Failed)
+	logger.Printf("  Readings:    %s (%s parsing errors)\n", display.Number(result.Readings), display.Number(result.Errors))
+	logger.Printf("  Elapsed:     %v\n", result.Duration.Round(time.Millisecond))
+	logger.Printf("  Throughput:  %s readings/s\n", display.Float(result.ReadingsPerSecond(), 0))
+	logger.Printf("  Stages:      %s\n", result.Timings)
+	if result.RolledBack {
+		logger.Println("✓ Benchmark completed; all database changes were rolled back")
+		return
+	}
+	logger.Println("✓ Benchmark completed; the sample readings were written to the database")
+}
+
+func ingestMQTTCommand(args []string) {
+	flags := flag.NewFlagSet("ingest:mqtt", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	broker := flags.String("broker", "", "Broker URL such as tcp://broker:1883 (overrides ingest.mqtt.broker)")
+	topics := flags.String("topics", "", "Comma-separated topic filters (overrides ingest.mqtt.topics)")
+	flushInterval := flags.String("flush-interval", "", "Longest time readings wait before they are inserted (overrides ingest.flush_interval)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go ingest:mqtt [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
+	cfg, csvScanner := options.newScanner()
+	if *broker != "" {
+		cfg.Ingest.MQTT.Broker = *broker
+	}
+	if *topics != "" {
+		cfg.Ingest.MQTT.Topics = splitPatterns(*topics)
+	}
+	if *flushInterval != "" {
+		cfg.Ingest.FlushInterval = *flushInterval
+	}
+	if err := cfg.Ingest.Validate(); err != nil {
+		logger.Fatalf("Invalid ingest option: %v", err)
+	}
+	defer startPoolMonitor(cfg, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	stats, err := csvScanner.IngestMQTT(ctx, cfg.Ingest)
+	if err != nil {
+		logger.Fatalf("MQTT ingest failed: %v", err)
+	}
+	logger.Printf("✓ MQTT ingest stopped: %d messages, %d readings inserted\n", stats.Messages, stats.Readings)
+}
+
+func ingestKafkaCommand(args []string) {
+	flags := flag.NewFlagSet("ingest:kafka", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	brokers := flags.String("brokers", "", "Comma-separated bootstrap brokers host:port (overrides ingest.kafka.brokers)")
+	topics := flags.String("topics", "", "Comma-separated topics (overrides ingest.kafka.topics)")
+	group := flags.String("group", "", "Consumer group whose offsets are committed (overrides ingest.kafka.group_id)")
+	flushInterval := flags.String("flush-interval", "", "Longest time readings wait before they are inserted (overrides ingest.flush_interval)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go ingest:kafka [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
+	cfg, csvScanner := options.newScanner()
+	if *brokers != "" {
+		cfg.Ingest.Kafka.Brokers = splitPatterns(*brokers)
+	}
+	if *topics != "" {
+		cfg.Ingest.Kafka.Topics = splitPatterns(*topics)
+	}
+	if *group != "" {
+		cfg.Ingest.Kafka.GroupID = *group
+	}
+	if *flushInterval != "" {
+		cfg.Ingest.FlushInterval = *flushInterval
+	}
+	if err := cfg.Ingest.Validate(); err != nil {
+		logger.Fatalf("Invalid ingest option: %v", err)
+	}
+	defer startPoolMonitor(cfg, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	stats, err := csvScanner.IngestKafka(ctx, cfg.Ingest)
+	if err != nil {
+		logger.Fatalf("Kafka ingest failed: %v", err)
+	}
+	logger.Printf("✓ Kafka ingest stopped: %d records, %d readings inserted\n", stats.Messages, stats.Readings)
+}
+
+// signalContext returns a context cancelled by Ctrl+C or SIGTERM so imports
+// stop after the batches in progress. A second signal terminates immediately,
+// closing the log first so its tail is not lost.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Warnf("Received %v, stopping after the batches in progress (repeat to abort)\n", sig)
+			cancel()
+		case <-stopped:
+			return
+		}
+		select {
+		case sig := <-signals:
+			logger.Fatalf("Received %v again, aborting\n", sig)
+		case <-stopped:
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(stopped)
+			cancel()
+		})
+	}
+}
+
+// scanOptions holds the flags shared by commands that import files
+type scanOptions struct {
+	acceptFrom     *string
+	acceptTo       *string
+	profile        *string
+	recursive      *bool
+	wide           *bool
+	raw            *bool
+	force          *bool
+	insertPolicy   *string
+	upsertWindow   *string
+	timezone       *string
+	numberFormat   *string
+	include        *string
+	exclude        *string
+	filePatterns   *string
+	excludeFiles   *string
+	batchSize      *int
+	workers        *int
+	maxRows        *int
+	insertWorkers  *int
+	loadMethod     *string
+	maxOpenConns   *int
+	maxIdleConns   *int
+	maxErrors      *string
+	faultInjection *string
+}
+
+// addScanFlags registers the import flags on a command's flag set
+func addScanFlags(flags *flag.FlagSet) *scanOptions {
+	options := &scanOptions{
+		acceptFrom:     flags.String("accept-from", "", "Drop rows before this time (RFC3339, YYYY-MM-DD, now, today, yesterday, -24h or -30d)"),
+		acceptTo:       flags.String("accept-to", "", "Drop rows at or after this time (same formats as --accept-from)"),
+		profile:        flags.String("profile", "", "Scan profile from the scan_profiles section of config.yaml"),
+		recursive:      flags.Bool("recursive", false, "Also scan nested subdirectories"),
+		wide:           flags.Bool("wide", false, "Parse wide-format files with one column per sensor"),
+		raw:            flags.Bool("raw", false, "Write to the append-only raw ingest table instead of sensor_data"),
+		force:          flags.Bool("force", false, "Re-import files even if the import manifest lists them"),
+		insertPolicy:   flags.String("on-duplicate", "", "Handle readings that already exist: error, skip or update"),
+		upsertWindow:   flags.String("upsert-window", "", "Overwrite existing readings newer than this duration (e.g. 24h) and skip older duplicates"),
+		timezone:       flags.String("timezone", "", "IANA timezone of timestamps without an offset (e.g. Europe/Berlin)"),
+		numberFormat:   flags.String("number-format", "", "How CSV values are written: standard, decimal_point (1,234.5) or decimal_comma (1.234,5)"),
+		include:        flags.String("include", "", "Only import these sensors (comma-separated names or glob patterns)"),
+		exclude:        flags.String("exclude", "", "Do not import these sensors (comma-separated names or glob patterns)"),
+		filePatterns:   flags.String("pattern", "", "Only import files matching these comma-separated globs (e.g. temp_*.csv)"),
+		excludeFiles:   flags.String("exclude-files", "", "Do not import files matching these comma-separated globs (e.g. *_backup.csv)"),
+		batchSize:      flags.Int("batch-size", 0, "Readings per insert statement (default 1000)"),
+		workers:        flags.Int("workers", 0, "Files imported in parallel (default: CPU cores, at most 8)"),
+		maxRows:        flags.Int("max-rows-in-memory", 0, "CSV rows a worker reads before inserting them (default: whole file)"),
+		insertWorkers:  flags.Int("insert-workers", 0, "Workers inserting the batches of each file while it is parsed (default 1)"),
+		loadMethod:     flags.String("load-method", "", "How batches are written: insert, copy (COPY FROM STDIN, PostgreSQL only) or staging (merge through a temporary table)"),
+		maxOpenConns:   flags.Int("max-open-conns", 0, "Database connections open at once for this run (overrides connection_pool.max_open_conns)"),
+		maxIdleConns:   flags.Int("max-idle-conns", 0, "Idle database connections kept for this run (overrides connection_pool.max_idle_conns)"),
+		maxErrors:      flags.String("max-errors", "", "Fail a file once it has more parsing errors than this count (e.g. 1000) or share of rows (e.g. 5%)"),
+		faultInjection: flags.String("fault-injection", "", ""),
+	}
+	flags.StringVar(options.acceptFrom, "from", "", "Same as --accept-from")
+	flags.StringVar(options.acceptTo, "to", "", "Same as --accept-to")
+	return options
+}
+
+// newScanner connects to the database and returns a scanner configured from
+// config.yaml and the command line flags, exiting on invalid settings
+func (o *scanOptions) newScanner() (*config.Config, *scanner.CSVScanner) {
+	if *o.maxOpenConns < 0 || *o.maxIdleConns < 0 {
+		logger.Fatalf("Invalid --max-open-conns or --max-idle-conns: must not be negative")
+	}
+	poolOverride = config.PoolConfig{MaxOpenConns: *o.maxOpenConns, MaxIdleConns: *o.maxIdleConns}
+	cfg, err := connectDatabase()
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if *o.profile != "" {
+		cfg.Scanner, err = cfg.ScannerProfile(*o.profile)
+		if err != nil {
+			logger.Fatalf("Failed to load scan profile: %v", err)
+		}
+		logger.Printf("Using scan profile: %s\n", *o.profile)
+	}
+
+	// Command line flags override the configured scanner settings
+	if *o.acceptFrom != "" {
+		cfg.Scanner.AcceptFrom = *o.acceptFrom
+	}
+	if *o.acceptTo != "" {
+		cfg.Scanner.AcceptTo = *o.acceptTo
+	}
+	if *o.raw {
+		cfg.Scanner.IngestMode = "raw"
+	}
+	if *o.recursive {
+		cfg.Scanner.Recursive = true
+	}
+	if *o.wide {
+		cfg.Scanner.Layout = "wide"
+	}
+	if *o.timezone != "" {
+		cfg.Scanner.SourceTimezone = *o.timezone
+	}
+	if *o.numberFormat != "" {
+		cfg.Scanner.NumberFormat = *o.numberFormat
+	}
+	if *o.include != "" {
+		cfg.Scanner.IncludeSensors = splitPatterns(*o.include)
+	}
+	if *o.exclude != "" {
+		cfg.Scanner.ExcludeSensors = splitPatterns(*o.exclude)
+	}
+	if *o.filePatterns != "" {
+		cfg.Scanner.FilePatterns = splitPatterns(*o.filePatterns)
+	}
+	if *o.excludeFiles != "" {
+		cfg.Scanner.ExcludeFiles = splitPatterns(*o.excludeFiles)
+	}
+	if *o.batchSize != 0 {
+		cfg.Scanner.BatchSize = *o.batchSize
+	}
+	if *o.workers != 0 {
+		cfg.Scanner.WorkerCount = *o.workers
+	}
+	if *o.maxRows != 0 {
+		cfg.Scanner.MaxRowsInMemory = *o.maxRows
+	}
+	if *o.insertWorkers != 0 {
+		cfg.Scanner.InsertWorkers = *o.insertWorkers
+	}
+	if *o.loadMethod != "" {
+		cfg.Scanner.LoadMethod = *o.loadMethod
+	}
+	if *o.maxErrors != "" {
+		cfg.Scanner.MaxErrors = *o.maxErrors
+	}
+	if err := cfg.Scanner.Validate(); err != nil {
+		logger.Fatalf("Invalid scanner option: %v", err)
+	}
+	if *o.insertPolicy != "" {
+		cfg.Scanner.InsertPolicy = *o.insertPolicy
+		if err := cfg.Scanner.Validate(); err != nil {
+			logger.Fatalf("Invalid --on-duplicate: %v", err)
+		}
+	}
+	if *o.upsertWindow != "" {
+		cfg.Scanner.UpsertWindow = *o.upsertWindow
+		if err := cfg.Scanner.Validate(); err != nil {
+			logger.Fatalf("Invalid --upsert-window: %v", err)
+		}
+	}
+
+	db := database.GetDB()
+	csvScanner := scanner.NewCSVScanner(db)
+	if err := csvScanner.Configure(cfg.Scanner); err != nil {
+		logger.Fatalf("Invalid scanner configuration: %v", err)
+	}
+	csvScanner.SetForce(*o.force)
+	csvScanner.SetFileTransactions(cfg.Database.Driver == "sqlite" && cfg.Database.SQLite.BulkMode)
+	csvScanner.SetRun(os.Args[1], os.Args[2:])
+	if *o.faultInjection != "" {
+		faults, err := scanner.ParseFaultInjection(*o.faultInjection)
+		if err != nil {
+			logger.Fatalf("Invalid fault injection: %v", err)
+		}
+		csvScanner.SetFaultInjector(faults)
+	}
+
+	return cfg, csvScanner
+}
+
+// splitPatterns splits a comma-separated flag value into its patterns
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// startPoolMonitor watches the connection pool while workers insert and
+// returns a function that stops it
+func startPoolMonitor(cfg *config.Config, csvScanner *scanner.CSVScanner) func() {
+	interval := cfg.Database.ConnectionPool.MonitorInterval
+	if interval < 0 {
+		return func() {}
+	}
+	if interval == 0 {
+		interval = 10
+	}
+	monitor, err := database.StartPoolMonitor(time.Duration(interval)*time.Second, csvScanner.WorkerCount())
+	if err != nil {
+		logger.Warnf("Connection pool monitor unavailable: %v\n", err)
+		return func() {}
+	}
+	return monitor.Stop
+}
+
+// controlAddress returns the control socket of watch and serve: the
+// --control-socket flag, control.socket or the default
+func controlAddress(cfg *config.Config, flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if cfg.Control.Socket != "" {
+		return cfg.Control.Socket
+	}
+	return control.DefaultAddress()
+}
+
+// pauseResult answers the pause and resume control commands
+type pauseResult struct {
+	Status  scanner.Status `json:"status"`
+	Changed bool           `json:"changed"` // False when the process was paused, or running, already
+}
+
+// startControl answers the commands of the status and control subcommands on the control
+// socket and returns a function that closes it. A socket that cannot be
+// opened, such as one held by another process, only disables status.
+func startControl(cfg *config.Config, flagValue string, csvScanner *scanner.CSVScanner) func() {
+	if cfg.Control.Disabled && flagValue == "" {
+		return func() {}
+	}
+	srv, err := control.Listen(controlAddress(cfg, flagValue), func(command string) (interface{}, error) {
+		switch command {
+		case "status":
+			return csvScanner.Status(), nil
+		case "pause":
+			changed := csvScanner.Pause()
+			return pauseResult{Status: csvScanner.Status(), Changed: changed}, nil
+		case "resume":
+			changed := csvScanner.Resume()
+			return pauseResult{Status: csvScanner.Status(), Changed: changed}, nil
+		}
+		return nil, fmt.Errorf("%w: %s", control.ErrUnknownCommand, command)
+	})
+	if err != nil {
+		logger.Warnf("Status is unavailable: %v (set control.socket or --control-socket)\n", err)
+		return func() {}
+	}
+	logger.Printf("Answering status on %s\n", srv.Address())
+	return func() {
+		if err := srv.Close(); err != nil {
+			logger.Warnf("Failed to close the control socket: %v\n", err)
+		}
+	}
+}
+
+func runsListCommand(args []string) {
+	flags := flag.NewFlagSet("runs:list", flag.ContinueOnError)
+	since := flags.String("since", "", "Only list runs started at or after this time (RFC3339, YYYY-MM-DD, today, yesterday or -24h)")
+	format := flags.String("format", "table", "Output format: table or json")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go runs:list [options]")
+		printFlagDefaults(flags)
+	}
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Printf("Error: unsupported format %q (expected table or json)\n", *format)
+		return
+	}
+	var sinceTime time.Time
+	if *since != "" {
+		var err error
+		if sinceTime, err = scanner.ParseTimeBound(*since, time.Now()); err != nil {
+			fmt.Printf("Error: invalid --since: %v\n", err)
+			return
+		}
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	runs, err := database.ListRuns(sinceTime)
+	if err != nil {
+		log.Fatalf("Failed to list runs: %v", err)
+	}
+
+	if *format == "json" {
+		writeJSON(runs)
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSTARTED AT\tDURATION\tHOST\tCOMMAND\tFILES\tFAILED\tRECORDS\tERRORS")
+	for _, run := range runs {
+		duration := "unfinished"
+		if run.FinishedAt != nil {
+			duration = run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.ID, display.Time(run.StartedAt, time.RFC3339), duration, run.Host,
+			strings.TrimSpace(run.Command+" "+run.Arguments), display.Number(run.FileCount),
+			display.Number(run.FailedCount), display.Number(run.RecordCount), display.Number(run.ErrorCount))
+	}
+	writer.Flush()
+	fmt.Printf("(%d runs)\n", len(runs))
+}
+
+func batchesListCommand(args []string) {
+	flags := flag.NewFlagSet("batches:list", flag.ContinueOnError)
+	since := flags.String("since", "", "Only list batches imported at or after this time (RFC3339, YYYY-MM-DD, today, yesterday or -24h)")
+	format := flags.String("format", "table", "Output format: table or json")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go batches:list [options]")
+		printFlagDefaults(flags)
+	}
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Printf("Error: unsupported format %q (expected table or json)\n", *format)
+		return
+	}
+	var sinceTime time.Time
+	if *since != "" {
+		var err error
+		if sinceTime, err = scanner.ParseTimeBound(*since, time.Now()); err != nil {
+			fmt.Printf("Error: invalid --since: %v\n", err)
+			return
+		}
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	batches, err := database.ListBatches(sinceTime)
+	if err != nil {
+		log.Fatalf("Failed to list batches: %v", err)
+	}
+
+	if *format == "json" {
+		writeJSON(batches)
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tIMPORTED AT\tFILE\tRECORDS\tERRORS\tDURATION\tSTATUS")
+	for _, batch := range batches {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%v\t%s\n",
+			batch.ID, display.Time(batch.ImportedAt, time.RFC3339), batch.FilePath,
+			display.Number(batch.RecordCount), display.Number(batch.ErrorCount),
+			time.Duration(batch.DurationMS)*time.Millisecond, batchStatus(batch))
+	}
+	writer.Flush()
+	fmt.Printf("(%d batches)\n", len(batches))
+}
+
+func batchesShowCommand(args []string) {
+	flags := flag.NewFlagSet("batches:show", flag.ContinueOnError)
+	format := flags.String("format", "table", "Output format: table or json")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go batches:show [options] <batch_id>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		fmt.Println("Error: batch ID required")
+		flags.Usage()
+		return
+	}
+	batchID, err := strconv.ParseUint(positional[0], 10, 64)
+	if err != nil || batchID == 0 {
+		fmt.Printf("Error: invalid batch ID: %s\n", positional[0])
+		return
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Printf("Error: unsupported format %q (expected table or json)\n", *format)
+		return
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	info, err := database.GetBatch(uint(batchID))
+	if err != nil {
+		log.Fatalf("Failed to load batch: %v", err)
+	}
+
+	if *format == "json" {
+		writeJSON(info)
+		return
+	}
+
+	batch := info.Batch
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Batch:\t%d\n", batch.ID)
+	fmt.Fprintf(writer, "Source file:\t%s\n", batch.FilePath)
+	fmt.Fprintf(writer, "SHA-256:\t%s\n", batch.SHA256)
+	fmt.Fprintf(writer, "Size:\t%s bytes\n", display.Number(int(batch.Size)))
+	fmt.Fprintf(writer, "Modified at:\t%s\n", display.Time(batch.ModifiedAt, time.RFC3339))
+	fmt.Fprintf(writer, "Imported at:\t%s\n", display.Time(batch.ImportedAt, time.RFC3339))
+	fmt.Fprintf(writer, "Duration:\t%v\n", time.Duration(batch.DurationMS)*time.Millisecond)
+	fmt.Fprintf(writer, "Status:\t%s\n", batchStatus(batch))
+	if batch.Tags != nil {
+		fmt.Fprintf(writer, "Tags:\t%s\n", *batch.Tags)
+	}
+	fmt.Fprintf(writer, "Records parsed:\t%s\n", display.Number(batch.RecordCount))
+	fmt.Fprintf(writer, "Parsing errors:\t%s\n", display.Number(batch.ErrorCount))
+	fmt.Fprintf(writer, "Readings stored:\t%s\n", display.Number(int(info.Rows)))
+	if info.RawRows > 0 {
+		fmt.Fprintf(writer, "Raw readings pending compaction:\t%s\n", display.Number(int(info.RawRows)))
+	}
+	if info.Aggregates > 0 {
+		fmt.Fprintf(writer, "Aggregate parts stored:\t%s\n", display.Number(int(info.Aggregates)))
+	}
+	writer.Flush()
+}
+
+// batchStatus describes whether an import batch finished
+func batchStatus(batch models.ImportFile) string {
+	if batch.Completed {
+		return "completed"
+	}
+	return "incomplete"
+}
+
+// writeJSON prints a value as indented JSON for automation
+func writeJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Fatalf("Failed to write JSON: %v", err)
+	}
+}
+
+func batchesRevertCommand(args []string) {
+	flags := flag.NewFlagSet("batches:revert", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only show how many readings would be removed")
+	yes := flags.Bool("yes", false, "Revert without asking for confirmation")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go batches:revert [options] <batch_id>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		fmt.Println("Error: batch ID required")
+		flags.Usage()
+		return
+	}
+	batchID, err := strconv.ParseUint(positional[0], 10, 64)
+	if err != nil || batchID == 0 {
+		fmt.Printf("Error: invalid batch ID: %s\n", positional[0])
+		return
+	}
+
+	cfg, err := connectDatabase()
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// Always count first so the operator sees what will be removed
+	preview, err := database.RevertBatch(uint(batchID), true)
+	if err != nil {
+		logger.Fatalf("Revert failed: %v", err)
+	}
+	batch := preview.Batch
+	logger.Printf("Batch %d: %s (sha256 %s), imported %s\n",
+		batch.ID, batch.FilePath, batch.SHA256[:12], display.Time(batch.ImportedAt, time.RFC3339))
+	logger.Printf("Readings to remove: %d in sensor_data, %d in the raw ingest table\n", preview.Rows, preview.RawRows)
+	if preview.Aggregates > 0 {
+		logger.Printf("Aggregate parts to remove: %d\n", preview.Aggregates)
+	}
+	if *dryRun {
+		rehearse(func() error {
+			_, err := database.RevertBatch(uint(batchID), false)
+			return err
+		})
+		return
+	}
+
+	if !*yes {
+		fmt.Print("Revert this batch? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			logger.Println("Revert cancelled")
+			return
+		}
+	}
+
+	result, err := database.RevertBatch(uint(batchID), false)
+	if err != nil {
+		logger.Fatalf("Revert failed: %v", err)
+	}
+	logger.Printf("✓ Reverted batch %d: removed %d readings and %d raw readings\n", batchID, result.Rows, result.RawRows)
+	if cfg.Scanner.JournalFile != "" {
+		if err := scanner.AppendJournalRevert(cfg.Scanner.JournalFile, batch, int(result.Rows)); err != nil {
+			logger.Warnf("Failed to record the revert in the import journal: %v\n", err)
+		}
+	}
+}
+
+func importUndoCommand(args []string) {
+	flags := flag.NewFlagSet("import:undo", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only show how many readings would be removed")
+	yes := flags.Bool("yes", false, "Undo without asking for confirmation")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go import:undo [options] <run_id|file>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 || positional[0] == "" {
+		fmt.Println("Error: run ID or file required")
+		flags.Usage()
+		return
+	}
+
+	// A number names a run, anything else a file
+	target := positional[0]
+	undo := func(dryRun bool) (*database.UndoResult, error) {
+		return database.UndoFile(filepath.ToSlash(target), dryRun)
+	}
+	if runID, err := strconv.ParseUint(target, 10, 64); err == nil {
+		if runID == 0 {
+			fmt.Printf("Error: invalid run ID: %s\n", target)
+			return
+		}
+		undo = func(dryRun bool) (*database.UndoResult, error) {
+			return database.UndoRun(uint(runID), dryRun)
+		}
+	}
+
+	cfg, err := connectDatabase()
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// Always count first so the operator sees what will be removed
+	preview, err := undo(true)
+	if err != nil {
+		logger.Fatalf("Undo failed: %v", err)
+	}
+	if run := preview.Run; run != nil {
+		logger.Printf("Run %d: %s, started %s on %s\n", run.ID, strings.TrimSpace(run.Command+" "+run.Arguments),
+			display.Time(run.StartedAt, time.RFC3339), run.Host)
+	}
+	for _, info := range preview.Batches {
+		batch := info.Batch
+		logger.Printf("Batch %d: %s (sha256 %s), imported %s\n",
+			batch.ID, batch.FilePath, batch.SHA256[:12], display.Time(batch.ImportedAt, time.RFC3339))
+	}
+	logger.Printf("Readings to remove: %d in sensor_data, %d in the raw ingest table\n", preview.Rows, preview.RawRows)
+	if preview.Aggregates > 0 {
+		logger.Printf("Aggregate parts to remove: %d\n", preview.Aggregates)
+	}
+	if *dryRun {
+		rehearse(func() error {
+			_, err := undo(false)
+			return err
+		})
+		return
+	}
+
+	if !*yes {
+		fmt.Print("Undo this import? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			logger.Println("Undo cancelled")
+			return
+		}
+	}
+
+	result, err := undo(false)
+	if err != nil {
+		logger.Fatalf("Undo failed: %v", err)
+	}
+	logger.Printf("✓ Undid %s: removed %d readings and %d raw readings, %d file(s) will be imported again by the next scan\n",
+		target, result.Rows, result.RawRows, len(result.Batches))
+	if cfg.Scanner.JournalFile != "" {
+		for _, info := range result.Batches {
+			if err := scanner.AppendJournalRevert(cfg.Scanner.JournalFile, info.Batch, int(info.Rows)); err != nil {
+				logger.Warnf("Failed to record the undo in the import journal: %v\n", err)
+			}
+		}
+	}
+}
+
+// rehearse runs a destructive operation in a transaction that is rolled back
+// and prints the statements it would run, with the rows each would affect.
+// Commands offer --dry-run through it.
+func rehearse(operation func() error) {
+	statements, err := database.DryRun(operation)
+	if err != nil {
+		logger.Fatalf("Dry run failed: %v", err)
+	}
+	for _, statement := range statements {
+		logger.Printf("%s row(s): %s\n", display.Number(int(statement.Rows)), statement.SQL)
+	}
+	logger.Printf("Dry run, %d statement(s) rolled back, nothing changed\n", len(statements))
+}
+
+func journalVerifyCommand(args []string) {
+	flags := flag.NewFlagSet("journal:verify", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	journalPath := flags.String("journal", "", "Journal to check (default: scanner.journal_file)")
+	offline := flags.Bool("offline", false, "Only check the checksums, without connecting to the database")
+	replay := flags.Bool("replay", false, "Re-import journaled files that are missing from the database")
+	dryRun := flags.Bool("dry-run", false, "With --replay, only list the files that would be re-imported")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go journal:verify [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+	if *journalPath == "" {
+		*journalPath = loadConfig().Scanner.JournalFile
+	}
+	if *journalPath == "" {
+		fmt.Println("Error: no journal configured; set scanner.journal_file or pass --journal")
+		return
+	}
+	if *offline && *replay {
+		fmt.Println("Error: --replay needs the database, it cannot be combined with --offline")
+		return
+	}
+
+	report, err := scanner.VerifyJournal(*journalPath)
+	if err != nil {
+		logger.Fatalf("Journal verification failed: %v", err)
+	}
+	summary := fmt.Sprintf("Journal %s: %s entries", *journalPath, display.Number(report.Entries))
+	if report.Entries > 0 {
+		summary += fmt.Sprintf(" from %s, %s to %s", strings.Join(report.Hosts, ", "),
+			display.Time(report.First, time.RFC3339), display.Time(report.Last, time.RFC3339))
+	}
+	logger.Println(summary)
+	logger.Printf("  %s imported, %s failed, %s reverted\n",
+		display.Number(report.Imports), display.Number(report.Failures), display.Number(report.Reverts))
+	if report.Broken != nil {
+		logger.Fatalf("✗ Checksum chain broken at line %d: %v", report.BrokenLine, report.Broken)
+	}
+	logger.Println("✓ Checksum chain intact")
+	if *offline {
+		return
+	}
+
+	_, csvScanner := options.newScanner()
+	missing, err := csvScanner.MissingImports(report)
+	if err != nil {
+		logger.Fatalf("Comparison with the database failed: %v", err)
+	}
+	if len(missing) == 0 {
+		logger.Println("✓ Every journaled import is in the import manifest")
+		return
+	}
+	logger.Warnf("%d journaled import(s) are not in the import manifest:\n", len(missing))
+	if !*replay {
+		for _, entry := range missing {
+			logger.Printf("  %s (sha256 %s, %s readings, imported %s)\n", entry.File, entry.SHA256[:12],
+				display.Number(entry.Records), display.Time(entry.Time, time.RFC3339))
+		}
+		logger.Println("Run journal:verify --replay to import the files still on disk again")
+		return
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	result, err := csvScanner.ReplayJournal(ctx, missing, *dryRun)
+	if err != nil {
+		logger.Fatalf("Replay failed: %v", err)
+	}
+	if *dryRun {
+		logger.Printf("Files to replay: %d (dry run, nothing imported)\n", result.Replayed)
+	} else {
+		logger.Printf("✓ Replayed %d file(s)\n", result.Replayed)
+	}
+	if result.Changed+result.Gone+result.Remote > 0 {
+		logger.Warnf("Not replayable: %d changed, %d no longer on disk, %d downloaded or piped in\n",
+			result.Changed, result.Gone, result.Remote)
+	}
+}
+
+func annotationsAddCommand(args []string) {
+	flags := flag.NewFlagSet("annotations:add", flag.ContinueOnError)
+	from := flags.String("from", "", "Start of the annotated event (RFC3339, \"2006-01-02 15:04:05\" in UTC, now or -2h)")
+	to := flags.String("to", "", "End of the event (same formats as --from; default: a point in time)")
+	sensors := flags.String("sensors", "*", "Glob pattern of the sensors the event concerns")
+	author := flags.String("author", "", "Who wrote the annotation (default: the current user)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go annotations:add [options] <text>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 || *from == "" {
+		fmt.Println("Error: --from and the annotation text are required")
+		flags.Usage()
+		return
+	}
+	now := time.Now()
+	startsAt, err := scanner.ParseTimeBound(*from, now)
+	if err != nil {
+		fmt.Printf("Error: invalid --from: %v\n", err)
+		return
+	}
+	var endsAt time.Time
+	if *to != "" {
+		if endsAt, err = scanner.ParseTimeBound(*to, now); err != nil {
+			fmt.Printf("Error: invalid --to: %v\n", err)
+			return
+		}
+	}
+	if *author == "" {
+		if current, err := user.Current(); err == nil {
+			*author = current.Username
+		}
+	}
+	annotation, err := database.NewAnnotation(startsAt, endsAt, *sensors, positional[0], *author)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	if err := database.CreateAnnotation(annotation); err != nil {
+		logger.Fatalf("Failed to add annotation: %v", err)
+	}
+	logger.Printf("✓ Added annotation %d for %s from %s to %s\n", annotation.ID, annotation.SensorPattern,
+		display.Time(annotation.StartsAt, time.RFC3339), display.Time(annotation.EndsAt, time.RFC3339))
+}
+
+func annotationsListCommand(args []string) {
+	flags := flag.NewFlagSet("annotations:list", flag.ContinueOnError)
+	from := flags.String("from", "", "Only annotations ending at or after this time (RFC3339, YYYY-MM-DD, today or -24h)")
+	to := flags.String("to", "", "Only annotations starting before this time")
+	sensors := flags.String("sensors", "", "Only annotations concerning these sensors (comma-separated names)")
+	format := flags.String("format", "table", "Output format: table or json")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go annotations:list [options]")
+		printFlagDefaults(flags)
+	}
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Printf("Error: unsupported format %q (expected table or json)\n", *format)
+		return
+	}
+	var filter database.AnnotationFilter
+	now := time.Now()
+	for _, bound := range []struct {
+		flag  string
+		value string
+		time  *time.Time
+	}{{"--from", *from, &filter.From}, {"--to", *to, &filter.To}} {
+		if bound.value == "" {
+			continue
+		}
+		var err error
+		if *bound.time, err = scanner.ParseTimeBound(bound.value, now); err != nil {
+			fmt.Printf("Error: invalid %s: %v\n", bound.flag, err)
+			return
+		}
+	}
+	if *sensors != "" {
+		filter.Sensors = splitPatterns(*sensors)
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	annotations, err := database.ListAnnotations(filter)
+	if err != nil {
+		log.Fatalf("Failed to list annotations: %v", err)
+	}
+
+	if *format == "json" {
+		writeJSON(annotations)
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tFROM\tTO\tSENSORS\tAUTHOR\tTEXT")
+	for _, annotation := range annotations {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			annotation.ID, display.Time(annotation.StartsAt, time.RFC3339), display.Time(annotation.EndsAt, time.RFC3339),
+			annotation.SensorPattern, annotation.Author, annotation.Text)
+	}
+	writer.Flush()
+	fmt.Printf("(%d annotations)\n", len(annotations))
+}
+
+func annotationsDeleteCommand(args []string) {
+	flags := flag.NewFlagSet("annotations:delete", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only show what would be deleted")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go annotations:delete [options] <annotation_id>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		fmt.Println("Error: annotation ID required")
+		flags.Usage()
+		return
+	}
+	id, err := strconv.ParseUint(positional[0], 10, 64)
+	if err != nil || id == 0 {
+		fmt.Printf("Error: invalid annotation ID: %s\n", positional[0])
+		return
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	if *dryRun {
+		rehearse(func() error { return database.DeleteAnnotation(uint(id)) })
+		return
+	}
+	if err := database.DeleteAnnotation(uint(id)); err != nil {
+		logger.Fatalf("Failed to delete annotation: %v", err)
+	}
+	logger.Printf("✓ Deleted annotation %d\n", id)
+}
+
+func readingsExcludeCommand(args []string) {
+	flags := flag.NewFlagSet("readings:exclude", flag.ContinueOnError)
+	from := flags.String("from", "", "Start of the excluded range, or the excluded reading's timestamp (RFC3339, \"2006-01-02 15:04:05\" in UTC)")
+	to := flags.String("to", "", "End of the excluded range, inclusive (default: only readings at --from)")
+	sensors := flags.String("sensors", "", "Glob pattern of the sensors whose readings are excluded, * for all (required)")
+	author := flags.String("author", "", "Who excluded the readings (default: the current user)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go readings:exclude [options] <reason>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 || *from == "" || *sensors == "" {
+		fmt.Println("Error: --from, --sensors and the reason are required")
+		flags.Usage()
+		return
+	}
+	now := time.Now()
+	startsAt, err := scanner.ParseTimeBound(*from, now)
+	if err != nil {
+		fmt.Printf("Error: invalid --from: %v\n", err)
+		return
+	}
+	var endsAt time.Time
+	if *to != "" {
+		if endsAt, err = scanner.ParseTimeBound(*to, now); err != nil {
+			fmt.Printf("Error: invalid --to: %v\n", err)
+			return
+		}
+	}
+	if *author == "" {
+		if current, err := user.Current(); err == nil {
+			*author = current.Username
+		}
+	}
+	exclusion, err := database.NewExclusion(startsAt, endsAt, *sensors, positional[0], *author)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	readings, err := database.CreateExclusion(exclusion)
+	if err != nil {
+		logger.Fatalf("Failed to exclude readings: %v", err)
+	}
+	logger.Printf("✓ Exclusion %d: %d readings of %s from %s to %s excluded (%s)\n", exclusion.ID, readings,
+		exclusion.SensorPattern, display.Time(exclusion.StartsAt, time.RFC3339), display.Time(exclusion.EndsAt, time.RFC3339),
+		exclusion.Reason)
+}
+
+func readingsExclusionsCommand(args []string) {
+	flags := flag.NewFlagSet("readings:exclusions", flag.ContinueOnError)
+	all := flags.Bool("all", false, "Also list revoked exclusions")
+	format := flags.String("format", "table", "Output format: table or json")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go readings:exclusions [options]")
+		printFlagDefaults(flags)
+	}
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Printf("Error: unsupported format %q (expected table or json)\n", *format)
+		return
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	exclusions, err := database.ListExclusions(*all)
+	if err != nil {
+		log.Fatalf("Failed to list exclusions: %v", err)
+	}
+
+	if *format == "json" {
+		writeJSON(exclusions)
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tFROM\tTO\tSENSORS\tAUTHOR\tCREATED AT\tSTATUS\tREASON")
+	for _, exclusion := range exclusions {
+		status := "active"
+		if exclusion.RevokedAt != nil {
+			status = "revoked " + display.Time(*exclusion.RevokedAt, time.RFC3339)
+			if exclusion.RevokedBy != "" {
+				status += " by " + exclusion.RevokedBy
+			}
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			exclusion.ID, display.Time(exclusion.StartsAt, time.RFC3339), display.Time(exclusion.EndsAt, time.RFC3339),
+			exclusion.SensorPattern, exclusion.Author, display.Time(exclusion.CreatedAt, time.RFC3339), status, exclusion.Reason)
+	}
+	writer.Flush()
+	fmt.Printf("(%d exclusions)\n", len(exclusions))
+}
+
+func readingsRestoreCommand(args []string) {
+	flags := flag.NewFlagSet("readings:restore", flag.ContinueOnError)
+	author := flags.String("author", "", "Who revoked the exclusion (default: the current user)")
+	dryRun := flags.Bool("dry-run", false, "Only show what would change")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go readings:restore [options] <exclusion_id>")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		fmt.Println("Error: exclusion ID required")
+		flags.Usage()
+		return
+	}
+	id, err := strconv.ParseUint(positional[0], 10, 64)
+	if err != nil || id == 0 {
+		fmt.Printf("Error: invalid exclusion ID: %s\n", positional[0])
+		return
+	}
+	if *author == "" {
+		if current, err := user.Current(); err == nil {
+			*author = current.Username
+		}
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	if *dryRun {
+		rehearse(func() error { return database.RevokeExclusion(uint(id), *author) })
+		return
+	}
+	if err := database.RevokeExclusion(uint(id), *author); err != nil {
+		logger.Fatalf("Failed to restore readings: %v", err)
+	}
+	logger.Printf("✓ Exclusion %d revoked, its readings count again\n", id)
+}
+
+func compactCommand(args []string) {
+	flags := flag.NewFlagSet("compact", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only show what would be moved and removed")
+	insertPolicy := flags.String("on-duplicate", "", "Handle readings already in sensor_data: skip (error also skips) or update")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go compact [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
+	logger.Println("Compacting raw ingest table...")
+
+	cfg, err := connectDatabase()
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	if *insertPolicy != "" {
+		cfg.Scanner.InsertPolicy = *insertPolicy
+		if err := cfg.Scanner.Validate(); err != nil {
+			logger.Fatalf("Invalid --on-duplicate: %v", err)
+		}
+	}
+	if *dryRun {
+		rehearse(func() error {
+			_, err := database.CompactRawData(cfg)
+			return err
+		})
+		return
+	}
+
+	result, err := database.CompactRawData(cfg)
+	if err != nil {
+		logger.Fatalf("Compaction failed: %v", err)
+	}
+
+	if result.RawRows == 0 {
+		logger.Println("Raw ingest table is empty, nothing to compact")
+		return
+	}
+
+	logger.Printf("✓ Compacted %d raw rows: %d inserted, %d replaced, %d duplicates discarded\n",
+		result.RawRows, result.Inserted, result.Replaced, result.Duplicates)
+}
+
+func aggregatesRollupCommand(args []string) {
+	flags := flag.NewFlagSet("aggregates:rollup", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go aggregates:rollup")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
+	if _, err := connectDatabase(); err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	merged, err := database.RollupAggregates()
+	if err != nil {
+		logger.Fatalf("Rollup failed: %v", err)
+	}
+	if merged == 0 {
+		logger.Println("No dirty aggregates, nothing to merge")
+		return
+	}
+	logger.Printf("✓ Merged %d dirty aggregated interval(s)\n", merged)
+}
+
+func rejectsRetryCommand(args []string) {
+	flags := flag.NewFlagSet("rejects:retry", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	source := flags.String("source", "", "Only retry readings whose source file matches this glob pattern")
+	dryRun := flags.Bool("dry-run", false, "Only count the readings that would be retried")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go rejects:retry [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
+	_, csvScanner := options.newScanner()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	result, err := csvScanner.RetryRejects(ctx, *source, *dryRun)
+	if err != nil {
+		logger.Fatalf("Retry failed: %v", err)
+	}
+	if *dryRun {
+		logger.Printf("Dead letters to retry: %d (dry run, nothing inserted)\n", result.Retried)
+		return
+	}
+	logger.Printf("✓ Retried %d dead letters: %d inserted, %d already existing, %d still failing\n",
+		result.Retried, result.Inserted, result.Skipped, result.Failed)
+}
+
+func serveCommand(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	options := addScanFlags(flags)
+	listen := flags.String("listen", "", "Address to listen on (overrides server.listen in config.yaml)")
+	controlSocket := flags.String("control-socket", "", "Answer status commands on this socket (overrides control.socket)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go serve [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+
+	cfg, csvScanner := options.newScanner()
+	if *listen != "" {
+		cfg.Server.Listen = *listen
+	}
+	defer startControl(cfg, *controlSocket, csvScanner)()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	// Ingest waits for pending migrations that auto_migrate did not apply
+	srv := server.New(cfg.Server, csvScanner)
+	srv.CheckSchema(func() ([]string, error) {
+		return database.PendingMigrations(cfg)
+	})
+	srv.SetConfigLoader(func() (*config.Config, error) { return config.Load("") })
+	defer reloadOnHangup(srv)()
+	if err := srv.Run(ctx); err != nil {
+		logger.Fatalf("Server failed: %v", err)
+	}
+}
+
+func statusCommand(args []string) {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	controlSocket := flags.String("control-socket", "", "Socket of the watch or serve process (overrides control.socket)")
+	format := flags.String("format", "table", "Output format: table or json")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go status [options]")
+		printFlagDefaults(flags)
+	}
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Printf("Error: unsupported format %q (expected table or json)\n", *format)
+		return
+	}
+
+	cfg := loadConfig()
+	var status scanner.Status
+	if err := control.Send(controlAddress(cfg, *controlSocket), "status", &status); err != nil {
+		log.Fatalf("Failed to query status: %v", err)
+	}
+
+	if *format == "json" {
+		writeJSON(status)
+		return
+	}
+
+	state := "running"
+	if status.Paused {
+		state = "paused"
+	}
+	fmt.Printf("%s (pid %d), %s, up %s with %d worker(s)\n", status.Command, status.PID, state, time.Since(status.Started).Round(time.Second), status.Workers)
+	fmt.Printf("Readings: %s inserted, %s/s over the last minute\n", display.Number(int(status.Readings)), display.Number(int(status.Rate)))
+	fmt.Printf("Queue depth: %d (%d waiting, %d settling, %d to retry)\n",
+		status.Queue.Depth(), status.Queue.Waiting, status.Queue.Settling, status.Queue.Retrying)
+	if len(status.Files) == 0 {
+		fmt.Println("No files in progress")
+		return
+	}
+	fmt.Println()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "FILE\tRUNNING\tREADINGS")
+	for _, file := range status.Files {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", file.Name, time.Since(file.Started).Round(time.Second), display.Number(int(file.Readings)))
+	}
+	writer.Flush()
+}
+
+func controlCommand(args []string) {
+	flags := flag.NewFlagSet("control", flag.ContinueOnError)
+	controlSocket := flags.String("control-socket", "", "Socket of the watch or serve process (overrides control.socket)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go control [options] pause|resume")
+		printFlagDefaults(flags)
+	}
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 || (positional[0] != "pause" && positional[0] != "resume") {
+		fmt.Println("Error: pause or resume required")
+		flags.Usage()
+		return
+	}
+	command := positional[0]
+
+	cfg := loadConfig()
+	var result pauseResult
+	if err := control.Send(controlAddress(cfg, *controlSocket), command, &result); err != nil {
+		log.Fatalf("Failed to %s: %v", command, err)
+	}
+
+	status := result.Status
+	switch {
+	case command == "pause" && !result.Changed:
+		fmt.Printf("%s (pid %d) is paused already\n", status.Command, status.PID)
+	case command == "pause":
+		fmt.Printf("✓ Paused %s (pid %d): %d file(s) in progress finish, new work waits for resume\n",
+			status.Command, status.PID, len(status.Files))
+	case !result.Changed:
+		fmt.Printf("%s (pid %d) is not paused\n", status.Command, status.PID)
+	default:
+		fmt.Printf("✓ Resumed %s (pid %d), %d file(s) waiting\n", status.Command, status.PID, status.Queue.Depth())
+	}
+}
+
+// reloadOnHangup reloads the runtime settings of serve from config.yaml on
+// SIGHUP, dropping the changes made with the admin API, and returns a
+// function that stops it
+func reloadOnHangup(srv *server.Server) func() {
+	hangups := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hangups:
+				cfg, err := config.Load("")
+				if err != nil {
+					logger.Errorf("Keeping the current settings: %v\n", err)
+					continue
+				}
+				srv.Reload(cfg)
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hangups)
+		close(stopped)
+	}
+}
+
+func demoCommand(args []string) {
+	flags := flag.NewFlagSet("demo", flag.ContinueOnError)
+	days := flags.Int("days", 7, "Days of sample readings to generate")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run main.go demo [options]")
+		printFlagDefaults(flags)
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return
+	}
+	if *days < 1 {
+		fmt.Println("Error: --days must be at least 1")
+		return
+	}
+
+	// Whatever database is configured, the demo never touches it
+	cfg := loadConfig()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.SQLite = config.SQLiteConfig{Path: config.SQLiteMemory}
+	if _, err := database.Connect(cfg); err != nil {
+		logger.Fatalf("Failed to open the in-memory database: %v", err)
+	}
+	if err := bootstrapSchema(cfg); err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "sensor_data_demo")
+	if err != nil {
+		logger.Fatalf("Failed to create the sample directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := writeDemoData(dir, *days); err != nil {
+		logger.Fatalf("Failed to generate sample data: %v", err)
+	}
+	logger.Printf("Generated %d day(s) of sample readings in %s\n", *days, dir)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	csvScanner := scanner.NewCSVScanner(database.GetDB())
+	if err := csvScanner.ScanDirectory(ctx, dir); err != nil {
+		logger.Fatalf("Demo import failed: %v", err)
+	}
+
+	stats, err := sensorquery.Readings().
+		Aggregate(sensorquery.Count, sensorquery.Min, sensorquery.Avg, sensorquery.Max).
+		Find(sensorquery.NewSource(database.GetDB()))
+	if err != nil {
+		logger.Fatalf("Failed to query the imported readings: %v", err)
+	}
+
+	writer := tabwriter.NewWriter(logger.Console(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\nSENSOR\tREADINGS\tMIN\tAVG\tMAX")
+	for _, stat := range stats {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", stat.SensorName, display.Number(int(stat.Values[0])),
+			display.Float(stat.Values[1], 2), display.Float(stat.Values[2], 2), display.Float(stat.Values[3], 2))
+	}
+	writer.Flush()
+	logger.Println("\n✓ Demo completed; the in-memory database is discarded on exit")
+	logger.Println("  Point config.yaml at your database and run scan on your own files to import them")
+}
+
+// writeDemoData writes a few days of temperature and humidity readings every
+// five minutes, plus a file with typical mistakes that end up rejected
+func writeDemoData(dir string, days int) error {
+	end := time.Now().UTC().Truncate(time.Hour)
+	start := end.AddDate(0, 0, -days)
+
+	files := []struct {
+		name    string
+		sensors []string
+		base    float64
+		swing   float64
+	}{
+		{"temperature.csv", []string{"temp_01", "temp_02", "temp_03"}, 21, 3},
+		{"humidity.csv", []string{"humidity_01", "humidity_02"}, 45, 10},
+	}
+	for i, file := range files {
+		var b strings.Builder
+		b.WriteString("timestamp,sensor_name,value\n")
+		for t := start; t.Before(end); t = t.Add(5 * time.Minute) {
+			// A daily cycle, offset per sensor
+			hour := float64(t.Hour()) + float64(t.Minute())/60
+			for j, sensor := range file.sensors {
+				value := file.base + file.swing*math.Sin((hour-6+float64(i+j))/24*2*math.Pi)
+				fmt.Fprintf(&b, "%s,%s,%.2f\n", t.Format(time.RFC3339), sensor, value)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, file.name), []byte(b.String()), 0644); err != nil {
+			return err
+		}
+	}
+
+	mistakes := "timestamp,sensor_name,value\n" +
+		end.Format(time.RFC3339) + ",door_01,1\n" +
+		"yesterday noon,door_01,0\n" +
+		end.Format(time.RFC3339) + ",door_02,open\n" +
+		end.Format(time.RFC3339) + ",,1\n"
+	return os.WriteFile(filepath.Join(dir, "door_events.csv"), []byte(mistakes), 0644)
+}
+
 func testInsertCommand() {
 	logger.Println("Inserting sample sensor data...")
 
@@ -0,0 +1,7 @@
+-- Migration: Rename sensor_data table
+-- Created: 2025-09-05 05:05:50
+-- Description: Give sensor_data the configured table_prefix and table_suffix; the baseline migration predates them and creates it unprefixed
+
+{{if ne (table "sensor_data") "sensor_data"}}
+ALTER TABLE sensor_data RENAME TO {{table "sensor_data"}};
+{{end}}
@@ -0,0 +1,11 @@
+-- Migration: Apply sensor_data ID strategy
+-- Created: 2025-09-05 05:06:00
+-- Description: Key sensor_data by the configured database.id_strategy; the importer refuses to run it against a populated table keyed differently
+
+{{if eq driver "mysql"}}{{if eq idStrategy "snowflake"}}
+ALTER TABLE {{table "sensor_data"}} MODIFY id BIGINT NOT NULL;
+{{else if eq idStrategy "composite"}}
+ALTER TABLE {{table "sensor_data"}} DROP PRIMARY KEY, DROP COLUMN id, DROP INDEX idx_timestamp_sensor, ADD PRIMARY KEY (timestamp, sensor_name);
+{{end}}{{else if eq driver "postgres"}}{{if eq idStrategy "snowflake"}}
+ALTER TABLE {{table "sensor_data"}} ALTER COLUMN id DROP DEFAULT;
+{{end}}{{end}}
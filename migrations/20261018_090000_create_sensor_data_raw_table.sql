@@ -0,0 +1,11 @@
+-- Migration: Create sensor_data_raw table
+-- Created: 2026-10-18 09:00:00
+-- Description: Append-only ingest table without unique index, deduplicated into sensor_data by the compact command
+
+CREATE TABLE {{table "sensor_data_raw"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    timestamp TIMESTAMP NOT NULL,
+    sensor_name VARCHAR(255) NOT NULL,
+    value DOUBLE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
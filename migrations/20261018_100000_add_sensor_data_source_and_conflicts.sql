@@ -0,0 +1,24 @@
+-- Migration: Add sensor data source and conflicts
+-- Created: 2026-10-18 10:00:00
+-- Description: Track the source file of each reading and record duplicate conflicts resolved by source precedence
+
+ALTER TABLE {{table "sensor_data"}}
+    ADD COLUMN source_file VARCHAR(1024) NULL,
+    ADD COLUMN source_modified_at TIMESTAMP NULL;
+
+ALTER TABLE {{table "sensor_data_raw"}}
+    ADD COLUMN source_file VARCHAR(1024) NULL,
+    ADD COLUMN source_modified_at TIMESTAMP NULL;
+
+CREATE TABLE {{table "sensor_data_conflicts"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    timestamp TIMESTAMP NOT NULL,
+    sensor_name VARCHAR(255) NOT NULL,
+    kept_value DOUBLE NOT NULL,
+    discarded_value DOUBLE NOT NULL,
+    kept_source VARCHAR(1024) NULL,
+    discarded_source VARCHAR(1024) NULL,
+    policy VARCHAR(32) NOT NULL,
+    resolved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_conflicts_sensor_timestamp (sensor_name, timestamp)
+);
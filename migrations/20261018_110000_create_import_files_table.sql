@@ -0,0 +1,15 @@
+-- Migration: Create import_files table
+-- Created: 2026-10-18 11:00:00
+-- Description: Manifest of imported files so repeated scans skip files whose contents were already imported
+
+CREATE TABLE {{table "import_files"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    file_path VARCHAR(1024) NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    modified_at TIMESTAMP NOT NULL,
+    record_count INT NOT NULL,
+    error_count INT NOT NULL,
+    imported_at TIMESTAMP NOT NULL,
+    UNIQUE INDEX idx_import_files_sha256 (sha256)
+);
@@ -0,0 +1,12 @@
+-- Migration: Create import_checkpoints table
+-- Created: 2026-10-18 12:00:00
+-- Description: Committed reading offsets of partially imported files so interrupted imports resume
+
+CREATE TABLE {{table "import_checkpoints"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    file_path VARCHAR(1024) NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    committed_rows INT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE INDEX idx_import_checkpoints_sha256 (sha256)
+);
@@ -0,0 +1,10 @@
+-- Migration: Create sensor_last_values table
+-- Created: 2026-10-18 13:00:00
+-- Description: Latest reading per sensor, maintained during import for fast "latest value" lookups
+
+CREATE TABLE {{table "sensor_last_values"}} (
+    sensor_name VARCHAR(255) NOT NULL PRIMARY KEY,
+    timestamp TIMESTAMP NOT NULL,
+    value DOUBLE NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
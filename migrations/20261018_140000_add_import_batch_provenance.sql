@@ -0,0 +1,13 @@
+-- Migration: Add import batch provenance
+-- Created: 2026-10-18 14:00:00
+-- Description: Link each reading to the import_files entry (import batch) that created it so a batch can be reverted
+
+ALTER TABLE {{table "sensor_data"}}
+    ADD COLUMN import_file_id BIGINT NULL,
+    ADD INDEX idx_sensor_data_import_file (import_file_id);
+
+ALTER TABLE {{table "sensor_data_raw"}}
+    ADD COLUMN import_file_id BIGINT NULL;
+
+ALTER TABLE {{table "import_files"}}
+    ADD COLUMN completed BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,6 @@
+-- Migration: Add import_files duration
+-- Created: 2026-10-18 15:00:00
+-- Description: Record how long each import batch took
+
+ALTER TABLE {{table "import_files"}}
+    ADD COLUMN duration_ms BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+-- Migration: Create sensor_data_rejects table
+-- Created: 2026-10-18 16:00:00
+-- Description: Dead-letter table for parsed readings that failed to insert, replayed with rejects:retry
+
+CREATE TABLE {{table "sensor_data_rejects"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    timestamp TIMESTAMP NOT NULL,
+    sensor_name VARCHAR(255) NOT NULL,
+    value DOUBLE NOT NULL,
+    source_file VARCHAR(1024) NOT NULL,
+    import_file_id BIGINT NULL,
+    error VARCHAR(1024) NOT NULL,
+    attempts INT NOT NULL,
+    failed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP NULL
+);
@@ -0,0 +1,14 @@
+-- Migration: Create annotations table
+-- Created: 2026-10-18 17:00:00
+-- Description: Events over a time range, such as maintenance windows, stored alongside the readings of matching sensors
+
+CREATE TABLE {{table "annotations"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    sensor_pattern VARCHAR(255) NOT NULL,
+    text VARCHAR(1024) NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_annotations_starts_at (starts_at)
+);
@@ -0,0 +1,17 @@
+-- Migration: Create reading_exclusions table
+-- Created: 2026-10-18 18:00:00
+-- Description: Time ranges of readings marked as bad data, skipped by exports without deleting them
+
+CREATE TABLE {{table "reading_exclusions"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    sensor_pattern VARCHAR(255) NOT NULL,
+    sensor_like VARCHAR(512) NOT NULL,
+    reason VARCHAR(1024) NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP NULL,
+    revoked_by VARCHAR(255) NOT NULL DEFAULT '',
+    INDEX idx_reading_exclusions_range (starts_at, ends_at)
+);
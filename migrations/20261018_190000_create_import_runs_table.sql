@@ -0,0 +1,24 @@
+-- Migration: Create import runs table
+-- Created: 2026-10-18 19:00:00
+-- Description: Record each run of an importing command and link the readings it wrote to it
+
+CREATE TABLE {{table "import_runs"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    command VARCHAR(64) NOT NULL,
+    arguments VARCHAR(2048) NULL,
+    host VARCHAR(255) NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NULL,
+    file_count INT NOT NULL,
+    failed_count INT NOT NULL,
+    record_count INT NOT NULL,
+    error_count INT NOT NULL,
+    INDEX idx_import_runs_started_at (started_at)
+);
+
+ALTER TABLE {{table "sensor_data"}}
+    ADD COLUMN source_run_id BIGINT NULL,
+    ADD INDEX idx_sensor_data_source_run (source_run_id);
+
+ALTER TABLE {{table "sensor_data_raw"}}
+    ADD COLUMN source_run_id BIGINT NULL;
@@ -0,0 +1,18 @@
+-- Migration: Create sensor_data_aggregates table
+-- Created: 2026-10-18 20:00:00
+-- Description: Per-interval min/max/avg/count of high-frequency sensors, stored instead of their readings
+
+CREATE TABLE {{table "sensor_data_aggregates"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    bucket_start TIMESTAMP NOT NULL,
+    sensor_name VARCHAR(255) NOT NULL,
+    interval_seconds INT NOT NULL,
+    import_file_id BIGINT NULL,
+    reading_count INT NOT NULL,
+    min_value DOUBLE NOT NULL,
+    max_value DOUBLE NOT NULL,
+    avg_value DOUBLE NOT NULL,
+    source_run_id BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_sensor_aggregates_bucket (bucket_start, sensor_name, interval_seconds, import_file_id)
+);
@@ -0,0 +1,8 @@
+-- Migration: Add percentiles to sensor_data_aggregates
+-- Created: 2026-10-18 21:00:00
+-- Description: Approximate median, 95th and 99th percentile of each aggregated interval
+
+ALTER TABLE {{table "sensor_data_aggregates"}}
+    ADD COLUMN p50_value DOUBLE NULL,
+    ADD COLUMN p95_value DOUBLE NULL,
+    ADD COLUMN p99_value DOUBLE NULL;
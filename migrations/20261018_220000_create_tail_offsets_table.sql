@@ -0,0 +1,13 @@
+-- Migration: Create tail_offsets table
+-- Created: 2026-10-18 22:00:00
+-- Description: How far tail mode has imported each growing file, so it continues there after a restart
+
+CREATE TABLE {{table "tail_offsets"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    file_path VARCHAR(768) NOT NULL,
+    byte_offset BIGINT NOT NULL,
+    head_size INT NOT NULL,
+    head_sha256 VARCHAR(64) NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE INDEX idx_tail_offsets_file_path (file_path)
+);
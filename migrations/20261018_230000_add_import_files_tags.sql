@@ -0,0 +1,6 @@
+-- Migration: Add import_files tags
+-- Created: 2026-10-18 23:00:00
+-- Description: Store the fields captured from each file name on its import batch
+
+ALTER TABLE {{table "import_files"}}
+    ADD COLUMN tags VARCHAR(1024) NULL;
@@ -0,0 +1,97 @@
+-- Migration: Split sensor_data_aggregates into per-batch parts
+-- Created: 2026-10-19 00:00:00
+-- Description: Keep what each import batch contributed to an interval in sensor_data_aggregate_parts and merge the parts into one row per interval in sensor_data_aggregates
+
+{{if eq driver "postgres"}}
+CREATE TABLE {{table "sensor_data_aggregate_parts"}} (
+    id BIGSERIAL PRIMARY KEY,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    sensor_name VARCHAR(255) NOT NULL,
+    interval_seconds INT NOT NULL,
+    import_file_id BIGINT NOT NULL,
+    reading_count INT NOT NULL,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    avg_value DOUBLE PRECISION NOT NULL,
+    p50_value DOUBLE PRECISION NULL,
+    p95_value DOUBLE PRECISION NULL,
+    p99_value DOUBLE PRECISION NULL,
+    digest BYTEA NULL,
+    source_run_id BIGINT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+{{else if eq driver "sqlite"}}
+CREATE TABLE {{table "sensor_data_aggregate_parts"}} (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    bucket_start DATETIME NOT NULL,
+    sensor_name VARCHAR(255) NOT NULL,
+    interval_seconds INTEGER NOT NULL,
+    import_file_id INTEGER NOT NULL,
+    reading_count INTEGER NOT NULL,
+    min_value REAL NOT NULL,
+    max_value REAL NOT NULL,
+    avg_value REAL NOT NULL,
+    p50_value REAL NULL,
+    p95_value REAL NULL,
+    p99_value REAL NULL,
+    digest BLOB NULL,
+    source_run_id INTEGER NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+{{else}}
+CREATE TABLE {{table "sensor_data_aggregate_parts"}} (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    bucket_start TIMESTAMP NOT NULL,
+    sensor_name VARCHAR(255) NOT NULL,
+    interval_seconds INT NOT NULL,
+    import_file_id BIGINT NOT NULL,
+    reading_count INT NOT NULL,
+    min_value DOUBLE NOT NULL,
+    max_value DOUBLE NOT NULL,
+    avg_value DOUBLE NOT NULL,
+    p50_value DOUBLE NULL,
+    p95_value DOUBLE NULL,
+    p99_value DOUBLE NULL,
+    digest BLOB NULL,
+    source_run_id BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+{{end}}
+CREATE UNIQUE INDEX idx_sensor_aggregate_parts_bucket ON {{table "sensor_data_aggregate_parts"}} (bucket_start, sensor_name, interval_seconds, import_file_id);
+CREATE INDEX idx_sensor_aggregate_parts_import_file ON {{table "sensor_data_aggregate_parts"}} (import_file_id);
+CREATE INDEX idx_sensor_aggregate_parts_source_run ON {{table "sensor_data_aggregate_parts"}} (source_run_id);
+
+-- Each batch keeps its row as its part; rows stored without a batch add up
+-- to one part per interval. A part merged from several rows keeps no
+-- percentiles, which cannot be combined without their t-digests.
+INSERT INTO {{table "sensor_data_aggregate_parts"}} (bucket_start, sensor_name, interval_seconds, import_file_id, reading_count,
+    min_value, max_value, avg_value, p50_value, p95_value, p99_value, source_run_id, created_at)
+SELECT bucket_start, sensor_name, interval_seconds, COALESCE(import_file_id, 0), SUM(reading_count),
+    MIN(min_value), MAX(max_value),
+    SUM(avg_value * CASE WHEN reading_count > 0 THEN reading_count ELSE 1 END) / SUM(CASE WHEN reading_count > 0 THEN reading_count ELSE 1 END),
+    CASE WHEN COUNT(*) = 1 THEN MAX(p50_value) END, CASE WHEN COUNT(*) = 1 THEN MAX(p95_value) END, CASE WHEN COUNT(*) = 1 THEN MAX(p99_value) END,
+    MAX(source_run_id), MAX(created_at)
+FROM {{table "sensor_data_aggregates"}}
+GROUP BY bucket_start, sensor_name, interval_seconds, COALESCE(import_file_id, 0);
+
+DELETE FROM {{table "sensor_data_aggregates"}};
+
+{{if eq driver "mysql"}}
+ALTER TABLE {{table "sensor_data_aggregates"}} DROP INDEX idx_sensor_aggregates_bucket, DROP COLUMN import_file_id, DROP COLUMN source_run_id;
+{{else}}
+DROP INDEX idx_sensor_aggregates_bucket;
+ALTER TABLE {{table "sensor_data_aggregates"}} DROP COLUMN import_file_id;
+ALTER TABLE {{table "sensor_data_aggregates"}} DROP COLUMN source_run_id;
+{{end}}
+CREATE UNIQUE INDEX idx_sensor_aggregates_bucket ON {{table "sensor_data_aggregates"}} (bucket_start, sensor_name, interval_seconds);
+
+-- Every interval is merged from its parts like the importer does
+INSERT INTO {{table "sensor_data_aggregates"}} (bucket_start, sensor_name, interval_seconds, reading_count,
+    min_value, max_value, avg_value, p50_value, p95_value, p99_value, created_at)
+SELECT bucket_start, sensor_name, interval_seconds, SUM(reading_count),
+    MIN(min_value), MAX(max_value),
+    SUM(avg_value * CASE WHEN reading_count > 0 THEN reading_count ELSE 1 END) / SUM(CASE WHEN reading_count > 0 THEN reading_count ELSE 1 END),
+    CASE WHEN COUNT(*) = 1 THEN MAX(p50_value) END, CASE WHEN COUNT(*) = 1 THEN MAX(p95_value) END, CASE WHEN COUNT(*) = 1 THEN MAX(p99_value) END,
+    MIN(created_at)
+FROM {{table "sensor_data_aggregate_parts"}}
+GROUP BY bucket_start, sensor_name, interval_seconds;
@@ -0,0 +1,6 @@
+-- Migration: Add dirty flag to sensor_data_aggregates
+-- Created: 2026-10-19 02:00:00
+-- Description: Flag intervals whose parts changed until they are merged again, so an interrupted import or revert leaves them for the next rollup run
+
+ALTER TABLE {{table "sensor_data_aggregates"}} ADD COLUMN dirty BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX idx_sensor_aggregates_dirty ON {{table "sensor_data_aggregates"}} (dirty);
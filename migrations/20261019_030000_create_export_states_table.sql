@@ -0,0 +1,25 @@
+-- Migration: Create export_states table
+-- Created: 2026-10-19 03:00:00
+-- Description: Keep the watermark of each named incremental export on the server, and index created_at where only the MySQL baseline did
+
+{{if eq driver "postgres"}}
+CREATE TABLE {{table "export_states"}} (
+    name VARCHAR(255) PRIMARY KEY,
+    watermark TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_created_at ON {{table "sensor_data"}} (created_at);
+{{else if eq driver "sqlite"}}
+CREATE TABLE {{table "export_states"}} (
+    name VARCHAR(255) PRIMARY KEY,
+    watermark DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_created_at ON {{table "sensor_data"}} (created_at);
+{{else}}
+CREATE TABLE {{table "export_states"}} (
+    name VARCHAR(255) PRIMARY KEY,
+    watermark DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+{{end}}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Annotation marks an event over a time range, such as a maintenance window,
+// for the sensors matching a glob pattern, so it can be shown alongside
+// their readings
+type Annotation struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	StartsAt      time.Time `gorm:"not null;index:idx_annotations_starts_at" json:"starts_at"`
+	EndsAt        time.Time `gorm:"not null" json:"ends_at"`                 // Equal to StartsAt for a point in time
+	SensorPattern string    `gorm:"not null;size:255" json:"sensor_pattern"` // Glob pattern, * for every sensor
+	Text          string    `gorm:"not null;size:1024" json:"text"`
+	Author        string    `gorm:"not null;size:255" json:"author"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName customizes the table name
+func (Annotation) TableName() string {
+	return TableName("annotations")
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// ExportState records where an incremental export continues: the readings
+// stored up to Watermark were returned by an earlier export of that name
+type ExportState struct {
+	Name      string    `gorm:"primaryKey;size:255" json:"name"`
+	Watermark time.Time `gorm:"not null" json:"watermark"` // Database time up to which every stored reading was exported
+	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// TableName customizes the table name
+func (ExportState) TableName() string {
+	return TableName("export_states")
+}
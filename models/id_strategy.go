@@ -0,0 +1,99 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ID strategies for sensor_data rows
+const (
+	IDAutoIncrement = "auto_increment" // Database-assigned sequential id
+	IDSnowflake     = "snowflake"      // Time-ordered 64-bit id assigned by the importer
+	IDComposite     = "composite"      // No id column; (timestamp, sensor_name) is the primary key
+)
+
+// idStrategy is the configured ID strategy of sensor_data
+var idStrategy = IDAutoIncrement
+
+// SetIDStrategy selects how sensor_data rows are keyed. node identifies this
+// importer in snowflake IDs so concurrent importers never collide.
+func SetIDStrategy(strategy string, node int64) {
+	if strategy == "" {
+		strategy = IDAutoIncrement
+	}
+	idStrategy = strategy
+	snowflakes = &snowflakeGenerator{node: node}
+}
+
+// IDStrategy returns the configured ID strategy of sensor_data
+func IDStrategy() string {
+	return idStrategy
+}
+
+// Snowflake IDs hold 41 bits of milliseconds since snowflakeEpoch, a 10-bit
+// node number and a 12-bit sequence within the millisecond
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+)
+
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// snowflakeGenerator issues increasing snowflake IDs
+type snowflakeGenerator struct {
+	mu       sync.Mutex
+	node     int64
+	lastTick int64
+	sequence int64
+}
+
+var snowflakes = &snowflakeGenerator{}
+
+// next returns the next ID, waiting for the next millisecond when the
+// sequence of the current one is exhausted
+func (g *snowflakeGenerator) next() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tick := time.Since(snowflakeEpoch).Milliseconds()
+	if tick < g.lastTick {
+		// The clock went backwards: keep issuing from the last tick
+		tick = g.lastTick
+	}
+	if tick == g.lastTick {
+		g.sequence = (g.sequence + 1) & (1<<snowflakeSequenceBits - 1)
+		if g.sequence == 0 {
+			for tick <= g.lastTick {
+				time.Sleep(time.Millisecond / 10)
+				tick = time.Since(snowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTick = tick
+
+	return uint64(tick)<<(snowflakeNodeBits+snowflakeSequenceBits) |
+		uint64(g.node)<<snowflakeSequenceBits |
+		uint64(g.sequence)
+}
+
+// BeforeCreate keys a new reading according to the ID strategy
+func (d *SensorData) BeforeCreate(tx *gorm.DB) error {
+	switch idStrategy {
+	case IDSnowflake:
+		if d.ID == 0 {
+			d.ID = uint(snowflakes.next())
+		}
+	case IDComposite:
+		// The table has no id column: read back a key column instead of the
+		// id GORM would otherwise request on PostgreSQL and SQLite
+		if _, ok := tx.Statement.Clauses["RETURNING"]; !ok {
+			tx.Statement.AddClause(clause.Returning{Columns: []clause.Column{{Name: "sensor_name"}}})
+		}
+	}
+	return nil
+}
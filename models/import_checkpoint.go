@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// ImportCheckpoint records how many readings of a partially imported file
+// were committed, so an interrupted import can resume after them
+type ImportCheckpoint struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FilePath      string    `gorm:"not null;size:1024" json:"file_path"`
+	SHA256        string    `gorm:"column:sha256;uniqueIndex:idx_import_checkpoints_sha256;not null;size:64" json:"sha256"`
+	CommittedRows int       `gorm:"not null" json:"committed_rows"`
+	UpdatedAt     time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// TableName customizes the table name
+func (ImportCheckpoint) TableName() string {
+	return TableName("import_checkpoints")
+}
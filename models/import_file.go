@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// ImportFile records a file that was imported, identified by the SHA-256 of
+// its contents, so later scans can skip it. Each entry is an import batch:
+// the readings it wrote reference it through import_file_id.
+type ImportFile struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FilePath    string    `gorm:"not null;size:1024" json:"file_path"`
+	SHA256      string    `gorm:"column:sha256;uniqueIndex:idx_import_files_sha256;not null;size:64" json:"sha256"`
+	Size        int64     `gorm:"not null" json:"size"`
+	ModifiedAt  time.Time `gorm:"not null" json:"modified_at"`
+	RecordCount int       `gorm:"not null" json:"record_count"`
+	ErrorCount  int       `gorm:"not null" json:"error_count"`
+	ImportedAt  time.Time `gorm:"not null" json:"imported_at"`
+	DurationMS  int64     `gorm:"not null" json:"duration_ms"`
+	Completed   bool      `gorm:"not null" json:"completed"` // False while the import is in progress or after it failed
+	// Tags holds the fields captured from the file name by scanner.filename_pattern as a JSON object
+	Tags *string `gorm:"size:1024" json:"tags,omitempty"`
+}
+
+// TableName customizes the table name
+func (ImportFile) TableName() string {
+	return TableName("import_files")
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// ImportRun records one run of an importing command, such as a scan, an
+// import or a watch session. The readings it wrote reference it through
+// source_run_id, and the file they came from through import_file_id.
+type ImportRun struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Command     string     `gorm:"not null;size:64" json:"command"`
+	Arguments   string     `gorm:"size:2048" json:"arguments"`
+	Host        string     `gorm:"size:255" json:"host"`
+	StartedAt   time.Time  `gorm:"not null;index:idx_import_runs_started_at" json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"` // Nil while the run is going on, or after it crashed
+	FileCount   int        `gorm:"not null" json:"files"`
+	FailedCount int        `gorm:"not null" json:"failed_files"`
+	RecordCount int        `gorm:"not null" json:"records"` // Readings written, existing readings skipped are not counted
+	ErrorCount  int        `gorm:"not null" json:"errors"`  // Parsing errors and validation violations in files
+}
+
+// TableName customizes the table name
+func (ImportRun) TableName() string {
+	return TableName("import_runs")
+}
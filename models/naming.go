@@ -0,0 +1,19 @@
+package models
+
+// Table name affixes applied to every model, so the importer's tables can
+// share a database with other applications
+var (
+	tablePrefix string
+	tableSuffix string
+)
+
+// SetTableNaming sets the prefix and suffix added to every table name
+func SetTableNaming(prefix, suffix string) {
+	tablePrefix = prefix
+	tableSuffix = suffix
+}
+
+// TableName returns the configured name of a table, e.g. "sensor_data"
+func TableName(base string) string {
+	return tablePrefix + base + tableSuffix
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// ReadingExclusion marks the readings of the sensors matching a glob pattern
+// within a time range as bad data. The readings stay in sensor_data for
+// audit, but exports skip them. A revoked exclusion is kept as a record.
+type ReadingExclusion struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	StartsAt      time.Time  `gorm:"not null;index:idx_reading_exclusions_range" json:"starts_at"`
+	EndsAt        time.Time  `gorm:"not null;index:idx_reading_exclusions_range" json:"ends_at"` // Inclusive
+	SensorPattern string     `gorm:"not null;size:255" json:"sensor_pattern"`                    // Glob pattern, * for every sensor
+	SensorLike    string     `gorm:"not null;size:512" json:"-"`                                 // SensorPattern as a LIKE pattern escaped with !
+	Reason        string     `gorm:"not null;size:1024" json:"reason"`
+	Author        string     `gorm:"not null;size:255" json:"author"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy     string     `gorm:"not null;size:255" json:"revoked_by,omitempty"`
+}
+
+// TableName customizes the table name
+func (ReadingExclusion) TableName() string {
+	return TableName("reading_exclusions")
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// SensorAggregate summarizes the readings of a sensor in one interval.
+// Sensors configured for pre-aggregation store these instead of their
+// readings. Each row merges the parts stored by the import batches covering
+// the interval; a dirty row waits to be merged again after they changed.
+type SensorAggregate struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	BucketStart     time.Time `gorm:"uniqueIndex:idx_sensor_aggregates_bucket;not null" json:"bucket_start"`
+	SensorName      string    `gorm:"uniqueIndex:idx_sensor_aggregates_bucket;not null;size:255" json:"sensor_name"`
+	IntervalSeconds int       `gorm:"uniqueIndex:idx_sensor_aggregates_bucket;not null" json:"interval_seconds"`
+	ReadingCount    int       `gorm:"not null" json:"count"`
+	MinValue        float64   `gorm:"not null" json:"min"`
+	MaxValue        float64   `gorm:"not null" json:"max"`
+	AvgValue        float64   `gorm:"not null" json:"avg"`
+	P50Value        *float64  `json:"p50,omitempty"` // Approximate percentiles, empty when they cannot be combined
+	P95Value        *float64  `json:"p95,omitempty"`
+	P99Value        *float64  `json:"p99,omitempty"`
+	Dirty           bool      `gorm:"not null;default:false;index:idx_sensor_aggregates_dirty" json:"dirty"` // Parts changed since the row was merged
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName customizes the table name
+func (SensorAggregate) TableName() string {
+	return TableName("sensor_data_aggregates")
+}
+
+// SensorAggregatePart is what one import batch contributed to an interval of
+// a sensor. Importing the file again replaces its part, reverting the batch
+// deletes it, and the interval in sensor_data_aggregates is merged from the
+// parts that remain.
+type SensorAggregatePart struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	BucketStart     time.Time `gorm:"uniqueIndex:idx_sensor_aggregate_parts_bucket;not null" json:"bucket_start"`
+	SensorName      string    `gorm:"uniqueIndex:idx_sensor_aggregate_parts_bucket;not null;size:255" json:"sensor_name"`
+	IntervalSeconds int       `gorm:"uniqueIndex:idx_sensor_aggregate_parts_bucket;not null" json:"interval_seconds"`
+	ImportFileID    uint      `gorm:"uniqueIndex:idx_sensor_aggregate_parts_bucket;index:idx_sensor_aggregate_parts_import_file;not null" json:"import_file_id"` // 0 for files imported without a batch
+	ReadingCount    int       `gorm:"not null" json:"count"`
+	MinValue        float64   `gorm:"not null" json:"min"`
+	MaxValue        float64   `gorm:"not null" json:"max"`
+	AvgValue        float64   `gorm:"not null" json:"avg"`
+	P50Value        *float64  `json:"p50,omitempty"`
+	P95Value        *float64  `json:"p95,omitempty"`
+	P99Value        *float64  `json:"p99,omitempty"`
+	Digest          []byte    `json:"-"` // t-digest of the readings; empty for intervals of pre-aggregated files
+	SourceRunID     *uint     `gorm:"index:idx_sensor_aggregate_parts_source_run" json:"source_run_id,omitempty"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName customizes the table name
+func (SensorAggregatePart) TableName() string {
+	return TableName("sensor_data_aggregate_parts")
+}
@@ -6,21 +6,68 @@ import (
 
 // SensorData represents sensor reading data
 type SensorData struct {
-	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	Timestamp  time.Time `gorm:"uniqueIndex:idx_timestamp_sensor;not null" json:"timestamp"`
-	SensorName string    `gorm:"uniqueIndex:idx_timestamp_sensor;not null;size:255" json:"sensor_name"`
-	Value      float64   `gorm:"not null" json:"value"`
-	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	ID               uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Timestamp        time.Time  `gorm:"uniqueIndex:idx_timestamp_sensor;not null" json:"timestamp"`
+	SensorName       string     `gorm:"uniqueIndex:idx_timestamp_sensor;not null;size:255" json:"sensor_name"`
+	Value            float64    `gorm:"not null" json:"value"`
+	SourceFile       *string    `gorm:"size:1024" json:"source_file,omitempty"`
+	SourceModifiedAt *time.Time `json:"source_modified_at,omitempty"`
+	ImportFileID     *uint      `gorm:"index:idx_sensor_data_import_file" json:"import_file_id,omitempty"`
+	SourceRunID      *uint      `gorm:"index:idx_sensor_data_source_run" json:"source_run_id,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime;index:idx_created_at" json:"created_at"`
 }
 
 // TableName customizes the table name
 func (SensorData) TableName() string {
-	return "sensor_data"
+	return TableName("sensor_data")
+}
+
+// SensorDataRaw represents a reading in the append-only ingest table.
+// It has no unique index so parallel imports never contend on it; the
+// compact command deduplicates it into sensor_data.
+type SensorDataRaw struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Timestamp        time.Time  `gorm:"not null" json:"timestamp"`
+	SensorName       string     `gorm:"not null;size:255" json:"sensor_name"`
+	Value            float64    `gorm:"not null" json:"value"`
+	SourceFile       *string    `gorm:"size:1024" json:"source_file,omitempty"`
+	SourceModifiedAt *time.Time `json:"source_modified_at,omitempty"`
+	ImportFileID     *uint      `json:"import_file_id,omitempty"`
+	SourceRunID      *uint      `json:"source_run_id,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName customizes the table name
+func (SensorDataRaw) TableName() string {
+	return TableName("sensor_data_raw")
+}
+
+// SensorDataConflict records a duplicate reading resolved by source precedence
+type SensorDataConflict struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Timestamp       time.Time `gorm:"not null" json:"timestamp"`
+	SensorName      string    `gorm:"not null;size:255" json:"sensor_name"`
+	KeptValue       float64   `gorm:"not null" json:"kept_value"`
+	DiscardedValue  float64   `gorm:"not null" json:"discarded_value"`
+	KeptSource      *string   `gorm:"size:1024" json:"kept_source,omitempty"`
+	DiscardedSource *string   `gorm:"size:1024" json:"discarded_source,omitempty"`
+	Policy          string    `gorm:"not null;size:32" json:"policy"`
+	ResolvedAt      time.Time `gorm:"autoCreateTime" json:"resolved_at"`
+}
+
+// TableName customizes the table name
+func (SensorDataConflict) TableName() string {
+	return TableName("sensor_data_conflicts")
 }
 
 // GetAllModels returns all models for migration
 func GetAllModels() []interface{} {
 	return []interface{}{
 		&SensorData{},
+		&SensorDataRaw{},
+		&SensorDataConflict{},
+		&ImportFile{},
+		&ImportCheckpoint{},
+		&SensorLastValue{},
 	}
 }
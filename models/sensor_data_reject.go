@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// SensorDataReject keeps a parsed reading that could not be inserted, with
+// the error, so it can be inspected and replayed with rejects:retry
+type SensorDataReject struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Timestamp     time.Time  `gorm:"not null" json:"timestamp"`
+	SensorName    string     `gorm:"not null;size:255" json:"sensor_name"`
+	Value         float64    `gorm:"not null" json:"value"`
+	SourceFile    string     `gorm:"not null;size:1024" json:"source_file"`
+	ImportFileID  *uint      `json:"import_file_id,omitempty"`
+	Error         string     `gorm:"not null;size:1024" json:"error"`
+	Attempts      int        `gorm:"not null" json:"attempts"` // Inserts tried, including the import
+	FailedAt      time.Time  `gorm:"autoCreateTime" json:"failed_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+}
+
+// TableName customizes the table name
+func (SensorDataReject) TableName() string {
+	return TableName("sensor_data_rejects")
+}
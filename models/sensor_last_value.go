@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// SensorLastValue caches the most recent reading of each sensor, maintained
+// during import so "latest value" lookups do not scan sensor_data
+type SensorLastValue struct {
+	SensorName string    `gorm:"primaryKey;size:255" json:"sensor_name"`
+	Timestamp  time.Time `gorm:"not null" json:"timestamp"`
+	Value      float64   `gorm:"not null" json:"value"`
+	UpdatedAt  time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// TableName customizes the table name
+func (SensorLastValue) TableName() string {
+	return TableName("sensor_last_values")
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// TailOffset records how far tail mode has imported a growing file, so it
+// continues after the imported lines when restarted
+type TailOffset struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FilePath   string    `gorm:"uniqueIndex:idx_tail_offsets_file_path;not null;size:768" json:"file_path"`
+	ByteOffset int64     `gorm:"not null" json:"byte_offset"`                            // Bytes imported, always at the end of a line
+	HeadSize   int       `gorm:"not null" json:"head_size"`                              // Bytes at the start of the file covered by HeadSHA256
+	HeadSHA256 string    `gorm:"column:head_sha256;not null;size:64" json:"head_sha256"` // Tells a replaced file from the one imported
+	UpdatedAt  time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// TableName customizes the table name
+func (TailOffset) TableName() string {
+	return TableName("tail_offsets")
+}
@@ -0,0 +1,160 @@
+package rollup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// digestCompression bounds the number of centroids of a t-digest to about
+// this many; larger values trade memory for accuracy
+const digestCompression = 100
+
+// digestVersion is the first byte of an encoded digest
+const digestVersion = 1
+
+// centroid is the mean of a run of neighbouring values and how many there were
+type centroid struct {
+	mean, weight float64
+}
+
+// Digest estimates quantiles of a stream of values in bounded memory, using
+// the merging t-digest of Dunning and Ertl. Centroids near the tails stay
+// small, so high percentiles remain accurate where the spikes are. Digests
+// of different parts of a stream merge into one of the whole stream.
+type Digest struct {
+	centroids []centroid
+	buffer    []centroid // Values added since the last merge
+	count     float64
+	min, max  float64
+}
+
+// NewDigest returns an empty digest
+func NewDigest() *Digest {
+	return &Digest{min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// Add records a value
+func (td *Digest) Add(value float64) {
+	td.addCentroid(centroid{mean: value, weight: 1}, value, value)
+}
+
+// Merge adds the values recorded by another digest
+func (td *Digest) Merge(other *Digest) {
+	other.merge()
+	for _, c := range other.centroids {
+		td.addCentroid(c, other.min, other.max)
+	}
+}
+
+// addCentroid buffers a centroid whose values lie between min and max
+func (td *Digest) addCentroid(c centroid, min, max float64) {
+	td.buffer = append(td.buffer, c)
+	td.count += c.weight
+	td.min = math.Min(td.min, min)
+	td.max = math.Max(td.max, max)
+	if len(td.buffer) >= 5*digestCompression {
+		td.merge()
+	}
+}
+
+// merge folds the buffered values into the centroids, growing each centroid
+// as far as the scale function allows at its position
+func (td *Digest) merge() {
+	if len(td.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(td.centroids)+len(td.buffer))
+	all = append(append(all, td.centroids...), td.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := all[:0]
+	current := all[0]
+	before := 0.0 // Weight of the centroids before current
+	limit := td.count * quantileLimit(0)
+	for _, next := range all[1:] {
+		if before+current.weight+next.weight <= limit {
+			current.weight += next.weight
+			current.mean += (next.mean - current.mean) * next.weight / current.weight
+			continue
+		}
+		before += current.weight
+		merged = append(merged, current)
+		limit = td.count * quantileLimit(before/td.count)
+		current = next
+	}
+	td.centroids = append(merged, current)
+	td.buffer = td.buffer[:0]
+}
+
+// quantileLimit returns the quantile up to which a centroid starting at
+// quantile q may grow, by the arcsine scale function k1
+func quantileLimit(q float64) float64 {
+	k := digestCompression/(2*math.Pi)*math.Asin(2*q-1) + 1
+	if k >= digestCompression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/digestCompression) + 1) / 2
+}
+
+// Quantile estimates the value below which the fraction q of the values
+// lies, interpolating between the centres of neighbouring centroids
+func (td *Digest) Quantile(q float64) float64 {
+	td.merge()
+	centroids := td.centroids
+	if len(centroids) == 0 {
+		return math.NaN()
+	}
+
+	target := q * td.count
+	first := centroids[0]
+	if target <= first.weight/2 {
+		return td.min + (first.mean-td.min)*target/(first.weight/2)
+	}
+	cumulative := 0.0
+	for i := 0; i < len(centroids)-1; i++ {
+		left := cumulative + centroids[i].weight/2
+		right := cumulative + centroids[i].weight + centroids[i+1].weight/2
+		if target <= right {
+			return centroids[i].mean + (centroids[i+1].mean-centroids[i].mean)*(target-left)/(right-left)
+		}
+		cumulative += centroids[i].weight
+	}
+	last := centroids[len(centroids)-1]
+	center := td.count - last.weight/2
+	return last.mean + (td.max-last.mean)*math.Min(1, (target-center)/(last.weight/2))
+}
+
+// MarshalBinary encodes the digest: a version byte, then the count, minimum
+// and maximum and the mean and weight of each centroid as little-endian
+// float64 values
+func (td *Digest) MarshalBinary() ([]byte, error) {
+	td.merge()
+	data := make([]byte, 1, 1+8*(3+2*len(td.centroids)))
+	data[0] = digestVersion
+	for _, value := range []float64{td.count, td.min, td.max} {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(value))
+	}
+	for _, c := range td.centroids {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(c.mean))
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(c.weight))
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a digest encoded by MarshalBinary
+func (td *Digest) UnmarshalBinary(data []byte) error {
+	if len(data) < 1+8*3 || data[0] != digestVersion || (len(data)-1)%16 != 8 {
+		return fmt.Errorf("invalid t-digest encoding")
+	}
+	values := make([]float64, (len(data)-1)/8)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[1+8*i:]))
+	}
+	*td = Digest{count: values[0], min: values[1], max: values[2]}
+	for i := 3; i < len(values); i += 2 {
+		td.centroids = append(td.centroids, centroid{mean: values[i], weight: values[i+1]})
+	}
+	return nil
+}
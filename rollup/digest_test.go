@@ -0,0 +1,95 @@
+package rollup
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// exactQuantile returns the value below which the fraction q of the sorted
+// values lies
+func exactQuantile(sorted []float64, q float64) float64 {
+	return sorted[min(int(q*float64(len(sorted))), len(sorted)-1)]
+}
+
+func TestDigestQuantileAccuracy(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	distributions := map[string]func() float64{
+		"uniform":     func() float64 { return random.Float64() * 100 },
+		"exponential": func() float64 { return random.ExpFloat64() * 10 },
+		"normal":      func() float64 { return 50 + random.NormFloat64()*5 },
+	}
+	for name, next := range distributions {
+		digest := NewDigest()
+		values := make([]float64, 50000)
+		for i := range values {
+			values[i] = next()
+			digest.Add(values[i])
+		}
+		sort.Float64s(values)
+
+		// The error is measured in ranks: the estimate must lie between the
+		// values a little below and above the quantile
+		for _, q := range []float64{0.01, 0.5, 0.95, 0.99, 0.999} {
+			tolerance := 0.01
+			if q < 0.05 || q > 0.95 {
+				tolerance = 0.002
+			}
+			got := digest.Quantile(q)
+			low, high := exactQuantile(values, q-tolerance), exactQuantile(values, q+tolerance)
+			if got < low || got > high {
+				t.Errorf("%s: quantile %v = %v, want between %v and %v", name, q, got, low, high)
+			}
+		}
+		if digest.Quantile(0) != values[0] || digest.Quantile(1) != values[len(values)-1] {
+			t.Errorf("%s: quantiles 0 and 1 = %v, %v; want the minimum and maximum", name, digest.Quantile(0), digest.Quantile(1))
+		}
+		if len(digest.centroids) > 2*digestCompression {
+			t.Errorf("%s: %d centroids, want at most %d", name, len(digest.centroids), 2*digestCompression)
+		}
+	}
+}
+
+func TestDigestMergeMatchesOneStream(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	whole := NewDigest()
+	parts := []*Digest{NewDigest(), NewDigest(), NewDigest()}
+	for i := 0; i < 30000; i++ {
+		value := random.ExpFloat64()
+		whole.Add(value)
+		parts[i%len(parts)].Add(value)
+	}
+	merged := NewDigest()
+	for _, part := range parts {
+		merged.Merge(part)
+	}
+
+	if merged.count != whole.count || merged.min != whole.min || merged.max != whole.max {
+		t.Errorf("merged %v values from %v to %v, want %v from %v to %v", merged.count, merged.min, merged.max, whole.count, whole.min, whole.max)
+	}
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		if got, want := merged.Quantile(q), whole.Quantile(q); math.Abs(got-want) > 0.02*want {
+			t.Errorf("quantile %v of the merged digests = %v, want about %v", q, got, want)
+		}
+	}
+}
+
+func TestDigestSmallInputs(t *testing.T) {
+	if q := NewDigest().Quantile(0.5); !math.IsNaN(q) {
+		t.Errorf("median of an empty digest = %v, want NaN", q)
+	}
+
+	digest := NewDigest()
+	digest.Add(7)
+	for _, q := range []float64{0, 0.5, 1} {
+		if got := digest.Quantile(q); got != 7 {
+			t.Errorf("quantile %v of a single value = %v, want 7", q, got)
+		}
+	}
+
+	p50, p95, p99 := Percentiles(digest)
+	if *p50 != 7 || *p95 != 7 || *p99 != 7 {
+		t.Errorf("percentiles = %v, %v, %v; want 7", *p50, *p95, *p99)
+	}
+}
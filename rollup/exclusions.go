@@ -0,0 +1,72 @@
+package rollup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// exclusion is an active exclusion with its sensor pattern compiled
+type exclusion struct {
+	startsAt, endsAt time.Time
+	sensors          *regexp.Regexp
+}
+
+// Exclusions are the active exclusions, which leave readings out of the
+// aggregates like they leave them out of queries
+type Exclusions []exclusion
+
+// LoadExclusions reads the active exclusions; none when the exclusions
+// table does not exist
+func LoadExclusions(db *gorm.DB) (Exclusions, error) {
+	if !db.Migrator().HasTable(&models.ReadingExclusion{}) {
+		return nil, nil
+	}
+	var rows []models.ReadingExclusion
+	if err := db.Where("revoked_at IS NULL").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read exclusions: %w", err)
+	}
+	exclusions := make(Exclusions, len(rows))
+	for i, row := range rows {
+		exclusions[i] = exclusion{startsAt: row.StartsAt, endsAt: row.EndsAt, sensors: globRegexp(row.SensorPattern)}
+	}
+	return exclusions, nil
+}
+
+// globRegexp matches what the LIKE pattern of an exclusion matches: * any
+// run of characters and ? any one character
+func globRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("^(?s:" + quoted + ")$")
+}
+
+// Covers reports whether a reading is excluded
+func (es Exclusions) Covers(sensor string, at time.Time) bool {
+	for _, e := range es {
+		if !at.Before(e.startsAt) && !at.After(e.endsAt) && e.sensors.MatchString(sensor) {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversInterval reports whether every reading an interval can hold is
+// excluded. An interval only partly excluded keeps its readings, which an
+// aggregate cannot tell apart.
+func (es Exclusions) CoversInterval(key Key) bool {
+	start := key.bucketStart()
+	end := start.Add(time.Duration(key.Interval) * time.Second)
+	for _, e := range es {
+		if !start.Before(e.startsAt) && !end.After(e.endsAt) && e.sensors.MatchString(key.Sensor) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+// Package rollup keeps sensor_data_aggregates in step with the parts the
+// import batches store in sensor_data_aggregate_parts: each interval of a
+// sensor is merged from the parts that cover it.
+package rollup
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Key identifies an interval of a sensor
+type Key struct {
+	Start    int64 // Unix seconds
+	Sensor   string
+	Interval int // Seconds
+}
+
+// KeyOf returns the interval a part covers
+func KeyOf(part models.SensorAggregatePart) Key {
+	return Key{Start: part.BucketStart.Unix(), Sensor: part.SensorName, Interval: part.IntervalSeconds}
+}
+
+// bucketStart returns the start of the interval as stored
+func (k Key) bucketStart() time.Time {
+	return time.Unix(k.Start, 0).UTC()
+}
+
+// SortKeys orders keys by start, sensor and interval, the order their rows
+// are locked in
+func SortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if a.Sensor != b.Sensor {
+			return a.Sensor < b.Sensor
+		}
+		return a.Interval < b.Interval
+	})
+}
+
+// bucketColumns are the unique key of sensor_data_aggregates
+var bucketColumns = []clause.Column{{Name: "bucket_start"}, {Name: "sensor_name"}, {Name: "interval_seconds"}}
+
+// MarkDirty flags the intervals in sensor_data_aggregates for Recompute,
+// adding rows for new intervals. Call it in the transaction that changes
+// their parts, before changing them: it also locks the rows, so
+// transactions changing the parts of an interval take turns with each other
+// and with Recompute.
+func MarkDirty(tx *gorm.DB, keys []Key, batchSize int) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	SortKeys(keys)
+	rows := make([]models.SensorAggregate, len(keys))
+	for i, key := range keys {
+		rows[i] = models.SensorAggregate{BucketStart: key.bucketStart(), SensorName: key.Sensor, IntervalSeconds: key.Interval, Dirty: true}
+	}
+	onConflict := clause.OnConflict{Columns: bucketColumns, DoUpdates: clause.AssignmentColumns([]string{"dirty"})}
+	if err := tx.Clauses(onConflict).CreateInBatches(rows, batchSize).Error; err != nil {
+		return fmt.Errorf("failed to mark aggregates dirty: %w", err)
+	}
+	return nil
+}
+
+// Recompute merges the parts of each interval into its row in
+// sensor_data_aggregates and clears its dirty flag. Intervals without parts,
+// or entirely covered by an active exclusion, are deleted. Each batchSize intervals are merged in a transaction of their
+// own, so an interval left dirty by a failure is merged by the next run.
+func Recompute(db *gorm.DB, keys []Key, batchSize int) error {
+	SortKeys(keys)
+	for start := 0; start < len(keys); start += batchSize {
+		chunk := keys[start:min(start+batchSize, len(keys))]
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return recompute(tx, chunk, batchSize)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecomputeDirty merges every interval flagged dirty, such as those of an
+// import interrupted before it merged them, and returns how many it merged
+func RecomputeDirty(db *gorm.DB, batchSize int) (int, error) {
+	merged := 0
+	var after *Key
+	for {
+		// Intervals flagged again behind the last one merged are left for the
+		// next run
+		query := db.Where("dirty = ?", true)
+		if after != nil {
+			start := after.bucketStart()
+			query = query.Where("bucket_start > ? OR (bucket_start = ? AND (sensor_name > ? OR (sensor_name = ? AND interval_seconds > ?)))",
+				start, start, after.Sensor, after.Sensor, after.Interval)
+		}
+		var rows []models.SensorAggregate
+		if err := query.Order("bucket_start, sensor_name, interval_seconds").Limit(batchSize).Find(&rows).Error; err != nil {
+			return merged, fmt.Errorf("failed to list dirty aggregates: %w", err)
+		}
+		if len(rows) == 0 {
+			return merged, nil
+		}
+		keys := make([]Key, len(rows))
+		for i, row := range rows {
+			keys[i] = Key{Start: row.BucketStart.Unix(), Sensor: row.SensorName, Interval: row.IntervalSeconds}
+		}
+		if err := Recompute(db, keys, batchSize); err != nil {
+			return merged, err
+		}
+		merged += len(keys)
+		after = &keys[len(keys)-1]
+	}
+}
+
+// recompute merges the intervals in a transaction, flagging them dirty
+// first to wait for transactions still changing their parts
+func recompute(tx *gorm.DB, keys []Key, batchSize int) error {
+	if err := MarkDirty(tx, keys, batchSize); err != nil {
+		return err
+	}
+	parts, err := loadParts(tx, keys)
+	if err != nil {
+		return err
+	}
+	exclusions, err := LoadExclusions(tx)
+	if err != nil {
+		return err
+	}
+
+	var rows []models.SensorAggregate
+	var empty []Key
+	for _, key := range keys {
+		if len(parts[key]) == 0 || exclusions.CoversInterval(key) {
+			empty = append(empty, key)
+			continue
+		}
+		row, err := Merge(parts[key])
+		if err != nil {
+			return fmt.Errorf("failed to merge the parts of %s at %s: %w", key.Sensor, key.bucketStart().Format(time.RFC3339), err)
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) > 0 {
+		onConflict := clause.OnConflict{
+			Columns:   bucketColumns,
+			DoUpdates: clause.AssignmentColumns([]string{"reading_count", "min_value", "max_value", "avg_value", "p50_value", "p95_value", "p99_value", "dirty"}),
+		}
+		if err := tx.Clauses(onConflict).CreateInBatches(rows, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to store aggregates: %w", err)
+		}
+	}
+	for _, key := range empty {
+		if err := tx.Where("bucket_start = ? AND sensor_name = ? AND interval_seconds = ?", key.bucketStart(), key.Sensor, key.Interval).
+			Delete(&models.SensorAggregate{}).Error; err != nil {
+			return fmt.Errorf("failed to delete aggregates: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadParts reads the parts of the intervals, by interval. The parts of each
+// sensor and interval length are read by the range of their starts.
+func loadParts(tx *gorm.DB, keys []Key) (map[Key][]models.SensorAggregatePart, error) {
+	type series struct {
+		sensor   string
+		interval int
+	}
+	ranges := make(map[series][2]int64)
+	wanted := make(map[Key]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+		s := series{sensor: key.Sensor, interval: key.Interval}
+		r, ok := ranges[s]
+		if !ok {
+			r = [2]int64{key.Start, key.Start}
+		}
+		ranges[s] = [2]int64{min(r[0], key.Start), max(r[1], key.Start)}
+	}
+
+	parts := make(map[Key][]models.SensorAggregatePart, len(keys))
+	for s, r := range ranges {
+		var found []models.SensorAggregatePart
+		if err := tx.Where("sensor_name = ? AND interval_seconds = ? AND bucket_start BETWEEN ? AND ?",
+			s.sensor, s.interval, time.Unix(r[0], 0).UTC(), time.Unix(r[1], 0).UTC()).
+			Order("import_file_id").Find(&found).Error; err != nil {
+			return nil, fmt.Errorf("failed to read aggregate parts: %w", err)
+		}
+		for _, part := range found {
+			if key := KeyOf(part); wanted[key] {
+				parts[key] = append(parts[key], part)
+			}
+		}
+	}
+	return parts, nil
+}
+
+// Merge combines the parts of one interval. Counts add up, the minimum and
+// maximum are those of all parts and the average is weighted by the counts;
+// a part without a count, from a pre-aggregated file, weighs as one reading.
+// Percentiles come from the merged t-digests, so they are left empty when a
+// part of several has none.
+func Merge(parts []models.SensorAggregatePart) (models.SensorAggregate, error) {
+	row, _, err := merge(parts)
+	return row, err
+}
+
+// MergeParts combines parts of one interval into a single part, keeping the
+// merged t-digest when every part has one
+func MergeParts(parts []models.SensorAggregatePart) (models.SensorAggregatePart, error) {
+	row, digest, err := merge(parts)
+	if err != nil {
+		return models.SensorAggregatePart{}, err
+	}
+	part := parts[len(parts)-1]
+	part.ReadingCount, part.MinValue, part.MaxValue, part.AvgValue = row.ReadingCount, row.MinValue, row.MaxValue, row.AvgValue
+	part.P50Value, part.P95Value, part.P99Value = row.P50Value, row.P95Value, row.P99Value
+	part.Digest = nil
+	if digest != nil {
+		if part.Digest, err = digest.MarshalBinary(); err != nil {
+			return models.SensorAggregatePart{}, err
+		}
+	}
+	return part, nil
+}
+
+// merge combines the parts of one interval and their t-digests; the digest
+// is nil when a part has none
+func merge(parts []models.SensorAggregatePart) (models.SensorAggregate, *Digest, error) {
+	first := parts[0]
+	row := models.SensorAggregate{
+		BucketStart:     first.BucketStart,
+		SensorName:      first.SensorName,
+		IntervalSeconds: first.IntervalSeconds,
+		MinValue:        math.Inf(1),
+		MaxValue:        math.Inf(-1),
+	}
+	if len(parts) == 1 {
+		row.P50Value, row.P95Value, row.P99Value = first.P50Value, first.P95Value, first.P99Value
+	}
+
+	var weighted, weights float64
+	digest := NewDigest()
+	for _, part := range parts {
+		row.ReadingCount += part.ReadingCount
+		row.MinValue = math.Min(row.MinValue, part.MinValue)
+		row.MaxValue = math.Max(row.MaxValue, part.MaxValue)
+		weight := float64(max(part.ReadingCount, 1))
+		weighted += part.AvgValue * weight
+		weights += weight
+
+		if digest == nil || len(part.Digest) == 0 {
+			digest = nil
+			continue
+		}
+		var partDigest Digest
+		if err := partDigest.UnmarshalBinary(part.Digest); err != nil {
+			return row, nil, err
+		}
+		digest.Merge(&partDigest)
+	}
+	row.AvgValue = weighted / weights
+
+	if len(parts) > 1 && digest != nil {
+		row.P50Value, row.P95Value, row.P99Value = Percentiles(digest)
+	}
+	return row, digest, nil
+}
+
+// Percentiles estimates the median, 95th and 99th percentile of a digest
+func Percentiles(digest *Digest) (p50, p95, p99 *float64) {
+	percentile := func(p float64) *float64 {
+		value := digest.Quantile(p / 100)
+		return &value
+	}
+	return percentile(50), percentile(95), percentile(99)
+}
@@ -0,0 +1,96 @@
+package rollup
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+// part returns a part of batch with the readings, with their t-digest
+func part(t *testing.T, batch uint, values ...float64) models.SensorAggregatePart {
+	t.Helper()
+	p := models.SensorAggregatePart{
+		BucketStart:     time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		SensorName:      "vib_01",
+		IntervalSeconds: 60,
+		ImportFileID:    batch,
+		MinValue:        math.Inf(1),
+		MaxValue:        math.Inf(-1),
+	}
+	digest := NewDigest()
+	var sum float64
+	for _, value := range values {
+		digest.Add(value)
+		sum += value
+		p.ReadingCount++
+		p.MinValue = math.Min(p.MinValue, value)
+		p.MaxValue = math.Max(p.MaxValue, value)
+	}
+	p.AvgValue = sum / float64(p.ReadingCount)
+	p.P50Value, p.P95Value, p.P99Value = Percentiles(digest)
+	var err error
+	if p.Digest, err = digest.MarshalBinary(); err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	return p
+}
+
+func TestMerge(t *testing.T) {
+	var low, high []float64
+	for i := 1; i <= 900; i++ {
+		low = append(low, float64(i%100))
+	}
+	for i := 0; i < 100; i++ {
+		high = append(high, 1000)
+	}
+
+	row, err := Merge([]models.SensorAggregatePart{part(t, 1, low...), part(t, 2, high...)})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if row.ReadingCount != 1000 || row.MinValue != 0 || row.MaxValue != 1000 {
+		t.Errorf("merged = %+v, want 1000 readings from 0 to 1000", row)
+	}
+	if want := (49.5*900 + 1000*100) / 1000; math.Abs(row.AvgValue-want) > 1e-9 {
+		t.Errorf("avg = %v, want %v weighted by the counts", row.AvgValue, want)
+	}
+	// A tenth of the readings are spikes, so the median stays low and the
+	// 95th percentile is a spike
+	if row.P50Value == nil || *row.P50Value > 60 || row.P95Value == nil || *row.P95Value != 1000 {
+		t.Errorf("percentiles = %v, %v; want the median of the low readings and a spike", row.P50Value, row.P95Value)
+	}
+
+	// A part of a pre-aggregated file has no digest to merge
+	summary := models.SensorAggregatePart{BucketStart: row.BucketStart, SensorName: "vib_01", IntervalSeconds: 60, MinValue: 5, MaxValue: 5, AvgValue: 5}
+	if row, err = Merge([]models.SensorAggregatePart{part(t, 1, 1, 2, 3), summary}); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if row.ReadingCount != 3 || row.AvgValue != 2.75 || row.P50Value != nil {
+		t.Errorf("merged with a summary = %+v, want 3 readings averaging 2.75 and no percentiles", row)
+	}
+}
+
+func TestDigestEncoding(t *testing.T) {
+	digest := NewDigest()
+	for i := 0; i < 10000; i++ {
+		digest.Add(float64(i))
+	}
+	data, err := digest.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var decoded Digest
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	for _, q := range []float64{0, 0.5, 0.99, 1} {
+		if got, want := decoded.Quantile(q), digest.Quantile(q); got != want {
+			t.Errorf("quantile %v = %v after decoding, want %v", q, got, want)
+		}
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("decoding a truncated digest succeeded")
+	}
+}
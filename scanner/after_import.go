@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+)
+
+// Actions applied to source files after they were imported
+const (
+	AfterImportNone    = "none"
+	AfterImportArchive = "archive"
+	AfterImportRename  = "rename"
+	AfterImportDelete  = "delete"
+)
+
+// afterImport moves, renames or deletes source files once they are imported
+// so the intake directory only holds files still to be processed
+type afterImport struct {
+	action     string
+	archiveDir string
+	suffix     string
+}
+
+func newAfterImport(cfg config.AfterImportConfig) afterImport {
+	action := afterImport{action: cfg.Action, archiveDir: cfg.ArchiveDir, suffix: cfg.Suffix}
+	if action.action == "" {
+		action.action = AfterImportNone
+	}
+	if action.archiveDir == "" {
+		action.archiveDir = "archive"
+	}
+	if action.suffix == "" {
+		action.suffix = ".imported"
+	}
+	return action
+}
+
+func (a afterImport) enabled() bool {
+	return a.action != AfterImportNone
+}
+
+// archivePath returns the archive directory for a scanned directory
+func (a afterImport) archivePath(directoryPath string) string {
+	if filepath.IsAbs(a.archiveDir) {
+		return a.archiveDir
+	}
+	return filepath.Join(directoryPath, a.archiveDir)
+}
+
+// isArchiveDir reports whether a directory found while scanning is the
+// archive, whose files were already imported
+func (a afterImport) isArchiveDir(directoryPath, dir string) bool {
+	return a.action == AfterImportArchive && filepath.Clean(dir) == filepath.Clean(a.archivePath(directoryPath))
+}
+
+// apply runs the action on every source file whose jobs all succeeded. Files
+// skipped as already imported count as successful, files not started because
+// the scan was cancelled do not; all members of a ZIP archive must succeed
+// before the archive is touched.
+func (a afterImport) apply(directoryPath string, results []ProcessResult) {
+	if !a.enabled() {
+		return
+	}
+
+	var paths []string
+	succeeded := make(map[string]bool)
+	for _, result := range results {
+		ok, seen := succeeded[result.FilePath]
+		if !seen {
+			paths = append(paths, result.FilePath)
+			ok = true
+		}
+		succeeded[result.FilePath] = ok && result.Error == nil && !result.Cancelled
+	}
+
+	for _, path := range paths {
+		if !succeeded[path] {
+			continue
+		}
+		if err := a.applyTo(directoryPath, path); err != nil {
+			logger.Warnf("Failed to %s %s: %v\n", a.action, path, err)
+		}
+	}
+}
+
+// applyTo runs the action on one source file
+func (a afterImport) applyTo(directoryPath, path string) error {
+	switch a.action {
+	case AfterImportDelete:
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		logger.Printf("Deleted %s\n", path)
+
+	case AfterImportRename:
+		target := availablePath(path + a.suffix)
+		if err := os.Rename(path, target); err != nil {
+			return err
+		}
+		logger.Printf("Renamed %s to %s\n", path, target)
+
+	case AfterImportArchive:
+		relPath, err := filepath.Rel(directoryPath, path)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			relPath = filepath.Base(path)
+		}
+		target := availablePath(filepath.Join(a.archivePath(directoryPath), relPath))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := moveFile(path, target); err != nil {
+			return err
+		}
+		logger.Printf("Archived %s to %s\n", path, target)
+	}
+	return nil
+}
+
+// availablePath returns path, or path with a timestamp before its extension
+// when a file of that name already exists, so nothing is overwritten
+func availablePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + time.Now().Format("20060102-150405.000") + ext
+}
+
+// moveFile renames a file, copying it when the target is on another filesystem
+func moveFile(source, target string) error {
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(target)
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+
+	in.Close()
+	return os.Remove(source)
+}
@@ -0,0 +1,242 @@
+package scanner
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+	"sensor_data_import/rollup"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// aggregationRule stores the readings of sensors matching a glob pattern as
+// per-interval aggregates
+type aggregationRule struct {
+	sensors  string
+	interval time.Duration
+}
+
+// aggregationRules selects the aggregated sensors; the first matching rule
+// applies. A nil slice stores every reading.
+type aggregationRules []aggregationRule
+
+// newAggregationRules converts the configured aggregations
+func newAggregationRules(configs []config.AggregationConfig) (aggregationRules, error) {
+	var rules aggregationRules
+	for i, c := range configs {
+		if _, err := path.Match(c.Sensors, ""); err != nil || c.Sensors == "" {
+			return nil, fmt.Errorf("aggregations[%d]: invalid sensors pattern %q", i, c.Sensors)
+		}
+		interval, err := time.ParseDuration(c.Interval)
+		if err != nil || interval < time.Second || interval%time.Second != 0 {
+			return nil, fmt.Errorf("aggregations[%d]: invalid interval %q (expected whole seconds such as 1m)", i, c.Interval)
+		}
+		rules = append(rules, aggregationRule{sensors: c.Sensors, interval: interval})
+	}
+	return rules, nil
+}
+
+// intervalFor returns the aggregation interval of a sensor, or 0 when its
+// readings are stored
+func (ar aggregationRules) intervalFor(sensorName string) time.Duration {
+	for _, rule := range ar {
+		if matched, _ := path.Match(rule.sensors, sensorName); matched {
+			return rule.interval
+		}
+	}
+	return 0
+}
+
+// aggregateKey identifies the bucket of a reading
+type aggregateKey struct {
+	sensorName string
+	start      int64 // Unix seconds
+	interval   time.Duration
+}
+
+// aggregateBucket accumulates the readings of one bucket
+type aggregateBucket struct {
+	count    int
+	min, max float64
+	sum      float64
+	digest   *rollup.Digest // Estimates the percentiles
+}
+
+// aggregate folds the readings of aggregated sensors into the buckets of the
+// file and returns the readings to store individually. Readings covered by
+// an active exclusion are stored individually too, so the aggregates leave
+// them out and revoking the exclusion brings them back.
+func (cs *CSVScanner) aggregate(fi *fileImport, data []models.SensorData, result *ProcessResult) ([]models.SensorData, error) {
+	if len(cs.aggregations) == 0 {
+		return data, nil
+	}
+	if !fi.exclusionsLoaded {
+		exclusions, err := rollup.LoadExclusions(cs.db)
+		if err != nil {
+			return nil, err
+		}
+		fi.exclusions, fi.exclusionsLoaded = exclusions, true
+	}
+
+	kept := data[:0]
+	for _, reading := range data {
+		interval := cs.aggregations.intervalFor(reading.SensorName)
+		if interval == 0 || fi.exclusions.Covers(reading.SensorName, reading.Timestamp) {
+			kept = append(kept, reading)
+			continue
+		}
+
+		if fi.aggregates == nil {
+			fi.aggregates = make(map[aggregateKey]*aggregateBucket)
+		}
+		// Buckets are aligned to the Unix epoch; Truncate aligns them to year 1,
+		// which differs for intervals that do not divide a day
+		unix, seconds := reading.Timestamp.Unix(), int64(interval/time.Second)
+		key := aggregateKey{sensorName: reading.SensorName, start: unix - unix%seconds, interval: interval}
+		bucket, ok := fi.aggregates[key]
+		if !ok {
+			bucket = &aggregateBucket{min: math.Inf(1), max: math.Inf(-1), digest: rollup.NewDigest()}
+			fi.aggregates[key] = bucket
+		}
+		bucket.count++
+		bucket.sum += reading.Value
+		bucket.min = math.Min(bucket.min, reading.Value)
+		bucket.max = math.Max(bucket.max, reading.Value)
+		bucket.digest.Add(reading.Value)
+		result.AggregatedCount++
+	}
+	return kept, nil
+}
+
+// storeAggregates writes the buckets of a file, or the intervals of a
+// pre-aggregated file, once all its rows were seen. They are stored as the
+// part of the import batch in each interval, so importing the same file
+// again replaces its part instead of counting its readings twice, and the
+// interval in sensor_data_aggregates is flagged dirty and merged again from
+// the parts of every batch covering it once they are committed. Files
+// imported without a batch share one part per interval that adds up their
+// readings.
+func (cs *CSVScanner) storeAggregates(fi *fileImport) error {
+	if len(fi.aggregates) == 0 && len(fi.summaries) == 0 {
+		return nil
+	}
+
+	parts := make([]models.SensorAggregatePart, 0, len(fi.aggregates)+len(fi.summaries))
+	for key, bucket := range fi.aggregates {
+		digest, err := bucket.digest.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("failed to encode the percentiles of %s: %w", key.sensorName, err)
+		}
+		part := models.SensorAggregatePart{
+			BucketStart:     time.Unix(key.start, 0).UTC(),
+			SensorName:      key.sensorName,
+			IntervalSeconds: int(key.interval / time.Second),
+			ReadingCount:    bucket.count,
+			MinValue:        bucket.min,
+			MaxValue:        bucket.max,
+			AvgValue:        bucket.sum / float64(bucket.count),
+			Digest:          digest,
+		}
+		part.P50Value, part.P95Value, part.P99Value = rollup.Percentiles(bucket.digest)
+		parts = append(parts, part)
+	}
+	parts = append(parts, fi.summaries...)
+	runID := cs.run.id()
+	for i := range parts {
+		parts[i].ImportFileID = fi.batchID
+		if runID != 0 {
+			parts[i].SourceRunID = &runID
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		a, b := rollup.KeyOf(parts[i]), rollup.KeyOf(parts[j])
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if a.Sensor != b.Sensor {
+			return a.Sensor < b.Sensor
+		}
+		return a.Interval < b.Interval
+	})
+
+	// A file listing an interval twice keeps its last row
+	unique := parts[:0]
+	keys := make([]rollup.Key, 0, len(parts))
+	for _, part := range parts {
+		key := rollup.KeyOf(part)
+		if n := len(unique); n > 0 && keys[n-1] == key {
+			unique[n-1] = part
+			continue
+		}
+		unique = append(unique, part)
+		keys = append(keys, key)
+	}
+	parts = unique
+
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		if err := rollup.MarkDirty(tx, keys, cs.batchSize); err != nil {
+			return err
+		}
+		if fi.batchID == 0 {
+			if err := addToUnbatchedParts(tx, parts, keys); err != nil {
+				return err
+			}
+		}
+		onConflict := clause.OnConflict{
+			Columns: []clause.Column{{Name: "bucket_start"}, {Name: "sensor_name"}, {Name: "interval_seconds"}, {Name: "import_file_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reading_count", "min_value", "max_value", "avg_value",
+				"p50_value", "p95_value", "p99_value", "digest", "source_run_id"}),
+		}
+		if err := tx.Clauses(onConflict).CreateInBatches(parts, cs.batchSize).Error; err != nil {
+			return fmt.Errorf("failed to store aggregates: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fi.aggregates = nil
+	fi.summaries = nil
+
+	// The parts are stored; intervals not merged now stay dirty for the next
+	// rollup run
+	if err := rollup.Recompute(cs.db, keys, cs.batchSize); err != nil {
+		logger.Warnf("%s: aggregates left dirty, run aggregates:rollup to merge them: %v\n", fi.job.FileName, err)
+	}
+	return nil
+}
+
+// addToUnbatchedParts merges the parts of a file imported without a batch
+// with the parts earlier such files stored in the same intervals, which
+// cannot be told apart to be replaced
+func addToUnbatchedParts(tx *gorm.DB, parts []models.SensorAggregatePart, keys []rollup.Key) error {
+	var stored []models.SensorAggregatePart
+	if err := tx.Where("import_file_id = 0 AND bucket_start BETWEEN ? AND ?",
+		parts[0].BucketStart, parts[len(parts)-1].BucketStart).Find(&stored).Error; err != nil {
+		return fmt.Errorf("failed to read aggregates: %w", err)
+	}
+	earlier := make(map[rollup.Key]models.SensorAggregatePart, len(stored))
+	for _, part := range stored {
+		earlier[rollup.KeyOf(part)] = part
+	}
+	for i, key := range keys {
+		part, ok := earlier[key]
+		if !ok {
+			continue
+		}
+		merged, err := rollup.MergeParts([]models.SensorAggregatePart{part, parts[i]})
+		if err != nil {
+			return fmt.Errorf("failed to merge aggregates of %s: %w", key.Sensor, err)
+		}
+		merged.ID = 0
+		parts[i] = merged
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+// aggregateFile folds the readings into the aggregates of a file of the
+// batch and stores them
+func aggregateFile(t *testing.T, cs *CSVScanner, batchID uint, readings ...models.SensorData) {
+	t.Helper()
+	fi := &fileImport{batchID: batchID}
+	if kept, err := cs.aggregate(fi, readings, &ProcessResult{}); err != nil || len(kept) != 0 {
+		t.Fatalf("%d readings were kept, %v; want all aggregated", len(kept), err)
+	}
+	if err := cs.storeAggregates(fi); err != nil {
+		t.Fatalf("storeAggregates: %v", err)
+	}
+}
+
+func TestAggregatesAlignedToEpoch(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.SensorAggregate{}, &models.SensorAggregatePart{}); err != nil {
+		t.Fatalf("create aggregate tables: %v", err)
+	}
+	cs := NewCSVScanner(db)
+	if err := cs.Configure(config.ScannerConfig{Aggregations: []config.AggregationConfig{{Sensors: "vib_*", Interval: "7m"}}}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+
+	// 2025-09-01 00:00 UTC is 29,278,080 minutes after the epoch, 6 minutes
+	// into a 7-minute bucket
+	midnight := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	aggregateFile(t, cs, 1,
+		models.SensorData{Timestamp: midnight, SensorName: "vib_01", Value: 1},
+		models.SensorData{Timestamp: midnight.Add(30 * time.Second), SensorName: "vib_01", Value: 3},
+		models.SensorData{Timestamp: midnight.Add(time.Minute), SensorName: "vib_01", Value: 10},
+	)
+
+	var stored []models.SensorAggregate
+	if err := db.Order("bucket_start").Find(&stored).Error; err != nil {
+		t.Fatalf("read aggregates: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("stored %d aggregates, want 2", len(stored))
+	}
+	for i, want := range []time.Time{midnight.Add(-6 * time.Minute), midnight.Add(time.Minute)} {
+		if start := stored[i].BucketStart; !start.Equal(want) || start.Unix()%(7*60) != 0 {
+			t.Errorf("bucket %d starts at %v, want %v", i, start, want)
+		}
+	}
+	if stored[0].ReadingCount != 2 || stored[0].AvgValue != 2 {
+		t.Errorf("first bucket = %+v, want 2 readings averaging 2", stored[0])
+	}
+
+	// Another batch covering the interval adds to it; importing the first
+	// batch again replaces its part instead of counting it twice
+	aggregateFile(t, cs, 2, models.SensorData{Timestamp: midnight, SensorName: "vib_01", Value: 5})
+	aggregateFile(t, cs, 1,
+		models.SensorData{Timestamp: midnight, SensorName: "vib_01", Value: 1},
+		models.SensorData{Timestamp: midnight.Add(30 * time.Second), SensorName: "vib_01", Value: 3},
+		models.SensorData{Timestamp: midnight.Add(time.Minute), SensorName: "vib_01", Value: 10},
+	)
+	stored = nil
+	if err := db.Order("bucket_start").Find(&stored).Error; err != nil {
+		t.Fatalf("read aggregates: %v", err)
+	}
+	if len(stored) != 2 || stored[0].ReadingCount != 3 || stored[0].AvgValue != 3 || stored[0].MinValue != 1 || stored[0].MaxValue != 5 {
+		t.Errorf("aggregates after the second batch = %+v, want 3 readings from 1 to 5 in the first interval", stored)
+	}
+	if p99 := stored[0].P99Value; p99 == nil || *p99 < 3 || *p99 > 5 {
+		t.Errorf("p99 of the first interval = %v, want one merged from both batches", p99)
+	}
+
+	// Files imported without a batch add up
+	aggregateFile(t, cs, 0, models.SensorData{Timestamp: midnight, SensorName: "vib_01", Value: 7})
+	aggregateFile(t, cs, 0, models.SensorData{Timestamp: midnight, SensorName: "vib_01", Value: 9})
+	stored = nil
+	if err := db.Order("bucket_start").Find(&stored).Error; err != nil {
+		t.Fatalf("read aggregates: %v", err)
+	}
+	if stored[0].ReadingCount != 5 || stored[0].MaxValue != 9 {
+		t.Errorf("first interval = %+v, want 5 readings up to 9", stored[0])
+	}
+}
+
+// Readings under an active exclusion are stored individually, so the
+// aggregates leave them out and revoking the exclusion brings them back
+func TestAggregationSkipsExcludedReadings(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.SensorAggregate{}, &models.SensorAggregatePart{}, &models.ReadingExclusion{}); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	midnight := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	insertRows(t, db, models.ReadingExclusion{StartsAt: midnight, EndsAt: midnight, SensorPattern: "vib_*", SensorLike: "vib!_%", Reason: "spike"})
+	cs := NewCSVScanner(db)
+	if err := cs.Configure(config.ScannerConfig{Aggregations: []config.AggregationConfig{{Sensors: "vib_*", Interval: "1h"}}}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+
+	fi := &fileImport{}
+	kept, err := cs.aggregate(fi, []models.SensorData{
+		{Timestamp: midnight, SensorName: "vib_01", Value: 900},
+		{Timestamp: midnight.Add(time.Minute), SensorName: "vib_01", Value: 1},
+	}, &ProcessResult{})
+	if err != nil {
+		t.Fatalf("aggregate: %v", err)
+	}
+	if len(kept) != 1 || kept[0].Value != 900 {
+		t.Errorf("kept %+v, want the excluded reading", kept)
+	}
+	if len(fi.aggregates) != 1 {
+		t.Errorf("%d buckets, want 1 with the other reading", len(fi.aggregates))
+	}
+}
+
+func TestAggregatesEstimatePercentiles(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.SensorAggregate{}, &models.SensorAggregatePart{}); err != nil {
+		t.Fatalf("create aggregate tables: %v", err)
+	}
+	cs := NewCSVScanner(db)
+	if err := cs.Configure(config.ScannerConfig{Aggregations: []config.AggregationConfig{{Sensors: "vib_*", Interval: "1h"}}}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+
+	// Readings 1 to 1000 in shuffled order, one a second
+	midnight := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	readings := make([]models.SensorData, 1000)
+	for i := range readings {
+		readings[i] = models.SensorData{Timestamp: midnight.Add(time.Duration(i) * time.Second), SensorName: "vib_01", Value: float64((i*379)%1000 + 1)}
+	}
+	aggregateFile(t, cs, 1, readings...)
+
+	var stored models.SensorAggregate
+	if err := db.First(&stored).Error; err != nil {
+		t.Fatalf("read aggregate: %v", err)
+	}
+	for _, p := range []struct {
+		name  string
+		value *float64
+		want  float64
+	}{{"p50", stored.P50Value, 500}, {"p95", stored.P95Value, 950}, {"p99", stored.P99Value, 990}} {
+		if p.value == nil || *p.value < p.want-5 || *p.value > p.want+5 {
+			t.Errorf("%s = %v, want about %v", p.name, p.value, p.want)
+		}
+	}
+}
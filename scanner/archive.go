@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isZipFile reports whether a file name looks like a ZIP archive
+func isZipFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".zip")
+}
+
+// listZipMembers returns a job for every CSV or JSON Lines member of a ZIP archive.
+// relPath is the archive path relative to the scanned directory.
+func listZipMembers(archivePath, relPath string) ([]FileJob, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive %s: %w", relPath, err)
+	}
+	defer archive.Close()
+
+	var jobs []FileJob
+	for _, member := range archive.File {
+		name := memberName(member.Name)
+		if member.FileInfo().IsDir() || !isDataFile(path.Base(name)) {
+			continue
+		}
+		jobs = append(jobs, FileJob{
+			FilePath: archivePath,
+			FileName: filepath.ToSlash(relPath) + "/" + name,
+			Dir:      filepath.Dir(relPath),
+			Member:   member.Name,
+			Size:     int64(member.CompressedSize64),
+		})
+	}
+
+	return jobs, nil
+}
+
+// archiveMemberReader closes the member stream and its archive together
+type archiveMemberReader struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+// Close closes the member stream and the archive
+func (r *archiveMemberReader) Close() error {
+	err := r.ReadCloser.Close()
+	if closeErr := r.archive.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openZipMember opens a single member of a ZIP archive for streaming
+func openZipMember(archivePath, memberName string) (io.ReadCloser, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range archive.File {
+		if member.Name != memberName {
+			continue
+		}
+		stream, err := member.Open()
+		if err != nil {
+			archive.Close()
+			return nil, err
+		}
+		reader := &archiveMemberReader{ReadCloser: stream, archive: archive}
+		return wrapDecompressor(reader, reader, memberName)
+	}
+
+	archive.Close()
+	return nil, fmt.Errorf("archive member not found: %s", memberName)
+}
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"sensor_data_import/logger"
+)
+
+// BenchmarkResult summarizes a benchmark run over a sample directory
+type BenchmarkResult struct {
+	Files      int
+	Failed     int
+	Readings   int
+	Errors     int
+	Duration   time.Duration // Wall clock time of the import, from first read to last commit
+	Timings    StageTimings  // Time by stage, summed over all workers
+	RolledBack bool          // The readings were written in a transaction that was rolled back
+}
+
+// ReadingsPerSecond returns the end-to-end import throughput
+func (r BenchmarkResult) ReadingsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Readings) / r.Duration.Seconds()
+}
+
+// Benchmark imports the data files of a sample directory with the configured
+// settings and measures the end-to-end throughput. Files are imported even if
+// the import manifest lists them. After-import actions and the changelog are
+// skipped, and rejected rows go to a temporary directory, so the sample stays
+// unchanged.
+//
+// With rollback, the whole run is one database transaction that is rolled
+// back, so the database is left unchanged. A transaction is bound to one
+// connection, so the files are then imported by a single worker. A failed
+// insert aborts a PostgreSQL transaction, so the error insert policy is
+// measured as skip.
+func (cs *CSVScanner) Benchmark(ctx context.Context, directoryPath string, rollback bool) (BenchmarkResult, error) {
+	var result BenchmarkResult
+	if _, err := os.Stat(directoryPath); err != nil {
+		return result, fmt.Errorf("sample directory does not exist: %s", directoryPath)
+	}
+	files, err := cs.findCSVFiles(directoryPath)
+	if err != nil {
+		return result, fmt.Errorf("failed to find CSV files: %w", err)
+	}
+	if len(files) == 0 {
+		return result, fmt.Errorf("no data files found in %s", directoryPath)
+	}
+
+	rejectDir, err := os.MkdirTemp("", "sensor-benchmark-")
+	if err != nil {
+		return result, fmt.Errorf("failed to create reject directory: %w", err)
+	}
+	defer os.RemoveAll(rejectDir)
+	cs.rejectDir = rejectDir
+	cs.force = true
+	cs.changelogPath = ""
+	cs.journalPath = ""
+	cs.afterImport = afterImport{}
+
+	if rollback {
+		tx := cs.db.Begin()
+		if tx.Error != nil {
+			return result, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+		}
+		db := cs.db
+		cs.db = tx
+		defer func() {
+			cs.db = db
+			if err := tx.Rollback().Error; err != nil {
+				logger.Warnf("Failed to roll back benchmark transaction: %v\n", err)
+			}
+		}()
+		result.RolledBack = true
+
+		cs.workerCount = 1
+		if cs.insertPolicy == InsertPolicyError && cs.upsertWindow == 0 {
+			cs.insertPolicy = InsertPolicySkip
+		}
+		logger.Println("Dry run: importing in one transaction that is rolled back (1 worker, existing readings skipped)")
+	}
+
+	logger.Printf("Benchmarking %d file(s) from %s\n", len(files), directoryPath)
+	if err := cs.beginScan(); err != nil {
+		return result, err
+	}
+	defer cs.endScan()
+
+	start := time.Now()
+	results := cs.processFilesParallel(ctx, files, 0)
+	result.Duration = time.Since(start)
+	cs.displaySummary(results)
+
+	for _, fileResult := range results {
+		result.Files++
+		if fileResult.Error != nil {
+			result.Failed++
+		}
+		result.Readings += fileResult.RecordCount
+		result.Errors += fileResult.ErrorCount
+		result.Timings.Add(fileResult.Timings)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("benchmark cancelled: %w", err)
+	}
+	return result, nil
+}
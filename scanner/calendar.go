@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"sort"
+	"time"
+
+	"sensor_data_import/config"
+)
+
+// operatingCalendar knows when sensors are not expected to report: closed
+// weekdays, holidays and planned shutdowns
+type operatingCalendar struct {
+	location  *time.Location
+	closed    [7]bool            // By time.Weekday
+	holidays  map[string]bool    // Dates as YYYY-MM-DD
+	shutdowns []calendarShutdown // Sorted and merged
+}
+
+// calendarShutdown is a planned shutdown from start up to end
+type calendarShutdown struct {
+	start, end time.Time
+}
+
+// newOperatingCalendar loads the operating calendar, returning nil when it
+// declares no downtime. The configuration must have been validated.
+func newOperatingCalendar(cfg config.CalendarConfig) *operatingCalendar {
+	if len(cfg.ClosedWeekdays) == 0 && len(cfg.Holidays) == 0 && len(cfg.Shutdowns) == 0 {
+		return nil
+	}
+
+	oc := &operatingCalendar{location: time.UTC, holidays: make(map[string]bool)}
+	if cfg.Timezone != "" {
+		oc.location, _ = time.LoadLocation(cfg.Timezone)
+	}
+	for _, name := range cfg.ClosedWeekdays {
+		day, _ := config.ParseWeekday(name)
+		oc.closed[day] = true
+	}
+	for _, day := range cfg.Holidays {
+		oc.holidays[day] = true
+	}
+
+	shutdowns := make([]calendarShutdown, 0, len(cfg.Shutdowns))
+	for _, s := range cfg.Shutdowns {
+		start, _ := config.ParseCalendarTime(s.From, oc.location, false)
+		end, _ := config.ParseCalendarTime(s.To, oc.location, true)
+		shutdowns = append(shutdowns, calendarShutdown{start: start, end: end})
+	}
+	sort.Slice(shutdowns, func(i, j int) bool { return shutdowns[i].start.Before(shutdowns[j].start) })
+	// Merge overlapping shutdowns so their downtime is not subtracted twice
+	for _, s := range shutdowns {
+		last := len(oc.shutdowns) - 1
+		if last >= 0 && !s.start.After(oc.shutdowns[last].end) {
+			if s.end.After(oc.shutdowns[last].end) {
+				oc.shutdowns[last].end = s.end
+			}
+			continue
+		}
+		oc.shutdowns = append(oc.shutdowns, s)
+	}
+	return oc
+}
+
+// operatingTime returns how much of the time from start to end falls outside
+// planned downtime
+func (oc *operatingCalendar) operatingTime(start, end time.Time) time.Duration {
+	if oc == nil {
+		return end.Sub(start)
+	}
+
+	var operating time.Duration
+	for from := start.In(oc.location); from.Before(end); {
+		// Walk the range a local day at a time
+		year, month, day := from.Date()
+		next := time.Date(year, month, day+1, 0, 0, 0, 0, oc.location)
+		to := next
+		if end.Before(to) {
+			to = end
+		}
+		if !oc.closed[from.Weekday()] && !oc.holidays[from.Format("2006-01-02")] {
+			operating += to.Sub(from) - oc.shutdownTime(from, to)
+		}
+		from = next
+	}
+	return operating
+}
+
+// shutdownTime returns how much of the time from start to end falls in a shutdown
+func (oc *operatingCalendar) shutdownTime(start, end time.Time) time.Duration {
+	var downtime time.Duration
+	for _, s := range oc.shutdowns {
+		if !s.start.Before(end) {
+			break
+		}
+		from, to := s.start, s.end
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			downtime += to.Sub(from)
+		}
+	}
+	return downtime
+}
@@ -0,0 +1,189 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// Change event operations
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+)
+
+// changeValue is the state of a reading before or after a change
+type changeValue struct {
+	Value float64 `json:"value"`
+}
+
+// changeEvent is one line of the changelog
+type changeEvent struct {
+	Op          string       `json:"op"`
+	Table       string       `json:"table"`
+	File        string       `json:"file"`
+	SensorName  string       `json:"sensor_name"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Before      *changeValue `json:"before"`
+	After       *changeValue `json:"after"`
+	CommittedAt time.Time    `json:"committed_at"`
+}
+
+// changelog appends committed inserts and updates to a JSON Lines file so
+// downstream caches can follow imports without polling the database
+type changelog struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// openChangelog opens the changelog file for appending
+func openChangelog(path string) (*changelog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open changelog: %w", err)
+	}
+	return &changelog{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Close closes the changelog file
+func (c *changelog) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+// write appends the events of a committed batch; a nil changelog is disabled
+func (c *changelog) write(fileName string, events []changeEvent) {
+	if c == nil || len(events) == 0 {
+		return
+	}
+
+	table := models.SensorData{}.TableName()
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, event := range events {
+		event.Table = table
+		event.File = fileName
+		event.CommittedAt = now
+		if err := c.encoder.Encode(event); err != nil {
+			logger.Warnf("Failed to write changelog: %v\n", err)
+			return
+		}
+	}
+}
+
+// insertEvent describes a newly inserted reading
+func insertEvent(record models.SensorData) changeEvent {
+	return changeEvent{
+		Op:         ChangeInsert,
+		SensorName: record.SensorName,
+		Timestamp:  record.Timestamp.UTC(),
+		After:      &changeValue{Value: record.Value},
+	}
+}
+
+// updateEvent describes a stored reading whose value was replaced
+func updateEvent(record models.SensorData, before float64) changeEvent {
+	event := insertEvent(record)
+	event.Op = ChangeUpdate
+	event.Before = &changeValue{Value: before}
+	return event
+}
+
+// insertEvents describes a batch that was inserted without conflicts
+func insertEvents(batch []models.SensorData) []changeEvent {
+	events := make([]changeEvent, 0, len(batch))
+	for _, record := range batch {
+		events = append(events, insertEvent(record))
+	}
+	return events
+}
+
+// policyEvents describes the effect of inserting a batch with the skip or
+// update insert policy over the stored readings loaded before the insert
+func policyEvents(existing map[readingKey]*models.SensorData, batch []models.SensorData, policy string) []changeEvent {
+	var events []changeEvent
+	current := make(map[readingKey]float64, len(existing))
+	for key, stored := range existing {
+		current[key] = stored.Value
+	}
+
+	for _, record := range batch {
+		key := keyOf(&record)
+		before, found := current[key]
+		switch {
+		case !found:
+			events = append(events, insertEvent(record))
+		case policy == InsertPolicyUpdate && before != record.Value:
+			events = append(events, updateEvent(record, before))
+		default:
+			continue
+		}
+		current[key] = record.Value
+	}
+
+	return events
+}
+
+// batchEvents describes the changes a batch is about to make, reading the
+// stored values first when the insert policy may skip or update rows.
+// Nothing is read while the changelog is disabled or in raw ingest mode.
+func (cs *CSVScanner) batchEvents(tx *gorm.DB, batch []models.SensorData, policy string) ([]changeEvent, error) {
+	if cs.changelog == nil || cs.rawIngest {
+		return nil, nil
+	}
+	if policy == InsertPolicyError {
+		return insertEvents(batch), nil
+	}
+	existing, err := loadExisting(tx, batch)
+	if err != nil {
+		return nil, err
+	}
+	return policyEvents(existing, batch, policy), nil
+}
+
+// loadExisting loads the stored readings that may collide with a batch
+func loadExisting(db *gorm.DB, batch []models.SensorData) (map[readingKey]*models.SensorData, error) {
+	existing := make(map[readingKey]*models.SensorData)
+	if len(batch) == 0 {
+		return existing, nil
+	}
+
+	sensorNames := make([]string, 0, len(batch))
+	seenSensors := make(map[string]bool)
+	minTime, maxTime := batch[0].Timestamp, batch[0].Timestamp
+	for _, record := range batch {
+		if !seenSensors[record.SensorName] {
+			seenSensors[record.SensorName] = true
+			sensorNames = append(sensorNames, record.SensorName)
+		}
+		if record.Timestamp.Before(minTime) {
+			minTime = record.Timestamp
+		}
+		if record.Timestamp.After(maxTime) {
+			maxTime = record.Timestamp
+		}
+	}
+
+	var existingRows []models.SensorData
+	if err := db.Where("sensor_name IN ? AND timestamp BETWEEN ? AND ?", sensorNames, minTime, maxTime).
+		Find(&existingRows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load existing readings: %w", err)
+	}
+
+	for i := range existingRows {
+		existing[keyOf(&existingRows[i])] = &existingRows[i]
+	}
+	return existing, nil
+}
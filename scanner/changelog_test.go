@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+// readChangelog returns the events in the changelog at path
+func readChangelog(t *testing.T, path string) []changeEvent {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open changelog: %v", err)
+	}
+	defer file.Close()
+	var events []changeEvent
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var event changeEvent
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatalf("changelog line %q: %v", lines.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestChangelogRecordsCommittedChanges(t *testing.T) {
+	const file = "timestamp,sensor_name,value\n" +
+		"2025-09-01 00:00:00,temp_01,9\n" + // Replaces the stored 0
+		"2025-09-01 00:01:00,temp_01,1\n" + // Same as stored, no change
+		"2025-09-01 00:02:00,temp_01,2\n" + // New
+		"2025-09-01 00:02:00,temp_01,2\n" // Repeated in the file, no change
+	for _, tt := range []struct {
+		policy string
+		want   []string // Op and minute of each event
+	}{
+		{InsertPolicyUpdate, []string{"update@00:00", "insert@00:02"}},
+		{InsertPolicySkip, []string{"insert@00:02"}},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			db := openTestDB(t)
+			insertRows(t, db, minuteReadings(2)...)
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"a.csv": file})
+			changelogPath := filepath.Join(t.TempDir(), "changes.jsonl")
+			cs := NewCSVScanner(db)
+			if err := cs.Configure(config.ScannerConfig{InsertPolicy: tt.policy, ChangelogFile: changelogPath}); err != nil {
+				t.Fatalf("configure scanner: %v", err)
+			}
+			if err := cs.ScanDirectory(context.Background(), dir); err != nil {
+				t.Fatalf("ScanDirectory: %v", err)
+			}
+
+			events := readChangelog(t, changelogPath)
+			var got []string
+			for _, event := range events {
+				got = append(got, event.Op+"@"+event.Timestamp.Format("15:04"))
+				if event.File != "a.csv" || event.Table != (models.SensorData{}).TableName() || event.CommittedAt.IsZero() || event.After == nil {
+					t.Errorf("event = %+v, want the file, table, commit time and new value", event)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("events = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("events = %v, want %v", got, tt.want)
+					break
+				}
+			}
+			if tt.policy == InsertPolicyUpdate && (events[0].Before == nil || events[0].Before.Value != 0 || events[0].After.Value != 9) {
+				t.Errorf("update event = %+v, want 0 replaced by 9", events[0])
+			}
+		})
+	}
+}
+
+func TestChangelogDisabledInRawIngest(t *testing.T) {
+	cs := NewCSVScanner(openTestDB(t))
+	cs.changelog = &changelog{}
+	cs.rawIngest = true
+	events, err := cs.batchEvents(cs.db, minuteReadings(3), InsertPolicySkip)
+	if err != nil || events != nil {
+		t.Errorf("events = %v, %v; want none in raw ingest mode", events, err)
+	}
+
+	// Without a conflict policy, every reading of the batch is an insert
+	cs.rawIngest = false
+	if events, err := cs.batchEvents(cs.db, minuteReadings(3), InsertPolicyError); err != nil || len(events) != 3 || !events[2].Timestamp.Equal(minuteReadings(3)[2].Timestamp) {
+		t.Errorf("events = %v, %v; want 3 inserts", events, err)
+	}
+}
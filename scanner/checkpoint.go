@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fileCheckpoint tracks the committed readings of the file being imported
+type fileCheckpoint struct {
+	fileName string
+	hash     string
+	base     int // Readings committed before this run
+}
+
+// loadCheckpoint returns the checkpoint of a file, resuming after the
+// readings committed by an earlier, interrupted run
+func (cs *CSVScanner) loadCheckpoint(fileName string, fingerprint fileFingerprint) (*fileCheckpoint, error) {
+	cp := &fileCheckpoint{fileName: fileName, hash: fingerprint.hash}
+	if cs.force {
+		return cp, nil
+	}
+
+	var saved models.ImportCheckpoint
+	err := cs.db.Where("sha256 = ?", fingerprint.hash).First(&saved).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	cp.base = saved.CommittedRows
+	return cp, nil
+}
+
+// save records that the first offset readings after the base are committed
+func (cp *fileCheckpoint) save(db *gorm.DB, offset int) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sha256"}},
+		DoUpdates: clause.AssignmentColumns([]string{"file_path", "committed_rows", "updated_at"}),
+	}).Create(&models.ImportCheckpoint{
+		FilePath:      storedPath(cp.fileName),
+		SHA256:        cp.hash,
+		CommittedRows: cp.base + offset,
+		UpdatedAt:     time.Now().UTC(),
+	}).Error
+}
+
+// clear removes the checkpoint once the file is completely imported
+func (cp *fileCheckpoint) clear(db *gorm.DB) error {
+	return db.Where("sha256 = ?", cp.hash).Delete(&models.ImportCheckpoint{}).Error
+}
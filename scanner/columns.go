@@ -0,0 +1,227 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sensor_data_import/config"
+)
+
+// Canonical reading fields
+const (
+	FieldTimestamp  = "timestamp"
+	FieldSensorName = "sensor_name"
+	FieldValue      = "value"
+)
+
+// mappedFields lists the fields in columnMap order
+var mappedFields = [3]string{FieldTimestamp, FieldSensorName, FieldValue}
+
+// defaultColumnSynonyms lists header names recognized for each field
+var defaultColumnSynonyms = map[string][]string{
+	FieldTimestamp:  {"timestamp", "ts", "time", "datetime", "date_time", "date"},
+	FieldSensorName: {"sensor_name", "sensor", "sensorname", "name", "tag"},
+	FieldValue:      {"value", "reading", "val", "measurement"},
+}
+
+// columnMap holds the zero-based column index of each field. A field with an
+// expression is computed from the row instead; its index is then the highest
+// column the expression reads.
+type columnMap struct {
+	timestamp  int
+	sensorName int
+	value      int
+	exprs      [3]exprNode
+}
+
+// positionalColumns is the historical timestamp,sensor_name,value layout
+var positionalColumns = columnMap{timestamp: 0, sensorName: 1, value: 2}
+
+// fileSensorColumns is the timestamp,value layout of files whose name
+// supplies the sensor
+var fileSensorColumns = columnMap{timestamp: 0, sensorName: -1, value: 1}
+
+// minColumns returns the number of columns a row needs to contain every field
+func (cm columnMap) minColumns() int {
+	return max(cm.timestamp, cm.sensorName, cm.value) + 1
+}
+
+// cells returns the timestamp, sensor name and value text of a row
+func (cm columnMap) cells(record []string) (timestamp, sensorName, value string, err error) {
+	texts := [3]string{}
+	for i, index := range [3]int{cm.timestamp, cm.sensorName, cm.value} {
+		if cm.exprs[i] == nil {
+			if index >= 0 {
+				texts[i] = record[index]
+			}
+			continue
+		}
+		v, err := cm.exprs[i].eval(record)
+		if err != nil {
+			return "", "", "", fmt.Errorf("%s expression: %w", mappedFields[i], err)
+		}
+		texts[i] = v.text()
+	}
+	return texts[0], texts[1], texts[2], nil
+}
+
+// String formats the mapping for log output
+func (cm columnMap) String() string {
+	parts := make([]string, 3)
+	for i, index := range [3]int{cm.timestamp, cm.sensorName, cm.value} {
+		if cm.exprs[i] != nil {
+			parts[i] = mappedFields[i] + "=<expression>"
+		} else if index < 0 {
+			parts[i] = mappedFields[i] + "=<file name>"
+		} else {
+			parts[i] = fmt.Sprintf("%s=%d", mappedFields[i], index)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// headerMatcher maps header names to fields using configured synonyms
+type headerMatcher struct {
+	synonyms map[string]string // normalized header name -> field
+}
+
+// newHeaderMatcher combines the default synonyms with configured extras
+func newHeaderMatcher(extra map[string][]string) (*headerMatcher, error) {
+	hm := &headerMatcher{synonyms: make(map[string]string)}
+
+	for field, names := range defaultColumnSynonyms {
+		for _, name := range names {
+			hm.synonyms[normalizeHeader(name)] = field
+		}
+	}
+
+	for field, names := range extra {
+		if _, ok := defaultColumnSynonyms[field]; !ok {
+			return nil, fmt.Errorf("unknown column field %q (expected timestamp, sensor_name or value)", field)
+		}
+		for _, name := range names {
+			hm.synonyms[normalizeHeader(name)] = field
+		}
+	}
+
+	return hm, nil
+}
+
+// normalizeHeader lowercases a header name and strips surrounding whitespace and quotes
+func normalizeHeader(name string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(name), `"'`))
+}
+
+// isKnownHeader reports whether a cell matches any header synonym
+func (hm *headerMatcher) isKnownHeader(cell string) bool {
+	_, ok := hm.synonyms[normalizeHeader(cell)]
+	return ok
+}
+
+// mapColumns locates each field in a header row. It returns false when any
+// field is missing, in which case the positional layout should be used. With
+// fileSensor the sensor_name column may be missing, as the file name
+// supplies the sensor.
+func (hm *headerMatcher) mapColumns(header []string, fileSensor bool) (columnMap, bool) {
+	found := map[string]int{}
+	for i, cell := range header {
+		field, ok := hm.synonyms[normalizeHeader(cell)]
+		if !ok {
+			continue
+		}
+		// The first matching column wins
+		if _, seen := found[field]; !seen {
+			found[field] = i
+		}
+	}
+
+	_, hasSensor := found[FieldSensorName]
+	if fileSensor && !hasSensor && len(found) == len(defaultColumnSynonyms)-1 {
+		return columnMap{timestamp: found[FieldTimestamp], sensorName: -1, value: found[FieldValue]}, true
+	}
+	if len(found) < len(defaultColumnSynonyms) {
+		return positionalColumns, false
+	}
+
+	return columnMap{
+		timestamp:  found[FieldTimestamp],
+		sensorName: found[FieldSensorName],
+		value:      found[FieldValue],
+	}, true
+}
+
+// columnMapping locates the reading columns for files matching a pattern
+type columnMapping struct {
+	files  string
+	fields [3]exprNode // timestamp, sensor_name, value
+}
+
+// newColumnMappings converts the configured mappings, preserving their order.
+// Each column is a header name, a zero-based index or an expression.
+func newColumnMappings(configs []config.ColumnMappingConfig) ([]columnMapping, error) {
+	mappings := make([]columnMapping, 0, len(configs))
+	for _, c := range configs {
+		mapping := columnMapping{files: c.Files}
+		for i, ref := range []string{c.Timestamp, c.SensorName, c.Value} {
+			field, err := parseColumnField(ref)
+			if err != nil {
+				return nil, fmt.Errorf("column mapping %s: %w", c.Files, err)
+			}
+			mapping.fields[i] = field
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// parseColumnField parses a header name, zero-based index or expression
+func parseColumnField(ref string) (exprNode, error) {
+	if isExpression(ref) {
+		return parseExpression(ref)
+	}
+	if index, err := strconv.Atoi(ref); err == nil {
+		if index < 0 {
+			return nil, fmt.Errorf("invalid column index %d", index)
+		}
+		return columnRef{index: index}, nil
+	}
+	return columnRef{name: ref}, nil
+}
+
+// matchesFile reports whether the mapping applies to a file
+func (cm columnMapping) matchesFile(fileName string) bool {
+	return matchFilePattern(cm.files, fileName)
+}
+
+// usesHeaderNames reports whether any column is selected by header name
+func (cm columnMapping) usesHeaderNames() bool {
+	for _, field := range cm.fields {
+		if _, err := field.bind(nil); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve binds the mapping to the header row, if any. Plain column
+// references become indexes; expressions are kept for per-row evaluation.
+func (cm columnMapping) resolve(header []string) (columnMap, error) {
+	var columns columnMap
+	indexes := [3]*int{&columns.timestamp, &columns.sensorName, &columns.value}
+
+	for i, field := range cm.fields {
+		bound, err := field.bind(header)
+		if err != nil {
+			return columnMap{}, err
+		}
+		if ref, ok := bound.(columnRef); ok {
+			*indexes[i] = ref.index
+			continue
+		}
+		*indexes[i] = bound.maxColumn()
+		columns.exprs[i] = bound
+	}
+
+	return columns, nil
+}
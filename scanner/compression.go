@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gzipMagic is the header that starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isCSVFile reports whether a file name looks like a plain or gzip-compressed CSV
+func isCSVFile(name string) bool {
+	return strings.ToLower(filepath.Ext(baseCSVName(name))) == ".csv"
+}
+
+// baseCSVName strips a trailing .gz extension from a file name
+func baseCSVName(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		return name[:len(name)-len(".gz")]
+	}
+	return name
+}
+
+// fileReader reads a possibly compressed file and closes every layer on Close
+type fileReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes the decompressor and the underlying file
+func (fr *fileReader) Close() error {
+	var firstErr error
+	for i := len(fr.closers) - 1; i >= 0; i-- {
+		if err := fr.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openDataFile opens a file for streaming, transparently decompressing gzip
+// content detected by its magic bytes regardless of the file extension
+func openDataFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapDecompressor(file, file, path)
+}
+
+// wrapDecompressor inspects the start of a stream and adds a gzip reader when
+// needed. The closer is closed together with the returned reader.
+func wrapDecompressor(r io.Reader, closer io.Closer, name string) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		closer.Close()
+		return nil, err
+	}
+
+	if !bytes.Equal(header, gzipMagic) {
+		if strings.EqualFold(filepath.Ext(name), ".gz") {
+			closer.Close()
+			return nil, fmt.Errorf("file has .gz extension but is not gzip-compressed")
+		}
+		return &fileReader{Reader: buffered, closers: []io.Closer{closer}}, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		closer.Close()
+		return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+
+	return &fileReader{Reader: gz, closers: []io.Closer{closer, gz}}, nil
+}
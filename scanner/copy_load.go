@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sensor_data_import/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// Load methods for the readings of a batch
+const (
+	LoadMethodInsert = "insert" // Multi-row INSERT statements (default)
+	LoadMethodCopy   = "copy"   // PostgreSQL COPY FROM STDIN
+)
+
+// copyFromKey holds the COPY function of a load transaction in its settings
+const copyFromKey = "sensor_data_import:copy_from"
+
+// copyFromFunc streams readings into a table with COPY, within the load
+// transaction
+type copyFromFunc func(table string, batch []models.SensorData) error
+
+// loadTransaction runs fn in a transaction. When loading with COPY, the
+// transaction is opened on a dedicated PostgreSQL connection whose COPY
+// function insertBatch finds in the settings of the tx it is passed.
+func (cs *CSVScanner) loadTransaction(fn func(tx *gorm.DB) error) error {
+	if !cs.copyLoad {
+		return cs.db.Transaction(fn)
+	}
+
+	ctx := context.Background()
+	sqlDB, err := cs.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sqlTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := cs.db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	tx.Statement.ConnPool = sqlTx
+	copyFrom := copyFromFunc(func(table string, batch []models.SensorData) error {
+		return conn.Raw(func(driverConn any) error {
+			pgConn, ok := driverConn.(*stdlib.Conn)
+			if !ok {
+				return errors.New("COPY needs a PostgreSQL connection")
+			}
+			return copyReadings(ctx, pgConn.Conn(), table, batch, tx.NowFunc())
+		})
+	})
+
+	tx.Statement.Settings.Store(copyFromKey, copyFrom)
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := sqlTx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// copyFromOf returns the COPY function of a load transaction, if it has one
+func copyFromOf(tx *gorm.DB) (copyFromFunc, bool) {
+	value, ok := tx.Get(copyFromKey)
+	if !ok {
+		return nil, false
+	}
+	copyFrom, ok := value.(copyFromFunc)
+	return copyFrom, ok
+}
+
+// copyReadings streams readings into table with COPY FROM STDIN. Readings
+// are keyed as by an INSERT: snowflake IDs are assigned here, auto-increment
+// IDs by the database and composite keys need no ID column. now is the
+// created_at of the readings.
+func copyReadings(ctx context.Context, conn *pgx.Conn, table string, batch []models.SensorData, now time.Time) error {
+	columns := []string{"timestamp", "sensor_name", "value", "source_file", "source_modified_at", "import_file_id", "source_run_id", "created_at"}
+	snowflake := models.IDStrategy() == models.IDSnowflake
+	if snowflake {
+		columns = append([]string{"id"}, columns...)
+	}
+
+	_, err := conn.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+		record := &batch[i]
+		row := []any{record.Timestamp, record.SensorName, record.Value, record.SourceFile, record.SourceModifiedAt,
+			optionalID(record.ImportFileID), optionalID(record.SourceRunID), now}
+		if snowflake {
+			if err := record.BeforeCreate(nil); err != nil {
+				return nil, err
+			}
+			row = append([]any{int64(record.ID)}, row...)
+		}
+		return row, nil
+	}))
+	return err
+}
+
+// optionalID converts an optional ID for COPY, which encodes signed integers
+func optionalID(id *uint) *int64 {
+	if id == nil {
+		return nil
+	}
+	value := int64(*id)
+	return &value
+}
@@ -0,0 +1,165 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// postgresDSNVariable names the PostgreSQL database the COPY tests load
+// into. Its tables are prefixed with test_copy_ and dropped by the tests.
+const postgresDSNVariable = "SENSOR_DATA_TEST_POSTGRES_DSN"
+
+// openPostgres connects to the test database and creates an empty
+// sensor_data table, skipping the test when no database is configured
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNVariable)
+	if dsn == "" {
+		t.Skipf("set %s to run the PostgreSQL tests", postgresDSNVariable)
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to PostgreSQL: %v", err)
+	}
+
+	models.SetTableNaming("test_copy_", "")
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.SensorData{})
+		models.SetTableNaming("", "")
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := db.Migrator().DropTable(&models.SensorData{}); err != nil {
+		t.Fatalf("drop sensor_data: %v", err)
+	}
+	if err := db.AutoMigrate(&models.SensorData{}); err != nil {
+		t.Fatalf("create sensor_data: %v", err)
+	}
+	return db
+}
+
+// copyScanner returns a scanner loading with method and the insert policy
+func copyScanner(t *testing.T, db *gorm.DB, method, policy string) *CSVScanner {
+	t.Helper()
+	cs := NewCSVScanner(db)
+	if err := cs.Configure(config.ScannerConfig{LoadMethod: method, InsertPolicy: policy}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	if !cs.copyLoad {
+		t.Fatalf("load method %s does not use COPY on PostgreSQL", method)
+	}
+	return cs
+}
+
+func copyReading(minute int, value float64) models.SensorData {
+	source := "readings.csv"
+	return models.SensorData{
+		Timestamp:  time.Date(2025, 9, 1, 0, minute, 0, 0, time.UTC),
+		SensorName: "temp_01",
+		Value:      value,
+		SourceFile: &source,
+	}
+}
+
+func storedCopyReadings(t *testing.T, db *gorm.DB) []models.SensorData {
+	t.Helper()
+	var stored []models.SensorData
+	if err := db.Order("timestamp").Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	return stored
+}
+
+func TestPostgresCopyLoad(t *testing.T) {
+	db := openPostgres(t)
+	cs := copyScanner(t, db, LoadMethodCopy, InsertPolicyError)
+
+	result := ProcessResult{FileName: "readings.csv"}
+	batch := []models.SensorData{copyReading(0, 1), copyReading(1, 2), copyReading(2, 3)}
+	if err := cs.batchInsertSensorData(context.Background(), batch, &result, nil); err != nil {
+		t.Fatalf("batchInsertSensorData: %v", err)
+	}
+	if result.FailedCount != 0 || result.SkippedCount != 0 {
+		t.Errorf("result = %+v, want every reading inserted", result)
+	}
+
+	stored := storedCopyReadings(t, db)
+	if len(stored) != 3 {
+		t.Fatalf("stored %d readings, want 3", len(stored))
+	}
+	for i, reading := range stored {
+		if reading.ID == 0 || reading.Value != float64(i+1) || reading.SourceFile == nil || *reading.SourceFile != "readings.csv" ||
+			reading.ImportFileID != nil || reading.CreatedAt.IsZero() {
+			t.Errorf("reading %d = %+v", i, reading)
+		}
+	}
+}
+
+// A duplicate fails the COPY, which rolls back the whole batch; the rows are
+// then inserted one by one and only the duplicate is refused
+func TestPostgresCopyLoadFallback(t *testing.T) {
+	db := openPostgres(t)
+	insertRows(t, db, copyReading(1, 9))
+	cs := copyScanner(t, db, LoadMethodCopy, InsertPolicyError)
+
+	result := ProcessResult{FileName: "readings.csv"}
+	batch := []models.SensorData{copyReading(0, 1), copyReading(1, 2), copyReading(2, 3)}
+	if err := cs.batchInsertSensorData(context.Background(), batch, &result, nil); err != nil {
+		t.Fatalf("batchInsertSensorData: %v", err)
+	}
+	if result.FailedCount != 1 {
+		t.Errorf("%d readings failed, want the duplicate", result.FailedCount)
+	}
+
+	stored := storedCopyReadings(t, db)
+	if len(stored) != 3 || stored[0].Value != 1 || stored[1].Value != 9 || stored[2].Value != 3 {
+		t.Errorf("stored readings = %+v, want 1, the existing 9 and 3", stored)
+	}
+}
+
+// Policies that handle conflicts insert with ON CONFLICT on the COPY
+// connection, and the staging load method fills its table with COPY
+func TestPostgresCopyLoadPolicies(t *testing.T) {
+	tests := []struct {
+		method      string
+		policy      string
+		wantSkipped int
+		wantValue   float64 // Value of the existing reading afterwards
+	}{
+		{LoadMethodCopy, InsertPolicySkip, 1, 9},
+		{LoadMethodCopy, InsertPolicyUpdate, 0, 2},
+		{LoadMethodStaging, InsertPolicySkip, 1, 9},
+		{LoadMethodStaging, InsertPolicyUpdate, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+"/"+tt.policy, func(t *testing.T) {
+			db := openPostgres(t)
+			insertRows(t, db, copyReading(1, 9))
+			cs := copyScanner(t, db, tt.method, tt.policy)
+
+			result := ProcessResult{FileName: "readings.csv"}
+			batch := []models.SensorData{copyReading(0, 1), copyReading(1, 2)}
+			if err := cs.batchInsertSensorData(context.Background(), batch, &result, nil); err != nil {
+				t.Fatalf("batchInsertSensorData: %v", err)
+			}
+			if result.SkippedCount != tt.wantSkipped || result.FailedCount != 0 {
+				t.Errorf("skipped %d and failed %d, want %d skipped", result.SkippedCount, result.FailedCount, tt.wantSkipped)
+			}
+
+			stored := storedCopyReadings(t, db)
+			if len(stored) != 2 || stored[1].Value != tt.wantValue {
+				t.Errorf("stored readings = %+v, want the existing one with value %v", stored, tt.wantValue)
+			}
+		})
+	}
+}
@@ -1,16 +1,25 @@
 package scanner
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"sensor_data_import/config"
+	"sensor_data_import/display"
 	"sensor_data_import/logger"
 	"sensor_data_import/models"
 
@@ -19,25 +28,138 @@ import (
 
 // CSVScanner handles scanning and processing CSV files
 type CSVScanner struct {
-	db          *gorm.DB
-	workerCount int
+	db                    *gorm.DB
+	workerCount           int
+	insertWorkers         int           // Workers inserting the batches of each file
+	loadMethod            string        // How batches are written: insert, copy or staging
+	copyLoad              bool          // Load transactions stream rows with COPY
+	staging               *stagingTable // Staging table of the staging load method
+	batchSize             int
+	fileTransactions      bool          // Commit each file in one transaction, not each batch
+	maxRowsInMemory       int           // CSV rows read at a time, 0 for whole files
+	watchRampUp           time.Duration // Delay between starting workers in watch mode
+	watchRetryAttempts    int           // Imports of a failing file in watch mode before giving up
+	watchRetryDelay       time.Duration // Wait before the first retry in watch mode
+	filenameTemplate      *FilenameTemplate
+	filenameMetadata      *filenameMetadata // Nil without filename_regex
+	rejectNonConforming   bool
+	acceptWindow          TimeWindow // Accept window as resolved when the scanner was configured, for the log
+	acceptFrom, acceptTo  string     // Configured bounds of the accept window, resolved again for each batch
+	rawIngest             bool
+	insertPolicy          string
+	upsertWindow          time.Duration // Overwrite readings newer than this, skip older duplicates
+	upsertCutoff          time.Time     // Start of the upsert window, set when a scan begins
+	jsonFields            config.JSONFieldsConfig
+	http                  *httpSource
+	s3                    *s3Source
+	sftp                  *sftpSource
+	faults                *FaultInjector
+	recursive             bool
+	manifest              bool // Skip files recorded in the import manifest
+	fileTags              bool // Store the fields captured from file names on their import batch
+	force                 bool // Re-import files even if they are in the manifest
+	checkpoints           bool // Resume interrupted files from their import checkpoint
+	lastValues            bool // Maintain the sensor_last_values cache
+	deadLetters           bool // Keep readings that fail to insert in sensor_data_rejects
+	rejectDir             string
+	changelogPath         string
+	changelog             *changelog // Open while a scan writes change events
+	journalPath           string
+	journal               *journal // Open while a scan appends to the import journal
+	spoolPath             string
+	spool                 *readingSpool // Open while a scan spools readings the database cannot take
+	afterImport           afterImport
+	precedence            *precedencePolicy
+	valueChecks           valueChecker
+	transforms            valueTransforms
+	aggregations          aggregationRules
+	errorLimit            errorLimit
+	sensors               sensorFilter
+	files                 fileFilter       // Selects the files of a directory that are imported
+	validator             *sensorValidator // Nil without validation rules
+	headers               *headerMatcher
+	columnMappings        []columnMapping
+	timestampFormats      []string
+	sourceLocation        *time.Location
+	timezoneOverrides     []timezoneOverride
+	sourceEncoding        sourceEncoding
+	encodingOverrides     []encodingOverride
+	numberFormat          numberFormat
+	numberFormatOverrides []numberFormatOverride
+	preamble              preambleSkipper
+	footers               footerMatcher
+	wideLayout            bool
+	wideMapping           map[string]string
+	sensorAliases         *sensorAliases
+	precedenceLocks       sensorLocks   // Serializes duplicate resolution per sensor across workers
+	pushMu                sync.Mutex    // Serializes pushed inserts, which refresh the upsert cutoff
+	pushLimit             rateLimiter   // Caps the pushed readings inserted per second
+	progress              *scanProgress // Set while processFilesParallel runs
+	live                  liveStatus    // Reported by Status over the control socket
+	pause                 pauseGate     // Holds back new files while paused over the control socket
+	runCommand            string
+	runArguments          string
+	run                   *importRun // Set between beginScan and endScan when runs are recorded
 }
 
 // FileJob represents a CSV file to be processed
 type FileJob struct {
 	FilePath string
-	FileName string
+	FileName string            // Path relative to the scanned directory
+	Dir      string            // Subdirectory relative to the scanned directory ("." for top level)
+	Member   string            // Member name when the file is inside a ZIP archive
+	Fields   map[string]string // Fields captured from the file name by the filename template, stored as tags of its batch
+	Size     int64             // Bytes on disk, used to estimate scan progress
+
+	input  io.Reader // Stream read instead of FilePath, such as standard input
+	source string    // URL a downloaded file was fetched from, or the file a tailed stream was read from
 }
 
 // ProcessResult contains the result of processing a CSV file
 type ProcessResult struct {
-	FilePath    string
-	RecordCount int
-	ErrorCount  int
-	Duration    time.Duration
-	Error       error
+	FilePath         string
+	FileName         string
+	RecordCount      int
+	ErrorCount       int
+	ErrorsByCategory map[string]int // Parsing errors by category, such as bad timestamp
+	ViolationCount   int            // Readings rejected by a validation rule
+	CadenceCount     int            // Readings outside their expected reporting interval, still imported
+	DroppedCount     int            // Rows outside the accept window
+	FilteredCount    int            // Readings of sensors left out by the include/exclude filters
+	ConflictCount    int            // Duplicates resolved by source precedence
+	SkippedCount     int            // Existing rows kept by the skip insert policy
+	AggregatedCount  int            // Readings of aggregated sensors, stored as aggregates
+	SummaryCount     int            // Intervals of a pre-aggregated file, stored as aggregates
+	FailedCount      int            // Readings that failed to insert, dead-lettered or not
+	DeadLettered     int            // Readings that failed to insert, kept in the dead-letter table
+	Spooled          int            // Readings kept in the local spool while the database was unreachable
+	PreambleLines    int            // Metadata lines skipped before the header row
+	FooterRows       int            // Summary rows skipped
+	AlreadyDone      bool           // Skipped because the import manifest has the same contents
+	Cancelled        bool           // Not started because the scan was cancelled
+	ResumedAfter     int            // Readings committed by an interrupted run and not inserted again
+	Duration         time.Duration
+	Timings          StageTimings // Duration broken down by stage
+	RejectFile       string       // Where rejected rows were written, if any
+	SHA256           string       // Hash of the contents, when the file was fingerprinted
+	BatchID          uint         // Import batch in the manifest, 0 without one
+	Error            error
+
+	rejects      []rejectedRow
+	rejectHeader []string
+	chunked      bool                 // Read in chunks, so the number of readings is not known up front
+	rowOffset    int                  // Rows before the chunk being parsed
+	rowsParsed   int                  // Rows parsed so far, for the error limit
+	errorLimit   errorLimit           // Set for files, whose parsing stops once over it
+	numbers      numberFormat         // Set for CSV files; other values are in the standard format
+	fileSensor   string               // Sensor named by the file name, for rows without a sensor
+	lastSeen     map[string]time.Time // Latest reading per sensor, for cadence checks
+	window       *TimeWindow          // Accept window of the batch, resolved when its first row is parsed
 }
 
+// defaultBatchSize is the number of readings per insert statement
+const defaultBatchSize = 1000
+
 // NewCSVScanner creates a new CSV scanner
 func NewCSVScanner(db *gorm.DB) *CSVScanner {
 	// Default to number of CPU cores for parallel processing
@@ -46,9 +168,27 @@ func NewCSVScanner(db *gorm.DB) *CSVScanner {
 		workerCount = 8 // Limit to 8 workers to avoid overwhelming the database
 	}
 
+	headers, _ := newHeaderMatcher(nil)
+	downloader, _ := newHTTPSource(config.HTTPSourceConfig{})
+	buckets, _ := newS3Source(config.S3SourceConfig{})
+	servers, _ := newSFTPSource(config.SFTPSourceConfig{})
+
 	return &CSVScanner{
-		db:          db,
-		workerCount: workerCount,
+		db:                 db,
+		workerCount:        workerCount,
+		insertWorkers:      1,
+		batchSize:          defaultBatchSize,
+		watchRampUp:        DefaultWatchRampUp,
+		watchRetryAttempts: DefaultWatchRetryAttempts,
+		watchRetryDelay:    DefaultWatchRetryDelay,
+		http:               downloader,
+		s3:                 buckets,
+		sftp:               servers,
+		headers:            headers,
+		timestampFormats:   config.DefaultTimestampFormats,
+		sourceLocation:     time.UTC,
+		sourceEncoding:     sourceEncoding{name: EncodingAuto},
+		live:               liveStatus{started: time.Now()},
 	}
 }
 
@@ -59,9 +199,244 @@ func (cs *CSVScanner) SetWorkerCount(count int) {
 	}
 }
 
-// ScanDirectory scans a directory for CSV files and processes them in parallel
-func (cs *CSVScanner) ScanDirectory(directoryPath string) error {
+// WorkerCount returns the number of parallel workers
+func (cs *CSVScanner) WorkerCount() int {
+	return cs.workerCount
+}
+
+// SetRecursive enables scanning of nested subdirectories
+func (cs *CSVScanner) SetRecursive(recursive bool) {
+	cs.recursive = recursive
+}
+
+// SetFileTransactions commits the readings of each file, or of each chunk of
+// max_rows_in_memory rows, in one transaction instead of one per batch
+func (cs *CSVScanner) SetFileTransactions(enabled bool) {
+	cs.fileTransactions = enabled
+}
+
+// transactionSize returns how many of a file's readings are committed
+// together: a batch, or all of them with file transactions
+func (cs *CSVScanner) transactionSize(readings int) int {
+	if cs.fileTransactions {
+		return max(readings, 1)
+	}
+	return cs.batchSize
+}
+
+// SetForce re-imports files even if the import manifest lists them
+func (cs *CSVScanner) SetForce(force bool) {
+	cs.force = force
+}
+
+// SetWatchRetryAttempts sets how often watch mode tries to import a failing
+// file before giving up; 1 disables retries
+func (cs *CSVScanner) SetWatchRetryAttempts(attempts int) {
+	if attempts > 0 {
+		cs.watchRetryAttempts = attempts
+	}
+}
+
+// SetWatchRampUp sets how long watch mode waits before starting each
+// additional worker; 0 starts every worker at once
+func (cs *CSVScanner) SetWatchRampUp(rampUp time.Duration) {
+	if rampUp >= 0 {
+		cs.watchRampUp = rampUp
+	}
+}
+
+// SetFaultInjector enables fault injection for inserts (testing only)
+func (cs *CSVScanner) SetFaultInjector(fi *FaultInjector) {
+	cs.faults = fi
+}
+
+// Configure applies scanner settings from the configuration
+func (cs *CSVScanner) Configure(cfg config.ScannerConfig) error {
+	if cfg.FilenamePattern != "" {
+		template, err := CompileFilenameTemplate(cfg.FilenamePattern)
+		if err != nil {
+			return err
+		}
+		cs.filenameTemplate = template
+		cs.rejectNonConforming = cfg.FilenamePolicy == "reject"
+	}
+
+	metadata, err := newFilenameMetadata(cfg.FilenameRegex, cfg.FilenameSensorName)
+	if err != nil {
+		return err
+	}
+	cs.filenameMetadata = metadata
+
+	if cfg.WorkerCount > 0 {
+		cs.workerCount = cfg.WorkerCount
+	}
+	if cfg.BatchSize > 0 {
+		cs.batchSize = cfg.BatchSize
+	}
+	if cfg.InsertWorkers > 0 {
+		cs.insertWorkers = cfg.InsertWorkers
+	}
+	cs.loadMethod = cfg.LoadMethod
+	postgres := cs.db.Dialector.Name() == "postgres"
+	if cs.loadMethod == LoadMethodCopy && !postgres {
+		logger.Warnf("Load method copy needs PostgreSQL, using INSERT statements instead\n")
+		cs.loadMethod = LoadMethodInsert
+	}
+	// The staging table is filled with COPY where the database has it
+	cs.copyLoad = cs.loadMethod == LoadMethodCopy || (cs.loadMethod == LoadMethodStaging && postgres)
+	cs.staging = nil
+	if cs.loadMethod == LoadMethodStaging {
+		if cs.staging, err = newStagingTable(cs.db); err != nil {
+			return err
+		}
+	}
+	cs.maxRowsInMemory = cfg.MaxRowsInMemory
+
+	downloader, err := newHTTPSource(cfg.HTTP)
+	if err != nil {
+		return err
+	}
+	cs.http = downloader
+	if cs.s3, err = newS3Source(cfg.S3); err != nil {
+		return err
+	}
+	if cs.sftp, err = newSFTPSource(cfg.SFTP); err != nil {
+		return err
+	}
+	if cfg.WatchRampUp != "" {
+		rampUp, err := time.ParseDuration(cfg.WatchRampUp)
+		if err != nil {
+			return fmt.Errorf("invalid scanner watch_ramp_up: %w", err)
+		}
+		cs.SetWatchRampUp(rampUp)
+	}
+	cs.SetWatchRetryAttempts(cfg.WatchRetryAttempts)
+	if cfg.WatchRetryDelay != "" {
+		if cs.watchRetryDelay, err = time.ParseDuration(cfg.WatchRetryDelay); err != nil {
+			return fmt.Errorf("invalid scanner watch_retry_delay: %w", err)
+		}
+	}
+
+	cs.rawIngest = cfg.IngestMode == "raw"
+	cs.insertPolicy = cfg.InsertPolicy
+	if cfg.UpsertWindow != "" {
+		window, err := time.ParseDuration(cfg.UpsertWindow)
+		if err != nil {
+			return fmt.Errorf("invalid scanner upsert_window: %w", err)
+		}
+		cs.SetUpsertWindow(window)
+	}
+	cs.jsonFields = cfg.JSONFields
+	headers, err := newHeaderMatcher(cfg.ColumnSynonyms)
+	if err != nil {
+		return fmt.Errorf("invalid column_synonyms: %w", err)
+	}
+	cs.headers = headers
+	mappings, err := newColumnMappings(cfg.ColumnMappings)
+	if err != nil {
+		return err
+	}
+	cs.columnMappings = mappings
+	if len(cfg.TimestampFormats) > 0 {
+		cs.timestampFormats = cfg.TimestampFormats
+	}
+	cs.sourceLocation, cs.timezoneOverrides, err = loadSourceLocations(cfg)
+	if err != nil {
+		return err
+	}
+	cs.sourceEncoding, cs.encodingOverrides, err = loadEncodings(cfg)
+	if err != nil {
+		return err
+	}
+	cs.numberFormat, cs.numberFormatOverrides, err = loadNumberFormats(cfg)
+	if err != nil {
+		return err
+	}
+
+	cs.preamble = preambleSkipper{skipLines: cfg.SkipLines}
+	if cfg.HeaderMarker != "" {
+		marker, err := regexp.Compile(cfg.HeaderMarker)
+		if err != nil {
+			return fmt.Errorf("invalid header_marker: %w", err)
+		}
+		cs.preamble.marker = marker
+	}
+
+	footers, err := newFooterMatcher(cfg.FooterPatterns)
+	if err != nil {
+		return err
+	}
+	cs.footers = footers
+
+	cs.wideLayout = cfg.Layout == "wide" || cfg.WideMappingFile != ""
+	if cfg.WideMappingFile != "" {
+		mapping, err := loadWideMapping(cfg.WideMappingFile)
+		if err != nil {
+			return err
+		}
+		cs.wideMapping = mapping
+	}
+	cs.sensorAliases = nil
+	if cfg.SensorAliasFile != "" {
+		if cs.sensorAliases, err = loadSensorAliases(cfg.SensorAliasFile, cfg.UnknownSensors == "reject"); err != nil {
+			return err
+		}
+	}
+
+	if cs.errorLimit, err = newErrorLimit(cfg.MaxErrors); err != nil {
+		return err
+	}
+
+	cs.valueChecks = valueChecker{
+		maxAbs:    cfg.MaxAbsValue,
+		whitelist: cfg.MagnitudeWhitelist,
+	}
+	cs.sensors = sensorFilter{include: cfg.IncludeSensors, exclude: cfg.ExcludeSensors}
+	cs.files = fileFilter{patterns: cfg.FilePatterns, exclude: cfg.ExcludeFiles}
+	if cs.transforms, err = newValueTransforms(cfg.ValueTransforms); err != nil {
+		return err
+	}
+	if cs.aggregations, err = newAggregationRules(cfg.Aggregations); err != nil {
+		return err
+	}
+	cs.validator, err = newSensorValidator(cfg.Validation)
+	if err != nil {
+		return err
+	}
+
+	if cfg.DuplicatePrecedence != "" && cfg.DuplicatePrecedence != PrecedenceFirst {
+		cs.precedence = &precedencePolicy{
+			mode:        cfg.DuplicatePrecedence,
+			directories: cfg.PrecedenceDirectories,
+		}
+	}
+	cs.recursive = cfg.Recursive
+	cs.rejectDir = cfg.RejectDir
+	cs.changelogPath = cfg.ChangelogFile
+	cs.journalPath = cfg.JournalFile
+	cs.spoolPath = cfg.SpoolFile
+	cs.afterImport = newAfterImport(cfg.AfterImport)
+
+	cs.acceptFrom, cs.acceptTo = cfg.AcceptFrom, cfg.AcceptTo
+	window, err := cs.resolveAcceptWindow(time.Now())
+	if err != nil {
+		return err
+	}
+	if !window.From.IsZero() && !window.To.IsZero() && !window.From.Before(window.To) {
+		return fmt.Errorf("accept window is empty: %s", window)
+	}
+	cs.acceptWindow = window
+
+	return nil
+}
+
+// ScanDirectory scans a directory for CSV files and processes them in parallel.
+// When ctx is cancelled, workers finish the batch they are inserting, files not
+// started yet are skipped, and the summary is still written; the returned
+// error then wraps ctx.Err().
+func (cs *CSVScanner) ScanDirectory(ctx context.Context, directoryPath string) error {
 	logger.Printf("Scanning directory: %s\n", directoryPath)
+	directoryPath = scanRoot(directoryPath)
 
 	// Check if directory exists
 	if _, err := os.Stat(directoryPath); os.IsNotExist(err) {
@@ -80,66 +455,257 @@ func (cs *CSVScanner) ScanDirectory(directoryPath string) error {
 	}
 
 	logger.Printf("Found %d CSV file(s) to process\n", len(csvFiles))
-	logger.Printf("Processing with %d parallel workers\n", cs.workerCount)
+	if err := cs.beginScan(); err != nil {
+		return err
+	}
+	defer cs.endScan()
 
 	// Process files in parallel
-	results := cs.processFilesParallel(csvFiles)
+	results := cs.processFilesParallel(ctx, csvFiles, 0)
 
 	// Display results summary
 	cs.displaySummary(results)
 
+	// Move imported files out of the way
+	cs.afterImport.apply(directoryPath, results)
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("scan cancelled: %w", err)
+	}
 	return nil
 }
 
-// findCSVFiles finds all CSV files in the specified directory (non-recursive)
+// beginScan logs the active settings and prepares the optional tables and
+// outputs used while importing; endScan releases them
+func (cs *CSVScanner) beginScan() error {
+	logger.Printf("Processing with %d parallel workers\n", cs.workerCount)
+	if cs.insertWorkers > 1 {
+		logger.Printf("Inserting each file with %d workers\n", cs.insertWorkers)
+	}
+	if cs.fileTransactions {
+		logger.Printf("Committing the readings of each file in one transaction\n")
+	}
+	switch cs.loadMethod {
+	case LoadMethodCopy:
+		logger.Printf("Loading batches with COPY; batches that need conflict handling are inserted\n")
+	case LoadMethodStaging:
+		logger.Printf("Loading batches through the staging table %s\n", cs.staging.name)
+	}
+	if cs.wideLayout {
+		logger.Println("Parsing files as wide format (one column per sensor)")
+	}
+	if cs.faults != nil {
+		logger.Warnf("Fault injection enabled: %s\n", cs.faults)
+	}
+	if cs.rawIngest {
+		logger.Printf("Writing to raw ingest table %s (run compact to deduplicate)\n", models.SensorDataRaw{}.TableName())
+		if cs.precedence != nil {
+			logger.Warnf("Duplicate precedence %s is not applied in raw ingest mode\n", cs.precedence.mode)
+		}
+	} else if cs.precedence != nil {
+		logger.Printf("Resolving duplicates with %s precedence\n", cs.precedence.mode)
+		if cs.upsertWindow > 0 {
+			logger.Warnf("Upsert window %v is not applied while duplicate precedence is enabled\n", cs.upsertWindow)
+		} else if cs.insertPolicy != InsertPolicyError {
+			logger.Warnf("Insert policy %s is not applied while duplicate precedence is enabled\n", cs.insertPolicy)
+		}
+	} else if cs.upsertWindow > 0 {
+		cs.upsertCutoff = time.Now().Add(-cs.upsertWindow)
+		logger.Printf("Existing readings: update after %s, skip before (upsert window %v)\n",
+			display.Time(cs.upsertCutoff.UTC(), time.RFC3339), cs.upsertWindow)
+	} else if cs.insertPolicy != InsertPolicyError {
+		logger.Printf("Existing readings: %s\n", cs.insertPolicy)
+	}
+	if !cs.acceptWindow.IsZero() {
+		logger.Printf("Accepting rows with timestamps in %s\n", cs.acceptWindow)
+	}
+	if cs.sensors.enabled() {
+		logger.Printf("Sensor filter: %s\n", cs.sensors)
+	}
+	if cs.files.enabled() {
+		logger.Printf("File filter: %s\n", cs.files)
+	}
+	if len(cs.transforms) > 0 {
+		logger.Printf("Transforming values with %d expression(s)\n", len(cs.transforms))
+	}
+	if cs.validator != nil {
+		logger.Printf("Validating readings with %d rule(s)\n", len(cs.validator.rules))
+	}
+	if len(cs.aggregations) > 0 {
+		if !cs.db.Migrator().HasTable(&models.SensorAggregate{}) || !cs.db.Migrator().HasTable(&models.SensorAggregatePart{}) {
+			return fmt.Errorf("aggregate tables %s and %s not found; run migrate first",
+				models.SensorAggregate{}.TableName(), models.SensorAggregatePart{}.TableName())
+		}
+		logger.Printf("Storing %d sensor pattern(s) as per-interval aggregates\n", len(cs.aggregations))
+	}
+	cs.enableManifest()
+	cs.openRun()
+	cs.enableLastValues()
+	cs.enableDeadLetters()
+	if cs.changelogPath != "" {
+		if cs.rawIngest {
+			logger.Warnf("Changelog %s is not written in raw ingest mode\n", cs.changelogPath)
+		} else {
+			changelog, err := openChangelog(cs.changelogPath)
+			if err != nil {
+				cs.endScan()
+				return err
+			}
+			cs.changelog = changelog
+			logger.Printf("Writing change events to %s\n", cs.changelogPath)
+		}
+	}
+	if cs.journalPath != "" {
+		journal, err := openJournal(cs.journalPath)
+		if err != nil {
+			cs.endScan()
+			return err
+		}
+		cs.journal = journal
+		logger.Printf("Recording imports in the journal %s\n", cs.journalPath)
+	}
+	if err := cs.openReadingSpool(); err != nil {
+		cs.endScan()
+		return err
+	}
+
+	return nil
+}
+
+// endScan closes the outputs opened by beginScan and ends the import run
+func (cs *CSVScanner) endScan() {
+	cs.closeReadingSpool()
+	cs.closeRun()
+	if err := cs.changelog.Close(); err != nil {
+		logger.Warnf("Failed to close changelog: %v\n", err)
+	}
+	cs.changelog = nil
+	if err := cs.journal.Close(); err != nil {
+		logger.Warnf("Failed to close import journal: %v\n", err)
+	}
+	cs.journal = nil
+}
+
+// findCSVFiles finds all CSV files in the specified directory, descending
+// into subdirectories when recursive scanning is enabled
 func (cs *CSVScanner) findCSVFiles(directoryPath string) ([]FileJob, error) {
 	var csvFiles []FileJob
+	filtered := 0
 
-	// Read directory contents
-	entries, err := os.ReadDir(directoryPath)
+	err := filepath.WalkDir(directoryPath, func(entryPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			// Skip subdirectories unless scanning recursively, and the archive of imported files
+			if entryPath != directoryPath && (!cs.recursive || cs.afterImport.isArchiveDir(directoryPath, entryPath)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		jobs, err := jobsForFile(directoryPath, entryPath)
+		if err != nil {
+			return err
+		}
+		allowed := cs.files.filter(jobs)
+		filtered += len(jobs) - len(allowed)
+		csvFiles = append(csvFiles, allowed...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	if filtered > 0 {
+		logger.Printf("Left out %d file(s) not selected by the file filter (%s)\n", filtered, cs.files)
+	}
 
-	// Process each entry
-	for _, entry := range entries {
-		// Skip subdirectories
-		if entry.IsDir() {
-			continue
+	if cs.recursive {
+		cs.logDirectoryCounts(csvFiles)
+	}
+
+	return csvFiles, nil
+}
+
+// jobsForFile returns the jobs for a file found in the scanned directory:
+// one per CSV member of a ZIP archive, one for a data file, or none
+func jobsForFile(directoryPath, entryPath string) ([]FileJob, error) {
+	relPath, err := filepath.Rel(directoryPath, entryPath)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(entryPath)
+
+	// Every CSV member of a ZIP archive becomes its own job
+	if isZipFile(name) {
+		members, err := listZipMembers(entryPath, relPath)
+		if err != nil {
+			// A corrupt archive should not abort the rest of the scan
+			logger.Errorf("Skipping archive: %v\n", err)
+			return nil, nil
 		}
+		return members, nil
+	}
+
+	// Check if file has a supported extension (optionally gzip-compressed),
+	// leaving out reject files written by earlier scans
+	if !isDataFile(name) || isRejectFile(name) {
+		return nil, nil
+	}
+	job := FileJob{
+		FilePath: entryPath,
+		FileName: filepath.ToSlash(relPath),
+		Dir:      filepath.Dir(relPath),
+	}
+	if info, err := os.Stat(entryPath); err == nil {
+		job.Size = info.Size()
+	}
+	return []FileJob{job}, nil
+}
 
-		// Check if file has CSV extension
-		if strings.ToLower(filepath.Ext(entry.Name())) == ".csv" {
-			filePath := filepath.Join(directoryPath, entry.Name())
-			csvFiles = append(csvFiles, FileJob{
-				FilePath: filePath,
-				FileName: entry.Name(),
-			})
+// logDirectoryCounts logs how many CSV files were found in each subdirectory
+func (cs *CSVScanner) logDirectoryCounts(files []FileJob) {
+	var dirs []string
+	counts := make(map[string]int)
+	for _, file := range files {
+		if counts[file.Dir] == 0 {
+			dirs = append(dirs, file.Dir)
 		}
+		counts[file.Dir]++
 	}
 
-	return csvFiles, nil
+	for _, dir := range dirs {
+		logger.Printf("  %s: %d CSV file(s)\n", dir, counts[dir])
+	}
 }
 
 // processFilesParallel processes CSV files in parallel using worker goroutines
-func (cs *CSVScanner) processFilesParallel(files []FileJob) []ProcessResult {
+// Once ctx is cancelled, files not started yet are returned as cancelled.
+// With a ramp-up interval, workers are started one at a time so a burst of
+// files does not hit the database with every worker at once.
+func (cs *CSVScanner) processFilesParallel(ctx context.Context, files []FileJob, rampUp time.Duration) []ProcessResult {
 	jobs := make(chan FileJob, len(files))
 	results := make(chan ProcessResult, len(files))
 
-	// Start worker goroutines
-	var wg sync.WaitGroup
-	for i := 0; i < cs.workerCount; i++ {
-		wg.Add(1)
-		go cs.worker(jobs, results, &wg)
+	cs.progress = startProgress(files)
+	defer func() {
+		cs.progress.stopProgress()
+		cs.progress = nil
+	}()
+
+	// Queue every job before starting workers so the queue depth is known
+	for _, file := range files {
+		jobs <- file
 	}
+	close(jobs)
+	cs.live.setRound(jobs)
+	defer cs.live.setRound(nil)
 
-	// Send jobs
-	go func() {
-		for _, file := range files {
-			jobs <- file
-		}
-		close(jobs)
-	}()
+	// Start worker goroutines
+	var wg sync.WaitGroup
+	wg.Add(1) // Held until every worker has been started
+	go cs.startWorkers(ctx, jobs, results, &wg, min(cs.workerCount, len(files)), rampUp)
 
 	// Collect results
 	go func() {
@@ -147,157 +713,675 @@ func (cs *CSVScanner) processFilesParallel(files []FileJob) []ProcessResult {
 		close(results)
 	}()
 
+	// Track remaining files per subdirectory for progress reporting
+	remaining := make(map[string]int)
+	dirRecords := make(map[string]int)
+	fileDirs := make(map[string]string)
+	for _, file := range files {
+		remaining[file.Dir]++
+		fileDirs[file.FileName] = file.Dir
+	}
+
 	var allResults []ProcessResult
 	for result := range results {
 		allResults = append(allResults, result)
+		cs.progress.finished(result.FileName)
+		cs.run.countFile(result)
+
+		dir := fileDirs[result.FileName]
+		dirRecords[dir] += result.RecordCount
+		remaining[dir]--
+		if cs.recursive && remaining[dir] == 0 {
+			logger.Printf("✓ Finished directory %s: %d records imported\n", dir, dirRecords[dir])
+		}
 	}
 
 	return allResults
 }
 
+// startWorkers starts count workers, waiting rampUp before each one after the
+// first. Ramping stops early once the queue is empty or ctx is cancelled.
+func (cs *CSVScanner) startWorkers(ctx context.Context, jobs <-chan FileJob, results chan<- ProcessResult, wg *sync.WaitGroup, count int, rampUp time.Duration) {
+	defer wg.Done()
+
+	for started := 0; started < count; started++ {
+		if started > 0 && rampUp > 0 {
+			select {
+			case <-time.After(rampUp):
+			case <-ctx.Done():
+				return
+			}
+			if len(jobs) == 0 {
+				return
+			}
+			logger.Printf("Starting worker %d of %d, %d file(s) queued\n", started+1, count, len(jobs))
+		}
+		wg.Add(1)
+		go cs.worker(ctx, jobs, results, wg)
+	}
+}
+
 // worker processes CSV files from the job channel
-func (cs *CSVScanner) worker(jobs <-chan FileJob, results chan<- ProcessResult, wg *sync.WaitGroup) {
+func (cs *CSVScanner) worker(ctx context.Context, jobs <-chan FileJob, results chan<- ProcessResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	for job := range jobs {
-		result := cs.processCSVFile(job)
+	for {
+		// A paused worker finishes its file, then waits before taking another
+		cs.pause.wait(ctx)
+		job, ok := <-jobs
+		if !ok {
+			return
+		}
+		if ctx.Err() != nil {
+			results <- ProcessResult{FilePath: job.FilePath, FileName: job.FileName, Cancelled: true}
+			continue
+		}
+		cs.live.begin(job.FileName)
+		result := cs.processFileRecovering(ctx, job)
+		cs.live.end(job.FileName)
+		cs.recordJournal(job, result)
 		results <- result
 	}
 }
 
+// processFileRecovering processes a file like processCSVFile, but a panic
+// fails the file instead of the whole run. The stack trace is logged with the
+// run ID so the failure can be matched to the import_runs record.
+func (cs *CSVScanner) processFileRecovering(ctx context.Context, job FileJob) (result ProcessResult) {
+	startTime := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("Panic while importing %s (run %d): %v\n%s", job.FileName, cs.run.id(), r, debug.Stack())
+			result = ProcessResult{
+				FilePath: job.FilePath,
+				FileName: job.FileName,
+				Error:    fmt.Errorf("panic: %v", r),
+				Duration: time.Since(startTime),
+			}
+		}
+	}()
+	return cs.processCSVFile(ctx, job)
+}
+
 // processCSVFile processes a single CSV file
-func (cs *CSVScanner) processCSVFile(job FileJob) ProcessResult {
+func (cs *CSVScanner) processCSVFile(ctx context.Context, job FileJob) ProcessResult {
 	startTime := time.Now()
 	result := ProcessResult{
-		FilePath: job.FilePath,
+		FilePath:   job.FilePath,
+		FileName:   job.FileName,
+		errorLimit: cs.errorLimit,
 	}
 
 	logger.Printf("Processing file: %s\n", job.FileName)
 
-	// Open CSV file
-	file, err := os.Open(job.FilePath)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to open file: %w", err)
+	// Enforce the filename convention before touching the file contents
+	if err := cs.checkFileName(&job); err != nil {
+		result.Error = err
 		result.Duration = time.Since(startTime)
 		return result
 	}
-	defer file.Close()
 
-	// Create CSV reader
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1 // Allow variable number of fields
+	// Take the sensor of rows without one from the file name
+	if sensorName, ok := cs.filenameMetadata.sensorFor(jobBaseName(job)); ok {
+		result.fileSensor = sensorName
+		logger.Debugf("Sensor of %s from its file name: %s\n", job.FileName, sensorName)
+	}
+
+	// Skip files whose contents were already imported
+	var fingerprint *fileFingerprint
+	if (cs.manifest || cs.checkpoints) && job.input == nil {
+		fp, err := fingerprintJob(job)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to hash file: %w", err)
+			result.Duration = time.Since(startTime)
+			return result
+		}
+		if cs.manifest && !cs.force {
+			imported, err := cs.alreadyImported(fp)
+			if err != nil {
+				result.Error = err
+				result.Duration = time.Since(startTime)
+				return result
+			}
+			if imported {
+				result.AlreadyDone = true
+				result.Duration = time.Since(startTime)
+				logger.Printf("Skipping %s: already imported (sha256 %s)\n", job.FileName, fp.hash[:12])
+				return result
+			}
+		}
+		fingerprint = &fp
+		result.SHA256 = fp.hash
+	}
 
-	// Read all records
-	records, err := reader.ReadAll()
+	// Open CSV file, decompressing gzip content on the fly
+	stageStart := time.Now()
+	file, err := cs.openJob(job)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to read CSV: %w", err)
+		result.Error = fmt.Errorf("failed to open file: %w", err)
 		result.Duration = time.Since(startTime)
 		return result
 	}
+	defer file.Close()
 
-	if len(records) == 0 {
-		result.Error = fmt.Errorf("empty CSV file")
+	// Convert the contents to UTF-8, dropping any byte order mark
+	input, err := cs.decodeInput(file, job.FileName)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read file: %w", err)
 		result.Duration = time.Since(startTime)
 		return result
 	}
 
-	// Process records (skip header if present)
-	sensorData, errorCount := cs.parseCSVRecords(records, job.FileName)
-	result.RecordCount = len(sensorData)
-	result.ErrorCount = errorCount
-
-	// Batch insert sensor data
-	if len(sensorData) > 0 {
-		if err := cs.batchInsertSensorData(sensorData); err != nil {
-			result.Error = fmt.Errorf("failed to insert data: %w", err)
+	// Pick the parser based on the file extension
+	fi := &fileImport{job: job, fingerprint: fingerprint}
+	defer fi.finishInserts()
+	var sensorData []models.SensorData
+	if isJSONLinesFile(job.FileName) {
+		records, err := readJSONLines(input, cs.jsonFields, job.FileName, &result)
+		result.Timings.Read = time.Since(stageStart)
+		if err != nil {
+			result.Error = err
+			result.Duration = time.Since(startTime)
+			return result
+		}
+
+		if len(records) == 0 {
+			result.Error = fmt.Errorf("empty JSON Lines file")
+			result.Duration = time.Since(startTime)
+			return result
+		}
+
+		stageStart = time.Now()
+		if !result.errorLimit.exceeded(&result, false) {
+			result.rowsParsed = 0 // The lines are counted again as rows
+			sensorData = cs.parseRows(records, 0, positionalColumns, job.FileName, &result)
+		}
+		result.Timings.Parse = time.Since(stageStart)
+	} else {
+		result.numbers = cs.numberFormatFor(job.FileName)
+
+		// Skip any metadata preamble before the header row
+		if cs.preamble.enabled() {
+			input, result.PreambleLines, err = cs.preamble.skip(input)
+			if err != nil {
+				result.Error = fmt.Errorf("failed to skip preamble: %w", err)
+				result.Duration = time.Since(startTime)
+				return result
+			}
+			logger.Debugf("Skipped %d preamble line(s) in %s\n", result.PreambleLines, job.FileName)
+		}
+
+		// Create CSV reader
+		reader := csv.NewReader(input)
+		reader.FieldsPerRecord = -1 // Allow variable number of fields
+
+		// Parse and insert large files a chunk at a time
+		if cs.maxRowsInMemory > 0 {
+			fi.chunked = true
+			result.chunked = true
+			if err := cs.importCSVChunks(ctx, fi, reader, &result); err != nil && result.Error == nil {
+				result.Error = err
+			}
+			if err := cs.writeRejects(job, &result); err != nil {
+				logger.Warnf("Failed to write rejected rows of %s: %v\n", job.FileName, err)
+			}
+			if result.Error == nil {
+				result.Error = fi.finishInserts()
+			}
+			if result.Error != nil {
+				result.Duration = time.Since(startTime)
+				return result
+			}
+			return cs.finishImport(fi, result, startTime)
+		}
+
+		// Read all records
+		records, err := reader.ReadAll()
+		result.Timings.Read = time.Since(stageStart)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to read CSV: %w", err)
+			result.Duration = time.Since(startTime)
+			return result
+		}
+
+		if len(records) == 0 {
+			result.Error = fmt.Errorf("empty CSV file")
+			result.Duration = time.Since(startTime)
+			return result
+		}
+
+		// Pre-aggregated files go to the aggregates, not sensor_data
+		stageStart = time.Now()
+		if !cs.parseSummaries(fi, records, &result) {
+			sensorData = cs.parseRecords(records, job.FileName, &result)
+		}
+		result.Timings.Parse = time.Since(stageStart)
+		if result.Error != nil {
 			result.Duration = time.Since(startTime)
 			return result
 		}
 	}
+	result.RecordCount += len(sensorData)
+
+	// Give up on a file with too many errors before anything is inserted
+	result.Error = result.errorLimit.check(&result, true)
+
+	// Quarantine rejected rows so they can be fixed and re-submitted
+	if err := cs.writeRejects(job, &result); err != nil {
+		logger.Warnf("Failed to write rejected rows of %s: %v\n", job.FileName, err)
+	}
+	if result.Error != nil {
+		result.Duration = time.Since(startTime)
+		return result
+	}
+
+	if err := cs.storeReadings(ctx, fi, sensorData, &result); err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	if err := fi.finishInserts(); err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+
+	return cs.finishImport(fi, result, startTime)
+}
+
+// finishImport records a completely stored file in the import manifest,
+// clears its checkpoint and logs what was done
+func (cs *CSVScanner) finishImport(fi *fileImport, result ProcessResult, startTime time.Time) ProcessResult {
+	job := fi.job
+
+	// Store the aggregates once every row of the file was seen
+	if err := cs.storeAggregates(fi); err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+
+	// Remember the file so later scans skip it
+	if fi.batchID != 0 {
+		result.Duration = time.Since(startTime)
+		if err := cs.recordImport(fi.batchID, result); err != nil {
+			logger.Warnf("Failed to record %s in the import manifest: %v\n", job.FileName, err)
+		}
+	}
+	if fi.checkpoint != nil {
+		if err := fi.checkpoint.clear(cs.db); err != nil {
+			logger.Warnf("Failed to clear the checkpoint of %s: %v\n", job.FileName, err)
+		}
+	}
 
 	result.Duration = time.Since(startTime)
 	logger.Printf("✓ Completed %s: %d records processed, %d errors in %v\n",
 		job.FileName, result.RecordCount, result.ErrorCount, result.Duration)
+	if result.DroppedCount > 0 {
+		logger.Printf("  %s: %d rows outside the accept window dropped\n", job.FileName, result.DroppedCount)
+	}
+	if result.FilteredCount > 0 {
+		logger.Printf("  %s: %d readings of filtered sensors left out\n", job.FileName, result.FilteredCount)
+	}
+	if result.FooterRows > 0 {
+		logger.Printf("  %s: %d summary rows skipped\n", job.FileName, result.FooterRows)
+	}
+	if result.ViolationCount > 0 || result.CadenceCount > 0 {
+		logger.Printf("  %s: %d readings rejected by validation rules, %d off their reporting interval\n",
+			job.FileName, result.ViolationCount, result.CadenceCount)
+	}
+	if result.ConflictCount > 0 {
+		logger.Printf("  %s: %d duplicate conflicts resolved by %s precedence\n",
+			job.FileName, result.ConflictCount, cs.precedence.mode)
+	}
+	if result.SkippedCount > 0 {
+		logger.Printf("  %s: %d existing readings skipped\n", job.FileName, result.SkippedCount)
+	}
+	if result.AggregatedCount > 0 {
+		logger.Printf("  %s: %d readings of aggregated sensors stored as aggregates\n", job.FileName, result.AggregatedCount)
+	}
+	if result.SummaryCount > 0 {
+		logger.Printf("  %s: %d pre-aggregated intervals stored as aggregates\n", job.FileName, result.SummaryCount)
+	}
+	if result.DeadLettered > 0 {
+		logger.Warnf("  %s: %d readings failed to insert and were kept in %s (see rejects:retry)\n",
+			job.FileName, result.DeadLettered, models.SensorDataReject{}.TableName())
+	}
+	if result.Spooled > 0 {
+		logger.Warnf("  %s: %d readings spooled locally while the database was unreachable\n", job.FileName, result.Spooled)
+	}
+	if result.RejectFile != "" {
+		logger.Printf("  %s: %d rejected rows written to %s\n", job.FileName, len(result.rejects), result.RejectFile)
+	}
+	if result.ResumedAfter > 0 {
+		logger.Printf("  %s: resumed after %d readings committed by an earlier run\n", job.FileName, result.ResumedAfter)
+	}
 
 	return result
 }
 
-// parseCSVRecords parses CSV records into SensorData structs
-func (cs *CSVScanner) parseCSVRecords(records [][]string, fileName string) ([]models.SensorData, int) {
-	var sensorData []models.SensorData
-	var errorCount int
+// openJob opens the data stream for a job, reading from inside a ZIP archive
+// or from the job's input stream when needed
+func (cs *CSVScanner) openJob(job FileJob) (io.ReadCloser, error) {
+	if job.input != nil {
+		return wrapDecompressor(job.input, io.NopCloser(job.input), job.FileName)
+	}
+	if job.Member != "" {
+		return openZipMember(job.FilePath, job.Member)
+	}
+	return openDataFile(job.FilePath)
+}
+
+// stampSource sets the source file and its modification time on every reading
+func (cs *CSVScanner) stampSource(job FileJob, data []models.SensorData) {
+	if job.input != nil {
+		source := job.source
+		if source == "" {
+			source = "stdin:" + job.FileName
+		}
+		for i := range data {
+			data[i].SourceFile = &source
+			data[i].SourceModifiedAt = nil
+		}
+		return
+	}
+
+	source := job.source
+	if source == "" {
+		source = storedPath(scanRoot(job.FilePath))
+	}
+	if job.Member != "" {
+		source += "/" + job.Member
+	}
+
+	var modified *time.Time
+	if info, err := os.Stat(job.FilePath); err == nil {
+		modTime := info.ModTime().UTC()
+		modified = &modTime
+	}
+
+	for i := range data {
+		data[i].SourceFile = &source
+		data[i].SourceModifiedAt = modified
+	}
+}
+
+// checkFileName matches the file name against the configured template and
+// records the captured fields on the job
+func (cs *CSVScanner) checkFileName(job *FileJob) error {
+	if cs.filenameTemplate == nil {
+		return nil
+	}
+
+	fields, ok := cs.filenameTemplate.Match(jobBaseName(*job))
+	if !ok {
+		if cs.rejectNonConforming {
+			return fmt.Errorf("file name does not match required pattern %s", cs.filenameTemplate)
+		}
+		logger.Warnf("File name %s does not match expected pattern %s\n", job.FileName, cs.filenameTemplate)
+		return nil
+	}
+
+	job.Fields = fields
+	if len(fields) > 0 {
+		logger.Debugf("File name fields for %s: %v\n", job.FileName, fields)
+	}
+
+	return nil
+}
+
+// jobBaseName returns the name of a job's file without directories or a .gz
+// extension, as matched by filename conventions
+func jobBaseName(job FileJob) string {
+	name := filepath.Base(job.FilePath)
+	if job.Member != "" {
+		name = path.Base(job.Member)
+	}
+	return baseCSVName(name)
+}
+
+// parseRecords parses CSV records in the configured layout
+func (cs *CSVScanner) parseRecords(records [][]string, fileName string, result *ProcessResult) []models.SensorData {
+	if cs.wideLayout {
+		// One column per sensor
+		return cs.parseWideRecords(records, fileName, result)
+	}
+	// Process records (skip header if present)
+	return cs.parseCSVRecords(records, fileName, result)
+}
+
+// parseCSVRecords parses CSV records into SensorData structs, counting
+// rejected and dropped rows on the result
+func (cs *CSVScanner) parseCSVRecords(records [][]string, fileName string, result *ProcessResult) []models.SensorData {
+	// An explicit column mapping for this file takes precedence over detection
+	if mapping, ok := cs.columnMappingFor(fileName); ok {
+		startRow := 0
+		var header []string
+		if len(records) > 0 && (mapping.usesHeaderNames() || cs.isHeaderRow(records[0], positionalColumns.minColumns())) {
+			startRow = 1
+			header = records[0]
+			result.rejectHeader = header
+		}
+
+		columns, err := mapping.resolve(header)
+		if err != nil {
+			result.Error = fmt.Errorf("column mapping %s: %w", mapping.files, err)
+			return nil
+		}
+		logger.Debugf("Columns in %s mapped by %s: %s\n", fileName, mapping.files, columns)
+
+		return cs.parseRows(records, startRow, columns, fileName, result)
+	}
 
 	// Detect if first row is header
 	startRow := 0
-	if len(records) > 0 && cs.isHeaderRow(records[0]) {
+	columns := positionalColumns
+	if result.fileSensor != "" && len(records) > 0 && len(records[0]) == 2 {
+		// Files naming their sensor may leave out the sensor column
+		columns = fileSensorColumns
+	}
+	if len(records) > 0 && cs.isHeaderRow(records[0], columns.minColumns()) {
 		startRow = 1
+		result.rejectHeader = records[0]
+
+		// Map columns by header name so reordered exports still import
+		if mapped, ok := cs.headers.mapColumns(records[0], result.fileSensor != ""); ok {
+			columns = mapped
+			if columns.String() != positionalColumns.String() {
+				logger.Debugf("Columns in %s mapped by header: %s\n", fileName, columns)
+			}
+		} else {
+			logger.Debugf("Header of %s not recognized, using positional columns\n", fileName)
+		}
 	}
 
+	return cs.parseRows(records, startRow, columns, fileName, result)
+}
+
+// columnMappingFor returns the first configured column mapping matching the file
+func (cs *CSVScanner) columnMappingFor(fileName string) (columnMapping, bool) {
+	for _, mapping := range cs.columnMappings {
+		if mapping.matchesFile(fileName) {
+			return mapping, true
+		}
+	}
+	return columnMapping{}, false
+}
+
+// parseRows parses timestamp, sensor_name, value rows starting at startRow
+func (cs *CSVScanner) parseRows(records [][]string, startRow int, columns columnMap, fileName string, result *ProcessResult) []models.SensorData {
+	var sensorData []models.SensorData
+
 	for i := startRow; i < len(records); i++ {
+		// Stop parsing a file with too many errors to be worth finishing
+		if result.errorLimit.exceeded(result, false) {
+			break
+		}
+		result.rowsParsed++
+
 		record := records[i]
+		row := i + 1 + result.PreambleLines + result.rowOffset
 
 		// Skip empty rows
 		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
 			continue
 		}
 
-		// Expect at least 3 columns: timestamp, sensor_name, value
-		if len(record) < 3 {
-			errorCount++
-			logger.Warnf("Row %d in %s has insufficient columns (expected 3, got %d)\n",
-				i+1, fileName, len(record))
+		// Skip summary rows rather than reporting them as bad readings
+		if cs.skipFooter(record, row, fileName, result) {
 			continue
 		}
 
-		// Parse timestamp
-		timestampStr := strings.TrimSpace(record[0])
-		timestamp, err := time.Parse(time.RFC3339, timestampStr)
-		if err != nil {
-			// Try alternative formats
-			if timestamp, err = time.Parse("2006-01-02T15:04:05", timestampStr); err != nil {
-				if timestamp, err = time.Parse("2006-01-02 15:04:05", timestampStr); err != nil {
-					errorCount++
-					logger.Warnf("Row %d in %s has invalid timestamp format: %s\n",
-						i+1, fileName, timestampStr)
-					continue
-				}
-			}
+		// Expect enough columns for timestamp, sensor_name and value
+		if len(record) < columns.minColumns() {
+			result.reject(fileName, row, record, ErrorShortRow, fmt.Sprintf("insufficient columns (expected %d, got %d)",
+				columns.minColumns(), len(record)))
+			continue
 		}
 
-		// Parse sensor name
-		sensorName := strings.TrimSpace(record[1])
-		if sensorName == "" {
-			errorCount++
-			logger.Warnf("Row %d in %s has empty sensor name\n", i+1, fileName)
+		timestampCell, sensorCell, valueCell, err := columns.cells(record)
+		if err != nil {
+			result.reject(fileName, row, record, ErrorMalformed, err.Error())
 			continue
 		}
 
-		// Parse value
-		valueStr := strings.TrimSpace(record[2])
-		value, err := strconv.ParseFloat(valueStr, 64)
-		if err != nil {
-			errorCount++
-			logger.Warnf("Row %d in %s has invalid value: %s\n", i+1, fileName, valueStr)
+		timestamp, ok := cs.parseTimestamp(timestampCell, record, row, fileName, result)
+		if !ok {
 			continue
 		}
 
-		// Create sensor data entry
-		sensorData = append(sensorData, models.SensorData{
-			Timestamp:  timestamp.UTC(),
-			SensorName: sensorName,
-			Value:      value,
-		})
+		reading, ok := cs.parseReading(timestamp, sensorCell, valueCell, record, row, fileName, result)
+		if ok {
+			sensorData = append(sensorData, reading)
+		}
+	}
+
+	return sensorData
+}
+
+// skipFooter reports whether a row is a summary row and counts it
+func (cs *CSVScanner) skipFooter(record []string, row int, fileName string, result *ProcessResult) bool {
+	if !cs.footers.matches(record) {
+		return false
+	}
+	result.FooterRows++
+	logger.Debugf("Row %d in %s is a summary row, skipped\n", row, fileName)
+	return true
+}
+
+// parseTimestamp parses a timestamp cell with the configured layouts, rejecting
+// the row when none of them match. Timestamps without an offset are read in
+// the file's source timezone.
+func (cs *CSVScanner) parseTimestamp(cell string, record []string, row int, fileName string, result *ProcessResult) (time.Time, bool) {
+	timestampStr := strings.TrimSpace(cell)
+	location := cs.locationFor(fileName)
+	for _, layout := range cs.timestampFormats {
+		if timestamp, err := time.ParseInLocation(layout, timestampStr, location); err == nil {
+			return timestamp.UTC(), true
+		}
 	}
 
-	return sensorData, errorCount
+	result.reject(fileName, row, record, ErrorBadTimestamp, "invalid timestamp format: "+timestampStr)
+	return time.Time{}, false
+}
+
+// parseReading validates the sensor name and value of a reading at a parsed timestamp
+func (cs *CSVScanner) parseReading(timestamp time.Time, sensorCell, valueCell string, record []string, row int, fileName string, result *ProcessResult) (models.SensorData, bool) {
+	// Drop rows outside the accept window
+	if !cs.batchAcceptWindow(result).Contains(timestamp) {
+		result.DroppedCount++
+		return models.SensorData{}, false
+	}
+
+	sensorName, ok := cs.resolveSensor(sensorCell, record, row, fileName, result)
+	if !ok {
+		return models.SensorData{}, false
+	}
+
+	// Parse value
+	valueStr := strings.TrimSpace(valueCell)
+	number, ok := result.numbers.normalize(valueStr)
+	value, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil {
+		result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("invalid value for %s: %s", sensorName, valueStr))
+		return models.SensorData{}, false
+	}
+
+	// Convert raw counts and units with the sensor's transform
+	value, err = cs.transforms.apply(sensorName, value)
+	if err != nil {
+		result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("invalid value for %s: %s: %v", sensorName, valueStr, err))
+		return models.SensorData{}, false
+	}
+
+	// Reject non-finite and implausibly large values
+	if err := cs.valueChecks.check(sensorName, value); err != nil {
+		result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("out-of-range value %s for %s: %v", valueStr, sensorName, err))
+		return models.SensorData{}, false
+	}
+	// Enforce the configured validation rules
+	if err := cs.validator.check(sensorName, value); err != nil {
+		result.violate(fileName, row, record, err.Error())
+		return models.SensorData{}, false
+	}
+	if violation := cs.validator.checkCadence(result, sensorName, timestamp); violation != "" {
+		result.CadenceCount++
+		logger.Warnf("Row %d in %s: %s\n", row, fileName, violation)
+	}
+	if significantDigits(number) > maxExactDigits {
+		logger.Debugf("Row %d in %s value %s exceeds float64 precision and will be stored as %v\n",
+			row, fileName, valueStr, value)
+	}
+
+	return models.SensorData{
+		Timestamp:  timestamp,
+		SensorName: sensorName,
+		Value:      value,
+	}, true
+}
+
+// resolveSensor parses the sensor name of a row, falling back to the one named
+// by the file name, and maps it to its canonical name. It reports false for
+// rows rejected or left out by the sensor filters.
+func (cs *CSVScanner) resolveSensor(sensorCell string, record []string, row int, fileName string, result *ProcessResult) (string, bool) {
+	sensorName := strings.TrimSpace(sensorCell)
+	if sensorName == "" {
+		sensorName = result.fileSensor
+	}
+	if sensorName == "" {
+		result.reject(fileName, row, record, ErrorEmptySensor, "empty sensor name")
+		return "", false
+	}
+
+	// Map former names of a sensor to its canonical name
+	sensorName, known := cs.sensorAliases.resolve(sensorName)
+	if !known {
+		result.reject(fileName, row, record, ErrorUnknownSensor, "unknown sensor name: "+sensorName)
+		return "", false
+	}
+
+	// Leave out sensors not selected by the include/exclude filters
+	if !cs.sensors.allows(sensorName) {
+		result.FilteredCount++
+		return "", false
+	}
+	return sensorName, true
 }
 
-// isHeaderRow checks if the first row is likely a header
-func (cs *CSVScanner) isHeaderRow(row []string) bool {
-	if len(row) < 3 {
+// isHeaderRow checks if the first row, expected to have at least minColumns
+// cells, is likely a header
+func (cs *CSVScanner) isHeaderRow(row []string, minColumns int) bool {
+	if len(row) < minColumns {
 		return false
 	}
 
+	// Any cell matching a known column name marks a header
+	for _, cell := range row {
+		if cs.headers.isKnownHeader(cell) {
+			return true
+		}
+	}
+
 	// Check if first column looks like a timestamp or contains header words
 	firstCol := strings.ToLower(strings.TrimSpace(row[0]))
 	headerWords := []string{"timestamp", "time", "date", "datetime"}
@@ -313,55 +1397,279 @@ func (cs *CSVScanner) isHeaderRow(row []string) bool {
 	return err != nil
 }
 
-// batchInsertSensorData inserts sensor data in batches to improve performance
-func (cs *CSVScanner) batchInsertSensorData(data []models.SensorData) error {
-	const batchSize = 1000
+// targetTableName returns the name of the table readings are written to
+func (cs *CSVScanner) targetTableName() string {
+	if cs.rawIngest {
+		return models.SensorDataRaw{}.TableName()
+	}
+	return models.SensorData{}.TableName()
+}
+
+// targetTable returns a session writing to the table selected by the ingest mode
+func (cs *CSVScanner) targetTable(db *gorm.DB) *gorm.DB {
+	if cs.rawIngest {
+		return db.Table(models.SensorDataRaw{}.TableName())
+	}
+	return db
+}
 
-	for i := 0; i < len(data); i += batchSize {
-		end := i + batchSize
+// batchInsertSensorData inserts sensor data in batches to improve performance.
+// With a checkpoint, the committed offset is saved after every batch. A
+// cancelled ctx stops it between batches, so the batch in flight is committed.
+func (cs *CSVScanner) batchInsertSensorData(ctx context.Context, data []models.SensorData, result *ProcessResult, checkpoint *fileCheckpoint) error {
+	cs.linkRun(data)
+
+	step := cs.transactionSize(len(data))
+	for i := 0; i < len(data); i += step {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("cancelled after %d of %d readings: %w", i, len(data), err)
+		}
+
+		end := i + step
 		if end > len(data) {
 			end = len(data)
 		}
 
-		batch := data[i:end]
+		if err := cs.insertSensorBatch(data[i:end], result, checkpoint, end); err != nil {
+			return err
+		}
+		cs.progress.inserted(result, end-i, len(data)-i)
+		cs.live.inserted(result.FileName, end-i)
+	}
+
+	return nil
+}
+
+// linkRun links every reading to the import run
+func (cs *CSVScanner) linkRun(data []models.SensorData) {
+	if runID := cs.run.id(); runID != 0 {
+		for i := range data {
+			data[i].SourceRunID = &runID
+		}
+	}
+}
+
+// insertSensorBatch inserts one batch of readings. A batch that fails is
+// spooled when the database is unreachable, or else inserted row by row.
+// With a checkpoint, end is saved as the committed offset.
+func (cs *CSVScanner) insertSensorBatch(batch []models.SensorData, result *ProcessResult, checkpoint *fileCheckpoint, end int) error {
+	if cs.faults.dropBatch() {
+		logger.Warnf("Fault injection: dropped batch of %d records\n", len(batch))
+		return nil
+	}
 
-		// Use GORM's CreateInBatches for efficient batch insertion
-		if err := cs.db.CreateInBatches(batch, batchSize).Error; err != nil {
-			// If batch insert fails, try individual inserts to identify problematic records
-			return cs.individualInsert(batch)
+	// While the database is unreachable, readings go straight to the spool
+	if cs.spool != nil && cs.spool.offline.Load() && cs.spoolBatch(batch, result) {
+		return nil
+	}
+
+	// Use GORM's CreateInBatches for efficient batch insertion
+	err := cs.faults.beforeInsert()
+	if err == nil && cs.precedence != nil && !cs.rawIngest {
+		var conflicts int
+		var events []changeEvent
+		conflicts, events, err = cs.insertWithPrecedence(batch)
+		result.ConflictCount += conflicts
+		if err == nil {
+			cs.changelog.write(result.FileName, events)
+			cs.run.countRecords(len(batch))
+		}
+	} else if err == nil {
+		// Commit the batch and its checkpoint together
+		var skipped int
+		var events []changeEvent
+		err = cs.loadTransaction(func(tx *gorm.DB) error {
+			var txErr error
+			if skipped, events, txErr = cs.insertWithPolicy(tx, batch); txErr != nil {
+				return txErr
+			}
+			if checkpoint != nil {
+				return checkpoint.save(tx, end)
+			}
+			return nil
+		})
+		if err == nil {
+			result.SkippedCount += skipped
+			cs.changelog.write(result.FileName, events)
+			cs.run.countRecords(len(batch) - skipped)
+			return nil
+		}
+	}
+	if err != nil {
+		// Keep the batch locally if the database went away
+		if cs.spoolBatch(batch, result) {
+			return nil
+		}
+		// If batch insert fails, try individual inserts to identify problematic records
+		if err := cs.individualInsert(batch, result); err != nil {
+			return err
 		}
 	}
 
+	if checkpoint != nil {
+		if err := checkpoint.save(cs.db, end); err != nil {
+			logger.Warnf("Failed to save checkpoint for %s: %v\n", checkpoint.fileName, err)
+		}
+	}
 	return nil
 }
 
-// individualInsert attempts to insert records individually when batch insert fails
-func (cs *CSVScanner) individualInsert(data []models.SensorData) error {
+// insertWithPolicy inserts a batch in a transaction with the insert policy
+// or upsert window, updating the last values, and returns the number of
+// existing rows skipped and the change events
+func (cs *CSVScanner) insertWithPolicy(tx *gorm.DB, batch []models.SensorData) (int, []changeEvent, error) {
+	var skipped int
+	var events []changeEvent
+	for _, part := range cs.policyBatches(batch) {
+		partEvents, err := cs.batchEvents(tx, part.rows, part.policy)
+		if err != nil {
+			return 0, nil, err
+		}
+		partSkipped, err := cs.insertBatch(tx, part.rows, part.policy)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err = cs.updateLastValues(tx, part.rows, part.policy == InsertPolicyUpdate); err != nil {
+			return 0, nil, err
+		}
+		events = append(events, partEvents...)
+		skipped += partSkipped
+	}
+	return skipped, events, nil
+}
+
+// individualInsert attempts to insert records individually when batch insert
+// fails, with the insert policy of each record. Records that still fail are
+// kept in the dead-letter table when it exists, so the file does not fail
+// over them.
+func (cs *CSVScanner) individualInsert(data []models.SensorData, result *ProcessResult) error {
+	fileName := result.FileName
 	var lastError error
-	successCount := 0
+	var inserted, updated []models.SensorData
+	var events []changeEvent
+	var skipped int
+	var failed []models.SensorDataReject
 
 	for _, record := range data {
-		if err := cs.db.Create(&record).Error; err != nil {
+		policy := cs.policyBatches([]models.SensorData{record})[0].policy
+		db := cs.targetTable(cs.db)
+		if onConflict, ok := conflictClause(policy); ok && !cs.rawIngest {
+			db = db.Clauses(onConflict)
+		}
+
+		recordEvents, err := cs.batchEvents(cs.db, []models.SensorData{record}, policy)
+		if err == nil {
+			err = cs.faults.beforeInsert()
+		}
+		var rowsAffected int64
+		if err == nil {
+			insert := db.Create(&record)
+			err, rowsAffected = insert.Error, insert.RowsAffected
+		}
+		switch {
+		case err != nil:
 			lastError = err
 			// Log the error but continue with other records
 			logger.Warnf("Failed to insert record %s at %s: %v\n",
 				record.SensorName, record.Timestamp.Format(time.RFC3339), err)
+			failed = append(failed, deadLetter(record, fileName, err))
+		case policy == InsertPolicySkip && rowsAffected == 0:
+			skipped++
+		case policy == InsertPolicyUpdate:
+			updated = append(updated, record)
+			events = append(events, recordEvents...)
+		default:
+			inserted = append(inserted, record)
+			events = append(events, recordEvents...)
+		}
+	}
+	successCount := len(inserted) + len(updated)
+	result.SkippedCount += skipped
+	result.FailedCount += len(failed)
+	cs.run.countRecords(successCount)
+	if !cs.rawIngest {
+		cs.changelog.write(fileName, events)
+	}
+
+	if err := cs.updateLastValues(cs.db, inserted, false); err != nil {
+		logger.Warnf("%v\n", err)
+	}
+	if err := cs.updateLastValues(cs.db, updated, true); err != nil {
+		logger.Warnf("%v\n", err)
+	}
+
+	if len(failed) > 0 && cs.deadLetters {
+		if err := cs.db.CreateInBatches(failed, cs.batchSize).Error; err != nil {
+			logger.Warnf("Failed to keep %d records in %s: %v\n", len(failed), models.SensorDataReject{}.TableName(), err)
 		} else {
-			successCount++
+			result.DeadLettered += len(failed)
+			lastError = nil
 		}
 	}
 
-	if successCount == 0 && lastError != nil {
+	if successCount+skipped == 0 && lastError != nil {
 		return fmt.Errorf("failed to insert any records: %w", lastError)
 	}
 
-	if lastError != nil {
+	if len(failed) > 0 {
 		logger.Printf("Inserted %d out of %d records with some errors\n", successCount, len(data))
 	}
 
 	return nil
 }
 
+// topErrorFiles is how many files the summary lists by parsing errors
+const topErrorFiles = 5
+
+// displayErrorBreakdown lists the parsing errors by category and the files
+// with the most of them, so the dominant failure is visible at a glance
+func displayErrorBreakdown(results []ProcessResult, totalErrors int) {
+	byCategory := make(map[string]int)
+	var files []ProcessResult
+	for _, result := range results {
+		if result.Error != nil || result.ErrorCount == 0 {
+			continue
+		}
+		for category, count := range result.ErrorsByCategory {
+			byCategory[category] += count
+		}
+		files = append(files, result)
+	}
+
+	for _, category := range categoriesByCount(byCategory) {
+		if count := byCategory[category]; count > 0 {
+			logger.Printf("  %-14s %s (%.0f%%)\n", category+":", display.Number(count), 100*float64(count)/float64(totalErrors))
+		}
+	}
+
+	if len(files) < 2 {
+		return
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].ErrorCount > files[j].ErrorCount })
+	logger.Println("Files with the most parsing errors:")
+	for _, result := range files[:min(len(files), topErrorFiles)] {
+		logger.Printf("  %s: %s (%s)\n", result.FileName, display.Number(result.ErrorCount), errorMix(result.ErrorsByCategory))
+	}
+}
+
+// categoriesByCount orders the error categories by their count, largest first
+func categoriesByCount(byCategory map[string]int) []string {
+	categories := append([]string{}, errorCategories...)
+	sort.SliceStable(categories, func(i, j int) bool { return byCategory[categories[i]] > byCategory[categories[j]] })
+	return categories
+}
+
+// errorMix describes the parsing errors of a file by category, largest first
+func errorMix(byCategory map[string]int) string {
+	var parts []string
+	for _, category := range categoriesByCount(byCategory) {
+		if count := byCategory[category]; count > 0 {
+			parts = append(parts, display.Number(count)+" "+category)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 // displaySummary displays a summary of the processing results
 func (cs *CSVScanner) displaySummary(results []ProcessResult) {
 	logger.Println("\n" + strings.Repeat("=", 60))
@@ -371,30 +1679,89 @@ func (cs *CSVScanner) displaySummary(results []ProcessResult) {
 	totalFiles := len(results)
 	totalRecords := 0
 	totalErrors := 0
+	totalDropped := 0
+	totalFiltered := 0
+	totalViolations := 0
+	totalCadence := 0
+	totalConflicts := 0
+	totalSkipped := 0
+	totalDeadLettered := 0
+	totalSpooled := 0
 	successfulFiles := 0
+	alreadyImported := 0
+	cancelledFiles := 0
 	failedFiles := 0
 	totalDuration := time.Duration(0)
+	var totalTimings StageTimings
 
 	for _, result := range results {
 		if result.Error != nil {
 			failedFiles++
-			logger.Printf("❌ %s: FAILED - %v\n", filepath.Base(result.FilePath), result.Error)
+			logger.Printf("❌ %s: FAILED - %v\n", result.FileName, result.Error)
+		} else if result.AlreadyDone {
+			alreadyImported++
+			logger.Printf("⏭️  %s: already imported, skipped\n", result.FileName)
+		} else if result.Cancelled {
+			cancelledFiles++
+			logger.Printf("⏹️  %s: not processed, scan cancelled\n", result.FileName)
 		} else {
 			successfulFiles++
 			totalRecords += result.RecordCount
 			totalErrors += result.ErrorCount
-			logger.Printf("✅ %s: %d records, %d errors (%v)\n",
-				filepath.Base(result.FilePath), result.RecordCount, result.ErrorCount, result.Duration)
+			totalDropped += result.DroppedCount
+			totalFiltered += result.FilteredCount
+			totalViolations += result.ViolationCount
+			totalCadence += result.CadenceCount
+			totalConflicts += result.ConflictCount
+			totalSkipped += result.SkippedCount
+			totalDeadLettered += result.DeadLettered
+			totalSpooled += result.Spooled
+			logger.Printf("✅ %s: %s records, %s errors (%v; %s)\n", result.FileName,
+				display.Number(result.RecordCount), display.Number(result.ErrorCount), result.Duration, result.Timings)
 		}
 		totalDuration += result.Duration
+		totalTimings.Add(result.Timings)
 	}
 
 	logger.Println(strings.Repeat("-", 60))
-	logger.Printf("Total files processed: %d\n", totalFiles)
-	logger.Printf("Successful: %d\n", successfulFiles)
-	logger.Printf("Failed: %d\n", failedFiles)
-	logger.Printf("Total records imported: %d\n", totalRecords)
-	logger.Printf("Total parsing errors: %d\n", totalErrors)
+	logger.Printf("Total files processed: %s\n", display.Number(totalFiles))
+	logger.Printf("Successful: %s\n", display.Number(successfulFiles))
+	logger.Printf("Failed: %s\n", display.Number(failedFiles))
+	if alreadyImported > 0 {
+		logger.Printf("Already imported: %s\n", display.Number(alreadyImported))
+	}
+	if cancelledFiles > 0 {
+		logger.Printf("Not processed (cancelled): %s\n", display.Number(cancelledFiles))
+	}
+	logger.Printf("Total records imported: %s\n", display.Number(totalRecords))
+	logger.Printf("Total parsing errors: %s\n", display.Number(totalErrors))
+	if totalErrors > 0 {
+		displayErrorBreakdown(results, totalErrors)
+	}
+	if !cs.acceptWindow.IsZero() {
+		logger.Printf("Total rows outside accept window: %s\n", display.Number(totalDropped))
+	}
+	if cs.sensors.enabled() {
+		logger.Printf("Total readings of filtered sensors: %s\n", display.Number(totalFiltered))
+	}
+	if cs.validator != nil {
+		logger.Printf("Total validation violations: %s\n", display.Number(totalViolations))
+		logger.Printf("Total readings off their reporting interval: %s\n", display.Number(totalCadence))
+	}
+	if cs.precedence != nil {
+		logger.Printf("Total duplicate conflicts resolved: %s\n", display.Number(totalConflicts))
+	} else if (cs.insertPolicy == InsertPolicySkip || cs.upsertWindow > 0) && !cs.rawIngest {
+		logger.Printf("Total existing readings skipped: %s\n", display.Number(totalSkipped))
+	}
+	if totalDeadLettered > 0 {
+		logger.Printf("Total readings kept in %s: %s (replay with rejects:retry)\n",
+			models.SensorDataReject{}.TableName(), display.Number(totalDeadLettered))
+	}
+	if totalSpooled > 0 {
+		logger.Printf("Total readings spooled to %s: %s (inserted once the database is reachable)\n",
+			cs.spoolPath, display.Number(totalSpooled))
+	}
 	logger.Printf("Total processing time: %v\n", totalDuration)
+	logger.Printf("Time by stage: %s\n", totalTimings)
 	logger.Println(strings.Repeat("=", 60))
 }
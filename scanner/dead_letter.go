@@ -0,0 +1,167 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// maxDeadLetterError is the longest error message kept with a dead letter
+const maxDeadLetterError = 1024
+
+// enableDeadLetters keeps readings that fail to insert when the dead-letter
+// table exists
+func (cs *CSVScanner) enableDeadLetters() {
+	cs.deadLetters = cs.db.Migrator().HasTable(&models.SensorDataReject{})
+	if !cs.deadLetters {
+		logger.Debugf("Dead-letter table %s not found, readings that fail to insert are only logged\n",
+			models.SensorDataReject{}.TableName())
+	}
+}
+
+// deadLetter builds the dead-letter row of a reading that failed to insert
+func deadLetter(record models.SensorData, fileName string, err error) models.SensorDataReject {
+	return models.SensorDataReject{
+		Timestamp:    record.Timestamp,
+		SensorName:   record.SensorName,
+		Value:        record.Value,
+		SourceFile:   storedPath(fileName),
+		ImportFileID: record.ImportFileID,
+		Error:        truncateError(err),
+		Attempts:     1,
+	}
+}
+
+// truncateError shortens an error message to fit the error column
+func truncateError(err error) string {
+	message := err.Error()
+	if len(message) > maxDeadLetterError {
+		message = message[:maxDeadLetterError]
+	}
+	return message
+}
+
+// RetryResult counts what a dead-letter replay did
+type RetryResult struct {
+	Retried  int
+	Inserted int
+	Skipped  int // Existing readings kept by the insert policy
+	Failed   int // Still failing, left in the dead-letter table
+}
+
+// RetryRejects replays the readings of the dead-letter table whose source
+// file matches pattern (all when empty), oldest first. Each reading that is
+// inserted, or skipped as existing, is removed from the table in the same
+// transaction; a reading that fails again stays with its new error. With
+// dryRun, only the matching readings are counted.
+func (cs *CSVScanner) RetryRejects(ctx context.Context, pattern string, dryRun bool) (RetryResult, error) {
+	var result RetryResult
+	if pattern != "" {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return result, fmt.Errorf("invalid source pattern %q: %w", pattern, err)
+		}
+	}
+	if !cs.db.Migrator().HasTable(&models.SensorDataReject{}) {
+		return result, fmt.Errorf("dead-letter table %s not found; run migrate first", models.SensorDataReject{}.TableName())
+	}
+	if !dryRun {
+		if err := cs.beginScan(); err != nil {
+			return result, err
+		}
+		defer cs.endScan()
+	}
+
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, nil
+		}
+		var rejects []models.SensorDataReject
+		if err := cs.db.Where("id > ?", lastID).Order("id").Limit(cs.batchSize).Find(&rejects).Error; err != nil {
+			return result, fmt.Errorf("failed to load dead letters: %w", err)
+		}
+		if len(rejects) == 0 {
+			return result, nil
+		}
+		lastID = rejects[len(rejects)-1].ID
+
+		for _, reject := range rejects {
+			if pattern != "" {
+				if ok, _ := path.Match(pattern, reject.SourceFile); !ok {
+					continue
+				}
+			}
+			result.Retried++
+			if dryRun {
+				continue
+			}
+			skipped, err := cs.retryReject(reject)
+			switch {
+			case err != nil:
+				result.Failed++
+				logger.Warnf("Reject %d (%s at %s from %s) failed again: %v\n", reject.ID, reject.SensorName,
+					reject.Timestamp.Format(time.RFC3339), reject.SourceFile, err)
+			case skipped:
+				result.Skipped++
+			default:
+				result.Inserted++
+			}
+		}
+	}
+}
+
+// retryReject inserts a dead-lettered reading and removes it from the
+// dead-letter table, or records the new error. It reports whether the
+// reading already existed and was skipped.
+func (cs *CSVScanner) retryReject(reject models.SensorDataReject) (bool, error) {
+	sourceFile := reject.SourceFile
+	record := models.SensorData{
+		Timestamp:    reject.Timestamp,
+		SensorName:   reject.SensorName,
+		Value:        reject.Value,
+		ImportFileID: reject.ImportFileID,
+	}
+	if cs.precedence != nil {
+		record.SourceFile = &sourceFile
+	}
+	batch := []models.SensorData{record}
+
+	var skipped int
+	var events []changeEvent
+	err := cs.faults.beforeInsert()
+	if err == nil && cs.precedence != nil && !cs.rawIngest {
+		_, events, err = cs.insertWithPrecedence(batch)
+		if err == nil {
+			err = cs.db.Delete(&reject).Error
+		}
+	} else if err == nil {
+		err = cs.db.Transaction(func(tx *gorm.DB) error {
+			var txErr error
+			if skipped, events, txErr = cs.insertWithPolicy(tx, batch); txErr != nil {
+				return txErr
+			}
+			return tx.Delete(&reject).Error
+		})
+	}
+
+	if err != nil {
+		now := time.Now().UTC()
+		update := cs.db.Model(&reject).Updates(map[string]interface{}{
+			"error":           truncateError(err),
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_attempt_at": now,
+		})
+		if update.Error != nil {
+			logger.Warnf("Failed to update reject %d: %v\n", reject.ID, update.Error)
+		}
+		return false, err
+	}
+	cs.changelog.write(sourceFile, events)
+	return skipped > 0, nil
+}
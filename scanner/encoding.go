@@ -0,0 +1,192 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// EncodingAuto detects the encoding of each file from its byte order mark
+// and contents
+const EncodingAuto = "auto"
+
+// encodingSniffSize is how much of a file is examined to detect its encoding
+const encodingSniffSize = 64 * 1024
+
+// Byte order marks, which are dropped whatever the configured encoding
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// sourceEncoding is the character encoding of a set of source files
+type sourceEncoding struct {
+	name     string
+	encoding encoding.Encoding // Nil for UTF-8 or auto detection
+}
+
+// encodingOverride assigns an encoding to files matching a pattern
+type encodingOverride struct {
+	files    string
+	encoding sourceEncoding
+}
+
+// lookupEncoding resolves an encoding name such as shift_jis, utf-16le or
+// windows-1252; empty and auto detect the encoding of each file
+func lookupEncoding(name string) (sourceEncoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == EncodingAuto {
+		return sourceEncoding{name: EncodingAuto}, nil
+	}
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return sourceEncoding{}, fmt.Errorf("unsupported encoding %q", name)
+	}
+	if canonical, err := htmlindex.Name(enc); err == nil {
+		name = canonical
+	}
+	if name == "utf-8" {
+		enc = nil
+	}
+	return sourceEncoding{name: name, encoding: enc}, nil
+}
+
+// loadEncodings loads the default source encoding and per-pattern overrides
+func loadEncodings(cfg config.ScannerConfig) (sourceEncoding, []encodingOverride, error) {
+	defaultEncoding, err := lookupEncoding(cfg.Encoding)
+	if err != nil {
+		return sourceEncoding{}, nil, fmt.Errorf("invalid scanner encoding: %w", err)
+	}
+
+	overrides := make([]encodingOverride, 0, len(cfg.EncodingOverrides))
+	for _, o := range cfg.EncodingOverrides {
+		enc, err := lookupEncoding(o.Encoding)
+		if err != nil {
+			return sourceEncoding{}, nil, fmt.Errorf("invalid encoding for %s: %w", o.Files, err)
+		}
+		overrides = append(overrides, encodingOverride{files: o.Files, encoding: enc})
+	}
+
+	return defaultEncoding, overrides, nil
+}
+
+// encodingFor returns the configured encoding of a file
+func (cs *CSVScanner) encodingFor(fileName string) sourceEncoding {
+	for _, override := range cs.encodingOverrides {
+		if matchFilePattern(override.files, fileName) {
+			return override.encoding
+		}
+	}
+	return cs.sourceEncoding
+}
+
+// decodeInput converts the contents of a file to UTF-8 and drops a byte
+// order mark, which would otherwise hide the header row. A byte order mark
+// takes precedence over the configured encoding.
+func (cs *CSVScanner) decodeInput(r io.Reader, fileName string) (io.Reader, error) {
+	buffered := bufio.NewReaderSize(r, encodingSniffSize)
+	head, err := buffered.Peek(encodingSniffSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	complete := err == io.EOF
+
+	configured := cs.encodingFor(fileName)
+	name, enc := configured.name, configured.encoding
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		name, enc = "utf-8", nil
+		buffered.Discard(len(bomUTF8))
+	case bytes.HasPrefix(head, bomUTF16LE):
+		name, enc = "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+		buffered.Discard(len(bomUTF16LE))
+	case bytes.HasPrefix(head, bomUTF16BE):
+		name, enc = "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+		buffered.Discard(len(bomUTF16BE))
+	case name == EncodingAuto:
+		name, enc = detectEncoding(head, complete)
+		if name == "" {
+			logger.Warnf("Could not detect the encoding of %s, reading it as UTF-8 (set scanner.encoding)\n", fileName)
+			name = "utf-8"
+		}
+	}
+
+	if enc == nil {
+		return buffered, nil
+	}
+	logger.Debugf("Decoding %s from %s\n", fileName, name)
+	return transform.NewReader(buffered, enc.NewDecoder()), nil
+}
+
+// detectEncoding guesses the encoding of a file without a byte order mark
+// from its first bytes: UTF-16 (recognized by the zero bytes of ASCII text),
+// UTF-8 or Shift-JIS. It returns an empty name when none of them fit.
+func detectEncoding(head []byte, complete bool) (string, encoding.Encoding) {
+	// ASCII text in UTF-16 has a zero byte in every other position, which
+	// would also pass as UTF-8
+	var evenZeros, oddZeros int
+	for i, b := range head {
+		if b == 0 {
+			if i%2 == 0 {
+				evenZeros++
+			} else {
+				oddZeros++
+			}
+		}
+	}
+	if pairs := len(head) / 2; pairs > 0 {
+		switch {
+		case oddZeros > pairs/3 && evenZeros < pairs/20:
+			return "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+		case evenZeros > pairs/3 && oddZeros < pairs/20:
+			return "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+		}
+	}
+
+	if validUTF8(head, complete) {
+		return "utf-8", nil
+	}
+	if decodesCleanly(japanese.ShiftJIS, head, complete) {
+		return "shift_jis", japanese.ShiftJIS
+	}
+	return "", nil
+}
+
+// validUTF8 reports whether data is valid UTF-8, allowing a character cut
+// off at the end when data is only the start of the file
+func validUTF8(data []byte, complete bool) bool {
+	for trimmed := 0; trimmed < utf8.UTFMax; trimmed++ {
+		if utf8.Valid(data) {
+			return true
+		}
+		if complete || len(data) == 0 {
+			return false
+		}
+		data = data[:len(data)-1]
+	}
+	return false
+}
+
+// decodesCleanly reports whether data decodes without invalid sequences
+func decodesCleanly(enc encoding.Encoding, data []byte, complete bool) bool {
+	decoded := make([]byte, 3*len(data)+utf8.UTFMax)
+	n, _, err := enc.NewDecoder().Transform(decoded, data, complete)
+	if err != nil && err != transform.ErrShortSrc {
+		return false
+	}
+	return !bytes.ContainsRune(decoded[:n], utf8.RuneError)
+}
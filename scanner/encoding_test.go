@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const encodedCSV = "timestamp,sensor_name,value\n2025-09-01 00:00:00,温度_01,21.5\n"
+
+// encode converts text from UTF-8 to enc
+func encode(t *testing.T, enc encoding.Encoding, text string) []byte {
+	t.Helper()
+	data, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return data
+}
+
+// decoded returns what decodeInput makes of a file with the contents
+func decoded(t *testing.T, cs *CSVScanner, fileName string, contents []byte) string {
+	t.Helper()
+	r, err := cs.decodeInput(bytes.NewReader(contents), fileName)
+	if err != nil {
+		t.Fatalf("decodeInput: %v", err)
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read decoded input: %v", err)
+	}
+	return string(text)
+}
+
+func TestDecodeInputDetectsEncodings(t *testing.T) {
+	utf16le := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	utf16be := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	tests := []struct {
+		name     string
+		contents []byte
+	}{
+		{"utf-8", []byte(encodedCSV)},
+		{"utf-8 with bom", append(append([]byte{}, bomUTF8...), encodedCSV...)},
+		{"utf-16le with bom", append(append([]byte{}, bomUTF16LE...), encode(t, utf16le, encodedCSV)...)},
+		{"utf-16be with bom", append(append([]byte{}, bomUTF16BE...), encode(t, utf16be, encodedCSV)...)},
+		{"utf-16le", encode(t, utf16le, encodedCSV)},
+		{"utf-16be", encode(t, utf16be, encodedCSV)},
+		{"shift_jis", encode(t, japanese.ShiftJIS, encodedCSV)},
+	}
+	cs := NewCSVScanner(nil)
+	for _, tt := range tests {
+		if got := decoded(t, cs, "a.csv", tt.contents); got != encodedCSV {
+			t.Errorf("%s decoded to %q", tt.name, got)
+		}
+	}
+}
+
+func TestDetectEncodingOfPartialInput(t *testing.T) {
+	// A character cut off by the sniffed prefix is not mistaken for invalid
+	// input, unless the prefix is the whole file
+	head := []byte(encodedCSV)
+	cut := head[:bytes.Index(head, []byte("度"))+1]
+	if name, _ := detectEncoding(cut, false); name != "utf-8" {
+		t.Errorf("detected %q for the start of a UTF-8 file, want utf-8", name)
+	}
+	if name, _ := detectEncoding(cut, true); name == "utf-8" {
+		t.Error("detected utf-8 for a complete file ending mid-character")
+	}
+	if name, _ := detectEncoding([]byte{0xff, 0xff, 0x80, 0xa0}, true); name != "" {
+		t.Errorf("detected %q for bytes of no supported encoding", name)
+	}
+}
+
+func TestConfiguredEncodings(t *testing.T) {
+	cs := NewCSVScanner(openTestDB(t))
+	err := cs.Configure(config.ScannerConfig{
+		Encoding:          "windows-1252",
+		EncodingOverrides: []config.EncodingOverrideConfig{{Files: "jp_*.csv", Encoding: "Shift_JIS"}},
+	})
+	if err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	latin := "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_°C,21.5\n"
+	if got := decoded(t, cs, "a.csv", encode(t, charmap.Windows1252, latin)); got != latin {
+		t.Errorf("windows-1252 decoded to %q", got)
+	}
+	if got := decoded(t, cs, "jp_a.csv", encode(t, japanese.ShiftJIS, encodedCSV)); got != encodedCSV {
+		t.Errorf("shift_jis override decoded to %q", got)
+	}
+	// A byte order mark wins over the configured encoding
+	if got := decoded(t, cs, "jp_b.csv", append(append([]byte{}, bomUTF8...), encodedCSV...)); got != encodedCSV {
+		t.Errorf("utf-8 with bom decoded to %q", got)
+	}
+
+	for _, cfg := range []config.ScannerConfig{
+		{Encoding: "klingon"},
+		{EncodingOverrides: []config.EncodingOverrideConfig{{Files: "*.csv", Encoding: "ebcdic-9"}}},
+	} {
+		if _, _, err := loadEncodings(cfg); err == nil {
+			t.Errorf("loadEncodings(%+v) accepted an unknown encoding", cfg)
+		}
+	}
+}
+
+func TestScanUTF16FileWithByteOrderMark(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	contents := append(append([]byte{}, bomUTF16LE...), encode(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), encodedCSV)...)
+	writeFiles(t, dir, map[string]string{"a.csv": string(contents)})
+
+	cs := NewCSVScanner(db)
+	if err := cs.ScanDirectory(context.Background(), dir); err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+	var stored []models.SensorData
+	if err := db.Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	if len(stored) != 1 || stored[0].SensorName != "温度_01" || stored[0].Value != 21.5 {
+		t.Errorf("stored = %+v, want 温度_01 at 21.5 with the header recognized", stored)
+	}
+}
@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"fmt"
+
+	"sensor_data_import/config"
+)
+
+// errorLimitMinRows is how many rows a percentage limit waits for before it
+// can stop a file part-way, so a bad row near the start does not abort it
+const errorLimitMinRows = 1000
+
+// errorLimit fails a file once it has more parsing errors than allowed, so a
+// corrupted file is abandoned instead of being parsed and logged row by row
+type errorLimit struct {
+	count   int     // Errors allowed per file, 0 for no limit
+	percent float64 // Percentage of rows allowed to fail, 0 for no limit
+}
+
+// newErrorLimit parses the max_errors setting
+func newErrorLimit(value string) (errorLimit, error) {
+	count, percent, err := config.ParseMaxErrors(value)
+	return errorLimit{count: count, percent: percent}, err
+}
+
+// exceeded reports whether the errors of a file are over the limit. Until
+// the whole file was parsed, a percentage only applies after enough rows.
+func (el errorLimit) exceeded(result *ProcessResult, final bool) bool {
+	if el.count > 0 && result.ErrorCount > el.count {
+		return true
+	}
+	if el.percent > 0 && result.rowsParsed > 0 && (final || result.rowsParsed >= errorLimitMinRows) {
+		return float64(result.ErrorCount)*100 > el.percent*float64(result.rowsParsed)
+	}
+	return false
+}
+
+// check fails the file when its errors are over the limit
+func (el errorLimit) check(result *ProcessResult, final bool) error {
+	if result.Error != nil || !el.exceeded(result, final) {
+		return nil
+	}
+	if el.percent > 0 {
+		return fmt.Errorf("too many parsing errors: %d of %d rows (limit %g%%), file abandoned",
+			result.ErrorCount, result.rowsParsed, el.percent)
+	}
+	return fmt.Errorf("too many parsing errors: more than %d after %d rows, file abandoned", el.count, result.rowsParsed)
+}
@@ -0,0 +1,471 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// isExpression reports whether a column mapping entry is an expression rather
+// than a header name or index. Expressions always reference columns via col[...].
+func isExpression(ref string) bool {
+	return strings.Contains(ref, "col[")
+}
+
+// exprValue is the result of evaluating an expression: a string or a number
+type exprValue struct {
+	str   string
+	num   float64
+	isNum bool
+}
+
+// text formats the value as a cell would appear in the CSV file
+func (v exprValue) text() string {
+	if v.isNum {
+		return strconv.FormatFloat(v.num, 'g', -1, 64)
+	}
+	return v.str
+}
+
+// number converts the value to a number, parsing strings
+func (v exprValue) number() (float64, error) {
+	if v.isNum {
+		return v.num, nil
+	}
+	num, err := strconv.ParseFloat(strings.TrimSpace(v.str), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", v.str)
+	}
+	return num, nil
+}
+
+// exprNode is a node of a parsed column expression
+type exprNode interface {
+	eval(record []string) (exprValue, error)
+	// bind resolves column references by header name against a header row
+	bind(header []string) (exprNode, error)
+	// maxColumn returns the highest column index referenced, or -1
+	maxColumn() int
+}
+
+// columnRef reads a cell by index, or by header name until bound
+type columnRef struct {
+	index int
+	name  string
+}
+
+func (c columnRef) eval(record []string) (exprValue, error) {
+	if c.name != "" {
+		return exprValue{}, fmt.Errorf("column %q is not bound to a header", c.name)
+	}
+	if c.index >= len(record) {
+		return exprValue{}, fmt.Errorf("column %d is missing", c.index)
+	}
+	return exprValue{str: record[c.index]}, nil
+}
+
+func (c columnRef) bind(header []string) (exprNode, error) {
+	if c.name == "" {
+		return c, nil
+	}
+	for i, cell := range header {
+		if normalizeHeader(cell) == normalizeHeader(c.name) {
+			return columnRef{index: i}, nil
+		}
+	}
+	return nil, fmt.Errorf("column %q not found in header", c.name)
+}
+
+func (c columnRef) maxColumn() int {
+	if c.name != "" {
+		return -1
+	}
+	return c.index
+}
+
+// literal is a constant string or number
+type literal exprValue
+
+func (l literal) eval([]string) (exprValue, error) { return exprValue(l), nil }
+func (l literal) bind([]string) (exprNode, error)  { return l, nil }
+func (l literal) maxColumn() int                   { return -1 }
+
+// negate is unary minus
+type negate struct {
+	operand exprNode
+}
+
+func (n negate) eval(record []string) (exprValue, error) {
+	v, err := n.operand.eval(record)
+	if err != nil {
+		return exprValue{}, err
+	}
+	num, err := v.number()
+	if err != nil {
+		return exprValue{}, err
+	}
+	return exprValue{num: -num, isNum: true}, nil
+}
+
+func (n negate) bind(header []string) (exprNode, error) {
+	operand, err := n.operand.bind(header)
+	if err != nil {
+		return nil, err
+	}
+	return negate{operand: operand}, nil
+}
+
+func (n negate) maxColumn() int {
+	return n.operand.maxColumn()
+}
+
+// binaryOp is an arithmetic operation on two numbers
+type binaryOp struct {
+	op          byte
+	left, right exprNode
+}
+
+func (b binaryOp) eval(record []string) (exprValue, error) {
+	lv, err := b.left.eval(record)
+	if err != nil {
+		return exprValue{}, err
+	}
+	rv, err := b.right.eval(record)
+	if err != nil {
+		return exprValue{}, err
+	}
+	l, err := lv.number()
+	if err != nil {
+		return exprValue{}, err
+	}
+	r, err := rv.number()
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	var result float64
+	switch b.op {
+	case '+':
+		result = l + r
+	case '-':
+		result = l - r
+	case '*':
+		result = l * r
+	case '/':
+		if r == 0 {
+			return exprValue{}, fmt.Errorf("division by zero")
+		}
+		result = l / r
+	}
+	return exprValue{num: result, isNum: true}, nil
+}
+
+func (b binaryOp) bind(header []string) (exprNode, error) {
+	left, err := b.left.bind(header)
+	if err != nil {
+		return nil, err
+	}
+	right, err := b.right.bind(header)
+	if err != nil {
+		return nil, err
+	}
+	return binaryOp{op: b.op, left: left, right: right}, nil
+}
+
+func (b binaryOp) maxColumn() int {
+	return max(b.left.maxColumn(), b.right.maxColumn())
+}
+
+// valueRef is the parsed value of a reading in a value transform, which is
+// evaluated over a single-cell record holding the value
+type valueRef struct{}
+
+func (valueRef) eval(record []string) (exprValue, error) { return exprValue{str: record[0]}, nil }
+func (v valueRef) bind([]string) (exprNode, error)       { return v, nil }
+func (valueRef) maxColumn() int                          { return -1 }
+
+// concatCall joins the text of its arguments
+type concatCall struct {
+	args []exprNode
+}
+
+func (c concatCall) eval(record []string) (exprValue, error) {
+	var sb strings.Builder
+	for _, arg := range c.args {
+		v, err := arg.eval(record)
+		if err != nil {
+			return exprValue{}, err
+		}
+		sb.WriteString(strings.TrimSpace(v.text()))
+	}
+	return exprValue{str: sb.String()}, nil
+}
+
+func (c concatCall) bind(header []string) (exprNode, error) {
+	args := make([]exprNode, len(c.args))
+	for i, arg := range c.args {
+		bound, err := arg.bind(header)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = bound
+	}
+	return concatCall{args: args}, nil
+}
+
+func (c concatCall) maxColumn() int {
+	highest := -1
+	for _, arg := range c.args {
+		highest = max(highest, arg.maxColumn())
+	}
+	return highest
+}
+
+// parseExpression parses a column expression such as `col[3] * 0.1` or
+// `concat(col[1], "_", col["Channel"])`.
+//
+// Columns are referenced by zero-based index or by header name. Numbers
+// support + - * / and parentheses; concat joins values as text.
+func parseExpression(src string) (exprNode, error) {
+	p := &exprParser{src: src}
+	node, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", src, err)
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("invalid expression %q: unexpected %q at offset %d", src, p.src[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+// parseTransform parses a value transform such as `(value - 32) * 5 / 9`.
+// It has the syntax of a column expression, but reads the reading's value
+// instead of columns.
+func parseTransform(src string) (exprNode, error) {
+	p := &exprParser{src: src, transform: true}
+	node, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform %q: %w", src, err)
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("invalid transform %q: unexpected %q at offset %d", src, p.src[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+// exprParser is a recursive descent parser over the expression source
+type exprParser struct {
+	src       string
+	pos       int
+	transform bool // Parsing a value transform: value instead of col[...]
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// accept consumes the given token if it comes next
+func (p *exprParser) accept(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// acceptWord consumes the given identifier if it comes next as a whole word
+func (p *exprParser) acceptWord(word string) bool {
+	p.skipSpace()
+	rest := p.src[p.pos:]
+	if !strings.HasPrefix(rest, word) {
+		return false
+	}
+	if len(rest) > len(word) {
+		if next := rune(rest[len(word)]); next == '_' || unicode.IsLetter(next) || unicode.IsDigit(next) {
+			return false
+		}
+	}
+	p.pos += len(word)
+	return true
+}
+
+func (p *exprParser) expect(token string) error {
+	if !p.accept(token) {
+		return fmt.Errorf("expected %q at offset %d", token, p.pos)
+	}
+	return nil
+}
+
+// parseSum parses terms joined by + and -
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.accept("+"):
+			op = '+'
+		case p.accept("-"):
+			op = '-'
+		default:
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryOp{op: op, left: left, right: right}
+	}
+}
+
+// parseProduct parses factors joined by * and /
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.accept("*"):
+			op = '*'
+		case p.accept("/"):
+			op = '/'
+		default:
+			return left, nil
+		}
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryOp{op: op, left: left, right: right}
+	}
+}
+
+// parseFactor parses literals, column references, calls, negation and parentheses
+func (p *exprParser) parseFactor() (exprNode, error) {
+	switch {
+	case p.accept("-"):
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return negate{operand: operand}, nil
+	case p.accept("("):
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	case p.transform && p.acceptWord("value"):
+		return valueRef{}, nil
+	case p.transform && p.accept("col["):
+		return nil, fmt.Errorf("value transforms cannot reference columns")
+	case p.accept("col["):
+		ref, err := p.parseColumnRef()
+		if err != nil {
+			return nil, err
+		}
+		return ref, p.expect("]")
+	case p.accept("concat("):
+		return p.parseConcat()
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == '"' {
+		text, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literal{str: text}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos >= len(p.src) {
+			return nil, fmt.Errorf("unexpected end of expression")
+		}
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos:], p.pos)
+	}
+	num, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", p.src[start:p.pos])
+	}
+	return literal{num: num, isNum: true}, nil
+}
+
+// parseColumnRef parses the index or quoted header name inside col[...]
+func (p *exprParser) parseColumnRef() (exprNode, error) {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == '"' {
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return columnRef{name: name}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	index, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		return nil, fmt.Errorf("expected column index or quoted header name at offset %d", start)
+	}
+	return columnRef{index: index}, nil
+}
+
+// parseConcat parses the comma-separated arguments of concat(...)
+func (p *exprParser) parseConcat() (exprNode, error) {
+	var call concatCall
+	if p.accept(")") {
+		return call, nil
+	}
+	for {
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.accept(")") {
+			return call, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseString parses a double-quoted string literal with backslash escapes
+func (p *exprParser) parseString() (string, error) {
+	var sb strings.Builder
+	p.pos++ // opening quote
+	for p.pos < len(p.src) {
+		ch := p.src[p.pos]
+		p.pos++
+		switch ch {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if p.pos < len(p.src) {
+				sb.WriteByte(p.src[p.pos])
+				p.pos++
+			}
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
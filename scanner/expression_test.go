@@ -0,0 +1,163 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+func TestExpressionEvaluation(t *testing.T) {
+	record := []string{"2025-09-01 00:00:00", " 7 ", "site_a", "215", "x"}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"col[3] * 0.1", "21.5"},
+		{"col[3] - col[1] * 2", "201"},
+		{"(col[3] - col[1]) * 2", "416"},
+		{"-col[1] + 10 / 4", "-4.5"},
+		{`concat(col[2], "_", col[1])`, "site_a_7"},
+		{`concat("ch", col[3] / 5)`, "ch43"},
+		{`concat("a\"b")`, `a"b`},
+	}
+	for _, tt := range tests {
+		node, err := parseExpression(tt.src)
+		if err != nil {
+			t.Errorf("parseExpression(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := node.eval(record)
+		if err != nil || got.text() != tt.want {
+			t.Errorf("%s = %q, %v; want %q", tt.src, got.text(), err, tt.want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, src := range []string{"col[3] *", "col[x]", "col[3", "(col[1] + 2", `concat(col[1] "a")`, `concat("a`, "col[1] % 2", "1.2.3 + col[0]"} {
+		if _, err := parseExpression(src); err == nil {
+			t.Errorf("parseExpression(%q) accepted an invalid expression", src)
+		}
+	}
+
+	// Failures that depend on the row surface when evaluated
+	record := []string{"0", "n/a"}
+	for _, src := range []string{"col[1] * 2", "col[2] + 1", "col[0] + 1 / col[0]"} {
+		node, err := parseExpression(src)
+		if err != nil {
+			t.Fatalf("parseExpression(%q): %v", src, err)
+		}
+		if v, err := node.eval(record); err == nil {
+			t.Errorf("%s = %q, want an error", src, v.text())
+		}
+	}
+}
+
+func TestExpressionBindsHeaderNames(t *testing.T) {
+	node, err := parseExpression(`col["Raw"] * 0.5 + col[0]`)
+	if err != nil {
+		t.Fatalf("parseExpression: %v", err)
+	}
+	if _, err := node.eval([]string{"1", "2"}); err == nil {
+		t.Error("an unbound header name evaluated")
+	}
+	if _, err := node.bind([]string{"Offset", "Value"}); err == nil || !strings.Contains(err.Error(), `"Raw"`) {
+		t.Errorf("bind without the column = %v, want the missing header named", err)
+	}
+
+	bound, err := node.bind([]string{"Offset", "Site", "Raw"})
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if got, err := bound.eval([]string{"1", "site_a", "40"}); err != nil || got.text() != "21" {
+		t.Errorf("bound expression = %q, %v; want 21", got.text(), err)
+	}
+	if bound.maxColumn() != 2 {
+		t.Errorf("maxColumn = %d, want 2", bound.maxColumn())
+	}
+}
+
+func TestTransformReadsOnlyTheValue(t *testing.T) {
+	node, err := parseTransform("(value - 32) * 5 / 9")
+	if err != nil {
+		t.Fatalf("parseTransform: %v", err)
+	}
+	if got, err := node.eval([]string{"212"}); err != nil || got.text() != "100" {
+		t.Errorf("transform of 212 = %q, %v; want 100", got.text(), err)
+	}
+	for _, src := range []string{"col[1] * value", "value *", "values + 1"} {
+		if _, err := parseTransform(src); err == nil {
+			t.Errorf("parseTransform(%q) accepted an invalid transform", src)
+		}
+	}
+}
+
+func TestColumnMappingResolvesFields(t *testing.T) {
+	mappings, err := newColumnMappings([]config.ColumnMappingConfig{
+		{Files: "site_*.csv", Timestamp: "Time", SensorName: `concat(col["Site"], "_", col[2])`, Value: "col[3] * 0.1"},
+		{Files: "*.csv", Timestamp: "0", SensorName: "1", Value: "2"},
+	})
+	if err != nil {
+		t.Fatalf("newColumnMappings: %v", err)
+	}
+	if !mappings[0].matchesFile("site_a.csv") || mappings[0].matchesFile("plant.csv") || !mappings[0].usesHeaderNames() || mappings[1].usesHeaderNames() {
+		t.Fatalf("mappings match files or use header names unexpectedly")
+	}
+
+	columns, err := mappings[0].resolve([]string{"Time", "Site", "Channel", "Raw"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if columns.minColumns() != 4 {
+		t.Errorf("minColumns = %d, want 4 for the expression reading col[3]", columns.minColumns())
+	}
+	timestamp, sensor, value, err := columns.cells([]string{"2025-09-01 00:00:00", "site_a", "7", "215"})
+	if err != nil || timestamp != "2025-09-01 00:00:00" || sensor != "site_a_7" || value != "21.5" {
+		t.Errorf("cells = %q, %q, %q, %v; want the timestamp, site_a_7 and 21.5", timestamp, sensor, value, err)
+	}
+	if _, _, _, err := columns.cells([]string{"2025-09-01 00:00:00", "site_a", "7", "n/a"}); err == nil || !strings.Contains(err.Error(), "value expression") {
+		t.Errorf("cells of a non-numeric cell = %v, want a value expression error", err)
+	}
+	if _, err := mappings[0].resolve([]string{"Timestamp", "Site", "Channel", "Raw"}); err == nil {
+		t.Error("resolved a mapping against a header without its Time column")
+	}
+
+	for _, c := range []config.ColumnMappingConfig{
+		{Files: "*.csv", Timestamp: "-1", SensorName: "1", Value: "2"},
+		{Files: "*.csv", Timestamp: "0", SensorName: "1", Value: "col[2] *"},
+	} {
+		if _, err := newColumnMappings([]config.ColumnMappingConfig{c}); err == nil {
+			t.Errorf("newColumnMappings(%+v) accepted an invalid mapping", c)
+		}
+	}
+}
+
+func TestScanWithColumnExpressions(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"site_a.csv": "Time,Site,Channel,Raw\n2025-09-01 00:00:00,site_a,7,215\n2025-09-01 00:01:00,site_a,7,n/a\n2025-09-01 00:01:00,site_a,8,-30\n",
+	})
+	cs := NewCSVScanner(db)
+	err := cs.Configure(config.ScannerConfig{ColumnMappings: []config.ColumnMappingConfig{
+		{Files: "site_*.csv", Timestamp: "Time", SensorName: `concat(col["Site"], "_", col[2])`, Value: "col[3] * 0.1"},
+	}})
+	if err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	if err := cs.ScanDirectory(context.Background(), dir); err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+
+	// The row with a non-numeric cell is a parse error, the others import
+	var stored []models.SensorData
+	if err := db.Order("sensor_name").Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	if len(stored) != 2 || stored[0].SensorName != "site_a_7" || stored[0].Value != 21.5 || stored[1].SensorName != "site_a_8" || stored[1].Value != -3 {
+		t.Errorf("stored = %+v, want site_a_7 at 21.5 and site_a_8 at -3", stored)
+	}
+}
@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is returned by inserts that fail due to fault injection
+var ErrInjectedFault = errors.New("injected database fault")
+
+// FaultInjector randomly drops batches, fails inserts, panics in inserts and
+// delays inserts. It is only meant for integration tests of retry, fallback,
+// recovery and accounting logic.
+type FaultInjector struct {
+	DropRate  float64       // Probability that a batch is silently dropped
+	ErrorRate float64       // Probability that an insert returns ErrInjectedFault
+	PanicRate float64       // Probability that an insert panics
+	Delay     time.Duration // Delay added before every insert
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// ParseFaultInjection parses a spec such as "drop=0.1,error=0.05,panic=0.01,delay=200ms,seed=42"
+func ParseFaultInjection(spec string) (*FaultInjector, error) {
+	fi := &FaultInjector{}
+	seed := time.Now().UnixNano()
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid fault injection option %q (expected key=value)", part)
+		}
+
+		var err error
+		switch key {
+		case "drop":
+			fi.DropRate, err = parseRate(value)
+		case "error":
+			fi.ErrorRate, err = parseRate(value)
+		case "panic":
+			fi.PanicRate, err = parseRate(value)
+		case "delay":
+			fi.Delay, err = time.ParseDuration(value)
+		case "seed":
+			seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("unknown option (expected drop, error, panic, delay or seed)")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault injection option %q: %w", part, err)
+		}
+	}
+
+	fi.rng = rand.New(rand.NewSource(seed))
+	return fi, nil
+}
+
+// parseRate parses a probability between 0 and 1
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate must be between 0 and 1")
+	}
+	return rate, nil
+}
+
+// roll returns true with the given probability
+func (fi *FaultInjector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.rng.Float64() < rate
+}
+
+// dropBatch reports whether the next batch should be dropped
+func (fi *FaultInjector) dropBatch() bool {
+	return fi != nil && fi.roll(fi.DropRate)
+}
+
+// beforeInsert applies the configured delay and returns an injected error, if
+// any, or panics
+func (fi *FaultInjector) beforeInsert() error {
+	if fi == nil {
+		return nil
+	}
+	if fi.Delay > 0 {
+		time.Sleep(fi.Delay)
+	}
+	if fi.roll(fi.PanicRate) {
+		panic("injected panic")
+	}
+	if fi.roll(fi.ErrorRate) {
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// String formats the settings for log output
+func (fi *FaultInjector) String() string {
+	return fmt.Sprintf("drop=%g error=%g panic=%g delay=%v", fi.DropRate, fi.ErrorRate, fi.PanicRate, fi.Delay)
+}
@@ -0,0 +1,205 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// faultyScanner returns a scanner over db whose inserts fail as spec says
+func faultyScanner(t *testing.T, db *gorm.DB, spec string) *CSVScanner {
+	t.Helper()
+	faults, err := ParseFaultInjection(spec)
+	if err != nil {
+		t.Fatalf("ParseFaultInjection(%q): %v", spec, err)
+	}
+	cs := NewCSVScanner(db)
+	cs.SetFaultInjector(faults)
+	return cs
+}
+
+func TestParseFaultInjection(t *testing.T) {
+	fi, err := ParseFaultInjection("drop=0.1, error=0.05,panic=0,delay=20ms,seed=42")
+	if err != nil {
+		t.Fatalf("ParseFaultInjection: %v", err)
+	}
+	if fi.DropRate != 0.1 || fi.ErrorRate != 0.05 || fi.PanicRate != 0 || fi.Delay != 20*time.Millisecond {
+		t.Errorf("parsed %s", fi)
+	}
+
+	for _, spec := range []string{"error", "error=1.5", "drop=-0.1", "delay=soon", "seed=x", "crash=1"} {
+		if _, err := ParseFaultInjection(spec); err == nil {
+			t.Errorf("ParseFaultInjection(%q) accepted an invalid spec", spec)
+		}
+	}
+}
+
+func TestInjectedErrorsFallBackToRowInserts(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.SensorDataReject{}); err != nil {
+		t.Fatalf("create sensor_data_rejects: %v", err)
+	}
+	cs := faultyScanner(t, db, "error=0.5,seed=2")
+	cs.enableDeadLetters()
+
+	// The batch fails, so its readings are inserted one by one, and those
+	// that fail again are kept as dead letters
+	result := ProcessResult{FileName: "a.csv"}
+	if err := cs.insertSensorBatch(minuteReadings(20), &result, nil, 0); err != nil {
+		t.Fatalf("insertSensorBatch: %v", err)
+	}
+	stored := countRows(t, db, &models.SensorData{})
+	rejects := countRows(t, db, &models.SensorDataReject{})
+	if stored == 0 || result.FailedCount == 0 {
+		t.Fatalf("stored %d, failed %d; want the seed to fail some rows and not others", stored, result.FailedCount)
+	}
+	if stored+int64(result.FailedCount) != 20 || result.DeadLettered != result.FailedCount || rejects != int64(result.FailedCount) {
+		t.Errorf("stored %d, failed %d, dead-lettered %d, %d rejects; want every reading stored or dead-lettered once",
+			stored, result.FailedCount, result.DeadLettered, rejects)
+	}
+}
+
+func TestInjectedErrorsFailTheBatchWithoutDeadLetters(t *testing.T) {
+	db := openTestDB(t)
+	cs := faultyScanner(t, db, "error=1")
+	cs.enableDeadLetters()
+
+	result := ProcessResult{FileName: "a.csv"}
+	err := cs.insertSensorBatch(minuteReadings(5), &result, nil, 0)
+	if !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("insertSensorBatch = %v, want the injected fault", err)
+	}
+	if stored := countRows(t, db, &models.SensorData{}); stored != 0 || result.FailedCount != 5 {
+		t.Errorf("stored %d, failed %d; want none stored and all 5 failed", stored, result.FailedCount)
+	}
+}
+
+func TestDroppedBatchesAreNotStored(t *testing.T) {
+	db := openTestDB(t)
+	cs := faultyScanner(t, db, "drop=1")
+
+	result := ProcessResult{FileName: "a.csv"}
+	if err := cs.insertSensorBatch(minuteReadings(5), &result, nil, 0); err != nil {
+		t.Fatalf("insertSensorBatch: %v", err)
+	}
+	if stored := countRows(t, db, &models.SensorData{}); stored != 0 || result.FailedCount != 0 || result.Spooled != 0 {
+		t.Errorf("stored %d, result %+v; want the batch dropped without a trace", stored, result)
+	}
+}
+
+func TestInjectedPanicFailsOnlyItsFile(t *testing.T) {
+	db := openTestDB(t)
+	cs := faultyScanner(t, db, "panic=1")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n"})
+	path := filepath.Join(dir, "a.csv")
+
+	result := cs.processFileRecovering(context.Background(), FileJob{FilePath: path, FileName: "a.csv"})
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "injected panic") {
+		t.Fatalf("result error = %v, want the injected panic", result.Error)
+	}
+
+	// The next file imports once the fault is gone
+	cs.SetFaultInjector(nil)
+	if result := cs.processFileRecovering(context.Background(), FileJob{FilePath: path, FileName: "a.csv"}); result.Error != nil {
+		t.Errorf("import after the panic: %v", result.Error)
+	}
+	if stored := countRows(t, db, &models.SensorData{}); stored != 1 {
+		t.Errorf("stored %d readings, want 1", stored)
+	}
+}
+
+func TestWatchRetriesFilesThatFailedToInsert(t *testing.T) {
+	db := openTestDB(t)
+	cs := faultyScanner(t, db, "error=1")
+	cs.SetWatchRetryAttempts(3)
+	cs.watchRetryDelay = time.Minute
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n"})
+	path := filepath.Join(dir, "a.csv")
+	job := FileJob{FilePath: path, FileName: "a.csv"}
+	retries := make(map[string]*watchRetry)
+	now := time.Now()
+
+	// The first failure is retried after the delay, the second after twice it
+	result := cs.processFileRecovering(context.Background(), job)
+	if result.Error == nil {
+		t.Fatal("import with failing inserts succeeded")
+	}
+	cs.scheduleRetries(retries, []ProcessResult{result}, now)
+	if due := cs.dueRetries(retries, now.Add(59*time.Second)); len(due) != 0 {
+		t.Fatalf("retried %v before the delay", due)
+	}
+	if due := cs.dueRetries(retries, now.Add(time.Minute)); len(due) != 1 || due[0] != path {
+		t.Fatalf("due = %v, want %s after a minute", due, path)
+	}
+	now = now.Add(time.Minute)
+	cs.scheduleRetries(retries, []ProcessResult{cs.processFileRecovering(context.Background(), job)}, now)
+	if retry := retries[path]; retry == nil || retry.attempts != 2 || retry.due != now.Add(2*time.Minute) {
+		t.Fatalf("retry = %+v, want attempt 2 due in two minutes", retry)
+	}
+
+	// The database recovers before the last attempt
+	cs.SetFaultInjector(nil)
+	now = now.Add(2 * time.Minute)
+	if due := cs.dueRetries(retries, now); len(due) != 1 {
+		t.Fatalf("due = %v, want the third attempt", due)
+	}
+	cs.scheduleRetries(retries, []ProcessResult{cs.processFileRecovering(context.Background(), job)}, now)
+	if len(retries) != 0 || countRows(t, db, &models.SensorData{}) != 1 {
+		t.Errorf("%d retries left, %d readings stored; want the file imported on the third attempt", len(retries), countRows(t, db, &models.SensorData{}))
+	}
+}
+
+func TestSpoolKeepsBatchesWhileTheDatabaseIsDown(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sensor.db")
+	db := openSQLite(t, dbPath)
+	if err := db.AutoMigrate(&models.SensorData{}); err != nil {
+		t.Fatalf("create sensor_data: %v", err)
+	}
+	cs := faultyScanner(t, db, "error=1")
+	cs.spoolPath = filepath.Join(t.TempDir(), "spool.db")
+	if err := cs.openReadingSpool(); err != nil {
+		t.Fatalf("openReadingSpool: %v", err)
+	}
+	defer cs.closeReadingSpool()
+
+	// A failed insert while the database answers is not spooled
+	result := ProcessResult{FileName: "a.csv"}
+	cs.insertSensorBatch(minuteReadings(3), &result, nil, 0)
+	if result.Spooled != 0 || cs.spool.offline.Load() {
+		t.Fatalf("spooled %d readings while the database was reachable", result.Spooled)
+	}
+
+	// Once the database is gone, this batch and the next go to the spool
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	result = ProcessResult{FileName: "b.csv"}
+	if err := cs.insertSensorBatch(minuteReadings(4), &result, nil, 0); err != nil {
+		t.Fatalf("insertSensorBatch with the database down: %v", err)
+	}
+	if err := cs.insertSensorBatch(minuteReadings(6)[4:], &result, nil, 0); err != nil {
+		t.Fatalf("insertSensorBatch while offline: %v", err)
+	}
+	if count, _ := cs.spool.count(); result.Spooled != 6 || count != 6 || !cs.spool.offline.Load() {
+		t.Fatalf("spooled %d readings, %d in the spool; want 6 while offline", result.Spooled, count)
+	}
+
+	// The database comes back: the flush inserts the spool and empties it
+	cs.SetFaultInjector(nil)
+	cs.db = openSQLite(t, dbPath)
+	cs.flushSpool()
+	if count, _ := cs.spool.count(); count != 0 || cs.spool.offline.Load() {
+		t.Errorf("%d readings left in the spool after the flush", count)
+	}
+	if stored := countRows(t, cs.db, &models.SensorData{}); stored != 6 {
+		t.Errorf("stored %d readings, want the 6 spooled", stored)
+	}
+}
@@ -0,0 +1,59 @@
+package scanner
+
+import "strings"
+
+// fileFilter selects the files a scan imports by glob patterns, matched like
+// the patterns of timezone_overrides: against the base name, or the path
+// relative to the scanned directory when the pattern has a slash
+type fileFilter struct {
+	patterns []string // When set, only matching files are imported
+	exclude  []string // Matching files are never imported
+}
+
+func (ff fileFilter) enabled() bool {
+	return len(ff.patterns) > 0 || len(ff.exclude) > 0
+}
+
+// allows reports whether a file is imported
+func (ff fileFilter) allows(fileName string) bool {
+	if len(ff.patterns) > 0 && !matchesAnyFilePattern(ff.patterns, fileName) {
+		return false
+	}
+	return !matchesAnyFilePattern(ff.exclude, fileName)
+}
+
+// filter returns the jobs of the files the filter allows
+func (ff fileFilter) filter(jobs []FileJob) []FileJob {
+	if !ff.enabled() {
+		return jobs
+	}
+	allowed := jobs[:0]
+	for _, job := range jobs {
+		if ff.allows(job.FileName) {
+			allowed = append(allowed, job)
+		}
+	}
+	return allowed
+}
+
+// String describes the filter for log output
+func (ff fileFilter) String() string {
+	var parts []string
+	if len(ff.patterns) > 0 {
+		parts = append(parts, "matching "+strings.Join(ff.patterns, ", "))
+	}
+	if len(ff.exclude) > 0 {
+		parts = append(parts, "excluding "+strings.Join(ff.exclude, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// matchesAnyFilePattern reports whether a file matches one of the patterns
+func matchesAnyFilePattern(patterns []string, fileName string) bool {
+	for _, pattern := range patterns {
+		if matchFilePattern(pattern, fileName) {
+			return true
+		}
+	}
+	return false
+}
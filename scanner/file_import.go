@@ -0,0 +1,209 @@
+package scanner
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+	"sensor_data_import/rollup"
+)
+
+// fileImport tracks the import batch and checkpoint of a file while its
+// readings are stored, in one go or a chunk at a time
+type fileImport struct {
+	job              FileJob
+	fingerprint      *fileFingerprint
+	chunked          bool // Readings are stored a chunk at a time
+	opened           bool
+	batchID          uint
+	checkpoint       *fileCheckpoint
+	skip             int                               // Readings still to skip because an interrupted run committed them
+	aggregates       map[aggregateKey]*aggregateBucket // Buckets of aggregated sensors, stored when the file is complete
+	summaries        []models.SensorAggregatePart      // Intervals of a pre-aggregated file, stored when the file is complete
+	exclusions       rollup.Exclusions                 // Active exclusions, whose readings are not aggregated
+	exclusionsLoaded bool                              // The active exclusions were read
+	pipeline         *insertPipeline                   // Insert workers of the file, with more than one per file
+}
+
+// storeReadings stamps, links and inserts parsed readings. The import batch
+// is opened and the checkpoint loaded before the first readings are stored.
+func (cs *CSVScanner) storeReadings(ctx context.Context, fi *fileImport, sensorData []models.SensorData, result *ProcessResult) error {
+	// Keep only aggregates of high-frequency sensors
+	sensorData, err := cs.aggregate(fi, sensorData, result)
+	if err != nil {
+		return err
+	}
+
+	// Record the source of each reading so duplicates can be resolved by precedence
+	stageStart := time.Now()
+	if cs.precedence != nil {
+		cs.stampSource(fi.job, sensorData)
+	}
+	result.Timings.Transform += time.Since(stageStart)
+
+	if !fi.opened {
+		if err := cs.openImport(fi, len(sensorData), result); err != nil {
+			return err
+		}
+	}
+
+	// Link every reading to the import batch
+	if fi.batchID != 0 {
+		for i := range sensorData {
+			sensorData[i].ImportFileID = &fi.batchID
+		}
+	}
+
+	// Resume after the readings committed by an interrupted run
+	if fi.skip > 0 {
+		skipped := min(fi.skip, len(sensorData))
+		sensorData = sensorData[skipped:]
+		fi.skip -= skipped
+	}
+	if len(sensorData) == 0 {
+		return nil
+	}
+
+	// Queue the readings for the insert workers, which time themselves
+	if cs.insertWorkers > 1 {
+		if fi.pipeline == nil {
+			fi.pipeline = cs.startInsertPipeline(ctx, result, fi.checkpoint)
+		}
+		if err := fi.pipeline.queue(sensorData); err != nil {
+			return fmt.Errorf("failed to insert data: %w", err)
+		}
+		return nil
+	}
+
+	// Batch insert sensor data
+	stageStart = time.Now()
+	err = cs.batchInsertSensorData(ctx, sensorData, result, fi.checkpoint)
+	result.Timings.Insert += time.Since(stageStart)
+	if err != nil {
+		return fmt.Errorf("failed to insert data: %w", err)
+	}
+	if fi.checkpoint != nil {
+		fi.checkpoint.base += len(sensorData)
+	}
+	return nil
+}
+
+// finishInserts waits until the insert workers of the file, if any, have
+// inserted every queued batch
+func (fi *fileImport) finishInserts() error {
+	if fi.pipeline == nil {
+		return nil
+	}
+	pipeline := fi.pipeline
+	fi.pipeline = nil
+	if err := pipeline.wait(); err != nil {
+		return fmt.Errorf("failed to insert data: %w", err)
+	}
+	return nil
+}
+
+// openImport opens the import batch of a file and loads its checkpoint.
+// count is the number of readings in the file, or in its first chunk.
+func (cs *CSVScanner) openImport(fi *fileImport, count int, result *ProcessResult) error {
+	fi.opened = true
+	if fi.fingerprint == nil {
+		return nil
+	}
+
+	var err error
+	if cs.manifest {
+		if fi.batchID, err = cs.beginImport(fi.job, *fi.fingerprint); err != nil {
+			return err
+		}
+		result.BatchID = fi.batchID
+	}
+
+	if cs.checkpoints {
+		if fi.checkpoint, err = cs.loadCheckpoint(fi.job.FileName, *fi.fingerprint); err != nil {
+			return err
+		}
+		base := fi.checkpoint.base
+		if base > 0 && (fi.chunked || base <= count) {
+			logger.Printf("Resuming %s after %d committed readings\n", fi.job.FileName, base)
+			result.ResumedAfter = base
+			fi.skip = base
+		} else {
+			fi.checkpoint.base = 0
+		}
+	}
+	return nil
+}
+
+// importCSVChunks parses and stores a CSV file cs.maxRowsInMemory rows at a
+// time, so files larger than memory can be imported. Later chunks are parsed
+// with the header row of the first chunk in front of them.
+func (cs *CSVScanner) importCSVChunks(ctx context.Context, fi *fileImport, reader *csv.Reader, result *ProcessResult) error {
+	var header []string
+	rowsRead := 0
+
+	for {
+		stageStart := time.Now()
+		records, err := readCSVChunk(reader, cs.maxRowsInMemory)
+		result.Timings.Read += time.Since(stageStart)
+		if err != nil {
+			return fmt.Errorf("failed to read CSV: %w", err)
+		}
+		if len(records) == 0 {
+			if rowsRead == 0 {
+				return fmt.Errorf("empty CSV file")
+			}
+			return nil
+		}
+
+		chunkRows := len(records)
+		result.rowOffset = rowsRead
+		if header != nil {
+			records = append([][]string{header}, records...)
+			result.rowOffset--
+		}
+
+		stageStart = time.Now()
+		var sensorData []models.SensorData
+		if !cs.parseSummaries(fi, records, result) {
+			sensorData = cs.parseRecords(records, fi.job.FileName, result)
+		}
+		result.Timings.Parse += time.Since(stageStart)
+		if result.Error != nil {
+			return result.Error
+		}
+		// Chunks already stored stay, but no more are parsed or inserted
+		if err := result.errorLimit.check(result, false); err != nil {
+			return err
+		}
+		if rowsRead == 0 {
+			header = result.rejectHeader
+		}
+		rowsRead += chunkRows
+		result.RecordCount += len(sensorData)
+
+		if err := cs.storeReadings(ctx, fi, sensorData, result); err != nil {
+			return err
+		}
+		logger.Debugf("Stored %d rows of %s\n", rowsRead, fi.job.FileName)
+	}
+}
+
+// readCSVChunk reads up to limit records, returning fewer at the end of the input
+func readCSVChunk(reader *csv.Reader, limit int) ([][]string, error) {
+	var records [][]string
+	for len(records) < limit {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
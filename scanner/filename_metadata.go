@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultFilenameSensorName builds the sensor name from the sensor_name group
+const DefaultFilenameSensorName = "{sensor_name}"
+
+// placeholderPattern matches the {group} placeholders of a sensor name template
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// filenameMetadata supplies the sensor of rows without one from named groups
+// of a regular expression matched against the file name, such as site and
+// sensor_name in siteA_temp01_2025-09.csv
+type filenameMetadata struct {
+	pattern    *regexp.Regexp
+	sensorName string // Template such as "{site}_{sensor_name}"
+}
+
+// newFilenameMetadata compiles the file name expression, returning nil when
+// none is configured. Every placeholder of the sensor name template must be
+// a named group of the expression.
+func newFilenameMetadata(expr, sensorName string) (*filenameMetadata, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scanner filename_regex: %w", err)
+	}
+	if sensorName == "" {
+		sensorName = DefaultFilenameSensorName
+	}
+
+	placeholders := placeholderPattern.FindAllStringSubmatch(sensorName, -1)
+	if len(placeholders) == 0 {
+		return nil, fmt.Errorf("scanner filename_sensor_name %q has no {group} placeholder", sensorName)
+	}
+	for _, placeholder := range placeholders {
+		if pattern.SubexpIndex(placeholder[1]) < 0 {
+			return nil, fmt.Errorf("scanner filename_regex has no named group (?P<%s>...) used by filename_sensor_name %q",
+				placeholder[1], sensorName)
+		}
+	}
+
+	return &filenameMetadata{pattern: pattern, sensorName: sensorName}, nil
+}
+
+// sensorFor returns the sensor named by a file name, or false when the
+// expression does not match it or a group used by the template is empty
+func (fm *filenameMetadata) sensorFor(fileName string) (string, bool) {
+	if fm == nil {
+		return "", false
+	}
+	match := fm.pattern.FindStringSubmatch(fileName)
+	if match == nil {
+		return "", false
+	}
+
+	complete := true
+	sensorName := placeholderPattern.ReplaceAllStringFunc(fm.sensorName, func(placeholder string) string {
+		value := match[fm.pattern.SubexpIndex(placeholder[1:len(placeholder)-1])]
+		if value == "" {
+			complete = false
+		}
+		return value
+	})
+	sensorName = strings.TrimSpace(sensorName)
+	return sensorName, complete && sensorName != ""
+}
@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fieldNamePattern matches valid placeholder names inside a filename template
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FilenameTemplate is a compiled filename convention such as "{site}_{date}.csv"
+type FilenameTemplate struct {
+	template string
+	pattern  *regexp.Regexp
+}
+
+// CompileFilenameTemplate compiles a filename template into a matcher.
+//
+// Placeholders written as {name} capture part of the file name, "*" matches
+// anything and all other characters must match literally (case-insensitive).
+func CompileFilenameTemplate(template string) (*FilenameTemplate, error) {
+	var expr strings.Builder
+	expr.WriteString("(?i)^")
+
+	rest := template
+	for rest != "" {
+		switch {
+		case rest[0] == '{':
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed placeholder in filename template: %s", template)
+			}
+			name := rest[1:end]
+			if !fieldNamePattern.MatchString(name) {
+				return nil, fmt.Errorf("invalid placeholder {%s} in filename template: %s", name, template)
+			}
+			expr.WriteString("(?P<" + name + ">.+?)")
+			rest = rest[end+1:]
+		case rest[0] == '*':
+			expr.WriteString(".*?")
+			rest = rest[1:]
+		default:
+			next := strings.IndexAny(rest, "{*")
+			if next < 0 {
+				next = len(rest)
+			}
+			expr.WriteString(regexp.QuoteMeta(rest[:next]))
+			rest = rest[next:]
+		}
+	}
+	expr.WriteString("$")
+
+	pattern, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename template %s: %w", template, err)
+	}
+
+	return &FilenameTemplate{template: template, pattern: pattern}, nil
+}
+
+// Match checks a file name against the template and returns the captured fields
+func (ft *FilenameTemplate) Match(fileName string) (map[string]string, bool) {
+	match := ft.pattern.FindStringSubmatch(fileName)
+	if match == nil {
+		return nil, false
+	}
+
+	fields := make(map[string]string)
+	for i, name := range ft.pattern.SubexpNames() {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+
+	return fields, true
+}
+
+// String returns the original template
+func (ft *FilenameTemplate) String() string {
+	return ft.template
+}
+
+// matchFilePattern matches a glob pattern against a file's path relative to the
+// scanned directory, or against its base name when the pattern has no slash.
+// Matching ignores case, so "*.csv" also matches READINGS.CSV.
+func matchFilePattern(pattern, fileName string) bool {
+	name := filepath.ToSlash(fileName)
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return matched
+}
@@ -0,0 +1,41 @@
+package scanner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// footerMatcher recognizes summary rows such as "TOTAL,,123456"
+type footerMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+// newFooterMatcher compiles footer patterns, which are matched against the
+// row's cells joined by commas
+func newFooterMatcher(patterns []string) (footerMatcher, error) {
+	var fm footerMatcher
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fm, fmt.Errorf("invalid footer pattern %q: %w", pattern, err)
+		}
+		fm.patterns = append(fm.patterns, compiled)
+	}
+	return fm, nil
+}
+
+// matches reports whether a row is a summary row
+func (fm footerMatcher) matches(record []string) bool {
+	if len(fm.patterns) == 0 {
+		return false
+	}
+
+	line := strings.Join(record, ",")
+	for _, pattern := range fm.patterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
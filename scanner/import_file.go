@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"sensor_data_import/logger"
+)
+
+// DefaultStdinName is the name standard input is imported under when none is given
+const DefaultStdinName = "stdin.csv"
+
+// ImportFile imports a single data file, or every CSV member of a ZIP
+// archive, through the same pipeline as a directory scan
+func (cs *CSVScanner) ImportFile(ctx context.Context, filePath string) error {
+	filePath = scanRoot(filePath)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", filePath, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory, use scan to import directories", filePath)
+	}
+
+	directoryPath := filepath.Dir(filePath)
+	name := filepath.Base(filePath)
+	if !isZipFile(name) && !isDataFile(name) {
+		logger.Warnf("%s does not have a data file extension, reading it as CSV\n", name)
+	}
+	jobs := []FileJob{{
+		FilePath: filePath,
+		FileName: name,
+		Dir:      ".",
+		Size:     info.Size(),
+	}}
+	if isZipFile(name) {
+		if jobs, err = listZipMembers(filePath, name); err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return fmt.Errorf("no CSV files found in %s", filePath)
+		}
+	}
+
+	results, err := cs.importJobs(ctx, jobs)
+	cs.afterImport.apply(directoryPath, results)
+	return err
+}
+
+// ImportReader imports data piped in on standard input or another stream.
+// name stands in for the file name: its extension selects the parser, and it
+// is matched by column mappings and the filename pattern. The stream cannot
+// be fingerprinted, so it is not recorded in the import manifest and an
+// interrupted import cannot resume.
+func (cs *CSVScanner) ImportReader(ctx context.Context, input io.Reader, name string) error {
+	if name == "" {
+		name = DefaultStdinName
+	}
+	job := FileJob{
+		FilePath: name,
+		FileName: name,
+		Dir:      ".",
+		input:    input,
+	}
+
+	_, err := cs.importJobs(ctx, []FileJob{job})
+	return err
+}
+
+// importJobs imports the jobs of one file and writes the summary. The error
+// reports a failed or cancelled import, so callers can exit non-zero.
+func (cs *CSVScanner) importJobs(ctx context.Context, jobs []FileJob) ([]ProcessResult, error) {
+	if err := cs.beginScan(); err != nil {
+		return nil, err
+	}
+	defer cs.endScan()
+
+	results := cs.processFilesParallel(ctx, jobs, 0)
+	cs.displaySummary(results)
+
+	if err := ctx.Err(); err != nil {
+		return results, fmt.Errorf("import cancelled: %w", err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			return results, fmt.Errorf("import of %s failed: %w", result.FileName, result.Error)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,179 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// pipelineBatch is a batch of readings queued for the insert workers. start
+// and end are its offsets among the readings of the file queued so far.
+type pipelineBatch struct {
+	data       []models.SensorData
+	start, end int
+	remaining  int // Readings of the file not queued before this batch, for progress
+}
+
+// insertPipeline inserts the batches of one file with several workers, so
+// the file keeps being parsed while earlier batches are inserted. Batches
+// commit in any order; the checkpoint only advances over the batches
+// committed without a gap, so a resumed import never skips a reading.
+type insertPipeline struct {
+	cs         *CSVScanner
+	ctx        context.Context
+	result     *ProcessResult
+	checkpoint *fileCheckpoint
+	batches    chan pipelineBatch
+	workers    sync.WaitGroup
+	queued     int // Readings queued so far
+
+	mu         sync.Mutex
+	err        error
+	committed  int         // Readings committed without a gap from the first
+	done       map[int]int // End offset of each batch committed after a gap, by start offset
+	insertTime time.Duration
+}
+
+// startInsertPipeline starts cs.insertWorkers workers inserting the batches
+// of a file
+func (cs *CSVScanner) startInsertPipeline(ctx context.Context, result *ProcessResult, checkpoint *fileCheckpoint) *insertPipeline {
+	p := &insertPipeline{
+		cs:         cs,
+		ctx:        ctx,
+		result:     result,
+		checkpoint: checkpoint,
+		batches:    make(chan pipelineBatch, cs.insertWorkers),
+		done:       make(map[int]int),
+	}
+	for range cs.insertWorkers {
+		p.workers.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// queue splits readings into batches for the workers, blocking while every
+// worker is busy. It returns the first error of a worker, after which
+// nothing more is queued.
+func (p *insertPipeline) queue(data []models.SensorData) error {
+	p.cs.linkRun(data)
+	step := p.cs.transactionSize(len(data))
+	for i := 0; i < len(data); i += step {
+		if err := p.failed(); err != nil {
+			return err
+		}
+		if err := p.ctx.Err(); err != nil {
+			return fmt.Errorf("cancelled after %d readings: %w", p.queued, err)
+		}
+
+		end := min(i+step, len(data))
+		batch := pipelineBatch{data: data[i:end], start: p.queued, end: p.queued + end - i, remaining: len(data) - i}
+		select {
+		case p.batches <- batch:
+			p.queued = batch.end
+		case <-p.ctx.Done():
+			return fmt.Errorf("cancelled after %d readings: %w", p.queued, p.ctx.Err())
+		}
+	}
+	return p.failed()
+}
+
+// wait lets the workers finish the queued batches and returns the first
+// error, adding the time spent inserting to the file's timings
+func (p *insertPipeline) wait() error {
+	close(p.batches)
+	p.workers.Wait()
+	p.result.Timings.Insert += p.insertTime
+	return p.err
+}
+
+// failed returns the first error of a worker
+func (p *insertPipeline) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// work inserts queued batches until the queue is closed. After an error or
+// cancellation, the remaining batches are drained without inserting them.
+func (p *insertPipeline) work() {
+	defer p.workers.Done()
+	for batch := range p.batches {
+		if p.failed() != nil {
+			continue
+		}
+		if err := p.ctx.Err(); err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = fmt.Errorf("cancelled after %d readings: %w", p.committed, err)
+			}
+			p.mu.Unlock()
+			continue
+		}
+
+		// Each batch counts into its own result, merged once it is done
+		start := time.Now()
+		partial := ProcessResult{FileName: p.result.FileName}
+		err := p.insert(batch, &partial)
+		elapsed := time.Since(start)
+
+		p.mu.Lock()
+		p.insertTime += elapsed
+		p.result.ConflictCount += partial.ConflictCount
+		p.result.SkippedCount += partial.SkippedCount
+		p.result.FailedCount += partial.FailedCount
+		p.result.DeadLettered += partial.DeadLettered
+		p.result.Spooled += partial.Spooled
+		if err != nil {
+			if p.err == nil {
+				p.err = err
+			}
+		} else {
+			p.commit(batch)
+		}
+		p.mu.Unlock()
+
+		if err == nil {
+			p.cs.progress.inserted(p.result, len(batch.data), batch.remaining)
+			p.cs.live.inserted(p.result.FileName, len(batch.data))
+		}
+	}
+}
+
+// insert inserts one batch. A panic fails the file rather than the process,
+// which would otherwise end without the rest of the log.
+func (p *insertPipeline) insert(batch pipelineBatch, partial *ProcessResult) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("Panic while inserting readings of %s (run %d): %v\n%s", p.result.FileName, p.cs.run.id(), r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return p.cs.insertSensorBatch(batch.data, partial, nil, 0)
+}
+
+// commit advances the committed offset over the batch and any batches
+// committed earlier that now follow without a gap, saving the checkpoint
+// when it moves. The caller holds p.mu.
+func (p *insertPipeline) commit(batch pipelineBatch) {
+	p.done[batch.start] = batch.end
+	committed := p.committed
+	for end, ok := p.done[committed]; ok; end, ok = p.done[committed] {
+		delete(p.done, committed)
+		committed = end
+	}
+	if committed == p.committed {
+		return
+	}
+	p.committed = committed
+	if p.checkpoint != nil {
+		if err := p.checkpoint.save(p.cs.db, committed); err != nil {
+			logger.Warnf("Failed to save checkpoint for %s: %v\n", p.checkpoint.fileName, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Insert policies for rows whose (timestamp, sensor_name) already exists
+const (
+	InsertPolicyError  = "error"  // Fail the batch and retry rows individually, logging each duplicate
+	InsertPolicySkip   = "skip"   // Keep the existing row
+	InsertPolicyUpdate = "update" // Overwrite the existing value
+)
+
+// policyBatch is the part of a batch inserted with one insert policy
+type policyBatch struct {
+	policy string
+	rows   []models.SensorData
+}
+
+// SetUpsertWindow overwrites existing readings newer than window and skips
+// older duplicates, in place of the insert policy; 0 disables it
+func (cs *CSVScanner) SetUpsertWindow(window time.Duration) {
+	cs.upsertWindow = window
+}
+
+// policyBatches splits a batch by insert policy. With an upsert window,
+// readings after the cutoff use the update policy and older ones the skip
+// policy; otherwise the whole batch uses the insert policy.
+func (cs *CSVScanner) policyBatches(batch []models.SensorData) []policyBatch {
+	if cs.upsertWindow == 0 {
+		return []policyBatch{{policy: cs.insertPolicy, rows: batch}}
+	}
+
+	var recent, older []models.SensorData
+	for _, record := range batch {
+		if record.Timestamp.Before(cs.upsertCutoff) {
+			older = append(older, record)
+		} else {
+			recent = append(recent, record)
+		}
+	}
+
+	var parts []policyBatch
+	if len(recent) > 0 {
+		parts = append(parts, policyBatch{policy: InsertPolicyUpdate, rows: recent})
+	}
+	if len(older) > 0 {
+		parts = append(parts, policyBatch{policy: InsertPolicySkip, rows: older})
+	}
+	return parts
+}
+
+// conflictClause returns the ON CONFLICT / ON DUPLICATE KEY clause for an
+// insert policy; GORM renders it in the dialect of the connected driver
+func conflictClause(policy string) (clause.OnConflict, bool) {
+	columns := []clause.Column{{Name: "timestamp"}, {Name: "sensor_name"}}
+
+	switch policy {
+	case InsertPolicySkip:
+		// MySQL has no DO NOTHING and would otherwise assign the id column,
+		// which a composite key table lacks; a no-op assignment leaves
+		// duplicates unchanged and uncounted
+		return clause.OnConflict{
+			Columns:   columns,
+			DoNothing: true,
+			DoUpdates: []clause.Assignment{{Column: clause.Column{Name: "sensor_name"}, Value: clause.Column{Name: "sensor_name"}}},
+		}, true
+	case InsertPolicyUpdate:
+		return clause.OnConflict{
+			Columns:   columns,
+			DoUpdates: clause.AssignmentColumns([]string{"value", "source_file", "source_modified_at", "import_file_id", "source_run_id"}),
+		}, true
+	default:
+		return clause.OnConflict{}, false
+	}
+}
+
+// insertBatch inserts a batch with an insert policy and returns the number
+// of rows skipped as duplicates
+func (cs *CSVScanner) insertBatch(tx *gorm.DB, batch []models.SensorData, policy string) (skipped int, err error) {
+	if cs.staging != nil {
+		return cs.insertStaged(tx, batch, policy)
+	}
+
+	db := cs.targetTable(tx)
+	onConflict, ok := conflictClause(policy)
+	if !ok || cs.rawIngest {
+		// Rows that need no conflict handling can be streamed with COPY
+		if copyFrom, ok := copyFromOf(tx); ok {
+			return 0, copyFrom(cs.targetTableName(), batch)
+		}
+		return 0, db.CreateInBatches(batch, cs.batchSize).Error
+	}
+
+	insert := db.Clauses(onConflict).CreateInBatches(batch, cs.batchSize)
+	if insert.Error != nil {
+		return 0, insert.Error
+	}
+	if policy == InsertPolicySkip {
+		skipped = len(batch) - int(insert.RowsAffected)
+	}
+	return skipped, nil
+}
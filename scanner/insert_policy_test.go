@@ -0,0 +1,163 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB returns a connection of the driver that only builds statements
+func dryRunDB(t *testing.T, driver string) *gorm.DB {
+	t.Helper()
+	var dialector gorm.Dialector
+	switch driver {
+	case "mysql":
+		dialector = mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/sensors?parseTime=true", SkipInitializeWithVersion: true})
+	case "postgres":
+		dialector = postgres.New(postgres.Config{DSN: "host=127.0.0.1 user=user dbname=sensors"})
+	case "sqlite":
+		dialector = sqlite.Open(filepath.Join(t.TempDir(), "sensor.db"))
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open %s: %v", driver, err)
+	}
+	return db
+}
+
+// insertSQL returns the statement inserting a reading with the insert policy
+func insertSQL(t *testing.T, db *gorm.DB, policy string) string {
+	t.Helper()
+	onConflict, ok := conflictClause(policy)
+	if !ok {
+		t.Fatalf("no conflict clause for policy %s", policy)
+	}
+	readings := []models.SensorData{{Timestamp: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), SensorName: "temp_01", Value: 1}}
+	stmt := db.Clauses(onConflict).Create(&readings)
+	if stmt.Error != nil {
+		t.Fatalf("build %s insert: %v", policy, stmt.Error)
+	}
+	return stmt.Statement.SQL.String()
+}
+
+func TestConflictClausePerDriver(t *testing.T) {
+	defer models.SetIDStrategy(models.IDAutoIncrement, 0)
+
+	tests := []struct {
+		driver, strategy, policy string
+		want                     string
+	}{
+		{"mysql", models.IDAutoIncrement, InsertPolicySkip, "ON DUPLICATE KEY UPDATE `sensor_name`=`sensor_name`"},
+		{"mysql", models.IDComposite, InsertPolicySkip, "ON DUPLICATE KEY UPDATE `sensor_name`=`sensor_name`"},
+		{"mysql", models.IDAutoIncrement, InsertPolicyUpdate, "ON DUPLICATE KEY UPDATE `value`=VALUES(`value`)"},
+		{"postgres", models.IDAutoIncrement, InsertPolicySkip, `ON CONFLICT ("timestamp","sensor_name") DO NOTHING`},
+		{"postgres", models.IDComposite, InsertPolicySkip, `ON CONFLICT ("timestamp","sensor_name") DO NOTHING RETURNING "sensor_name"`},
+		{"postgres", models.IDAutoIncrement, InsertPolicyUpdate, `ON CONFLICT ("timestamp","sensor_name") DO UPDATE SET "value"="excluded"."value"`},
+		{"sqlite", models.IDAutoIncrement, InsertPolicySkip, "ON CONFLICT (`timestamp`,`sensor_name`) DO NOTHING"},
+		{"sqlite", models.IDSnowflake, InsertPolicyUpdate, "ON CONFLICT (`timestamp`,`sensor_name`) DO UPDATE SET `value`=`excluded`.`value`"},
+	}
+	for _, tt := range tests {
+		models.SetIDStrategy(tt.strategy, 0)
+		sql := insertSQL(t, dryRunDB(t, tt.driver), tt.policy)
+		if !strings.Contains(sql, tt.want) {
+			t.Errorf("%s %s with %s:\n%s\nwant %s", tt.driver, tt.policy, tt.strategy, sql, tt.want)
+		}
+		if tt.driver == "mysql" && strings.Contains(sql, "`id`=`id`") {
+			t.Errorf("mysql %s with %s assigns the id column:\n%s", tt.policy, tt.strategy, sql)
+		}
+	}
+}
+
+func TestInsertBatchPolicies(t *testing.T) {
+	at := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	batch := func(value float64) []models.SensorData {
+		return []models.SensorData{
+			{Timestamp: at, SensorName: "temp_01", Value: value},
+			{Timestamp: at.Add(time.Minute), SensorName: "temp_01", Value: value},
+		}
+	}
+
+	tests := []struct {
+		policy      string
+		wantSkipped int
+		wantValue   float64 // Value of the existing reading afterwards
+		wantErr     bool
+	}{
+		{InsertPolicySkip, 1, 1, false},
+		{InsertPolicyUpdate, 0, 2, false},
+		{InsertPolicyError, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			db := openTestDB(t)
+			insertRows(t, db, models.SensorData{Timestamp: at, SensorName: "temp_01", Value: 1})
+
+			skipped, err := NewCSVScanner(db).insertBatch(db, batch(2), tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("insertBatch error = %v, want error %v", err, tt.wantErr)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("skipped = %d, want %d", skipped, tt.wantSkipped)
+			}
+
+			var existing models.SensorData
+			if err := db.Where("sensor_name = ? AND timestamp = ?", "temp_01", at).First(&existing).Error; err != nil {
+				t.Fatalf("read existing reading: %v", err)
+			}
+			if existing.Value != tt.wantValue {
+				t.Errorf("existing value = %v, want %v", existing.Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestIndividualInsertPolicies(t *testing.T) {
+	at := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		policy      string
+		wantSkipped int
+		wantFailed  int
+		wantValue   float64 // Value of the existing reading afterwards
+	}{
+		{InsertPolicySkip, 1, 0, 1},
+		{InsertPolicyUpdate, 0, 0, 2},
+		{InsertPolicyError, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			db := openTestDB(t)
+			insertRows(t, db, models.SensorData{Timestamp: at, SensorName: "temp_01", Value: 1})
+
+			cs := NewCSVScanner(db)
+			cs.insertPolicy = tt.policy
+			result := ProcessResult{FileName: "readings.csv"}
+			err := cs.individualInsert([]models.SensorData{
+				{Timestamp: at, SensorName: "temp_01", Value: 2},
+				{Timestamp: at.Add(time.Minute), SensorName: "temp_01", Value: 2},
+			}, &result)
+			if err != nil {
+				t.Fatalf("individualInsert: %v", err)
+			}
+			if result.SkippedCount != tt.wantSkipped || result.FailedCount != tt.wantFailed {
+				t.Errorf("skipped %d and failed %d, want %d and %d", result.SkippedCount, result.FailedCount, tt.wantSkipped, tt.wantFailed)
+			}
+
+			var stored []models.SensorData
+			if err := db.Order("timestamp").Find(&stored).Error; err != nil {
+				t.Fatalf("read readings: %v", err)
+			}
+			if len(stored) != 2 || stored[0].Value != tt.wantValue {
+				t.Errorf("stored readings = %+v, want the existing one with value %v and the new one", stored, tt.wantValue)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// Journal actions
+const (
+	JournalImport = "import" // A file was imported
+	JournalFail   = "fail"   // A file failed to import
+	JournalRevert = "revert" // An import batch was reverted
+)
+
+// journalHashField ends every journal line, after the checksummed fields
+const journalHashField = `,"hash":"`
+
+// maxJournalLine is the longest journal line read back
+const maxJournalLine = 1024 * 1024
+
+// JournalEntry is one line of the import journal. Hash is the SHA-256 of the
+// line without it, and Prev the hash of the line before, so an edited,
+// removed or reordered line breaks the chain.
+type JournalEntry struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Action  string    `json:"action"`
+	File    string    `json:"file"`             // Name in logs and the import manifest
+	Path    string    `json:"path,omitempty"`   // Local file on the host, for replay
+	Member  string    `json:"member,omitempty"` // Member of a ZIP archive
+	Source  string    `json:"source,omitempty"` // URL of a downloaded file
+	SHA256  string    `json:"sha256,omitempty"`
+	BatchID uint      `json:"batch_id,omitempty"`
+	Records int       `json:"records"`
+	Errors  int       `json:"errors"`
+	Error   string    `json:"error,omitempty"`
+	Prev    string    `json:"prev"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// journal appends checksummed import actions to a local JSON Lines file, a
+// record of what this host ingested that outlives the database
+type journal struct {
+	mu   sync.Mutex
+	file *os.File
+	host string
+	seq  int64
+	prev string
+}
+
+// openJournal opens the journal for appending, continuing the chain of its
+// last entry
+func openJournal(journalPath string) (*journal, error) {
+	last, err := lastJournalEntry(journalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %w", journalPath, err)
+	}
+	file, err := os.OpenFile(journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	host, _ := os.Hostname()
+	return &journal{file: file, host: host, seq: last.Seq, prev: last.Hash}, nil
+}
+
+// lastJournalEntry returns the last entry of a journal, or an empty entry
+// when the journal does not exist yet
+func lastJournalEntry(journalPath string) (JournalEntry, error) {
+	var last JournalEntry
+	file, err := os.Open(journalPath)
+	if os.IsNotExist(err) {
+		return last, nil
+	}
+	if err != nil {
+		return last, err
+	}
+	defer file.Close()
+
+	// Entries are short: read the tail of the file rather than all of it
+	info, err := file.Stat()
+	if err != nil {
+		return last, err
+	}
+	offset := max(info.Size()-maxJournalLine, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return last, err
+	}
+	tail = bytes.TrimRight(tail, "\n")
+	if len(tail) == 0 {
+		return last, nil
+	}
+	line := tail[bytes.LastIndexByte(tail, '\n')+1:]
+	if err := json.Unmarshal(line, &last); err != nil || last.Hash == "" {
+		return last, fmt.Errorf("last line is not a journal entry (run journal:verify)")
+	}
+	return last, nil
+}
+
+// Close closes the journal file
+func (j *journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// append writes an entry and syncs it to disk; a nil journal is disabled
+func (j *journal) append(entry JournalEntry) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry.Seq = j.seq + 1
+	entry.Time = time.Now().UTC()
+	entry.Host = j.host
+	entry.Prev = j.prev
+	entry.Hash = ""
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	line := append(body[:len(body)-1], journalHashField+hash+"\"}\n"...)
+	if _, err := j.file.Write(line); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.seq, j.prev = entry.Seq, hash
+	return nil
+}
+
+// recordJournal appends the outcome of a file import to the journal
+func (cs *CSVScanner) recordJournal(job FileJob, result ProcessResult) {
+	if cs.journal == nil || result.AlreadyDone || result.Cancelled {
+		return
+	}
+
+	entry := JournalEntry{
+		Action:  JournalImport,
+		File:    job.FileName,
+		Member:  job.Member,
+		Source:  job.source,
+		SHA256:  result.SHA256,
+		BatchID: result.BatchID,
+		Records: result.RecordCount,
+		Errors:  result.ErrorCount,
+	}
+	if job.input == nil && job.source == "" {
+		entry.Path = scanRoot(job.FilePath)
+	}
+	if result.Error != nil {
+		entry.Action = JournalFail
+		entry.Error = result.Error.Error()
+	}
+	if err := cs.journal.append(entry); err != nil {
+		logger.Warnf("Failed to write import journal: %v\n", err)
+	}
+}
+
+// AppendJournalRevert appends a reverted import batch to the journal
+func AppendJournalRevert(journalPath string, batch models.ImportFile, rows int) error {
+	j, err := openJournal(journalPath)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	return j.append(JournalEntry{
+		Action:  JournalRevert,
+		File:    batch.FilePath,
+		SHA256:  batch.SHA256,
+		BatchID: batch.ID,
+		Records: rows,
+	})
+}
+
+// JournalReport summarizes a journal checked by VerifyJournal
+type JournalReport struct {
+	Entries    int
+	Imports    int
+	Failures   int
+	Reverts    int
+	Hosts      []string
+	First      time.Time
+	Last       time.Time
+	BrokenLine int   // Line where the checksum chain breaks, 0 when intact
+	Broken     error // Why the chain breaks at BrokenLine
+
+	imported map[string]JournalEntry // Latest import of each contents not reverted since
+}
+
+// VerifyJournal reads a journal and checks its checksum chain. Entries after
+// a break are not read.
+func VerifyJournal(journalPath string) (*JournalReport, error) {
+	file, err := os.Open(journalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	report := &JournalReport{imported: make(map[string]JournalEntry)}
+	hosts := make(map[string]bool)
+	var prev JournalEntry
+
+	lines := bufio.NewScanner(file)
+	lines.Buffer(make([]byte, 0, 64*1024), maxJournalLine)
+	for lineNumber := 1; lines.Scan(); lineNumber++ {
+		entry, err := checkJournalLine(lines.Bytes(), prev)
+		if err != nil {
+			report.BrokenLine, report.Broken = lineNumber, err
+			return report, nil
+		}
+		prev = entry
+
+		report.Entries++
+		if report.First.IsZero() {
+			report.First = entry.Time
+		}
+		report.Last = entry.Time
+		if !hosts[entry.Host] {
+			hosts[entry.Host] = true
+			report.Hosts = append(report.Hosts, entry.Host)
+		}
+		switch entry.Action {
+		case JournalImport:
+			report.Imports++
+			if entry.SHA256 != "" {
+				report.imported[entry.SHA256] = entry
+			}
+		case JournalFail:
+			report.Failures++
+		case JournalRevert:
+			report.Reverts++
+			delete(report.imported, entry.SHA256)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return report, nil
+}
+
+// checkJournalLine decodes a journal line and checks its hash and its link
+// to the entry before
+func checkJournalLine(line []byte, prev JournalEntry) (JournalEntry, error) {
+	var entry JournalEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return entry, fmt.Errorf("not a journal entry: %v", err)
+	}
+
+	at := bytes.LastIndex(line, []byte(journalHashField))
+	if at < 0 || string(line[at:]) != journalHashField+entry.Hash+"\"}" {
+		return entry, fmt.Errorf("entry has no checksum")
+	}
+	sum := sha256.Sum256(append(line[:at:at], '}'))
+	if hex.EncodeToString(sum[:]) != entry.Hash {
+		return entry, fmt.Errorf("checksum mismatch, the entry was modified")
+	}
+	if entry.Seq != prev.Seq+1 || entry.Prev != prev.Hash {
+		return entry, fmt.Errorf("entry %d does not follow entry %d, entries were removed or reordered", entry.Seq, prev.Seq)
+	}
+	return entry, nil
+}
+
+// MissingImports returns the files the journal records as imported, and not
+// reverted since, whose contents are not in the import manifest, such as
+// after the database was rebuilt. Imports from standard input have no hash
+// and are not listed.
+func (cs *CSVScanner) MissingImports(report *JournalReport) ([]JournalEntry, error) {
+	hashes := make([]string, 0, len(report.imported))
+	for hash := range report.imported {
+		hashes = append(hashes, hash)
+	}
+
+	known := make(map[string]bool)
+	for start := 0; start < len(hashes); start += cs.batchSize {
+		var found []string
+		if err := cs.db.Model(&models.ImportFile{}).
+			Where("sha256 IN ? AND completed = ?", hashes[start:min(start+cs.batchSize, len(hashes))], true).
+			Pluck("sha256", &found).Error; err != nil {
+			return nil, fmt.Errorf("failed to read import manifest: %w", err)
+		}
+		for _, hash := range found {
+			known[hash] = true
+		}
+	}
+
+	var missing []JournalEntry
+	for hash, entry := range report.imported {
+		if !known[hash] {
+			missing = append(missing, entry)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Seq < missing[j].Seq })
+	return missing, nil
+}
+
+// ReplayResult counts the journaled files replayed by ReplayJournal
+type ReplayResult struct {
+	Replayed  int // Still on disk with the journaled contents
+	Changed   int // On disk with different contents
+	Gone      int // No longer on disk
+	Remote    int // Downloaded or read from standard input, so not kept
+	Cancelled bool
+}
+
+// ReplayJournal imports the journaled files that are missing from the
+// database again, from where the journal says they were read. Files whose
+// contents changed since are left out. With dryRun nothing is imported.
+func (cs *CSVScanner) ReplayJournal(ctx context.Context, entries []JournalEntry, dryRun bool) (ReplayResult, error) {
+	var result ReplayResult
+	var jobs []FileJob
+	for _, entry := range entries {
+		if entry.Path == "" {
+			result.Remote++
+			logger.Printf("  %s: %s\n", entry.File, "not replayable, it was not read from a local file")
+			continue
+		}
+		job := FileJob{FilePath: entry.Path, FileName: entry.File, Dir: path.Dir(entry.File), Member: entry.Member}
+		fingerprint, err := fingerprintJob(job)
+		if err != nil {
+			result.Gone++
+			logger.Warnf("  %s: %s is gone (%v)\n", entry.File, entry.Path, err)
+			continue
+		}
+		if fingerprint.hash != entry.SHA256 {
+			result.Changed++
+			logger.Warnf("  %s: %s has changed since it was imported, left out\n", entry.File, entry.Path)
+			continue
+		}
+		if info, err := os.Stat(entry.Path); err == nil {
+			job.Size = info.Size()
+		}
+		jobs = append(jobs, job)
+		result.Replayed++
+		logger.Printf("  %s: replaying %s\n", entry.File, entry.Path)
+	}
+
+	if dryRun || len(jobs) == 0 {
+		return result, nil
+	}
+	_, err := cs.importJobs(ctx, jobs)
+	result.Cancelled = ctx.Err() != nil
+	return result, err
+}
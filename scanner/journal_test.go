@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+// journalScanner returns a scanner recording its imports in the journal at
+// journalPath, over a new database with the import manifest
+func journalScanner(t *testing.T, journalPath string) *CSVScanner {
+	t.Helper()
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.ImportFile{}); err != nil {
+		t.Fatalf("create import_files: %v", err)
+	}
+	cs := NewCSVScanner(db)
+	if err := cs.Configure(config.ScannerConfig{JournalFile: journalPath}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	return cs
+}
+
+func TestJournalChainDetectsTampering(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := openJournal(journalPath)
+	if err != nil {
+		t.Fatalf("openJournal: %v", err)
+	}
+	j.append(JournalEntry{Action: JournalImport, File: "a.csv", SHA256: "aaaa", Records: 10})
+	j.append(JournalEntry{Action: JournalFail, File: "b.csv", Error: "broken"})
+	j.Close()
+
+	// Reopening continues the chain
+	if err := AppendJournalRevert(journalPath, models.ImportFile{ID: 1, FilePath: "a.csv", SHA256: "aaaa"}, 10); err != nil {
+		t.Fatalf("AppendJournalRevert: %v", err)
+	}
+	report, err := VerifyJournal(journalPath)
+	if err != nil {
+		t.Fatalf("VerifyJournal: %v", err)
+	}
+	if report.BrokenLine != 0 || report.Entries != 3 || report.Imports != 1 || report.Failures != 1 || report.Reverts != 1 || len(report.imported) != 0 {
+		t.Fatalf("report = %+v, want an intact chain of 3 entries with the import reverted", report)
+	}
+
+	original, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(original, []byte("\n"))
+	for name, tampered := range map[string][]byte{
+		"edited":    bytes.Replace(original, []byte(`"records":10`), []byte(`"records":11`), 1),
+		"removed":   bytes.Join([][]byte{lines[0], lines[2]}, nil),
+		"reordered": bytes.Join([][]byte{lines[1], lines[0], lines[2]}, nil),
+	} {
+		if err := os.WriteFile(journalPath, tampered, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		report, err := VerifyJournal(journalPath)
+		if err != nil || report.BrokenLine == 0 {
+			t.Errorf("%s journal: report %+v, %v; want the broken line found", name, report, err)
+		}
+	}
+
+	// New entries are not chained onto a journal that does not end in one
+	if err := os.WriteFile(journalPath, append(original, "garbage\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openJournal(journalPath); err == nil {
+		t.Error("opened a journal whose last line is not an entry")
+	}
+}
+
+func TestJournalReplaysImportsMissingFromTheDatabase(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n",
+		"b.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_02,2\n",
+		"c.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_03,3\n",
+	})
+	if err := journalScanner(t, journalPath).ScanDirectory(context.Background(), dir); err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+
+	// The database is rebuilt, and meanwhile b.csv changed and c.csv is gone
+	writeFiles(t, dir, map[string]string{"b.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_02,20\n"})
+	if err := os.Remove(filepath.Join(dir, "c.csv")); err != nil {
+		t.Fatal(err)
+	}
+	cs := journalScanner(t, "")
+	report, err := VerifyJournal(journalPath)
+	if err != nil || report.BrokenLine != 0 || report.Imports != 3 {
+		t.Fatalf("report = %+v, %v; want 3 imports", report, err)
+	}
+	missing, err := cs.MissingImports(report)
+	if err != nil {
+		t.Fatalf("MissingImports: %v", err)
+	}
+	if len(missing) != 3 {
+		t.Fatalf("missing = %+v, want all 3 files", missing)
+	}
+
+	if result, err := cs.ReplayJournal(context.Background(), missing, true); err != nil || result.Replayed != 1 || countRows(t, cs.db, &models.SensorData{}) != 0 {
+		t.Fatalf("dry run = %+v, %v; want a.csv listed and nothing imported", result, err)
+	}
+	result, err := cs.ReplayJournal(context.Background(), missing, false)
+	if err != nil {
+		t.Fatalf("ReplayJournal: %v", err)
+	}
+	if result.Replayed != 1 || result.Changed != 1 || result.Gone != 1 {
+		t.Errorf("replay = %+v, want a.csv replayed, b.csv changed and c.csv gone", result)
+	}
+	var stored []models.SensorData
+	if err := cs.db.Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	if len(stored) != 1 || stored[0].SensorName != "temp_01" {
+		t.Errorf("stored = %+v, want the reading of a.csv", stored)
+	}
+	if missing, err := cs.MissingImports(report); err != nil || len(missing) != 2 {
+		t.Errorf("missing after the replay = %+v, %v; want b.csv and c.csv", missing, err)
+	}
+}
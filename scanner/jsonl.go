@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"sensor_data_import/config"
+)
+
+// maxJSONLineSize limits a single JSON Lines record to 1 MiB
+const maxJSONLineSize = 1024 * 1024
+
+// isJSONLinesFile reports whether a file name looks like a plain or gzip-compressed JSON Lines file
+func isJSONLinesFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(baseCSVName(name))) {
+	case ".jsonl", ".ndjson":
+		return true
+	}
+	return false
+}
+
+// isDataFile reports whether the scanner has a parser for the file
+func isDataFile(name string) bool {
+	return isCSVFile(name) || isJSONLinesFile(name)
+}
+
+// readJSONLines converts JSON Lines input into timestamp, sensor_name, value
+// records so it can go through the same row parser as CSV files. Invalid
+// lines are counted as errors and kept as empty records to preserve row numbers.
+func readJSONLines(r io.Reader, fields config.JSONFieldsConfig, fileName string, result *ProcessResult) ([][]string, error) {
+	var records [][]string
+
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64*1024), maxJSONLineSize)
+
+	for lines.Scan() {
+		// Stop reading once the file has too many errors to be worth finishing
+		if result.errorLimit.exceeded(result, false) {
+			break
+		}
+		result.rowsParsed++
+
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 {
+			records = append(records, nil)
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			result.reject(fileName, len(records)+1, []string{string(line)}, ErrorMalformed, fmt.Sprintf("not a valid JSON object: %v", err))
+			records = append(records, nil)
+			continue
+		}
+
+		records = append(records, []string{
+			jsonFieldString(object[fields.Timestamp]),
+			jsonFieldString(object[fields.SensorName]),
+			jsonFieldString(object[fields.Value]),
+		})
+	}
+
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSON Lines: %w", err)
+	}
+
+	return records, nil
+}
+
+// jsonFieldString renders a decoded JSON value as the text the row parser expects
+func jsonFieldString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,247 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// Consumer timings
+const (
+	kafkaCommitInterval = time.Second      // Acknowledged offsets are committed at most this often
+	kafkaCommitTimeout  = 10 * time.Second // Bounds the final commit on the way out
+)
+
+// kafkaConsumer reads the partitions assigned to it by its consumer group.
+// Offsets are only committed once marked, after the readings of the records
+// are committed, so records are delivered at least once.
+type kafkaConsumer struct {
+	client *kgo.Client
+	source string // First bootstrap broker, recorded in the source of the readings
+	group  string
+}
+
+// newKafkaConsumer builds the consumer from the ingest kafka section
+func newKafkaConsumer(cfg config.KafkaConfig) (*kafkaConsumer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("no Kafka brokers: set ingest kafka brokers in config.yaml")
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, fmt.Errorf("no Kafka topics: set ingest kafka topics in config.yaml")
+	}
+
+	var brokers []string
+	for _, broker := range cfg.Brokers {
+		brokers = append(brokers, os.ExpandEnv(broker))
+	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "sensor_data_import"
+	}
+	sessionTimeout := 30 * time.Second
+	if cfg.SessionTimeout != "" {
+		var err error
+		if sessionTimeout, err = time.ParseDuration(cfg.SessionTimeout); err != nil {
+			return nil, fmt.Errorf("invalid ingest kafka session_timeout: %w", err)
+		}
+	}
+	resetTo := kgo.NewOffset().AtStart()
+	if cfg.AutoOffsetReset == "latest" {
+		resetTo = kgo.NewOffset().AtEnd()
+	}
+
+	consumer := &kafkaConsumer{source: brokers[0], group: cfg.GroupID}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.ClientID(clientID),
+		kgo.ConsumerGroup(cfg.GroupID),
+		kgo.ConsumeTopics(cfg.Topics...),
+		kgo.Balancers(kgo.RangeBalancer()),
+		kgo.SessionTimeout(sessionTimeout),
+		kgo.ConsumeResetOffset(resetTo),
+		kgo.AutoCommitMarks(),
+		kgo.AutoCommitInterval(kafkaCommitInterval),
+		kgo.OnPartitionsAssigned(consumer.assigned),
+		kgo.WithLogger(kafkaLogger{}),
+	}
+	if cfg.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{}))
+	}
+	if cfg.SASL.Mechanism != "" {
+		mechanism, err := kafkaSASL(cfg.SASL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka settings: %w", err)
+	}
+	consumer.client = client
+	return consumer, nil
+}
+
+// kafkaSASL returns the SASL mechanism of the ingest kafka sasl section
+func kafkaSASL(cfg config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	username, password := os.ExpandEnv(cfg.Username), os.ExpandEnv(cfg.Password)
+	switch strings.ToUpper(cfg.Mechanism) {
+	case "PLAIN":
+		return plain.Auth{User: username, Pass: password}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: username, Pass: password}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: username, Pass: password}.AsSha512Mechanism(), nil
+	}
+	return nil, fmt.Errorf("unknown ingest kafka sasl mechanism %q (expected PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512)", cfg.Mechanism)
+}
+
+// IngestKafka consumes the configured topics as a member of the consumer
+// group and inserts the readings of the records until ctx is cancelled. The
+// group's committed offsets are advanced only after the readings are
+// committed, so records received before a crash are read again; their
+// readings already exist and are skipped.
+func (cs *CSVScanner) IngestKafka(ctx context.Context, cfg config.IngestConfig) (StreamStats, error) {
+	consumer, err := newKafkaConsumer(cfg.Kafka)
+	if err != nil {
+		return StreamStats{}, err
+	}
+	flushInterval, err := time.ParseDuration(cfg.FlushInterval)
+	if err != nil {
+		consumer.client.Close()
+		return StreamStats{}, fmt.Errorf("invalid ingest flush_interval: %w", err)
+	}
+	// Closing leaves the group, so the partitions move to the other members
+	defer consumer.client.Close()
+	queue, err := cs.openStreamQueue(cfg)
+	if err != nil {
+		return StreamStats{}, err
+	}
+	defer queue.close()
+
+	// Reach a broker before ingesting so configuration errors fail right away
+	if err := consumer.client.Ping(ctx); err != nil {
+		return StreamStats{}, fmt.Errorf("failed to reach the Kafka brokers: %w", err)
+	}
+
+	consumeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	messages := make(chan streamMessage, cs.batchSize)
+	consumeErr := make(chan error, 1)
+	go func() {
+		consumeErr <- consumer.consume(consumeCtx, messages)
+		close(messages)
+	}()
+
+	stats, err := cs.ingestStream(ctx, messages, cfg.Kafka.PayloadFormat, flushInterval, queue)
+	cancel()
+	if receiveErr := <-consumeErr; err == nil {
+		err = receiveErr
+	}
+
+	// Commit the offsets of the readings flushed on the way out
+	commitCtx, cancelCommit := context.WithTimeout(context.Background(), kafkaCommitTimeout)
+	defer cancelCommit()
+	if commitErr := consumer.client.CommitMarkedOffsets(commitCtx); commitErr != nil {
+		logger.Warnf("Failed to commit Kafka offsets, the last records will be read again: %v\n", commitErr)
+	}
+	return stats, err
+}
+
+// consume polls records and passes them to messages until ctx is cancelled.
+// The client rejoins the group after rebalances and lost connections itself;
+// only errors no retry can fix end the ingest.
+func (k *kafkaConsumer) consume(ctx context.Context, messages chan<- streamMessage) error {
+	for {
+		fetches := k.client.PollFetches(ctx)
+		if ctx.Err() != nil || fetches.IsClientClosed() {
+			return nil
+		}
+
+		var fatal error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			switch {
+			case errors.Is(err, context.Canceled):
+			case isFatalKafkaError(err):
+				fatal = fmt.Errorf("fetch of %s/%d failed: %w", topic, partition, err)
+			default:
+				logger.Warnf("Fetch of %s/%d failed, retrying: %v\n", topic, partition, err)
+			}
+		})
+		if fatal != nil {
+			return fatal
+		}
+
+		records := fetches.RecordIter()
+		for !records.Done() {
+			record := records.Next()
+			message := streamMessage{
+				name:    record.Topic,
+				source:  streamSource("kafka", k.source, record.Topic),
+				payload: record.Value,
+				ack: func() error {
+					k.client.MarkCommitRecords(record)
+					return nil
+				},
+			}
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// isFatalKafkaError reports whether a fetch error stays until the
+// configuration or the broker's ACLs change
+func isFatalKafkaError(err error) bool {
+	return errors.Is(err, kerr.TopicAuthorizationFailed) ||
+		errors.Is(err, kerr.GroupAuthorizationFailed) ||
+		errors.Is(err, kerr.SaslAuthenticationFailed) ||
+		errors.Is(err, kerr.UnsupportedSaslMechanism)
+}
+
+// assigned logs the partitions the group assigned to this member
+func (k *kafkaConsumer) assigned(_ context.Context, _ *kgo.Client, partitions map[string][]int32) {
+	var names []string
+	for topic, numbers := range partitions {
+		for _, number := range numbers {
+			names = append(names, topic+"/"+strconv.Itoa(int(number)))
+		}
+	}
+	sort.Strings(names)
+	logger.Printf("Joined Kafka consumer group %s, reading %d more partition(s): %s\n",
+		k.group, len(names), strings.Join(names, ", "))
+}
+
+// kafkaLogger passes the client's warnings and errors to the log
+type kafkaLogger struct{}
+
+func (kafkaLogger) Level() kgo.LogLevel {
+	return kgo.LogLevelWarn
+}
+
+func (kafkaLogger) Log(level kgo.LogLevel, msg string, keyvals ...any) {
+	var fields strings.Builder
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fmt.Fprintf(&fields, " %v=%v", keyvals[i], keyvals[i+1])
+	}
+	logger.Warnf("Kafka client: %s%s\n", msg, fields.String())
+}
@@ -0,0 +1,130 @@
+package scanner
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// startKafka starts an in-process Kafka cluster with a two-partition topic
+func startKafka(t *testing.T, topic string) []string {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, topic))
+	if err != nil {
+		t.Fatalf("start Kafka cluster: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster.ListenAddrs()
+}
+
+// produce writes each value as a record, in batches compressed with codec
+func produce(t *testing.T, brokers []string, topic string, codec kgo.CompressionCodec, values ...string) {
+	t.Helper()
+	producer, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ProducerBatchCompression(codec))
+	if err != nil {
+		t.Fatalf("create producer: %v", err)
+	}
+	defer producer.Close()
+	var records []*kgo.Record
+	for _, value := range values {
+		records = append(records, &kgo.Record{Topic: topic, Value: []byte(value)})
+	}
+	if err := producer.ProduceSync(context.Background(), records...).FirstErr(); err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+}
+
+// receive consumes count messages with a new member of group, acknowledging
+// each, and commits their offsets
+func receive(t *testing.T, brokers []string, topic, group string, count int) []string {
+	t.Helper()
+	consumer, err := newKafkaConsumer(config.KafkaConfig{Brokers: brokers, Topics: []string{topic}, GroupID: group, SessionTimeout: "6s"})
+	if err != nil {
+		t.Fatalf("create consumer: %v", err)
+	}
+	defer consumer.client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	messages := make(chan streamMessage)
+	done := make(chan error, 1)
+	go func() { done <- consumer.consume(ctx, messages) }()
+
+	var payloads []string
+	for len(payloads) < count {
+		select {
+		case message := <-messages:
+			if !strings.HasPrefix(message.source, "kafka://") || message.name != topic {
+				t.Errorf("message from %s named %s, want kafka://... named %s", message.source, message.name, topic)
+			}
+			payloads = append(payloads, string(message.payload))
+			if err := message.ack(); err != nil {
+				t.Fatalf("ack: %v", err)
+			}
+		case <-ctx.Done():
+			t.Fatalf("received %d of %d messages before the timeout: %q", len(payloads), count, payloads)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if err := consumer.client.CommitMarkedOffsets(context.Background()); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	sort.Strings(payloads)
+	return payloads
+}
+
+func TestKafkaConsumeCompressedBatches(t *testing.T) {
+	brokers := startKafka(t, "readings")
+	codecs := map[string]kgo.CompressionCodec{
+		"none":   kgo.NoCompression(),
+		"gzip":   kgo.GzipCompression(),
+		"snappy": kgo.SnappyCompression(),
+		"lz4":    kgo.Lz4Compression(),
+		"zstd":   kgo.ZstdCompression(),
+	}
+	var want []string
+	for name, codec := range codecs {
+		values := []string{name + "_1,1", name + "_2,2"}
+		produce(t, brokers, "readings", codec, values...)
+		want = append(want, values...)
+	}
+	sort.Strings(want)
+
+	got := receive(t, brokers, "readings", "sensor_data_import", len(want))
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("payloads = %q, want %q", got, want)
+	}
+}
+
+func TestKafkaResumesAfterCommittedOffsets(t *testing.T) {
+	brokers := startKafka(t, "readings")
+	produce(t, brokers, "readings", kgo.NoCompression(), "first,1", "second,2")
+	receive(t, brokers, "readings", "sensor_data_import", 2)
+
+	// A new member of the group only reads records after the committed ones
+	produce(t, brokers, "readings", kgo.NoCompression(), "third,3")
+	if got := receive(t, brokers, "readings", "sensor_data_import", 1); len(got) != 1 || got[0] != "third,3" {
+		t.Errorf("payloads after the commit = %q, want only third,3", got)
+	}
+}
+
+func TestKafkaSASLMechanisms(t *testing.T) {
+	for _, mechanism := range []string{"PLAIN", "scram-sha-256", "SCRAM-SHA-512"} {
+		if _, err := kafkaSASL(config.KafkaSASLConfig{Mechanism: mechanism, Username: "user", Password: "secret"}); err != nil {
+			t.Errorf("mechanism %s: %v", mechanism, err)
+		}
+	}
+	if _, err := kafkaSASL(config.KafkaSASLConfig{Mechanism: "GSSAPI"}); err == nil {
+		t.Error("unsupported mechanism GSSAPI was accepted")
+	}
+}
@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// enableLastValues turns on last-value maintenance when its table exists
+func (cs *CSVScanner) enableLastValues() {
+	cs.lastValues = cs.db.Migrator().HasTable(&models.SensorLastValue{})
+	if !cs.lastValues {
+		logger.Debugf("Last-value table %s not found, latest readings are not cached\n",
+			models.SensorLastValue{}.TableName())
+	}
+}
+
+// latestPerSensor returns the newest reading of each sensor in a batch;
+// for equal timestamps the later row wins
+func latestPerSensor(batch []models.SensorData) []models.SensorLastValue {
+	index := make(map[string]int)
+	var latest []models.SensorLastValue
+	now := time.Now().UTC()
+
+	for _, record := range batch {
+		i, seen := index[record.SensorName]
+		if seen && record.Timestamp.Before(latest[i].Timestamp) {
+			continue
+		}
+		value := models.SensorLastValue{
+			SensorName: record.SensorName,
+			Timestamp:  record.Timestamp,
+			Value:      record.Value,
+			UpdatedAt:  now,
+		}
+		if seen {
+			latest[i] = value
+		} else {
+			index[record.SensorName] = len(latest)
+			latest = append(latest, value)
+		}
+	}
+
+	return latest
+}
+
+// updateLastValues records the newest reading of each sensor in the batch
+// unless a newer one is already cached. With replaceEqual, a reading at the
+// cached timestamp replaces it, as when an existing value was overwritten.
+func (cs *CSVScanner) updateLastValues(tx *gorm.DB, batch []models.SensorData, replaceEqual bool) error {
+	if !cs.lastValues || len(batch) == 0 {
+		return nil
+	}
+
+	table := models.SensorLastValue{}.TableName()
+	compare := ">"
+	if replaceEqual {
+		compare = ">="
+	}
+
+	var onConflict clause.OnConflict
+	if tx.Dialector.Name() == "mysql" {
+		// MySQL applies assignments left to right, so the timestamp is updated last
+		newer := fmt.Sprintf("VALUES(timestamp) %s timestamp", compare)
+		onConflict = clause.OnConflict{
+			DoUpdates: []clause.Assignment{
+				{Column: clause.Column{Name: "value"}, Value: gorm.Expr("IF(" + newer + ", VALUES(value), value)")},
+				{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("IF(" + newer + ", VALUES(updated_at), updated_at)")},
+				{Column: clause.Column{Name: "timestamp"}, Value: gorm.Expr("IF(" + newer + ", VALUES(timestamp), timestamp)")},
+			},
+		}
+	} else {
+		onConflict = clause.OnConflict{
+			Columns:   []clause.Column{{Name: "sensor_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"timestamp", "value", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				gorm.Expr(fmt.Sprintf("excluded.timestamp %s %s.timestamp", compare, table)),
+			}},
+		}
+	}
+
+	latest := latestPerSensor(batch)
+	if err := tx.Clauses(onConflict).Create(&latest).Error; err != nil {
+		return fmt.Errorf("failed to update last values: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// fileFingerprint identifies the contents of a file for the import manifest
+type fileFingerprint struct {
+	hash    string
+	size    int64
+	modTime time.Time
+}
+
+// fingerprintJob hashes the raw contents of a file, or of a ZIP member
+func fingerprintJob(job FileJob) (fileFingerprint, error) {
+	info, err := os.Stat(job.FilePath)
+	if err != nil {
+		return fileFingerprint{}, err
+	}
+
+	var reader io.ReadCloser
+	if job.Member != "" {
+		reader, err = openZipMember(job.FilePath, job.Member)
+	} else {
+		reader, err = os.Open(job.FilePath)
+	}
+	if err != nil {
+		return fileFingerprint{}, err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, reader)
+	if err != nil {
+		return fileFingerprint{}, err
+	}
+
+	return fileFingerprint{
+		hash:    hex.EncodeToString(hasher.Sum(nil)),
+		size:    size,
+		modTime: info.ModTime().UTC(),
+	}, nil
+}
+
+// enableManifest turns on the import manifest and checkpoints when their tables exist
+func (cs *CSVScanner) enableManifest() {
+	cs.checkpoints = cs.db.Migrator().HasTable(&models.ImportCheckpoint{})
+	if !cs.checkpoints {
+		logger.Warnf("Checkpoint table %s not found (run migrate); interrupted imports will restart from the beginning\n",
+			models.ImportCheckpoint{}.TableName())
+	}
+
+	cs.manifest = cs.db.Migrator().HasTable(&models.ImportFile{})
+	if !cs.manifest {
+		logger.Warnf("Import manifest table %s not found (run migrate); already imported files will not be skipped\n",
+			models.ImportFile{}.TableName())
+	} else if cs.force {
+		logger.Println("Re-importing files even if they were already imported (--force)")
+	}
+
+	cs.fileTags = cs.manifest && cs.db.Migrator().HasColumn(&models.ImportFile{}, "Tags")
+	if cs.filenameTemplate != nil && cs.manifest && !cs.fileTags {
+		logger.Warnf("Column tags of %s not found (run migrate); fields captured from file names will not be stored\n",
+			models.ImportFile{}.TableName())
+	}
+}
+
+// alreadyImported reports whether a file with the same contents was imported before
+func (cs *CSVScanner) alreadyImported(fingerprint fileFingerprint) (bool, error) {
+	var count int64
+	if err := cs.db.Model(&models.ImportFile{}).Where("sha256 = ? AND completed = ?", fingerprint.hash, true).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check import manifest: %w", err)
+	}
+	return count > 0, nil
+}
+
+// beginImport adds or reopens the manifest entry of a file about to be
+// imported and returns its ID, which identifies the import batch on every
+// reading written. The entry stays incomplete until recordImport.
+func (cs *CSVScanner) beginImport(job FileJob, fingerprint fileFingerprint) (uint, error) {
+	var err error
+	// A worker importing identical contents may create the entry first: retry once to reuse it
+	for attempt := 0; attempt < 2; attempt++ {
+		var entry models.ImportFile
+		if err = cs.db.Where("sha256 = ?", fingerprint.hash).Limit(1).Find(&entry).Error; err != nil {
+			return 0, fmt.Errorf("failed to read import manifest: %w", err)
+		}
+
+		entry.FilePath = storedPath(job.FileName)
+		entry.SHA256 = fingerprint.hash
+		entry.Size = fingerprint.size
+		entry.ModifiedAt = fingerprint.modTime
+		entry.RecordCount = 0
+		entry.ErrorCount = 0
+		entry.DurationMS = 0
+		entry.ImportedAt = time.Now().UTC()
+		entry.Completed = false
+
+		query := cs.db.Omit("tags")
+		if cs.fileTags {
+			entry.Tags = fileTags(job.Fields)
+			query = cs.db
+		}
+		if err = query.Save(&entry).Error; err == nil {
+			return entry.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("failed to record import batch: %w", err)
+}
+
+// recordImport completes the manifest entry of an imported file
+func (cs *CSVScanner) recordImport(batchID uint, result ProcessResult) error {
+	return cs.db.Model(&models.ImportFile{}).Where("id = ?", batchID).Updates(map[string]interface{}{
+		"record_count": result.RecordCount,
+		"error_count":  result.ErrorCount,
+		"imported_at":  time.Now().UTC(),
+		"duration_ms":  result.Duration.Milliseconds(),
+		"completed":    true,
+	}).Error
+}
+
+// fileTags encodes the fields captured from a file name as a JSON object,
+// with the keys sorted, or returns nil when there are none
+func fileTags(fields map[string]string) *string {
+	if len(fields) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+	tags := string(encoded)
+	return &tags
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+func TestFilenameFieldsTagBatches(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.ImportFile{}); err != nil {
+		t.Fatalf("create import_files: %v", err)
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"plantA_20250901.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n",
+		"notes.csv":           "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_02,2\n",
+	})
+
+	csvScanner := NewCSVScanner(db)
+	if err := csvScanner.Configure(config.ScannerConfig{FilenamePattern: "{site}_{date}.csv", FilenamePolicy: "warn"}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	if err := csvScanner.ScanDirectory(context.Background(), dir); err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+
+	var batches []models.ImportFile
+	if err := db.Order("file_path").Find(&batches).Error; err != nil {
+		t.Fatalf("read batches: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("%d batches, want 2", len(batches))
+	}
+	if batches[0].Tags != nil {
+		t.Errorf("non-conforming notes.csv tagged %s", *batches[0].Tags)
+	}
+	if tags := batches[1].Tags; tags == nil || *tags != `{"date":"20250901","site":"plantA"}` {
+		t.Errorf("plantA_20250901.csv tags = %v, want date and site", tags)
+	}
+
+	// Readings are tagged through their batch
+	var reading models.SensorData
+	if err := db.Where("sensor_name = ?", "temp_01").First(&reading).Error; err != nil {
+		t.Fatalf("read reading: %v", err)
+	}
+	if reading.ImportFileID == nil || *reading.ImportFileID != batches[1].ID {
+		t.Errorf("temp_01 batch = %v, want %d", reading.ImportFileID, batches[1].ID)
+	}
+}
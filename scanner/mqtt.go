@@ -0,0 +1,229 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Connection timings
+const (
+	mqttMaxReconnectDelay = time.Minute      // Reconnect delays double up to this
+	mqttDialTimeout       = 30 * time.Second // Bounds connecting to the broker
+	mqttDisconnectQuiesce = 250              // Milliseconds to finish sending on the way out
+)
+
+// mqttSubackFailure is the return code of a subscription the broker refused
+const mqttSubackFailure = 0x80
+
+// mqttSource connects to the configured broker and subscribes to the topics
+type mqttSource struct {
+	broker  *url.URL
+	options *mqtt.ClientOptions
+	topics  []string
+	qos     byte
+}
+
+// newMQTTSource builds the MQTT settings from the ingest mqtt section
+func newMQTTSource(cfg config.MQTTConfig) (*mqttSource, error) {
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("no MQTT broker: set ingest mqtt broker in config.yaml")
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, fmt.Errorf("no MQTT topics: set ingest mqtt topics in config.yaml")
+	}
+	broker, err := url.Parse(os.ExpandEnv(cfg.Broker))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ingest mqtt broker: %w", err)
+	}
+	if broker.Port() == "" {
+		broker.Host = net.JoinHostPort(broker.Hostname(), defaultMQTTPort(broker.Scheme))
+	}
+
+	keepAlive := 60 * time.Second
+	if cfg.KeepAlive != "" {
+		if keepAlive, err = time.ParseDuration(cfg.KeepAlive); err != nil {
+			return nil, fmt.Errorf("invalid ingest mqtt keep_alive: %w", err)
+		}
+	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = "sensor_data_import-" + hostname
+	}
+
+	source := &mqttSource{broker: broker, topics: cfg.Topics, qos: 1}
+	if cfg.QoS != nil {
+		source.qos = byte(*cfg.QoS)
+	}
+	if cfg.CleanSession && source.qos > 0 {
+		logger.Warnf("MQTT clean_session is set: messages sent while the importer is disconnected are lost\n")
+	}
+
+	source.options = mqtt.NewClientOptions().
+		AddBroker(broker.String()).
+		SetClientID(clientID).
+		SetUsername(os.ExpandEnv(cfg.Username)).
+		SetPassword(os.ExpandEnv(cfg.Password)).
+		SetProtocolVersion(4). // MQTT 3.1.1
+		SetCleanSession(cfg.CleanSession).
+		SetKeepAlive(keepAlive).
+		SetConnectTimeout(mqttDialTimeout).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(mqttMaxReconnectDelay).
+		SetOrderMatters(true).   // Messages are handed over in the order received
+		SetAutoAckDisabled(true) // Acknowledged once their readings are committed
+	return source, nil
+}
+
+// defaultMQTTPort returns the port of a broker URL without one
+func defaultMQTTPort(scheme string) string {
+	switch scheme {
+	case "ssl", "tls", "mqtts":
+		return "8883"
+	}
+	return "1883"
+}
+
+// IngestMQTT subscribes to the configured topics and inserts the readings of
+// the messages received until ctx is cancelled. With QoS 1, messages are
+// acknowledged once their readings are committed. A lost connection is
+// re-established with increasing delays.
+func (cs *CSVScanner) IngestMQTT(ctx context.Context, cfg config.IngestConfig) (StreamStats, error) {
+	source, err := newMQTTSource(cfg.MQTT)
+	if err != nil {
+		return StreamStats{}, err
+	}
+	flushInterval, err := time.ParseDuration(cfg.FlushInterval)
+	if err != nil {
+		return StreamStats{}, fmt.Errorf("invalid ingest flush_interval: %w", err)
+	}
+	queue, err := cs.openStreamQueue(cfg)
+	if err != nil {
+		return StreamStats{}, err
+	}
+	defer queue.close()
+
+	ingestCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	messages := make(chan streamMessage, cs.batchSize)
+	subscription := source.subscribe(ingestCtx, cancel, messages)
+
+	// Connect before ingesting so configuration errors fail right away
+	client := mqtt.NewClient(source.options)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttDialTimeout) {
+		return StreamStats{}, fmt.Errorf("failed to connect to MQTT broker %s: timed out", source.broker.Host)
+	}
+	if err := token.Error(); err != nil {
+		return StreamStats{}, fmt.Errorf("failed to connect to MQTT broker %s: %w", source.broker.Host, err)
+	}
+	if token.(*mqtt.ConnectToken).SessionPresent() {
+		logger.Printf("Resuming the session stored by MQTT broker %s\n", source.broker.Host)
+	}
+
+	// The handlers stop sending once ingestCtx is done, so messages is never
+	// closed; ingestStream returns on the cancellation
+	stats, err := cs.ingestStream(ingestCtx, messages, cfg.MQTT.PayloadFormat, flushInterval, queue)
+	client.Disconnect(mqttDisconnectQuiesce)
+	if refused := subscription.refused(); refused != nil {
+		return stats, refused
+	}
+	return stats, err
+}
+
+// mqttSubscription remembers a subscription the broker refused
+type mqttSubscription struct {
+	mu      sync.Mutex
+	refusal error
+}
+
+func (s *mqttSubscription) refused() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refusal
+}
+
+// subscribe sets the handlers that subscribe to the topics on every
+// connection and send the messages received to messages. A refused
+// subscription cancels the ingest through cancel.
+func (s *mqttSource) subscribe(ctx context.Context, cancel context.CancelFunc, messages chan<- streamMessage) *mqttSubscription {
+	subscription := &mqttSubscription{}
+	host := s.broker.Host
+
+	handler := func(_ mqtt.Client, message mqtt.Message) {
+		streamed := streamMessage{
+			name:    message.Topic(),
+			source:  streamSource("mqtt", host, message.Topic()),
+			payload: message.Payload(),
+		}
+		if message.Qos() > 0 {
+			streamed.ack = func() error {
+				message.Ack()
+				return nil
+			}
+		}
+		select {
+		case messages <- streamed:
+		case <-ctx.Done():
+		}
+	}
+
+	filters := make(map[string]byte, len(s.topics))
+	for _, topic := range s.topics {
+		filters[topic] = s.qos
+	}
+
+	// Messages of a resumed session may arrive before the subscription is
+	// renewed
+	s.options.SetDefaultPublishHandler(handler)
+	s.options.SetOnConnectHandler(func(client mqtt.Client) {
+		logger.Printf("Connected to MQTT broker %s\n", host)
+		token := client.SubscribeMultiple(filters, handler)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			logger.Warnf("Failed to subscribe to %s: %v\n", strings.Join(s.topics, ", "), err)
+			return
+		}
+
+		var refused []string
+		for topic, code := range token.(*mqtt.SubscribeToken).Result() {
+			if code == mqttSubackFailure {
+				refused = append(refused, topic)
+			}
+		}
+		if len(refused) > 0 {
+			sort.Strings(refused)
+			subscription.mu.Lock()
+			subscription.refusal = &mqttSubscriptionError{topic: strings.Join(refused, ", ")}
+			subscription.mu.Unlock()
+			cancel()
+			return
+		}
+		logger.Printf("Subscribed to %s (QoS %d)\n", strings.Join(s.topics, ", "), s.qos)
+	})
+	s.options.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		logger.Warnf("Lost the connection to MQTT broker %s, reconnecting: %v\n", host, err)
+	})
+	return subscription
+}
+
+// mqttSubscriptionError is a subscription the broker refused
+type mqttSubscriptionError struct {
+	topic string
+}
+
+func (e *mqttSubscriptionError) Error() string {
+	return fmt.Sprintf("MQTT broker refused the subscription to %s", e.topic)
+}
@@ -0,0 +1,233 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// deniedTopics lets every client connect and refuses subscriptions to
+// filters under denied/
+type deniedTopics struct {
+	mochi.HookBase
+}
+
+func (h *deniedTopics) ID() string {
+	return "denied-topics"
+}
+
+func (h *deniedTopics) Provides(b byte) bool {
+	return bytes.Contains([]byte{mochi.OnConnectAuthenticate, mochi.OnACLCheck}, []byte{b})
+}
+
+func (h *deniedTopics) OnConnectAuthenticate(*mochi.Client, packets.Packet) bool {
+	return true
+}
+
+func (h *deniedTopics) OnACLCheck(_ *mochi.Client, topic string, write bool) bool {
+	return write || !strings.HasPrefix(topic, "denied/")
+}
+
+// startBroker starts an in-process MQTT broker on a free loopback port and
+// returns its URL
+func startBroker(t *testing.T) (string, *mochi.Server) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("find a free port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	server := mochi.New(&mochi.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := server.AddHook(&deniedTopics{}, nil); err != nil {
+		t.Fatalf("add hook: %v", err)
+	}
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr})); err != nil {
+		t.Fatalf("add listener: %v", err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatalf("start broker: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return "tcp://" + addr, server
+}
+
+// publish sends each payload to topic with QoS 1
+func publish(t *testing.T, broker, topic string, payloads ...string) {
+	t.Helper()
+	client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID("publisher"))
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatalf("connect publisher: %v", token.Error())
+	}
+	defer client.Disconnect(mqttDisconnectQuiesce)
+	for _, payload := range payloads {
+		if token := client.Publish(topic, 1, false, payload); token.Wait() && token.Error() != nil {
+			t.Fatalf("publish: %v", token.Error())
+		}
+	}
+}
+
+// waitForSubscriptions waits until the broker holds count subscriptions
+func waitForSubscriptions(t *testing.T, server *mochi.Server, count int64) {
+	t.Helper()
+	for start := time.Now(); atomic.LoadInt64(&server.Info.Subscriptions) < count; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("the broker holds %d subscriptions, want %d", atomic.LoadInt64(&server.Info.Subscriptions), count)
+		}
+	}
+}
+
+// connectSource connects a client of the source that sends the messages it
+// receives to messages
+func connectSource(t *testing.T, ctx context.Context, source *mqttSource, messages chan streamMessage) mqtt.Client {
+	t.Helper()
+	source.subscribe(ctx, func() {}, messages)
+	client := mqtt.NewClient(source.options)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatalf("connect: %v", token.Error())
+	}
+	return client
+}
+
+func nextMessage(t *testing.T, messages chan streamMessage) streamMessage {
+	t.Helper()
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return streamMessage{}
+	}
+}
+
+// A message is acknowledged only by its ack, so one left unacknowledged is
+// delivered again when the session is resumed
+func TestMQTTRedeliversUnacknowledgedMessages(t *testing.T) {
+	broker, server := startBroker(t)
+	cfg := config.MQTTConfig{Broker: broker, ClientID: "importer", Topics: []string{"plant/+/readings"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source, err := newMQTTSource(cfg)
+	if err != nil {
+		t.Fatalf("newMQTTSource: %v", err)
+	}
+	messages := make(chan streamMessage, 10)
+	client := connectSource(t, ctx, source, messages)
+	waitForSubscriptions(t, server, 1)
+	publish(t, broker, "plant/line_1/readings", "temp_01,1", "temp_01,2")
+
+	first := nextMessage(t, messages)
+	if first.name != "plant/line_1/readings" || first.source != streamSource("mqtt", strings.TrimPrefix(broker, "tcp://"), first.name) {
+		t.Errorf("message named %s from %s", first.name, first.source)
+	}
+	if string(first.payload) != "temp_01,1" || first.ack == nil {
+		t.Fatalf("first message = %q with ack %v, want temp_01,1 with an ack", first.payload, first.ack != nil)
+	}
+	if err := first.ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if second := nextMessage(t, messages); string(second.payload) != "temp_01,2" {
+		t.Fatalf("second message = %q, want temp_01,2", second.payload)
+	}
+	time.Sleep(100 * time.Millisecond) // Let the acknowledgement reach the broker
+	client.Disconnect(mqttDisconnectQuiesce)
+
+	source, err = newMQTTSource(cfg)
+	if err != nil {
+		t.Fatalf("newMQTTSource: %v", err)
+	}
+	client = connectSource(t, ctx, source, messages)
+	defer client.Disconnect(mqttDisconnectQuiesce)
+	if again := nextMessage(t, messages); string(again.payload) != "temp_01,2" {
+		t.Errorf("redelivered message = %q, want only the unacknowledged temp_01,2", again.payload)
+	}
+	select {
+	case message := <-messages:
+		t.Errorf("acknowledged message %q was delivered again", message.payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestIngestMQTTStoresReadings(t *testing.T) {
+	broker, server := startBroker(t)
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.ImportRun{}, &models.ImportFile{}, &models.SensorDataReject{}); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	csvScanner := NewCSVScanner(db)
+	scannerConfig := config.ScannerConfig{
+		InsertPolicy: InsertPolicySkip,
+		JSONFields:   config.JSONFieldsConfig{Timestamp: "timestamp", SensorName: "sensor_name", Value: "value"},
+	}
+	if err := csvScanner.Configure(scannerConfig); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type result struct {
+		stats StreamStats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stats, err := csvScanner.IngestMQTT(ctx, config.IngestConfig{
+			FlushInterval: "50ms",
+			MQTT:          config.MQTTConfig{Broker: broker, ClientID: "importer", Topics: []string{"plant/+/readings"}, PayloadFormat: "auto"},
+		})
+		done <- result{stats, err}
+	}()
+	waitForSubscriptions(t, server, 1)
+	publish(t, broker, "plant/line_1/readings",
+		"2025-09-01 12:00:00,temp_01,21.5",
+		`{"timestamp": "2025-09-01 12:01:00", "sensor_name": "temp_01", "value": 21.75}`)
+
+	var count int64
+	for start := time.Now(); count < 2 && time.Since(start) < 5*time.Second; time.Sleep(20 * time.Millisecond) {
+		db.Model(&models.SensorData{}).Count(&count)
+	}
+	cancel()
+	ingested := <-done
+	if ingested.err != nil {
+		t.Fatalf("IngestMQTT: %v", ingested.err)
+	}
+	if count != 2 || ingested.stats.Messages != 2 || ingested.stats.Readings != 2 {
+		t.Errorf("stored %d readings, stats %+v, want 2 messages and 2 readings", count, ingested.stats)
+	}
+}
+
+func TestIngestMQTTRefusedSubscription(t *testing.T) {
+	broker, _ := startBroker(t)
+	csvScanner := NewCSVScanner(openTestDB(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := csvScanner.IngestMQTT(ctx, config.IngestConfig{
+		FlushInterval: "1s",
+		MQTT:          config.MQTTConfig{Broker: broker, Topics: []string{"plant/+/readings", "denied/#"}},
+	})
+	var refused *mqttSubscriptionError
+	if !errors.As(err, &refused) || refused.topic != "denied/#" {
+		t.Fatalf("IngestMQTT error = %v, want the subscription to denied/# refused", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("IngestMQTT only returned at the timeout")
+	}
+}
@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"sensor_data_import/config"
+)
+
+// numberFormat describes how the values of a file are written. The zero value
+// is the standard format read by strconv.ParseFloat.
+type numberFormat struct {
+	name     string
+	decimal  rune   // Decimal separator, 0 for the standard format
+	grouping string // Accepted thousands separators
+}
+
+// Number formats by their configured name. Spaces include the no-break and
+// narrow no-break spaces used by French and other exports.
+var numberFormats = map[string]numberFormat{
+	"standard":      {name: "standard"},
+	"decimal_point": {name: "decimal_point", decimal: '.', grouping: ", '_\u00a0\u202f"},
+	"decimal_comma": {name: "decimal_comma", decimal: ',', grouping: ". '\u00a0\u202f"},
+}
+
+// numberFormatOverride assigns a number format to files matching a pattern
+type numberFormatOverride struct {
+	files  string
+	format numberFormat
+}
+
+// lookupNumberFormat resolves a number format name; empty is standard
+func lookupNumberFormat(name string) (numberFormat, error) {
+	if name == "" {
+		return numberFormat{}, nil
+	}
+	format, ok := numberFormats[name]
+	if !ok {
+		return numberFormat{}, fmt.Errorf("unsupported number format %q", name)
+	}
+	return format, nil
+}
+
+// loadNumberFormats loads the default number format and per-pattern overrides
+func loadNumberFormats(cfg config.ScannerConfig) (numberFormat, []numberFormatOverride, error) {
+	defaultFormat, err := lookupNumberFormat(cfg.NumberFormat)
+	if err != nil {
+		return numberFormat{}, nil, fmt.Errorf("invalid scanner number_format: %w", err)
+	}
+
+	overrides := make([]numberFormatOverride, 0, len(cfg.NumberFormatOverrides))
+	for _, o := range cfg.NumberFormatOverrides {
+		format, err := lookupNumberFormat(o.Format)
+		if err != nil {
+			return numberFormat{}, nil, fmt.Errorf("invalid number format for %s: %w", o.Files, err)
+		}
+		overrides = append(overrides, numberFormatOverride{files: o.Files, format: format})
+	}
+
+	return defaultFormat, overrides, nil
+}
+
+// numberFormatFor returns the configured number format of a file
+func (cs *CSVScanner) numberFormatFor(fileName string) numberFormat {
+	for _, override := range cs.numberFormatOverrides {
+		if matchFilePattern(override.files, fileName) {
+			return override.format
+		}
+	}
+	return cs.numberFormat
+}
+
+// normalize rewrites a value in the standard format strconv.ParseFloat
+// reads, such as 1.234,5e3 to 1234.5e3. Thousands separators must group the
+// integer digits by three, so a value written in another format, like 23.5
+// in a decimal_comma file, is rejected rather than misread as 235.
+func (f numberFormat) normalize(value string) (string, bool) {
+	if f.decimal == 0 {
+		return value, true
+	}
+
+	sign := ""
+	if value != "" && (value[0] == '+' || value[0] == '-') {
+		sign, value = value[:1], value[1:]
+	}
+	exponent := ""
+	if i := strings.IndexAny(value, "eE"); i >= 0 {
+		value, exponent = value[:i], value[i:]
+	}
+
+	integer, fraction, hasFraction := strings.Cut(value, string(f.decimal))
+	if !allDigits(fraction) || (integer == "" && fraction == "") {
+		return "", false
+	}
+	integer, ok := f.ungroup(integer)
+	if !ok {
+		return "", false
+	}
+
+	if hasFraction {
+		return sign + integer + "." + fraction + exponent, true
+	}
+	return sign + integer + exponent, true
+}
+
+// ungroup removes the thousands separators from the integer digits of a value
+func (f numberFormat) ungroup(integer string) (string, bool) {
+	separator := strings.IndexAny(integer, f.grouping)
+	if separator < 0 {
+		return integer, allDigits(integer)
+	}
+
+	// Every group must be set off by the same separator as the first
+	_, size := utf8.DecodeRuneInString(integer[separator:])
+	groups := strings.Split(integer, integer[separator:separator+size])
+	for i, group := range groups {
+		if !allDigits(group) || group == "" || len(group) > 3 || (i > 0 && len(group) != 3) {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
+
+// allDigits reports whether a string contains only ASCII digits
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+func TestNumberFormatNormalize(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+		want   string // Empty when the value is rejected
+	}{
+		{"standard", "1234.5", "1234.5"},
+		{"standard", "1,234.5", "1,234.5"}, // Left to strconv.ParseFloat to reject
+		{"decimal_point", "1,234.5", "1234.5"},
+		{"decimal_point", "-1 234 567.25e3", "-1234567.25e3"},
+		{"decimal_point", "1_000", "1000"},
+		{"decimal_point", ".5", ".5"},
+		{"decimal_point", "12,34.5", ""},
+		{"decimal_point", "1,234 567", ""},
+		{"decimal_comma", "1.234,5", "1234.5"},
+		{"decimal_comma", "+21,75", "+21.75"},
+		{"decimal_comma", "1 234 567,8", "1234567.8"},
+		{"decimal_comma", "1.234.567", "1234567"},
+		{"decimal_comma", "23.5", ""}, // A decimal point, not a thousands separator
+		{"decimal_comma", "1,2,3", ""},
+		{"decimal_comma", ",", ""},
+		{"decimal_comma", "n/a", ""},
+	}
+	for _, tt := range tests {
+		format, err := lookupNumberFormat(tt.format)
+		if err != nil {
+			t.Fatalf("lookupNumberFormat(%q): %v", tt.format, err)
+		}
+		got, ok := format.normalize(tt.value)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("%s: normalize(%q) = %q, %v; want %q", tt.format, tt.value, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLoadNumberFormats(t *testing.T) {
+	format, overrides, err := loadNumberFormats(config.ScannerConfig{
+		NumberFormatOverrides: []config.NumberFormatOverrideConfig{{Files: "de_*.csv", Format: "decimal_comma"}},
+	})
+	if err != nil {
+		t.Fatalf("loadNumberFormats: %v", err)
+	}
+	cs := &CSVScanner{numberFormat: format, numberFormatOverrides: overrides}
+	if got := cs.numberFormatFor("de_plant.csv").name; got != "decimal_comma" {
+		t.Errorf("format of de_plant.csv = %q, want decimal_comma", got)
+	}
+	if got := cs.numberFormatFor("us_plant.csv"); got.decimal != 0 {
+		t.Errorf("format of us_plant.csv = %+v, want the standard format", got)
+	}
+
+	for _, cfg := range []config.ScannerConfig{
+		{NumberFormat: "roman"},
+		{NumberFormatOverrides: []config.NumberFormatOverrideConfig{{Files: "*.csv", Format: "decimal_dot"}}},
+	} {
+		if _, _, err := loadNumberFormats(cfg); err == nil {
+			t.Errorf("loadNumberFormats(%+v) accepted an unknown format", cfg)
+		}
+	}
+}
+
+func TestScanDecimalCommaFile(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"de_plant.csv": "timestamp,sensor_name,value\n" +
+			"2025-09-01 00:00:00,temp_01,\"1.234,5\"\n" +
+			"2025-09-01 00:01:00,temp_01,\"-0,25\"\n" +
+			"2025-09-01 00:02:00,temp_01,23.5\n",
+	})
+	cs := NewCSVScanner(db)
+	err := cs.Configure(config.ScannerConfig{
+		NumberFormatOverrides: []config.NumberFormatOverrideConfig{{Files: "de_*.csv", Format: "decimal_comma"}},
+	})
+	if err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	if err := cs.ScanDirectory(context.Background(), dir); err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+
+	// 23.5 is ambiguous in a decimal_comma file, so it is rejected
+	var stored []models.SensorData
+	if err := db.Order("timestamp").Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	if len(stored) != 2 || stored[0].Value != 1234.5 || stored[1].Value != -0.25 {
+		t.Errorf("stored = %+v, want 1234.5 and -0.25", stored)
+	}
+}
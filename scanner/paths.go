@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxStoredPath is the size of the file path columns (source_file, file_path)
+const maxStoredPath = 1024
+
+// Windows extended-length path prefixes, for a local path and for a UNC share
+const (
+	longPathPrefix    = `\\?\`
+	longUNCPathPrefix = `\\?\UNC\`
+)
+
+// scanRoot returns the absolute form of a directory or file to import, so
+// Go's long path support on Windows applies to files nested beyond MAX_PATH
+// whatever form the root was given in
+func scanRoot(directoryPath string) string {
+	if absPath, err := filepath.Abs(directoryPath); err == nil {
+		return absPath
+	}
+	return directoryPath
+}
+
+// storedPath normalizes a file path before it is written to the database, so
+// the same file is recorded the same way however it was reached: separators
+// become forward slashes, extended-length prefixes are dropped and the server
+// and share of a UNC path (\\Server\Share\...) and a drive letter are brought
+// to one case, as Windows does not distinguish them. A path longer than the
+// column keeps its end, which holds the file name.
+func storedPath(p string) string {
+	switch {
+	case strings.HasPrefix(p, longUNCPathPrefix):
+		p = `\\` + p[len(longUNCPathPrefix):]
+	case strings.HasPrefix(p, longPathPrefix):
+		p = p[len(longPathPrefix):]
+	}
+	p = filepath.ToSlash(p)
+
+	if rest, ok := strings.CutPrefix(p, "//"); ok {
+		// The server and share name of a UNC path
+		parts := strings.SplitN(rest, "/", 3)
+		for i := 0; i < len(parts) && i < 2; i++ {
+			parts[i] = strings.ToLower(parts[i])
+		}
+		p = "//" + strings.Join(parts, "/")
+	} else if len(p) >= 2 && p[1] == ':' {
+		p = strings.ToUpper(p[:1]) + p[1:]
+	}
+
+	if len(p) > maxStoredPath {
+		start := len(p) - maxStoredPath + len("...")
+		for start < len(p) && !utf8.RuneStart(p[start]) {
+			start++
+		}
+		p = "..." + p[start:]
+	}
+	return p
+}
+
+// memberName returns the name of a ZIP archive member with forward slashes.
+// Archives created by some Windows tools separate directories with backslashes.
+func memberName(name string) string {
+	return strings.ReplaceAll(name, `\`, "/")
+}
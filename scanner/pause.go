@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+
+	"sensor_data_import/logger"
+)
+
+// pauseGate holds back new work while paused. The zero value is running.
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // Closed on resume; nil while running
+}
+
+// paused reports whether new work is held back
+func (pg *pauseGate) paused() bool {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	return pg.resumed != nil
+}
+
+// wait blocks while paused, until resumed or ctx is cancelled
+func (pg *pauseGate) wait(ctx context.Context) {
+	pg.mu.Lock()
+	resumed := pg.resumed
+	pg.mu.Unlock()
+	if resumed == nil {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+}
+
+// Pause stops the scanner from starting new files, and serve from taking
+// pushed readings, while the files and batches in progress finish. It
+// returns false when the scanner was paused already.
+func (cs *CSVScanner) Pause() bool {
+	cs.pause.mu.Lock()
+	defer cs.pause.mu.Unlock()
+	if cs.pause.resumed != nil {
+		return false
+	}
+	cs.pause.resumed = make(chan struct{})
+	logger.Printf("Paused: work in progress finishes, new files and pushes wait for resume\n")
+	return true
+}
+
+// Resume lets a paused scanner start new files again. It returns false when
+// the scanner was not paused.
+func (cs *CSVScanner) Resume() bool {
+	cs.pause.mu.Lock()
+	defer cs.pause.mu.Unlock()
+	if cs.pause.resumed == nil {
+		return false
+	}
+	close(cs.pause.resumed)
+	cs.pause.resumed = nil
+	logger.Printf("Resumed\n")
+	return true
+}
+
+// Paused reports whether the scanner is paused
+func (cs *CSVScanner) Paused() bool {
+	return cs.pause.paused()
+}
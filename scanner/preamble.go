@@ -0,0 +1,56 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// preambleSkipper removes metadata lines that precede the real CSV header
+type preambleSkipper struct {
+	skipLines int            // Lines always skipped at the start of the file
+	marker    *regexp.Regexp // Pattern identifying the header row, if set
+}
+
+// enabled reports whether any preamble handling is configured
+func (ps preambleSkipper) enabled() bool {
+	return ps.skipLines > 0 || ps.marker != nil
+}
+
+// skip consumes the preamble and returns a reader positioned at the header
+// row together with the number of lines skipped
+func (ps preambleSkipper) skip(r io.Reader) (io.Reader, int, error) {
+	buffered := bufio.NewReader(r)
+	skipped := 0
+
+	for skipped < ps.skipLines {
+		if _, err := buffered.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				return strings.NewReader(""), skipped, nil
+			}
+			return nil, skipped, err
+		}
+		skipped++
+	}
+
+	if ps.marker == nil {
+		return buffered, skipped, nil
+	}
+
+	for {
+		line, err := buffered.ReadString('\n')
+		if line != "" && ps.marker.MatchString(strings.TrimRight(line, "\r\n")) {
+			// Put the header row back in front of the remaining data
+			return io.MultiReader(strings.NewReader(line), buffered), skipped, nil
+		}
+		if err == io.EOF {
+			return nil, skipped, fmt.Errorf("header marker %q not found", ps.marker)
+		}
+		if err != nil {
+			return nil, skipped, err
+		}
+		skipped++
+	}
+}
@@ -0,0 +1,231 @@
+package scanner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// Duplicate precedence policies
+const (
+	PrecedenceFirst          = "first"           // Keep whichever value was inserted first
+	PrecedenceLatestDelivery = "latest_delivery" // The most recently modified source file wins
+	PrecedenceDirectory      = "directory"       // Sources in earlier precedence directories win
+)
+
+// precedencePolicy decides which of two conflicting readings is kept
+type precedencePolicy struct {
+	mode        string
+	directories []string
+}
+
+// directoryRank returns the rank of a source file for the directory policy.
+// Files in the first listed directory rank highest; unlisted files rank 0.
+func (pp *precedencePolicy) directoryRank(source *string) int {
+	if source == nil {
+		return 0
+	}
+	path := "/" + filepath.ToSlash(*source) + "/"
+	for i, dir := range pp.directories {
+		if strings.Contains(path, "/"+strings.Trim(filepath.ToSlash(dir), "/")+"/") {
+			return len(pp.directories) - i
+		}
+	}
+	return 0
+}
+
+// incomingWins reports whether an incoming reading replaces the existing one.
+// Readings without a recorded source always lose to a known source.
+func (pp *precedencePolicy) incomingWins(incoming, existing *models.SensorData) bool {
+	if pp.mode == PrecedenceDirectory {
+		incomingRank, existingRank := pp.directoryRank(incoming.SourceFile), pp.directoryRank(existing.SourceFile)
+		if incomingRank != existingRank {
+			return incomingRank > existingRank
+		}
+	}
+
+	// Latest delivery decides, and breaks ties between equally ranked directories
+	if existing.SourceModifiedAt == nil {
+		return incoming.SourceModifiedAt != nil
+	}
+	if incoming.SourceModifiedAt == nil {
+		return false
+	}
+	return incoming.SourceModifiedAt.After(*existing.SourceModifiedAt)
+}
+
+// conflict records which of two conflicting readings was kept
+func (pp *precedencePolicy) conflict(kept, discarded *models.SensorData) models.SensorDataConflict {
+	return models.SensorDataConflict{
+		Timestamp:       kept.Timestamp,
+		SensorName:      kept.SensorName,
+		KeptValue:       kept.Value,
+		DiscardedValue:  discarded.Value,
+		KeptSource:      kept.SourceFile,
+		DiscardedSource: discarded.SourceFile,
+		Policy:          pp.mode,
+	}
+}
+
+// resolveBatch keeps one reading per key of a batch, chosen by the policy
+// like a reading already stored, in the order the keys first appear. A tie,
+// such as two rows of one file, keeps the first. Duplicates with different
+// values are returned as conflicts.
+func (pp *precedencePolicy) resolveBatch(batch []models.SensorData) ([]models.SensorData, []models.SensorDataConflict) {
+	index := make(map[readingKey]int, len(batch))
+	unique := make([]models.SensorData, 0, len(batch))
+	var conflicts []models.SensorDataConflict
+	for i := range batch {
+		incoming := &batch[i]
+		key := keyOf(incoming)
+		j, seen := index[key]
+		if !seen {
+			index[key] = len(unique)
+			unique = append(unique, *incoming)
+			continue
+		}
+		current := &unique[j]
+		if current.Value == incoming.Value {
+			continue
+		}
+		if pp.incomingWins(incoming, current) {
+			conflicts = append(conflicts, pp.conflict(incoming, current))
+			unique[j] = *incoming
+		} else {
+			conflicts = append(conflicts, pp.conflict(current, incoming))
+		}
+	}
+	return unique, conflicts
+}
+
+// precedenceStripes is the number of locks the sensors of duplicate
+// resolution are spread over
+const precedenceStripes = 64
+
+// sensorLocks serializes duplicate resolution per sensor, so workers
+// importing different sensors do not wait for each other
+type sensorLocks struct {
+	stripes [precedenceStripes]sync.Mutex
+}
+
+// lock locks the stripes of the batch's sensors and returns the function
+// unlocking them. Stripes are locked in order, so two batches sharing
+// sensors never wait for each other's.
+func (sl *sensorLocks) lock(batch []models.SensorData) func() {
+	var wanted [precedenceStripes]bool
+	for i := range batch {
+		hash := fnv.New32a()
+		hash.Write([]byte(batch[i].SensorName))
+		wanted[hash.Sum32()%precedenceStripes] = true
+	}
+	var locked []*sync.Mutex
+	for i := range wanted {
+		if wanted[i] {
+			sl.stripes[i].Lock()
+			locked = append(locked, &sl.stripes[i])
+		}
+	}
+	return func() {
+		for _, mu := range locked {
+			mu.Unlock()
+		}
+	}
+}
+
+// readingKey identifies a reading by sensor and timestamp
+type readingKey struct {
+	sensorName string
+	timestamp  int64
+}
+
+func keyOf(data *models.SensorData) readingKey {
+	return readingKey{sensorName: data.SensorName, timestamp: data.Timestamp.UTC().UnixNano()}
+}
+
+// insertWithPrecedence inserts a batch, resolving duplicates within it and
+// against existing rows with the precedence policy and recording every
+// conflict. It returns the changes made for the changelog. The sensors of the
+// batch are locked meanwhile, so concurrent workers cannot race on the same
+// keys.
+func (cs *CSVScanner) insertWithPrecedence(batch []models.SensorData) (conflicts int, events []changeEvent, err error) {
+	if len(batch) == 0 {
+		return 0, nil, nil
+	}
+	unlock := cs.precedenceLocks.lock(batch)
+	defer unlock()
+
+	batch, audit := cs.precedence.resolveBatch(batch)
+
+	// Load existing rows that may collide with the batch
+	existing, err := loadExisting(cs.db, batch)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var inserts, replaced []models.SensorData
+
+	err = cs.db.Transaction(func(tx *gorm.DB) error {
+		for i := range batch {
+			incoming := &batch[i]
+			current, found := existing[keyOf(incoming)]
+			if !found {
+				inserts = append(inserts, *incoming)
+				continue
+			}
+			if current.Value == incoming.Value {
+				continue
+			}
+
+			if !cs.precedence.incomingWins(incoming, current) {
+				audit = append(audit, cs.precedence.conflict(current, incoming))
+				continue
+			}
+			if err := tx.Model(&models.SensorData{}).
+				Where("timestamp = ? AND sensor_name = ?", current.Timestamp, current.SensorName).Updates(map[string]interface{}{
+				"value":              incoming.Value,
+				"source_file":        incoming.SourceFile,
+				"source_modified_at": incoming.SourceModifiedAt,
+				"import_file_id":     incoming.ImportFileID,
+				"source_run_id":      incoming.SourceRunID,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to replace reading %s at %s: %w",
+					incoming.SensorName, incoming.Timestamp.Format(time.RFC3339), err)
+			}
+			replaced = append(replaced, *incoming)
+			events = append(events, updateEvent(*incoming, current.Value))
+			audit = append(audit, cs.precedence.conflict(incoming, current))
+		}
+
+		if len(inserts) > 0 {
+			if err := tx.CreateInBatches(inserts, len(inserts)).Error; err != nil {
+				return err
+			}
+		}
+		if len(audit) > 0 {
+			if err := tx.CreateInBatches(audit, len(audit)).Error; err != nil {
+				return fmt.Errorf("failed to record conflicts: %w", err)
+			}
+		}
+		if err := cs.updateLastValues(tx, inserts, false); err != nil {
+			return err
+		}
+		return cs.updateLastValues(tx, replaced, true)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(audit) > 0 {
+		logger.Debugf("Resolved %d duplicate conflict(s) with %s precedence\n", len(audit), cs.precedence.mode)
+	}
+
+	return len(audit), append(insertEvents(inserts), events...), nil
+}
@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+func TestInsertWithPrecedenceResolvesBatchDuplicates(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.SensorDataConflict{}); err != nil {
+		t.Fatalf("create sensor_data_conflicts: %v", err)
+	}
+	at := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	delivered := time.Date(2025, 9, 2, 0, 0, 0, 0, time.UTC)
+	reading := func(minute int, value float64, source string, hours int) models.SensorData {
+		modified := delivered.Add(time.Duration(hours) * time.Hour)
+		return models.SensorData{Timestamp: at.Add(time.Duration(minute) * time.Minute), SensorName: "temp_01", Value: value, SourceFile: &source, SourceModifiedAt: &modified}
+	}
+	insertRows(t, db, reading(0, 1, "a.csv", 0))
+
+	cs := NewCSVScanner(db)
+	cs.precedence = &precedencePolicy{mode: PrecedenceLatestDelivery}
+	// The later delivery of each key wins within the batch, wherever it comes
+	conflicts, _, err := cs.insertWithPrecedence([]models.SensorData{
+		reading(0, 3, "c.csv", 1),
+		reading(1, 5, "c.csv", 1),
+		reading(0, 2, "b.csv", 2),
+		reading(1, 6, "b.csv", 2),
+		reading(1, 6, "d.csv", 3), // Same value, no conflict
+	})
+	if err != nil {
+		t.Fatalf("insertWithPrecedence: %v", err)
+	}
+	if conflicts != 3 {
+		t.Errorf("conflicts = %d, want 2 within the batch and 1 with the stored reading", conflicts)
+	}
+
+	var stored []models.SensorData
+	if err := db.Order("timestamp").Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	if len(stored) != 2 || stored[0].Value != 2 || stored[1].Value != 6 || *stored[1].SourceFile != "b.csv" {
+		t.Errorf("stored = %+v, want 2 and 6 from b.csv", stored)
+	}
+	if audit := countRows(t, db, &models.SensorDataConflict{}); audit != 3 {
+		t.Errorf("recorded conflicts = %d, want 3", audit)
+	}
+}
@@ -0,0 +1,148 @@
+package scanner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+)
+
+// Intervals between progress updates on a terminal and in log lines
+const (
+	liveProgressInterval = 500 * time.Millisecond
+	logProgressInterval  = 30 * time.Second
+)
+
+// scanProgress tracks how much of a scan is done so long scans show they are
+// alive. Progress is measured in bytes: a file counts in full once finished,
+// and in proportion to its inserted readings while in progress.
+type scanProgress struct {
+	totalFiles int
+	totalBytes int64
+	sizes      map[string]int64
+	start      time.Time
+	live       bool // Redraw a status line instead of logging
+
+	mu        sync.Mutex
+	doneFiles int
+	doneBytes float64
+	credited  map[string]float64 // Bytes counted for files in progress
+	readings  int64
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// startProgress starts reporting the progress of importing files until stop is called
+func startProgress(files []FileJob) *scanProgress {
+	sp := &scanProgress{
+		totalFiles: len(files),
+		sizes:      make(map[string]int64, len(files)),
+		start:      time.Now(),
+		live:       logger.IsTerminal(),
+		credited:   make(map[string]float64),
+		stop:       make(chan struct{}),
+	}
+	for _, file := range files {
+		sp.totalBytes += file.Size
+		sp.sizes[file.FileName] = file.Size
+	}
+
+	interval := logProgressInterval
+	if sp.live {
+		interval = liveProgressInterval
+	}
+	sp.done.Add(1)
+	go sp.run(interval)
+	return sp
+}
+
+func (sp *scanProgress) run(interval time.Duration) {
+	defer sp.done.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if sp.live {
+				logger.SetStatus(sp.String())
+			} else {
+				logger.Printf("%s\n", sp)
+			}
+		case <-sp.stop:
+			if sp.live {
+				logger.SetStatus("")
+			}
+			return
+		}
+	}
+}
+
+// stopProgress stops reporting
+func (sp *scanProgress) stopProgress() {
+	if sp == nil {
+		return
+	}
+	close(sp.stop)
+	sp.done.Wait()
+}
+
+// inserted records that count of a file's remaining readings were written.
+// Files read in chunks are credited once they finish.
+func (sp *scanProgress) inserted(result *ProcessResult, count, remaining int) {
+	if sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.readings += int64(count)
+	if result.chunked || remaining <= 0 {
+		return
+	}
+	share := float64(sp.sizes[result.FileName]) - sp.credited[result.FileName]
+	credit := share * float64(count) / float64(remaining)
+	sp.credited[result.FileName] += credit
+	sp.doneBytes += credit
+}
+
+// finished records that a file is done, whether imported, skipped or failed
+func (sp *scanProgress) finished(fileName string) {
+	if sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.doneBytes += float64(sp.sizes[fileName]) - sp.credited[fileName]
+	delete(sp.credited, fileName)
+	sp.doneFiles++
+}
+
+// String formats the progress with the insert rate and estimated time left
+func (sp *scanProgress) String() string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	elapsed := time.Since(sp.start)
+	rate := float64(sp.readings) / elapsed.Seconds()
+
+	fraction := 0.0
+	if sp.totalBytes > 0 {
+		fraction = sp.doneBytes / float64(sp.totalBytes)
+	} else if sp.totalFiles > 0 {
+		fraction = float64(sp.doneFiles) / float64(sp.totalFiles)
+	}
+
+	eta := "unknown"
+	if fraction > 0 {
+		remaining := time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+		eta = remaining.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("Progress: %d/%d files, %.0f%%, %d readings (%.0f/s), ETA %s",
+		sp.doneFiles, sp.totalFiles, fraction*100, sp.readings, rate, eta)
+}
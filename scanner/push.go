@@ -0,0 +1,191 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// ErrInvalidPayload is returned by Push for a body that is not CSV or JSON
+// readings
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// PushResult reports what was done with a pushed payload
+type PushResult struct {
+	Inserted int             `json:"inserted"`
+	Skipped  int             `json:"skipped"` // Existing readings kept, such as a resent payload
+	Rejected []PushRejection `json:"rejected,omitempty"`
+}
+
+// PushRejection is a reading of a pushed payload that failed parsing or
+// validation
+type PushRejection struct {
+	Row      int    `json:"row"` // Line of a CSV body, or element of a JSON array, counting from 1
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+}
+
+// BeginPush prepares the scanner for payloads pushed by Push until EndPush.
+// Senders retry, so the error insert policy is applied as skip.
+func (cs *CSVScanner) BeginPush() error {
+	return cs.beginStream()
+}
+
+// EndPush closes what BeginPush opened
+func (cs *CSVScanner) EndPush() {
+	cs.endScan()
+}
+
+// Push parses a CSV or JSON payload with the scanner's parsing and validation
+// settings and inserts its readings in one transaction. Rejected readings are
+// returned rather than failing the payload. name is matched against column
+// mappings and timezone overrides, and source is recorded with the readings
+// for duplicate precedence.
+func (cs *CSVScanner) Push(ctx context.Context, payload []byte, format, name, source string) (PushResult, error) {
+	var push PushResult
+	records, headerAdded, err := cs.payloadRecords(payload, format)
+	if err != nil {
+		return push, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	result := ProcessResult{FileName: name}
+	data := cs.parseRecords(records, name, &result)
+	if result.Error != nil {
+		return push, fmt.Errorf("%w: %v", ErrInvalidPayload, result.Error)
+	}
+	for _, rejected := range result.rejects {
+		row := rejected.row
+		if headerAdded {
+			row--
+		}
+		push.Rejected = append(push.Rejected, PushRejection{Row: row, Category: rejected.category, Reason: rejected.reason})
+	}
+	if len(data) == 0 {
+		return push, nil
+	}
+	if cs.precedence != nil {
+		for i := range data {
+			data[i].SourceFile = &source
+		}
+	}
+
+	if push.Inserted, push.Skipped, err = cs.insertPushed(ctx, data, source); err != nil {
+		return push, err
+	}
+	return push, nil
+}
+
+// insertPushed inserts pushed readings in one transaction and returns how
+// many were inserted and how many existing readings were skipped. Inserts
+// wait for the push rate limit, and are serialized because each refreshes
+// the upsert cutoff.
+func (cs *CSVScanner) insertPushed(ctx context.Context, data []models.SensorData, source string) (int, int, error) {
+	waited := cs.live.waitPush()
+	if err := cs.pushLimit.wait(ctx, len(data)); err != nil {
+		waited()
+		return 0, 0, fmt.Errorf("cancelled while waiting for the rate limit: %w", err)
+	}
+	cs.pushMu.Lock()
+	defer cs.pushMu.Unlock()
+	waited()
+	cs.live.begin(source)
+	defer cs.live.end(source)
+	if cs.upsertWindow > 0 {
+		cs.upsertCutoff = time.Now().Add(-cs.upsertWindow)
+	}
+	result := ProcessResult{FileName: source}
+	if err := cs.batchInsertSensorData(ctx, data, &result, nil); err != nil {
+		return 0, 0, err
+	}
+	inserted := len(data) - result.SkippedCount - result.FailedCount
+	logger.Debugf("Inserted %d pushed readings from %s (%d existing skipped)\n", inserted, source, result.SkippedCount)
+	return inserted, result.SkippedCount, nil
+}
+
+// PushReading is a reading sent by a client in its typed form
+type PushReading struct {
+	SensorName string
+	Timestamp  time.Time // Zero when the client left it out
+	Value      float64
+}
+
+// PushStream inserts the readings of one client stream in batches, so a long
+// stream is committed as it arrives rather than held in memory
+type PushStream struct {
+	cs      *CSVScanner
+	name    string
+	source  string
+	result  ProcessResult // Counts rejects and tracks cadence across the stream
+	rows    int           // Readings received, numbering them in warnings
+	pending []models.SensorData
+	stats   StreamStats
+}
+
+// NewPushStream starts a stream of pushed readings. name is matched against
+// timezone overrides, and source is recorded with the readings for duplicate
+// precedence.
+func (cs *CSVScanner) NewPushStream(name, source string) *PushStream {
+	return &PushStream{cs: cs, name: name, source: source, result: ProcessResult{FileName: name}}
+}
+
+// Add validates the readings of one message and inserts a batch once enough
+// readings are buffered. The caller reads the next message only after Add
+// returns, so a slow database slows down the sender.
+func (p *PushStream) Add(ctx context.Context, readings []PushReading) error {
+	p.stats.Messages++
+	before := p.result.ErrorCount + p.result.ViolationCount
+	for _, reading := range readings {
+		p.rows++
+		value := strconv.FormatFloat(reading.Value, 'g', -1, 64)
+		if reading.Timestamp.IsZero() {
+			p.result.reject(p.name, p.rows, []string{"", reading.SensorName, value}, ErrorBadTimestamp, "missing timestamp")
+			continue
+		}
+		record := []string{reading.Timestamp.UTC().Format(time.RFC3339Nano), reading.SensorName, value}
+		data, ok := p.cs.parseReading(reading.Timestamp.UTC(), reading.SensorName, value, record, p.rows, p.name, &p.result)
+		if !ok {
+			continue
+		}
+		if p.cs.precedence != nil {
+			data.SourceFile = &p.source
+		}
+		p.pending = append(p.pending, data)
+	}
+	p.stats.Errors += p.result.ErrorCount + p.result.ViolationCount - before
+	// Rejects are logged and counted; a stream has no reject file to keep them for
+	p.result.rejects = p.result.rejects[:0]
+
+	if len(p.pending) >= p.cs.batchSize {
+		return p.flush(ctx)
+	}
+	return nil
+}
+
+// Close inserts the buffered readings and returns the statistics of the stream
+func (p *PushStream) Close(ctx context.Context) (StreamStats, error) {
+	err := p.flush(ctx)
+	return p.stats, err
+}
+
+// flush inserts the buffered readings
+func (p *PushStream) flush(ctx context.Context) error {
+	if len(p.pending) == 0 {
+		return nil
+	}
+	inserted, skipped, err := p.cs.insertPushed(ctx, p.pending, p.source)
+	if err != nil {
+		return err
+	}
+	// The next batch of the stream resolves the accept window again
+	p.result.window = nil
+	p.stats.Readings += inserted
+	p.stats.Skipped += skipped
+	p.stats.Flushes++
+	p.pending = p.pending[:0]
+	return nil
+}
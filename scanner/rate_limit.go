@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateBurst is how much unused rate a limiter saves up for a burst
+const rateBurst = time.Second
+
+// rateLimiter spaces out inserts to a number of readings per second. A batch
+// above the rate is let through, and the batches after it wait for the time
+// it took up. The zero value does not limit.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64   // Readings per second; 0 for no limit
+	next time.Time // When the readings let through so far are paid for
+}
+
+// set changes the rate, 0 for no limit
+func (rl *rateLimiter) set(rate float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = rate
+	rl.next = time.Time{}
+}
+
+// limit returns the rate, 0 for no limit
+func (rl *rateLimiter) limit() float64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.rate
+}
+
+// wait blocks until count readings may be inserted, or ctx is cancelled
+func (rl *rateLimiter) wait(ctx context.Context, count int) error {
+	rl.mu.Lock()
+	if rl.rate <= 0 {
+		rl.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if rl.next.Before(now.Add(-rateBurst)) {
+		rl.next = now.Add(-rateBurst)
+	}
+	start := rl.next
+	rl.next = rl.next.Add(time.Duration(float64(count) / rl.rate * float64(time.Second)))
+	rl.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetPushRateLimit caps the pushed readings inserted per second, across all
+// clients; 0 removes the limit. Pushes above it wait for their turn.
+func (cs *CSVScanner) SetPushRateLimit(readingsPerSecond float64) {
+	cs.pushLimit.set(readingsPerSecond)
+}
+
+// PushRateLimit returns the pushed readings inserted per second at most, 0
+// without a limit
+func (cs *CSVScanner) PushRateLimit() float64 {
+	return cs.pushLimit.limit()
+}
@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSpacesOutBatches(t *testing.T) {
+	var rl rateLimiter
+	if err := rl.wait(context.Background(), 1_000_000); err != nil {
+		t.Fatalf("wait without a limit: %v", err)
+	}
+
+	// At 1000 readings/s the saved-up second lets 1000 through, and the
+	// batch after them waits for the 100 ms the next 100 take
+	rl.set(1000)
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		if err := rl.wait(context.Background(), 100); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("the burst waited %v", elapsed)
+	}
+	start = time.Now()
+	if err := rl.wait(context.Background(), 100); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("a batch above the rate waited %v, want about 100ms", elapsed)
+	}
+
+	// A cancelled push stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rl.wait(context.Background(), 1000)
+	if err := rl.wait(ctx, 100); err == nil {
+		t.Error("wait returned nil for a cancelled context")
+	}
+}
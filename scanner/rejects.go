@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sensor_data_import/logger"
+)
+
+// rejectSuffix is appended to a source file name to name its reject file
+const rejectSuffix = ".rejects.csv"
+
+// Categories of parsing errors, counted separately in the summary and
+// written to the reject file
+const (
+	ErrorBadTimestamp  = "bad timestamp"
+	ErrorBadValue      = "bad value"
+	ErrorShortRow      = "short row"
+	ErrorEmptySensor   = "empty sensor"
+	ErrorUnknownSensor = "unknown sensor" // Not in the sensor alias file, with unknown_sensors: reject
+	ErrorMalformed     = "malformed"      // Rows or headers that could not be read at all
+	rejectValidation   = "validation"
+)
+
+// errorCategories lists the parsing error categories in summary order
+var errorCategories = []string{ErrorBadTimestamp, ErrorBadValue, ErrorShortRow, ErrorEmptySensor, ErrorUnknownSensor, ErrorMalformed}
+
+// rejectedRow is a row that failed parsing, kept for the reject file
+type rejectedRow struct {
+	row      int
+	record   []string
+	category string
+	reason   string
+}
+
+// reject counts a row as an error of a category, logs it and keeps it for
+// the reject file
+func (r *ProcessResult) reject(fileName string, row int, record []string, category, reason string) {
+	r.countError(category)
+	r.rejects = append(r.rejects, rejectedRow{row: row, record: record, category: category, reason: reason})
+	logger.Warnf("Row %d in %s: %s\n", row, fileName, reason)
+}
+
+// countError counts a parsing error of a category
+func (r *ProcessResult) countError(category string) {
+	r.ErrorCount++
+	if r.ErrorsByCategory == nil {
+		r.ErrorsByCategory = make(map[string]int)
+	}
+	r.ErrorsByCategory[category]++
+}
+
+// isRejectFile reports whether a file was written by the scanner as a reject file
+func isRejectFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), rejectSuffix)
+}
+
+// rejectPath returns where the rejected rows of a job are written: next to
+// the source file, or under the reject directory mirroring the scanned tree.
+// Downloaded files are not kept, so their rejects go to the working directory.
+func (cs *CSVScanner) rejectPath(job FileJob) string {
+	if cs.rejectDir != "" {
+		return filepath.Join(cs.rejectDir, filepath.FromSlash(job.FileName)) + rejectSuffix
+	}
+	if job.source != "" {
+		return path.Base(job.FileName) + rejectSuffix
+	}
+	if job.Member != "" {
+		return job.FilePath + "-" + path.Base(job.Member) + rejectSuffix
+	}
+	return job.FilePath + rejectSuffix
+}
+
+// writeRejects writes the rejected rows of a file with their row number,
+// error category and reason, or removes a stale reject file when every row was accepted
+func (cs *CSVScanner) writeRejects(job FileJob, result *ProcessResult) error {
+	rejectPath := cs.rejectPath(job)
+	if len(result.rejects) == 0 {
+		if err := os.Remove(rejectPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(rejectPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(rejectPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if result.rejectHeader != nil {
+		header := append(append([]string{}, result.rejectHeader...), "reject_row", "reject_category", "reject_reason")
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+	for _, rejected := range result.rejects {
+		// Pad short rows so the reject columns line up with the header
+		line := append([]string{}, rejected.record...)
+		for len(line) < len(result.rejectHeader) {
+			line = append(line, "")
+		}
+		line = append(line, strconv.Itoa(rejected.row), rejected.category, rejected.reason)
+		if err := writer.Write(line); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", rejectPath, err)
+	}
+
+	result.RejectFile = rejectPath
+	return nil
+}
@@ -0,0 +1,407 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+)
+
+// Download defaults used until Configure applies the scanner http settings
+const (
+	defaultHTTPTimeout    = 60 * time.Second
+	defaultHTTPAttempts   = 3
+	defaultHTTPRetryDelay = 2 * time.Second
+)
+
+// httpSource downloads remote files with retries
+type httpSource struct {
+	client     *http.Client
+	attempts   int
+	retryDelay time.Duration
+	headers    map[string]string
+}
+
+// newHTTPSource builds the downloader from the scanner http settings
+func newHTTPSource(cfg config.HTTPSourceConfig) (*httpSource, error) {
+	source := &httpSource{
+		attempts:   defaultHTTPAttempts,
+		retryDelay: defaultHTTPRetryDelay,
+		headers:    make(map[string]string, len(cfg.Headers)),
+	}
+	timeout := defaultHTTPTimeout
+
+	var err error
+	if cfg.Timeout != "" {
+		if timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid scanner http timeout: %w", err)
+		}
+	}
+	if cfg.RetryDelay != "" {
+		if source.retryDelay, err = time.ParseDuration(cfg.RetryDelay); err != nil {
+			return nil, fmt.Errorf("invalid scanner http retry_delay: %w", err)
+		}
+	}
+	if cfg.Attempts > 0 {
+		source.attempts = cfg.Attempts
+	}
+	for name, value := range cfg.Headers {
+		source.headers[name] = os.ExpandEnv(value)
+	}
+
+	// Fetch files exactly as served, so compressed exports stay compressed
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+	source.client = &http.Client{Timeout: timeout, Transport: transport}
+	return source, nil
+}
+
+// httpStatusError reports a download answered with an unexpected status
+type httpStatusError struct {
+	status string
+	code   int
+	detail string // Error message from the response body, if the server sent one
+}
+
+func (e *httpStatusError) Error() string {
+	if e.detail != "" {
+		return "server returned " + e.status + ": " + e.detail
+	}
+	return "server returned " + e.status
+}
+
+// statusError describes a response with an unexpected status, including the
+// code and message of an S3 XML error body
+func statusError(response *http.Response) error {
+	err := &httpStatusError{status: response.Status, code: response.StatusCode}
+	var s3Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if xml.Unmarshal(body, &s3Error) == nil && s3Error.Code != "" {
+		err.detail = strings.TrimSpace(s3Error.Code + " " + s3Error.Message)
+	}
+	return err
+}
+
+// retryable reports whether a failed download may succeed when tried again:
+// network errors, server errors and rate limiting are retried, other client
+// errors such as 401 or 404 are not
+func retryable(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// IsURL reports whether a scan source is an http:// or https:// URL
+func IsURL(source string) bool {
+	lower := strings.ToLower(source)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// IsRemote reports whether a scan source is downloaded: an http(s) URL, an
+// s3:// bucket prefix or an sftp:// path
+func IsRemote(source string) bool {
+	return IsURL(source) || IsS3URL(source) || IsSFTPURL(source)
+}
+
+// ReadURLList reads a file listing one http(s), s3:// or sftp:// URL per
+// line. Blank lines and lines starting with # are ignored.
+func ReadURLList(listPath string) ([]string, error) {
+	file, err := os.Open(listPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var urls []string
+	lines := bufio.NewScanner(file)
+	for lineNumber := 1; lines.Scan(); lineNumber++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !IsRemote(line) {
+			return nil, fmt.Errorf("%s line %d: not an http(s), s3 or sftp URL: %s", listPath, lineNumber, line)
+		}
+		urls = append(urls, line)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// remoteFile is a file to download and import
+type remoteFile struct {
+	url    string                    // Where the file is downloaded from over HTTP
+	name   string                    // Names the file in logs, the import manifest and column mapping patterns
+	source string                    // Recorded as the source file of its readings
+	sign   func(*http.Request) error // Authenticates the request; nil sends it as is
+	// fetch downloads a file not served over HTTP into localPath
+	fetch func(ctx context.Context, localPath string) (int64, error)
+	// remove deletes the file from the remote side once it was imported; nil keeps it
+	remove func() error
+}
+
+// remoteName names a downloaded file by the host and path of its URL, e.g.
+// vendor.example/exports/readings.csv, for logs, the import manifest and
+// column mapping patterns
+func remoteName(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("invalid URL %s: missing host", rawURL)
+	}
+	name := strings.Trim(parsed.Path, "/")
+	if name == "" {
+		name = "index.csv"
+	}
+	return parsed.Host + "/" + name, nil
+}
+
+// ScanURLs downloads remote files and imports them like the files of a
+// scanned directory. An s3:// URL stands for the data files under its key
+// prefix and an sftp:// URL for a file or the files of a directory. HTTP
+// downloads are retried as configured; a file that cannot be downloaded is
+// reported as failed without stopping the others.
+func (cs *CSVScanner) ScanURLs(ctx context.Context, urls []string) error {
+	defer cs.sftp.closeAll()
+
+	var files []remoteFile
+	var failed []ProcessResult
+	for _, rawURL := range urls {
+		if !IsS3URL(rawURL) && !IsSFTPURL(rawURL) {
+			name, err := remoteName(rawURL)
+			if err != nil {
+				logger.Errorf("Failed to download %s: %v\n", rawURL, err)
+				failed = append(failed, ProcessResult{FilePath: rawURL, FileName: rawURL, Error: err})
+				continue
+			}
+			files = append(files, remoteFile{url: rawURL, name: name, source: rawURL})
+			continue
+		}
+
+		var objects []remoteFile
+		var err error
+		if IsSFTPURL(rawURL) {
+			objects, err = cs.sftpFiles(ctx, rawURL)
+		} else {
+			objects, err = cs.s3Files(ctx, rawURL)
+		}
+		if err != nil {
+			logger.Errorf("Failed to list %s: %v\n", rawURL, err)
+			failed = append(failed, ProcessResult{FilePath: rawURL, FileName: rawURL, Error: err})
+			continue
+		}
+		if len(objects) == 0 {
+			logger.Warnf("No data files found under %s\n", rawURL)
+		}
+		files = append(files, objects...)
+	}
+
+	tempDir, err := os.MkdirTemp("", "sensor-import-")
+	if err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	logger.Printf("Downloading %d remote file(s)\n", len(files))
+	var jobs []FileJob
+	downloaded := make(map[string]remoteFile)
+	for i, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		fileJobs, err := cs.downloadJobs(ctx, file, filepath.Join(tempDir, fmt.Sprint(i)))
+		if err != nil {
+			logger.Errorf("Failed to download %s: %v\n", file.source, err)
+			failed = append(failed, ProcessResult{FilePath: file.source, FileName: file.name, Error: err})
+			continue
+		}
+		for _, job := range fileJobs {
+			downloaded[job.FilePath] = file
+		}
+		jobs = append(jobs, fileJobs...)
+	}
+
+	if err := cs.beginScan(); err != nil {
+		return err
+	}
+	defer cs.endScan()
+
+	results := failed
+	if len(jobs) > 0 {
+		results = append(results, cs.processFilesParallel(ctx, jobs, 0)...)
+	}
+	cs.displaySummary(results)
+	removeImported(downloaded, results)
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("scan cancelled: %w", err)
+	}
+	return nil
+}
+
+// downloadJobs downloads a remote file into dir and returns its jobs: one for
+// a data file, or one per CSV member of a ZIP archive
+func (cs *CSVScanner) downloadJobs(ctx context.Context, file remoteFile, dir string) ([]FileJob, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	localPath := filepath.Join(dir, path.Base(file.name))
+
+	var size int64
+	var err error
+	if file.fetch != nil {
+		size, err = file.fetch(ctx, localPath)
+	} else {
+		size, err = cs.http.download(ctx, file, localPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Downloaded %s (%d bytes)\n", file.source, size)
+
+	if isZipFile(localPath) {
+		members, err := listZipMembers(localPath, file.name)
+		if err != nil {
+			return nil, err
+		}
+		for i := range members {
+			members[i].source = file.source
+		}
+		return members, nil
+	}
+	return []FileJob{{
+		FilePath: localPath,
+		FileName: file.name,
+		Dir:      ".",
+		Size:     size,
+		source:   file.source,
+	}}, nil
+}
+
+// removeImported deletes remote files from their source once every job they
+// produced was imported, or had been imported before. Files whose source
+// keeps them are left alone.
+func removeImported(downloaded map[string]remoteFile, results []ProcessResult) {
+	imported := make(map[string]bool)
+	for _, result := range results {
+		file, ok := downloaded[result.FilePath]
+		if !ok || file.remove == nil {
+			continue
+		}
+		succeeded := result.Error == nil && !result.Cancelled
+		if done, seen := imported[result.FilePath]; seen {
+			succeeded = succeeded && done
+		}
+		imported[result.FilePath] = succeeded
+	}
+
+	localPaths := make([]string, 0, len(imported))
+	for localPath := range imported {
+		localPaths = append(localPaths, localPath)
+	}
+	sort.Strings(localPaths)
+	for _, localPath := range localPaths {
+		file := downloaded[localPath]
+		if !imported[localPath] {
+			logger.Printf("Keeping %s on the server: it was not imported\n", file.source)
+			continue
+		}
+		if err := file.remove(); err != nil {
+			logger.Warnf("Failed to delete %s from the server: %v\n", file.source, err)
+			continue
+		}
+		logger.Printf("Deleted %s from the server\n", file.source)
+	}
+}
+
+// download fetches a remote file into a local file, retrying failed attempts
+// with a doubling delay
+func (hs *httpSource) download(ctx context.Context, file remoteFile, localPath string) (int64, error) {
+	delay := hs.retryDelay
+	for attempt := 1; ; attempt++ {
+		size, err := hs.fetch(ctx, file, localPath)
+		if err == nil {
+			return size, nil
+		}
+		if attempt >= hs.attempts || !retryable(err) || ctx.Err() != nil {
+			return 0, err
+		}
+
+		logger.Warnf("Download of %s failed (attempt %d of %d): %v; retrying in %v\n",
+			file.source, attempt, hs.attempts, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// get sends a GET request with the configured headers and returns the
+// response of a request answered with 200 OK
+func (hs *httpSource) get(ctx context.Context, rawURL string, sign func(*http.Request) error) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range hs.headers {
+		request.Header.Set(name, value)
+	}
+	if sign != nil {
+		if err := sign(request); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := hs.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, statusError(response)
+	}
+	return response, nil
+}
+
+// fetch makes one download attempt
+func (hs *httpSource) fetch(ctx context.Context, file remoteFile, localPath string) (int64, error) {
+	response, err := hs.get(ctx, file.url, file.sign)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	local, err := os.Create(localPath)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(local, response.Body)
+	if closeErr := local.Close(); err == nil {
+		err = closeErr
+	}
+	return size, err
+}
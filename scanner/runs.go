@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// maxRunArguments is the length of the arguments column of import_runs
+const maxRunArguments = 2048
+
+// importRun is the import_runs entry of the running command. Its totals are
+// counted by every worker and written when the run ends.
+type importRun struct {
+	mu     sync.Mutex
+	record models.ImportRun
+}
+
+// SetRun names the command and arguments recorded in import_runs when the
+// scanner starts importing; without it no run is recorded
+func (cs *CSVScanner) SetRun(command string, arguments []string) {
+	cs.runCommand = command
+	cs.runArguments = strings.Join(arguments, " ")
+	if len(cs.runArguments) > maxRunArguments {
+		cs.runArguments = cs.runArguments[:maxRunArguments]
+	}
+}
+
+// openRun adds the import_runs entry of the command, when it was named and
+// the table exists
+func (cs *CSVScanner) openRun() {
+	if cs.runCommand == "" {
+		return
+	}
+	if !cs.db.Migrator().HasTable(&models.ImportRun{}) {
+		logger.Warnf("Import run table %s not found (run migrate); readings will not be linked to this run\n",
+			models.ImportRun{}.TableName())
+		return
+	}
+
+	host, _ := os.Hostname()
+	run := &importRun{record: models.ImportRun{
+		Command:   cs.runCommand,
+		Arguments: cs.runArguments,
+		Host:      host,
+		StartedAt: time.Now().UTC(),
+	}}
+	if err := cs.db.Create(&run.record).Error; err != nil {
+		logger.Warnf("Failed to record import run: %v\n", err)
+		return
+	}
+	cs.run = run
+	logger.Printf("Recording import run %d\n", run.record.ID)
+}
+
+// closeRun writes the end time and totals of the run
+func (cs *CSVScanner) closeRun() {
+	run := cs.run
+	if run == nil {
+		return
+	}
+	cs.run = nil
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	finished := time.Now().UTC()
+	run.record.FinishedAt = &finished
+	if err := cs.db.Model(&models.ImportRun{}).Where("id = ?", run.record.ID).Updates(map[string]interface{}{
+		"finished_at":  finished,
+		"file_count":   run.record.FileCount,
+		"failed_count": run.record.FailedCount,
+		"record_count": run.record.RecordCount,
+		"error_count":  run.record.ErrorCount,
+	}).Error; err != nil {
+		logger.Warnf("Failed to record the end of import run %d: %v\n", run.record.ID, err)
+	}
+}
+
+// id returns the ID of the run, or 0 when no run is recorded
+func (r *importRun) id() uint {
+	if r == nil {
+		return 0
+	}
+	return r.record.ID
+}
+
+// countFile adds a processed file to the totals of the run
+func (r *importRun) countFile(result ProcessResult) {
+	if r == nil || result.Cancelled || result.AlreadyDone {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.FileCount++
+	if result.Error != nil {
+		r.record.FailedCount++
+	}
+	r.record.ErrorCount += result.ErrorCount + result.ViolationCount
+}
+
+// countRecords adds readings written to the totals of the run
+func (r *importRun) countRecords(count int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.RecordCount += count
+}
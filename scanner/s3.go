@@ -0,0 +1,280 @@
+package scanner
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"sensor_data_import/config"
+)
+
+// defaultS3Region is used when neither the config nor the environment sets one
+const defaultS3Region = "us-east-1"
+
+// emptyPayloadHash is the SHA-256 of an empty request body, sent with every
+// signed S3 request since the importer only reads
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Source lists and signs requests for objects in S3 or an S3-compatible service
+type s3Source struct {
+	region          string
+	endpoint        *url.URL
+	pathStyle       bool
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// newS3Source builds the S3 client settings, falling back to the AWS_*
+// environment variables for anything the config leaves empty
+func newS3Source(cfg config.S3SourceConfig) (*s3Source, error) {
+	setting := func(value string, variables ...string) string {
+		if value != "" {
+			return os.ExpandEnv(value)
+		}
+		for _, variable := range variables {
+			if value := os.Getenv(variable); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	source := &s3Source{
+		region:          setting(cfg.Region, "AWS_REGION", "AWS_DEFAULT_REGION"),
+		pathStyle:       cfg.PathStyle,
+		accessKeyID:     setting(cfg.AccessKeyID, "AWS_ACCESS_KEY_ID"),
+		secretAccessKey: setting(cfg.SecretAccessKey, "AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    setting(cfg.SessionToken, "AWS_SESSION_TOKEN"),
+	}
+	if source.region == "" {
+		source.region = defaultS3Region
+	}
+
+	endpoint := setting(cfg.Endpoint, "AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = "https://s3." + source.region + ".amazonaws.com"
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid scanner s3 endpoint: %s", endpoint)
+	}
+	source.endpoint = parsed
+	return source, nil
+}
+
+// IsS3URL reports whether a scan source is an s3://bucket/prefix URL
+func IsS3URL(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), "s3://")
+}
+
+// parseS3URL splits an s3://bucket/prefix URL into its bucket and key prefix
+func parseS3URL(rawURL string) (bucket, prefix string, err error) {
+	bucket, prefix, _ = strings.Cut(rawURL[len("s3://"):], "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %s: missing bucket", rawURL)
+	}
+	return bucket, prefix, nil
+}
+
+// s3Files lists the data files and ZIP archives under the prefix of an
+// s3:// URL. Like a directory scan, keys in nested "subdirectories" are only
+// included when recursive scanning is enabled.
+func (cs *CSVScanner) s3Files(ctx context.Context, rawURL string) ([]remoteFile, error) {
+	bucket, prefix, err := parseS3URL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := cs.s3.list(ctx, cs.http, bucket, prefix, cs.recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []remoteFile
+	for _, key := range keys {
+		if !isDataFile(key) && !isZipFile(key) {
+			continue
+		}
+		files = append(files, remoteFile{
+			url:    cs.s3.objectURL(bucket, key, nil),
+			name:   bucket + "/" + key,
+			source: "s3://" + bucket + "/" + key,
+			sign:   cs.s3.sign,
+		})
+	}
+	return files, nil
+}
+
+// listBucketResult is the part of a ListObjectsV2 response the scanner reads
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list returns the keys of the objects under a prefix, following
+// continuation tokens until the listing is complete
+func (s *s3Source) list(ctx context.Context, hs *httpSource, bucket, prefix string, recursive bool) ([]string, error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if !recursive {
+		query.Set("delimiter", "/")
+	}
+
+	var keys []string
+	for {
+		response, err := hs.get(ctx, s.objectURL(bucket, "", query), s.sign)
+		if err != nil {
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket listing: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// objectURL returns the URL of an object, or of the bucket when key is empty.
+// Buckets whose names contain dots are always addressed path-style, as they
+// do not match the wildcard TLS certificate of virtual-hosted addresses.
+func (s *s3Source) objectURL(bucket, key string, query url.Values) string {
+	host := s.endpoint.Host
+	requestPath := "/" + awsEscape(key, false)
+	if s.pathStyle || strings.Contains(bucket, ".") {
+		requestPath = "/" + awsEscape(bucket, true) + requestPath
+	} else {
+		host = bucket + "." + host
+	}
+
+	rawURL := s.endpoint.Scheme + "://" + host + requestPath
+	if len(query) > 0 {
+		rawURL += "?" + canonicalQuery(query)
+	}
+	return rawURL
+}
+
+// sign adds an AWS Signature Version 4 to a request. Without credentials the
+// request is left unsigned, which public buckets accept.
+func (s *s3Source) sign(request *http.Request) error {
+	if s.accessKeyID == "" {
+		return nil
+	}
+	s.signAt(request, time.Now().UTC())
+	return nil
+}
+
+// signAt signs a request for the given time
+func (s *s3Source) signAt(request *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	// The host, a range and every x-amz-* header are signed
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		if lower := strings.ToLower(name); lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.secretAccessKey)
+	for _, part := range []string{now.Format("20060102"), s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as signature
+// version 4 requires
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters, and slashes
+// unless encodeSlash is set
+func awsEscape(value string, encodeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSQLite connects to the SQLite database at path, closed when the test
+// ends
+func openSQLite(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// openTestDB returns a new SQLite database holding sensor_data
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openSQLite(t, filepath.Join(t.TempDir(), "sensor.db"))
+	if err := db.AutoMigrate(&models.SensorData{}); err != nil {
+		t.Fatalf("create sensor_data: %v", err)
+	}
+	return db
+}
+
+// insertRows stores rows in db
+func insertRows[T any](t *testing.T, db *gorm.DB, rows ...T) []T {
+	t.Helper()
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatalf("insert %T: %v", rows, err)
+	}
+	return rows
+}
+
+// countRows returns the number of rows of a model's table
+func countRows(t *testing.T, db *gorm.DB, model interface{}) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Model(model).Count(&count).Error; err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	return count
+}
+
+// minuteReadings returns count readings of temp_01, one a minute from
+// midnight of 2025-09-01 UTC
+func minuteReadings(count int) []models.SensorData {
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	data := make([]models.SensorData, count)
+	for i := range data {
+		data[i] = models.SensorData{Timestamp: start.Add(time.Duration(i) * time.Minute), SensorName: "temp_01", Value: float64(i)}
+	}
+	return data
+}
+
+// writeFiles creates the files of contents, by path relative to dir
+func writeFiles(t *testing.T, dir string, contents map[string]string) {
+	t.Helper()
+	for name, content := range contents {
+		filePath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// appendFile appends text to the file at path
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sensorAliasFile is the format of a sensor alias file
+type sensorAliasFile struct {
+	Aliases map[string]string `yaml:"aliases"` // Name found in files -> canonical sensor name
+	Sensors []string          `yaml:"sensors"` // Further canonical names without aliases
+}
+
+// sensorAliases maps the names sensors had over time to one canonical name.
+// A nil *sensorAliases keeps every name as it is.
+type sensorAliases struct {
+	names         map[string]string // Alias or canonical name -> canonical name
+	rejectUnknown bool              // Reject names that are neither
+}
+
+// loadSensorAliases reads a sensor alias file. With rejectUnknown, readings
+// of sensors the file does not name are rejected.
+func loadSensorAliases(path string, rejectUnknown bool) (*sensorAliases, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sensor alias file: %w", err)
+	}
+
+	var file sensorAliasFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse sensor alias file: %w", err)
+	}
+	if len(file.Aliases) == 0 && len(file.Sensors) == 0 {
+		return nil, fmt.Errorf("sensor alias file %s has no aliases or sensors", path)
+	}
+
+	aliases := &sensorAliases{names: make(map[string]string), rejectUnknown: rejectUnknown}
+	for _, name := range file.Sensors {
+		if name = strings.TrimSpace(name); name != "" {
+			aliases.names[name] = name
+		}
+	}
+	for alias, canonical := range file.Aliases {
+		canonical = strings.TrimSpace(canonical)
+		if canonical == "" {
+			return nil, fmt.Errorf("sensor alias %q in %s has no canonical name", alias, path)
+		}
+		aliases.names[canonical] = canonical
+	}
+	for alias, canonical := range file.Aliases {
+		alias, canonical = strings.TrimSpace(alias), strings.TrimSpace(canonical)
+		// An alias of an alias would depend on the order names are mapped in
+		if mapped, ok := aliases.names[alias]; ok && mapped == alias && alias != canonical {
+			return nil, fmt.Errorf("sensor alias %q in %s is also a canonical name", alias, path)
+		}
+		aliases.names[alias] = canonical
+	}
+	return aliases, nil
+}
+
+// resolve returns the canonical name of a sensor, and false when the name is
+// unknown and such sensors are rejected
+func (a *sensorAliases) resolve(name string) (string, bool) {
+	if a == nil {
+		return name, true
+	}
+	if canonical, ok := a.names[name]; ok {
+		return canonical, true
+	}
+	return name, !a.rejectUnknown
+}
@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"path"
+	"strings"
+)
+
+// sensorFilter selects which sensors are imported from mixed files. Patterns
+// are exact sensor names or glob patterns.
+type sensorFilter struct {
+	include []string // When set, only matching sensors are imported
+	exclude []string // Matching sensors are never imported
+}
+
+func (sf sensorFilter) enabled() bool {
+	return len(sf.include) > 0 || len(sf.exclude) > 0
+}
+
+// allows reports whether the readings of a sensor are imported
+func (sf sensorFilter) allows(sensorName string) bool {
+	if len(sf.include) > 0 && !matchesAnyPattern(sf.include, sensorName) {
+		return false
+	}
+	return !matchesAnyPattern(sf.exclude, sensorName)
+}
+
+// String describes the filter for log output
+func (sf sensorFilter) String() string {
+	var parts []string
+	if len(sf.include) > 0 {
+		parts = append(parts, "including "+strings.Join(sf.include, ", "))
+	}
+	if len(sf.exclude) > 0 {
+		parts = append(parts, "excluding "+strings.Join(sf.exclude, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// matchesAnyPattern reports whether a name matches one of the glob patterns
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sensor_data_import/config"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultSFTPTimeout bounds connecting and authenticating to an SFTP server
+const defaultSFTPTimeout = 30 * time.Second
+
+// sftpSource connects to SFTP servers with the configured credentials. One
+// connection per user and host is kept open for the duration of a scan.
+type sftpSource struct {
+	cfg     config.SFTPSourceConfig
+	timeout time.Duration
+	mu      sync.Mutex
+	clients map[string]*sftpClient // By user@host:port
+}
+
+// newSFTPSource builds the SFTP settings from the scanner sftp section
+func newSFTPSource(cfg config.SFTPSourceConfig) (*sftpSource, error) {
+	source := &sftpSource{cfg: cfg, timeout: defaultSFTPTimeout, clients: make(map[string]*sftpClient)}
+	if cfg.Timeout != "" {
+		var err error
+		if source.timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid scanner sftp timeout: %w", err)
+		}
+	}
+	return source, nil
+}
+
+// IsSFTPURL reports whether a scan source is an sftp://user@host/path URL
+func IsSFTPURL(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), "sftp://")
+}
+
+// client returns the open connection for a user and host, connecting on first use
+func (s *sftpSource) client(user, host string) (*sftpClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(host, "22")
+	}
+	key := user + "@" + address
+	if client := s.clients[key]; client != nil {
+		return client, nil
+	}
+
+	clientConfig, err := s.clientConfig(user)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ssh.Dial("tcp", address, clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	session, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start sftp on %s: %w", address, err)
+	}
+	client := &sftpClient{Client: session, conn: conn}
+	s.clients[key] = client
+	return client, nil
+}
+
+// sftpClient is an SFTP session together with the SSH connection it runs on
+type sftpClient struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+// Close ends the SFTP session and the SSH connection
+func (c *sftpClient) Close() error {
+	c.Client.Close()
+	return c.conn.Close()
+}
+
+// download copies a remote file to w, checking for cancellation between chunks
+func (c *sftpClient) download(ctx context.Context, remotePath string, w io.Writer) (int64, error) {
+	file, err := c.Open(remotePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return file.WriteTo(cancelableWriter{ctx: ctx, w: w})
+}
+
+// cancelableWriter fails writes once ctx is cancelled, which ends a transfer
+// writing to it
+type cancelableWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw cancelableWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// clientConfig returns the SSH settings for a user: key and/or password
+// authentication and host key verification against known_hosts
+func (s *sftpSource) clientConfig(user string) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if keyFile := expandHome(os.ExpandEnv(s.cfg.KeyFile)); keyFile != "" {
+		pemBytes, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scanner sftp key_file: %w", err)
+		}
+		var signer ssh.Signer
+		if passphrase := os.ExpandEnv(s.cfg.KeyPassphrase); passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pemBytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid scanner sftp key_file %s: %w", keyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password := os.ExpandEnv(s.cfg.Password); password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no SFTP credentials: set scanner sftp key_file or password")
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !s.cfg.InsecureIgnoreHostKey {
+		knownHostsFile := expandHome(os.ExpandEnv(s.cfg.KnownHosts))
+		if knownHostsFile == "" {
+			knownHostsFile = expandHome("~/.ssh/known_hosts")
+		}
+		var err error
+		if hostKeyCallback, err = knownhosts.New(knownHostsFile); err != nil {
+			return nil, fmt.Errorf("failed to read known hosts (set scanner sftp known_hosts): %w", err)
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         s.timeout,
+	}, nil
+}
+
+// closeAll closes the connections opened during a scan
+func (s *sftpSource) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, client := range s.clients {
+		client.Close()
+		delete(s.clients, key)
+	}
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(filePath string) string {
+	if rest, ok := strings.CutPrefix(filePath, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return filePath
+}
+
+// sftpFiles returns the data files and ZIP archives an sftp:// URL names:
+// the file itself, or the files of a directory. Like a directory scan,
+// subdirectories are only included when recursive scanning is enabled.
+func (cs *CSVScanner) sftpFiles(ctx context.Context, rawURL string) ([]remoteFile, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid URL %s: missing host", rawURL)
+	}
+	if _, hasPassword := parsed.User.Password(); hasPassword {
+		return nil, fmt.Errorf("invalid URL %s: set the password in scanner sftp, not in the URL", parsed.Redacted())
+	}
+	user := parsed.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	if user == "" {
+		return nil, fmt.Errorf("invalid URL %s: missing user (sftp://user@host/path)", rawURL)
+	}
+
+	client, err := cs.sftp.client(user, parsed.Host)
+	if err != nil {
+		return nil, err
+	}
+	// Paths are absolute; /~/ starts at the login directory, as in curl
+	root := parsed.Path
+	if rest, ok := strings.CutPrefix(root, "/~"); ok {
+		root = "." + rest
+	}
+	if root == "" {
+		root = "."
+	}
+	entry, err := client.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", root, err)
+	}
+
+	var remotePaths []string
+	if entry.IsDir() {
+		if remotePaths, err = cs.sftpWalk(ctx, client, root); err != nil {
+			return nil, err
+		}
+		sort.Strings(remotePaths)
+	} else {
+		remotePaths = []string{root}
+	}
+
+	var files []remoteFile
+	for _, remotePath := range remotePaths {
+		if !isDataFile(remotePath) && !isZipFile(remotePath) {
+			continue
+		}
+		relPath := strings.TrimPrefix(remotePath, "/")
+		if !strings.HasPrefix(remotePath, "/") {
+			relPath = "~/" + path.Clean(remotePath)
+		}
+		file := remoteFile{
+			name:   parsed.Host + "/" + relPath,
+			source: "sftp://" + parsed.Host + "/" + relPath,
+			fetch: func(ctx context.Context, localPath string) (int64, error) {
+				local, err := os.Create(localPath)
+				if err != nil {
+					return 0, err
+				}
+				size, err := client.download(ctx, remotePath, local)
+				if closeErr := local.Close(); err == nil {
+					err = closeErr
+				}
+				return size, err
+			},
+		}
+		if cs.sftp.cfg.DeleteAfterImport {
+			file.remove = func() error { return client.Remove(remotePath) }
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// sftpWalk returns the files of a remote directory, descending into
+// subdirectories when recursive scanning is enabled
+func (cs *CSVScanner) sftpWalk(ctx context.Context, client *sftpClient, dir string) ([]string, error) {
+	entries, err := client.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list %s: %w", dir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entryPath := path.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			files = append(files, entryPath)
+			continue
+		}
+		if !cs.recursive {
+			continue
+		}
+		nested, err := cs.sftpWalk(ctx, client, entryPath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, nested...)
+	}
+	return files, nil
+}
@@ -0,0 +1,193 @@
+package scanner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sensor_data_import/config"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startSFTPServer serves the local file system over SFTP on a free loopback
+// port to the user importer with the password secret. It returns the
+// address and a known_hosts file holding the server's host key.
+func startSFTPServer(t *testing.T) (string, string) {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("host key signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "importer" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, serverConfig)
+		}
+	}()
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(listener.Addr().String())}, signer.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+	return listener.Addr().String(), knownHosts
+}
+
+// serveSFTP runs the sftp subsystem on the sessions of an SSH connection
+func serveSFTP(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are served")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for request := range channelRequests {
+				isSFTP := request.Type == "subsystem" && string(request.Payload[4:]) == "sftp"
+				request.Reply(isSFTP, nil)
+				if isSFTP {
+					server, err := sftp.NewServer(channel)
+					if err != nil {
+						channel.Close()
+						return
+					}
+					server.Serve()
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+// sftpTestScanner returns a scanner of sftp:// URLs with the settings
+func sftpTestScanner(t *testing.T, cfg config.SFTPSourceConfig) *CSVScanner {
+	t.Helper()
+	source, err := newSFTPSource(cfg)
+	if err != nil {
+		t.Fatalf("newSFTPSource: %v", err)
+	}
+	t.Cleanup(source.closeAll)
+	return &CSVScanner{sftp: source}
+}
+
+func TestSFTPFilesDownloadAndRemove(t *testing.T) {
+	addr, knownHosts := startSFTPServer(t)
+	dir := t.TempDir()
+	content := "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n"
+	writeFiles(t, dir, map[string]string{
+		"a.csv":          "timestamp,sensor_name,value\n",
+		"notes.txt":      "not a data file",
+		"nested/b.csv":   content,
+		"nested/c.jsonl": "{}\n",
+	})
+	cs := sftpTestScanner(t, config.SFTPSourceConfig{Password: "secret", KnownHosts: knownHosts, DeleteAfterImport: true})
+	cs.recursive = true
+
+	files, err := cs.sftpFiles(context.Background(), "sftp://importer@"+addr+filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatalf("sftpFiles: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, strings.TrimPrefix(file.name, addr+"/"+strings.TrimPrefix(filepath.ToSlash(dir), "/")))
+	}
+	if strings.Join(names, " ") != "/a.csv /nested/b.csv /nested/c.jsonl" {
+		t.Fatalf("files = %q, want a.csv, nested/b.csv and nested/c.jsonl", names)
+	}
+	if !strings.HasPrefix(files[1].source, "sftp://"+addr+"/") {
+		t.Errorf("source = %s, want an sftp:// URL", files[1].source)
+	}
+
+	localPath := filepath.Join(t.TempDir(), "b.csv")
+	size, err := files[1].fetch(context.Background(), localPath)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if downloaded, _ := os.ReadFile(localPath); size != int64(len(content)) || string(downloaded) != content {
+		t.Errorf("downloaded %d bytes: %q", size, downloaded)
+	}
+
+	if err := files[1].remove(); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nested", "b.csv")); !os.IsNotExist(err) {
+		t.Errorf("nested/b.csv was not removed: %v", err)
+	}
+
+	// Without recursion only the files at the top are listed
+	cs.recursive = false
+	if files, err = cs.sftpFiles(context.Background(), "sftp://importer@"+addr+filepath.ToSlash(dir)); err != nil || len(files) != 1 {
+		t.Errorf("non-recursive listing = %d files, %v; want only a.csv", len(files), err)
+	}
+}
+
+func TestSFTPFetchCancelled(t *testing.T) {
+	addr, knownHosts := startSFTPServer(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": strings.Repeat("2025-09-01 00:00:00,temp_01,1\n", 10000)})
+	cs := sftpTestScanner(t, config.SFTPSourceConfig{Password: "secret", KnownHosts: knownHosts})
+
+	files, err := cs.sftpFiles(context.Background(), "sftp://importer@"+addr+filepath.ToSlash(dir)+"/a.csv")
+	if err != nil || len(files) != 1 {
+		t.Fatalf("sftpFiles = %d files, %v; want a.csv", len(files), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := files[0].fetch(ctx, filepath.Join(t.TempDir(), "a.csv")); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled fetch error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSFTPVerifiesHostKey(t *testing.T) {
+	addr, _ := startSFTPServer(t)
+	_, otherAddrKnownHosts := startSFTPServer(t) // Holds another server's key
+
+	cs := sftpTestScanner(t, config.SFTPSourceConfig{Password: "secret", KnownHosts: otherAddrKnownHosts})
+	if _, err := cs.sftpFiles(context.Background(), "sftp://importer@"+addr+"/"); err == nil {
+		t.Error("connected to a server missing from known_hosts")
+	}
+
+	cs = sftpTestScanner(t, config.SFTPSourceConfig{Password: "wrong", InsecureIgnoreHostKey: true})
+	if _, err := cs.sftpFiles(context.Background(), "sftp://importer@"+addr+"/"); err == nil {
+		t.Error("connected with a wrong password")
+	}
+}
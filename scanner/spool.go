@@ -0,0 +1,302 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	// spoolFlushInterval is how often a scan checks whether the database is
+	// back and flushes the spooled readings
+	spoolFlushInterval = 30 * time.Second
+	// spoolPingTimeout bounds the check whether the database is reachable
+	spoolPingTimeout = 5 * time.Second
+)
+
+// spooledReading is a parsed reading kept in the local spool while the
+// database was unreachable
+type spooledReading struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement"`
+	Timestamp        time.Time `gorm:"not null"`
+	SensorName       string    `gorm:"not null"`
+	Value            float64   `gorm:"not null"`
+	SourceFile       *string
+	SourceModifiedAt *time.Time
+	ImportFileID     *uint
+	SourceRunID      *uint
+	FileName         string    `gorm:"not null"` // File the reading was parsed from, for warnings and dead letters
+	SpooledAt        time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName keeps the spool table name free of the configured table naming
+func (spooledReading) TableName() string {
+	return "spooled_readings"
+}
+
+// reading returns the spooled reading as it is inserted
+func (row spooledReading) reading() models.SensorData {
+	return models.SensorData{
+		Timestamp:        row.Timestamp,
+		SensorName:       row.SensorName,
+		Value:            row.Value,
+		SourceFile:       row.SourceFile,
+		SourceModifiedAt: row.SourceModifiedAt,
+		ImportFileID:     row.ImportFileID,
+		SourceRunID:      row.SourceRunID,
+	}
+}
+
+// readingSpool is an embedded SQLite database holding the readings that
+// could not be inserted because the database was unreachable
+type readingSpool struct {
+	path    string
+	db      *gorm.DB
+	offline atomic.Bool // Set once an insert found the database unreachable, cleared by a flush
+	flushMu sync.Mutex  // Serializes flushes
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// openSpool opens, or creates, the spool file
+func openSpool(path string) (*readingSpool, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool %s: %w", path, err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool %s: %w", path, err)
+	}
+	// One connection serializes the workers' writes to the file
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&spooledReading{}); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to create spool table in %s: %w", path, err)
+	}
+	return &readingSpool{path: path, db: db}, nil
+}
+
+// add keeps readings of fileName in the spool
+func (s *readingSpool) add(fileName string, data []models.SensorData) error {
+	rows := make([]spooledReading, len(data))
+	for i, record := range data {
+		rows[i] = spooledReading{
+			Timestamp:        record.Timestamp,
+			SensorName:       record.SensorName,
+			Value:            record.Value,
+			SourceFile:       record.SourceFile,
+			SourceModifiedAt: record.SourceModifiedAt,
+			ImportFileID:     record.ImportFileID,
+			SourceRunID:      record.SourceRunID,
+			FileName:         fileName,
+		}
+	}
+	if err := s.db.CreateInBatches(rows, 1000).Error; err != nil {
+		return fmt.Errorf("failed to spool %d readings to %s: %w", len(data), s.path, err)
+	}
+	return nil
+}
+
+// count returns the number of readings waiting in the spool
+func (s *readingSpool) count() (int64, error) {
+	var count int64
+	err := s.db.Model(&spooledReading{}).Count(&count).Error
+	return count, err
+}
+
+// close closes the spool file
+func (s *readingSpool) close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// openReadingSpool opens the spool when one is configured and flushes the
+// readings earlier runs left in it. While the scan runs, the spool is
+// flushed every spoolFlushInterval, so long-running modes catch up as soon
+// as the database is back.
+func (cs *CSVScanner) openReadingSpool() error {
+	if cs.spoolPath == "" {
+		return nil
+	}
+	spool, err := openSpool(cs.spoolPath)
+	if err != nil {
+		return err
+	}
+	cs.spool = spool
+	logger.Printf("Readings are spooled to %s whenever the database is unreachable\n", cs.spoolPath)
+	cs.flushSpool()
+
+	spool.stop = make(chan struct{})
+	spool.done = make(chan struct{})
+	go func() {
+		defer close(spool.done)
+		ticker := time.NewTicker(spoolFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-spool.stop:
+				return
+			case <-ticker.C:
+				cs.flushSpool()
+			}
+		}
+	}()
+	return nil
+}
+
+// closeReadingSpool stops the periodic flush, flushes once more and closes
+// the spool, reporting the readings still waiting in it
+func (cs *CSVScanner) closeReadingSpool() {
+	spool := cs.spool
+	if spool == nil {
+		return
+	}
+	if spool.stop != nil {
+		close(spool.stop)
+		<-spool.done
+	}
+	cs.flushSpool()
+	if count, err := spool.count(); err == nil && count > 0 {
+		logger.Warnf("%d readings remain spooled in %s; they are inserted by the next import once the database is reachable\n",
+			count, spool.path)
+	}
+	if err := spool.close(); err != nil {
+		logger.Warnf("Failed to close spool %s: %v\n", spool.path, err)
+	}
+	cs.spool = nil
+}
+
+// databaseReachable pings the database
+func (cs *CSVScanner) databaseReachable() bool {
+	sqlDB, err := cs.db.DB()
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), spoolPingTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx) == nil
+}
+
+// spoolBatch keeps a batch that failed to insert in the spool when the
+// database turns out to be unreachable. It reports whether the batch was
+// spooled; otherwise the caller handles the failure as before.
+func (cs *CSVScanner) spoolBatch(batch []models.SensorData, result *ProcessResult) bool {
+	if cs.spool == nil {
+		return false
+	}
+	if !cs.spool.offline.Load() {
+		if cs.databaseReachable() {
+			return false
+		}
+		logger.Warnf("Database unreachable, spooling readings to %s\n", cs.spool.path)
+		cs.spool.offline.Store(true)
+	}
+	if err := cs.spool.add(result.FileName, batch); err != nil {
+		logger.Warnf("%v\n", err)
+		return false
+	}
+	result.Spooled += len(batch)
+	return true
+}
+
+// flushSpool inserts the spooled readings, oldest first, once the database
+// is reachable. Each batch is removed from the spool after it was inserted;
+// readings that fail to insert for another reason are kept in the
+// dead-letter table like those of a file.
+func (cs *CSVScanner) flushSpool() {
+	spool := cs.spool
+	spool.flushMu.Lock()
+	defer spool.flushMu.Unlock()
+
+	count, err := spool.count()
+	if err != nil {
+		logger.Warnf("Failed to read spool %s: %v\n", spool.path, err)
+		return
+	}
+	if count == 0 {
+		spool.offline.Store(false)
+		return
+	}
+	if !cs.databaseReachable() {
+		logger.Debugf("Database still unreachable, %d readings stay spooled\n", count)
+		return
+	}
+
+	flushed := 0
+	for {
+		var rows []spooledReading
+		if err := spool.db.Order("id").Limit(cs.batchSize).Find(&rows).Error; err != nil {
+			logger.Warnf("Failed to read spool %s: %v\n", spool.path, err)
+			return
+		}
+		if len(rows) == 0 {
+			break
+		}
+		if err := cs.insertSpooled(rows); err != nil {
+			logger.Warnf("Spooled readings not flushed yet: %v\n", err)
+			return
+		}
+		if err := spool.db.Where("id <= ?", rows[len(rows)-1].ID).Delete(&spooledReading{}).Error; err != nil {
+			logger.Warnf("Failed to remove flushed readings from spool %s: %v\n", spool.path, err)
+			return
+		}
+		flushed += len(rows)
+	}
+	spool.offline.Store(false)
+	logger.Printf("✓ Flushed %d spooled readings from %s\n", flushed, spool.path)
+}
+
+// insertSpooled inserts spooled readings, grouped by the file they came from
+// so warnings and dead letters name it. An error means the database is
+// unreachable again and the readings stay spooled.
+func (cs *CSVScanner) insertSpooled(rows []spooledReading) error {
+	var files []string
+	byFile := make(map[string][]models.SensorData)
+	for _, row := range rows {
+		if _, ok := byFile[row.FileName]; !ok {
+			files = append(files, row.FileName)
+		}
+		byFile[row.FileName] = append(byFile[row.FileName], row.reading())
+	}
+
+	for _, fileName := range files {
+		batch := byFile[fileName]
+		var events []changeEvent
+		var err error
+		if cs.precedence != nil && !cs.rawIngest {
+			_, events, err = cs.insertWithPrecedence(batch)
+		} else {
+			err = cs.loadTransaction(func(tx *gorm.DB) error {
+				var txErr error
+				_, events, txErr = cs.insertWithPolicy(tx, batch)
+				return txErr
+			})
+		}
+		if err == nil {
+			cs.changelog.write(fileName, events)
+			continue
+		}
+		if !cs.databaseReachable() {
+			return err
+		}
+		// Duplicates of readings inserted since, or rows the database rejects
+		result := ProcessResult{FileName: fileName}
+		if err := cs.individualInsert(batch, &result); err != nil {
+			logger.Warnf("Spooled readings of %s could not be inserted: %v\n", fileName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+// spoolReadings leaves readings of fileName in the spool file at path, as a
+// run that ended while the database was down would
+func spoolReadings(t *testing.T, path, fileName string, data []models.SensorData) {
+	t.Helper()
+	spool, err := openSpool(path)
+	if err != nil {
+		t.Fatalf("openSpool: %v", err)
+	}
+	defer spool.close()
+	if err := spool.add(fileName, data); err != nil {
+		t.Fatalf("add to spool: %v", err)
+	}
+}
+
+func TestSpoolReplaysReadingsOfEarlierRuns(t *testing.T) {
+	spoolPath := filepath.Join(t.TempDir(), "spool.db")
+	data := minuteReadings(5)
+	source := "site_a/readings.csv"
+	batchID := uint(7)
+	for i := range data {
+		data[i].SourceFile, data[i].ImportFileID = &source, &batchID
+	}
+	spoolReadings(t, spoolPath, "readings.csv", data)
+
+	// The next run flushes the spool in batches before it imports anything
+	db := openTestDB(t)
+	cs := NewCSVScanner(db)
+	if err := cs.Configure(config.ScannerConfig{BatchSize: 2, SpoolFile: spoolPath}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	if err := cs.openReadingSpool(); err != nil {
+		t.Fatalf("openReadingSpool: %v", err)
+	}
+	defer cs.closeReadingSpool()
+
+	if count, _ := cs.spool.count(); count != 0 {
+		t.Errorf("%d readings left in the spool, want it flushed", count)
+	}
+	var stored []models.SensorData
+	if err := db.Order("timestamp").Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	if len(stored) != 5 || stored[4].Value != 4 {
+		t.Fatalf("stored %+v, want the 5 spooled readings", stored)
+	}
+	if stored[0].SourceFile == nil || *stored[0].SourceFile != source || stored[0].ImportFileID == nil || *stored[0].ImportFileID != batchID {
+		t.Errorf("stored %+v, want the provenance of the spooled reading", stored[0])
+	}
+}
+
+func TestSpoolFlushWaitsForTheDatabase(t *testing.T) {
+	spoolPath := filepath.Join(t.TempDir(), "spool.db")
+	spoolReadings(t, spoolPath, "a.csv", minuteReadings(3))
+
+	dbPath := filepath.Join(t.TempDir(), "sensor.db")
+	db := openSQLite(t, dbPath)
+	if err := db.AutoMigrate(&models.SensorData{}); err != nil {
+		t.Fatalf("create sensor_data: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	cs := NewCSVScanner(db)
+	cs.spoolPath = spoolPath
+	if err := cs.openReadingSpool(); err != nil {
+		t.Fatalf("openReadingSpool: %v", err)
+	}
+	defer cs.closeReadingSpool()
+	if count, _ := cs.spool.count(); count != 3 {
+		t.Fatalf("%d readings in the spool while the database is down, want 3", count)
+	}
+
+	cs.db = openSQLite(t, dbPath)
+	cs.flushSpool()
+	if count, _ := cs.spool.count(); count != 0 || countRows(t, cs.db, &models.SensorData{}) != 3 {
+		t.Errorf("%d readings left in the spool, want all 3 inserted once the database is back", count)
+	}
+}
+
+func TestSpooledDuplicatesBecomeDeadLetters(t *testing.T) {
+	spoolPath := filepath.Join(t.TempDir(), "spool.db")
+	spoolReadings(t, spoolPath, "a.csv", minuteReadings(3))
+
+	// Another import stored one of the readings while they were spooled
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.SensorDataReject{}); err != nil {
+		t.Fatalf("create sensor_data_rejects: %v", err)
+	}
+	insertRows(t, db, minuteReadings(2)[1])
+	cs := NewCSVScanner(db)
+	if err := cs.Configure(config.ScannerConfig{InsertPolicy: InsertPolicyError, SpoolFile: spoolPath}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	cs.enableDeadLetters()
+	if err := cs.openReadingSpool(); err != nil {
+		t.Fatalf("openReadingSpool: %v", err)
+	}
+	defer cs.closeReadingSpool()
+
+	// The other readings are inserted and the spool does not keep retrying
+	// the duplicate
+	if count, _ := cs.spool.count(); count != 0 {
+		t.Errorf("%d readings left in the spool, want none", count)
+	}
+	stored, rejects := countRows(t, db, &models.SensorData{}), countRows(t, db, &models.SensorDataReject{})
+	if stored != 3 || rejects != 1 {
+		t.Errorf("stored %d readings and %d dead letters, want 3 and the duplicate", stored, rejects)
+	}
+}
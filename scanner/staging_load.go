@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// LoadMethodStaging loads each batch into an unindexed temporary table and
+// merges it with one INSERT ... SELECT
+const LoadMethodStaging = "staging"
+
+// stagingChunkSize is the number of rows per statement filling the staging
+// table, keeping the bound parameters below the limits of every driver
+const stagingChunkSize = 1000
+
+// stagingTable is the temporary table batches are loaded into before they
+// are merged into their table. Temporary tables belong to one connection, so
+// each pooled connection gets its own, created by the first batch loaded on it
+// and dropped when the connection closes.
+type stagingTable struct {
+	name    string
+	columns []string // In the order copyReadings writes them
+	create  string   // CREATE TEMPORARY TABLE IF NOT EXISTS statement
+	clear   string   // Empties the table before commit; PostgreSQL empties it itself
+}
+
+// newStagingTable defines the staging table with the column types of
+// sensor_data in the dialect of db. It has no indexes and no constraints.
+func newStagingTable(db *gorm.DB) (*stagingTable, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&models.SensorData{}); err != nil {
+		return nil, fmt.Errorf("failed to define staging table: %w", err)
+	}
+
+	staging := &stagingTable{name: models.TableName("sensor_data_staging")}
+	var definitions []string
+	if models.IDStrategy() == models.IDSnowflake {
+		// Snowflake IDs are assigned by the importer before loading
+		staging.columns = append(staging.columns, "id")
+		definitions = append(definitions, stmt.Quote("id")+" BIGINT")
+	}
+	for _, column := range []string{"timestamp", "sensor_name", "value", "source_file", "source_modified_at", "import_file_id", "source_run_id", "created_at"} {
+		field := stmt.Schema.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("failed to define staging table: sensor_data has no column %s", column)
+		}
+		staging.columns = append(staging.columns, column)
+		definitions = append(definitions, stmt.Quote(column)+" "+db.Dialector.DataTypeOf(field))
+	}
+
+	create := fmt.Sprintf("CREATE TEMPORARY TABLE IF NOT EXISTS %s (%s)", stmt.Quote(staging.name), strings.Join(definitions, ", "))
+	if db.Dialector.Name() == "postgres" {
+		staging.create = create + " ON COMMIT DELETE ROWS"
+	} else {
+		staging.create = create
+		staging.clear = "DELETE FROM " + stmt.Quote(staging.name)
+	}
+	return staging, nil
+}
+
+// insertStaged loads a batch into the staging table and merges it into the
+// target table in one statement, applying the insert policy to the whole set.
+// It returns the number of rows skipped as duplicates.
+func (cs *CSVScanner) insertStaged(tx *gorm.DB, batch []models.SensorData, policy string) (int, error) {
+	staging := cs.staging
+	if err := tx.Exec(staging.create).Error; err != nil {
+		return 0, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	var err error
+	if copyFrom, ok := copyFromOf(tx); ok {
+		err = copyFrom(staging.name, batch)
+	} else {
+		err = tx.Table(staging.name).CreateInBatches(staging.rows(batch, tx.NowFunc()), stagingChunkSize).Error
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load staging table: %w", err)
+	}
+
+	merge := tx.Exec(staging.mergeStatement(tx, cs.targetTableName(), policy, cs.rawIngest))
+	if merge.Error != nil {
+		return 0, merge.Error
+	}
+	if staging.clear != "" {
+		if err := tx.Exec(staging.clear).Error; err != nil {
+			return 0, fmt.Errorf("failed to empty staging table: %w", err)
+		}
+	}
+
+	if policy == InsertPolicySkip && !cs.rawIngest {
+		return len(batch) - int(merge.RowsAffected), nil
+	}
+	return 0, nil
+}
+
+// rows converts readings to staging table rows stored at now, assigning
+// snowflake IDs
+func (s *stagingTable) rows(batch []models.SensorData, now time.Time) []map[string]any {
+	rows := make([]map[string]any, len(batch))
+	for i := range batch {
+		record := &batch[i]
+		row := map[string]any{
+			"timestamp":          record.Timestamp,
+			"sensor_name":        record.SensorName,
+			"value":              record.Value,
+			"source_file":        record.SourceFile,
+			"source_modified_at": record.SourceModifiedAt,
+			"import_file_id":     record.ImportFileID,
+			"source_run_id":      record.SourceRunID,
+			"created_at":         now,
+		}
+		if s.columns[0] == "id" {
+			record.BeforeCreate(nil)
+			row["id"] = int64(record.ID)
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// mergeStatement builds the INSERT ... SELECT moving the staged rows into
+// table, with the conflict handling of the insert policy in the dialect of
+// tx. Raw ingest tables have no unique index, so nothing can conflict.
+func (s *stagingTable) mergeStatement(tx *gorm.DB, table, policy string, raw bool) string {
+	quoted := make([]string, len(s.columns))
+	for i, column := range s.columns {
+		quoted[i] = tx.Statement.Quote(column)
+	}
+	columns := strings.Join(quoted, ", ")
+	// WHERE true keeps SQLite from reading ON CONFLICT as a join constraint
+	statement := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE true",
+		tx.Statement.Quote(table), columns, columns, tx.Statement.Quote(s.name))
+
+	onConflict, ok := conflictClause(policy)
+	if !ok || raw {
+		return statement
+	}
+	var updates []string
+	for _, assignment := range onConflict.DoUpdates {
+		column := tx.Statement.Quote(assignment.Column.Name)
+		if tx.Dialector.Name() == "mysql" {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", column, column))
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+		}
+	}
+
+	if tx.Dialector.Name() == "mysql" {
+		if onConflict.DoNothing {
+			// A no-op assignment leaves duplicates unchanged and uncounted
+			sensorName := tx.Statement.Quote("sensor_name")
+			return statement + fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s = %s", sensorName, sensorName)
+		}
+		return statement + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+	target := fmt.Sprintf(" ON CONFLICT (%s, %s)", tx.Statement.Quote("timestamp"), tx.Statement.Quote("sensor_name"))
+	if onConflict.DoNothing {
+		return statement + target + " DO NOTHING"
+	}
+	return statement + target + " DO UPDATE SET " + strings.Join(updates, ", ")
+}
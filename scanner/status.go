@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rateWindow is how many seconds the insert rate of the status is averaged over
+const rateWindow = 60
+
+// Status is a snapshot of a long-running scanner, such as watch or serve,
+// reported over the control socket
+type Status struct {
+	Command  string       `json:"command"`
+	PID      int          `json:"pid"`
+	Started  time.Time    `json:"started"`
+	Workers  int          `json:"workers"`
+	Paused   bool         `json:"paused"`
+	Readings int64        `json:"readings"` // Readings inserted since the start
+	Rate     float64      `json:"rate"`     // Readings inserted per second over the last minute
+	Files    []ActiveFile `json:"files"`    // Files, or pushed sources, being inserted
+	Queue    StatusQueue  `json:"queue"`
+}
+
+// ActiveFile is a file being imported, or a pushed source being inserted
+type ActiveFile struct {
+	Name     string    `json:"name"`
+	Started  time.Time `json:"started"`
+	Readings int64     `json:"readings"` // Readings inserted so far
+}
+
+// StatusQueue counts the work waiting for a worker
+type StatusQueue struct {
+	Waiting  int `json:"waiting"`  // Files waiting for a worker, or pushes waiting for their insert
+	Settling int `json:"settling"` // Changed files waiting for the debounce interval
+	Retrying int `json:"retrying"` // Failed files waiting for their next attempt
+}
+
+// Depth returns the number of files or pushes waiting
+func (q StatusQueue) Depth() int {
+	return q.Waiting + q.Settling + q.Retrying
+}
+
+// liveStatus tracks what a scanner is doing for Status. The zero value is
+// ready to use.
+type liveStatus struct {
+	mu       sync.Mutex
+	started  time.Time
+	active   map[string]*activeEntry
+	readings int64
+	seconds  [rateWindow]int64 // Unix second each rate bucket counts
+	counts   [rateWindow]int64 // Readings inserted in that second
+	round    chan FileJob      // Files of the import round not yet taken by a worker
+	queue    StatusQueue       // Set by watch mode, except the files of the round
+	pushes   int               // Pushes waiting for their insert
+}
+
+// activeEntry is a file in progress; a pushed source may be inserted by
+// several requests at once
+type activeEntry struct {
+	ActiveFile
+	refs int
+}
+
+// begin records that a file or pushed source is being inserted
+func (ls *liveStatus) begin(name string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.active == nil {
+		ls.active = make(map[string]*activeEntry)
+	}
+	entry := ls.active[name]
+	if entry == nil {
+		entry = &activeEntry{ActiveFile: ActiveFile{Name: name, Started: time.Now()}}
+		ls.active[name] = entry
+	}
+	entry.refs++
+}
+
+// end records that a file or pushed source is done
+func (ls *liveStatus) end(name string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if entry := ls.active[name]; entry != nil {
+		if entry.refs--; entry.refs <= 0 {
+			delete(ls.active, name)
+		}
+	}
+}
+
+// inserted counts readings of a file or pushed source as inserted
+func (ls *liveStatus) inserted(name string, count int) {
+	now := time.Now().Unix()
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.readings += int64(count)
+	bucket := now % rateWindow
+	if ls.seconds[bucket] != now {
+		ls.seconds[bucket], ls.counts[bucket] = now, 0
+	}
+	ls.counts[bucket] += int64(count)
+	if entry := ls.active[name]; entry != nil {
+		entry.Readings += int64(count)
+	}
+}
+
+// setRound records the job queue of an import round, nil once it is done
+func (ls *liveStatus) setRound(jobs chan FileJob) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.round = jobs
+}
+
+// setQueue records the files watch mode holds back
+func (ls *liveStatus) setQueue(queued, settling, retrying int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.queue = StatusQueue{Waiting: queued, Settling: settling, Retrying: retrying}
+}
+
+// waitPush counts a push waiting for its insert until the returned function
+// is called
+func (ls *liveStatus) waitPush() func() {
+	ls.mu.Lock()
+	ls.pushes++
+	ls.mu.Unlock()
+	return func() {
+		ls.mu.Lock()
+		ls.pushes--
+		ls.mu.Unlock()
+	}
+}
+
+// Status returns what the scanner is doing: the files in progress, the
+// insert rate and the work waiting
+func (cs *CSVScanner) Status() Status {
+	ls := &cs.live
+	now := time.Now()
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	status := Status{
+		Command:  cs.runCommand,
+		PID:      os.Getpid(),
+		Started:  ls.started,
+		Workers:  cs.workerCount,
+		Paused:   cs.pause.paused(),
+		Readings: ls.readings,
+		Files:    make([]ActiveFile, 0, len(ls.active)),
+		Queue:    ls.queue,
+	}
+	status.Queue.Waiting += len(ls.round) + ls.pushes
+
+	// The current second is still filling, so the rate covers the ones before
+	var recent int64
+	for i := range ls.seconds {
+		if age := now.Unix() - ls.seconds[i]; age > 0 && age <= rateWindow {
+			recent += ls.counts[i]
+		}
+	}
+	if window := min(now.Sub(ls.started).Seconds(), rateWindow); window >= 1 {
+		status.Rate = float64(recent) / window
+	}
+
+	for _, entry := range ls.active {
+		status.Files = append(status.Files, entry.ActiveFile)
+	}
+	sort.Slice(status.Files, func(i, j int) bool {
+		if !status.Files[i].Started.Equal(status.Files[j].Started) {
+			return status.Files[i].Started.Before(status.Files[j].Started)
+		}
+		return status.Files[i].Name < status.Files[j].Name
+	})
+	return status
+}
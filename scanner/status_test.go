@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusReportsFilesAndQueue(t *testing.T) {
+	cs := NewCSVScanner(nil)
+	cs.SetRun("watch", nil)
+	cs.live.started = time.Now().Add(-2 * time.Minute)
+
+	cs.live.begin("a.csv")
+	cs.live.begin("b.csv")
+	cs.live.inserted("a.csv", 600)
+	// Inserted a second ago rather than in the second still filling
+	cs.live.seconds = [rateWindow]int64{}
+	last := time.Now().Unix() - 1
+	bucket := last % rateWindow
+	cs.live.seconds[bucket], cs.live.counts[bucket] = last, 600
+	cs.live.end("b.csv")
+
+	round := make(chan FileJob, 4)
+	round <- FileJob{FileName: "c.csv"}
+	round <- FileJob{FileName: "d.csv"}
+	cs.live.setRound(round)
+	cs.live.setQueue(1, 2, 1)
+	waited := cs.live.waitPush()
+
+	status := cs.Status()
+	if status.Command != "watch" || status.Readings != 600 {
+		t.Errorf("status = %+v, want watch with 600 readings", status)
+	}
+	if status.Rate != 10 {
+		t.Errorf("rate = %v, want 600 readings over a minute", status.Rate)
+	}
+	if len(status.Files) != 1 || status.Files[0].Name != "a.csv" || status.Files[0].Readings != 600 {
+		t.Errorf("files = %+v, want a.csv with 600 readings", status.Files)
+	}
+	// Two files of the round, one queued behind it and one push
+	want := StatusQueue{Waiting: 4, Settling: 2, Retrying: 1}
+	if status.Queue != want || status.Queue.Depth() != 7 {
+		t.Errorf("queue = %+v, want %+v", status.Queue, want)
+	}
+
+	waited()
+	cs.live.setRound(nil)
+	cs.live.end("a.csv")
+	if status := cs.Status(); len(status.Files) != 0 || status.Queue.Waiting != 1 {
+		t.Errorf("after the round: %+v, want no files and the queued one waiting", status)
+	}
+}
+
+func TestPausedWorkerTakesNoFiles(t *testing.T) {
+	cs := NewCSVScanner(nil)
+	cs.Pause()
+
+	jobs := make(chan FileJob, 1)
+	jobs <- FileJob{FileName: "a.csv"}
+	close(jobs)
+	results := make(chan ProcessResult, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go cs.worker(ctx, jobs, results, &wg)
+
+	time.Sleep(50 * time.Millisecond)
+	if len(jobs) != 1 {
+		t.Fatal("a paused worker took a file")
+	}
+	if cs.Pause() || !cs.Status().Paused {
+		t.Error("Pause of a paused scanner changed it, or its status is not paused")
+	}
+
+	// Stopping while paused hands back the waiting files as cancelled
+	cancel()
+	wg.Wait()
+	if result := <-results; result.FileName != "a.csv" || !result.Cancelled {
+		t.Errorf("result = %+v, want a.csv cancelled", result)
+	}
+	if !cs.Resume() || cs.Resume() || cs.Paused() {
+		t.Error("Resume did not resume the scanner exactly once")
+	}
+}
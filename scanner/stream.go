@@ -0,0 +1,311 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"sensor_data_import/display"
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// Payload formats of broker messages
+const (
+	PayloadAuto = "auto" // JSON when the payload starts with { or [, CSV otherwise
+	PayloadJSON = "json" // An object or array of objects with the json_fields
+	PayloadCSV  = "csv"  // timestamp,sensor_name,value lines
+)
+
+// maxStreamBacklog is how many batches of readings are held by default while
+// inserts fail
+const maxStreamBacklog = 100
+
+// streamMessage is a message received from a broker
+type streamMessage struct {
+	name    string // Topic, matched by column mappings and timezone overrides
+	source  string // Recorded as the source of the readings, e.g. mqtt://broker/topic
+	payload []byte
+	ack     func() error // Acknowledges the message to the broker; nil when not needed
+}
+
+// StreamStats counts what a stream ingest did
+type StreamStats struct {
+	Messages int
+	Readings int
+	Errors   int // Rows that could not be parsed
+	Skipped  int // Existing readings kept, such as redelivered messages
+	Flushes  int
+}
+
+// streamIngest buffers the readings parsed from messages until a batch is
+// full or the flush interval has passed. Messages are acknowledged only after
+// their readings are committed, to the database or the queue file, so a
+// crash redelivers them.
+type streamIngest struct {
+	cs            *CSVScanner
+	format        string
+	queue         *streamQueue
+	flushInterval time.Duration
+	retryAt       time.Time // Before it, queued readings wait after a failed insert
+	stats         StreamStats
+	pending       []models.SensorData
+	acks          []func() error
+	lastLogged    time.Time
+}
+
+// ingestStream inserts the readings of messages until ctx is cancelled or
+// messages is closed, then flushes what is buffered. Brokers redeliver
+// messages, so the error insert policy is applied as skip.
+func (cs *CSVScanner) ingestStream(ctx context.Context, messages <-chan streamMessage, format string, flushInterval time.Duration, queue *streamQueue) (StreamStats, error) {
+	if err := cs.beginStream(); err != nil {
+		return StreamStats{}, err
+	}
+	defer cs.endScan()
+
+	stream := &streamIngest{cs: cs, format: format, queue: queue, flushInterval: flushInterval, lastLogged: time.Now()}
+	if queue.queued > 0 {
+		if err := stream.flush(ctx); err != nil {
+			logger.Warnf("Failed to insert %d queued readings, retrying: %v\n", queue.queued, err)
+		}
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		// A full queue file takes no messages until the database catches up
+		incoming := messages
+		if stream.full() {
+			incoming = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			// Commit what was received; the inserts use a fresh context
+			err := stream.stop(stream.flush(context.Background()))
+			stream.logProgress()
+			return stream.stats, err
+
+		case message, ok := <-incoming:
+			if !ok {
+				err := stream.stop(stream.flush(context.Background()))
+				stream.logProgress()
+				return stream.stats, err
+			}
+			stream.add(message)
+			if len(stream.pending) < cs.batchSize {
+				continue
+			}
+			if err := stream.flush(ctx); err != nil {
+				if err := stream.backlogged(err); err != nil {
+					return stream.stats, err
+				}
+			}
+
+		case <-ticker.C:
+			if err := stream.flush(ctx); err != nil {
+				if err := stream.backlogged(err); err != nil {
+					return stream.stats, err
+				}
+			}
+			if time.Since(stream.lastLogged) >= time.Minute {
+				stream.logProgress()
+			}
+		}
+	}
+}
+
+// beginStream prepares the scanner for readings that senders may deliver
+// again: the error insert policy is applied as skip, and checkpoints are off
+// since every commit is acknowledged and there is nothing to resume
+func (cs *CSVScanner) beginStream() error {
+	if cs.insertPolicy == InsertPolicyError && cs.upsertWindow == 0 {
+		cs.insertPolicy = InsertPolicySkip
+	}
+	cs.checkpoints = false
+	return cs.beginScan()
+}
+
+// add parses a message and buffers its readings
+func (s *streamIngest) add(message streamMessage) {
+	s.stats.Messages++
+	var result ProcessResult
+	records, _, err := s.cs.payloadRecords(message.payload, s.format)
+	if err != nil {
+		result.countError(ErrorMalformed)
+		logger.Warnf("Message on %s: %v\n", message.name, err)
+	} else {
+		data := s.cs.parseRecords(records, message.name, &result)
+		if s.cs.precedence != nil {
+			source := message.source
+			for i := range data {
+				data[i].SourceFile = &source
+			}
+		}
+		s.pending = append(s.pending, data...)
+	}
+	if result.Error != nil {
+		result.countError(ErrorMalformed)
+		logger.Warnf("Message on %s: %v\n", message.name, result.Error)
+	}
+	s.stats.Errors += result.ErrorCount
+	if message.ack != nil {
+		s.acks = append(s.acks, message.ack)
+	}
+}
+
+// flush inserts the buffered readings and acknowledges their messages, or
+// with a queue file hands them to flushQueue
+func (s *streamIngest) flush(ctx context.Context) error {
+	if s.queue.disk != nil {
+		return s.flushQueue(ctx)
+	}
+	if len(s.pending) > 0 {
+		if err := s.insert(ctx, s.pending); err != nil {
+			return err
+		}
+		s.pending = s.pending[:0]
+	}
+	s.acknowledge()
+	return nil
+}
+
+// insert inserts a batch of received readings
+func (s *streamIngest) insert(ctx context.Context, data []models.SensorData) error {
+	if s.cs.upsertWindow > 0 {
+		s.cs.upsertCutoff = time.Now().Add(-s.cs.upsertWindow)
+	}
+	result := ProcessResult{FileName: "stream"}
+	if err := s.cs.batchInsertSensorData(ctx, data, &result, nil); err != nil {
+		return err
+	}
+	s.stats.Readings += len(data) - result.SkippedCount - result.FailedCount
+	s.stats.Skipped += result.SkippedCount
+	s.stats.Flushes++
+	logger.Debugf("Inserted %d readings from the stream (%d existing skipped)\n", len(data), result.SkippedCount)
+	return nil
+}
+
+// acknowledge acknowledges the messages whose readings were committed
+func (s *streamIngest) acknowledge() {
+	var failed int
+	var ackErr error
+	for _, ack := range s.acks {
+		if err := ack(); err != nil {
+			failed++
+			ackErr = err
+		}
+	}
+	if failed > 0 {
+		// The broker redelivers the messages, and their readings are skipped
+		logger.Warnf("Failed to acknowledge %d message(s), expecting redelivery: %v\n", failed, ackErr)
+	}
+	s.acks = s.acks[:0]
+}
+
+// backlogged keeps the readings of a failed flush for the next attempt. The
+// in-memory queue gives up once it holds the queue size; readings in the
+// queue file wait however long the database is away.
+func (s *streamIngest) backlogged(err error) error {
+	if s.queue.disk != nil && len(s.pending) == 0 {
+		if s.full() {
+			logger.Warnf("Queue %s is full with %d readings, taking no messages until they are inserted: %v\n", s.queue.disk.path, s.queue.queued, err)
+		} else {
+			logger.Warnf("Failed to insert %d queued readings, retrying: %v\n", s.queue.queued, err)
+		}
+		return nil
+	}
+	if len(s.pending) >= s.queue.size {
+		return fmt.Errorf("%d readings could not be inserted: %w", len(s.pending), err)
+	}
+	logger.Warnf("Failed to insert %d readings, retrying: %v\n", len(s.pending), err)
+	return nil
+}
+
+// stop returns the error of the last flush, unless it only left readings in
+// the queue file for the next ingest
+func (s *streamIngest) stop(err error) error {
+	if err != nil && s.queue.disk != nil && len(s.pending) == 0 {
+		logger.Warnf("Failed to insert queued readings: %v\n", err)
+		return nil
+	}
+	return err
+}
+
+// logProgress logs the running totals
+func (s *streamIngest) logProgress() {
+	s.lastLogged = time.Now()
+	logger.Printf("Stream: %s messages, %s readings inserted, %s existing skipped, %s parsing errors\n",
+		display.Number(s.stats.Messages), display.Number(s.stats.Readings),
+		display.Number(s.stats.Skipped), display.Number(s.stats.Errors))
+}
+
+// streamHeader is put in front of payload records without a header row, so
+// the row parser does not take the first reading for one
+var streamHeader = []string{"timestamp", "sensor_name", "value"}
+
+// payloadRecords converts a message payload into timestamp, sensor_name,
+// value records for the row parser. It reports whether streamHeader was put
+// in front, which shifts the row numbers by one.
+func (cs *CSVScanner) payloadRecords(payload []byte, format string) ([][]string, bool, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 {
+		return nil, false, fmt.Errorf("empty payload")
+	}
+	if format == PayloadAuto || format == "" {
+		format = PayloadCSV
+		if payload[0] == '{' || payload[0] == '[' {
+			format = PayloadJSON
+		}
+	}
+
+	if format == PayloadCSV {
+		reader := csv.NewReader(bytes.NewReader(payload))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, false, fmt.Errorf("not valid CSV: %w", err)
+		}
+		for _, cell := range records[0] {
+			if cs.headers.isKnownHeader(cell) {
+				return records, false, nil
+			}
+		}
+		return append([][]string{streamHeader}, records...), true, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var objects []map[string]interface{}
+	if payload[0] == '[' {
+		if err := decoder.Decode(&objects); err != nil {
+			return nil, false, fmt.Errorf("not a JSON array of objects: %w", err)
+		}
+	} else {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			return nil, false, fmt.Errorf("not a valid JSON object: %w", err)
+		}
+		objects = append(objects, object)
+	}
+
+	records := [][]string{streamHeader}
+	for _, object := range objects {
+		records = append(records, []string{
+			jsonFieldString(object[cs.jsonFields.Timestamp]),
+			jsonFieldString(object[cs.jsonFields.SensorName]),
+			jsonFieldString(object[cs.jsonFields.Value]),
+		})
+	}
+	return records, true, nil
+}
+
+// streamSource returns a URL naming a broker topic, with credentials removed
+func streamSource(scheme, host, topic string) string {
+	return scheme + "://" + host + "/" + strings.TrimPrefix(topic, "/")
+}
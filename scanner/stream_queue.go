@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/display"
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// streamQueue holds the readings received by a stream ingest until they are
+// inserted. With a queue file they are kept in an embedded SQLite database
+// like the spool, and their messages are acknowledged once queued;
+// otherwise they stay in memory and unacknowledged.
+type streamQueue struct {
+	disk   *readingSpool // nil for the in-memory queue
+	size   int           // Readings held at most while inserts fail
+	queued int           // Readings waiting in the queue file
+}
+
+// openStreamQueue opens the queue of the ingest settings. Readings an
+// earlier ingest left in the queue file are inserted first.
+func (cs *CSVScanner) openStreamQueue(cfg config.IngestConfig) (*streamQueue, error) {
+	queue := &streamQueue{size: cfg.QueueSize}
+	if queue.size == 0 {
+		queue.size = maxStreamBacklog * cs.batchSize
+	}
+	if cfg.QueueFile == "" {
+		return queue, nil
+	}
+
+	disk, err := openSpool(cfg.QueueFile)
+	if err != nil {
+		return nil, err
+	}
+	count, err := disk.count()
+	if err != nil {
+		disk.close()
+		return nil, fmt.Errorf("failed to read queue %s: %w", cfg.QueueFile, err)
+	}
+	queue.disk, queue.queued = disk, int(count)
+	if count > 0 {
+		logger.Printf("%s readings left in queue %s are inserted first\n", display.Number(int(count)), cfg.QueueFile)
+	}
+	logger.Printf("Received readings are queued in %s until they are inserted\n", cfg.QueueFile)
+	return queue, nil
+}
+
+// close closes the queue file, reporting the readings still waiting in it
+func (q *streamQueue) close() {
+	if q.disk == nil {
+		return
+	}
+	if q.queued > 0 {
+		logger.Warnf("%d readings remain queued in %s; the next ingest inserts them\n", q.queued, q.disk.path)
+	}
+	if err := q.disk.close(); err != nil {
+		logger.Warnf("Failed to close queue %s: %v\n", q.disk.path, err)
+	}
+}
+
+// full reports whether the queue file, with the readings buffered for it,
+// holds as many readings as it may, so the ingest takes no messages until
+// inserts catch up
+func (s *streamIngest) full() bool {
+	return s.queue.disk != nil && s.queue.queued+len(s.pending) >= s.queue.size
+}
+
+// flushQueue moves the buffered readings to the queue file, acknowledges
+// their messages and inserts the queued readings, oldest first. Readings
+// that fail to insert stay queued, and inserts are tried again once the
+// flush interval has passed.
+func (s *streamIngest) flushQueue(ctx context.Context) error {
+	q := s.queue
+	if len(s.pending) > 0 {
+		if err := q.disk.add("stream", s.pending); err != nil {
+			return err
+		}
+		q.queued += len(s.pending)
+		s.pending = s.pending[:0]
+	}
+	s.acknowledge()
+	if time.Now().Before(s.retryAt) {
+		return nil
+	}
+
+	for q.queued > 0 {
+		var rows []spooledReading
+		if err := q.disk.db.Order("id").Limit(s.cs.batchSize).Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to read queue %s: %w", q.disk.path, err)
+		}
+		if len(rows) == 0 {
+			q.queued = 0
+			break
+		}
+		data := make([]models.SensorData, len(rows))
+		for i, row := range rows {
+			data[i] = row.reading()
+		}
+		if err := s.insert(ctx, data); err != nil {
+			s.retryAt = time.Now().Add(s.flushInterval)
+			return err
+		}
+		if err := q.disk.db.Where("id <= ?", rows[len(rows)-1].ID).Delete(&spooledReading{}).Error; err != nil {
+			// The readings would be inserted again and skipped as existing
+			return fmt.Errorf("failed to remove inserted readings from queue %s: %w", q.disk.path, err)
+		}
+		q.queued -= len(rows)
+	}
+	s.retryAt = time.Time{}
+	return nil
+}
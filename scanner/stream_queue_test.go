@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+func TestStreamQueueKeepsReadingsThroughAnOutage(t *testing.T) {
+	// The database fails every insert
+	db := openTestDB(t)
+	cs := faultyScanner(t, db, "error=1")
+	if err := cs.Configure(config.ScannerConfig{InsertPolicy: InsertPolicySkip}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	ingest := config.IngestConfig{QueueFile: filepath.Join(t.TempDir(), "queue.db"), QueueSize: 4}
+
+	var acked atomic.Int32
+	message := func(minute int) streamMessage {
+		payload := fmt.Appendf(nil, "2025-09-01 12:%02d:00,temp_01,21.5\n2025-09-01 12:%02d:30,temp_01,21.6", minute, minute)
+		return streamMessage{name: "plant/readings", payload: payload, ack: func() error { acked.Add(1); return nil }}
+	}
+	messages := make(chan streamMessage, 3)
+	for minute := 0; minute < 3; minute++ {
+		messages <- message(minute)
+	}
+
+	queue, err := cs.openStreamQueue(ingest)
+	if err != nil {
+		t.Fatalf("openStreamQueue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := cs.ingestStream(ctx, messages, PayloadCSV, 20*time.Millisecond, queue)
+		done <- err
+	}()
+
+	// Two messages fill the queue and are acknowledged; the third waits
+	for start := time.Now(); acked.Load() < 2 && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ingestStream during the outage: %v", err)
+	}
+	queue.close()
+	if acked.Load() != 2 || len(messages) != 1 {
+		t.Fatalf("acknowledged %d messages with %d waiting, want 2 queued and 1 held back", acked.Load(), len(messages))
+	}
+
+	// Once the database is back, the next ingest inserts the queued readings
+	// before the new messages
+	cs.SetFaultInjector(nil)
+	close(messages)
+	queue, err = cs.openStreamQueue(ingest)
+	if err != nil {
+		t.Fatalf("reopen queue: %v", err)
+	}
+	defer queue.close()
+	if queue.queued != 4 {
+		t.Fatalf("reopened queue holds %d readings, want 4", queue.queued)
+	}
+	stats, err := cs.ingestStream(context.Background(), messages, PayloadCSV, 20*time.Millisecond, queue)
+	if err != nil {
+		t.Fatalf("ingestStream after the outage: %v", err)
+	}
+	if count := countRows(t, db, &models.SensorData{}); count != 6 || stats.Readings != 6 || queue.queued != 0 || acked.Load() != 3 {
+		t.Errorf("stored %d readings, stats %+v, %d queued, %d acknowledged; want all 6 stored from an empty queue", count, stats, queue.queued, acked.Load())
+	}
+	if remaining, err := queue.disk.count(); err != nil || remaining != 0 {
+		t.Errorf("queue file holds %d readings (%v), want none", remaining, err)
+	}
+}
+
+func TestInMemoryStreamQueueGivesUpWhenFull(t *testing.T) {
+	cs := faultyScanner(t, openTestDB(t), "error=1")
+	if err := cs.Configure(config.ScannerConfig{InsertPolicy: InsertPolicySkip}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+
+	queue, err := cs.openStreamQueue(config.IngestConfig{QueueSize: 2})
+	if err != nil {
+		t.Fatalf("openStreamQueue: %v", err)
+	}
+	stream := &streamIngest{cs: cs, format: PayloadCSV, queue: queue}
+	stream.add(streamMessage{name: "plant/readings", payload: []byte("2025-09-01 12:00:00,temp_01,21.5")})
+	if err := stream.backlogged(stream.flush(context.Background())); err != nil {
+		t.Fatalf("one reading below the queue size: %v", err)
+	}
+	stream.add(streamMessage{name: "plant/readings", payload: []byte("2025-09-01 12:01:00,temp_01,21.6")})
+	if err := stream.backlogged(stream.flush(context.Background())); err == nil {
+		t.Error("a full in-memory queue kept retrying")
+	}
+}
@@ -0,0 +1,299 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+)
+
+// Fields of pre-aggregated files, which summarize each interval of a sensor
+// instead of listing its readings
+const (
+	FieldIntervalStart = "interval_start"
+	FieldIntervalEnd   = "interval_end"
+	FieldInterval      = "interval"
+	FieldMin           = "min"
+	FieldMax           = "max"
+	FieldAvg           = "avg"
+	FieldCount         = "count"
+	FieldP50           = "p50"
+	FieldP95           = "p95"
+	FieldP99           = "p99"
+)
+
+// summaryColumnSynonyms lists header names recognized for the fields of
+// pre-aggregated files. The interval start also matches the timestamp names.
+var summaryColumnSynonyms = map[string][]string{
+	FieldIntervalStart: {"interval_start", "start", "start_time", "period_start", "bucket_start"},
+	FieldIntervalEnd:   {"interval_end", "end", "end_time", "period_end", "bucket_end"},
+	FieldInterval:      {"interval", "interval_seconds", "interval_length", "duration", "period"},
+	FieldMin:           {"min", "minimum", "min_value"},
+	FieldMax:           {"max", "maximum", "max_value"},
+	FieldAvg:           {"avg", "average", "mean", "avg_value"},
+	FieldCount:         {"count", "samples", "reading_count"},
+	FieldP50:           {"p50", "median", "p50_value"},
+	FieldP95:           {"p95", "p95_value"},
+	FieldP99:           {"p99", "p99_value"},
+}
+
+// summaryFields maps each normalized synonym to its field
+var summaryFields = func() map[string]string {
+	fields := make(map[string]string)
+	for field, names := range summaryColumnSynonyms {
+		for _, name := range names {
+			fields[name] = field
+		}
+	}
+	return fields
+}()
+
+// summaryColumns holds the zero-based column index of each field a
+// pre-aggregated file has
+type summaryColumns map[string]int
+
+// minColumns returns the number of columns a row needs to contain every field
+func (sc summaryColumns) minColumns() int {
+	highest := 0
+	for _, index := range sc {
+		highest = max(highest, index)
+	}
+	return highest + 1
+}
+
+// cell returns the trimmed text of a field, and false when the file lacks it
+func (sc summaryColumns) cell(record []string, field string) (string, bool) {
+	index, ok := sc[field]
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(record[index]), true
+}
+
+// summaryColumnsOf locates the fields of a pre-aggregated file in a header
+// row. It reports false for headers without min, max and avg columns, and an
+// error for those lacking the interval start, sensor or interval length.
+func (cs *CSVScanner) summaryColumnsOf(header []string, fileSensor bool) (summaryColumns, bool, error) {
+	columns := summaryColumns{}
+	for i, cell := range header {
+		name := normalizeHeader(cell)
+		field, ok := summaryFields[name]
+		if !ok {
+			switch cs.headers.synonyms[name] {
+			case FieldTimestamp:
+				field = FieldIntervalStart
+			case FieldSensorName:
+				field = FieldSensorName
+			default:
+				continue
+			}
+		}
+		// The first matching column wins
+		if _, seen := columns[field]; !seen {
+			columns[field] = i
+		}
+	}
+
+	for _, field := range []string{FieldMin, FieldMax, FieldAvg} {
+		if _, ok := columns[field]; !ok {
+			return nil, false, nil
+		}
+	}
+	if _, ok := columns[FieldIntervalStart]; !ok {
+		return nil, true, fmt.Errorf("no interval start column")
+	}
+	if _, ok := columns[FieldSensorName]; !ok && !fileSensor {
+		return nil, true, fmt.Errorf("no sensor column")
+	}
+	_, hasInterval := columns[FieldInterval]
+	if _, hasEnd := columns[FieldIntervalEnd]; !hasInterval && !hasEnd {
+		return nil, true, fmt.Errorf("no interval length or interval end column")
+	}
+	return columns, true, nil
+}
+
+// parseSummaries parses the rows of a pre-aggregated file into fi.summaries.
+// Such files are recognized by min, max and avg columns in their header row;
+// for other files it reports false and leaves them to parseRecords.
+func (cs *CSVScanner) parseSummaries(fi *fileImport, records [][]string, result *ProcessResult) bool {
+	fileName := fi.job.FileName
+	if cs.wideLayout || len(records) == 0 {
+		return false
+	}
+	if _, ok := cs.columnMappingFor(fileName); ok {
+		return false
+	}
+	columns, ok, err := cs.summaryColumnsOf(records[0], result.fileSensor != "")
+	if !ok {
+		return false
+	}
+	if err != nil {
+		result.Error = fmt.Errorf("pre-aggregated file: %w", err)
+		return true
+	}
+	result.rejectHeader = records[0]
+	logger.Debugf("%s holds pre-aggregated intervals\n", fileName)
+
+	for i := 1; i < len(records); i++ {
+		// Stop parsing a file with too many errors to be worth finishing
+		if result.errorLimit.exceeded(result, false) {
+			break
+		}
+		result.rowsParsed++
+
+		record := records[i]
+		row := i + 1 + result.PreambleLines + result.rowOffset
+
+		// Skip empty rows
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+		if cs.skipFooter(record, row, fileName, result) {
+			continue
+		}
+		if len(record) < columns.minColumns() {
+			result.reject(fileName, row, record, ErrorShortRow, fmt.Sprintf("insufficient columns (expected %d, got %d)",
+				columns.minColumns(), len(record)))
+			continue
+		}
+
+		if summary, ok := cs.parseSummary(record, columns, row, fileName, result); ok {
+			fi.summaries = append(fi.summaries, summary)
+			result.RecordCount++
+			result.SummaryCount++
+		}
+	}
+	return true
+}
+
+// parseSummary parses one interval of a pre-aggregated file. Its values go
+// through the value transform and range checks of the sensor; validation
+// rules apply to readings only.
+func (cs *CSVScanner) parseSummary(record []string, columns summaryColumns, row int, fileName string, result *ProcessResult) (models.SensorAggregatePart, bool) {
+	startCell, _ := columns.cell(record, FieldIntervalStart)
+	start, ok := cs.parseTimestamp(startCell, record, row, fileName, result)
+	if !ok {
+		return models.SensorAggregatePart{}, false
+	}
+
+	// The interval length is given, or follows from the interval end
+	var interval time.Duration
+	if cell, ok := columns.cell(record, FieldInterval); ok {
+		var err error
+		if interval, err = parseIntervalLength(cell); err != nil {
+			result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("invalid interval %q: %v", cell, err))
+			return models.SensorAggregatePart{}, false
+		}
+	} else {
+		endCell, _ := columns.cell(record, FieldIntervalEnd)
+		end, ok := cs.parseTimestamp(endCell, record, row, fileName, result)
+		if !ok {
+			return models.SensorAggregatePart{}, false
+		}
+		if interval = end.Sub(start); interval < time.Second || interval%time.Second != 0 {
+			result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("invalid interval from %s to %s", startCell, endCell))
+			return models.SensorAggregatePart{}, false
+		}
+	}
+
+	if !cs.batchAcceptWindow(result).Contains(start) {
+		result.DroppedCount++
+		return models.SensorAggregatePart{}, false
+	}
+
+	sensorCell, _ := columns.cell(record, FieldSensorName)
+	sensorName, ok := cs.resolveSensor(sensorCell, record, row, fileName, result)
+	if !ok {
+		return models.SensorAggregatePart{}, false
+	}
+
+	summary := models.SensorAggregatePart{
+		BucketStart:     start,
+		SensorName:      sensorName,
+		IntervalSeconds: int(interval / time.Second),
+	}
+	parse := func(field, cell string) (float64, bool) {
+		value, err := cs.parseSummaryValue(sensorName, cell, result)
+		if err != nil {
+			result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("invalid %s for %s: %s: %v", field, sensorName, cell, err))
+			return 0, false
+		}
+		return value, true
+	}
+	required := []struct {
+		field  string
+		target *float64
+	}{{FieldMin, &summary.MinValue}, {FieldMax, &summary.MaxValue}, {FieldAvg, &summary.AvgValue}}
+	for _, r := range required {
+		cell, _ := columns.cell(record, r.field)
+		if *r.target, ok = parse(r.field, cell); !ok {
+			return models.SensorAggregatePart{}, false
+		}
+	}
+	// Percentiles are optional and may be empty
+	optional := []struct {
+		field  string
+		target **float64
+	}{{FieldP50, &summary.P50Value}, {FieldP95, &summary.P95Value}, {FieldP99, &summary.P99Value}}
+	for _, o := range optional {
+		cell, ok := columns.cell(record, o.field)
+		if !ok || cell == "" {
+			continue
+		}
+		value, ok := parse(o.field, cell)
+		if !ok {
+			return models.SensorAggregatePart{}, false
+		}
+		*o.target = &value
+	}
+	if summary.MinValue > summary.MaxValue || summary.AvgValue < summary.MinValue || summary.AvgValue > summary.MaxValue {
+		result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("inconsistent interval of %s: avg %v is not between min %v and max %v",
+			sensorName, summary.AvgValue, summary.MinValue, summary.MaxValue))
+		return models.SensorAggregatePart{}, false
+	}
+
+	if cell, ok := columns.cell(record, FieldCount); ok && cell != "" {
+		count, err := strconv.Atoi(cell)
+		if err != nil || count < 0 {
+			result.reject(fileName, row, record, ErrorBadValue, fmt.Sprintf("invalid count for %s: %s", sensorName, cell))
+			return models.SensorAggregatePart{}, false
+		}
+		summary.ReadingCount = count
+	}
+	return summary, true
+}
+
+// parseSummaryValue parses a min, max, avg or percentile cell like the value
+// of a reading
+func (cs *CSVScanner) parseSummaryValue(sensorName, cell string, result *ProcessResult) (float64, error) {
+	number, ok := result.numbers.normalize(cell)
+	value, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("not a number")
+	}
+	if value, err = cs.transforms.apply(sensorName, value); err != nil {
+		return 0, err
+	}
+	if err := cs.valueChecks.check(sensorName, value); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// parseIntervalLength parses an interval length given in seconds or as a
+// duration such as 1h, which must be a whole number of seconds
+func parseIntervalLength(text string) (time.Duration, error) {
+	var interval time.Duration
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		interval = time.Duration(seconds * float64(time.Second))
+	} else if interval, err = time.ParseDuration(text); err != nil {
+		return 0, fmt.Errorf("expected seconds or a duration such as 1h")
+	}
+	if interval < time.Second || interval%time.Second != 0 {
+		return 0, fmt.Errorf("not a whole number of seconds")
+	}
+	return interval, nil
+}
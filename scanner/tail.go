@@ -0,0 +1,310 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// DefaultTailInterval is how often tail mode checks its files for appended lines
+const DefaultTailInterval = time.Second
+
+// tailHeadBytes is how much of the start of a tailed file is hashed to
+// notice that it was replaced by a new file
+const tailHeadBytes = 1024
+
+// tailMaxChunk caps the bytes read from one file per check, so a large file
+// seen for the first time is imported in several steps
+const tailMaxChunk = 64 << 20
+
+// tailState is how far a tailed file has been imported
+type tailState struct {
+	key      string // Absolute path, as stored in the tail offset table
+	offset   int64  // Bytes imported, always at the end of a line
+	headSize int    // Bytes at the start of the file covered by headHash
+	headHash string
+	pending  int64 // Offset after the lines being imported
+}
+
+// Tail follows a growing file, or the data files of a directory, and imports
+// the complete lines appended to them until ctx is cancelled. How far each
+// file was imported is stored in the tail offset table, so a restart continues
+// where the last run stopped. A file that shrank was truncated and one whose
+// first bytes changed was replaced, as by log rotation; both are read again
+// from the start. Appended CSV lines are parsed with the header row of the
+// file in front of them.
+func (cs *CSVScanner) Tail(ctx context.Context, target string, interval time.Duration) error {
+	target = scanRoot(target)
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", target, err)
+	}
+	if interval <= 0 {
+		interval = DefaultTailInterval
+	}
+	if !cs.db.Migrator().HasTable(&models.TailOffset{}) {
+		return fmt.Errorf("tail offset table %s not found; run migrate first", models.TailOffset{}.TableName())
+	}
+
+	if err := cs.beginScan(); err != nil {
+		return err
+	}
+	defer cs.endScan()
+
+	logger.Printf("Following %s for appended lines (checking every %v)\n", target, interval)
+	states := make(map[string]*tailState)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		more := cs.tailOnce(ctx, target, info.IsDir(), states)
+
+		// Keep reading without waiting while a file has more than one chunk left
+		if more && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			logger.Println("Stopping tail")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// tailOnce imports the lines appended to the followed files since the last
+// check. It reports whether a file has more lines than were read.
+func (cs *CSVScanner) tailOnce(ctx context.Context, target string, isDir bool, states map[string]*tailState) bool {
+	files := []FileJob{{FilePath: target, FileName: filepath.Base(target), Dir: "."}}
+	if isDir {
+		var err error
+		if files, err = cs.tailFiles(target); err != nil {
+			logger.Warnf("Failed to list %s: %v\n", target, err)
+			return false
+		}
+	}
+
+	var jobs []FileJob
+	more := false
+	for _, file := range files {
+		job, remaining, err := cs.tailJob(file, states)
+		if err != nil {
+			logger.Warnf("Failed to read %s: %v\n", file.FileName, err)
+			continue
+		}
+		more = more || remaining
+		if job != nil {
+			jobs = append(jobs, *job)
+		}
+	}
+	if len(jobs) == 0 {
+		return more
+	}
+
+	for _, result := range cs.processFilesParallel(ctx, jobs, 0) {
+		state := states[result.FilePath]
+		if result.Cancelled || result.Error != nil {
+			// The lines are read again at the next check
+			if result.Error != nil {
+				logger.Errorf("Failed to import the lines appended to %s: %v\n", result.FileName, result.Error)
+			}
+			more = false
+			continue
+		}
+		if err := cs.advanceTail(state); err != nil {
+			logger.Warnf("Failed to save the tail offset of %s: %v\n", result.FileName, err)
+		}
+	}
+	return more
+}
+
+// tailFiles lists the uncompressed data files of a followed directory
+func (cs *CSVScanner) tailFiles(directoryPath string) ([]FileJob, error) {
+	var files []FileJob
+	err := filepath.WalkDir(directoryPath, func(entryPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entryPath != directoryPath && !cs.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := entry.Name()
+		if isZipFile(name) || strings.EqualFold(filepath.Ext(name), ".gz") {
+			return nil
+		}
+		jobs, err := jobsForFile(directoryPath, entryPath)
+		files = append(files, cs.files.filter(jobs)...)
+		return err
+	})
+	return files, err
+}
+
+// tailJob returns a job importing the complete lines appended to a file since
+// the last check, or nil when there are none. It reports whether more lines
+// are left than one chunk holds.
+func (cs *CSVScanner) tailJob(file FileJob, states map[string]*tailState) (*FileJob, bool, error) {
+	state, err := cs.tailState(file.FilePath, states)
+	if err != nil {
+		return nil, false, err
+	}
+
+	f, err := os.Open(file.FilePath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	size := info.Size()
+
+	// Start again on a truncated or replaced file
+	if state.offset > size {
+		logger.Printf("%s was truncated, reading it from the start\n", file.FileName)
+		state.offset, state.headSize, state.headHash = 0, 0, ""
+	} else if state.offset > 0 {
+		hash, err := headHash(f, state.headSize)
+		if err != nil {
+			return nil, false, err
+		}
+		if hash != state.headHash {
+			logger.Printf("%s was replaced, reading it from the start\n", file.FileName)
+			state.offset, state.headSize, state.headHash = 0, 0, ""
+		}
+	}
+	if state.offset == size {
+		return nil, false, nil
+	}
+
+	// Read up to the last complete line
+	length := min(size-state.offset, tailMaxChunk)
+	appended := make([]byte, length)
+	if _, err := f.ReadAt(appended, state.offset); err != nil {
+		return nil, false, err
+	}
+	end := bytes.LastIndexByte(appended, '\n')
+	if end < 0 {
+		return nil, false, nil
+	}
+	appended = appended[:end+1]
+	state.pending = state.offset + int64(len(appended))
+
+	// Put the header row, and any preamble before it, in front of the lines
+	if state.offset > 0 && !isJSONLinesFile(file.FileName) {
+		head, err := cs.tailHead(io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return nil, false, err
+		}
+		appended = append(head, appended...)
+	}
+
+	job := file
+	job.input = bytes.NewReader(appended)
+	job.source = storedPath(state.key)
+	return &job, state.pending < size && length == tailMaxChunk, nil
+}
+
+// tailHead returns the lines of a file up to and including its header row
+func (cs *CSVScanner) tailHead(file *io.SectionReader) ([]byte, error) {
+	lines := 1
+	if cs.preamble.enabled() {
+		_, skipped, err := cs.preamble.skip(file)
+		if err != nil {
+			return nil, err
+		}
+		lines += skipped
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	reader := bufio.NewReader(file)
+	var head []byte
+	for range lines {
+		line, err := reader.ReadBytes('\n')
+		head = append(head, line...)
+		if err != nil {
+			break
+		}
+	}
+	return head, nil
+}
+
+// tailState returns the state of a followed file, loading its saved offset
+// the first time the file is seen
+func (cs *CSVScanner) tailState(path string, states map[string]*tailState) (*tailState, error) {
+	if state, ok := states[path]; ok {
+		return state, nil
+	}
+
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var saved models.TailOffset
+	if err := cs.db.Where("file_path = ?", storedPath(key)).Limit(1).Find(&saved).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tail offset: %w", err)
+	}
+	state := &tailState{key: key, offset: saved.ByteOffset, headSize: saved.HeadSize, headHash: saved.HeadSHA256}
+	if state.offset > 0 {
+		logger.Printf("Continuing %s after %d imported bytes\n", path, state.offset)
+	}
+	states[path] = state
+	return state, nil
+}
+
+// advanceTail moves the offset of a file past the lines just imported and
+// saves it
+func (cs *CSVScanner) advanceTail(state *tailState) error {
+	state.offset = state.pending
+	if state.headSize < tailHeadBytes {
+		f, err := os.Open(state.key)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		state.headSize = int(min(state.offset, tailHeadBytes))
+		if state.headHash, err = headHash(f, state.headSize); err != nil {
+			return err
+		}
+	}
+
+	return cs.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"byte_offset", "head_size", "head_sha256", "updated_at"}),
+	}).Create(&models.TailOffset{
+		FilePath:   storedPath(state.key),
+		ByteOffset: state.offset,
+		HeadSize:   state.headSize,
+		HeadSHA256: state.headHash,
+		UpdatedAt:  time.Now().UTC(),
+	}).Error
+}
+
+// headHash hashes the first size bytes of a file
+func headHash(f *os.File, size int) (string, error) {
+	head := make([]byte, size)
+	if _, err := f.ReadAt(head, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+)
+
+// tailScanner returns a scanner over a database holding sensor_data and the
+// tail offsets
+func tailScanner(t *testing.T) *CSVScanner {
+	t.Helper()
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.TailOffset{}); err != nil {
+		t.Fatalf("create tail offsets: %v", err)
+	}
+	cs := NewCSVScanner(db)
+	fields := config.JSONFieldsConfig{Timestamp: "timestamp", SensorName: "sensor_name", Value: "value"}
+	if err := cs.Configure(config.ScannerConfig{JSONFields: fields}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+	return cs
+}
+
+// storedSensorValues returns the values in sensor_data in timestamp order
+func storedSensorValues(t *testing.T, cs *CSVScanner) []float64 {
+	t.Helper()
+	var stored []models.SensorData
+	if err := cs.db.Order("timestamp").Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	values := make([]float64, len(stored))
+	for i, r := range stored {
+		values[i] = r.Value
+	}
+	return values
+}
+
+func TestTailImportsAppendedLines(t *testing.T) {
+	cs := tailScanner(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plant.csv")
+	writeFiles(t, dir, map[string]string{
+		"plant.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n2025-09-01 00:01:00,temp_01,2\n2025-09-01 00:02:00,te",
+	})
+	states := make(map[string]*tailState)
+	ctx := context.Background()
+
+	// The line still being written waits for its newline
+	cs.tailOnce(ctx, path, false, states)
+	if values := storedSensorValues(t, cs); len(values) != 2 {
+		t.Fatalf("stored %v, want the two complete lines", values)
+	}
+
+	// Appended lines are parsed with the header row of the file
+	appendFile(t, path, "mp_01,3\n2025-09-01 00:03:00,temp_01,4\n")
+	cs.tailOnce(ctx, path, false, states)
+	if values := storedSensorValues(t, cs); len(values) != 4 || values[2] != 3 {
+		t.Fatalf("stored %v, want 1 to 4", values)
+	}
+
+	// A restart continues after the saved offset
+	appendFile(t, path, "2025-09-01 00:04:00,temp_01,5\n")
+	states = make(map[string]*tailState)
+	cs.tailOnce(ctx, path, false, states)
+	if values := storedSensorValues(t, cs); len(values) != 5 {
+		t.Fatalf("stored %v after a restart, want 1 to 5", values)
+	}
+	var saved models.TailOffset
+	if err := cs.db.First(&saved).Error; err != nil {
+		t.Fatalf("read tail offset: %v", err)
+	}
+	if info, _ := os.Stat(path); saved.ByteOffset != info.Size() {
+		t.Errorf("saved offset %d, want the file size %d", saved.ByteOffset, info.Size())
+	}
+}
+
+func TestTailRereadsTruncatedAndReplacedFiles(t *testing.T) {
+	cs := tailScanner(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plant.csv")
+	writeFiles(t, dir, map[string]string{
+		"plant.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n2025-09-01 00:01:00,temp_01,2\n",
+	})
+	states := make(map[string]*tailState)
+	ctx := context.Background()
+	cs.tailOnce(ctx, path, false, states)
+
+	// A shorter file was truncated and is read from the start
+	writeFiles(t, dir, map[string]string{
+		"plant.csv": "timestamp,sensor_name,value\n2025-09-01 01:00:00,temp_01,3\n",
+	})
+	cs.tailOnce(ctx, path, false, states)
+	if values := storedSensorValues(t, cs); len(values) != 3 || values[2] != 3 {
+		t.Fatalf("stored %v, want the truncated file read again", values)
+	}
+
+	// A file as long as the offset but with other first bytes was replaced
+	writeFiles(t, dir, map[string]string{
+		"plant.csv": "timestamp,sensor_name,value\n2025-09-01 02:00:00,temp_02,4\n2025-09-01 02:01:00,temp_02,5\n",
+	})
+	cs.tailOnce(ctx, path, false, states)
+	if values := storedSensorValues(t, cs); len(values) != 5 {
+		t.Fatalf("stored %v, want the replacing file read from the start", values)
+	}
+
+	// Unchanged files are not read again
+	cs.tailOnce(ctx, path, false, states)
+	if values := storedSensorValues(t, cs); len(values) != 5 {
+		t.Errorf("stored %v, want nothing new", values)
+	}
+}
+
+func TestTailFollowsDirectory(t *testing.T) {
+	cs := tailScanner(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.csv":    "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n",
+		"b.jsonl":  `{"timestamp": "2025-09-01 00:00:00", "sensor_name": "temp_02", "value": 2}` + "\n",
+		"c.csv.gz": "not followed",
+	})
+	states := make(map[string]*tailState)
+	ctx := context.Background()
+	cs.tailOnce(ctx, dir, true, states)
+	appendFile(t, filepath.Join(dir, "b.jsonl"), `{"timestamp": "2025-09-01 00:01:00", "sensor_name": "temp_02", "value": 3}`+"\n")
+	cs.tailOnce(ctx, dir, true, states)
+
+	if values := storedSensorValues(t, cs); len(values) != 3 {
+		t.Errorf("stored %v, want both files followed", values)
+	}
+	if len(states) != 2 {
+		t.Errorf("followed %d files, want the two uncompressed ones", len(states))
+	}
+}
+
+func TestTailRequiresTheOffsetTable(t *testing.T) {
+	cs := NewCSVScanner(openTestDB(t))
+	if err := cs.Tail(context.Background(), t.TempDir(), 0); err == nil {
+		t.Error("Tail without the tail offset table succeeded")
+	}
+}
@@ -0,0 +1,140 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sensor_data_import/display"
+)
+
+// timeBoundLayouts lists the layouts accepted for time window bounds
+var timeBoundLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTimeBound parses a time window bound relative to now.
+//
+// Accepted values are absolute timestamps (RFC3339, "2006-01-02 15:04:05",
+// "2006-01-02"), the keywords "now", "today" and "yesterday" (midnight UTC),
+// and signed durations such as "-36h", "-30d" or "-2w" which are added to now.
+func ParseTimeBound(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch strings.ToLower(value) {
+	case "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	}
+
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if days, ok := parseDays(value); ok {
+			return now.AddDate(0, 0, days), nil
+		}
+		offset, err := time.ParseDuration(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q: %w", value, err)
+		}
+		return now.Add(offset), nil
+	}
+
+	for _, layout := range timeBoundLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q (expected RFC3339, YYYY-MM-DD, now, today, yesterday or a duration like -24h or -30d)", value)
+}
+
+// parseDays parses a signed whole number of days ("-30d") or weeks ("-2w"),
+// which time.ParseDuration does not accept
+func parseDays(value string) (int, bool) {
+	unit := 1
+	switch {
+	case strings.HasSuffix(value, "d"):
+	case strings.HasSuffix(value, "w"):
+		unit = 7
+	default:
+		return 0, false
+	}
+	count, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil {
+		return 0, false
+	}
+	return count * unit, true
+}
+
+// TimeWindow restricts imported rows to [From, To); zero bounds are open
+type TimeWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+// IsZero reports whether the window has no bounds
+func (tw TimeWindow) IsZero() bool {
+	return tw.From.IsZero() && tw.To.IsZero()
+}
+
+// Contains reports whether the timestamp lies inside the window
+func (tw TimeWindow) Contains(t time.Time) bool {
+	if !tw.From.IsZero() && t.Before(tw.From) {
+		return false
+	}
+	if !tw.To.IsZero() && !t.Before(tw.To) {
+		return false
+	}
+	return true
+}
+
+// String formats the window for log output
+func (tw TimeWindow) String() string {
+	from, to := "-inf", "+inf"
+	if !tw.From.IsZero() {
+		from = display.Time(tw.From, time.RFC3339)
+	}
+	if !tw.To.IsZero() {
+		to = display.Time(tw.To, time.RFC3339)
+	}
+	return fmt.Sprintf("[%s, %s)", from, to)
+}
+
+// resolveAcceptWindow resolves the configured bounds of the accept window
+// relative to now
+func (cs *CSVScanner) resolveAcceptWindow(now time.Time) (TimeWindow, error) {
+	var window TimeWindow
+	var err error
+	if cs.acceptFrom != "" {
+		if window.From, err = ParseTimeBound(cs.acceptFrom, now); err != nil {
+			return TimeWindow{}, fmt.Errorf("invalid accept_from: %w", err)
+		}
+	}
+	if cs.acceptTo != "" {
+		if window.To, err = ParseTimeBound(cs.acceptTo, now); err != nil {
+			return TimeWindow{}, fmt.Errorf("invalid accept_to: %w", err)
+		}
+	}
+	return window, nil
+}
+
+// batchAcceptWindow returns the accept window of the batch whose result is
+// given, resolving it when the batch's first row is parsed, so relative
+// bounds such as "today" or "-7d" follow the clock in a watch or a stream
+// that runs for days, like the upsert cutoff
+func (cs *CSVScanner) batchAcceptWindow(result *ProcessResult) TimeWindow {
+	if result.window == nil {
+		// The bounds were checked when the scanner was configured
+		window, _ := cs.resolveAcceptWindow(time.Now())
+		result.window = &window
+	}
+	return *result.window
+}
@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+
+	"sensor_data_import/config"
+)
+
+// timezoneOverride assigns a source timezone to files matching a pattern
+type timezoneOverride struct {
+	files    string
+	location *time.Location
+}
+
+// loadSourceLocations loads the default source timezone and per-pattern overrides
+func loadSourceLocations(cfg config.ScannerConfig) (*time.Location, []timezoneOverride, error) {
+	location := time.UTC
+	if cfg.SourceTimezone != "" {
+		loc, err := time.LoadLocation(cfg.SourceTimezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid source_timezone: %w", err)
+		}
+		location = loc
+	}
+
+	overrides := make([]timezoneOverride, 0, len(cfg.TimezoneOverrides))
+	for _, o := range cfg.TimezoneOverrides {
+		loc, err := time.LoadLocation(o.Timezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid timezone for %s: %w", o.Files, err)
+		}
+		overrides = append(overrides, timezoneOverride{files: o.Files, location: loc})
+	}
+
+	return location, overrides, nil
+}
+
+// locationFor returns the timezone of naive timestamps in a file
+func (cs *CSVScanner) locationFor(fileName string) *time.Location {
+	for _, override := range cs.timezoneOverrides {
+		if matchFilePattern(override.files, fileName) {
+			return override.location
+		}
+	}
+	return cs.sourceLocation
+}
@@ -0,0 +1,29 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+)
+
+// StageTimings breaks the processing time of a file into pipeline stages
+type StageTimings struct {
+	Read      time.Duration // Opening, decompressing and reading the file
+	Parse     time.Duration // Converting rows into readings
+	Transform time.Duration // Post-processing readings before insert
+	Insert    time.Duration // Writing readings to the database
+}
+
+// Add accumulates another file's timings
+func (st *StageTimings) Add(other StageTimings) {
+	st.Read += other.Read
+	st.Parse += other.Parse
+	st.Transform += other.Transform
+	st.Insert += other.Insert
+}
+
+// String formats the timings for log output
+func (st StageTimings) String() string {
+	return fmt.Sprintf("read %v, parse %v, transform %v, insert %v",
+		st.Read.Round(time.Microsecond), st.Parse.Round(time.Microsecond),
+		st.Transform.Round(time.Microsecond), st.Insert.Round(time.Microsecond))
+}
@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+)
+
+// defaultIntervalTolerance is the fraction of the expected reporting interval
+// a reading may deviate by before it is reported
+const defaultIntervalTolerance = 0.5
+
+// validationRule constrains the readings of sensors matching a glob pattern
+type validationRule struct {
+	sensors   string
+	min       *float64
+	max       *float64
+	sentinels []float64
+	interval  time.Duration
+	tolerance float64
+}
+
+// sensorValidator enforces the configured validation rules
+type sensorValidator struct {
+	namePattern *regexp.Regexp
+	rules       []validationRule
+	calendar    *operatingCalendar // Nil when sensors report around the clock
+}
+
+// newSensorValidator compiles the validation rules, returning nil when none are configured
+func newSensorValidator(cfg config.ValidationConfig) (*sensorValidator, error) {
+	if cfg.SensorNamePattern == "" && len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	sv := &sensorValidator{calendar: newOperatingCalendar(cfg.Calendar)}
+	if cfg.SensorNamePattern != "" {
+		sv.namePattern = regexp.MustCompile(cfg.SensorNamePattern)
+	}
+	for _, rule := range cfg.Rules {
+		compiled := validationRule{
+			sensors:   rule.Sensors,
+			min:       rule.Min,
+			max:       rule.Max,
+			sentinels: rule.RejectValues,
+			tolerance: rule.IntervalTolerance,
+		}
+		if rule.Interval != "" {
+			compiled.interval, _ = time.ParseDuration(rule.Interval)
+		}
+		if compiled.tolerance == 0 {
+			compiled.tolerance = defaultIntervalTolerance
+		}
+		sv.rules = append(sv.rules, compiled)
+	}
+	return sv, nil
+}
+
+// ruleFor returns the first rule matching a sensor
+func (sv *sensorValidator) ruleFor(sensorName string) *validationRule {
+	for i := range sv.rules {
+		if matched, _ := path.Match(sv.rules[i].sensors, sensorName); matched {
+			return &sv.rules[i]
+		}
+	}
+	return nil
+}
+
+// check returns why a reading breaks the sensor name pattern or the value
+// constraints of its rule, or nil
+func (sv *sensorValidator) check(sensorName string, value float64) error {
+	if sv == nil {
+		return nil
+	}
+	if sv.namePattern != nil && !sv.namePattern.MatchString(sensorName) {
+		return fmt.Errorf("sensor name %s does not match %s", sensorName, sv.namePattern)
+	}
+
+	rule := sv.ruleFor(sensorName)
+	if rule == nil {
+		return nil
+	}
+	for _, sentinel := range rule.sentinels {
+		if value == sentinel {
+			return fmt.Errorf("value %g of %s is a rejected sentinel", value, sensorName)
+		}
+	}
+	if rule.min != nil && value < *rule.min {
+		return fmt.Errorf("value %g of %s is below the minimum %g", value, sensorName, *rule.min)
+	}
+	if rule.max != nil && value > *rule.max {
+		return fmt.Errorf("value %g of %s is above the maximum %g", value, sensorName, *rule.max)
+	}
+	return nil
+}
+
+// checkCadence compares a reading with the previous reading of its sensor in
+// the same file and describes a gap or burst outside the expected interval
+func (sv *sensorValidator) checkCadence(result *ProcessResult, sensorName string, timestamp time.Time) string {
+	if sv == nil {
+		return ""
+	}
+	rule := sv.ruleFor(sensorName)
+	if rule == nil || rule.interval == 0 {
+		return ""
+	}
+
+	if result.lastSeen == nil {
+		result.lastSeen = make(map[string]time.Time)
+	}
+	previous, seen := result.lastSeen[sensorName]
+	result.lastSeen[sensorName] = timestamp
+	if !seen || !timestamp.After(previous) {
+		// Files not sorted by time are not checked against the cadence
+		return ""
+	}
+
+	gap := timestamp.Sub(previous)
+	slack := time.Duration(float64(rule.interval) * rule.tolerance)
+	switch {
+	case gap > rule.interval+slack:
+		// Planned downtime is not a gap
+		operating := sv.calendar.operatingTime(previous, timestamp)
+		if operating <= rule.interval+slack {
+			return ""
+		}
+		if operating < gap {
+			return fmt.Sprintf("%s reported after a gap of %v, %v of it in operating time (expected every %v)",
+				sensorName, gap, operating, rule.interval)
+		}
+		return fmt.Sprintf("%s reported after a gap of %v (expected every %v)", sensorName, gap, rule.interval)
+	case gap < rule.interval-slack:
+		return fmt.Sprintf("%s reported %v after its previous reading (expected every %v)", sensorName, gap, rule.interval)
+	}
+	return ""
+}
+
+// violate counts a row as a validation violation, logs it and keeps it for
+// the reject file
+func (r *ProcessResult) violate(fileName string, row int, record []string, reason string) {
+	r.ViolationCount++
+	r.rejects = append(r.rejects, rejectedRow{row: row, record: record, category: rejectValidation, reason: reason})
+	logger.Warnf("Row %d in %s: %s\n", row, fileName, reason)
+}
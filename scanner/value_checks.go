@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+)
+
+// maxExactDigits is the number of significant decimal digits a float64 always round-trips
+const maxExactDigits = 15
+
+// valueChecker validates parsed values for representability and plausible magnitude
+type valueChecker struct {
+	maxAbs    float64  // Largest accepted absolute value (0 disables the bound)
+	whitelist []string // Sensor name patterns exempt from the magnitude bound
+}
+
+// check returns an error describing why a value must be rejected
+func (vc *valueChecker) check(sensorName string, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("value is not a finite number")
+	}
+
+	if vc.maxAbs <= 0 || math.Abs(value) <= vc.maxAbs || vc.whitelisted(sensorName) {
+		return nil
+	}
+
+	// A value within bounds after dividing by 1000 usually means a unit mixup
+	if math.Abs(value)/1000 <= vc.maxAbs {
+		return fmt.Errorf("|value| exceeds %g, possible unit error (e.g. Wh instead of kWh)", vc.maxAbs)
+	}
+	return fmt.Errorf("|value| exceeds %g", vc.maxAbs)
+}
+
+// whitelisted reports whether a sensor is exempt from the magnitude bound
+func (vc *valueChecker) whitelisted(sensorName string) bool {
+	for _, pattern := range vc.whitelist {
+		if matched, _ := path.Match(pattern, sensorName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// significantDigits counts the significant decimal digits in a numeric string
+func significantDigits(value string) int {
+	mantissa := strings.TrimLeft(strings.ToLower(value), "+-")
+	if i := strings.IndexByte(mantissa, 'e'); i >= 0 {
+		mantissa = mantissa[:i]
+	}
+
+	digits := strings.TrimLeft(strings.Replace(mantissa, ".", "", 1), "0")
+	if strings.Contains(mantissa, ".") {
+		digits = strings.TrimRight(digits, "0")
+	}
+	return len(digits)
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"sensor_data_import/config"
+)
+
+// valueTransform rewrites the values of sensors matching a glob pattern
+type valueTransform struct {
+	sensors    string
+	expression string
+	node       exprNode
+}
+
+// valueTransforms applies the first transform matching a sensor. A nil
+// slice leaves every value unchanged.
+type valueTransforms []valueTransform
+
+// newValueTransforms parses the configured transform expressions
+func newValueTransforms(configs []config.ValueTransformConfig) (valueTransforms, error) {
+	var transforms valueTransforms
+	for i, c := range configs {
+		if _, err := path.Match(c.Sensors, ""); err != nil || c.Sensors == "" {
+			return nil, fmt.Errorf("value_transforms[%d]: invalid sensors pattern %q", i, c.Sensors)
+		}
+		node, err := parseTransform(c.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("value_transforms[%d]: %w", i, err)
+		}
+		transforms = append(transforms, valueTransform{sensors: c.Sensors, expression: c.Expression, node: node})
+	}
+	return transforms, nil
+}
+
+// apply returns the transformed value of a reading
+func (vt valueTransforms) apply(sensorName string, value float64) (float64, error) {
+	for _, transform := range vt {
+		if matched, _ := path.Match(transform.sensors, sensorName); !matched {
+			continue
+		}
+		// 'g' with precision -1 formats the value so it parses back exactly
+		result, err := transform.node.eval([]string{strconv.FormatFloat(value, 'g', -1, 64)})
+		if err != nil {
+			return 0, fmt.Errorf("transform %q failed: %w", transform.expression, err)
+		}
+		return result.number()
+	}
+	return value, nil
+}
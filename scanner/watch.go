@@ -0,0 +1,357 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sensor_data_import/logger"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long a file must go without changes before
+// watch mode imports it
+const DefaultWatchDebounce = 2 * time.Second
+
+// DefaultWatchRampUp is how long watch mode waits before starting each
+// additional worker on a burst of files
+const DefaultWatchRampUp = 2 * time.Second
+
+// DefaultWatchRetryAttempts is how often watch mode tries to import a file
+// that keeps failing before giving up
+const DefaultWatchRetryAttempts = 5
+
+// DefaultWatchRetryDelay is the wait before watch mode retries a failed file
+// the first time; it doubles for each further attempt
+const DefaultWatchRetryDelay = 30 * time.Second
+
+// maxWatchRetryDelay caps the doubling delay between retries
+const maxWatchRetryDelay = time.Hour
+
+// watchRetry tracks a file that failed to import in watch mode
+type watchRetry struct {
+	name     string
+	attempts int       // Failed imports so far
+	due      time.Time // Start of the next attempt, zero while it is under way
+}
+
+// Watch imports the files already in a directory, then keeps importing new
+// or modified files as they appear until ctx is cancelled. A file is imported
+// once it has not been written to for the debounce interval, so files that
+// are still being copied in are not read half-written. Files that settle while
+// an import is running are queued for the next one, and each import ramps up
+// its workers gradually so a burst of arrivals does not spike the database.
+// Files that fail to import are tried again after a doubling delay, since
+// the cause, such as a database outage, is often transient.
+func (cs *CSVScanner) Watch(ctx context.Context, directoryPath string, debounce time.Duration) error {
+	if _, err := os.Stat(directoryPath); os.IsNotExist(err) {
+		return fmt.Errorf("directory does not exist: %s", directoryPath)
+	}
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+	directoryPath = scanRoot(directoryPath)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := cs.beginScan(); err != nil {
+		return err
+	}
+	defer cs.endScan()
+
+	// Watch before the initial scan so files arriving meanwhile are not missed
+	if err := cs.watchTree(watcher, directoryPath, directoryPath, nil); err != nil {
+		return err
+	}
+
+	csvFiles, err := cs.findCSVFiles(directoryPath)
+	if err != nil {
+		return fmt.Errorf("failed to find CSV files: %w", err)
+	}
+
+	// Imports run in the background so events keep being read meanwhile;
+	// imported receives the results when one finishes
+	var queue []string
+	queued := make(map[string]bool)
+	retries := make(map[string]*watchRetry)
+	importing := false
+	imported := make(chan []ProcessResult, 1)
+	startImport := func(jobs []FileJob) {
+		importing = true
+		go func() {
+			imported <- cs.importWatched(ctx, directoryPath, jobs)
+		}()
+	}
+	defer func() {
+		// Let the import in progress commit its batches before returning
+		if importing {
+			<-imported
+		}
+	}()
+
+	if len(csvFiles) > 0 {
+		logger.Printf("Importing %d existing file(s)\n", len(csvFiles))
+		startImport(csvFiles)
+	}
+
+	logger.Printf("Watching %s for new files (debounce %v)\n", directoryPath, debounce)
+
+	pending := make(map[string]time.Time)
+	tick := debounce / 2
+	if tick < 100*time.Millisecond {
+		tick = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	defer cs.live.setQueue(0, 0, 0)
+	for {
+		cs.live.setQueue(len(queue), len(pending), len(retries))
+		select {
+		case <-ctx.Done():
+			logger.Println("Stopping watch")
+			if len(queue) > 0 {
+				logger.Warnf("%d queued file(s) not imported\n", len(queue))
+			}
+			if len(retries) > 0 {
+				logger.Warnf("%d failed file(s) waiting for a retry not imported\n", len(retries))
+			}
+			return nil
+
+		case results := <-imported:
+			importing = false
+			cs.scheduleRetries(retries, results, time.Now())
+			if len(queue) > 0 && !cs.Paused() {
+				jobs := cs.watchJobs(directoryPath, queue)
+				queue, queued = nil, make(map[string]bool)
+				if len(jobs) > 0 {
+					logger.Printf("Importing %d queued file(s)\n", len(jobs))
+					startImport(jobs)
+				}
+			}
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			cs.handleWatchEvent(watcher, directoryPath, event, pending)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warnf("File watcher error: %v\n", err)
+
+		case now := <-ticker.C:
+			var ready []string
+			for path, changed := range pending {
+				if now.Sub(changed) >= debounce {
+					ready = append(ready, path)
+					delete(pending, path)
+					delete(retries, path) // Changed contents get a fresh set of attempts
+				}
+			}
+			ready = append(ready, cs.dueRetries(retries, now)...)
+			paused := cs.Paused()
+			if !importing && !paused && len(queue) > 0 {
+				// Resumed: files queued while paused are imported with the new ones
+				for _, path := range ready {
+					if !queued[path] {
+						queue = append(queue, path)
+					}
+				}
+				ready, queue, queued = queue, nil, make(map[string]bool)
+			}
+			if len(ready) == 0 {
+				continue
+			}
+			if !importing && !paused {
+				if jobs := cs.watchJobs(directoryPath, ready); len(jobs) > 0 {
+					logger.Printf("Importing %d new, modified or retried file(s)\n", len(jobs))
+					startImport(jobs)
+				}
+				continue
+			}
+			sort.Strings(ready)
+			for _, path := range ready {
+				if !queued[path] {
+					queued[path] = true
+					queue = append(queue, path)
+				}
+			}
+			if paused {
+				logger.Printf("Queued %d file(s) while paused, queue depth %d\n", len(ready), len(queue))
+			} else {
+				logger.Printf("Queued %d file(s) behind the import in progress, queue depth %d\n", len(ready), len(queue))
+			}
+		}
+	}
+}
+
+// handleWatchEvent records files that were created or written, and starts
+// watching new subdirectories when scanning recursively
+func (cs *CSVScanner) handleWatchEvent(watcher *fsnotify.Watcher, directoryPath string, event fsnotify.Event, pending map[string]time.Time) {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		delete(pending, event.Name)
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if event.Has(fsnotify.Create) && cs.recursive {
+			// Files may have landed in the directory before it was watched
+			if err := cs.watchTree(watcher, directoryPath, event.Name, pending); err != nil {
+				logger.Warnf("Failed to watch %s: %v\n", event.Name, err)
+			}
+		}
+		return
+	}
+
+	name := filepath.Base(event.Name)
+	if (isDataFile(name) || isZipFile(name)) && !isRejectFile(name) {
+		pending[event.Name] = time.Now()
+	}
+}
+
+// watchTree adds a directory, and its subdirectories when scanning
+// recursively, to the watcher. Files found in them are added to pending.
+func (cs *CSVScanner) watchTree(watcher *fsnotify.Watcher, directoryPath, root string, pending map[string]time.Time) error {
+	return filepath.WalkDir(root, func(entryPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			if pending != nil {
+				pending[entryPath] = time.Now()
+			}
+			return nil
+		}
+		if entryPath != directoryPath && (!cs.recursive || cs.afterImport.isArchiveDir(directoryPath, entryPath)) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(entryPath); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", entryPath, err)
+		}
+		return nil
+	})
+}
+
+// watchJobs returns the jobs for files whose changes have settled, leaving
+// out files removed since
+func (cs *CSVScanner) watchJobs(directoryPath string, paths []string) []FileJob {
+	sort.Strings(paths)
+
+	var jobs []FileJob
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		fileJobs, err := jobsForFile(directoryPath, path)
+		if err != nil {
+			logger.Warnf("Skipping %s: %v\n", path, err)
+			continue
+		}
+		jobs = append(jobs, cs.files.filter(fileJobs)...)
+	}
+	return jobs
+}
+
+// importWatched imports one round of files, ramping up the workers
+func (cs *CSVScanner) importWatched(ctx context.Context, directoryPath string, jobs []FileJob) []ProcessResult {
+	results := cs.processFilesParallel(ctx, jobs, cs.watchRampUp)
+	cs.displaySummary(results)
+	cs.afterImport.apply(directoryPath, results)
+	return results
+}
+
+// scheduleRetries schedules another attempt for each file that failed to
+// import, gives up on files out of attempts and forgets files imported since
+func (cs *CSVScanner) scheduleRetries(retries map[string]*watchRetry, results []ProcessResult, now time.Time) {
+	// A ZIP archive failed when any of its members did
+	outcomes := make(map[string]ProcessResult)
+	for _, result := range results {
+		if previous, seen := outcomes[result.FilePath]; !result.Cancelled && (!seen || previous.Error == nil) {
+			outcomes[result.FilePath] = result
+		}
+	}
+	paths := make([]string, 0, len(outcomes))
+	for path := range outcomes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		result := outcomes[path]
+		retry := retries[path]
+		if result.Error == nil {
+			if retry != nil {
+				logger.Printf("✓ %s imported on attempt %d\n", retry.name, retry.attempts+1)
+				delete(retries, path)
+			}
+			continue
+		}
+
+		if retry == nil {
+			retry = &watchRetry{name: result.FileName}
+			retries[path] = retry
+		}
+		retry.attempts++
+		if retry.attempts >= cs.watchRetryAttempts {
+			if cs.watchRetryAttempts > 1 {
+				logger.Errorf("Giving up on %s after %d failed attempts: %v (save it again to retry)\n",
+					retry.name, retry.attempts, result.Error)
+			}
+			delete(retries, path)
+			continue
+		}
+		delay := min(cs.watchRetryDelay<<(retry.attempts-1), maxWatchRetryDelay)
+		retry.due = now.Add(delay)
+		logger.Warnf("%s failed (attempt %d of %d), retrying in %v\n",
+			retry.name, retry.attempts, cs.watchRetryAttempts, delay)
+	}
+
+	var next time.Time
+	for _, retry := range retries {
+		if !retry.due.IsZero() && (next.IsZero() || retry.due.Before(next)) {
+			next = retry.due
+		}
+	}
+	if !next.IsZero() {
+		logger.Printf("Retry queue: %d file(s) waiting, next attempt in %v\n",
+			len(retries), next.Sub(now).Round(time.Second))
+	}
+}
+
+// dueRetries returns the failed files whose next attempt is due, forgetting
+// files removed since
+func (cs *CSVScanner) dueRetries(retries map[string]*watchRetry, now time.Time) []string {
+	var due []string
+	for path, retry := range retries {
+		if retry.due.IsZero() || now.Before(retry.due) {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			delete(retries, path)
+			continue
+		}
+		retry.due = time.Time{}
+		due = append(due, path)
+		logger.Printf("Retrying %s (attempt %d of %d)\n", retry.name, retry.attempts+1, cs.watchRetryAttempts)
+	}
+	return due
+}
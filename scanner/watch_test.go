@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// waitForReadings waits until db holds count readings, failing the test
+// after a few seconds
+func waitForReadings(t *testing.T, cs *CSVScanner, count int64) {
+	t.Helper()
+	stored := int64(0)
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(20 * time.Millisecond) {
+		if stored = countRows(t, cs.db, &models.SensorData{}); stored >= count {
+			return
+		}
+	}
+	t.Fatalf("stored %d readings, want %d", stored, count)
+}
+
+func TestWatchImportsExistingAndNewFiles(t *testing.T) {
+	cs := NewCSVScanner(openTestDB(t))
+	cs.SetRecursive(true)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_01,1\n"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cs.Watch(ctx, dir, 100*time.Millisecond) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch: %v", err)
+		}
+	}()
+
+	// The file already there is imported first
+	waitForReadings(t, cs, 1)
+
+	// A file written in two steps is imported once it settles, with what it
+	// holds by then, and so is a file in a new subdirectory
+	path := filepath.Join(dir, "b.csv")
+	writeFiles(t, dir, map[string]string{"b.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_02,2\n"})
+	appendFile(t, path, "2025-09-01 00:01:00,temp_02,3\n")
+	writeFiles(t, dir, map[string]string{"site_b/c.csv": "timestamp,sensor_name,value\n2025-09-01 00:00:00,temp_03,4\n"})
+	waitForReadings(t, cs, 4)
+}
+
+func TestWatchEventsSelectDataFiles(t *testing.T) {
+	cs := NewCSVScanner(nil)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.csv":             "",
+		"b.jsonl":           "",
+		"a.csv.rejects.csv": "",
+		"notes.txt":         "",
+	})
+	pending := make(map[string]time.Time)
+	for _, name := range []string{"a.csv", "b.jsonl", "a.csv.rejects.csv", "notes.txt", "gone.csv"} {
+		cs.handleWatchEvent(nil, dir, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Create}, pending)
+	}
+	if len(pending) != 2 {
+		t.Errorf("pending = %v, want a.csv and b.jsonl", pending)
+	}
+
+	// A removed or renamed file is no longer waited for
+	cs.handleWatchEvent(nil, dir, fsnotify.Event{Name: filepath.Join(dir, "a.csv"), Op: fsnotify.Rename}, pending)
+	if _, ok := pending[filepath.Join(dir, "a.csv")]; ok || len(pending) != 1 {
+		t.Errorf("pending = %v after the rename, want only b.jsonl", pending)
+	}
+
+	// Files removed before they settled get no job
+	if err := os.Remove(filepath.Join(dir, "b.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	jobs := cs.watchJobs(dir, []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.jsonl")})
+	if len(jobs) != 1 || jobs[0].FileName != "a.csv" {
+		t.Errorf("jobs = %+v, want a.csv only", jobs)
+	}
+}
+
+func TestWatchGivesUpAfterTheLastAttempt(t *testing.T) {
+	cs := NewCSVScanner(nil)
+	cs.SetWatchRetryAttempts(2)
+	cs.watchRetryDelay = time.Minute
+	path := filepath.Join(t.TempDir(), "a.csv")
+	failed := []ProcessResult{{FilePath: path, FileName: "a.csv", Error: ErrInjectedFault}}
+	retries := make(map[string]*watchRetry)
+	now := time.Now()
+
+	cs.scheduleRetries(retries, failed, now)
+	if len(retries) != 1 {
+		t.Fatalf("retries = %v, want a.csv scheduled", retries)
+	}
+	cs.scheduleRetries(retries, failed, now.Add(time.Minute))
+	if len(retries) != 0 {
+		t.Errorf("retries = %v, want a.csv given up after 2 attempts", retries)
+	}
+
+	// Cancelled imports are neither failures nor successes
+	cs.scheduleRetries(retries, []ProcessResult{{FilePath: path, FileName: "a.csv", Error: context.Canceled, Cancelled: true}}, now)
+	if len(retries) != 0 {
+		t.Errorf("retries = %v, want a cancelled import not retried", retries)
+	}
+}
+
+func TestWatchRequiresTheDirectory(t *testing.T) {
+	cs := NewCSVScanner(openTestDB(t))
+	if err := cs.Watch(context.Background(), filepath.Join(t.TempDir(), "missing"), 0); err == nil {
+		t.Error("Watch of a missing directory succeeded")
+	}
+}
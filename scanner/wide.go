@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// wideMappingFile is the format of a wide-format column mapping file
+type wideMappingFile struct {
+	Columns map[string]string `yaml:"columns"` // Column header -> sensor name
+}
+
+// loadWideMapping reads a column mapping file, keyed by normalized header
+func loadWideMapping(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wide mapping file: %w", err)
+	}
+
+	var file wideMappingFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse wide mapping file: %w", err)
+	}
+	if len(file.Columns) == 0 {
+		return nil, fmt.Errorf("wide mapping file %s has no columns", path)
+	}
+
+	mapping := make(map[string]string, len(file.Columns))
+	for header, sensorName := range file.Columns {
+		mapping[normalizeHeader(header)] = strings.TrimSpace(sensorName)
+	}
+	return mapping, nil
+}
+
+// wideColumn is a value column of a wide-format file
+type wideColumn struct {
+	index      int
+	sensorName string
+}
+
+// wideColumns finds the timestamp column and the sensor columns of a wide header
+func (cs *CSVScanner) wideColumns(header []string) (int, []wideColumn) {
+	timestampIndex := -1
+	for i, cell := range header {
+		if cs.headers.synonyms[normalizeHeader(cell)] == FieldTimestamp {
+			timestampIndex = i
+			break
+		}
+	}
+	if timestampIndex < 0 {
+		timestampIndex = 0
+	}
+
+	var columns []wideColumn
+	for i, cell := range header {
+		name := strings.TrimSpace(cell)
+		if i == timestampIndex || name == "" {
+			continue
+		}
+
+		// With a mapping file only mapped columns are imported
+		if cs.wideMapping != nil {
+			mapped, ok := cs.wideMapping[normalizeHeader(name)]
+			if !ok {
+				continue
+			}
+			name = mapped
+		}
+		columns = append(columns, wideColumn{index: i, sensorName: name})
+	}
+
+	return timestampIndex, columns
+}
+
+// parseWideRecords explodes wide-format rows (one column per sensor) into
+// one reading per non-empty cell. The first row must be the header.
+func (cs *CSVScanner) parseWideRecords(records [][]string, fileName string, result *ProcessResult) []models.SensorData {
+	var sensorData []models.SensorData
+	if len(records) == 0 {
+		return sensorData
+	}
+
+	timestampIndex, columns := cs.wideColumns(records[0])
+	if len(columns) == 0 {
+		result.countError(ErrorMalformed)
+		logger.Warnf("Header of %s has no sensor columns\n", fileName)
+		return sensorData
+	}
+	result.rejectHeader = records[0]
+	logger.Debugf("Wide layout in %s: timestamp column %d, %d sensor column(s)\n",
+		fileName, timestampIndex, len(columns))
+
+	for i := 1; i < len(records); i++ {
+		// Stop parsing a file with too many errors to be worth finishing
+		if result.errorLimit.exceeded(result, false) {
+			break
+		}
+		result.rowsParsed++
+
+		record := records[i]
+		row := i + 1 + result.PreambleLines + result.rowOffset
+
+		// Skip empty rows
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+
+		// Skip summary rows rather than reporting them as bad readings
+		if cs.skipFooter(record, row, fileName, result) {
+			continue
+		}
+
+		if timestampIndex >= len(record) {
+			result.reject(fileName, row, record, ErrorShortRow, "no timestamp column")
+			continue
+		}
+
+		timestamp, ok := cs.parseTimestamp(record[timestampIndex], record, row, fileName, result)
+		if !ok {
+			continue
+		}
+
+		for _, column := range columns {
+			// Missing cells are gaps in the export, not errors
+			if column.index >= len(record) || strings.TrimSpace(record[column.index]) == "" {
+				continue
+			}
+
+			reading, ok := cs.parseReading(timestamp, column.sensorName, record[column.index], record, row, fileName, result)
+			if ok {
+				sensorData = append(sensorData, reading)
+			}
+		}
+	}
+
+	return sensorData
+}
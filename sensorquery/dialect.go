@@ -0,0 +1,76 @@
+package sensorquery
+
+import (
+	"fmt"
+	"strings"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// bucketExpression returns the start of the bucket of width seconds holding
+// each reading, as Unix seconds, in the SQL of the driver. Epoch seconds are
+// computed without the session time zone, which differs between servers:
+// UNIX_TIMESTAMP of a MySQL TIMESTAMP column is the instant stored.
+func bucketExpression(driver string, width int64) (string, error) {
+	switch driver {
+	case "postgres":
+		return fmt.Sprintf("CAST(FLOOR(EXTRACT(EPOCH FROM timestamp) / %[1]d) AS BIGINT) * %[1]d", width), nil
+	case "mysql":
+		return fmt.Sprintf("FLOOR(UNIX_TIMESTAMP(timestamp) / %[1]d) * %[1]d", width), nil
+	case "sqlite":
+		// Timestamps are stored as text with their offset, which strftime applies
+		return fmt.Sprintf("(CAST(strftime('%%s', timestamp) AS INTEGER) / %[1]d) * %[1]d", width), nil
+	}
+	return "", fmt.Errorf("buckets are not supported on driver %s", driver)
+}
+
+// sensorCondition matches sensor names against exact names and glob patterns
+func sensorCondition(patterns []string) (string, []any) {
+	var conditions []string
+	var args []any
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?") {
+			conditions = append(conditions, "sensor_name LIKE ? ESCAPE '!'")
+			args = append(args, GlobToLike(pattern))
+		} else {
+			conditions = append(conditions, "sensor_name = ?")
+			args = append(args, pattern)
+		}
+	}
+	return strings.Join(conditions, " OR "), args
+}
+
+// GlobToLike converts a glob pattern with * and ? into a LIKE pattern using
+// ! as the escape character
+func GlobToLike(pattern string) string {
+	var like strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			like.WriteByte('%')
+		case '?':
+			like.WriteByte('_')
+		case '%', '_', '!':
+			like.WriteByte('!')
+			like.WriteRune(r)
+		default:
+			like.WriteRune(r)
+		}
+	}
+	return like.String()
+}
+
+// NotExcluded returns the condition leaving out the readings of a table
+// covered by an active exclusion, or an empty string when the exclusions
+// table does not exist
+func NotExcluded(db *gorm.DB, table string) string {
+	exclusions := models.ReadingExclusion{}.TableName()
+	if !db.Migrator().HasTable(exclusions) {
+		return ""
+	}
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %[1]s e WHERE e.revoked_at IS NULL"+
+		" AND %[2]s.timestamp BETWEEN e.starts_at AND e.ends_at"+
+		" AND %[2]s.sensor_name LIKE e.sensor_like ESCAPE '!')", exclusions, table)
+}
@@ -0,0 +1,149 @@
+package sensorquery
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sensor_data_import/models"
+)
+
+// Parallel splits the query into time chunks of the given width, aligned to
+// the Unix epoch, and reads up to workers of them at once. Stream still
+// returns the rows in order: each chunk is held in memory until the chunks
+// before it are returned. An open side of the range is closed at the first
+// or last reading. Chunks are widened to a whole number of buckets, and
+// aggregates without buckets, which span the whole range, are read by one
+// query. Fewer than two workers read the range with one query.
+func (q *Query) Parallel(workers int, chunk time.Duration) *Query {
+	q.workers, q.chunk = workers, chunk
+	return q
+}
+
+// parallel reports whether Stream reads the query in chunks
+func (q *Query) parallel() bool {
+	return q.workers > 1 && q.chunk >= time.Second && (!q.Aggregated() || q.Bucketed())
+}
+
+// chunkResult holds the rows of one chunk, or the error reading it
+type chunkResult struct {
+	rows []Row
+	err  error
+}
+
+// streamParallel calls fn for every row of the query, reading its chunks with
+// up to q.workers queries at a time
+func (q *Query) streamParallel(ctx context.Context, source *Source, fn func(Row) error) error {
+	from, to, ok, err := q.bounds(ctx, source)
+	if err != nil || !ok {
+		return err
+	}
+	chunks := q.chunks(from, to)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops the chunks still being read after an error
+	results := make([]chan chunkResult, len(chunks))
+	start := func(i int) {
+		results[i] = make(chan chunkResult, 1)
+		go func() {
+			rows, err := chunks[i].collect(ctx, source)
+			results[i] <- chunkResult{rows: rows, err: err}
+		}()
+	}
+	for i := 0; i < min(q.workers, len(chunks)); i++ {
+		start(i)
+	}
+
+	for i := range chunks {
+		result := <-results[i]
+		if next := i + q.workers; next < len(chunks) {
+			start(next)
+		}
+		if result.err != nil {
+			return result.err
+		}
+		for _, row := range result.rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bounds returns the range the chunks cover: the range of the query, with an
+// open side closed at the first or last matching reading. ok is false when
+// no reading lies in the range.
+func (q *Query) bounds(ctx context.Context, source *Source) (from, to time.Time, ok bool, err error) {
+	from, to = q.from, q.to
+	if from.IsZero() {
+		first, found, err := q.edge(ctx, source, "timestamp")
+		if err != nil || !found {
+			return from, to, false, err
+		}
+		from = first
+	}
+	if to.IsZero() {
+		last, found, err := q.edge(ctx, source, "timestamp DESC")
+		if err != nil || !found {
+			return from, to, false, err
+		}
+		to = last.Add(time.Nanosecond) // The range excludes its end
+	}
+	return from, to, from.Before(to), nil
+}
+
+// edge returns the timestamp of the first reading in the range of the query
+// in the given order
+func (q *Query) edge(ctx context.Context, source *Source, order string) (time.Time, bool, error) {
+	stmt := q.where(source.db.WithContext(ctx).Model(&models.SensorData{}), source.notExcluded)
+	var timestamps []time.Time
+	if err := stmt.Order(order).Limit(1).Pluck("timestamp", &timestamps).Error; err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to find the range of the readings: %w", err)
+	}
+	if len(timestamps) == 0 {
+		return time.Time{}, false, nil
+	}
+	return timestamps[0], true, nil
+}
+
+// chunks splits from to to into queries reading one chunk each. Chunks are
+// aligned to the Unix epoch and span whole buckets, so no bucket is split.
+func (q *Query) chunks(from, to time.Time) []*Query {
+	width := int64(q.chunk / time.Second)
+	if bucket := int64(q.bucket / time.Second); bucket > 0 && width%bucket != 0 {
+		width += bucket - width%bucket
+	}
+
+	var chunks []*Query
+	start := from.Unix() - from.Unix()%width
+	if from.Unix() < 0 && from.Unix()%width != 0 {
+		start -= width
+	}
+	for ; start <= to.Unix(); start += width {
+		chunkFrom, chunkTo := time.Unix(start, 0).UTC(), time.Unix(start+width, 0).UTC()
+		if chunkFrom.Before(from) {
+			chunkFrom = from
+		}
+		if chunkTo.After(to) {
+			chunkTo = to
+		}
+		if !chunkFrom.Before(chunkTo) {
+			continue
+		}
+		chunk := *q
+		chunk.from, chunk.to, chunk.workers = chunkFrom, chunkTo, 0
+		chunks = append(chunks, &chunk)
+	}
+	return chunks
+}
+
+// collect returns every row of the query
+func (q *Query) collect(ctx context.Context, source *Source) ([]Row, error) {
+	var rows []Row
+	err := q.Stream(ctx, source, func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
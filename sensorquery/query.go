@@ -0,0 +1,311 @@
+// Package sensorquery builds queries over the imported readings for every
+// supported driver, so callers describe what they want instead of writing
+// dialect-specific SQL against sensor_data:
+//
+//	source := sensorquery.NewSource(db)
+//	rows, err := sensorquery.Readings().
+//		Sensors("greenhouse_*").
+//		Between(from, to).
+//		Bucket(15 * time.Minute).
+//		Aggregate(sensorquery.Avg, sensorquery.Max).
+//		Find(source)
+//
+// Readings covered by an active exclusion are left out unless the query
+// includes them.
+package sensorquery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/gorm"
+)
+
+// Function is an aggregate computed over the values of each group
+type Function string
+
+const (
+	Avg   Function = "avg"
+	Min   Function = "min"
+	Max   Function = "max"
+	Sum   Function = "sum"
+	Count Function = "count"
+)
+
+// ParseFunction returns the aggregate function with the given name
+func ParseFunction(name string) (Function, error) {
+	switch fn := Function(strings.ToLower(strings.TrimSpace(name))); fn {
+	case Avg, Min, Max, Sum, Count:
+		return fn, nil
+	}
+	return "", fmt.Errorf("unknown aggregate %q (expected avg, min, max, sum or count)", name)
+}
+
+// Column is the name of the result column holding the aggregate
+func (fn Function) Column() string {
+	return string(fn) + "_value"
+}
+
+// Query selects readings of sensor_data. Without Bucket or Aggregate it
+// returns the readings themselves, ordered by timestamp and sensor name.
+// Builder methods modify and return the query.
+type Query struct {
+	sensors         []string
+	from, to        time.Time
+	addedAfter      time.Time // Bounds of created_at; see Added
+	addedUntil      time.Time
+	bucket          time.Duration
+	functions       []Function
+	includeExcluded bool
+	workers         int           // Chunks read at once; see Parallel
+	chunk           time.Duration // Width of the chunks
+}
+
+// Row is a reading, or the aggregates of one sensor in one bucket
+type Row struct {
+	Timestamp  time.Time // Time of the reading or start of the bucket; zero when aggregated without buckets
+	SensorName string
+	Value      float64   // The reading, or the first aggregate
+	Values     []float64 // Every aggregate, in the order given to Aggregate
+}
+
+// Source is a database the queries read from. Whether it has the exclusions
+// table is looked up once, when the source is created, so keep the source
+// for the queries that follow instead of creating one per query.
+type Source struct {
+	db          *gorm.DB
+	notExcluded string // Condition leaving out excluded readings; empty without the exclusions table
+}
+
+// NewSource returns a source reading from db
+func NewSource(db *gorm.DB) *Source {
+	return &Source{db: db, notExcluded: NotExcluded(db, models.SensorData{}.TableName())}
+}
+
+// Readings starts a query over every reading
+func Readings() *Query {
+	return &Query{}
+}
+
+// Sensors limits the query to sensors matching one of the patterns: exact
+// names or globs with * and ?. Empty patterns are ignored.
+func (q *Query) Sensors(patterns ...string) *Query {
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			q.sensors = append(q.sensors, pattern)
+		}
+	}
+	return q
+}
+
+// Between limits the query to readings from from (inclusive) to to
+// (exclusive). A zero time leaves that side open.
+func (q *Query) Between(from, to time.Time) *Query {
+	q.from, q.to = from, to
+	return q
+}
+
+// Added limits the query to readings stored after after (exclusive) and up
+// to until (inclusive), by their created_at. A zero time leaves that side
+// open. Exporting up to a time and continuing after it the next time returns
+// each reading once, provided it was committed before the export.
+func (q *Query) Added(after, until time.Time) *Query {
+	q.addedAfter, q.addedUntil = after, until
+	return q
+}
+
+// Bucket groups the readings of each sensor into buckets of the given width,
+// aligned to the Unix epoch. Without Aggregate each bucket holds the average.
+func (q *Query) Bucket(width time.Duration) *Query {
+	q.bucket = width
+	return q
+}
+
+// Aggregate computes the functions per sensor, and per bucket when the query
+// has one. Repeated functions are computed once.
+func (q *Query) Aggregate(functions ...Function) *Query {
+	for _, fn := range functions {
+		if !q.hasFunction(fn) {
+			q.functions = append(q.functions, fn)
+		}
+	}
+	return q
+}
+
+// IncludeExcluded also returns readings marked as bad data by an exclusion
+func (q *Query) IncludeExcluded(include bool) *Query {
+	q.includeExcluded = include
+	return q
+}
+
+// Aggregated reports whether the query returns aggregates instead of readings
+func (q *Query) Aggregated() bool {
+	return q.bucket > 0 || len(q.functions) > 0
+}
+
+// Bucketed reports whether the aggregates are grouped into time buckets
+func (q *Query) Bucketed() bool {
+	return q.bucket > 0
+}
+
+// Functions returns the aggregates the query computes, in result order
+func (q *Query) Functions() []Function {
+	if len(q.functions) == 0 && q.bucket > 0 {
+		return []Function{Avg}
+	}
+	return q.functions
+}
+
+func (q *Query) hasFunction(fn Function) bool {
+	for _, existing := range q.functions {
+		if existing == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// Build returns the query as a GORM statement on the database of source.
+// Readings select the timestamp, sensor_name and value columns; aggregates
+// select bucket (Unix seconds, only with Bucket), sensor_name and a column
+// per function named by Function.Column.
+func (q *Query) Build(source *Source) (*gorm.DB, error) {
+	return q.build(source.db, source.notExcluded)
+}
+
+// build returns the query on db, leaving out excluded readings with the
+// notExcluded condition unless the query includes them
+func (q *Query) build(db *gorm.DB, notExcluded string) (*gorm.DB, error) {
+	if q.bucket < 0 || q.bucket%time.Second != 0 {
+		return nil, fmt.Errorf("bucket width %v is not a whole number of seconds", q.bucket)
+	}
+	for _, fn := range q.functions {
+		if _, err := ParseFunction(string(fn)); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt := q.where(db.Model(&models.SensorData{}), notExcluded)
+
+	if !q.Aggregated() {
+		return stmt.Select("timestamp, sensor_name, value").Order("timestamp, sensor_name"), nil
+	}
+
+	var columns []string
+	for _, fn := range q.Functions() {
+		columns = append(columns, fmt.Sprintf("%s(value) AS %s", strings.ToUpper(string(fn)), fn.Column()))
+	}
+	if q.bucket == 0 {
+		return stmt.Select("sensor_name, " + strings.Join(columns, ", ")).
+			Group("sensor_name").Order("sensor_name"), nil
+	}
+
+	bucket, err := bucketExpression(db.Dialector.Name(), int64(q.bucket/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Select(bucket + " AS bucket, sensor_name, " + strings.Join(columns, ", ")).
+		Group("bucket, sensor_name").Order("bucket, sensor_name"), nil
+}
+
+// where adds the conditions on the time, sensor and creation of the
+// readings, and leaves out excluded readings with the notExcluded condition
+// unless the query includes them
+func (q *Query) where(stmt *gorm.DB, notExcluded string) *gorm.DB {
+	if !q.from.IsZero() {
+		stmt = stmt.Where("timestamp >= ?", q.from)
+	}
+	if !q.to.IsZero() {
+		stmt = stmt.Where("timestamp < ?", q.to)
+	}
+	if len(q.sensors) > 0 {
+		condition, args := sensorCondition(q.sensors)
+		stmt = stmt.Where(condition, args...)
+	}
+	if !q.addedAfter.IsZero() {
+		stmt = stmt.Where("created_at > ?", q.addedAfter)
+	}
+	if !q.addedUntil.IsZero() {
+		stmt = stmt.Where("created_at <= ?", q.addedUntil)
+	}
+	if !q.includeExcluded && notExcluded != "" {
+		stmt = stmt.Where(notExcluded)
+	}
+	return stmt
+}
+
+// SensorNames returns the names of the sensors with readings in the query,
+// sorted
+func (q *Query) SensorNames(ctx context.Context, source *Source) ([]string, error) {
+	var names []string
+	stmt := q.where(source.db.WithContext(ctx).Model(&models.SensorData{}), source.notExcluded)
+	if err := stmt.Distinct("sensor_name").Order("sensor_name").Pluck("sensor_name", &names).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sensors: %w", err)
+	}
+	return names, nil
+}
+
+// Stream calls fn for every row of the query without loading the result into
+// memory, apart from the chunks of a Parallel query. It stops at the first
+// error returned by fn or when ctx is cancelled.
+func (q *Query) Stream(ctx context.Context, source *Source, fn func(Row) error) error {
+	if q.parallel() {
+		return q.streamParallel(ctx, source, fn)
+	}
+	stmt, err := q.build(source.db.WithContext(ctx), source.notExcluded)
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query readings: %w", err)
+	}
+	defer rows.Close()
+
+	functions := len(q.Functions())
+	for rows.Next() {
+		var row Row
+		if err := q.scan(rows.Scan, &row, functions); err != nil {
+			return fmt.Errorf("failed to read row: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Find returns every row of the query
+func (q *Query) Find(source *Source) ([]Row, error) {
+	return q.collect(context.Background(), source)
+}
+
+// scan reads one result row in the column order of Build
+func (q *Query) scan(scan func(dest ...any) error, row *Row, functions int) error {
+	if !q.Aggregated() {
+		return scan(&row.Timestamp, &row.SensorName, &row.Value)
+	}
+
+	row.Values = make([]float64, functions)
+	var bucket int64
+	var dest []any
+	if q.bucket > 0 {
+		dest = append(dest, &bucket)
+	}
+	dest = append(dest, &row.SensorName)
+	for i := range row.Values {
+		dest = append(dest, &row.Values[i])
+	}
+	if err := scan(dest...); err != nil {
+		return err
+	}
+	if q.bucket > 0 {
+		row.Timestamp = time.Unix(bucket, 0).UTC()
+	}
+	row.Value = row.Values[0]
+	return nil
+}
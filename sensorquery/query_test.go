@@ -0,0 +1,149 @@
+package sensorquery
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sensor_data_import/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSource creates the readings and exclusions tables in a new SQLite
+// database and returns a source over it
+func openSource(t *testing.T, readings ...models.SensorData) (*Source, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "sensor.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := db.AutoMigrate(&models.SensorData{}, &models.ReadingExclusion{}); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	if len(readings) > 0 {
+		if err := db.Create(&readings).Error; err != nil {
+			t.Fatalf("insert readings: %v", err)
+		}
+	}
+	return NewSource(db), db
+}
+
+func reading(sensor string, at time.Time, value float64) models.SensorData {
+	return models.SensorData{Timestamp: at, SensorName: sensor, Value: value}
+}
+
+func TestBucketsAndExclusions(t *testing.T) {
+	start := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	source, db := openSource(t,
+		reading("temp_01", start, 1),
+		reading("temp_01", start.Add(10*time.Minute), 3),
+		reading("temp_01", start.Add(20*time.Minute), 100),
+		reading("temp_02", start.Add(5*time.Minute), 7),
+	)
+	exclusion := models.ReadingExclusion{
+		StartsAt: start.Add(20 * time.Minute), EndsAt: start.Add(20 * time.Minute),
+		SensorPattern: "temp_01", SensorLike: GlobToLike("temp_01"), Reason: "spike", Author: "test",
+	}
+	if err := db.Create(&exclusion).Error; err != nil {
+		t.Fatalf("insert exclusion: %v", err)
+	}
+
+	rows, err := Readings().Bucket(15*time.Minute).Aggregate(Avg, Count).Find(source)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []string
+	for _, row := range rows {
+		got = append(got, row.Timestamp.Format("15:04")+" "+row.SensorName)
+	}
+	if strings.Join(got, ", ") != "12:00 temp_01, 12:00 temp_02" || rows[0].Value != 2 || rows[0].Values[1] != 2 {
+		t.Errorf("rows = %+v, want temp_01 averaging 2 over 2 readings without the excluded one", rows)
+	}
+
+	rows, err = Readings().Sensors("temp_01").IncludeExcluded(true).Find(source)
+	if err != nil || len(rows) != 3 {
+		t.Errorf("with excluded readings: %d rows, %v; want 3", len(rows), err)
+	}
+}
+
+// The exclusions table is looked up when the source is created
+func TestSourceWithoutExclusionsTable(t *testing.T) {
+	source, db := openSource(t, reading("temp_01", time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC), 1))
+	if source.notExcluded == "" {
+		t.Fatal("the source did not find the exclusions table")
+	}
+	if err := db.Migrator().DropTable(&models.ReadingExclusion{}); err != nil {
+		t.Fatalf("drop exclusions: %v", err)
+	}
+	if rows, err := Readings().Find(NewSource(db)); err != nil || len(rows) != 1 {
+		t.Errorf("without exclusions table: %d rows, %v; want 1", len(rows), err)
+	}
+}
+
+// MySQL buckets the stored instant, whatever the session time zone
+func TestMySQLBucketUsesUnixTimestamp(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/sensors?parseTime=true", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open mysql: %v", err)
+	}
+	stmt, err := Readings().Bucket(time.Hour).Build(&Source{db: db})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	sql := stmt.Find(&[]Row{}).Statement.SQL.String()
+	if !strings.Contains(sql, "FLOOR(UNIX_TIMESTAMP(timestamp) / 3600) * 3600 AS bucket") {
+		t.Errorf("SQL = %s, want buckets of UNIX_TIMESTAMP(timestamp)", sql)
+	}
+}
+
+// Reading a query in chunks returns the rows of one query, in order
+func TestParallelMatchesSerial(t *testing.T) {
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	var readings []models.SensorData
+	for minute := 0; minute < 10*60; minute += 7 {
+		at := start.Add(time.Duration(minute) * time.Minute)
+		readings = append(readings, reading("temp_01", at, float64(minute)), reading("temp_02", at, float64(-minute)))
+	}
+	source, _ := openSource(t, readings...)
+
+	queries := map[string]func() *Query{
+		"readings": func() *Query { return Readings() },
+		"bounded": func() *Query {
+			return Readings().Between(start.Add(90*time.Minute), start.Add(5*time.Hour)).Sensors("temp_01")
+		},
+		"buckets":     func() *Query { return Readings().Bucket(45*time.Minute).Aggregate(Avg, Count) },
+		"no buckets":  func() *Query { return Readings().Aggregate(Max) },
+		"empty range": func() *Query { return Readings().Between(start.AddDate(1, 0, 0), time.Time{}) },
+	}
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			want, err := query().Find(source)
+			if err != nil {
+				t.Fatalf("serial: %v", err)
+			}
+			got, err := query().Parallel(3, time.Hour).Find(source)
+			if err != nil {
+				t.Fatalf("parallel: %v", err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("parallel returned %d rows, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].SensorName != want[i].SensorName || got[i].Value != want[i].Value {
+					t.Fatalf("row %d = %+v, want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
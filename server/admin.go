@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+)
+
+// Settings are what the admin API changes while serve runs
+type Settings struct {
+	LogLevel      string  `json:"log_level"`
+	ExportWorkers int     `json:"export_workers"` // Time chunks of an export read at once
+	RateLimit     float64 `json:"rate_limit"`     // Pushed readings per second, 0 for no limit
+}
+
+// settingsChange is the body of a request changing settings; settings left
+// out keep their value
+type settingsChange struct {
+	LogLevel      *string  `json:"log_level"`
+	ExportWorkers *int     `json:"export_workers"`
+	RateLimit     *float64 `json:"rate_limit"`
+}
+
+// settingsResponse reports the settings in effect, those loaded from
+// config.yaml and the names of the settings the admin API overrides
+type settingsResponse struct {
+	Settings   Settings `json:"settings"`
+	Configured Settings `json:"configured"`
+	Overrides  []string `json:"overrides"`
+}
+
+// runtimeSettings holds the settings of the running server: those of
+// config.yaml, with the changes of the admin API until the next reload
+type runtimeSettings struct {
+	mu         sync.Mutex
+	configured Settings
+	current    Settings
+	overrides  map[string]bool
+}
+
+// configuredSettings returns the runtime settings of a configuration
+func configuredSettings(cfg *config.Config) Settings {
+	return Settings{LogLevel: cfg.Logging.LogLevel, ExportWorkers: cfg.Server.ExportWorkers, RateLimit: cfg.Server.RateLimit}
+}
+
+// exportWorkers returns how many time chunks of an export are read at once
+func (rs *runtimeSettings) exportWorkers() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.current.ExportWorkers
+}
+
+// response returns the settings as the admin API reports them
+func (rs *runtimeSettings) response() settingsResponse {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	overrides := make([]string, 0, len(rs.overrides))
+	for name := range rs.overrides {
+		overrides = append(overrides, name)
+	}
+	sort.Strings(overrides)
+	return settingsResponse{Settings: rs.current, Configured: rs.configured, Overrides: overrides}
+}
+
+// apply puts settings into effect
+func (s *Server) apply(settings Settings) {
+	if err := logger.SetLevel(settings.LogLevel); err != nil {
+		logger.Warnf("Keeping log level %s: %v\n", logger.Level(), err)
+	}
+	if s.scanner != nil {
+		s.scanner.SetPushRateLimit(settings.RateLimit)
+	}
+}
+
+// Reload puts the runtime settings of a reloaded configuration into effect,
+// dropping the changes made with the admin API
+func (s *Server) Reload(cfg *config.Config) {
+	rs := &s.settings
+	rs.mu.Lock()
+	dropped := len(rs.overrides)
+	rs.configured = configuredSettings(cfg)
+	rs.current = rs.configured
+	rs.overrides = nil
+	s.apply(rs.current)
+	rs.mu.Unlock()
+	logger.Printf("Reloaded the runtime settings from the configuration, dropping %d admin override(s)\n", dropped)
+}
+
+// SetConfigLoader lets POST /api/v1/admin/reload reload the configuration
+// with load
+func (s *Server) SetConfigLoader(load func() (*config.Config, error)) {
+	s.loadConfig = load
+}
+
+// admin rejects requests without the admin token, and every request while
+// no admin token is configured
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminToken == "" {
+			http.Error(w, "the admin API is disabled: set server.admin_token", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleGetSettings returns the runtime settings
+func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, http.StatusOK, s.settings.response())
+}
+
+// handleChangeSettings changes the runtime settings of a JSON body until the
+// next configuration reload. Nothing is changed unless every setting is valid.
+func (s *Server) handleChangeSettings(w http.ResponseWriter, r *http.Request) {
+	var change settingsChange
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&change); err != nil {
+		http.Error(w, "invalid settings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rs := &s.settings
+	rs.mu.Lock()
+	settings := rs.current
+	var changed []string
+	var problems []error
+	if change.LogLevel != nil {
+		if err := logger.CheckLevel(*change.LogLevel); err != nil {
+			problems = append(problems, err)
+		}
+		settings.LogLevel = *change.LogLevel
+		changed = append(changed, "log_level")
+	}
+	if change.ExportWorkers != nil {
+		if *change.ExportWorkers < 0 {
+			problems = append(problems, fmt.Errorf("invalid export_workers %d (expected 0 or more)", *change.ExportWorkers))
+		}
+		settings.ExportWorkers = *change.ExportWorkers
+		changed = append(changed, "export_workers")
+	}
+	if change.RateLimit != nil {
+		if *change.RateLimit < 0 {
+			problems = append(problems, fmt.Errorf("invalid rate_limit %v (expected 0 or more readings per second)", *change.RateLimit))
+		}
+		settings.RateLimit = *change.RateLimit
+		changed = append(changed, "rate_limit")
+	}
+	if len(problems) > 0 {
+		rs.mu.Unlock()
+		http.Error(w, errors.Join(problems...).Error(), http.StatusBadRequest)
+		return
+	}
+
+	if rs.overrides == nil {
+		rs.overrides = make(map[string]bool)
+	}
+	for _, name := range changed {
+		rs.overrides[name] = true
+	}
+	rs.current = settings
+	s.apply(settings)
+	rs.mu.Unlock()
+
+	if len(changed) > 0 {
+		logger.Printf("Admin API changed %s until the next configuration reload: log level %s, %d export worker(s), rate limit %v readings/s\n",
+			strings.Join(changed, ", "), settings.LogLevel, settings.ExportWorkers, settings.RateLimit)
+	}
+	writeJSONResponse(w, http.StatusOK, s.settings.response())
+}
+
+// handleReload reloads the configuration, dropping the changes made with the
+// admin API. An invalid configuration changes nothing.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if s.loadConfig == nil {
+		http.Error(w, "reloading the configuration is not supported", http.StatusNotImplemented)
+		return
+	}
+	cfg, err := s.loadConfig()
+	if err != nil {
+		logger.Errorf("Failed to reload the configuration: %v\n", err)
+		http.Error(w, "failed to reload the configuration: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	s.Reload(cfg)
+	writeJSONResponse(w, http.StatusOK, s.settings.response())
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sensor_data_import/config"
+	"sensor_data_import/logger"
+	"sensor_data_import/scanner"
+)
+
+// adminServer returns a server with the admin token "secret" and the
+// settings of cfg
+func adminServer(t *testing.T, cfg *config.Config) *Server {
+	t.Helper()
+	level := logger.Level()
+	t.Cleanup(func() { logger.SetLevel(level) })
+
+	cfg.Server.AdminToken = "secret"
+	s := exportServer(t, cfg.Server)
+	s.scanner = scanner.NewCSVScanner(nil)
+	s.Reload(cfg)
+	return s
+}
+
+// adminRequest sends an admin API request with the token and returns the
+// response
+func adminRequest(s *Server, handler http.HandlerFunc, method, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/api/v1/admin/settings", strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	s.admin(handler)(recorder, request)
+	return recorder
+}
+
+func TestAdminRequiresItsToken(t *testing.T) {
+	s := exportServer(t, config.ServerConfig{APIToken: "secret"})
+	if recorder := adminRequest(s, s.handleGetSettings, http.MethodGet, "secret", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("without admin_token: status %d, want 403", recorder.Code)
+	}
+
+	s = adminServer(t, &config.Config{})
+	for _, token := range []string{"", "wrong"} {
+		if recorder := adminRequest(s, s.handleGetSettings, http.MethodGet, token, ""); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want 401", token, recorder.Code)
+		}
+	}
+	if recorder := adminRequest(s, s.handleGetSettings, http.MethodGet, "secret", ""); recorder.Code != http.StatusOK {
+		t.Errorf("admin token: status %d, want 200", recorder.Code)
+	}
+}
+
+func TestAdminChangesSettingsUntilReload(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Logging.LogLevel = "info"
+	cfg.Server.ExportWorkers = 2
+	s := adminServer(t, cfg)
+
+	recorder := adminRequest(s, s.handleChangeSettings, http.MethodPatch, "secret", `{"log_level": "debug", "rate_limit": 500}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("change: status %d, %q", recorder.Code, recorder.Body)
+	}
+	var changed settingsResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&changed); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := Settings{LogLevel: "debug", ExportWorkers: 2, RateLimit: 500}
+	if changed.Settings != want || strings.Join(changed.Overrides, ",") != "log_level,rate_limit" {
+		t.Errorf("after the change: %+v, want %+v overriding log_level and rate_limit", changed, want)
+	}
+	if logger.Level() != "debug" || s.scanner.PushRateLimit() != 500 {
+		t.Errorf("log level %s and rate limit %v not in effect", logger.Level(), s.scanner.PushRateLimit())
+	}
+
+	// A reload returns to the configured settings
+	s.SetConfigLoader(func() (*config.Config, error) { return cfg, nil })
+	recorder = adminRequest(s, s.handleReload, http.MethodPost, "secret", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("reload: status %d, %q", recorder.Code, recorder.Body)
+	}
+	reloaded := s.settings.response()
+	if reloaded.Settings != configuredSettings(cfg) || len(reloaded.Overrides) != 0 {
+		t.Errorf("after the reload: %+v, want the configured settings", reloaded)
+	}
+	if logger.Level() != "info" || s.scanner.PushRateLimit() != 0 {
+		t.Errorf("log level %s and rate limit %v kept after the reload", logger.Level(), s.scanner.PushRateLimit())
+	}
+}
+
+func TestAdminRejectsInvalidSettings(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Logging.LogLevel = "info"
+	s := adminServer(t, cfg)
+
+	for _, body := range []string{
+		`{"log_level": "debug", "rate_limit": -1}`,
+		`{"log_level": "verbose"}`,
+		`{"export_workers": -2}`,
+		`{"workers": 4}`,
+	} {
+		if recorder := adminRequest(s, s.handleChangeSettings, http.MethodPatch, "secret", body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, recorder.Code)
+		}
+	}
+	if current := s.settings.response(); current.Settings != configuredSettings(cfg) || len(current.Overrides) != 0 || logger.Level() != "info" {
+		t.Errorf("rejected changes took effect: %+v", current)
+	}
+
+	// A configuration that fails to load keeps the settings in effect
+	adminRequest(s, s.handleChangeSettings, http.MethodPatch, "secret", `{"export_workers": 8}`)
+	s.SetConfigLoader(func() (*config.Config, error) { return nil, errors.New("bad yaml") })
+	if recorder := adminRequest(s, s.handleReload, http.MethodPost, "secret", ""); recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reload of a bad config: status %d, want 422", recorder.Code)
+	}
+	if s.settings.exportWorkers() != 8 {
+		t.Errorf("export workers %d after a failed reload, want the override kept", s.settings.exportWorkers())
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sensor_data_import/database"
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+	"sensor_data_import/scanner"
+)
+
+// maxRecordBody bounds the size of a request creating an annotation or exclusion
+const maxRecordBody = 64 << 10
+
+// annotationRequest is the body of a request creating an annotation. Times
+// are parsed like the export's from and to parameters.
+type annotationRequest struct {
+	StartsAt      string `json:"starts_at"`
+	EndsAt        string `json:"ends_at"`
+	SensorPattern string `json:"sensor_pattern"`
+	Text          string `json:"text"`
+	Author        string `json:"author"`
+}
+
+// handleListAnnotations returns the annotations matching the from, to and
+// sensors query parameters as JSON
+func (s *Server) handleListAnnotations(w http.ResponseWriter, r *http.Request) {
+	from, to, sensors, err := rangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	annotations, err := database.ListAnnotations(database.AnnotationFilter{From: from, To: to, Sensors: sensors})
+	if err != nil {
+		logger.Errorf("Failed to list annotations: %v\n", err)
+		http.Error(w, "failed to list annotations", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, annotations)
+}
+
+// handleCreateAnnotation stores the annotation of a JSON body and returns it
+// with its ID
+func (s *Server) handleCreateAnnotation(w http.ResponseWriter, r *http.Request) {
+	var request annotationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordBody)).Decode(&request); err != nil {
+		http.Error(w, "invalid annotation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	startsAt, err := scanner.ParseTimeBound(request.StartsAt, now)
+	if err != nil {
+		http.Error(w, "invalid starts_at: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var endsAt time.Time
+	if request.EndsAt != "" {
+		if endsAt, err = scanner.ParseTimeBound(request.EndsAt, now); err != nil {
+			http.Error(w, "invalid ends_at: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	annotation, err := database.NewAnnotation(startsAt, endsAt, request.SensorPattern, request.Text, request.Author)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := database.CreateAnnotation(annotation); err != nil {
+		logger.Errorf("Failed to store annotation: %v\n", err)
+		http.Error(w, "failed to store annotation", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, annotation)
+}
+
+// handleDeleteAnnotation removes the annotation named in the path
+func (s *Server) handleDeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		http.Error(w, "invalid annotation ID", http.StatusBadRequest)
+		return
+	}
+	if err := database.DeleteAnnotation(uint(id)); err != nil {
+		if errors.Is(err, database.ErrAnnotationNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Errorf("Failed to delete annotation %d: %v\n", id, err)
+		http.Error(w, "failed to delete annotation", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// grafanaAnnotationQuery is the body Grafana's JSON data source sends for
+// annotations: the dashboard's time range and the annotation query, which
+// here lists sensor names separated by commas (empty for all sensors)
+type grafanaAnnotationQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Annotation json.RawMessage `json:"annotation"`
+}
+
+// grafanaAnnotation is one annotation in the format Grafana expects, with
+// times in milliseconds since the epoch
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"`
+	TimeEnd    int64           `json:"timeEnd"`
+	IsRegion   bool            `json:"isRegion"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// handleGrafanaPing answers the connection test of Grafana's JSON data source
+func (s *Server) handleGrafanaPing(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGrafanaAnnotations returns the annotations in a dashboard's time
+// range for Grafana's JSON data source
+func (s *Server) handleGrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	var query grafanaAnnotationQuery
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordBody)).Decode(&query); err != nil {
+		http.Error(w, "invalid annotation query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := database.AnnotationFilter{From: query.Range.From, To: query.Range.To}
+	var definition struct {
+		Query string `json:"query"`
+	}
+	json.Unmarshal(query.Annotation, &definition)
+	for _, sensor := range strings.Split(definition.Query, ",") {
+		if sensor = strings.TrimSpace(sensor); sensor != "" {
+			filter.Sensors = append(filter.Sensors, sensor)
+		}
+	}
+
+	annotations, err := database.ListAnnotations(filter)
+	if err != nil {
+		logger.Errorf("Failed to list annotations: %v\n", err)
+		http.Error(w, "failed to list annotations", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]grafanaAnnotation, 0, len(annotations))
+	for _, annotation := range annotations {
+		response = append(response, grafanaAnnotation{
+			Annotation: query.Annotation,
+			Time:       annotation.StartsAt.UnixMilli(),
+			TimeEnd:    annotation.EndsAt.UnixMilli(),
+			IsRegion:   annotation.EndsAt.After(annotation.StartsAt),
+			Title:      annotation.Text,
+			Text:       annotation.Text,
+			Tags:       annotationTags(annotation),
+		})
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// annotationTags tags an annotation in Grafana with its sensor pattern and author
+func annotationTags(annotation models.Annotation) []string {
+	tags := []string{annotation.SensorPattern}
+	if annotation.Author != "" {
+		tags = append(tags, annotation.Author)
+	}
+	return tags
+}
+
+// writeJSONResponse sends a value as JSON with a status code
+func writeJSONResponse(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
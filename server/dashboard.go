@@ -0,0 +1,64 @@
+package server
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sensor_data_import/database"
+	"sensor_data_import/logger"
+)
+
+const (
+	// dashboardDays is how many days the dashboard covers by default
+	dashboardDays = 14
+	// maxDashboardDays bounds the days parameter of the dashboard
+	maxDashboardDays = 90
+	// dashboardRows is how many runs, files and sensors the dashboard lists
+	dashboardRows = 50
+)
+
+// dashboardAssets holds the page and script of the web dashboard. They carry
+// no data, so they are served without the token; the script asks for it
+// and sends it with its API requests.
+//
+//go:embed dashboard
+var dashboardAssets embed.FS
+
+// dashboardFiles serves the web dashboard at /dashboard/
+func dashboardFiles() http.Handler {
+	assets, err := fs.Sub(dashboardAssets, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/dashboard/", http.FileServerFS(assets))
+}
+
+// handleDashboard returns the recent import runs and files, the stalest
+// sensors and the daily trend of the last days query parameter as JSON
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	days := dashboardDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days < 1 || days > maxDashboardDays {
+			http.Error(w, fmt.Sprintf("invalid days %q (expected 1 to %d)", value, maxDashboardDays), http.StatusBadRequest)
+			return
+		}
+	}
+	if s.readings == nil {
+		http.Error(w, "database is not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	dashboard, err := database.LoadDashboard(since, dashboardRows)
+	if err != nil {
+		logger.Errorf("Failed to load the dashboard: %v\n", err)
+		http.Error(w, "failed to load the dashboard", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, dashboard)
+}
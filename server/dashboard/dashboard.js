@@ -0,0 +1,226 @@
+// Web dashboard of serve: polls /api/v1/dashboard and renders the recent
+// import runs and files, the sensor freshness and the daily error trend.
+(function () {
+  "use strict";
+
+  var refreshInterval = 30000;
+  var tokenKey = "sensor_data_import.token";
+  var hour = 3600;
+  var day = 24 * hour;
+
+  var $ = function (id) { return document.getElementById(id); };
+  var timer = null;
+
+  function token() {
+    return sessionStorage.getItem(tokenKey) || "";
+  }
+
+  function load() {
+    clearTimeout(timer);
+    var headers = {};
+    if (token()) {
+      headers.Authorization = "Bearer " + token();
+    }
+    fetch("../api/v1/dashboard?days=" + $("days").value, { headers: headers })
+      .then(function (response) {
+        if (response.status === 401) {
+          sessionStorage.removeItem(tokenKey);
+          $("login").hidden = false;
+          $("content").hidden = true;
+          return null;
+        }
+        if (!response.ok) {
+          return response.text().then(function (text) { throw new Error(text.trim() || response.statusText); });
+        }
+        return response.json();
+      })
+      .then(function (dashboard) {
+        if (dashboard) {
+          render(dashboard);
+          timer = setTimeout(load, refreshInterval);
+        }
+      })
+      .catch(function (err) {
+        showError("Failed to load the dashboard: " + err.message);
+        timer = setTimeout(load, refreshInterval);
+      });
+  }
+
+  function showError(message) {
+    $("error").textContent = message;
+    $("error").hidden = !message;
+  }
+
+  function render(dashboard) {
+    showError("");
+    $("login").hidden = true;
+    $("content").hidden = false;
+    $("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+
+    var missing = dashboard.missing_tables || [];
+    $("missing").textContent = missing.length ? "Tables not created yet (run migrate): " + missing.join(", ") : "";
+    $("missing").hidden = !missing.length;
+
+    renderTrend(dashboard.trend);
+    renderRows("runs", dashboard.runs, "No import runs in this period", function (run) {
+      var duration = run.finished_at ? formatDuration((Date.parse(run.finished_at) - Date.parse(run.started_at)) / 1000) : "not finished";
+      return [
+        cell(run.id, "num"),
+        cell(run.command),
+        cell(run.host),
+        cell(formatTime(run.started_at)),
+        cell(duration),
+        cell(formatNumber(run.files), "num"),
+        cell(formatNumber(run.failed_files), run.failed_files ? "num bad" : "num"),
+        cell(formatNumber(run.records), "num"),
+        cell(formatNumber(run.errors), run.errors ? "num bad" : "num")
+      ];
+    });
+    renderRows("files", dashboard.files, "No files imported yet", function (file) {
+      var path = cell(file.file_path, "path");
+      path.title = file.file_path;
+      return [
+        cell(file.id, "num"),
+        path,
+        cell(formatTime(file.imported_at)),
+        cell(file.completed ? "imported" : "incomplete", file.completed ? "" : "bad"),
+        cell(formatNumber(file.record_count), "num"),
+        cell(formatNumber(file.error_count), file.error_count ? "num bad" : "num"),
+        cell(formatDuration(file.duration_ms / 1000), "num")
+      ];
+    });
+    $("sensor-count").textContent = dashboard.sensor_count > dashboard.sensors.length
+      ? "(stalest " + dashboard.sensors.length + " of " + formatNumber(dashboard.sensor_count) + ")"
+      : "";
+    renderRows("sensors", dashboard.sensors, "No sensors with readings yet", function (sensor) {
+      var age = sensor.age_seconds >= day ? "num bad" : sensor.age_seconds >= hour ? "num late" : "num";
+      return [
+        cell(sensor.sensor_name),
+        cell(formatTime(sensor.timestamp)),
+        cell(formatDuration(sensor.age_seconds), age),
+        cell(sensor.value.toLocaleString(), "num")
+      ];
+    });
+  }
+
+  function renderRows(id, items, empty, cells) {
+    var body = document.querySelector("#" + id + " tbody");
+    body.replaceChildren();
+    if (!items.length) {
+      var row = body.insertRow();
+      var td = cell(empty);
+      td.colSpan = document.querySelectorAll("#" + id + " th").length;
+      row.appendChild(td);
+      return;
+    }
+    items.forEach(function (item) {
+      var row = body.insertRow();
+      cells(item).forEach(function (td) { row.appendChild(td); });
+    });
+  }
+
+  function cell(value, className) {
+    var td = document.createElement("td");
+    td.textContent = value === undefined || value === null ? "" : String(value);
+    if (className) {
+      td.className = className;
+    }
+    return td;
+  }
+
+  // renderTrend draws the parsing errors and failed files of each day as
+  // stacked bars
+  function renderTrend(trend) {
+    var ns = "http://www.w3.org/2000/svg";
+    var width = 800, height = 160, top = 12, bottom = 20;
+    var svg = document.createElementNS(ns, "svg");
+    svg.setAttribute("viewBox", "0 0 " + width + " " + height);
+
+    var max = 1;
+    trend.forEach(function (d) { max = Math.max(max, d.errors + d.failed_files); });
+    var slot = width / trend.length;
+    var scale = (height - top - bottom) / max;
+    var labelEvery = Math.ceil(trend.length / 10);
+
+    trend.forEach(function (d, i) {
+      var x = i * slot + slot * 0.15;
+      var base = height - bottom;
+      [["errors", d.errors], ["failed", d.failed_files]].forEach(function (part) {
+        if (!part[1]) {
+          return;
+        }
+        var rect = document.createElementNS(ns, "rect");
+        rect.setAttribute("class", part[0]);
+        rect.setAttribute("x", x);
+        rect.setAttribute("width", slot * 0.7);
+        rect.setAttribute("y", base - part[1] * scale);
+        rect.setAttribute("height", part[1] * scale);
+        base -= part[1] * scale;
+        svg.appendChild(rect);
+      });
+
+      var hover = document.createElementNS(ns, "rect");
+      hover.setAttribute("x", i * slot);
+      hover.setAttribute("width", slot);
+      hover.setAttribute("y", 0);
+      hover.setAttribute("height", height);
+      hover.setAttribute("fill", "transparent");
+      var title = document.createElementNS(ns, "title");
+      title.textContent = d.day + ": " + d.runs + " runs, " + formatNumber(d.records) + " readings, " +
+        formatNumber(d.errors) + " parsing errors, " + d.failed_files + " failed files";
+      hover.appendChild(title);
+      svg.appendChild(hover);
+
+      if (i % labelEvery === 0) {
+        var label = document.createElementNS(ns, "text");
+        label.setAttribute("x", i * slot + slot / 2);
+        label.setAttribute("y", height - 6);
+        label.setAttribute("text-anchor", "middle");
+        label.textContent = d.day.slice(5);
+        svg.appendChild(label);
+      }
+    });
+
+    var peak = document.createElementNS(ns, "text");
+    peak.setAttribute("x", 2);
+    peak.setAttribute("y", 10);
+    peak.textContent = "max " + formatNumber(max);
+    svg.appendChild(peak);
+
+    $("trend").replaceChildren(svg);
+  }
+
+  function formatTime(value) {
+    return value ? new Date(value).toLocaleString() : "";
+  }
+
+  function formatNumber(value) {
+    return Number(value || 0).toLocaleString();
+  }
+
+  function formatDuration(seconds) {
+    if (seconds < 1) {
+      return Math.round(seconds * 1000) + " ms";
+    }
+    if (seconds < 60) {
+      return seconds.toFixed(1) + " s";
+    }
+    if (seconds < hour) {
+      return Math.floor(seconds / 60) + " min";
+    }
+    if (seconds < day) {
+      return (seconds / hour).toFixed(1) + " h";
+    }
+    return (seconds / day).toFixed(1) + " d";
+  }
+
+  $("login").addEventListener("submit", function (event) {
+    event.preventDefault();
+    sessionStorage.setItem(tokenKey, $("token").value);
+    $("token").value = "";
+    load();
+  });
+  $("days").addEventListener("change", load);
+  $("refresh").addEventListener("click", load);
+  load();
+})();
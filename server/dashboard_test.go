@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/database"
+	"sensor_data_import/models"
+)
+
+// dashboard requests the dashboard data with the query parameters
+func dashboard(t *testing.T, s *Server, params string) (*httptest.ResponseRecorder, database.Dashboard) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	s.authorized(s.handleDashboard)(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/dashboard?"+params, nil))
+	var data database.Dashboard
+	if recorder.Code == http.StatusOK {
+		if err := json.NewDecoder(recorder.Body).Decode(&data); err != nil {
+			t.Fatalf("decode dashboard: %v", err)
+		}
+	}
+	return recorder, data
+}
+
+func TestDashboardReportsRunsFilesAndFreshness(t *testing.T) {
+	s := exportServer(t, config.ServerConfig{})
+	db := database.DB
+	if err := db.AutoMigrate(&models.ImportRun{}, &models.ImportFile{}, &models.SensorLastValue{}); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	finished := yesterday.Add(time.Minute)
+	runs := []models.ImportRun{
+		{Command: "scan", StartedAt: yesterday, FinishedAt: &finished, FileCount: 3, FailedCount: 1, RecordCount: 200, ErrorCount: 7},
+		{Command: "watch", StartedAt: now, FileCount: 1, RecordCount: 50, ErrorCount: 2},
+		{Command: "scan", StartedAt: now.AddDate(0, 0, -30), FileCount: 9, ErrorCount: 99},
+	}
+	files := []models.ImportFile{
+		{FilePath: "data/a.csv", SHA256: "a", ImportedAt: yesterday, RecordCount: 200, ErrorCount: 7, Completed: true},
+		{FilePath: "data/b.csv", SHA256: "b", ImportedAt: now, RecordCount: 50, ErrorCount: 2},
+	}
+	lastValues := []models.SensorLastValue{
+		{SensorName: "temp_01", Timestamp: now.Add(-time.Minute), Value: 21.5, UpdatedAt: now},
+		{SensorName: "temp_02", Timestamp: now.Add(-48 * time.Hour), Value: 19, UpdatedAt: now},
+	}
+	insertRows(t, db, runs...)
+	insertRows(t, db, files...)
+	insertRows(t, db, lastValues...)
+
+	recorder, data := dashboard(t, s, "days=7")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, %q", recorder.Code, recorder.Body)
+	}
+	if len(data.Runs) != 2 || data.Runs[0].Command != "watch" {
+		t.Errorf("runs = %+v, want the watch and the scan of the last 7 days, most recent first", data.Runs)
+	}
+	if len(data.Files) != 2 || data.Files[0].FilePath != "data/b.csv" {
+		t.Errorf("files = %+v, want b.csv first", data.Files)
+	}
+	if len(data.Sensors) != 2 || data.Sensors[0].SensorName != "temp_02" || data.Sensors[0].AgeSeconds < 47*3600 || data.SensorCount != 2 {
+		t.Errorf("sensors = %+v, want temp_02 first, two days old", data.Sensors)
+	}
+	if len(data.Trend) != 7 || len(data.Missing) != 0 {
+		t.Fatalf("trend of %d days, missing %v; want 7 days and no missing tables", len(data.Trend), data.Missing)
+	}
+	last, previous := data.Trend[6], data.Trend[5]
+	if last.Day != now.Format(time.DateOnly) || last.Runs != 1 || last.Errors != 2 {
+		t.Errorf("today = %+v, want the watch run", last)
+	}
+	if previous.Runs != 1 || previous.Files != 3 || previous.FailedFiles != 1 || previous.Records != 200 || previous.Errors != 7 {
+		t.Errorf("yesterday = %+v, want the scan run", previous)
+	}
+
+	if recorder, _ := dashboard(t, s, "days=365"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("days=365: status %d, want 400", recorder.Code)
+	}
+}
+
+func TestDashboardWithoutTables(t *testing.T) {
+	s := exportServer(t, config.ServerConfig{})
+	recorder, data := dashboard(t, s, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, %q", recorder.Code, recorder.Body)
+	}
+	if len(data.Missing) != 3 || len(data.Runs) != 0 || len(data.Trend) != dashboardDays {
+		t.Errorf("dashboard = %+v, want three missing tables and an empty trend of %d days", data, dashboardDays)
+	}
+}
+
+func TestDashboardServesItsAssets(t *testing.T) {
+	s := New(config.ServerConfig{APIToken: "secret"}, nil)
+	for _, path := range []string{"/dashboard/", "/dashboard/dashboard.js"} {
+		recorder := httptest.NewRecorder()
+		s.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK || recorder.Body.Len() == 0 {
+			t.Errorf("%s: status %d, want the asset without a token", path, recorder.Code)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	s.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/dashboard", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("dashboard data without the token: status %d, want 401", recorder.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sensor_data_import/database"
+	"sensor_data_import/logger"
+	"sensor_data_import/models"
+	"sensor_data_import/scanner"
+)
+
+// exclusionRequest is the body of a request excluding readings. Times are
+// parsed like the export's from and to parameters.
+type exclusionRequest struct {
+	StartsAt      string `json:"starts_at"`
+	EndsAt        string `json:"ends_at"`
+	SensorPattern string `json:"sensor_pattern"`
+	Reason        string `json:"reason"`
+	Author        string `json:"author"`
+}
+
+// exclusionResponse is a stored exclusion with the readings it covers
+type exclusionResponse struct {
+	Exclusion *models.ReadingExclusion `json:"exclusion"`
+	Readings  int64                    `json:"readings"`
+}
+
+// handleListExclusions returns the active exclusions as JSON, and revoked
+// ones too with all=true
+func (s *Server) handleListExclusions(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	exclusions, err := database.ListExclusions(all)
+	if err != nil {
+		logger.Errorf("Failed to list exclusions: %v\n", err)
+		http.Error(w, "failed to list exclusions", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, exclusions)
+}
+
+// handleCreateExclusion marks the readings of a JSON body's time range and
+// sensor pattern as excluded
+func (s *Server) handleCreateExclusion(w http.ResponseWriter, r *http.Request) {
+	var request exclusionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordBody)).Decode(&request); err != nil {
+		http.Error(w, "invalid exclusion: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	startsAt, err := scanner.ParseTimeBound(request.StartsAt, now)
+	if err != nil {
+		http.Error(w, "invalid starts_at: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var endsAt time.Time
+	if request.EndsAt != "" {
+		if endsAt, err = scanner.ParseTimeBound(request.EndsAt, now); err != nil {
+			http.Error(w, "invalid ends_at: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	exclusion, err := database.NewExclusion(startsAt, endsAt, request.SensorPattern, request.Reason, request.Author)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	readings, err := database.CreateExclusion(exclusion)
+	if err != nil {
+		logger.Errorf("Failed to store exclusion: %v\n", err)
+		http.Error(w, "failed to store exclusion", http.StatusInternalServerError)
+		return
+	}
+	logger.Printf("Exclusion %d: %d readings of %s excluded (%s)\n", exclusion.ID, readings, exclusion.SensorPattern, exclusion.Reason)
+	writeJSONResponse(w, http.StatusCreated, exclusionResponse{Exclusion: exclusion, Readings: readings})
+}
+
+// handleRevokeExclusion revokes the exclusion named in the path; ?author=
+// records who did
+func (s *Server) handleRevokeExclusion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		http.Error(w, "invalid exclusion ID", http.StatusBadRequest)
+		return
+	}
+	if err := database.RevokeExclusion(uint(id), r.URL.Query().Get("author")); err != nil {
+		if errors.Is(err, database.ErrExclusionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Errorf("Failed to revoke exclusion %d: %v\n", id, err)
+		http.Error(w, "failed to revoke exclusion", http.StatusInternalServerError)
+		return
+	}
+	logger.Printf("Exclusion %d revoked\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"sensor_data_import/database"
+	"sensor_data_import/logger"
+	"sensor_data_import/scanner"
+	"sensor_data_import/sensorquery"
+)
+
+// exportFlushRows is how many rows are written between flushes of the response
+const exportFlushRows = 1000
+
+// exportStateName matches the names of incremental exports
+var exportStateName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,255}$`)
+
+// handleExport streams the readings matching the from, to and sensors query
+// parameters as CSV, leaving out excluded readings unless include_excluded
+// is true. With bucket or aggregate it streams aggregates instead, one column
+// per function. The response is sent in chunks as rows are read, so
+// large ranges do not have to fit in memory on either side; with
+// export_workers, time chunks of the range are read at once. The format
+// parameters adapt the CSV to the system reading it, and pivot writes a
+// column per sensor.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	query, err := exportQuery(r)
+	var pivot bool
+	var incremental string
+	var format exportFormat
+	if err == nil {
+		pivot, err = pivotParams(r, query)
+	}
+	if err == nil {
+		incremental, err = incrementalParam(r, query)
+	}
+	if err == nil {
+		format, err = exportFormatParams(r)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.readings == nil {
+		http.Error(w, "database is not connected", http.StatusInternalServerError)
+		return
+	}
+	var watermark time.Time
+	if incremental != "" {
+		if watermark, err = incrementalExport(r, query, incremental); err != nil {
+			logger.Errorf("Export failed: %v\n", err)
+			http.Error(w, "failed to read the incremental export state", http.StatusInternalServerError)
+			return
+		}
+	}
+	query.Parallel(s.settings.exportWorkers(), s.cfg.ExportChunkDuration())
+
+	header := exportHeader(query)
+	var pivoted *pivotWriter
+	if pivot {
+		sensors, err := query.SensorNames(r.Context(), s.readings)
+		if err != nil {
+			logger.Errorf("Export failed: %v\n", err)
+			http.Error(w, "failed to list the sensors to pivot", http.StatusInternalServerError)
+			return
+		}
+		pivoted = newPivotWriter(format, sensors)
+		header = pivoted.header()
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="readings.csv"`)
+	flusher, _ := w.(http.Flusher)
+
+	writer := csv.NewWriter(w)
+	writer.Comma = format.delimiter
+	if format.header {
+		writer.Write(header)
+	}
+
+	rows := 0
+	write := func(record []string) error {
+		writer.Write(record)
+		rows++
+		if rows%exportFlushRows == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return writer.Error()
+	}
+	err = query.Stream(r.Context(), s.readings, func(row sensorquery.Row) error {
+		if pivoted == nil {
+			return write(exportRecord(query, format, row))
+		}
+		if record := pivoted.add(row); record != nil {
+			return write(record)
+		}
+		return nil
+	})
+	if pivoted != nil && err == nil {
+		if record := pivoted.flush(); record != nil {
+			err = write(record)
+		}
+	}
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	// The next export continues after the readings of this one only once
+	// every row is written
+	if err == nil && incremental != "" {
+		err = database.SaveExportState(incremental, watermark)
+	}
+
+	if err != nil {
+		// The status is already sent; abort the connection so the client
+		// does not mistake a truncated export for a complete one
+		logger.Errorf("Export failed after %d rows: %v\n", rows, err)
+		panic(http.ErrAbortHandler)
+	}
+	logger.Debugf("Exported %d rows\n", rows)
+}
+
+// exportRecord returns the CSV fields of a reading or of the aggregates of
+// a sensor
+func exportRecord(query *sensorquery.Query, format exportFormat, row sensorquery.Row) []string {
+	var record []string
+	if !query.Aggregated() || query.Bucketed() {
+		record = append(record, format.timestamp(row.Timestamp))
+	}
+	record = append(record, row.SensorName)
+	if !query.Aggregated() {
+		return append(record, format.value(row.Value))
+	}
+	for _, value := range row.Values {
+		record = append(record, format.value(value))
+	}
+	return record
+}
+
+// exportHeader names the CSV columns of an export
+func exportHeader(query *sensorquery.Query) []string {
+	if !query.Aggregated() {
+		return []string{"timestamp", "sensor_name", "value"}
+	}
+	var header []string
+	if query.Bucketed() {
+		header = append(header, "timestamp")
+	}
+	header = append(header, "sensor_name")
+	for _, fn := range query.Functions() {
+		header = append(header, string(fn))
+	}
+	return header
+}
+
+// exportQuery builds the export query from the query parameters. Sensors and
+// aggregates may be repeated or comma-separated.
+func exportQuery(r *http.Request) (*sensorquery.Query, error) {
+	from, to, sensors, err := rangeParams(r)
+	if err != nil {
+		return nil, err
+	}
+	query := sensorquery.Readings().Between(from, to).Sensors(sensors...)
+	params := r.URL.Query()
+
+	if value := params.Get("include_excluded"); value != "" {
+		include, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include_excluded %q (expected true or false)", value)
+		}
+		query.IncludeExcluded(include)
+	}
+
+	if value := params.Get("bucket"); value != "" {
+		width, err := time.ParseDuration(value)
+		if err != nil || width < time.Second || width%time.Second != 0 {
+			return nil, fmt.Errorf("invalid bucket %q (expected a duration of whole seconds, e.g. 15m)", value)
+		}
+		query.Bucket(width)
+	}
+
+	for _, name := range listParam(params["aggregate"]) {
+		fn, err := sensorquery.ParseFunction(name)
+		if err != nil {
+			return nil, err
+		}
+		query.Aggregate(fn)
+	}
+	return query, nil
+}
+
+// incrementalParam returns the name of an incremental export, which the
+// incremental parameter gives, or "" for a full export
+func incrementalParam(r *http.Request, query *sensorquery.Query) (string, error) {
+	name := r.URL.Query().Get("incremental")
+	if name == "" {
+		return "", nil
+	}
+	if !exportStateName.MatchString(name) {
+		return "", fmt.Errorf("invalid incremental %q (expected a name of letters, digits, '.', '_' and '-')", name)
+	}
+	if query.Aggregated() {
+		return "", fmt.Errorf("incremental exports return readings: leave out bucket and aggregate")
+	}
+	return name, nil
+}
+
+// incrementalExport limits the query to the readings stored since the
+// previous export of the same name, up to the watermark it returns, which
+// that export saves once it has written every row. A reading is stored when
+// its transaction commits, so the watermark lies before the oldest one still
+// open, and a watermark held back by a long transaction before the saved one
+// exports nothing until the transaction ends.
+func incrementalExport(r *http.Request, query *sensorquery.Query, name string) (time.Time, error) {
+	after, err := database.LoadExportState(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	watermark, err := database.ExportWatermark(r.Context())
+	if err != nil {
+		return time.Time{}, err
+	}
+	if watermark.Before(after) {
+		watermark = after
+	}
+	query.Added(after, watermark)
+	return watermark, nil
+}
+
+// rangeParams reads the from, to and sensors query parameters shared by the
+// export and the annotations
+func rangeParams(r *http.Request) (from, to time.Time, sensors []string, err error) {
+	params := r.URL.Query()
+	now := time.Now()
+	if value := params.Get("from"); value != "" {
+		if from, err = scanner.ParseTimeBound(value, now); err != nil {
+			return
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if to, err = scanner.ParseTimeBound(value, now); err != nil {
+			return
+		}
+	}
+	return from, to, listParam(params["sensors"]), nil
+}
+
+// listParam splits repeated, comma-separated query parameter values
+func listParam(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
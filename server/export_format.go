@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Named timestamp formats of exports; other values are Go time layouts
+const (
+	timeFormatRFC3339 = "rfc3339"
+	timeFormatUnix    = "unix"
+	timeFormatUnixMs  = "unix_ms"
+)
+
+// maxExportPrecision bounds the decimal places of exported values; a float64
+// holds no more significant digits
+const maxExportPrecision = 17
+
+// exportFormat is how the fields of an export are written, so the CSV can
+// match what a downstream system expects
+type exportFormat struct {
+	timeFormat string         // A named format or a Go time layout
+	location   *time.Location // Zone of formatted timestamps
+	precision  int            // Decimal places of values; -1 for as many as needed
+	delimiter  rune
+	header     bool
+}
+
+// exportFormatParams reads the time_format, timezone, precision, delimiter
+// and header query parameters. The defaults write RFC 3339 timestamps in UTC,
+// values with as many decimals as needed, commas and a header row.
+func exportFormatParams(r *http.Request) (exportFormat, error) {
+	params := r.URL.Query()
+	format := exportFormat{timeFormat: timeFormatRFC3339, location: time.UTC, precision: -1, delimiter: ',', header: true}
+
+	if value := params.Get("time_format"); value != "" {
+		switch value {
+		case timeFormatRFC3339, timeFormatUnix, timeFormatUnixMs:
+		default:
+			// A layout without any element would write the same text for every row
+			if sample := time.Date(1999, 12, 31, 23, 58, 59, 0, time.UTC); sample.Format(value) == value {
+				return format, fmt.Errorf("invalid time_format %q (expected rfc3339, unix, unix_ms or a Go layout such as 2006-01-02 15:04:05)", value)
+			}
+		}
+		format.timeFormat = value
+	}
+
+	if value := params.Get("timezone"); value != "" {
+		location, err := time.LoadLocation(value)
+		if err != nil {
+			return format, fmt.Errorf("invalid timezone %q (expected an IANA name such as Asia/Tokyo)", value)
+		}
+		format.location = location
+	}
+
+	if value := params.Get("precision"); value != "" {
+		precision, err := strconv.Atoi(value)
+		if err != nil || precision < 0 || precision > maxExportPrecision {
+			return format, fmt.Errorf("invalid precision %q (expected 0 to %d decimal places)", value, maxExportPrecision)
+		}
+		format.precision = precision
+	}
+
+	if value := params.Get("delimiter"); value != "" {
+		if value == "tab" || value == `\t` {
+			value = "\t"
+		}
+		delimiter, size := utf8.DecodeRuneInString(value)
+		if size != len(value) || strings.ContainsRune("\"\r\n", delimiter) || delimiter == utf8.RuneError {
+			return format, fmt.Errorf("invalid delimiter %q (expected one character such as ; or tab)", value)
+		}
+		format.delimiter = delimiter
+	}
+
+	if value := params.Get("header"); value != "" {
+		header, err := strconv.ParseBool(value)
+		if err != nil {
+			return format, fmt.Errorf("invalid header %q (expected true or false)", value)
+		}
+		format.header = header
+	}
+	return format, nil
+}
+
+// timestamp formats the time of a reading or the start of a bucket
+func (f exportFormat) timestamp(t time.Time) string {
+	switch f.timeFormat {
+	case timeFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case timeFormatUnixMs:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case timeFormatRFC3339:
+		return t.In(f.location).Format(time.RFC3339)
+	}
+	return t.In(f.location).Format(f.timeFormat)
+}
+
+// value formats a reading or an aggregate
+func (f exportFormat) value(value float64) string {
+	return strconv.FormatFloat(value, 'f', f.precision, 64)
+}
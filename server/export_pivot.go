@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sensor_data_import/sensorquery"
+)
+
+// pivotParams reads the pivot and resample query parameters. A pivoted
+// export has one timestamp column and one column per sensor; resample
+// averages each sensor over intervals of the given width, or applies the
+// single function named by aggregate.
+func pivotParams(r *http.Request, query *sensorquery.Query) (bool, error) {
+	params := r.URL.Query()
+	pivot := false
+	if value := params.Get("pivot"); value != "" {
+		var err error
+		if pivot, err = strconv.ParseBool(value); err != nil {
+			return false, fmt.Errorf("invalid pivot %q (expected true or false)", value)
+		}
+	}
+	resample := params.Get("resample")
+	if !pivot {
+		if resample != "" {
+			return false, fmt.Errorf("resample requires pivot=true; use bucket for aggregates in rows")
+		}
+		return false, nil
+	}
+
+	if params.Get("bucket") != "" {
+		return false, fmt.Errorf("pivoted exports take resample instead of bucket")
+	}
+	if resample != "" {
+		width, err := time.ParseDuration(resample)
+		if err != nil || width < time.Second || width%time.Second != 0 {
+			return false, fmt.Errorf("invalid resample %q (expected a duration of whole seconds, e.g. 15m)", resample)
+		}
+		query.Bucket(width)
+	}
+	if query.Aggregated() && !query.Bucketed() {
+		return false, fmt.Errorf("pivoted exports aggregate per resample interval: add resample")
+	}
+	if len(query.Functions()) > 1 {
+		return false, fmt.Errorf("pivoted exports take one aggregate, one column per sensor")
+	}
+	return true, nil
+}
+
+// pivotWriter collects the rows of one timestamp into a record with a
+// column per sensor. Rows arrive ordered by timestamp, so a record is
+// complete when the next timestamp starts.
+type pivotWriter struct {
+	format  exportFormat
+	columns map[string]int // Column of each sensor
+	time    time.Time      // Timestamp of the record being collected
+	record  []string       // Nil until a row is added
+}
+
+// newPivotWriter returns a writer of records with a column per sensor
+func newPivotWriter(format exportFormat, sensors []string) *pivotWriter {
+	columns := make(map[string]int, len(sensors))
+	for i, sensor := range sensors {
+		columns[sensor] = i + 1
+	}
+	return &pivotWriter{format: format, columns: columns}
+}
+
+// header names the timestamp column and the sensor columns
+func (p *pivotWriter) header() []string {
+	header := make([]string, len(p.columns)+1)
+	header[0] = "timestamp"
+	for sensor, column := range p.columns {
+		header[column] = sensor
+	}
+	return header
+}
+
+// add adds the value of a row and returns the record of the previous
+// timestamp once the row starts a new one
+func (p *pivotWriter) add(row sensorquery.Row) []string {
+	var complete []string
+	if p.record != nil && !row.Timestamp.Equal(p.time) {
+		complete = p.flush()
+	}
+	if p.record == nil {
+		p.time = row.Timestamp
+		p.record = make([]string, len(p.columns)+1)
+		p.record[0] = p.format.timestamp(row.Timestamp)
+	}
+	// Sensors with readings added after the columns were listed are left out
+	if column, ok := p.columns[row.SensorName]; ok {
+		p.record[column] = p.format.value(row.Value)
+	}
+	return complete
+}
+
+// flush returns the record being collected, or nil when there is none
+func (p *pivotWriter) flush() []string {
+	record := p.record
+	p.record = nil
+	return record
+}
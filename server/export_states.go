@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"sensor_data_import/database"
+	"sensor_data_import/logger"
+)
+
+// handleListExportStates returns the watermarks of the incremental exports
+// as JSON
+func (s *Server) handleListExportStates(w http.ResponseWriter, r *http.Request) {
+	states, err := database.ListExportStates()
+	if err != nil {
+		logger.Errorf("Failed to list export states: %v\n", err)
+		http.Error(w, "failed to list export states", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, states)
+}
+
+// handleDeleteExportState forgets the incremental export named in the path,
+// so its next export returns every reading again
+func (s *Server) handleDeleteExportState(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := database.DeleteExportState(name); err != nil {
+		if errors.Is(err, database.ErrExportStateNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Errorf("Failed to delete export state %s: %v\n", name, err)
+		http.Error(w, "failed to delete export state", http.StatusInternalServerError)
+		return
+	}
+	logger.Printf("Export state %s deleted\n", name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/database"
+	"sensor_data_import/models"
+	"sensor_data_import/sensorquery"
+)
+
+// exportServer returns a server exporting the readings from a new SQLite
+// database, which is also the connected database keeping export states
+func exportServer(t *testing.T, cfg config.ServerConfig, readings ...models.SensorData) *Server {
+	t.Helper()
+	db := openTestDB(t, &models.SensorData{}, &models.ExportState{})
+	database.DB = db
+	t.Cleanup(func() { database.DB = nil })
+	if len(readings) > 0 {
+		insertRows(t, db, readings...)
+	}
+	return &Server{cfg: cfg, readings: sensorquery.NewSource(db)}
+}
+
+// export requests the export with the query parameters and returns the
+// response
+func export(t *testing.T, s *Server, params string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	s.handleExport(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/export?"+params, nil))
+	return recorder
+}
+
+// hourlyReadings returns a reading of each sensor every 20 minutes for hours
+// hours from 2025-09-01 00:00 UTC
+func hourlyReadings(hours int, sensors ...string) []models.SensorData {
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	var readings []models.SensorData
+	for minute := 0; minute < hours*60; minute += 20 {
+		for i, sensor := range sensors {
+			readings = append(readings, models.SensorData{
+				Timestamp:  start.Add(time.Duration(minute) * time.Minute),
+				SensorName: sensor,
+				Value:      float64(minute) + float64(i)/4,
+			})
+		}
+	}
+	return readings
+}
+
+func TestExportWorkers(t *testing.T) {
+	readings := hourlyReadings(6, "temp_01", "temp_02")
+	serial := exportServer(t, config.ServerConfig{}, readings...)
+	parallel := exportServer(t, config.ServerConfig{ExportWorkers: 4, ExportChunk: "1h"}, readings...)
+
+	for _, params := range []string{"", "sensors=temp_02&from=2025-09-01T01:30:00Z", "bucket=2h&aggregate=avg,count"} {
+		want := export(t, serial, params)
+		got := export(t, parallel, params)
+		if want.Code != http.StatusOK || got.Code != http.StatusOK {
+			t.Fatalf("%q: status %d and %d, want 200", params, want.Code, got.Code)
+		}
+		if got.Body.String() != want.Body.String() {
+			t.Errorf("%q: parallel export =\n%s\nwant\n%s", params, got.Body, want.Body)
+		}
+	}
+}
+
+// Each incremental export returns the readings stored since the watermark
+// of the previous one, leaving out those stored in the last minute
+func TestIncrementalExport(t *testing.T) {
+	now := time.Now()
+	at := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	reading := func(minute int, added time.Duration) models.SensorData {
+		return models.SensorData{Timestamp: at.Add(time.Duration(minute) * time.Minute), SensorName: "temp_01", Value: float64(minute), CreatedAt: now.Add(-added)}
+	}
+	// The last reading was just stored, so its transaction may still be open
+	s := exportServer(t, config.ServerConfig{}, reading(1, 2*time.Hour), reading(2, 30*time.Minute), reading(3, 0))
+
+	values := func(params string) []string {
+		t.Helper()
+		response := export(t, s, params)
+		if response.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", params, response.Code, response.Body)
+		}
+		var values []string
+		for _, line := range strings.Split(strings.TrimSpace(response.Body.String()), "\n")[1:] {
+			values = append(values, line[strings.LastIndex(line, ",")+1:])
+		}
+		return values
+	}
+
+	if got := values("incremental=nightly"); strings.Join(got, " ") != "1 2" {
+		t.Errorf("first export = %v, want the readings stored before the watermark", got)
+	}
+	watermark, err := database.LoadExportState("nightly")
+	if err != nil || watermark.After(now) || watermark.Before(now.Add(-time.Minute)) {
+		t.Errorf("saved watermark = %v, %v; want shortly before %v", watermark, err, now)
+	}
+	if got := values("incremental=nightly"); len(got) != 0 {
+		t.Errorf("repeated export = %v, want nothing new", got)
+	}
+	if got := values("incremental=hourly"); strings.Join(got, " ") != "1 2" {
+		t.Errorf("export of another name = %v, want every settled reading", got)
+	}
+
+	// An export continues after the saved watermark
+	if err := database.SaveExportState("nightly", now.Add(-time.Hour)); err != nil {
+		t.Fatalf("SaveExportState: %v", err)
+	}
+	if got := values("incremental=nightly"); strings.Join(got, " ") != "2" {
+		t.Errorf("export after an hour ago = %v, want the reading stored since", got)
+	}
+
+	request := httptest.NewRequest(http.MethodDelete, "/api/v1/export/states/nightly", nil)
+	request.SetPathValue("name", "nightly")
+	recorder := httptest.NewRecorder()
+	s.handleDeleteExportState(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("delete state: status %d: %s", recorder.Code, recorder.Body)
+	}
+	if got := values("incremental=nightly"); strings.Join(got, " ") != "1 2" {
+		t.Errorf("export after deleting the state = %v, want every settled reading", got)
+	}
+
+	for _, params := range []string{"incremental=night%20ly", "incremental=nightly&bucket=1h"} {
+		if response := export(t, s, params); response.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", params, response.Code)
+		}
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	at := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	s := exportServer(t, config.ServerConfig{}, models.SensorData{Timestamp: at, SensorName: "temp_01", Value: 21.456})
+
+	tests := []struct {
+		params string
+		want   string
+	}{
+		{"", "timestamp,sensor_name,value\n2025-09-01T12:00:00Z,temp_01,21.456\n"},
+		{"time_format=unix&precision=1&header=false", "1756728000,temp_01,21.5\n"},
+		{"time_format=unix_ms&delimiter=tab", "timestamp\tsensor_name\tvalue\n1756728000000\ttemp_01\t21.456\n"},
+		{"time_format=2006/01/02+15:04&timezone=Asia/Tokyo&delimiter=%3B&precision=0", "timestamp;sensor_name;value\n2025/09/01 21:00;temp_01;21\n"},
+		{"timezone=Asia/Tokyo&bucket=1h&aggregate=max&header=false", "2025-09-01T21:00:00+09:00,temp_01,21.456\n"},
+	}
+	for _, tt := range tests {
+		response := export(t, s, tt.params)
+		if response.Code != http.StatusOK || response.Body.String() != tt.want {
+			t.Errorf("%s: status %d, body %q; want %q", tt.params, response.Code, response.Body, tt.want)
+		}
+	}
+
+	for _, params := range []string{"time_format=iso", "timezone=Mars/Olympus", "precision=-1", "precision=18", "delimiter=ab", `delimiter="`, "header=maybe"} {
+		if response := export(t, s, params); response.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", params, response.Code)
+		}
+	}
+}
+
+func TestPivotExport(t *testing.T) {
+	at := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	s := exportServer(t, config.ServerConfig{}, []models.SensorData{
+		{Timestamp: at, SensorName: "temp_01", Value: 20},
+		{Timestamp: at, SensorName: "humidity_01", Value: 55},
+		{Timestamp: at.Add(10 * time.Minute), SensorName: "temp_01", Value: 22},
+		{Timestamp: at.Add(20 * time.Minute), SensorName: "humidity_01", Value: 57},
+		{Timestamp: at.Add(30 * time.Minute), SensorName: "pressure_01", Value: 1013},
+	}...)
+
+	tests := []struct {
+		params string
+		want   string
+	}{
+		{"pivot=true&to=2025-09-01T12:25:00Z", "timestamp,humidity_01,temp_01\n" +
+			"2025-09-01T12:00:00Z,55,20\n2025-09-01T12:10:00Z,,22\n2025-09-01T12:20:00Z,57,\n"},
+		{"pivot=true&resample=30m&time_format=unix", "timestamp,humidity_01,pressure_01,temp_01\n" +
+			"1756728000,56,,21\n1756729800,,1013,\n"},
+		{"pivot=true&resample=1h&aggregate=max&sensors=temp_01&header=false", "2025-09-01T12:00:00Z,22\n"},
+	}
+	for _, tt := range tests {
+		response := export(t, s, tt.params)
+		if response.Code != http.StatusOK || response.Body.String() != tt.want {
+			t.Errorf("%s: status %d, body %q; want %q", tt.params, response.Code, response.Body, tt.want)
+		}
+	}
+
+	for _, params := range []string{"resample=1h", "pivot=true&bucket=1h", "pivot=true&aggregate=max", "pivot=true&resample=1h&aggregate=min,max", "pivot=true&resample=1.5s"} {
+		if response := export(t, s, params); response.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", params, response.Code)
+		}
+	}
+}
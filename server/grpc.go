@@ -0,0 +1,128 @@
+package server
+
+//go:generate protoc --go_out=.. --go_opt=module=sensor_data_import --go-grpc_out=.. --go-grpc_opt=module=sensor_data_import ingest.proto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/scanner"
+	"sensor_data_import/server/sensordatav1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // Accept gzip-compressed requests
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ingestService implements the ReadingIngest service of ingest.proto
+type ingestService struct {
+	sensordatav1.UnimplementedReadingIngestServer
+	scanner *scanner.CSVScanner
+}
+
+// newGRPCServer returns the gRPC server of the ingest service. It is served
+// through the HTTP server, on the same port as the HTTP API.
+func (s *Server) newGRPCServer() *grpc.Server {
+	grpcServer := grpc.NewServer(grpc.StreamInterceptor(s.authorizedStream))
+	sensordatav1.RegisterReadingIngestServer(grpcServer, &ingestService{scanner: s.scanner})
+	return grpcServer
+}
+
+// authorizedStream rejects streams without the configured bearer token, and
+// every stream while ingest is refused for pending migrations
+func (s *Server) authorizedStream(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var header string
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+	if !s.validToken(header) {
+		return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	if err := s.ingestReady(); err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return handler(srv, stream)
+}
+
+// WriteReadings serves the client-streaming WriteReadings RPC. Each request
+// is validated and buffered, and full batches are inserted before the next
+// request is read, so HTTP/2 flow control slows down a client that sends
+// faster than the database accepts.
+func (is *ingestService) WriteReadings(stream sensordatav1.ReadingIngest_WriteReadingsServer) error {
+	ctx := stream.Context()
+	name := "grpc"
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("stream-name"); len(values) > 0 && values[0] != "" {
+			name = values[0]
+		}
+	}
+	var host string
+	if client, ok := peer.FromContext(ctx); ok {
+		host, _, _ = net.SplitHostPort(client.Addr.String())
+	}
+	source := "grpc://" + host + "/" + name
+	push := is.scanner.NewPushStream(name, source)
+
+	err := receiveReadings(ctx, stream, push)
+	stats, closeErr := push.Close(context.WithoutCancel(ctx))
+	if err == nil {
+		err = closeErr
+	}
+	logger.Printf("gRPC stream %s: %d messages, %d readings inserted, %d existing skipped, %d rejected in %d batches\n",
+		source, stats.Messages, stats.Readings, stats.Skipped, stats.Errors, stats.Flushes)
+
+	if _, isStatus := status.FromError(err); err != nil && isStatus {
+		return err // The stream itself failed, e.g. was cancelled
+	}
+	switch {
+	case err == nil:
+		return stream.SendAndClose(&sensordatav1.WriteReadingsResponse{
+			Messages: int64(stats.Messages),
+			Inserted: int64(stats.Readings),
+			Skipped:  int64(stats.Skipped),
+			Rejected: int64(stats.Errors),
+			Batches:  int64(stats.Flushes),
+		})
+	case ctx.Err() != nil:
+		return status.Error(codes.Canceled, "stream cancelled")
+	default:
+		// Batches committed before the failure stay; the client resends the
+		// rest and the committed readings are skipped
+		logger.Errorf("gRPC stream %s failed: %v\n", source, err)
+		return status.Error(codes.Unavailable, fmt.Sprintf("failed to insert readings after %d were committed: %v",
+			stats.Readings+stats.Skipped, err))
+	}
+}
+
+// receiveReadings passes the readings of every request on the stream to
+// push until the client closes it
+func receiveReadings(ctx context.Context, stream sensordatav1.ReadingIngest_WriteReadingsServer, push *scanner.PushStream) error {
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		readings := make([]scanner.PushReading, 0, len(request.GetReadings()))
+		for _, reading := range request.GetReadings() {
+			pushed := scanner.PushReading{SensorName: reading.GetSensorName(), Value: reading.GetValue()}
+			if timestamp := reading.GetTimestamp(); timestamp != nil {
+				pushed.Timestamp = timestamp.AsTime()
+			}
+			readings = append(readings, pushed)
+		}
+		if err := push.Add(ctx, readings); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/models"
+	"sensor_data_import/scanner"
+	"sensor_data_import/server/sensordatav1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// startServer serves the API with the token on a free loopback port, storing
+// readings in a new SQLite database, until the test ends
+func startServer(t *testing.T, token string) (string, *gorm.DB) {
+	t.Helper()
+	db := openTestDB(t, &models.SensorData{}, &models.ImportRun{}, &models.ImportFile{}, &models.SensorDataReject{})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("find a free port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	csvScanner := scanner.NewCSVScanner(db)
+	if err := csvScanner.Configure(config.ScannerConfig{InsertPolicy: scanner.InsertPolicyError}); err != nil {
+		t.Fatalf("configure scanner: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- New(config.ServerConfig{Listen: addr, APIToken: token}, csvScanner).Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("server: %v", err)
+		}
+	})
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr, db
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("server did not start listening on %s", addr)
+		}
+	}
+}
+
+// ingestClient connects a grpc-go client of the ingest service
+func ingestClient(t *testing.T, addr string) sensordatav1.ReadingIngestClient {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return sensordatav1.NewReadingIngestClient(conn)
+}
+
+// writeReadings sends each request on one stream and returns the response
+func writeReadings(ctx context.Context, client sensordatav1.ReadingIngestClient, requests ...*sensordatav1.WriteReadingsRequest) (*sensordatav1.WriteReadingsResponse, error) {
+	stream, err := client.WriteReadings(ctx, grpc.UseCompressor(gzip.Name))
+	if err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		if err := stream.Send(request); err != nil {
+			break // The status is returned by CloseAndRecv
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestWriteReadingsRoundTrip(t *testing.T) {
+	addr, db := startServer(t, "secret")
+	client := ingestClient(t, addr)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret", "stream-name", "gateway_7")
+
+	at := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	requests := []*sensordatav1.WriteReadingsRequest{
+		{Readings: []*sensordatav1.Reading{
+			{SensorName: "temp_01", Timestamp: timestamppb.New(at), Value: 21.5},
+			{SensorName: "temp_02", Value: 19}, // No timestamp
+		}},
+		{Readings: []*sensordatav1.Reading{
+			{SensorName: "temp_01", Timestamp: timestamppb.New(at.Add(time.Minute)), Value: 21.75},
+		}},
+	}
+
+	response, err := writeReadings(ctx, client, requests...)
+	if err != nil {
+		t.Fatalf("WriteReadings: %v", err)
+	}
+	if response.GetMessages() != 2 || response.GetInserted() != 2 || response.GetRejected() != 1 || response.GetSkipped() != 0 {
+		t.Errorf("response = %v, want 2 messages, 2 inserted and 1 rejected", response)
+	}
+
+	var stored []models.SensorData
+	if err := db.Order("timestamp").Find(&stored).Error; err != nil {
+		t.Fatalf("read readings: %v", err)
+	}
+	if len(stored) != 2 || stored[0].Value != 21.5 || !stored[1].Timestamp.Equal(at.Add(time.Minute)) {
+		t.Errorf("stored readings = %+v, want temp_01 at 12:00 and 12:01", stored)
+	}
+
+	// A resent stream is answered with its readings skipped
+	response, err = writeReadings(ctx, client, requests...)
+	if err != nil {
+		t.Fatalf("WriteReadings again: %v", err)
+	}
+	if response.GetInserted() != 0 || response.GetSkipped() != 2 {
+		t.Errorf("resent response = %v, want 2 skipped", response)
+	}
+}
+
+func TestWriteReadingsRequiresToken(t *testing.T) {
+	addr, _ := startServer(t, "secret")
+	client := ingestClient(t, addr)
+
+	for _, header := range []string{"", "Bearer wrong"} {
+		ctx := context.Background()
+		if header != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", header)
+		}
+		_, err := writeReadings(ctx, client, &sensordatav1.WriteReadingsRequest{})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("authorization %q: %v, want Unauthenticated", header, err)
+		}
+	}
+}
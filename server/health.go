@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"sensor_data_import/database"
+)
+
+// schemaRecheck is how long a pending-migration check is trusted before the
+// migration table is read again, while migrations are pending
+const schemaRecheck = 10 * time.Second
+
+// healthPath is the route of the health check, which is neither
+// authenticated nor logged, so load balancers can poll it
+const healthPath = "/healthz"
+
+// schemaGate refuses ingest while migrations shipped with this build are
+// not applied to the database, as inserts into an older schema fail or leave
+// out what the newer code expects. The gate opens as soon as the migrations
+// are applied, for instance by migrate from another host; applied migrations
+// are never undone, so it stays open after.
+type schemaGate struct {
+	check func() ([]string, error) // Versions of the pending migrations
+
+	mu      sync.Mutex
+	pending []string
+	err     error
+	checked time.Time
+}
+
+// state returns the pending migrations, or the error checking them,
+// checking again once the last result is older than schemaRecheck
+func (g *schemaGate) state() ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	open := !g.checked.IsZero() && g.err == nil && len(g.pending) == 0
+	if !open && time.Since(g.checked) >= schemaRecheck {
+		g.pending, g.err = g.check()
+		g.checked = time.Now()
+	}
+	return g.pending, g.err
+}
+
+// ready returns why ingest is refused, or nil when the schema is current
+func (g *schemaGate) ready() error {
+	if g == nil {
+		return nil
+	}
+	pending, err := g.state()
+	if err != nil {
+		return fmt.Errorf("schema version unknown: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migration(s) pending (%s): run migrate, or set migration.auto_migrate", len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// CheckSchema refuses ingest over HTTP and gRPC while check, which returns
+// the versions of the pending migrations, reports any; the health check
+// reports them too. Without it the schema is not checked.
+func (s *Server) CheckSchema(check func() ([]string, error)) {
+	s.schema = &schemaGate{check: check}
+}
+
+// ingestReady returns why pushed readings are refused, or nil
+func (s *Server) ingestReady() error {
+	if err := s.schema.ready(); err != nil {
+		return fmt.Errorf("ingest is refused: %w", err)
+	}
+	if s.scanner != nil && s.scanner.Paused() {
+		return errors.New("ingest is paused: run control resume to continue")
+	}
+	return nil
+}
+
+// healthResponse is the body of the health check
+type healthResponse struct {
+	Status   string `json:"status"` // ok, or unavailable when the database or the schema is not
+	Database string `json:"database"`
+	Schema   string `json:"schema"`
+}
+
+// handleHealth reports whether the database is reachable and its schema
+// current, with status 200 when both are and 503 otherwise
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{Status: "ok", Database: "ok", Schema: "current"}
+	if !database.IsConnected() {
+		response.Status, response.Database = "unavailable", "unreachable"
+	}
+	if err := s.schema.ready(); err != nil {
+		response.Status, response.Schema = "unavailable", err.Error()
+	}
+	status := http.StatusOK
+	if response.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSONResponse(w, status, response)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+
+	"sensor_data_import/logger"
+	"sensor_data_import/scanner"
+)
+
+// maxPushBody bounds the size of a pushed payload
+const maxPushBody = 32 << 20
+
+// handleReadings inserts the readings of a CSV or JSON body: a single object,
+// an array of objects, or timestamp,sensor_name,value lines. Rejected readings
+// are listed in the response; the others are inserted.
+func (s *Server) handleReadings(w http.ResponseWriter, r *http.Request) {
+	if err := s.ingestReady(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "http"
+	}
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	result, err := s.scanner.Push(r.Context(), payload, pushFormat(r), name, "http://"+host+"/"+name)
+	if errors.Is(err, scanner.ErrInvalidPayload) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Errorf("Failed to insert pushed readings: %v\n", err)
+		http.Error(w, "failed to insert readings", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Inserted+result.Skipped == 0 && len(result.Rejected) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// pushFormat selects the payload format from the Content-Type, detecting it
+// from the body when the type is missing or generic
+func pushFormat(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return scanner.PayloadJSON
+	case "text/csv":
+		return scanner.PayloadCSV
+	}
+	return scanner.PayloadAuto
+}
@@ -0,0 +1,121 @@
+// gRPC ingest service of the serve command. The Go stubs in sensordatav1 are
+// generated from this file by go generate; generate client stubs the same way.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ingest.proto
+
+package sensordatav1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ReadingIngest_WriteReadings_FullMethodName = "/sensordata.v1.ReadingIngest/WriteReadings"
+)
+
+// ReadingIngestClient is the client API for ReadingIngest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ReadingIngestClient interface {
+	// WriteReadings inserts the readings of every request on the stream and
+	// answers with the statistics of the stream once the client closes it.
+	WriteReadings(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[WriteReadingsRequest, WriteReadingsResponse], error)
+}
+
+type readingIngestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReadingIngestClient(cc grpc.ClientConnInterface) ReadingIngestClient {
+	return &readingIngestClient{cc}
+}
+
+func (c *readingIngestClient) WriteReadings(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[WriteReadingsRequest, WriteReadingsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ReadingIngest_ServiceDesc.Streams[0], ReadingIngest_WriteReadings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WriteReadingsRequest, WriteReadingsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ReadingIngest_WriteReadingsClient = grpc.ClientStreamingClient[WriteReadingsRequest, WriteReadingsResponse]
+
+// ReadingIngestServer is the server API for ReadingIngest service.
+// All implementations must embed UnimplementedReadingIngestServer
+// for forward compatibility.
+type ReadingIngestServer interface {
+	// WriteReadings inserts the readings of every request on the stream and
+	// answers with the statistics of the stream once the client closes it.
+	WriteReadings(grpc.ClientStreamingServer[WriteReadingsRequest, WriteReadingsResponse]) error
+	mustEmbedUnimplementedReadingIngestServer()
+}
+
+// UnimplementedReadingIngestServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedReadingIngestServer struct{}
+
+func (UnimplementedReadingIngestServer) WriteReadings(grpc.ClientStreamingServer[WriteReadingsRequest, WriteReadingsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WriteReadings not implemented")
+}
+func (UnimplementedReadingIngestServer) mustEmbedUnimplementedReadingIngestServer() {}
+func (UnimplementedReadingIngestServer) testEmbeddedByValue()                       {}
+
+// UnsafeReadingIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReadingIngestServer will
+// result in compilation errors.
+type UnsafeReadingIngestServer interface {
+	mustEmbedUnimplementedReadingIngestServer()
+}
+
+func RegisterReadingIngestServer(s grpc.ServiceRegistrar, srv ReadingIngestServer) {
+	// If the following call pancis, it indicates UnimplementedReadingIngestServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ReadingIngest_ServiceDesc, srv)
+}
+
+func _ReadingIngest_WriteReadings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ReadingIngestServer).WriteReadings(&grpc.GenericServerStream[WriteReadingsRequest, WriteReadingsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ReadingIngest_WriteReadingsServer = grpc.ClientStreamingServer[WriteReadingsRequest, WriteReadingsResponse]
+
+// ReadingIngest_ServiceDesc is the grpc.ServiceDesc for ReadingIngest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ReadingIngest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sensordata.v1.ReadingIngest",
+	HandlerType: (*ReadingIngestServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WriteReadings",
+			Handler:       _ReadingIngest_WriteReadings_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingest.proto",
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/database"
+	"sensor_data_import/logger"
+	"sensor_data_import/scanner"
+	"sensor_data_import/sensorquery"
+)
+
+// shutdownTimeout bounds how long requests in progress may take to finish
+// once the server is stopped
+const shutdownTimeout = 30 * time.Second
+
+// Server serves the HTTP API
+type Server struct {
+	cfg      config.ServerConfig
+	mux      *http.ServeMux
+	scanner  *scanner.CSVScanner // Parses and inserts pushed readings
+	readings *sensorquery.Source // Exported readings; nil without a database
+	schema   *schemaGate         // Refuses ingest while migrations are pending; nil when not checked
+	settings runtimeSettings     // Changed by the admin API until the configuration is reloaded
+
+	loadConfig func() (*config.Config, error) // Reloads the configuration; nil when not supported
+}
+
+// New creates a server with all API routes registered. Pushed readings are
+// parsed and validated with the settings of csvScanner.
+func New(cfg config.ServerConfig, csvScanner *scanner.CSVScanner) *Server {
+	s := &Server{cfg: cfg, mux: http.NewServeMux(), scanner: csvScanner, readings: database.ReadingSource()}
+	s.settings.configured = Settings{LogLevel: logger.Level(), ExportWorkers: cfg.ExportWorkers, RateLimit: cfg.RateLimit}
+	s.settings.current = s.settings.configured
+	if csvScanner != nil {
+		csvScanner.SetPushRateLimit(cfg.RateLimit)
+	}
+	s.mux.HandleFunc("GET "+healthPath, s.handleHealth)
+	s.mux.HandleFunc("GET /api/v1/export", s.authorized(s.handleExport))
+	s.mux.HandleFunc("GET /api/v1/export/states", s.authorized(s.handleListExportStates))
+	s.mux.HandleFunc("DELETE /api/v1/export/states/{name}", s.authorized(s.handleDeleteExportState))
+	s.mux.HandleFunc("POST /api/v1/readings", s.authorized(s.handleReadings))
+	s.mux.HandleFunc("GET /api/v1/annotations", s.authorized(s.handleListAnnotations))
+	s.mux.HandleFunc("POST /api/v1/annotations", s.authorized(s.handleCreateAnnotation))
+	s.mux.HandleFunc("DELETE /api/v1/annotations/{id}", s.authorized(s.handleDeleteAnnotation))
+	s.mux.HandleFunc("GET /api/v1/exclusions", s.authorized(s.handleListExclusions))
+	s.mux.HandleFunc("POST /api/v1/exclusions", s.authorized(s.handleCreateExclusion))
+	s.mux.HandleFunc("DELETE /api/v1/exclusions/{id}", s.authorized(s.handleRevokeExclusion))
+	s.mux.HandleFunc("GET /grafana", s.authorized(s.handleGrafanaPing))
+	s.mux.HandleFunc("GET /grafana/{$}", s.authorized(s.handleGrafanaPing))
+	s.mux.HandleFunc("POST /grafana/annotations", s.authorized(s.handleGrafanaAnnotations))
+	s.mux.Handle("GET /dashboard/", dashboardFiles())
+	s.mux.HandleFunc("GET /api/v1/dashboard", s.authorized(s.handleDashboard))
+	s.mux.HandleFunc("GET /api/v1/admin/settings", s.admin(s.handleGetSettings))
+	s.mux.HandleFunc("PATCH /api/v1/admin/settings", s.admin(s.handleChangeSettings))
+	s.mux.HandleFunc("POST /api/v1/admin/reload", s.admin(s.handleReload))
+	s.mux.Handle("POST /sensordata.v1.ReadingIngest/WriteReadings", s.newGRPCServer())
+	return s
+}
+
+// Run serves requests until ctx is cancelled, then waits for the requests in
+// progress to finish
+func (s *Server) Run(ctx context.Context) error {
+	// Without a token anyone reaching the port could write and delete readings
+	if s.cfg.APIToken == "" && !isLoopback(s.cfg.Listen) {
+		return fmt.Errorf("server.api_token is required to listen on %s: set a token or listen on a loopback address such as 127.0.0.1:8080", s.cfg.Listen)
+	}
+	if err := s.ingestReady(); err != nil {
+		logger.Warnf("%v\n", err)
+	}
+	if err := s.scanner.BeginPush(); err != nil {
+		return err
+	}
+	defer s.scanner.EndPush()
+
+	// gRPC clients speak HTTP/2 without TLS on the same port
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	httpServer := &http.Server{
+		Addr:              s.cfg.Listen,
+		Handler:           s.logged(s.mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		Protocols:         protocols,
+		HTTP2:             &http.HTTP2Config{MaxConcurrentStreams: s.cfg.MaxStreams},
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.ListenAndServe()
+	}()
+	logger.Printf("Serving the HTTP API on %s, with the dashboard at /dashboard/\n", s.cfg.Listen)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("HTTP server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	logger.Println("Stopping the HTTP API")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to stop HTTP server: %w", err)
+	}
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("HTTP server failed: %w", err)
+	}
+	return nil
+}
+
+// authorized rejects requests without the configured bearer token
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.hasToken(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hasToken reports whether a request carries the configured bearer token,
+// or no token is configured
+func (s *Server) hasToken(r *http.Request) bool {
+	return s.validToken(r.Header.Get("Authorization"))
+}
+
+// validToken reports whether an Authorization header holds the configured
+// bearer token, or no token is configured
+func (s *Server) validToken(header string) bool {
+	if s.cfg.APIToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.APIToken)) == 1
+}
+
+// isLoopback reports whether a listen address only accepts connections from
+// this host. An empty host listens on every interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// logged logs every request with its status and duration, except health
+// checks
+func (s *Server) logged(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		logger.Printf("%s %s %s: %d in %v\n", r.RemoteAddr, r.Method, r.URL.RequestURI(),
+			recorder.status, time.Since(start).Round(time.Millisecond))
+	})
+}
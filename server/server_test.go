@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sensor_data_import/config"
+	"sensor_data_import/scanner"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns a new SQLite database holding the tables of tables,
+// closed when the test ends
+func openTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "sensor.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	return db
+}
+
+// insertRows stores rows in db
+func insertRows[T any](t *testing.T, db *gorm.DB, rows ...T) []T {
+	t.Helper()
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatalf("insert %T: %v", rows, err)
+	}
+	return rows
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:8080", true},
+		{"localhost:8080", true},
+		{"[::1]:8080", true},
+		{":8080", false},
+		{"0.0.0.0:8080", false},
+		{"192.168.1.10:8080", false},
+		{"8080", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestRunRequiresTokenOffLoopback(t *testing.T) {
+	s := New(config.ServerConfig{Listen: ":8080"}, nil)
+	err := s.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "api_token") {
+		t.Errorf("Run without a token on all interfaces = %v, want an api_token error", err)
+	}
+}
+
+func TestIngestWaitsForPendingMigrations(t *testing.T) {
+	s := exportServer(t, config.ServerConfig{})
+	pending := []string{"20261019_030000"}
+	s.CheckSchema(func() ([]string, error) { return pending, nil })
+
+	request := func(handler http.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(method, target, strings.NewReader("2025-09-01T00:00:00Z,temp_01,1\n")))
+		return recorder
+	}
+	if response := request(s.handleReadings, http.MethodPost, "/api/v1/readings"); response.Code != http.StatusServiceUnavailable ||
+		!strings.Contains(response.Body.String(), "20261019_030000") {
+		t.Errorf("push with a pending migration: status %d, %q; want 503 naming it", response.Code, response.Body)
+	}
+	if response := request(s.handleHealth, http.MethodGet, healthPath); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("health with a pending migration: status %d, want 503", response.Code)
+	}
+
+	// Once migrate has run elsewhere, the next check opens the gate
+	pending = nil
+	s.schema.checked = time.Time{}
+	if response := request(s.handleHealth, http.MethodGet, healthPath); response.Code != http.StatusOK ||
+		!strings.Contains(response.Body.String(), `"schema":"current"`) {
+		t.Errorf("health after migrating: status %d, %q; want 200 and a current schema", response.Code, response.Body)
+	}
+	if err := s.ingestReady(); err != nil {
+		t.Errorf("ingest after migrating: %v", err)
+	}
+}
+
+func TestPausedServerRefusesPushes(t *testing.T) {
+	s := exportServer(t, config.ServerConfig{})
+	s.scanner = scanner.NewCSVScanner(nil)
+	s.scanner.Pause()
+
+	recorder := httptest.NewRecorder()
+	s.handleReadings(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/readings", strings.NewReader("2025-09-01T00:00:00Z,temp_01,1\n")))
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "paused") {
+		t.Errorf("push while paused: status %d, %q; want 503", recorder.Code, recorder.Body)
+	}
+
+	s.scanner.Resume()
+	if err := s.ingestReady(); err != nil {
+		t.Errorf("ingest after resume: %v", err)
+	}
+}